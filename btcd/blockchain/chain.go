@@ -63,6 +63,7 @@ type BestState struct {
 	Hash        chainhash.Hash // The hash of the block.
 	Height      int32          // The height of the block.
 	Bits        uint32         // The difficulty bits of the block.
+	Timestamp   time.Time      // The timestamp of the block.
 	BlockSize   uint64         // The size of the block.
 	BlockWeight uint64         // The weight of the block.
 	NumTxns     uint64         // The number of txns in the block.
@@ -78,6 +79,7 @@ func newBestState(node *blockNode, blockSize, blockWeight, numTxns,
 		Hash:        node.hash,
 		Height:      node.height,
 		Bits:        node.bits,
+		Timestamp:   time.Unix(node.timestamp, 0),
 		BlockSize:   blockSize,
 		BlockWeight: blockWeight,
 		NumTxns:     numTxns,
@@ -102,6 +104,11 @@ type BlockChain struct {
 	sigCache            *txscript.SigCache
 	indexManager        IndexManager
 	hashCache           *txscript.HashCache
+	scriptCache         *ScriptCache
+
+	// maxScriptValidationWorkers is the maximum number of goroutines used
+	// to validate the scripts of a block, or zero to use three per core.
+	maxScriptValidationWorkers int
 
 	// The following fields are calculated based upon the provided chain
 	// parameters.  They are also set when the instance is created and
@@ -147,6 +154,11 @@ type BlockChain struct {
 	nextCheckpoint *chaincfg.Checkpoint
 	checkpointNode *blockNode
 
+	// finalized is the last block decided by the consensus of the VM, nil
+	// until it is set.  Reorganizations processing blocks never disconnect
+	// it or its ancestors.  It is protected by the chain lock.
+	finalized *blockNode
+
 	// The state is used as a fairly efficient way to cache information
 	// about the current best chain state that is returned to callers when
 	// requested.  It operates on the principle of MVCC such that any time a
@@ -699,6 +711,12 @@ func (b *BlockChain) connectBlock(node *blockNode, block *btcutil.Block,
 	b.stateSnapshot = state
 	b.stateLock.Unlock()
 
+	// The transactions of the block won't be validated again unless it is
+	// disconnected, so their script cache entries are no longer needed.
+	if b.scriptCache != nil {
+		b.scriptCache.Purge(block.Transactions())
+	}
+
 	// Notify the caller that the block was connected to the main chain.
 	// The caller would typically want to react with actions such as
 	// updating wallets.
@@ -1265,6 +1283,19 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *btcutil.Block, fla
 		return false, nil
 	}
 
+	// The side chain has more work, but becoming the main chain would
+	// disconnect finalized blocks, so it is only stored.
+	if b.finalized != nil {
+		fork := b.bestChain.FindFork(node)
+		finalizedFork := b.bestChain.FindFork(b.finalized)
+		if fork != nil && finalizedFork != nil && fork.height < finalizedFork.height {
+			log.Warnf("Block %v does not cause a reorganize: the side "+
+				"chain forks at height %d, below finalized block %v",
+				node.hash, fork.height, b.finalized.hash)
+			return false, nil
+		}
+	}
+
 	// We're extending (or creating) a side chain and the cumulative work
 	// for this new side chain is more than the old best chain, so this side
 	// chain needs to become the main chain.  In order to accomplish that,
@@ -1465,6 +1496,63 @@ func (b *BlockChain) HeaderByHash(hash *chainhash.Hash) (wire.BlockHeader, error
 	return node.Header(), nil
 }
 
+// IndexedHeader is a main chain block header read from the block index, along
+// with the hash and height of its block.
+type IndexedHeader struct {
+	Hash   chainhash.Hash
+	Height int32
+	Header wire.BlockHeader
+}
+
+// MainChainHeaders returns the headers of up to count main chain blocks
+// starting at startHeight, fewer if the main chain ends before.  The headers
+// are read from the block index, which keeps them in memory, so the block
+// data is never loaded.  An error is returned if there is no main chain block
+// at startHeight.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) MainChainHeaders(startHeight int32, count int) ([]IndexedHeader, error) {
+	// Grab a lock on the chain view to prevent it from changing due to a
+	// reorg while reading the headers.
+	b.bestChain.mtx.Lock()
+	defer b.bestChain.mtx.Unlock()
+
+	if b.bestChain.nodeByHeight(startHeight) == nil {
+		str := fmt.Sprintf("no block at height %d exists", startHeight)
+		return nil, errNotInMainChain(str)
+	}
+
+	count = min(count, int(b.bestChain.tip().height-startHeight)+1)
+	headers := make([]IndexedHeader, 0, max(count, 0))
+	for height := startHeight; len(headers) < count; height++ {
+		node := b.bestChain.nodeByHeight(height)
+		headers = append(headers, IndexedHeader{
+			Hash:   node.hash,
+			Height: node.height,
+			Header: node.Header(),
+		})
+	}
+	return headers, nil
+}
+
+// SetFinalizedBlock marks the block with the given hash as decided by the
+// consensus of the VM.  Processing blocks never reorganizes the chain in a way
+// that disconnects it or its ancestors, even if a side chain has more work.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SetFinalizedBlock(hash *chainhash.Hash) error {
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		str := fmt.Sprintf("block %s is not known", hash)
+		return errBlockNotStored(str)
+	}
+
+	b.chainLock.Lock()
+	b.finalized = node
+	b.chainLock.Unlock()
+	return nil
+}
+
 // MainChainHasBlock returns whether or not the block with the given hash is in
 // the main chain.
 //
@@ -1515,6 +1603,29 @@ func (b *BlockChain) BlockHeightByHash(hash *chainhash.Hash) (int32, error) {
 	return node.height, nil
 }
 
+// BlockHeightByHashAny returns the height of the block with the given hash in
+// the main chain or a side chain. An error is returned if the block data is
+// not stored or the block is known to be invalid.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BlockHeightByHashAny(hash *chainhash.Hash) (int32, error) {
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		str := fmt.Sprintf("block %s is not known", hash)
+		return 0, errBlockNotStored(str)
+	}
+
+	status := b.index.NodeStatus(node)
+	if !status.HaveData() {
+		str := fmt.Sprintf("block %s header exists but data is not stored", hash)
+		return 0, errBlockNotStored(str)
+	}
+	if status.KnownInvalid() {
+		return 0, fmt.Errorf("block %s is known to be invalid", hash)
+	}
+	return node.height, nil
+}
+
 // BlockHashByHeight returns the hash of the block at the given height in the
 // main chain.
 //
@@ -2132,10 +2243,25 @@ type Config struct {
 	// signature cache.
 	HashCache *txscript.HashCache
 
+	// ScriptCache defines a cache of the transactions whose scripts were
+	// validated, shared with the mempool so that the scripts of the
+	// transactions of a block that were accepted to the mempool are not
+	// executed again.
+	//
+	// This field can be nil if the caller is not interested in using a
+	// script cache.
+	ScriptCache *ScriptCache
+
 	// Prune specifies the target database usage (in bytes) the database
 	// will target for with block files.  Prune at 0 specifies that no
 	// blocks will be deleted.
 	Prune uint64
+
+	// MaxScriptValidationWorkers is the maximum number of goroutines used
+	// to validate the scripts of a block.
+	//
+	// This field can be zero to use three goroutines per processor core.
+	MaxScriptValidationWorkers int
 }
 
 // New returns a BlockChain instance using the provided configuration details.
@@ -2187,12 +2313,15 @@ func New(config *Config) (*BlockChain, error) {
 		index:               newBlockIndex(config.DB, params),
 		utxoCache:           newUtxoCache(config.DB, config.UtxoCacheMaxSize),
 		hashCache:           config.HashCache,
+		scriptCache:         config.ScriptCache,
 		bestChain:           newChainView(nil),
 		orphans:             make(map[chainhash.Hash]*orphanBlock),
 		prevOrphans:         make(map[chainhash.Hash][]*orphanBlock),
 		warningCaches:       newThresholdCaches(vbNumBits),
 		deploymentCaches:    newThresholdCaches(chaincfg.DefinedDeployments),
 		pruneTarget:         config.Prune,
+
+		maxScriptValidationWorkers: config.MaxScriptValidationWorkers,
 	}
 
 	// Ensure all the deployments are synchronized with our clock if
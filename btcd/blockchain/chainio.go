@@ -7,6 +7,7 @@ package blockchain
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/big"
 	"sync"
@@ -92,6 +93,24 @@ func isNotInMainChainErr(err error) bool {
 	return ok
 }
 
+// errBlockNotStored signifies that the data of a block that is not known, or
+// whose header only is known, was requested.
+type errBlockNotStored string
+
+// Error implements the error interface.
+func (e errBlockNotStored) Error() string {
+	return string(e)
+}
+
+// IsBlockNotFoundErr returns whether or not the passed error, or an error it
+// wraps, signifies that a requested block is not in the main chain or is not
+// stored.
+func IsBlockNotFoundErr(err error) bool {
+	var notInMainChain errNotInMainChain
+	var notStored errBlockNotStored
+	return errors.As(err, &notInMainChain) || errors.As(err, &notStored)
+}
+
 // errDeserialize signifies that a problem was encountered when deserializing
 // data.
 type errDeserialize string
@@ -1521,12 +1540,14 @@ func (b *BlockChain) BlockByHashAny(hash *chainhash.Hash) (*btcutil.Block, error
 	// Lookup the block hash in block index (checks ALL blocks)
 	node := b.index.LookupNode(hash)
 	if node == nil {
-		return nil, fmt.Errorf("block %s is not known", hash)
+		str := fmt.Sprintf("block %s is not known", hash)
+		return nil, errBlockNotStored(str)
 	}
 
 	// Verify the block data is actually stored (not just header-only)
 	if !b.index.NodeStatus(node).HaveData() {
-		return nil, fmt.Errorf("block %s header exists but data is not stored", hash)
+		str := fmt.Sprintf("block %s header exists but data is not stored", hash)
+		return nil, errBlockNotStored(str)
 	}
 
 	// Load the block from the database and return it.
@@ -0,0 +1,179 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/database"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+)
+
+// The functions in this file read the chain state of a block database directly,
+// without loading the block index, so that the database of a stopped node can
+// be inspected while it is opened read-only.
+
+// DBChainState is the best chain state stored in a block database.
+type DBChainState struct {
+	// Hash and Height are the hash and the height of the tip of the main
+	// chain.
+	Hash   chainhash.Hash
+	Height int32
+
+	// TotalTxns is the number of transactions in the main chain.
+	TotalTxns uint64
+
+	// UtxoHash is the hash of the block up to which the utxo set in the
+	// database is consistent, which lags behind the tip when the utxo cache
+	// was not flushed before the node stopped.  It is nil when the utxo set
+	// is consistent with the tip.
+	UtxoHash *chainhash.Hash
+}
+
+// DBStats are the numbers of entries of a block database.
+type DBStats struct {
+	// Blocks is the number of blocks in the block index, which includes the
+	// blocks of side chains.
+	Blocks uint64
+
+	// Utxos is the number of unspent transaction outputs in the utxo set.
+	Utxos uint64
+}
+
+// errChainNotInitialized is returned when a block database has no chain state.
+func errChainNotInitialized() error {
+	return database.Error{
+		ErrorCode:   database.ErrCorruption,
+		Description: "chain state not found -- the chain is not initialized",
+	}
+}
+
+// DBFetchChainState returns the best chain state stored in db.
+func DBFetchChainState(db database.DB) (*DBChainState, error) {
+	var chainState *DBChainState
+	err := db.View(func(dbTx database.Tx) error {
+		serializedData := dbTx.Metadata().Get(chainStateKeyName)
+		if serializedData == nil {
+			return errChainNotInitialized()
+		}
+		state, err := deserializeBestChainState(serializedData)
+		if err != nil {
+			return err
+		}
+
+		chainState = &DBChainState{
+			Hash:      state.hash,
+			Height:    int32(state.height),
+			TotalTxns: state.totalTxns,
+		}
+		if utxoHash := dbFetchUtxoStateConsistency(dbTx); utxoHash != nil {
+			hash, err := chainhash.NewHash(utxoHash)
+			if err != nil {
+				return database.Error{
+					ErrorCode:   database.ErrCorruption,
+					Description: fmt.Sprintf("corrupt utxo state consistency: %v", err),
+				}
+			}
+			if *hash != state.hash {
+				chainState.UtxoHash = hash
+			}
+		}
+		return nil
+	})
+	return chainState, err
+}
+
+// DBFetchBlockByHeight returns the block at the passed height of the main chain
+// stored in db.
+func DBFetchBlockByHeight(db database.DB, height int32) (*btcutil.Block, error) {
+	var block *btcutil.Block
+	err := db.View(func(dbTx database.Tx) error {
+		hash, err := dbFetchHashByHeight(dbTx, height)
+		if err != nil {
+			return err
+		}
+		block, err = dbFetchBlock(dbTx, hash)
+		if err != nil {
+			return err
+		}
+		block.SetHeight(height)
+		return nil
+	})
+	return block, err
+}
+
+// DBFetchBlockByHash returns the block of the main chain with the passed hash
+// stored in db.
+func DBFetchBlockByHash(db database.DB, hash *chainhash.Hash) (*btcutil.Block, error) {
+	var block *btcutil.Block
+	err := db.View(func(dbTx database.Tx) error {
+		height, err := dbFetchHeightByHash(dbTx, hash)
+		if err != nil {
+			return err
+		}
+		block, err = dbFetchBlock(dbTx, hash)
+		if err != nil {
+			return err
+		}
+		block.SetHeight(height)
+		return nil
+	})
+	return block, err
+}
+
+// dbFetchBlock uses an existing database transaction to fetch the block with
+// the passed hash.
+func dbFetchBlock(dbTx database.Tx, hash *chainhash.Hash) (*btcutil.Block, error) {
+	blockBytes, err := dbTx.FetchBlock(hash)
+	if err != nil {
+		return nil, err
+	}
+	return btcutil.NewBlockFromBytes(blockBytes)
+}
+
+// DBFetchUtxoEntry returns the unspent transaction output referenced by the
+// passed outpoint in the utxo set stored in db.  When the output is not in the
+// utxo set, nil will be returned for both the entry and the error.
+func DBFetchUtxoEntry(db database.DB, outpoint wire.OutPoint) (*UtxoEntry, error) {
+	var entry *UtxoEntry
+	err := db.View(func(dbTx database.Tx) error {
+		utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+		if utxoBucket == nil {
+			return errChainNotInitialized()
+		}
+		var err error
+		entry, err = dbFetchUtxoEntry(dbTx, utxoBucket, outpoint)
+		return err
+	})
+	return entry, err
+}
+
+// DBFetchStats counts the entries of the block index and the utxo set stored
+// in db.  It iterates both, so it takes a while for large chains.
+func DBFetchStats(db database.DB) (*DBStats, error) {
+	var stats DBStats
+	err := db.View(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		blockIndex := meta.Bucket(blockIndexBucketName)
+		utxoBucket := meta.Bucket(utxoSetBucketName)
+		if blockIndex == nil || utxoBucket == nil {
+			return errChainNotInitialized()
+		}
+
+		err := blockIndex.ForEach(func(_, _ []byte) error {
+			stats.Blocks++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return utxoBucket.ForEach(func(_, _ []byte) error {
+			stats.Utxos++
+			return nil
+		})
+	})
+	return &stats, err
+}
@@ -137,8 +137,9 @@ func calcNextRequiredDifficulty(lastNode HeaderCtx, newBlockTime time.Time,
 	c ChainCtx) (uint32, error) {
 
 	// Emulate the same behavior as Bitcoin Core that for regtest there is
-	// no difficulty retargeting.
-	if c.ChainParams().PoWNoRetargeting {
+	// no difficulty retargeting.  Networks without proof of work always use
+	// the minimum difficulty.
+	if c.ChainParams().PoWNoRetargeting || c.ChainParams().PoWDisabled {
 		return c.ChainParams().PowLimitBits, nil
 	}
 
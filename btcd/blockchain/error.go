@@ -56,8 +56,9 @@ const (
 	ErrInvalidTime
 
 	// ErrTimeTooOld indicates the time is either before the median time of
-	// the last several blocks per the chain consensus rules or prior to the
-	// most recent checkpoint.
+	// the last several blocks, or the time of the previous block on
+	// networks with monotonic timestamps, per the chain consensus rules or
+	// prior to the most recent checkpoint.
 	ErrTimeTooOld
 
 	// ErrTimeTooNew indicates the time is too far in the future as compared
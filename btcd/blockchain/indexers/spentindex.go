@@ -0,0 +1,279 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package indexers
+
+import (
+	"fmt"
+
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/database"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+)
+
+const (
+	// spentIndexName is the human-readable name for the index.
+	spentIndexName = "spent output index"
+
+	// spentKeySize is the size of a serialized outpoint key of the spent
+	// output index.
+	spentKeySize = chainhash.HashSize + 4
+
+	// spentEntryMinSize is the size of a serialized spent output index
+	// entry without the script of the spent output.
+	spentEntryMinSize = chainhash.HashSize + 4 + 4 + 8
+)
+
+var (
+	// spentIndexKey is the key of the spent output index and the db bucket
+	// used to house it.
+	spentIndexKey = []byte("spentbyoutpointidx")
+)
+
+// -----------------------------------------------------------------------------
+// The spent output index consists of an entry for every output spent by a
+// transaction in the main chain, keyed by the outpoint of the output.  Each
+// entry records the transaction spending the output along with the spent
+// output itself, so that the inputs of a transaction can be described without
+// looking up the transactions they spend.
+//
+// The serialized format for the keys and values in the spent index bucket is:
+//
+//   <outpoint> = <spending txhash><input index><block height><amount><pkscript>
+//
+//   Field           Type              Size
+//   outpoint        wire.OutPoint     36 bytes
+//   spending txhash chainhash.Hash    32 bytes
+//   input index     uint32            4 bytes
+//   block height    uint32            4 bytes
+//   amount          int64             8 bytes
+//   pkscript        []byte            variable
+//   -----
+//   Total: 84 bytes + pkscript
+// -----------------------------------------------------------------------------
+
+// SpentInfo describes an output spent by a transaction in the main chain.
+type SpentInfo struct {
+	// TxHash and InputIndex are the hash of the spending transaction and
+	// the index of its input spending the output.
+	TxHash     chainhash.Hash
+	InputIndex uint32
+
+	// Height is the height of the block containing the spending
+	// transaction.
+	Height int32
+
+	// Amount and PkScript are the amount and the public key script of the
+	// spent output.
+	Amount   int64
+	PkScript []byte
+}
+
+// spentIndexKeyFor returns the key of the spent output index entry of the
+// passed outpoint.
+func spentIndexKeyFor(op *wire.OutPoint) []byte {
+	key := make([]byte, spentKeySize)
+	copy(key, op.Hash[:])
+	byteOrder.PutUint32(key[chainhash.HashSize:], op.Index)
+	return key
+}
+
+// serializeSpentInfo returns the serialized spent output index entry of the
+// passed spent info.
+func serializeSpentInfo(info *SpentInfo) []byte {
+	serialized := make([]byte, spentEntryMinSize+len(info.PkScript))
+	offset := copy(serialized, info.TxHash[:])
+	byteOrder.PutUint32(serialized[offset:], info.InputIndex)
+	byteOrder.PutUint32(serialized[offset+4:], uint32(info.Height))
+	byteOrder.PutUint64(serialized[offset+8:], uint64(info.Amount))
+	copy(serialized[spentEntryMinSize:], info.PkScript)
+	return serialized
+}
+
+// deserializeSpentInfo decodes a spent output index entry serialized by
+// serializeSpentInfo.
+func deserializeSpentInfo(serialized []byte) (*SpentInfo, error) {
+	if len(serialized) < spentEntryMinSize {
+		return nil, errDeserialize("unexpected end of data")
+	}
+
+	var info SpentInfo
+	offset := copy(info.TxHash[:], serialized)
+	info.InputIndex = byteOrder.Uint32(serialized[offset:])
+	info.Height = int32(byteOrder.Uint32(serialized[offset+4:]))
+	info.Amount = int64(byteOrder.Uint64(serialized[offset+8:]))
+	info.PkScript = append([]byte(nil), serialized[spentEntryMinSize:]...)
+	return &info, nil
+}
+
+// SpentIndex implements an index of the outputs spent by the transactions in
+// the main chain.  That is to say, it supports querying the transaction
+// spending an output by its outpoint.
+type SpentIndex struct {
+	db database.DB
+}
+
+// Ensure the SpentIndex type implements the Indexer interface.
+var _ Indexer = (*SpentIndex)(nil)
+
+// Ensure the SpentIndex type implements the NeedsInputser interface.
+var _ NeedsInputser = (*SpentIndex)(nil)
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to record the spent outputs.
+//
+// This implements the NeedsInputser interface.
+func (idx *SpentIndex) NeedsInputs() bool {
+	return true
+}
+
+// Init is only provided to satisfy the Indexer interface as there is nothing to
+// initialize for this index.
+//
+// This is part of the Indexer interface.
+func (idx *SpentIndex) Init() error {
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *SpentIndex) Key() []byte {
+	return spentIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *SpentIndex) Name() string {
+	return spentIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs to be
+// created for the first time.  It creates the bucket for the spent output
+// index.
+//
+// This is part of the Indexer interface.
+func (idx *SpentIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(spentIndexKey)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer adds an entry for every output
+// spent by the transactions in the block, which are all written in the
+// database transaction of the block.
+//
+// This is part of the Indexer interface.
+func (idx *SpentIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	spentIndex := dbTx.Metadata().Bucket(spentIndexKey)
+	stxoIndex := 0
+	for _, tx := range block.Transactions()[1:] {
+		for i, txIn := range tx.MsgTx().TxIn {
+			if stxoIndex >= len(stxos) {
+				return AssertError(fmt.Sprintf("missing spent "+
+					"output of input %d of transaction %v",
+					i, tx.Hash()))
+			}
+			stxo := stxos[stxoIndex]
+			stxoIndex++
+
+			serialized := serializeSpentInfo(&SpentInfo{
+				TxHash:     *tx.Hash(),
+				InputIndex: uint32(i),
+				Height:     block.Height(),
+				Amount:     stxo.Amount,
+				PkScript:   stxo.PkScript,
+			})
+			key := spentIndexKeyFor(&txIn.PreviousOutPoint)
+			if err := spentIndex.Put(key, serialized); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the entries of the
+// outputs spent by the transactions in the block, which are unspent again.
+//
+// This is part of the Indexer interface.
+func (idx *SpentIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	spentIndex := dbTx.Metadata().Bucket(spentIndexKey)
+	for _, tx := range block.Transactions()[1:] {
+		for _, txIn := range tx.MsgTx().TxIn {
+			key := spentIndexKeyFor(&txIn.PreviousOutPoint)
+			if err := spentIndex.Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// SpentInfo returns how the output referenced by the passed outpoint was spent
+// in the main chain.  When the output is not spent in the main chain, nil will
+// be returned for both the info and the error.
+//
+// This function is safe for concurrent access.
+func (idx *SpentIndex) SpentInfo(op *wire.OutPoint) (*SpentInfo, error) {
+	var info *SpentInfo
+	err := idx.db.View(func(dbTx database.Tx) error {
+		serialized := dbTx.Metadata().Bucket(spentIndexKey).Get(
+			spentIndexKeyFor(op))
+		if serialized == nil {
+			return nil
+		}
+
+		var err error
+		info, err = deserializeSpentInfo(serialized)
+		if err != nil {
+			return database.Error{
+				ErrorCode: database.ErrCorruption,
+				Description: fmt.Sprintf("corrupt spent output "+
+					"index entry for %v: %v", op, err),
+			}
+		}
+		return nil
+	})
+	return info, err
+}
+
+// NewSpentIndex returns a new instance of an indexer that is used to create a
+// mapping of the outputs spent by the transactions in the blockchain to the
+// transactions spending them.
+//
+// It implements the Indexer interface which plugs into the IndexManager that in
+// turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewSpentIndex(db database.DB) *SpentIndex {
+	return &SpentIndex{db: db}
+}
+
+// DropSpentIndex drops the spent output index from the provided database if it
+// exists.  It is rebuilt from the genesis block the next time it is enabled.
+func DropSpentIndex(db database.DB, interrupt <-chan struct{}) error {
+	return dropIndex(db, spentIndexKey, spentIndexName, interrupt)
+}
+
+// SpentIndexInitialized returns true if the spent output index has been created
+// previously.
+func SpentIndexInitialized(db database.DB) bool {
+	var exists bool
+	db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(spentIndexKey)
+		exists = bucket != nil
+		return nil
+	})
+
+	return exists
+}
@@ -0,0 +1,147 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+)
+
+// scriptCacheEntry represents an entry in the ScriptCache.  The scripts of a
+// transaction only depend on the transaction and on the amounts and public key
+// scripts of the outputs it spends, so an entry records the hash of the spent
+// outputs the scripts were validated against along with the script flags they
+// were validated with.
+type scriptCacheEntry struct {
+	prevOutsHash chainhash.Hash
+	flags        txscript.ScriptFlags
+}
+
+// ScriptCache implements a cache of the transactions whose scripts were
+// validated, keyed by witness hash, with a randomized entry eviction policy.
+// It is shared between the mempool, the block template generator and block
+// validation, so that the scripts of a transaction that was validated when it
+// was accepted to the mempool are not executed again when it is included in a
+// block template and when the block is validated.
+//
+// An entry only matches a transaction spending the same outputs it was
+// validated against, so entries are invalidated when the outputs a transaction
+// spends change, such as when a reorganization replaces the transaction that
+// created them.  An entry also only matches when its transaction was validated
+// with at least the requested script flags.  Since every script flag only adds
+// restrictions, scripts valid under the standard verification flags of the
+// mempool are valid under the consensus flags of blocks.
+type ScriptCache struct {
+	sync.RWMutex
+	validTxns  map[chainhash.Hash]scriptCacheEntry
+	maxEntries uint
+}
+
+// NewScriptCache creates and initializes a new instance of ScriptCache.  Its
+// sole parameter 'maxEntries' represents the maximum number of entries allowed
+// to exist in the ScriptCache at any particular moment.  Random entries are
+// evicted to make room for new entries that would cause the number of entries
+// in the cache to exceed the max.
+func NewScriptCache(maxEntries uint) *ScriptCache {
+	return &ScriptCache{
+		validTxns:  make(map[chainhash.Hash]scriptCacheEntry),
+		maxEntries: maxEntries,
+	}
+}
+
+// calcPrevOutsHash returns the hash of the amounts and public key scripts of
+// the outputs spent by the passed transaction in the passed utxo view.  False
+// is returned when the view does not contain one of the spent outputs.
+//
+// The outputs may be marked spent, since block validation connects the
+// transactions of a block to the view before validating their scripts.
+func calcPrevOutsHash(tx *btcutil.Tx, utxoView *UtxoViewpoint) (chainhash.Hash, bool) {
+	var b bytes.Buffer
+	for _, txIn := range tx.MsgTx().TxIn {
+		entry := utxoView.LookupEntry(txIn.PreviousOutPoint)
+		if entry == nil {
+			return chainhash.Hash{}, false
+		}
+
+		var amount [8]byte
+		binary.LittleEndian.PutUint64(amount[:], uint64(entry.Amount()))
+		b.Write(amount[:])
+		_ = wire.WriteVarBytes(&b, 0, entry.PkScript())
+	}
+	return chainhash.HashH(b.Bytes()), true
+}
+
+// Validated returns true if the scripts of the passed transaction were
+// validated against the outputs it spends in the passed utxo view with at
+// least the passed script flags.  Otherwise, false is returned.
+//
+// NOTE: This function is safe for concurrent access.
+func (c *ScriptCache) Validated(tx *btcutil.Tx, utxoView *UtxoViewpoint,
+	flags txscript.ScriptFlags) bool {
+
+	c.RLock()
+	entry, ok := c.validTxns[*tx.WitnessHash()]
+	c.RUnlock()
+	if !ok || entry.flags&flags != flags {
+		return false
+	}
+
+	prevOutsHash, ok := calcPrevOutsHash(tx, utxoView)
+	return ok && prevOutsHash == entry.prevOutsHash
+}
+
+// Add records that the scripts of the passed transaction are valid against the
+// outputs it spends in the passed utxo view under the passed script flags.  In
+// the event that the ScriptCache is 'full', an existing entry is randomly
+// chosen to be evicted in order to make space for the new entry.
+//
+// NOTE: This function is safe for concurrent access.
+func (c *ScriptCache) Add(tx *btcutil.Tx, utxoView *UtxoViewpoint,
+	flags txscript.ScriptFlags) {
+
+	if c.maxEntries == 0 {
+		return
+	}
+	prevOutsHash, ok := calcPrevOutsHash(tx, utxoView)
+	if !ok {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	wtxid := *tx.WitnessHash()
+	if _, ok := c.validTxns[wtxid]; !ok &&
+		uint(len(c.validTxns)+1) > c.maxEntries {
+
+		// Remove a random entry from the map, relying on the random
+		// starting point of Go's map iteration as the SigCache does.
+		for evicted := range c.validTxns {
+			delete(c.validTxns, evicted)
+			break
+		}
+	}
+	c.validTxns[wtxid] = scriptCacheEntry{
+		prevOutsHash: prevOutsHash,
+		flags:        flags,
+	}
+}
+
+// Purge removes the entries of the passed transactions, which are no longer
+// needed once the block including them is connected.
+//
+// NOTE: This function is safe for concurrent access.
+func (c *ScriptCache) Purge(txns []*btcutil.Tx) {
+	c.Lock()
+	for _, tx := range txns {
+		delete(c.validTxns, *tx.WitnessHash())
+	}
+	c.Unlock()
+}
@@ -34,6 +34,7 @@ type txValidator struct {
 	flags        txscript.ScriptFlags
 	sigCache     *txscript.SigCache
 	hashCache    *txscript.HashCache
+	maxWorkers   int
 }
 
 // sendResult sends the result of a script pair validation on the internal
@@ -123,9 +124,12 @@ func (v *txValidator) Validate(items []*txValidateItem) error {
 	}
 
 	// Limit the number of goroutines to do script validation based on the
-	// number of processor cores.  This helps ensure the system stays
-	// reasonably responsive under heavy load.
-	maxGoRoutines := runtime.NumCPU() * 3
+	// number of processor cores unless a limit was configured.  This helps
+	// ensure the system stays reasonably responsive under heavy load.
+	maxGoRoutines := v.maxWorkers
+	if maxGoRoutines <= 0 {
+		maxGoRoutines = runtime.NumCPU() * 3
+	}
 	if maxGoRoutines <= 0 {
 		maxGoRoutines = 1
 	}
@@ -174,9 +178,11 @@ func (v *txValidator) Validate(items []*txValidateItem) error {
 }
 
 // newTxValidator returns a new instance of txValidator to be used for
-// validating transaction scripts asynchronously.
+// validating transaction scripts asynchronously using up to maxWorkers
+// goroutines.  A maxWorkers of zero uses three goroutines per processor core.
 func newTxValidator(utxoView *UtxoViewpoint, flags txscript.ScriptFlags,
-	sigCache *txscript.SigCache, hashCache *txscript.HashCache) *txValidator {
+	sigCache *txscript.SigCache, hashCache *txscript.HashCache,
+	maxWorkers int) *txValidator {
 	return &txValidator{
 		validateChan: make(chan *txValidateItem),
 		quitChan:     make(chan struct{}),
@@ -185,14 +191,21 @@ func newTxValidator(utxoView *UtxoViewpoint, flags txscript.ScriptFlags,
 		sigCache:     sigCache,
 		hashCache:    hashCache,
 		flags:        flags,
+		maxWorkers:   maxWorkers,
 	}
 }
 
 // ValidateTransactionScripts validates the scripts for the passed transaction
-// using multiple goroutines.
+// using multiple goroutines.  When the script cache is present, the scripts of
+// a transaction it holds as validated against the same spent outputs are not
+// executed again, and the transaction is added to it once validated.
 func ValidateTransactionScripts(tx *btcutil.Tx, utxoView *UtxoViewpoint,
 	flags txscript.ScriptFlags, sigCache *txscript.SigCache,
-	hashCache *txscript.HashCache) error {
+	hashCache *txscript.HashCache, scriptCache *ScriptCache) error {
+
+	if scriptCache != nil && scriptCache.Validated(tx, utxoView, flags) {
+		return nil
+	}
 
 	// First determine if segwit is active according to the scriptFlags. If
 	// it isn't then we don't need to interact with the HashCache.
@@ -236,15 +249,26 @@ func ValidateTransactionScripts(tx *btcutil.Tx, utxoView *UtxoViewpoint,
 	}
 
 	// Validate all of the inputs.
-	validator := newTxValidator(utxoView, flags, sigCache, hashCache)
-	return validator.Validate(txValItems)
+	validator := newTxValidator(utxoView, flags, sigCache, hashCache, 0)
+	if err := validator.Validate(txValItems); err != nil {
+		return err
+	}
+
+	if scriptCache != nil {
+		scriptCache.Add(tx, utxoView, flags)
+	}
+	return nil
 }
 
 // checkBlockScripts executes and validates the scripts for all transactions in
-// the passed block using multiple goroutines.
+// the passed block using up to maxWorkers goroutines.  When the script cache is
+// present, the scripts of the transactions it holds as validated against the
+// same spent outputs, such as those accepted to the mempool, are skipped, and
+// the transactions of the block are added to it once validated.
 func checkBlockScripts(block *btcutil.Block, utxoView *UtxoViewpoint,
 	scriptFlags txscript.ScriptFlags, sigCache *txscript.SigCache,
-	hashCache *txscript.HashCache) error {
+	hashCache *txscript.HashCache, scriptCache *ScriptCache,
+	maxWorkers int) error {
 
 	// First determine if segwit is active according to the scriptFlags. If
 	// it isn't then we don't need to interact with the HashCache.
@@ -258,6 +282,9 @@ func checkBlockScripts(block *btcutil.Block, utxoView *UtxoViewpoint,
 	}
 	txValItems := make([]*txValidateItem, 0, numInputs)
 	for _, tx := range block.Transactions() {
+		if scriptCache != nil && scriptCache.Validated(tx, utxoView, scriptFlags) {
+			continue
+		}
 		hash := tx.Hash()
 
 		// If the HashCache is present, and it doesn't yet contain the
@@ -299,7 +326,8 @@ func checkBlockScripts(block *btcutil.Block, utxoView *UtxoViewpoint,
 	}
 
 	// Validate all of the inputs.
-	validator := newTxValidator(utxoView, scriptFlags, sigCache, hashCache)
+	validator := newTxValidator(utxoView, scriptFlags, sigCache, hashCache,
+		maxWorkers)
 	start := time.Now()
 	if err := validator.Validate(txValItems); err != nil {
 		return err
@@ -308,6 +336,12 @@ func checkBlockScripts(block *btcutil.Block, utxoView *UtxoViewpoint,
 
 	log.Tracef("block %v took %v to verify", block.Hash(), elapsed)
 
+	if scriptCache != nil {
+		for _, tx := range block.Transactions() {
+			scriptCache.Add(tx, utxoView, scriptFlags)
+		}
+	}
+
 	// If the HashCache is present, once we have validated the block, we no
 	// longer need the cached hashes for these transactions, so we purge
 	// them from the cache.
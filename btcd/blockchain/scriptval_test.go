@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
 	"github.com/MetalBlockchain/btcvm/btcd/txscript"
 )
 
@@ -38,9 +39,128 @@ func TestCheckBlockScripts(t *testing.T) {
 	}
 
 	scriptFlags := txscript.ScriptBip16
-	err = checkBlockScripts(blocks[0], view, scriptFlags, nil, nil)
+	err = checkBlockScripts(blocks[0], view, scriptFlags, nil, nil, nil, 0)
 	if err != nil {
 		t.Errorf("Transaction script validation failed: %v\n", err)
 		return
 	}
 }
+
+// loadScriptTestBlock returns the known-good test block and the utxo view of
+// the outputs it spends.
+func loadScriptTestBlock(tb testing.TB) (*btcutil.Block, *UtxoViewpoint) {
+	testBlockNum := 277647
+	blocks, err := loadBlocks(fmt.Sprintf("%d.dat.bz2", testBlockNum))
+	if err != nil {
+		tb.Fatalf("Error loading file: %v\n", err)
+	}
+	view, err := loadUtxoView(fmt.Sprintf("%d.utxostore.bz2", testBlockNum))
+	if err != nil {
+		tb.Fatalf("Error loading txstore: %v\n", err)
+	}
+	return blocks[0], view
+}
+
+// TestScriptCache ensures that the script cache only holds transactions as
+// validated against the outputs and with the flags they were validated with.
+func TestScriptCache(t *testing.T) {
+	block, view := loadScriptTestBlock(t)
+	scriptFlags := txscript.ScriptBip16
+	tx := block.Transactions()[1]
+
+	cache := NewScriptCache(uint(len(block.Transactions())))
+	if cache.Validated(tx, view, scriptFlags) {
+		t.Fatal("Transaction validated before its scripts were executed")
+	}
+	err := ValidateTransactionScripts(tx, view, scriptFlags, nil, nil, cache)
+	if err != nil {
+		t.Fatalf("Transaction script validation failed: %v\n", err)
+	}
+	if !cache.Validated(tx, view, scriptFlags) {
+		t.Fatal("Transaction not validated after its scripts were executed")
+	}
+
+	// The scripts were not validated with more flags.
+	if cache.Validated(tx, view, scriptFlags|txscript.ScriptVerifyWitness) {
+		t.Fatal("Transaction validated with flags it wasn't validated with")
+	}
+
+	// The scripts were not validated against other spent outputs, such as
+	// those created by another transaction after a reorganization.
+	otherView := NewUtxoViewpoint()
+	for outpoint, entry := range view.Entries() {
+		otherView.Entries()[outpoint] = entry
+	}
+	spent := tx.MsgTx().TxIn[0].PreviousOutPoint
+	otherEntry := view.LookupEntry(spent).Clone()
+	otherEntry.amount++
+	otherView.Entries()[spent] = otherEntry
+	if cache.Validated(tx, otherView, scriptFlags) {
+		t.Fatal("Transaction validated against other spent outputs")
+	}
+
+	// Validating the block adds its transactions, except the coinbase which
+	// spends no outputs, and connecting it purges them.
+	err = checkBlockScripts(block, view, scriptFlags, nil, nil, cache, 0)
+	if err != nil {
+		t.Fatalf("Transaction script validation failed: %v\n", err)
+	}
+	if cache.Validated(block.Transactions()[0], view, scriptFlags) {
+		t.Fatal("Coinbase validated")
+	}
+	for _, tx := range block.Transactions()[1:] {
+		if !cache.Validated(tx, view, scriptFlags) {
+			t.Fatalf("Transaction %v of the block not validated", tx.Hash())
+		}
+	}
+	cache.Purge(block.Transactions())
+	if cache.Validated(tx, view, scriptFlags) {
+		t.Fatal("Transaction validated after it was purged")
+	}
+
+	// Entries are evicted to stay within the max.
+	cache = NewScriptCache(1)
+	for _, tx := range block.Transactions()[1:3] {
+		cache.Add(tx, view, scriptFlags)
+	}
+	if len(cache.validTxns) != 1 {
+		t.Fatalf("Script cache has %d entries, max is 1", len(cache.validTxns))
+	}
+}
+
+// BenchmarkCheckBlockScripts benchmarks validating the scripts of a block
+// whose transactions weren't seen before and of a block whose transactions
+// were all validated before, as when they were accepted to the mempool.
+func BenchmarkCheckBlockScripts(b *testing.B) {
+	block, view := loadScriptTestBlock(b)
+	scriptFlags := txscript.ScriptBip16
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			err := checkBlockScripts(block, view, scriptFlags, nil, nil,
+				nil, 0)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		cache := NewScriptCache(uint(len(block.Transactions())))
+		for _, tx := range block.Transactions() {
+			err := ValidateTransactionScripts(tx, view, scriptFlags, nil,
+				nil, cache)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			err := checkBlockScripts(block, view, scriptFlags, nil, nil,
+				cache, 0)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
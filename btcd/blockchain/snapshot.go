@@ -0,0 +1,285 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/database"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+)
+
+const (
+	// snapshotImportBatchSize is the number of database entries written per
+	// transaction while importing a snapshot.  The UTXO set is far too large
+	// to be written in a single transaction.
+	snapshotImportBatchSize = 50000
+)
+
+// UtxoSnapshot is a consistent, read-only view of the UTXO set as of a block
+// in the main chain.  It remains valid while the chain continues to process
+// blocks and must be closed when no longer needed.
+type UtxoSnapshot struct {
+	// Hash and Height identify the block the snapshot was taken at.
+	Hash   chainhash.Hash
+	Height int32
+
+	// TotalTxns is the total number of transactions in the chain as of the
+	// snapshot block.
+	TotalTxns uint64
+
+	dbTx database.Tx
+}
+
+// ForEach calls fn with every unspent output in the snapshot.  Outputs are
+// visited in outpoint order: by transaction hash and then by output index.
+// Iteration stops at the first error returned by fn.
+func (s *UtxoSnapshot) ForEach(fn func(wire.OutPoint, *UtxoEntry) error) error {
+	cursor := s.dbTx.Metadata().Bucket(utxoSetBucketName).Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		key := cursor.Key()
+		if len(key) <= chainhash.HashSize {
+			return AssertError(fmt.Sprintf("invalid utxo key %x", key))
+		}
+
+		var outpoint wire.OutPoint
+		copy(outpoint.Hash[:], key[:chainhash.HashSize])
+		index, _ := deserializeVLQ(key[chainhash.HashSize:])
+		outpoint.Index = uint32(index)
+
+		entry, err := deserializeUtxoEntry(cursor.Value())
+		if err != nil {
+			return err
+		}
+		if err := fn(outpoint, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close releases the snapshot.
+func (s *UtxoSnapshot) Close() error {
+	return s.dbTx.Rollback()
+}
+
+// SnapshotUtxoSet flushes the UTXO cache and returns a snapshot of the UTXO
+// set as of the current tip of the main chain.  The snapshot must be closed
+// by the caller.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SnapshotUtxoSet() (*UtxoSnapshot, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	state := b.BestSnapshot()
+	err := b.db.Update(func(dbTx database.Tx) error {
+		return b.utxoCache.flush(dbTx, FlushRequired, state)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dbTx, err := b.db.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+	return &UtxoSnapshot{
+		Hash:      state.Hash,
+		Height:    state.Height,
+		TotalTxns: state.TotalTxns,
+		dbTx:      dbTx,
+	}, nil
+}
+
+// SnapshotSource supplies the chain state imported by ImportSnapshot.
+type SnapshotSource interface {
+	// ForEachHeader calls fn with the header of every block in the chain,
+	// starting at height 1, in order of height.
+	ForEachHeader(fn func(*wire.BlockHeader) error) error
+
+	// ForEachUtxo calls fn with every unspent output as of the last block
+	// of the chain.
+	ForEachUtxo(fn func(wire.OutPoint, *UtxoEntry) error) error
+}
+
+// ImportSnapshot replaces the chain state with the state supplied by src.
+// The headers supplied by src must connect the genesis block to tip, which
+// becomes the new tip of the main chain.  Blocks prior to tip are not
+// available after the import, so the chain can not be reorganized below it.
+//
+// The import is not atomic.  The previous tip remains the tip of the main
+// chain until the import completes, but the UTXO set is inconsistent with it
+// if the import is interrupted, so an interrupted import must be retried
+// before the chain is used.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ImportSnapshot(src SnapshotSource, tip *btcutil.Block, totalTxns uint64) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	// Build the block nodes for the header chain, making sure it links the
+	// genesis block to the new tip.
+	genesis := newBlockNode(&b.chainParams.GenesisBlock.Header, nil)
+	genesis.status = statusDataStored | statusValid
+	nodes := []*blockNode{genesis}
+	err := src.ForEachHeader(func(header *wire.BlockHeader) error {
+		parent := nodes[len(nodes)-1]
+		if header.PrevBlock != parent.hash {
+			return fmt.Errorf("snapshot header at height %d does not "+
+				"connect to %v", parent.height+1, parent.hash)
+		}
+		node := newBlockNode(header, parent)
+		node.status = statusValid
+		nodes = append(nodes, node)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	tipNode := nodes[len(nodes)-1]
+	if !tipNode.hash.IsEqual(tip.Hash()) {
+		return fmt.Errorf("snapshot header chain ends at %v, expected %v",
+			tipNode.hash, tip.Hash())
+	}
+	tipNode.status |= statusDataStored
+	tip.SetHeight(tipNode.height)
+
+	// Discard any cached entries of the current UTXO set so they are never
+	// flushed over the imported one.
+	b.utxoCache = newUtxoCache(b.db, b.utxoCache.maxTotalMemoryUsage)
+
+	err = b.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if err := meta.DeleteBucket(utxoSetBucketName); err != nil {
+			return err
+		}
+		_, err := meta.CreateBucket(utxoSetBucketName)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	batch := newSnapshotBatch(b.db)
+	err = src.ForEachUtxo(func(outpoint wire.OutPoint, entry *UtxoEntry) error {
+		return batch.write(func(dbTx database.Tx) error {
+			utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+			return dbPutUtxoEntry(utxoBucket, outpoint, entry)
+		})
+	})
+	if err != nil {
+		batch.rollback()
+		return err
+	}
+
+	for _, node := range nodes {
+		err := batch.write(func(dbTx database.Tx) error {
+			if err := dbStoreBlockNode(dbTx, node); err != nil {
+				return err
+			}
+			return dbPutBlockIndex(dbTx, &node.hash, node.height)
+		})
+		if err != nil {
+			batch.rollback()
+			return err
+		}
+	}
+	if err := batch.commit(); err != nil {
+		return err
+	}
+
+	// Finally, switch the best chain state over to the new tip.
+	state := newBestState(tipNode, uint64(tip.MsgBlock().SerializeSize()),
+		uint64(GetBlockWeight(tip)), uint64(len(tip.Transactions())),
+		totalTxns, CalcPastMedianTime(tipNode))
+	err = b.db.Update(func(dbTx database.Tx) error {
+		if err := dbStoreBlock(dbTx, tip); err != nil {
+			return err
+		}
+		if err := dbPutBestState(dbTx, state, tipNode.workSum); err != nil {
+			return err
+		}
+		return dbPutUtxoStateConsistency(dbTx, &tipNode.hash)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Reload the in-memory chain state from the database.
+	b.index = newBlockIndex(b.db, b.chainParams)
+	b.bestChain = newChainView(nil)
+	b.checkpointNode = nil
+	b.nextCheckpoint = nil
+	b.warningCaches = newThresholdCaches(vbNumBits)
+	b.deploymentCaches = newThresholdCaches(chaincfg.DefinedDeployments)
+	if err := b.initChainState(); err != nil {
+		return err
+	}
+	if err := b.initThresholdCaches(); err != nil {
+		return err
+	}
+
+	log.Infof("Imported chain state snapshot (height %d, hash %v)",
+		tipNode.height, tipNode.hash)
+	return nil
+}
+
+// snapshotBatch spreads a large number of writes across database
+// transactions of snapshotImportBatchSize writes each.
+type snapshotBatch struct {
+	db     database.DB
+	dbTx   database.Tx
+	writes int
+}
+
+// newSnapshotBatch returns a batch writing to db.
+func newSnapshotBatch(db database.DB) *snapshotBatch {
+	return &snapshotBatch{db: db}
+}
+
+// write performs fn in the current transaction, committing the transaction
+// once it is full.
+func (b *snapshotBatch) write(fn func(database.Tx) error) error {
+	if b.dbTx == nil {
+		dbTx, err := b.db.Begin(true)
+		if err != nil {
+			return err
+		}
+		b.dbTx = dbTx
+	}
+
+	if err := fn(b.dbTx); err != nil {
+		return err
+	}
+
+	b.writes++
+	if b.writes < snapshotImportBatchSize {
+		return nil
+	}
+	return b.commit()
+}
+
+// commit commits the current transaction, if any.
+func (b *snapshotBatch) commit() error {
+	if b.dbTx == nil {
+		return nil
+	}
+	err := b.dbTx.Commit()
+	b.dbTx = nil
+	b.writes = 0
+	return err
+}
+
+// rollback discards the current transaction, if any.
+func (b *snapshotBatch) rollback() {
+	if b.dbTx != nil {
+		_ = b.dbTx.Rollback()
+		b.dbTx = nil
+		b.writes = 0
+	}
+}
@@ -404,6 +404,15 @@ func CountP2SHSigOps(tx *btcutil.Tx, isCoinBaseTx bool, utxoView *UtxoViewpoint)
 	return totalSigOps, nil
 }
 
+// MaxTimeOffset returns the maximum duration a block time is allowed to be
+// ahead of the current time for the provided chain parameters.
+func MaxTimeOffset(params *chaincfg.Params) time.Duration {
+	if params.MaxFutureBlockTime != 0 {
+		return params.MaxFutureBlockTime
+	}
+	return time.Second * MaxTimeOffsetSeconds
+}
+
 // CheckBlockHeaderSanity performs some preliminary checks on a block header to
 // ensure it is sane before continuing with processing.  These checks are
 // context free.
@@ -412,6 +421,26 @@ func CountP2SHSigOps(tx *btcutil.Tx, isCoinBaseTx bool, utxoView *UtxoViewpoint)
 // are needed to pass along to checkProofOfWork.
 func CheckBlockHeaderSanity(header *wire.BlockHeader, powLimit *big.Int,
 	timeSource MedianTimeSource, flags BehaviorFlags,
+) error {
+	return checkBlockHeaderSanity(header, powLimit, timeSource,
+		time.Second*MaxTimeOffsetSeconds, flags)
+}
+
+// CheckHeaderSanity performs the checks of CheckBlockHeaderSanity under the
+// chain params and time source of the chain, which ProcessBlock checks the
+// header of a block with.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CheckHeaderSanity(header *wire.BlockHeader) error {
+	return checkBlockHeaderSanity(header, b.chainParams.PowLimit, b.timeSource,
+		MaxTimeOffset(b.chainParams), BFNone)
+}
+
+// checkBlockHeaderSanity performs the checks of CheckBlockHeaderSanity,
+// allowing the block time to be up to maxTimeOffset ahead of the current time.
+func checkBlockHeaderSanity(header *wire.BlockHeader, powLimit *big.Int,
+	timeSource MedianTimeSource, maxTimeOffset time.Duration,
+	flags BehaviorFlags,
 ) error {
 	// Ensure the proof of work bits in the block header is in min/max range
 	// and the block hash is less than the target value described by the
@@ -433,8 +462,7 @@ func CheckBlockHeaderSanity(header *wire.BlockHeader, powLimit *big.Int,
 	}
 
 	// Ensure the block time is not too far in the future.
-	maxTimestamp := timeSource.AdjustedTime().Add(time.Second *
-		MaxTimeOffsetSeconds)
+	maxTimestamp := timeSource.AdjustedTime().Add(maxTimeOffset)
 	if header.Timestamp.After(maxTimestamp) {
 		str := fmt.Sprintf("block timestamp of %v is too far in the "+
 			"future", header.Timestamp)
@@ -449,10 +477,10 @@ func CheckBlockHeaderSanity(header *wire.BlockHeader, powLimit *big.Int,
 //
 // The flags do not modify the behavior of this function directly, however they
 // are needed to pass along to checkBlockHeaderSanity.
-func checkBlockSanity(block *btcutil.Block, powLimit *big.Int, timeSource MedianTimeSource, flags BehaviorFlags) error {
+func checkBlockSanity(block *btcutil.Block, powLimit *big.Int, timeSource MedianTimeSource, maxTimeOffset time.Duration, flags BehaviorFlags) error {
 	msgBlock := block.MsgBlock()
 	header := &msgBlock.Header
-	err := CheckBlockHeaderSanity(header, powLimit, timeSource, flags)
+	err := checkBlockHeaderSanity(header, powLimit, timeSource, maxTimeOffset, flags)
 	if err != nil {
 		return err
 	}
@@ -556,7 +584,8 @@ func checkBlockSanity(block *btcutil.Block, powLimit *big.Int, timeSource Median
 // CheckBlockSanity performs some preliminary checks on a block to ensure it is
 // sane before continuing with block processing.  These checks are context free.
 func CheckBlockSanity(block *btcutil.Block, powLimit *big.Int, timeSource MedianTimeSource) error {
-	return checkBlockSanity(block, powLimit, timeSource, BFNone)
+	return checkBlockSanity(block, powLimit, timeSource,
+		time.Second*MaxTimeOffsetSeconds, BFNone)
 }
 
 // ExtractCoinbaseHeight attempts to extract the height of the block from the
@@ -672,12 +701,17 @@ func CheckBlockHeaderContext(header *wire.BlockHeader, prevNode HeaderCtx,
 	if !fastAdd {
 		// Ensure the difficulty specified in the block header matches
 		// the calculated difficulty based on the previous block and
-		// difficulty retarget rules.
-		expectedDifficulty, err := calcNextRequiredDifficulty(
-			prevNode, header.Timestamp, c,
-		)
-		if err != nil {
-			return err
+		// difficulty retarget rules.  Without proof of work, the
+		// difficulty is the minimum regardless of the previous blocks.
+		expectedDifficulty := params.PowLimitBits
+		if !params.PoWDisabled {
+			var err error
+			expectedDifficulty, err = calcNextRequiredDifficulty(
+				prevNode, header.Timestamp, c,
+			)
+			if err != nil {
+				return err
+			}
 		}
 		blockDifficulty := header.Bits
 		if blockDifficulty != expectedDifficulty {
@@ -687,12 +721,24 @@ func CheckBlockHeaderContext(header *wire.BlockHeader, prevNode HeaderCtx,
 		}
 
 		// Ensure the timestamp for the block header is after the
-		// median time of the last several blocks (medianTimeBlocks).
-		medianTime := CalcPastMedianTime(prevNode)
-		if !header.Timestamp.After(medianTime) {
-			str := "block timestamp of %v is not after expected %v"
-			str = fmt.Sprintf(str, header.Timestamp, medianTime)
-			return ruleError(ErrTimeTooOld, str)
+		// median time of the last several blocks (medianTimeBlocks), or
+		// not before the timestamp of the previous block on networks
+		// with monotonic timestamps.
+		if params.MonotonicTimestamps {
+			prevTime := time.Unix(prevNode.Timestamp(), 0)
+			if header.Timestamp.Before(prevTime) {
+				str := "block timestamp of %v is before the " +
+					"previous block timestamp of %v"
+				str = fmt.Sprintf(str, header.Timestamp, prevTime)
+				return ruleError(ErrTimeTooOld, str)
+			}
+		} else {
+			medianTime := CalcPastMedianTime(prevNode)
+			if !header.Timestamp.After(medianTime) {
+				str := "block timestamp of %v is not after expected %v"
+				str = fmt.Sprintf(str, header.Timestamp, medianTime)
+				return ruleError(ErrTimeTooOld, str)
+			}
 		}
 
 		// Testnet4 only: Check timestamp against prev for
@@ -1311,7 +1357,7 @@ func (b *BlockChain) checkConnectBlock(
 	// prevent CPU exhaustion attacks.
 	if runScripts {
 		err := checkBlockScripts(block, view, scriptFlags, b.sigCache,
-			b.hashCache)
+			b.hashCache, b.scriptCache, b.maxScriptValidationWorkers)
 		if err != nil {
 			return err
 		}
@@ -1346,7 +1392,8 @@ func (b *BlockChain) CheckConnectBlockTemplate(block *btcutil.Block) error {
 		return ruleError(ErrPrevBlockNotBest, str)
 	}
 
-	err := checkBlockSanity(block, b.chainParams.PowLimit, b.timeSource, flags)
+	err := checkBlockSanity(block, b.chainParams.PowLimit, b.timeSource,
+		MaxTimeOffset(b.chainParams), flags)
 	if err != nil {
 		return err
 	}
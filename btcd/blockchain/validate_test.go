@@ -485,3 +485,233 @@ var Block100000 = wire.MsgBlock{
 		},
 	},
 }
+
+// TestCheckBlockHeaderContextPoWDisabled ensures the bits of blocks of a chain
+// without proof of work must be the proof of work limit, across a difficulty
+// retarget boundary with blocks produced much faster than the target spacing.
+func TestCheckBlockHeaderContextPoWDisabled(t *testing.T) {
+	powParams := chaincfg.TestNet3Params
+	noPoWParams := chaincfg.TestNet3Params
+	noPoWParams.PoWDisabled = true
+
+	// Create fake chains of blocks two seconds apart up to the block before
+	// the first retarget.
+	newChain := func(params *chaincfg.Params) (*BlockChain, *blockNode) {
+		chain := newFakeChain(params)
+		node := chain.bestChain.Tip()
+		for node.height+1 < chain.blocksPerRetarget {
+			node = newFakeNode(node, 4, params.PowLimitBits,
+				time.Unix(node.timestamp+2, 0))
+			chain.index.AddNode(node)
+		}
+		chain.bestChain.SetTip(node)
+		return chain, node
+	}
+
+	// The retarget of chains with proof of work raises the difficulty.
+	powChain, powTip := newChain(&powParams)
+	blockTime := time.Unix(powTip.timestamp+2, 0)
+	bits, err := powChain.CalcNextRequiredDifficulty(blockTime)
+	if err != nil {
+		t.Fatalf("CalcNextRequiredDifficulty: unexpected error: %v", err)
+	}
+	if bits == powParams.PowLimitBits {
+		t.Fatalf("CalcNextRequiredDifficulty: got the proof of work " +
+			"limit at a retarget")
+	}
+
+	// Chains without proof of work keep the proof of work limit.
+	chain, tip := newChain(&noPoWParams)
+	bits, err = chain.CalcNextRequiredDifficulty(blockTime)
+	if err != nil {
+		t.Fatalf("CalcNextRequiredDifficulty: unexpected error: %v", err)
+	}
+	if bits != noPoWParams.PowLimitBits {
+		t.Fatalf("CalcNextRequiredDifficulty: got %08x, want %08x",
+			bits, noPoWParams.PowLimitBits)
+	}
+
+	tests := []struct {
+		name    string
+		bits    uint32
+		wantErr bool
+	}{{
+		name: "proof of work limit",
+		bits: noPoWParams.PowLimitBits,
+	}, {
+		name:    "retargeted difficulty",
+		bits:    powParams.PowLimitBits - 1,
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		for _, prevNode := range []*blockNode{tip.parent, tip} {
+			header := &wire.BlockHeader{
+				Version:   4,
+				PrevBlock: prevNode.hash,
+				Bits:      test.bits,
+				Timestamp: time.Unix(prevNode.timestamp+2, 0),
+			}
+			err := CheckBlockHeaderContext(header, prevNode, BFNone,
+				chain, true)
+			if !test.wantErr {
+				if err != nil {
+					t.Errorf("%s at height %d: unexpected "+
+						"error: %v", test.name,
+						prevNode.height+1, err)
+				}
+				continue
+			}
+			rerr, ok := err.(RuleError)
+			if !ok || rerr.ErrorCode != ErrUnexpectedDifficulty {
+				t.Errorf("%s at height %d: got error %v, want %v",
+					test.name, prevNode.height+1, err,
+					ErrUnexpectedDifficulty)
+			}
+		}
+	}
+}
+
+// TestCheckBlockHeaderSanityMaxTimeOffset ensures block times ahead of the
+// current time are limited by the maximum future block time of the chain.
+func TestCheckBlockHeaderSanityMaxTimeOffset(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	if offset := MaxTimeOffset(&params); offset != 2*time.Hour {
+		t.Fatalf("MaxTimeOffset: got %v, want %v", offset, 2*time.Hour)
+	}
+	params.MaxFutureBlockTime = 5 * time.Second
+	if offset := MaxTimeOffset(&params); offset != 5*time.Second {
+		t.Fatalf("MaxTimeOffset: got %v, want %v", offset, 5*time.Second)
+	}
+
+	timeSource := NewMedianTime()
+	now := time.Unix(timeSource.AdjustedTime().Unix(), 0)
+	tests := []struct {
+		name    string
+		ahead   time.Duration
+		wantErr bool
+	}{{
+		name:  "current time",
+		ahead: 0,
+	}, {
+		name:  "proposer clock 3 seconds ahead",
+		ahead: 3 * time.Second,
+	}, {
+		name:    "beyond the maximum future block time",
+		ahead:   time.Minute,
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		header := &wire.BlockHeader{
+			Version:   4,
+			Bits:      params.PowLimitBits,
+			Timestamp: now.Add(test.ahead),
+		}
+		err := checkBlockHeaderSanity(header, params.PowLimit, timeSource,
+			MaxTimeOffset(&params), BFNoPoWCheck)
+		if !test.wantErr {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+		rerr, ok := err.(RuleError)
+		if !ok || rerr.ErrorCode != ErrTimeTooNew {
+			t.Errorf("%s: got error %v, want %v", test.name, err,
+				ErrTimeTooNew)
+		}
+
+		// The block time is allowed without the maximum future block
+		// time of the chain.
+		err = CheckBlockHeaderSanity(header, params.PowLimit, timeSource,
+			BFNoPoWCheck)
+		if err != nil {
+			t.Errorf("%s: unexpected error with the default maximum: %v",
+				test.name, err)
+		}
+	}
+}
+
+// TestCheckBlockHeaderContextMonotonicTimestamps ensures block times are
+// checked against the time of the previous block rather than the median time
+// of the last several blocks on networks with monotonic timestamps.
+func TestCheckBlockHeaderContextMonotonicTimestamps(t *testing.T) {
+	medianParams := chaincfg.RegressionNetParams
+	monotonicParams := chaincfg.RegressionNetParams
+	monotonicParams.MonotonicTimestamps = true
+
+	// Create fake chains of blocks two seconds apart, the last of which was
+	// proposed by a node with a clock 3 seconds ahead.
+	newChain := func(params *chaincfg.Params) (*BlockChain, *blockNode) {
+		chain := newFakeChain(params)
+		node := chain.bestChain.Tip()
+		for i := 0; i < medianTimeBlocks; i++ {
+			node = newFakeNode(node, 4, params.PowLimitBits,
+				time.Unix(node.timestamp+2, 0))
+			chain.index.AddNode(node)
+		}
+		node = newFakeNode(node, 4, params.PowLimitBits,
+			time.Unix(node.timestamp+2+3, 0))
+		chain.index.AddNode(node)
+		chain.bestChain.SetTip(node)
+		return chain, node
+	}
+	medianChain, medianTip := newChain(&medianParams)
+	monotonicChain, monotonicTip := newChain(&monotonicParams)
+	medianTime := CalcPastMedianTime(medianTip).Unix()
+
+	tests := []struct {
+		name             string
+		timestamp        int64
+		wantMedianErr    bool
+		wantMonotonicErr bool
+	}{{
+		name:      "after the previous block",
+		timestamp: medianTip.timestamp + 2,
+	}, {
+		name:      "same as the previous block",
+		timestamp: medianTip.timestamp,
+	}, {
+		name:             "before the previous block",
+		timestamp:        medianTip.timestamp - 1,
+		wantMonotonicErr: true,
+	}, {
+		name:             "median time",
+		timestamp:        medianTime,
+		wantMedianErr:    true,
+		wantMonotonicErr: true,
+	}}
+	for _, test := range tests {
+		for _, c := range []struct {
+			chain   *BlockChain
+			tip     *blockNode
+			wantErr bool
+		}{
+			{chain: medianChain, tip: medianTip, wantErr: test.wantMedianErr},
+			{chain: monotonicChain, tip: monotonicTip, wantErr: test.wantMonotonicErr},
+		} {
+			params := c.chain.ChainParams()
+			header := &wire.BlockHeader{
+				Version:   4,
+				PrevBlock: c.tip.hash,
+				Bits:      params.PowLimitBits,
+				Timestamp: time.Unix(test.timestamp, 0),
+			}
+			err := CheckBlockHeaderContext(header, c.tip, BFNone,
+				c.chain, true)
+			if !c.wantErr {
+				if err != nil {
+					t.Errorf("%s with monotonic timestamps %v: "+
+						"unexpected error: %v", test.name,
+						params.MonotonicTimestamps, err)
+				}
+				continue
+			}
+			rerr, ok := err.(RuleError)
+			if !ok || rerr.ErrorCode != ErrTimeTooOld {
+				t.Errorf("%s with monotonic timestamps %v: got "+
+					"error %v, want %v", test.name,
+					params.MonotonicTimestamps, err, ErrTimeTooOld)
+			}
+		}
+	}
+}
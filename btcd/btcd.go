@@ -13,11 +13,16 @@ import (
 
 	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
 	"github.com/MetalBlockchain/btcvm/btcd/blockchain/indexers"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
 	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
 	"github.com/MetalBlockchain/btcvm/btcd/database"
 	"github.com/MetalBlockchain/btcvm/btcd/limits"
+	"github.com/MetalBlockchain/btcvm/btcd/mempool"
 	"github.com/MetalBlockchain/btcvm/btcd/mining"
 	"github.com/MetalBlockchain/btcvm/btcd/ossec"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/btcsuite/btclog"
 )
 
 const (
@@ -32,9 +37,11 @@ var cfg *Config
 
 // BtcdMain is the main initialization function for btcd in VM mode.
 // It returns the server instance directly for use by the Metal VM.
-// The VM will handle server lifecycle (Start/Stop) instead of using signals.
+// The VM will handle server lifecycle (Start/Stop) instead of using signals,
+// so that a VM shut down and initialized again in the same process starts
+// from a clean state.  The database is closed if an error is returned.
 // nodeID is used to create a unique database path for each node.
-func BtcdMain(c *Config) (*Server, error) {
+func BtcdMain(c *Config) (_ *Server, err error) {
 	// If GOGC is not explicitly set, override GC percent.
 	if os.Getenv("GOGC") == "" {
 		// Block and transaction processing can cause bursty allocations.  This
@@ -53,10 +60,10 @@ func BtcdMain(c *Config) (*Server, error) {
 	// TODO 2025-12-03 <Deep>: cleanup global config usage
 	cfg = c
 
-	// Get a channel that will be closed when a shutdown signal has been
-	// triggered either from an OS signal such as SIGINT (Ctrl+C) or from
-	// another subsystem such as the RPC server.
-	interrupt := interruptListener()
+	// Get a channel that will be closed when the server is stopped, which
+	// interrupts long running operations such as index catch ups.  OS
+	// signals are handled by the node running the VM.
+	interrupt := make(chan struct{})
 
 	// Show version at startup.
 	btcdLog.Infof("Version %s", version())
@@ -67,27 +74,21 @@ func BtcdMain(c *Config) (*Server, error) {
 		return nil, err
 	}
 
-	// Return now if an interrupt signal was triggered.
-	if interruptRequested(interrupt) {
-		return nil, nil
-	}
-
 	// Load the block database.
 	db, err := loadBlockDB()
 	if err != nil {
 		btcdLog.Errorf("%v", err)
 		return nil, err
 	}
-	// Note: Database will be closed by server.Stop() in VM mode
-	// defer func() {
-	// 	btcdLog.Infof("Gracefully shutting down the database...")
-	// 	db.Close()
-	// }()
-
-	// Return now if an interrupt signal was triggered.
-	if interruptRequested(interrupt) {
-		return nil, nil
-	}
+	// The database is closed by server.Stop() in VM mode, or here if the
+	// server is not created, so that its lock is released for the next
+	// initialization
+	defer func() {
+		if err != nil {
+			btcdLog.Infof("Gracefully shutting down the database...")
+			db.Close()
+		}
+	}()
 
 	// Check if the database had previously been pruned.  If it had been, it's
 	// not possible to newly generate the tx index and addr index.
@@ -121,6 +122,13 @@ func BtcdMain(c *Config) (*Server, error) {
 		btcdLog.Errorf("%v", err)
 		return nil, err
 	}
+	if beenPruned && cfg.SpentIndex {
+		err = fmt.Errorf("--spentindex cannot be enabled as the node has been "+
+			"previously pruned. You must delete the files in the datadir: \"%s\" "+
+			"and sync from the beginning to enable the desired index", cfg.DataDir)
+		btcdLog.Errorf("%v", err)
+		return nil, err
+	}
 	// If we've previously been pruned and the cfindex isn't present, it means that the
 	// user wants to enable the cfindex after the node has already synced up and been
 	// pruned.
@@ -171,6 +179,15 @@ func BtcdMain(c *Config) (*Server, error) {
 		return nil, err
 	}
 
+	// Drop the spent output index when it is to be rebuilt.  The index
+	// manager creates it again and catches it up from the genesis block.
+	if cfg.ReindexSpentIndex {
+		if err := indexers.DropSpentIndex(db, interrupt); err != nil {
+			btcdLog.Errorf("%v", err)
+			return nil, err
+		}
+	}
+
 	// The config file is already created if it did not exist and the log
 	// file has already been opened by now so we only need to allow
 	// creating rpc cert and key files if they don't exist.
@@ -182,13 +199,15 @@ func BtcdMain(c *Config) (*Server, error) {
 	pledgex("stdio rpath wpath cpath flock dns inet")
 
 	// Create server (but don't start it yet - VM will call Start)
-	server, err := newServer(db, activeNetParams.Params, interrupt)
+	server, err := newServer(db, cfg.ChainParams, interrupt)
 	if err != nil {
 		btcdLog.Errorf("Unable to create server on %v: %v",
 			cfg.Listeners, err)
 		return nil, err
 	}
 
+	server.interrupt = interrupt
+
 	// Subscribe to blockchain notifications for block relay
 	server.setupBlockchainNotifications()
 
@@ -220,6 +239,227 @@ func (s *Server) SetOnTxAccepted(callback func(*btcutil.Tx)) {
 	}
 }
 
+// SetGenerateToAddress sets the function generating blocks for the
+// generatetoaddress RPC command
+func (s *Server) SetGenerateToAddress(generate GenerateToAddressFunc) {
+	if s.rpcServer != nil {
+		s.rpcServer.cfg.GenerateToAddress = generate
+	}
+}
+
+// SetOnTxAdded sets a callback for when transactions are added to the mempool,
+// which is called with the mempool lock held
+func (s *Server) SetOnTxAdded(callback func(*mempool.TxDesc)) {
+	if s.txMemPool != nil {
+		s.txMemPool.SetOnTxAdded(callback)
+	}
+}
+
+// SetOnOrphanEvicted sets a callback for when orphan transactions are evicted
+// from the orphan pool, which is called with the mempool lock held
+func (s *Server) SetOnOrphanEvicted(callback func(*btcutil.Tx, mempool.OrphanEvictionReason)) {
+	if s.txMemPool != nil {
+		s.txMemPool.SetOnOrphanEvicted(callback)
+	}
+}
+
+// SetOnTxEvicted sets a callback for when transactions are evicted from the
+// mempool because it is full or expired, which is called with the mempool lock
+// held
+func (s *Server) SetOnTxEvicted(callback func(*btcutil.Tx, mempool.TxEvictionReason)) {
+	if s.txMemPool != nil {
+		s.txMemPool.SetOnTxEvicted(callback)
+	}
+}
+
+// SetOnTxReplaced sets a callback for when transactions are evicted from the
+// mempool by a replacement transaction, which is called with the mempool lock
+// held
+func (s *Server) SetOnTxReplaced(callback func(replaced, replacement *btcutil.Tx)) {
+	if s.txMemPool != nil {
+		s.txMemPool.SetOnTxReplaced(callback)
+	}
+}
+
+// SetOnDoubleSpend sets a callback for when a transaction conflicting with the
+// mempool is rejected or confirmed in a block, which is called with the mempool
+// lock held
+func (s *Server) SetOnDoubleSpend(callback func(*mempool.DoubleSpend)) {
+	if s.txMemPool != nil {
+		s.txMemPool.SetOnDoubleSpend(callback)
+	}
+}
+
+// SetSmartFeeEstimator sets the fee estimator answering the estimatesmartfee
+// and estimatefeebytime RPC commands
+func (s *Server) SetSmartFeeEstimator(estimator SmartFeeEstimator) {
+	if s.rpcServer != nil {
+		s.rpcServer.cfg.SmartFeeEstimator = estimator
+	}
+}
+
+// SetConsensusInfo sets the function describing the consensus the chain is
+// run by for the getconsensusinfo and getblockchaininfo RPC commands
+func (s *Server) SetConsensusInfo(consensusInfo ConsensusInfoFunc) {
+	if s.rpcServer != nil {
+		s.rpcServer.cfg.ConsensusInfo = consensusInfo
+	}
+}
+
+// SetGossipInfo sets the function returning the state of the gossip of the VM
+// for the getgossipinfo RPC command
+func (s *Server) SetGossipInfo(gossipInfo GossipInfoFunc) {
+	if s.rpcServer != nil {
+		s.rpcServer.cfg.GossipInfo = gossipInfo
+	}
+}
+
+// SetMiningInfo sets the function returning the state of the block builder
+// for the getmininginfo RPC command
+func (s *Server) SetMiningInfo(miningInfo MiningInfoFunc) {
+	if s.rpcServer != nil {
+		s.rpcServer.cfg.MiningInfo = miningInfo
+	}
+}
+
+// SetDoubleSpends sets the function returning the recently seen double spends
+// of a transaction for the getdoublespends RPC command
+func (s *Server) SetDoubleSpends(doubleSpends DoubleSpendsFunc) {
+	if s.rpcServer != nil {
+		s.rpcServer.cfg.DoubleSpends = doubleSpends
+	}
+}
+
+// SetNetworkInfo sets the functions reporting the peers of the node on the
+// Metal network for the getnetworkinfo and getpeerinfo RPC commands
+func (s *Server) SetNetworkInfo(networkInfo NetworkInfoFunc, peerInfo PeerInfoFunc) {
+	if s.rpcServer != nil {
+		s.rpcServer.cfg.NetworkInfo = networkInfo
+		s.rpcServer.cfg.PeerInfo = peerInfo
+	}
+}
+
+// SetExportChainState sets the function exporting the accepted chain for the
+// exportchainstate RPC command
+func (s *Server) SetExportChainState(export ExportChainStateFunc) {
+	if s.rpcServer != nil {
+		s.rpcServer.cfg.ExportChainState = export
+	}
+}
+
+// SetResyncChainState sets the function rebuilding the chain state from the
+// accepted chain for the resyncchainstate RPC command
+func (s *Server) SetResyncChainState(resync ResyncChainStateFunc) {
+	if s.rpcServer != nil {
+		s.rpcServer.cfg.ResyncChainState = resync
+	}
+}
+
+// SetRunMaintenance sets the function flushing the chain state and compacting
+// the database for the runmaintenance RPC command
+func (s *Server) SetRunMaintenance(maintenance RunMaintenanceFunc) {
+	if s.rpcServer != nil {
+		s.rpcServer.cfg.RunMaintenance = maintenance
+	}
+}
+
+// SetCheckpoint sets the function returning the last accepted block as a
+// checkpoint for the getcheckpoint RPC command
+func (s *Server) SetCheckpoint(checkpoint CheckpointFunc) {
+	if s.rpcServer != nil {
+		s.rpcServer.cfg.Checkpoint = checkpoint
+	}
+}
+
+// SetBlockFilters sets the functions serving the compact filters of accepted
+// blocks for the getblockfilter and getcfheaders RPC commands
+func (s *Server) SetBlockFilters(blockFilter BlockFilterFunc, cfHeaders CFHeadersFunc) {
+	if s.rpcServer != nil {
+		s.rpcServer.cfg.BlockFilter = blockFilter
+		s.rpcServer.cfg.CFHeaders = cfHeaders
+	}
+}
+
+// SetChainTipStatus sets the function returning the consensus status of the
+// chain tips for the getchaintips command
+func (s *Server) SetChainTipStatus(chainTipStatus ChainTipStatusFunc) {
+	if s.rpcServer != nil {
+		s.rpcServer.cfg.ChainTipStatus = chainTipStatus
+	}
+}
+
+// SetBlockProposer sets the function returning the proposer recorded in the
+// coinbase of a block for the getblock command
+func (s *Server) SetBlockProposer(blockProposer BlockProposerFunc) {
+	if s.rpcServer != nil {
+		s.rpcServer.cfg.BlockProposer = blockProposer
+	}
+}
+
+// SetBlockValidityChanged sets the function called when the invalidateblock
+// and reconsiderblock commands change the validity of a block
+func (s *Server) SetBlockValidityChanged(blockValidityChanged BlockValidityFunc) {
+	if s.rpcServer != nil {
+		s.rpcServer.cfg.BlockValidityChanged = blockValidityChanged
+	}
+}
+
+// SetLogLevel sets the function setting the log level of a subsystem for the
+// setloglevel command
+func (s *Server) SetLogLevel(setLogLevel LogLevelFunc) {
+	if s.rpcServer != nil {
+		s.rpcServer.cfg.SetLogLevel = setLogLevel
+	}
+}
+
+// SetRPCAuth sets the function authenticating RPC clients and authorizing the
+// methods they call, replacing the rpcuser and rpclimituser credentials
+func (s *Server) SetRPCAuth(auth RPCAuthFunc) {
+	if s.rpcServer != nil {
+		s.rpcServer.cfg.Auth = auth
+	}
+}
+
+// SetRPCLimitExceeded sets the function called when a client exceeds a limit
+// of the RPC server
+func (s *Server) SetRPCLimitExceeded(limitExceeded RPCLimitFunc) {
+	if s.rpcServer != nil {
+		s.rpcServer.cfg.LimitExceeded = limitExceeded
+	}
+}
+
+// NotifyBlockAccepted sets the last block accepted by consensus, waking the
+// waitfornewblock and waitforblockheight RPC requests waiting for it
+func (s *Server) NotifyBlockAccepted(hash *chainhash.Hash, height int32) {
+	if s.rpcServer != nil {
+		s.rpcServer.ntfnMgr.NotifyBlockAccepted(hash, height)
+	}
+}
+
+// NotifyDoubleSpend sends a doublespendseen notification to the websocket
+// clients watching new transactions or the conflicting outpoints
+func (s *Server) NotifyDoubleSpend(doubleSpend *btcjson.DoubleSpendResult) {
+	if s.rpcServer != nil {
+		s.rpcServer.NotifyDoubleSpend(doubleSpend)
+	}
+}
+
+// SetDebugLevels sets the logging level of the btcd subsystems. debugLevel has
+// the format of the debuglevel option: a level for all subsystems, or a comma
+// separated list of subsystem=level pairs.
+func SetDebugLevels(debugLevel string) error {
+	return parseAndSetDebugLevels(debugLevel)
+}
+
+// LogLevel returns the logging level of a btcd subsystem.
+func LogLevel(subsystemID string) (btclog.Level, error) {
+	logger, ok := subsystemLoggers[subsystemID]
+	if !ok {
+		return btclog.LevelOff, fmt.Errorf("unknown subsystem %q", subsystemID)
+	}
+	return logger.Level(), nil
+}
+
 // removeRegressionDB removes the existing regression test database if running
 // in regression test mode and it already exists.
 func removeRegressionDB(dbPath string) error {
@@ -250,12 +490,18 @@ func removeRegressionDB(dbPath string) error {
 
 // dbPath returns the path to the block database given a database type.
 func blockDbPath(dbType string) string {
+	return BlockDBPath(cfg.DataDir, dbType)
+}
+
+// BlockDBPath returns the path to the block database of the given type in
+// the passed data directory.
+func BlockDBPath(dataDir, dbType string) string {
 	// The database name is based on the database type.
 	dbName := blockDbNamePrefix + "_" + dbType
 	if dbType == "sqlite" {
 		dbName = dbName + ".db"
 	}
-	dbPath := filepath.Join(cfg.DataDir, dbName)
+	dbPath := filepath.Join(dataDir, dbName)
 	return dbPath
 }
 
@@ -303,11 +549,7 @@ func loadBlockDB() (database.DB, error) {
 	// database type warnings when running with the memory database.
 	if cfg.DbType == "memdb" {
 		btcdLog.Infof("Creating block database in memory.")
-		db, err := database.Create(cfg.DbType)
-		if err != nil {
-			return nil, err
-		}
-		return db, nil
+		return OpenBlockDB(cfg.DataDir, cfg.DbType, cfg.ChainParams.Net, false)
 	}
 
 	warnMultipleDBs()
@@ -320,7 +562,34 @@ func loadBlockDB() (database.DB, error) {
 	removeRegressionDB(dbPath)
 
 	btcdLog.Infof("Loading block database from '%s'", dbPath)
-	db, err := database.Open(cfg.DbType, dbPath, activeNetParams.Net)
+	db, err := OpenBlockDB(cfg.DataDir, cfg.DbType, cfg.ChainParams.Net, false)
+	if err != nil {
+		return nil, err
+	}
+
+	btcdLog.Info("Block database loaded")
+	return db, nil
+}
+
+// OpenBlockDB opens the block database of the given type in the passed data
+// directory, creating it when it does not exist.  When readOnly is set, the
+// database must exist and is opened without modifying it, which fails with
+// database.ErrDbAlreadyOpen while another process has it open.
+func OpenBlockDB(dataDir, dbType string, net wire.BitcoinNet, readOnly bool) (database.DB, error) {
+	// The memdb backend does not have a file path associated with it, so
+	// there is nothing to open read-only.
+	if dbType == "memdb" {
+		if readOnly {
+			return nil, fmt.Errorf("the %s block database is not stored on disk", dbType)
+		}
+		return database.Create(dbType, net)
+	}
+
+	dbPath := BlockDBPath(dataDir, dbType)
+	if readOnly {
+		return database.Open(dbType, dbPath, net, true)
+	}
+	db, err := database.Open(dbType, dbPath, net)
 	if err != nil {
 		// Return the error if it's not because the database doesn't
 		// exist.
@@ -331,17 +600,15 @@ func loadBlockDB() (database.DB, error) {
 		}
 
 		// Create the db if it does not exist.
-		err = os.MkdirAll(cfg.DataDir, 0o700)
+		err = os.MkdirAll(dataDir, 0o700)
 		if err != nil {
 			return nil, err
 		}
-		db, err = database.Create(cfg.DbType, dbPath, activeNetParams.Net)
+		db, err = database.Create(dbType, dbPath, net)
 		if err != nil {
 			return nil, err
 		}
 	}
-
-	btcdLog.Info("Block database loaded")
 	return db, nil
 }
 
@@ -369,6 +636,26 @@ func (s *Server) RPCServer() *rpcServer {
 	return s.rpcServer
 }
 
+// TimeSource returns the median time source used to check block times.
+func (s *Server) TimeSource() blockchain.MedianTimeSource {
+	return s.timeSource
+}
+
+// DB returns the block database.
+func (s *Server) DB() database.DB {
+	return s.db
+}
+
+// TxIndex returns the transaction index, or nil if it is disabled.
+func (s *Server) TxIndex() *indexers.TxIndex {
+	return s.txIndex
+}
+
+// SpentIndex returns the spent output index, or nil if it is disabled.
+func (s *Server) SpentIndex() *indexers.SpentIndex {
+	return s.spentIndex
+}
+
 func init() {
 	pledgex("unveil stdio id rpath wpath cpath flock dns inet tty")
 }
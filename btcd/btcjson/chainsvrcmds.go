@@ -126,6 +126,34 @@ func NewDeriveAddressesCmd(descriptor string, descriptorRange *DescriptorRange)
 	}
 }
 
+// EstimateFeeByTimeCmd defines the estimatefeebytime JSON-RPC command.
+type EstimateFeeByTimeCmd struct {
+	Seconds      int64
+	EstimateMode *EstimateSmartFeeMode `jsonrpcdefault:"\"CONSERVATIVE\""`
+}
+
+// NewEstimateFeeByTimeCmd returns a new instance which can be used to issue an
+// estimatefeebytime JSON-RPC command.
+func NewEstimateFeeByTimeCmd(seconds int64, mode *EstimateSmartFeeMode) *EstimateFeeByTimeCmd {
+	return &EstimateFeeByTimeCmd{
+		Seconds:      seconds,
+		EstimateMode: mode,
+	}
+}
+
+// ExportChainStateCmd defines the exportchainstate JSON-RPC command.
+type ExportChainStateCmd struct {
+	Dir string
+}
+
+// NewExportChainStateCmd returns a new instance which can be used to issue an
+// exportchainstate JSON-RPC command.
+func NewExportChainStateCmd(dir string) *ExportChainStateCmd {
+	return &ExportChainStateCmd{
+		Dir: dir,
+	}
+}
+
 // ChangeType defines the different output types to use for the change address
 // of a transaction built by the node.
 type ChangeType string
@@ -289,6 +317,26 @@ func NewGetBlockHeaderCmd(hash string, verbose *bool) *GetBlockHeaderCmd {
 	}
 }
 
+// GetBlockHeadersCmd defines the getblockheaders JSON-RPC command.
+type GetBlockHeadersCmd struct {
+	StartHeight int32
+	Count       int32
+	Verbose     *bool `jsonrpcdefault:"true"`
+}
+
+// NewGetBlockHeadersCmd returns a new instance which can be used to issue a
+// getblockheaders JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetBlockHeadersCmd(startHeight, count int32, verbose *bool) *GetBlockHeadersCmd {
+	return &GetBlockHeadersCmd{
+		StartHeight: startHeight,
+		Count:       count,
+		Verbose:     verbose,
+	}
+}
+
 // HashOrHeight defines a type that can be used as hash_or_height value in JSON-RPC commands.
 type HashOrHeight struct {
 	Value interface{}
@@ -425,6 +473,26 @@ func NewGetBlockTemplateCmd(request *TemplateRequest) *GetBlockTemplateCmd {
 	}
 }
 
+// GetCFHeadersCmd defines the getcfheaders JSON-RPC command.
+type GetCFHeadersCmd struct {
+	StartHeight uint32          // The height of the first block
+	StopHash    string          // The hash of the last block
+	FilterType  *FilterTypeName // The type name of the filters, default=basic
+}
+
+// NewGetCFHeadersCmd returns a new instance which can be used to issue a
+// getcfheaders JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetCFHeadersCmd(startHeight uint32, stopHash string, filterType *FilterTypeName) *GetCFHeadersCmd {
+	return &GetCFHeadersCmd{
+		StartHeight: startHeight,
+		StopHash:    stopHash,
+		FilterType:  filterType,
+	}
+}
+
 // GetCFilterCmd defines the getcfilter JSON-RPC command.
 type GetCFilterCmd struct {
 	Hash       string
@@ -483,6 +551,15 @@ func NewGetChainTxStatsCmd(nBlocks *int32, blockHash *string) *GetChainTxStatsCm
 	}
 }
 
+// GetCheckpointCmd defines the getcheckpoint JSON-RPC command.
+type GetCheckpointCmd struct{}
+
+// NewGetCheckpointCmd returns a new instance which can be used to issue a
+// getcheckpoint JSON-RPC command.
+func NewGetCheckpointCmd() *GetCheckpointCmd {
+	return &GetCheckpointCmd{}
+}
+
 // GetConnectionCountCmd defines the getconnectioncount JSON-RPC command.
 type GetConnectionCountCmd struct{}
 
@@ -492,6 +569,15 @@ func NewGetConnectionCountCmd() *GetConnectionCountCmd {
 	return &GetConnectionCountCmd{}
 }
 
+// GetConsensusInfoCmd defines the getconsensusinfo JSON-RPC command.
+type GetConsensusInfoCmd struct{}
+
+// NewGetConsensusInfoCmd returns a new instance which can be used to issue a
+// getconsensusinfo JSON-RPC command.
+func NewGetConsensusInfoCmd() *GetConsensusInfoCmd {
+	return &GetConsensusInfoCmd{}
+}
+
 // GetDescriptorInfoCmd defines the getdescriptorinfo JSON-RPC command.
 type GetDescriptorInfoCmd struct {
 	Descriptor string
@@ -514,6 +600,19 @@ func NewGetDifficultyCmd() *GetDifficultyCmd {
 	return &GetDifficultyCmd{}
 }
 
+// GetDoubleSpendsCmd defines the getdoublespends JSON-RPC command.
+type GetDoubleSpendsCmd struct {
+	TxID string
+}
+
+// NewGetDoubleSpendsCmd returns a new instance which can be used to issue a
+// getdoublespends JSON-RPC command.
+func NewGetDoubleSpendsCmd(txHash string) *GetDoubleSpendsCmd {
+	return &GetDoubleSpendsCmd{
+		TxID: txHash,
+	}
+}
+
 // GetGenerateCmd defines the getgenerate JSON-RPC command.
 type GetGenerateCmd struct{}
 
@@ -523,6 +622,15 @@ func NewGetGenerateCmd() *GetGenerateCmd {
 	return &GetGenerateCmd{}
 }
 
+// GetGossipInfoCmd defines the getgossipinfo JSON-RPC command.
+type GetGossipInfoCmd struct{}
+
+// NewGetGossipInfoCmd returns a new instance which can be used to issue a
+// getgossipinfo JSON-RPC command.
+func NewGetGossipInfoCmd() *GetGossipInfoCmd {
+	return &GetGossipInfoCmd{}
+}
+
 // GetHashesPerSecCmd defines the gethashespersec JSON-RPC command.
 type GetHashesPerSecCmd struct{}
 
@@ -541,6 +649,42 @@ func NewGetInfoCmd() *GetInfoCmd {
 	return &GetInfoCmd{}
 }
 
+// GetMempoolAncestorsCmd defines the getmempoolancestors JSON-RPC command.
+type GetMempoolAncestorsCmd struct {
+	TxID    string
+	Verbose *bool `jsonrpcdefault:"false"`
+}
+
+// NewGetMempoolAncestorsCmd returns a new instance which can be used to issue
+// a getmempoolancestors JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetMempoolAncestorsCmd(txHash string, verbose *bool) *GetMempoolAncestorsCmd {
+	return &GetMempoolAncestorsCmd{
+		TxID:    txHash,
+		Verbose: verbose,
+	}
+}
+
+// GetMempoolDescendantsCmd defines the getmempooldescendants JSON-RPC command.
+type GetMempoolDescendantsCmd struct {
+	TxID    string
+	Verbose *bool `jsonrpcdefault:"false"`
+}
+
+// NewGetMempoolDescendantsCmd returns a new instance which can be used to
+// issue a getmempooldescendants JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetMempoolDescendantsCmd(txHash string, verbose *bool) *GetMempoolDescendantsCmd {
+	return &GetMempoolDescendantsCmd{
+		TxID:    txHash,
+		Verbose: verbose,
+	}
+}
+
 // GetMempoolEntryCmd defines the getmempoolentry JSON-RPC command.
 type GetMempoolEntryCmd struct {
 	TxID string
@@ -670,6 +814,34 @@ func NewGetRawTransactionCmd(txHash string, verbose *int) *GetRawTransactionCmd
 	}
 }
 
+// GetSpentInfoCmd defines the getspentinfo JSON-RPC command.
+type GetSpentInfoCmd struct {
+	Txid string
+	Vout uint32
+}
+
+// NewGetSpentInfoCmd returns a new instance which can be used to issue a
+// getspentinfo JSON-RPC command.
+func NewGetSpentInfoCmd(txHash string, vout uint32) *GetSpentInfoCmd {
+	return &GetSpentInfoCmd{
+		Txid: txHash,
+		Vout: vout,
+	}
+}
+
+// GetTxConfirmationsCmd defines the gettxconfirmations JSON-RPC command.
+type GetTxConfirmationsCmd struct {
+	Txid string
+}
+
+// NewGetTxConfirmationsCmd returns a new instance which can be used to issue a
+// gettxconfirmations JSON-RPC command.
+func NewGetTxConfirmationsCmd(txHash string) *GetTxConfirmationsCmd {
+	return &GetTxConfirmationsCmd{
+		Txid: txHash,
+	}
+}
+
 // GetTxOutCmd defines the gettxout JSON-RPC command.
 type GetTxOutCmd struct {
 	Txid           string
@@ -797,6 +969,31 @@ func NewReconsiderBlockCmd(blockHash string) *ReconsiderBlockCmd {
 	}
 }
 
+// ResyncChainStateCmd defines the resyncchainstate JSON-RPC command.
+type ResyncChainStateCmd struct {
+	StatusOnly *bool `jsonrpcdefault:"false"`
+}
+
+// NewResyncChainStateCmd returns a new instance which can be used to issue a
+// resyncchainstate JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewResyncChainStateCmd(statusOnly *bool) *ResyncChainStateCmd {
+	return &ResyncChainStateCmd{
+		StatusOnly: statusOnly,
+	}
+}
+
+// RunMaintenanceCmd defines the runmaintenance JSON-RPC command.
+type RunMaintenanceCmd struct{}
+
+// NewRunMaintenanceCmd returns a new instance which can be used to issue a
+// runmaintenance JSON-RPC command.
+func NewRunMaintenanceCmd() *RunMaintenanceCmd {
+	return &RunMaintenanceCmd{}
+}
+
 // SearchRawTransactionsCmd defines the searchrawtransactions JSON-RPC command.
 type SearchRawTransactionsCmd struct {
 	Address     string
@@ -927,6 +1124,21 @@ func NewSetGenerateCmd(generate bool, genProcLimit *int) *SetGenerateCmd {
 	}
 }
 
+// SetLogLevelCmd defines the setloglevel JSON-RPC command.
+type SetLogLevelCmd struct {
+	Subsystem string
+	Level     string
+}
+
+// NewSetLogLevelCmd returns a new instance which can be used to issue a
+// setloglevel JSON-RPC command.
+func NewSetLogLevelCmd(subsystem, level string) *SetLogLevelCmd {
+	return &SetLogLevelCmd{
+		Subsystem: subsystem,
+		Level:     level,
+	}
+}
+
 // SignMessageWithPrivKeyCmd defines the signmessagewithprivkey JSON-RPC command.
 type SignMessageWithPrivKeyCmd struct {
 	PrivKey string // base 58 Wallet Import format private key
@@ -1048,6 +1260,40 @@ func NewVerifyTxOutProofCmd(proof string) *VerifyTxOutProofCmd {
 	}
 }
 
+// WaitForBlockHeightCmd defines the waitforblockheight JSON-RPC command.
+type WaitForBlockHeightCmd struct {
+	Height  int64
+	Timeout *int64 `jsonrpcdefault:"0"` // milliseconds, 0 = no timeout
+}
+
+// NewWaitForBlockHeightCmd returns a new instance which can be used to issue a
+// waitforblockheight JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewWaitForBlockHeightCmd(height int64, timeout *int64) *WaitForBlockHeightCmd {
+	return &WaitForBlockHeightCmd{
+		Height:  height,
+		Timeout: timeout,
+	}
+}
+
+// WaitForNewBlockCmd defines the waitfornewblock JSON-RPC command.
+type WaitForNewBlockCmd struct {
+	Timeout *int64 `jsonrpcdefault:"0"` // milliseconds, 0 = no timeout
+}
+
+// NewWaitForNewBlockCmd returns a new instance which can be used to issue a
+// waitfornewblock JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewWaitForNewBlockCmd(timeout *int64) *WaitForNewBlockCmd {
+	return &WaitForNewBlockCmd{
+		Timeout: timeout,
+	}
+}
+
 // TestMempoolAcceptCmd defines the testmempoolaccept JSON-RPC command.
 type TestMempoolAcceptCmd struct {
 	// An array of hex strings of raw transactions.
@@ -1110,6 +1356,8 @@ func init() {
 	MustRegisterCmd("decoderawtransaction", (*DecodeRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decodescript", (*DecodeScriptCmd)(nil), flags)
 	MustRegisterCmd("deriveaddresses", (*DeriveAddressesCmd)(nil), flags)
+	MustRegisterCmd("estimatefeebytime", (*EstimateFeeByTimeCmd)(nil), flags)
+	MustRegisterCmd("exportchainstate", (*ExportChainStateCmd)(nil), flags)
 	MustRegisterCmd("fundrawtransaction", (*FundRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("getaddednodeinfo", (*GetAddedNodeInfoCmd)(nil), flags)
 	MustRegisterCmd("getbestblockhash", (*GetBestBlockHashCmd)(nil), flags)
@@ -1119,18 +1367,26 @@ func init() {
 	MustRegisterCmd("getblockfilter", (*GetBlockFilterCmd)(nil), flags)
 	MustRegisterCmd("getblockhash", (*GetBlockHashCmd)(nil), flags)
 	MustRegisterCmd("getblockheader", (*GetBlockHeaderCmd)(nil), flags)
+	MustRegisterCmd("getblockheaders", (*GetBlockHeadersCmd)(nil), flags)
 	MustRegisterCmd("getblockstats", (*GetBlockStatsCmd)(nil), flags)
 	MustRegisterCmd("getblocktemplate", (*GetBlockTemplateCmd)(nil), flags)
+	MustRegisterCmd("getcfheaders", (*GetCFHeadersCmd)(nil), flags)
 	MustRegisterCmd("getcfilter", (*GetCFilterCmd)(nil), flags)
 	MustRegisterCmd("getcfilterheader", (*GetCFilterHeaderCmd)(nil), flags)
 	MustRegisterCmd("getchaintips", (*GetChainTipsCmd)(nil), flags)
 	MustRegisterCmd("getchaintxstats", (*GetChainTxStatsCmd)(nil), flags)
+	MustRegisterCmd("getcheckpoint", (*GetCheckpointCmd)(nil), flags)
 	MustRegisterCmd("getconnectioncount", (*GetConnectionCountCmd)(nil), flags)
+	MustRegisterCmd("getconsensusinfo", (*GetConsensusInfoCmd)(nil), flags)
 	MustRegisterCmd("getdescriptorinfo", (*GetDescriptorInfoCmd)(nil), flags)
 	MustRegisterCmd("getdifficulty", (*GetDifficultyCmd)(nil), flags)
+	MustRegisterCmd("getdoublespends", (*GetDoubleSpendsCmd)(nil), flags)
 	MustRegisterCmd("getgenerate", (*GetGenerateCmd)(nil), flags)
+	MustRegisterCmd("getgossipinfo", (*GetGossipInfoCmd)(nil), flags)
 	MustRegisterCmd("gethashespersec", (*GetHashesPerSecCmd)(nil), flags)
 	MustRegisterCmd("getinfo", (*GetInfoCmd)(nil), flags)
+	MustRegisterCmd("getmempoolancestors", (*GetMempoolAncestorsCmd)(nil), flags)
+	MustRegisterCmd("getmempooldescendants", (*GetMempoolDescendantsCmd)(nil), flags)
 	MustRegisterCmd("getmempoolentry", (*GetMempoolEntryCmd)(nil), flags)
 	MustRegisterCmd("getmempoolinfo", (*GetMempoolInfoCmd)(nil), flags)
 	MustRegisterCmd("getmininginfo", (*GetMiningInfoCmd)(nil), flags)
@@ -1141,6 +1397,8 @@ func init() {
 	MustRegisterCmd("getpeerinfo", (*GetPeerInfoCmd)(nil), flags)
 	MustRegisterCmd("getrawmempool", (*GetRawMempoolCmd)(nil), flags)
 	MustRegisterCmd("getrawtransaction", (*GetRawTransactionCmd)(nil), flags)
+	MustRegisterCmd("getspentinfo", (*GetSpentInfoCmd)(nil), flags)
+	MustRegisterCmd("gettxconfirmations", (*GetTxConfirmationsCmd)(nil), flags)
 	MustRegisterCmd("gettxout", (*GetTxOutCmd)(nil), flags)
 	MustRegisterCmd("gettxoutproof", (*GetTxOutProofCmd)(nil), flags)
 	MustRegisterCmd("gettxoutsetinfo", (*GetTxOutSetInfoCmd)(nil), flags)
@@ -1150,10 +1408,13 @@ func init() {
 	MustRegisterCmd("ping", (*PingCmd)(nil), flags)
 	MustRegisterCmd("preciousblock", (*PreciousBlockCmd)(nil), flags)
 	MustRegisterCmd("reconsiderblock", (*ReconsiderBlockCmd)(nil), flags)
+	MustRegisterCmd("resyncchainstate", (*ResyncChainStateCmd)(nil), flags)
+	MustRegisterCmd("runmaintenance", (*RunMaintenanceCmd)(nil), flags)
 	MustRegisterCmd("searchrawtransactions", (*SearchRawTransactionsCmd)(nil), flags)
 	MustRegisterCmd("sendrawtransaction", (*SendRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("submitpackage", (*JsonSubmitPackageCmd)(nil), flags)
 	MustRegisterCmd("setgenerate", (*SetGenerateCmd)(nil), flags)
+	MustRegisterCmd("setloglevel", (*SetLogLevelCmd)(nil), flags)
 	MustRegisterCmd("signmessagewithprivkey", (*SignMessageWithPrivKeyCmd)(nil), flags)
 	MustRegisterCmd("stop", (*StopCmd)(nil), flags)
 	MustRegisterCmd("submitblock", (*SubmitBlockCmd)(nil), flags)
@@ -1162,6 +1423,8 @@ func init() {
 	MustRegisterCmd("verifychain", (*VerifyChainCmd)(nil), flags)
 	MustRegisterCmd("verifymessage", (*VerifyMessageCmd)(nil), flags)
 	MustRegisterCmd("verifytxoutproof", (*VerifyTxOutProofCmd)(nil), flags)
+	MustRegisterCmd("waitforblockheight", (*WaitForBlockHeightCmd)(nil), flags)
+	MustRegisterCmd("waitfornewblock", (*WaitForNewBlockCmd)(nil), flags)
 	MustRegisterCmd("testmempoolaccept", (*TestMempoolAcceptCmd)(nil), flags)
 	MustRegisterCmd("gettxspendingprevout", (*GetTxSpendingPrevOutCmd)(nil), flags)
 }
@@ -221,6 +221,45 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"decodescript","params":["00"],"id":1}`,
 			unmarshalled: &btcjson.DecodeScriptCmd{HexScript: "00"},
 		},
+		{
+			name: "estimatefeebytime - no mode",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("estimatefeebytime", 60)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewEstimateFeeByTimeCmd(60, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"estimatefeebytime","params":[60],"id":1}`,
+			unmarshalled: &btcjson.EstimateFeeByTimeCmd{
+				Seconds:      60,
+				EstimateMode: &btcjson.EstimateModeConservative,
+			},
+		},
+		{
+			name: "estimatefeebytime - economical mode",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("estimatefeebytime", 60, btcjson.EstimateModeEconomical)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewEstimateFeeByTimeCmd(60, &btcjson.EstimateModeEconomical)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"estimatefeebytime","params":[60,"ECONOMICAL"],"id":1}`,
+			unmarshalled: &btcjson.EstimateFeeByTimeCmd{
+				Seconds:      60,
+				EstimateMode: &btcjson.EstimateModeEconomical,
+			},
+		},
+		{
+			name: "exportchainstate",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("exportchainstate", "/tmp/export")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewExportChainStateCmd("/tmp/export")
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"exportchainstate","params":["/tmp/export"],"id":1}`,
+			unmarshalled: &btcjson.ExportChainStateCmd{Dir: "/tmp/export"},
+		},
 		{
 			name: "deriveaddresses no range",
 			newCmd: func() (interface{}, error) {
@@ -427,6 +466,36 @@ func TestChainSvrCmds(t *testing.T) {
 				Verbose: btcjson.Bool(true),
 			},
 		},
+		{
+			name: "getblockheaders",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblockheaders", 10, 100)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockHeadersCmd(10, 100, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblockheaders","params":[10,100],"id":1}`,
+			unmarshalled: &btcjson.GetBlockHeadersCmd{
+				StartHeight: 10,
+				Count:       100,
+				Verbose:     btcjson.Bool(true),
+			},
+		},
+		{
+			name: "getblockheaders optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblockheaders", 10, 100, false)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockHeadersCmd(10, 100, btcjson.Bool(false))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblockheaders","params":[10,100,false],"id":1}`,
+			unmarshalled: &btcjson.GetBlockHeadersCmd{
+				StartHeight: 10,
+				Count:       100,
+				Verbose:     btcjson.Bool(false),
+			},
+		},
 		{
 			name: "getblockstats height",
 			newCmd: func() (interface{}, error) {
@@ -564,6 +633,32 @@ func TestChainSvrCmds(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "getcfheaders",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getcfheaders", 1, "0000afaf")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetCFHeadersCmd(1, "0000afaf", nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getcfheaders","params":[1,"0000afaf"],"id":1}`,
+			unmarshalled: &btcjson.GetCFHeadersCmd{StartHeight: 1, StopHash: "0000afaf"},
+		},
+		{
+			name: "getcfheaders optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getcfheaders", 1, "0000afaf", "basic")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetCFHeadersCmd(1, "0000afaf", btcjson.NewFilterTypeName(btcjson.FilterTypeBasic))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getcfheaders","params":[1,"0000afaf","basic"],"id":1}`,
+			unmarshalled: &btcjson.GetCFHeadersCmd{
+				StartHeight: 1,
+				StopHash:    "0000afaf",
+				FilterType:  btcjson.NewFilterTypeName(btcjson.FilterTypeBasic),
+			},
+		},
 		{
 			name: "getcfilter",
 			newCmd: func() (interface{}, error) {
@@ -656,6 +751,28 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getconnectioncount","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetConnectionCountCmd{},
 		},
+		{
+			name: "getcheckpoint",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getcheckpoint")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetCheckpointCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getcheckpoint","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetCheckpointCmd{},
+		},
+		{
+			name: "getconsensusinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getconsensusinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetConsensusInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getconsensusinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetConsensusInfoCmd{},
+		},
 		{
 			name: "getdifficulty",
 			newCmd: func() (interface{}, error) {
@@ -667,6 +784,19 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getdifficulty","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetDifficultyCmd{},
 		},
+		{
+			name: "getdoublespends",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getdoublespends", "123")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetDoubleSpendsCmd("123")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getdoublespends","params":["123"],"id":1}`,
+			unmarshalled: &btcjson.GetDoubleSpendsCmd{
+				TxID: "123",
+			},
+		},
 		{
 			name: "getgenerate",
 			newCmd: func() (interface{}, error) {
@@ -678,6 +808,17 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getgenerate","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetGenerateCmd{},
 		},
+		{
+			name: "getgossipinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getgossipinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetGossipInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getgossipinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetGossipInfoCmd{},
+		},
 		{
 			name: "gethashespersec",
 			newCmd: func() (interface{}, error) {
@@ -700,6 +841,62 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getinfo","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetInfoCmd{},
 		},
+		{
+			name: "getmempoolancestors",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmempoolancestors", "txhash")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMempoolAncestorsCmd("txhash", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempoolancestors","params":["txhash"],"id":1}`,
+			unmarshalled: &btcjson.GetMempoolAncestorsCmd{
+				TxID:    "txhash",
+				Verbose: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "getmempoolancestors optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmempoolancestors", "txhash", true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMempoolAncestorsCmd("txhash", btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempoolancestors","params":["txhash",true],"id":1}`,
+			unmarshalled: &btcjson.GetMempoolAncestorsCmd{
+				TxID:    "txhash",
+				Verbose: btcjson.Bool(true),
+			},
+		},
+		{
+			name: "getmempooldescendants",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmempooldescendants", "txhash")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMempoolDescendantsCmd("txhash", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempooldescendants","params":["txhash"],"id":1}`,
+			unmarshalled: &btcjson.GetMempoolDescendantsCmd{
+				TxID:    "txhash",
+				Verbose: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "getmempooldescendants optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmempooldescendants", "txhash", true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMempoolDescendantsCmd("txhash", btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempooldescendants","params":["txhash",true],"id":1}`,
+			unmarshalled: &btcjson.GetMempoolDescendantsCmd{
+				TxID:    "txhash",
+				Verbose: btcjson.Bool(true),
+			},
+		},
 		{
 			name: "getmempoolentry",
 			newCmd: func() (interface{}, error) {
@@ -890,6 +1087,33 @@ func TestChainSvrCmds(t *testing.T) {
 				Verbose: btcjson.Int(1),
 			},
 		},
+		{
+			name: "getspentinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getspentinfo", "123", 1)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetSpentInfoCmd("123", 1)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getspentinfo","params":["123",1],"id":1}`,
+			unmarshalled: &btcjson.GetSpentInfoCmd{
+				Txid: "123",
+				Vout: 1,
+			},
+		},
+		{
+			name: "gettxconfirmations",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("gettxconfirmations", "123")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetTxConfirmationsCmd("123")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"gettxconfirmations","params":["123"],"id":1}`,
+			unmarshalled: &btcjson.GetTxConfirmationsCmd{
+				Txid: "123",
+			},
+		},
 		{
 			name: "gettxout",
 			newCmd: func() (interface{}, error) {
@@ -1063,6 +1287,43 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "123",
 			},
 		},
+		{
+			name: "resyncchainstate",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("resyncchainstate")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewResyncChainStateCmd(nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"resyncchainstate","params":[],"id":1}`,
+			unmarshalled: &btcjson.ResyncChainStateCmd{
+				StatusOnly: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "resyncchainstate status",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("resyncchainstate", true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewResyncChainStateCmd(btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"resyncchainstate","params":[true],"id":1}`,
+			unmarshalled: &btcjson.ResyncChainStateCmd{
+				StatusOnly: btcjson.Bool(true),
+			},
+		},
+		{
+			name: "runmaintenance",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("runmaintenance")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewRunMaintenanceCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"runmaintenance","params":[],"id":1}`,
+			unmarshalled: &btcjson.RunMaintenanceCmd{},
+		},
 		{
 			name: "searchrawtransactions",
 			newCmd: func() (interface{}, error) {
@@ -1298,6 +1559,20 @@ func TestChainSvrCmds(t *testing.T) {
 				GenProcLimit: btcjson.Int(6),
 			},
 		},
+		{
+			name: "setloglevel",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("setloglevel", "mempool", "debug")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSetLogLevelCmd("mempool", "debug")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setloglevel","params":["mempool","debug"],"id":1}`,
+			unmarshalled: &btcjson.SetLogLevelCmd{
+				Subsystem: "mempool",
+				Level:     "debug",
+			},
+		},
 		{
 			name: "signmessagewithprivkey",
 			newCmd: func() (interface{}, error) {
@@ -1450,6 +1725,60 @@ func TestChainSvrCmds(t *testing.T) {
 				Proof: "test",
 			},
 		},
+		{
+			name: "waitforblockheight",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("waitforblockheight", 100)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewWaitForBlockHeightCmd(100, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"waitforblockheight","params":[100],"id":1}`,
+			unmarshalled: &btcjson.WaitForBlockHeightCmd{
+				Height:  100,
+				Timeout: btcjson.Int64(0),
+			},
+		},
+		{
+			name: "waitforblockheight optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("waitforblockheight", 100, 1000)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewWaitForBlockHeightCmd(100, btcjson.Int64(1000))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"waitforblockheight","params":[100,1000],"id":1}`,
+			unmarshalled: &btcjson.WaitForBlockHeightCmd{
+				Height:  100,
+				Timeout: btcjson.Int64(1000),
+			},
+		},
+		{
+			name: "waitfornewblock",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("waitfornewblock")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewWaitForNewBlockCmd(nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"waitfornewblock","params":[],"id":1}`,
+			unmarshalled: &btcjson.WaitForNewBlockCmd{
+				Timeout: btcjson.Int64(0),
+			},
+		},
+		{
+			name: "waitfornewblock optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("waitfornewblock", 1000)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewWaitForNewBlockCmd(btcjson.Int64(1000))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"waitfornewblock","params":[1000],"id":1}`,
+			unmarshalled: &btcjson.WaitForNewBlockCmd{
+				Timeout: btcjson.Int64(1000),
+			},
+		},
 		{
 			name: "getdescriptorinfo",
 			newCmd: func() (interface{}, error) {
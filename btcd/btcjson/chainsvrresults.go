@@ -58,6 +58,7 @@ type GetBlockStatsResult struct {
 	SegWitTxs          int64   `json:"swtxs"`
 	Subsidy            int64   `json:"subsidy"`
 	Time               int64   `json:"time"`
+	TotalFee           int64   `json:"totalfee"`
 	TotalOut           int64   `json:"total_out"`
 	TotalSize          int64   `json:"total_size"`
 	TotalWeight        int64   `json:"total_weight"`
@@ -90,6 +91,10 @@ type GetBlockVerboseResult struct {
 	Difficulty    float64       `json:"difficulty"`
 	PreviousHash  string        `json:"previousblockhash"`
 	NextHash      string        `json:"nextblockhash,omitempty"`
+
+	// Proposer is the NodeID of the validator which built the block, if it
+	// recorded one in its coinbase.  It is only set by btcvm.
+	Proposer string `json:"proposer,omitempty"`
 }
 
 // GetBlockVerboseTxResult models the data from the getblock command when the
@@ -116,6 +121,10 @@ type GetBlockVerboseTxResult struct {
 	Difficulty    float64       `json:"difficulty"`
 	PreviousHash  string        `json:"previousblockhash"`
 	NextHash      string        `json:"nextblockhash,omitempty"`
+
+	// Proposer is the NodeID of the validator which built the block, if it
+	// recorded one in its coinbase.  It is only set by btcvm.
+	Proposer string `json:"proposer,omitempty"`
 }
 
 // GetChainTipsResult models the data from the getchaintips command.
@@ -124,6 +133,10 @@ type GetChainTipsResult struct {
 	Hash      string `json:"hash"`
 	BranchLen int32  `json:"branchlen"`
 	Status    string `json:"status"`
+
+	// ConsensusStatus is the status of the tip in consensus: accepted,
+	// processing, rejected or orphaned.  It is only set by btcvm.
+	ConsensusStatus string `json:"consensusstatus,omitempty"`
 }
 
 // GetChainTxStatsResult models the data from the getchaintxstats command.
@@ -223,6 +236,65 @@ type UnifiedSoftForks struct {
 	SoftForks map[string]*UnifiedSoftFork `json:"softforks"`
 }
 
+// ConsensusInfo describes how the blocks of a btcvm chain are agreed upon.
+// Blocks are accepted by Snowman consensus on a Metal subnet rather than by
+// proof of work, so this data is returned by the getconsensusinfo command and
+// alongside the standard getblockchaininfo fields.
+type ConsensusInfo struct {
+	Engine           string `json:"engine"`
+	LastAccepted     string `json:"lastaccepted"`
+	TargetBlockTime  int64  `json:"targetblocktime"`
+	PoWEnforced      bool   `json:"powenforced"`
+	CoinbaseMaturity uint16 `json:"coinbasematurity"`
+	SubnetID         string `json:"subnetid"`
+	ChainID          string `json:"chainid"`
+}
+
+// GetCheckpointResult models the data returned from the getcheckpoint
+// command.  It has the format of the checkpoints of the btcvm config.
+type GetCheckpointResult struct {
+	Height int64  `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+// GetGossipInfoResult models the data returned from the getgossipinfo command.
+type GetGossipInfoResult struct {
+	Bloom          GossipBloomInfo `json:"bloom"`
+	Push           GossipLoopInfo  `json:"push"`
+	Pull           GossipLoopInfo  `json:"pull"`
+	PushQueueDepth int64           `json:"pushqueuedepth"`
+	BytesSent      uint64          `json:"bytessent"`
+	BytesReceived  uint64          `json:"bytesreceived"`
+}
+
+// GossipBloomInfo models the state of the bloom filter of the gossiped items
+// returned by the getgossipinfo command.
+type GossipBloomInfo struct {
+	Elements               int64   `json:"elements"`
+	MaxElements            int64   `json:"maxelements"`
+	Size                   int64   `json:"size"`
+	FalsePositiveRate      float64 `json:"falsepositiverate"`
+	ResetFalsePositiveRate float64 `json:"resetfalsepositiverate"`
+	Resets                 uint64  `json:"resets"`
+	Rotations              uint64  `json:"rotations"`
+}
+
+// GossipLoopInfo models the activity of the push or pull gossip loop returned
+// by the getgossipinfo command.
+type GossipLoopInfo struct {
+	Items             uint64 `json:"items"`
+	Bytes             uint64 `json:"bytes"`
+	LastIntervalItems uint64 `json:"lastintervalitems"`
+	LastCycle         int64  `json:"lastcycle"`
+}
+
+// WaitForBlockResult models the data returned from the waitfornewblock and
+// waitforblockheight commands.
+type WaitForBlockResult struct {
+	Hash   string `json:"hash"`
+	Height int64  `json:"height"`
+}
+
 // GetBlockChainInfoResult models the data returned from the getblockchaininfo
 // command.
 type GetBlockChainInfoResult struct {
@@ -240,6 +312,7 @@ type GetBlockChainInfoResult struct {
 	SizeOnDisk           int64   `json:"size_on_disk,omitempty"`
 	*SoftForks
 	*UnifiedSoftForks
+	*ConsensusInfo
 }
 
 // GetBlockFilterResult models the data returned from the getblockfilter
@@ -249,6 +322,15 @@ type GetBlockFilterResult struct {
 	Header string `json:"header"` // the hex-encoded filter header
 }
 
+// GetCFHeadersResult models the data returned from the getcfheaders command.
+// As with the cfheaders message of BIP0157, the filter headers of the blocks
+// are derived from the previous filter header and the filter hashes.
+type GetCFHeadersResult struct {
+	StopHash         string   `json:"stophash"`         // the hash of the last block
+	PrevFilterHeader string   `json:"prevfilterheader"` // the filter header of the block before the first block
+	FilterHashes     []string `json:"filterhashes"`     // the filter hashes of the blocks
+}
+
 // GetBlockTemplateResultTx models the transactions field of the
 // getblocktemplate command.
 type GetBlockTemplateResultTx struct {
@@ -309,6 +391,17 @@ type GetBlockTemplateResult struct {
 	RejectReason string   `json:"reject-reason,omitempty"`
 }
 
+// DoubleSpendResult models a conflict between two transactions spending the
+// same outpoints.  It is returned by the getdoublespends command and carried
+// by the doublespendseen notification.
+type DoubleSpendResult struct {
+	TxID         string     `json:"txid"`
+	ConflictTxID string     `json:"conflicttxid"`
+	OutPoints    []OutPoint `json:"outpoints"`
+	Confirmed    bool       `json:"confirmed"`
+	Time         int64      `json:"time"`
+}
+
 // GetMempoolEntryResult models the data returned from the getmempoolentry's
 // fee field
 
@@ -338,13 +431,21 @@ type GetMempoolEntryResult struct {
 	WTxId           string      `json:"wtxid"`
 	Fees            MempoolFees `json:"fees"`
 	Depends         []string    `json:"depends"`
+	SpentBy         []string    `json:"spentby"`
 }
 
 // GetMempoolInfoResult models the data returned from the getmempoolinfo
 // command.
 type GetMempoolInfoResult struct {
-	Size  int64 `json:"size"`
-	Bytes int64 `json:"bytes"`
+	Size               int64   `json:"size"`
+	Bytes              int64   `json:"bytes"`
+	Orphans            int64   `json:"orphans"`
+	MaxMempool         int64   `json:"maxmempool"`
+	MempoolMinFee      float64 `json:"mempoolminfee"`
+	MinGossipFeeRate   float64 `json:"mingossipfeerate"`
+	MinRelayFeeRate    float64 `json:"minrelayfeerate"`
+	DataCarrier        bool    `json:"datacarrier"`
+	MaxDataCarrierSize uint32  `json:"maxdatacarriersize"`
 }
 
 // NetworksResult models the networks data from the getnetworkinfo command.
@@ -425,6 +526,26 @@ type GetNetworkInfoResult struct {
 	IncrementalFee  float64                `json:"incrementalfee"`
 	LocalAddresses  []LocalAddressesResult `json:"localaddresses"`
 	Warnings        StringOrArray          `json:"warnings"`
+
+	// MinGossipFeeRate and MinRelayFeeRate are the minimum fee rates in
+	// sat/vB of transactions accepted from and gossiped to peers.
+	MinGossipFeeRate float64 `json:"mingossipfeerate,omitempty"`
+	MinRelayFeeRate  float64 `json:"minrelayfeerate,omitempty"`
+
+	// Metal describes the connectivity of a btcvm node on the Metal
+	// network, which replaces the legacy peer-to-peer network.
+	Metal *MetalNetworkInfo `json:"metal,omitempty"`
+}
+
+// MetalNetworkInfo describes the Metal network a btcvm node gossips blocks
+// and transactions on.  It is returned by the getnetworkinfo command.
+type MetalNetworkInfo struct {
+	NodeID         string `json:"nodeid"`
+	NetworkID      uint32 `json:"networkid"`
+	SubnetID       string `json:"subnetid"`
+	ChainID        string `json:"chainid"`
+	Peers          int32  `json:"peers"`
+	ValidatorPeers int32  `json:"validatorpeers"`
 }
 
 // GetNodeAddressesResult models the data returned from the getnodeaddresses
@@ -461,6 +582,19 @@ type GetPeerInfoResult struct {
 	FeeFilter      int64   `json:"feefilter"`
 	SyncNode       bool    `json:"syncnode"`
 	V2Connection   bool    `json:"v2_connection"`
+
+	// Gossip is set for the peers of a btcvm node on the Metal network.
+	Gossip *MetalPeerGossipInfo `json:"gossip,omitempty"`
+}
+
+// MetalPeerGossipInfo counts the items a peer of a btcvm node pushed on the
+// Metal network, by outcome.  It is returned by the getpeerinfo command.
+type MetalPeerGossipInfo struct {
+	UsefulItems    uint64 `json:"usefulitems"`
+	DuplicateItems uint64 `json:"duplicateitems"`
+	InvalidTxs     uint64 `json:"invalidtxs"`
+	InvalidBlocks  uint64 `json:"invalidblocks"`
+	OversizedItems uint64 `json:"oversizeditems"`
 }
 
 // GetRawMempoolVerboseResult models the data returned from the getrawmempool
@@ -489,6 +623,23 @@ type ScriptPubKeyResult struct {
 	Addresses []string `json:"addresses,omitempty"` // Deprecated: removed in Bitcoin Core
 }
 
+// GetSpentInfoResult models the data from the getspentinfo command.
+type GetSpentInfoResult struct {
+	Txid   string `json:"txid"`
+	Index  uint32 `json:"index"`
+	Height int32  `json:"height"`
+}
+
+// GetTxConfirmationsResult models the data from the gettxconfirmations
+// command.
+type GetTxConfirmationsResult struct {
+	BlockHash      string `json:"blockhash,omitempty"`
+	BlockHeight    int32  `json:"blockheight,omitempty"`
+	AcceptedHeight int32  `json:"acceptedheight"`
+	Confirmations  int64  `json:"confirmations"`
+	Finalized      bool   `json:"finalized"`
+}
+
 // GetTxOutResult models the data from the gettxout command.
 type GetTxOutResult struct {
 	BestBlock     string             `json:"bestblock"`
@@ -574,6 +725,9 @@ type ScriptSig struct {
 // Vin models parts of the tx data.  It is defined separately since
 // getrawtransaction, decoderawtransaction, and searchrawtransaction use the
 // same structure.
+//
+// PrevOut is only set by getrawtransaction when the spent output index is
+// enabled.
 type Vin struct {
 	Coinbase  string     `json:"coinbase"`
 	Txid      string     `json:"txid"`
@@ -581,6 +735,7 @@ type Vin struct {
 	ScriptSig *ScriptSig `json:"scriptSig"`
 	Sequence  uint32     `json:"sequence"`
 	Witness   []string   `json:"txinwitness"`
+	PrevOut   *PrevOut   `json:"prevOut,omitempty"`
 }
 
 // IsCoinBase returns a bool to show if a Vin is a Coinbase one or not.
@@ -615,12 +770,14 @@ func (v *Vin) MarshalJSON() ([]byte, error) {
 			Vout      uint32     `json:"vout"`
 			ScriptSig *ScriptSig `json:"scriptSig"`
 			Witness   []string   `json:"txinwitness"`
+			PrevOut   *PrevOut   `json:"prevOut,omitempty"`
 			Sequence  uint32     `json:"sequence"`
 		}{
 			Txid:      v.Txid,
 			Vout:      v.Vout,
 			ScriptSig: v.ScriptSig,
 			Witness:   v.Witness,
+			PrevOut:   v.PrevOut,
 			Sequence:  v.Sequence,
 		}
 		return json.Marshal(txStruct)
@@ -630,11 +787,13 @@ func (v *Vin) MarshalJSON() ([]byte, error) {
 		Txid      string     `json:"txid"`
 		Vout      uint32     `json:"vout"`
 		ScriptSig *ScriptSig `json:"scriptSig"`
+		PrevOut   *PrevOut   `json:"prevOut,omitempty"`
 		Sequence  uint32     `json:"sequence"`
 	}{
 		Txid:      v.Txid,
 		Vout:      v.Vout,
 		ScriptSig: v.ScriptSig,
+		PrevOut:   v.PrevOut,
 		Sequence:  v.Sequence,
 	}
 	return json.Marshal(txStruct)
@@ -738,6 +897,29 @@ type GetMiningInfoResult struct {
 	NetworkHashPS      float64 `json:"networkhashps"`
 	PooledTx           uint64  `json:"pooledtx"`
 	TestNet            bool    `json:"testnet"`
+
+	// BlockMaxWeight and BlockMaxSize are the limits of blocks built by the
+	// node.
+	BlockMaxWeight uint32 `json:"blockmaxweight,omitempty"`
+	BlockMaxSize   uint32 `json:"blockmaxsize,omitempty"`
+
+	// Metal describes the block builder of a btcvm node, which builds the
+	// blocks it proposes to consensus rather than mining them.
+	Metal *MetalMiningInfo `json:"metal,omitempty"`
+}
+
+// MetalMiningInfo describes the block builder of a btcvm node.  It is returned
+// by the getmininginfo command.  When PoWDisabled is set, blocks carry no
+// proof of work, so the difficulty is reported as 1 and the network hashes
+// per second as 0.
+type MetalMiningInfo struct {
+	BuilderEnabled  bool     `json:"builderenabled"`
+	MiningAddrs     []string `json:"miningaddrs"`
+	TargetBlockTime float64  `json:"targetblocktime"`
+	PoWDisabled     bool     `json:"powdisabled"`
+	LastBuiltBlock  string   `json:"lastbuiltblock,omitempty"`
+	LastBuiltHeight int64    `json:"lastbuiltheight,omitempty"`
+	LastBuiltTime   int64    `json:"lastbuilttime,omitempty"`
 }
 
 // GetWorkResult models the data from the getwork command.
@@ -778,6 +960,7 @@ type TxRawResult struct {
 	Confirmations uint64 `json:"confirmations,omitempty"`
 	Time          int64  `json:"time,omitempty"`
 	Blocktime     int64  `json:"blocktime,omitempty"`
+	Finalized     *bool  `json:"finalized,omitempty"`
 }
 
 // SearchRawTransactionsResult models the data from the searchrawtransaction
@@ -831,6 +1014,33 @@ type EstimateSmartFeeResult struct {
 	Blocks  int64    `json:"blocks"`
 }
 
+// ExportChainStateResult models the data returned from the exportchainstate
+// command.
+type ExportChainStateResult struct {
+	Dir       string `json:"dir"`
+	TipHeight int64  `json:"tipheight"`
+	TipHash   string `json:"tiphash"`
+	Checksum  string `json:"checksum"`
+}
+
+// ResyncChainStateResult models the data returned from the resyncchainstate
+// command.
+type ResyncChainStateResult struct {
+	Running      bool   `json:"running"`
+	StartHeight  int64  `json:"startheight"`
+	Height       int64  `json:"height"`
+	TargetHeight int64  `json:"targetheight"`
+	Error        string `json:"error,omitempty"`
+}
+
+// RunMaintenanceResult models the data returned from the runmaintenance
+// command.  The durations are in seconds.
+type RunMaintenanceResult struct {
+	FlushDuration   float64 `json:"flushduration"`
+	Compacted       bool    `json:"compacted"`
+	CompactDuration float64 `json:"compactduration"`
+}
+
 var _ json.Unmarshaler = &FundRawTransactionResult{}
 
 type rawFundRawTransactionResult struct {
@@ -936,6 +1146,48 @@ type TestMempoolAcceptResult struct {
 	RejectReason string `json:"reject-reason,omitempty"`
 }
 
+// Reasons of a TxRejection.
+const (
+	// TxRejectMissingInputs is the reason of transactions spending
+	// outputs which are unknown or already spent in the chain.
+	TxRejectMissingInputs = "missing-inputs"
+
+	// TxRejectLowFee is the reason of transactions paying less than the
+	// minimum relay fee, the fee needed to enter a full mempool or the fee
+	// needed to replace their conflicts.
+	TxRejectLowFee = "low-fee"
+
+	// TxRejectNonStandard is the reason of transactions breaking the
+	// standardness policy of the mempool.
+	TxRejectNonStandard = "non-standard"
+
+	// TxRejectConflict is the reason of transactions spending outputs
+	// already spent by mempool transactions they can't replace.
+	TxRejectConflict = "conflict"
+
+	// TxRejectMaxFeeExceeded is the reason of transactions paying a fee
+	// rate above the maxfeerate of the request.
+	TxRejectMaxFeeExceeded = "max-fee-exceeded"
+
+	// TxRejectAlreadyInChain is the reason of transactions already
+	// confirmed in the chain.
+	TxRejectAlreadyInChain = "already-in-chain"
+
+	// TxRejectInvalid is the reason of the other rejected transactions.
+	TxRejectInvalid = "invalid"
+)
+
+// TxRejection models the data of the error of sendrawtransaction when the
+// transaction is rejected.
+type TxRejection struct {
+	// Reason is one of the TxReject reasons.
+	Reason string `json:"reason"`
+
+	// ConflictingTxids are the mempool transactions spending the same
+	// outputs as the rejected transaction, if any.
+	ConflictingTxids []string `json:"conflictingtxids,omitempty"`
+}
+
 // TestMempoolAcceptFees models the `fees` section from the testmempoolaccept
 // command.
 type TestMempoolAcceptFees struct {
@@ -88,6 +88,60 @@ func TestChainSvrCustomResults(t *testing.T) {
 			}},
 			expected: `[{"address":"tcp://127.0.0.1:1238","hwm":1337,"type":"pubrawblock"}]`,
 		},
+		{
+			name: "consensus info",
+			result: &btcjson.ConsensusInfo{
+				Engine:           "snowman",
+				LastAccepted:     "2JHbGP8Vm9MGa3MjHwSJMMFB1ehjzNYZkz1jTqDdsFzcrkfmHb",
+				TargetBlockTime:  2,
+				CoinbaseMaturity: 100,
+				SubnetID:         "11111111111111111111111111111111LpoYY",
+				ChainID:          "2Y17pVUomrGsf1GmiNZAPFfYgCZ9Np3N5Fd9oXQwmEqQS1buWR",
+			},
+			expected: `{"engine":"snowman","lastaccepted":"2JHbGP8Vm9MGa3MjHwSJMMFB1ehjzNYZkz1jTqDdsFzcrkfmHb",` +
+				`"targetblocktime":2,"powenforced":false,"coinbasematurity":100,` +
+				`"subnetid":"11111111111111111111111111111111LpoYY",` +
+				`"chainid":"2Y17pVUomrGsf1GmiNZAPFfYgCZ9Np3N5Fd9oXQwmEqQS1buWR"}`,
+		},
+		{
+			name: "blockchain info with consensus info",
+			result: &btcjson.GetBlockChainInfoResult{
+				Chain:         "btcvmtestnet",
+				Blocks:        2,
+				Headers:       1,
+				BestBlockHash: "000000000000005f94116250e2407310463c0a7cf950f1af9ebe935b1c0687ab",
+				Difficulty:    1,
+				MedianTime:    1700000000,
+				ConsensusInfo: &btcjson.ConsensusInfo{
+					Engine:          "snowman",
+					LastAccepted:    "2JHbGP8Vm9MGa3MjHwSJMMFB1ehjzNYZkz1jTqDdsFzcrkfmHb",
+					TargetBlockTime: 2,
+					SubnetID:        "11111111111111111111111111111111LpoYY",
+					ChainID:         "2Y17pVUomrGsf1GmiNZAPFfYgCZ9Np3N5Fd9oXQwmEqQS1buWR",
+				},
+			},
+			expected: `{"chain":"btcvmtestnet","blocks":2,"headers":1,` +
+				`"bestblockhash":"000000000000005f94116250e2407310463c0a7cf950f1af9ebe935b1c0687ab",` +
+				`"difficulty":1,"mediantime":1700000000,"pruned":false,` +
+				`"engine":"snowman","lastaccepted":"2JHbGP8Vm9MGa3MjHwSJMMFB1ehjzNYZkz1jTqDdsFzcrkfmHb",` +
+				`"targetblocktime":2,"powenforced":false,"coinbasematurity":0,` +
+				`"subnetid":"11111111111111111111111111111111LpoYY",` +
+				`"chainid":"2Y17pVUomrGsf1GmiNZAPFfYgCZ9Np3N5Fd9oXQwmEqQS1buWR"}`,
+		},
+		{
+			name: "blockchain info without consensus info",
+			result: &btcjson.GetBlockChainInfoResult{
+				Chain:         "mainnet",
+				Blocks:        2,
+				Headers:       1,
+				BestBlockHash: "000000000000005f94116250e2407310463c0a7cf950f1af9ebe935b1c0687ab",
+				Difficulty:    1,
+				MedianTime:    1700000000,
+			},
+			expected: `{"chain":"mainnet","blocks":2,"headers":1,` +
+				`"bestblockhash":"000000000000005f94116250e2407310463c0a7cf950f1af9ebe935b1c0687ab",` +
+				`"difficulty":1,"mediantime":1700000000,"pruned":false}`,
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
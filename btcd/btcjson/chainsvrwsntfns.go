@@ -75,6 +75,11 @@ const (
 	// from the chain server that inform a client that a transaction that
 	// matches the loaded filter was accepted by the mempool.
 	RelevantTxAcceptedNtfnMethod = "relevanttxaccepted"
+
+	// DoubleSpendSeenNtfnMethod is the method used for notifications from
+	// the chain server that a transaction conflicting with the mempool has
+	// been seen, either relayed by a peer or confirmed in a block.
+	DoubleSpendSeenNtfnMethod = "doublespendseen"
 )
 
 // BlockConnectedNtfn defines the blockconnected JSON-RPC notification.
@@ -99,12 +104,14 @@ func NewBlockConnectedNtfn(hash string, height int32, time int64) *BlockConnecte
 }
 
 // BlockDisconnectedNtfn defines the blockdisconnected JSON-RPC notification.
+// Txids optionally lists the transactions of the block which were reverted.
 //
 // Deprecated: Use FilteredBlockDisconnectedNtfn instead.
 type BlockDisconnectedNtfn struct {
 	Hash   string
 	Height int32
 	Time   int64
+	Txids  *[]string
 }
 
 // NewBlockDisconnectedNtfn returns a new instance which can be used to issue a
@@ -285,6 +292,19 @@ func NewRelevantTxAcceptedNtfn(txHex string) *RelevantTxAcceptedNtfn {
 	return &RelevantTxAcceptedNtfn{Transaction: txHex}
 }
 
+// DoubleSpendSeenNtfn defines the doublespendseen JSON-RPC notification.
+type DoubleSpendSeenNtfn struct {
+	DoubleSpend DoubleSpendResult
+}
+
+// NewDoubleSpendSeenNtfn returns a new instance which can be used to issue a
+// doublespendseen JSON-RPC notification.
+func NewDoubleSpendSeenNtfn(doubleSpend DoubleSpendResult) *DoubleSpendSeenNtfn {
+	return &DoubleSpendSeenNtfn{
+		DoubleSpend: doubleSpend,
+	}
+}
+
 func init() {
 	// The commands in this file are only usable by websockets and are
 	// notifications.
@@ -301,4 +321,5 @@ func init() {
 	MustRegisterCmd(TxAcceptedNtfnMethod, (*TxAcceptedNtfn)(nil), flags)
 	MustRegisterCmd(TxAcceptedVerboseNtfnMethod, (*TxAcceptedVerboseNtfn)(nil), flags)
 	MustRegisterCmd(RelevantTxAcceptedNtfnMethod, (*RelevantTxAcceptedNtfn)(nil), flags)
+	MustRegisterCmd(DoubleSpendSeenNtfnMethod, (*DoubleSpendSeenNtfn)(nil), flags)
 }
@@ -59,6 +59,24 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				Time:   123456789,
 			},
 		},
+		{
+			name: "blockdisconnected with txids",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("blockdisconnected", "123", 100000, 123456789, []string{"tx0", "tx1"})
+			},
+			staticNtfn: func() interface{} {
+				ntfn := btcjson.NewBlockDisconnectedNtfn("123", 100000, 123456789)
+				ntfn.Txids = &[]string{"tx0", "tx1"}
+				return ntfn
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"blockdisconnected","params":["123",100000,123456789,["tx0","tx1"]],"id":null}`,
+			unmarshalled: &btcjson.BlockDisconnectedNtfn{
+				Hash:   "123",
+				Height: 100000,
+				Time:   123456789,
+				Txids:  &[]string{"tx0", "tx1"},
+			},
+		},
 		{
 			name: "filteredblockconnected",
 			newNtfn: func() (interface{}, error) {
@@ -225,6 +243,32 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				Transaction: "001122",
 			},
 		},
+		{
+			name: "doublespendseen",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("doublespendseen", `{"txid":"123","conflicttxid":"456","outpoints":[{"hash":"789","index":1}],"confirmed":false,"time":10}`)
+			},
+			staticNtfn: func() interface{} {
+				doubleSpend := btcjson.DoubleSpendResult{
+					TxID:         "123",
+					ConflictTxID: "456",
+					OutPoints:    []btcjson.OutPoint{{Hash: "789", Index: 1}},
+					Confirmed:    false,
+					Time:         10,
+				}
+				return btcjson.NewDoubleSpendSeenNtfn(doubleSpend)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"doublespendseen","params":[{"txid":"123","conflicttxid":"456","outpoints":[{"hash":"789","index":1}],"confirmed":false,"time":10}],"id":null}`,
+			unmarshalled: &btcjson.DoubleSpendSeenNtfn{
+				DoubleSpend: btcjson.DoubleSpendResult{
+					TxID:         "123",
+					ConflictTxID: "456",
+					OutPoints:    []btcjson.OutPoint{{Hash: "789", Index: 1}},
+					Confirmed:    false,
+					Time:         10,
+				},
+			},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
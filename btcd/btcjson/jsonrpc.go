@@ -47,6 +47,10 @@ type RPCErrorCode int
 type RPCError struct {
 	Code    RPCErrorCode `json:"code,omitempty"`
 	Message string       `json:"message,omitempty"`
+
+	// Data holds structured details of the error, such as the
+	// *TxRejection of a transaction rejected by sendrawtransaction.
+	Data interface{} `json:"data,omitempty"`
 }
 
 // Guarantee RPCError satisfies the builtin error interface.
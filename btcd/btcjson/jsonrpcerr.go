@@ -186,4 +186,8 @@ const (
 const (
 	ErrRPCNoWallet      RPCErrorCode = -1
 	ErrRPCUnimplemented RPCErrorCode = -1
+
+	// ErrRPCLimitExceeded indicates that the client exceeded a limit of the
+	// server, such as its request rate or number of subscriptions.
+	ErrRPCLimitExceeded RPCErrorCode = -32005
 )
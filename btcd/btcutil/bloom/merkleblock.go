@@ -5,12 +5,19 @@
 package bloom
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
 	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
 	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
 	"github.com/MetalBlockchain/btcvm/btcd/wire"
 )
 
+// minTxPayload is the minimum payload size for a transaction, used to bound
+// the number of transactions of a merkle block.
+const minTxPayload = 10
+
 // merkleBlock is used to house intermediate information needed to generate a
 // wire.MsgMerkleBlock according to a filter.
 type merkleBlock struct {
@@ -81,6 +88,25 @@ func (m *merkleBlock) traverseAndBuild(height, pos uint32) {
 // NewMerkleBlock returns a new *wire.MsgMerkleBlock and an array of the matched
 // transaction index numbers based on the passed block and filter.
 func NewMerkleBlock(block *btcutil.Block, filter *Filter) (*wire.MsgMerkleBlock, []uint32) {
+	return newMerkleBlock(block, filter.MatchTxAndUpdate)
+}
+
+// NewMerkleBlockWithTxIDs returns a new *wire.MsgMerkleBlock proving the
+// inclusion of the transactions of the passed block whose hash is in txIDs,
+// along with an array of their index numbers.  The transactions are matched
+// by their txid, as the merkle tree of the block header does not commit to
+// witness data.
+func NewMerkleBlockWithTxIDs(block *btcutil.Block, txIDs map[chainhash.Hash]struct{}) (*wire.MsgMerkleBlock, []uint32) {
+	return newMerkleBlock(block, func(tx *btcutil.Tx) bool {
+		_, ok := txIDs[*tx.Hash()]
+		return ok
+	})
+}
+
+// newMerkleBlock returns a new *wire.MsgMerkleBlock and an array of the
+// matched transaction index numbers based on the passed block and match
+// function.
+func newMerkleBlock(block *btcutil.Block, match func(*btcutil.Tx) bool) (*wire.MsgMerkleBlock, []uint32) {
 	numTx := uint32(len(block.Transactions()))
 	mBlock := merkleBlock{
 		numTx:       numTx,
@@ -88,10 +114,10 @@ func NewMerkleBlock(block *btcutil.Block, filter *Filter) (*wire.MsgMerkleBlock,
 		matchedBits: make([]byte, 0, numTx),
 	}
 
-	// Find and keep track of any transactions that match the filter.
+	// Find and keep track of any transactions that match.
 	var matchedIndices []uint32
 	for txIndex, tx := range block.Transactions() {
-		if filter.MatchTxAndUpdate(tx) {
+		if match(tx) {
 			mBlock.matchedBits = append(mBlock.matchedBits, 0x01)
 			matchedIndices = append(matchedIndices, uint32(txIndex))
 		} else {
@@ -124,3 +150,114 @@ func NewMerkleBlock(block *btcutil.Block, filter *Filter) (*wire.MsgMerkleBlock,
 	}
 	return &msgMerkleBlock, matchedIndices
 }
+
+// partialMerkleTree is used to house intermediate information needed to
+// extract the matched transactions of a wire.MsgMerkleBlock.
+type partialMerkleTree struct {
+	numTx      uint32
+	hashes     []*chainhash.Hash
+	flags      []byte
+	bitsUsed   uint32
+	hashesUsed uint32
+	matches    []*chainhash.Hash
+}
+
+// calcTreeWidth calculates and returns the number of nodes (width) or a
+// merkle tree at the given depth-first height.
+func (t *partialMerkleTree) calcTreeWidth(height uint32) uint32 {
+	return (t.numTx + (1 << height) - 1) >> height
+}
+
+// traverseAndExtract walks the partial merkle tree in the depth-first order
+// it was built in, returning the hash of the sub-tree at the given height and
+// position and recording the matched leaves along the way.
+func (t *partialMerkleTree) traverseAndExtract(height, pos uint32) (*chainhash.Hash, error) {
+	if t.bitsUsed >= uint32(len(t.flags))*8 {
+		return nil, errors.New("merkle block flags exhausted")
+	}
+	isParent := (t.flags[t.bitsUsed/8]>>(t.bitsUsed%8))&0x01 == 0x01
+	t.bitsUsed++
+
+	// Leaves and nodes which are not the parent of a matched leaf have their
+	// hash included in the merkle block.
+	if height == 0 || !isParent {
+		if t.hashesUsed >= uint32(len(t.hashes)) {
+			return nil, errors.New("merkle block hashes exhausted")
+		}
+		hash := t.hashes[t.hashesUsed]
+		t.hashesUsed++
+		if height == 0 && isParent {
+			t.matches = append(t.matches, hash)
+		}
+		return hash, nil
+	}
+
+	left, err := t.traverseAndExtract(height-1, pos*2)
+	if err != nil {
+		return nil, err
+	}
+	right := left
+	if pos*2+1 < t.calcTreeWidth(height-1) {
+		right, err = t.traverseAndExtract(height-1, pos*2+1)
+		if err != nil {
+			return nil, err
+		}
+
+		// Identical siblings would let a tree with duplicated
+		// transactions have the same root as the original tree
+		// (CVE-2012-2459).
+		if left.IsEqual(right) {
+			return nil, errors.New("merkle block has identical siblings")
+		}
+	}
+	hash := blockchain.HashMerkleBranches(left, right)
+	return &hash, nil
+}
+
+// ExtractMerkleBlockMatches validates the partial merkle tree of the passed
+// merkle block and returns its merkle root along with the hashes of the
+// transactions it matches.  The root must be compared against the merkle root
+// of a known block header for the matches to be proven.
+func ExtractMerkleBlockMatches(msg *wire.MsgMerkleBlock) (*chainhash.Hash, []*chainhash.Hash, error) {
+	if msg.Transactions == 0 {
+		return nil, nil, errors.New("merkle block has no transactions")
+	}
+	if msg.Transactions > wire.MaxBlockPayload/minTxPayload {
+		return nil, nil, fmt.Errorf("merkle block has too many "+
+			"transactions: %d", msg.Transactions)
+	}
+	if uint32(len(msg.Hashes)) > msg.Transactions {
+		return nil, nil, errors.New("merkle block has more hashes than " +
+			"transactions")
+	}
+	if len(msg.Flags)*8 < len(msg.Hashes) {
+		return nil, nil, errors.New("merkle block has fewer flags than " +
+			"hashes")
+	}
+
+	tree := partialMerkleTree{
+		numTx:  msg.Transactions,
+		hashes: msg.Hashes,
+		flags:  msg.Flags,
+	}
+
+	// Calculate the number of merkle branches (height) in the tree.
+	height := uint32(0)
+	for tree.calcTreeWidth(height) > 1 {
+		height++
+	}
+
+	root, err := tree.traverseAndExtract(height, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Every hash and every byte of flags must have been used.
+	if (tree.bitsUsed+7)/8 != uint32(len(msg.Flags)) {
+		return nil, nil, errors.New("merkle block has unused flags")
+	}
+	if tree.hashesUsed != uint32(len(msg.Hashes)) {
+		return nil, nil, errors.New("merkle block has unused hashes")
+	}
+	return root, tree.matches, nil
+}
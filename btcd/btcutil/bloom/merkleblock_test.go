@@ -9,6 +9,7 @@ import (
 	"encoding/hex"
 	"testing"
 
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
 	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
 	"github.com/MetalBlockchain/btcvm/btcd/btcutil/bloom"
 	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
@@ -72,3 +73,152 @@ func TestMerkleBlock3(t *testing.T) {
 		return
 	}
 }
+
+// testMerkleBlock returns a block with the passed transactions and a valid
+// merkle root.
+func testMerkleBlock(txns []*wire.MsgTx) *btcutil.Block {
+	msgBlock := wire.NewMsgBlock(&wire.BlockHeader{})
+	for _, tx := range txns {
+		_ = msgBlock.AddTransaction(tx)
+	}
+	block := btcutil.NewBlock(msgBlock)
+	msgBlock.Header.MerkleRoot = blockchain.CalcMerkleRoot(
+		block.Transactions(), false,
+	)
+	return btcutil.NewBlock(msgBlock)
+}
+
+func TestMerkleBlockWithTxIDs(t *testing.T) {
+	// An odd number of transactions makes the last node of every level
+	// hashed with itself.  The first transaction has a witness, so its
+	// wtxid differs from its txid.
+	txns := make([]*wire.MsgTx, 7)
+	for i := range txns {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: uint32(i)}, nil, nil))
+		tx.AddTxOut(wire.NewTxOut(int64(i), nil))
+		txns[i] = tx
+	}
+	txns[0].TxIn[0].Witness = wire.TxWitness{{0x01}}
+	block := testMerkleBlock(txns)
+	txs := block.Transactions()
+
+	tests := []struct {
+		name    string
+		matched []int
+	}{
+		{"first", []int{0}},
+		{"last", []int{6}},
+		{"middle", []int{3}},
+		{"several", []int{1, 2, 6}},
+		{"all", []int{0, 1, 2, 3, 4, 5, 6}},
+	}
+	for _, test := range tests {
+		txIDs := make(map[chainhash.Hash]struct{})
+		for _, i := range test.matched {
+			txIDs[*txs[i].Hash()] = struct{}{}
+		}
+		mBlock, indices := bloom.NewMerkleBlockWithTxIDs(block, txIDs)
+		if len(indices) != len(test.matched) {
+			t.Errorf("%s: got %d matches, want %d", test.name,
+				len(indices), len(test.matched))
+			continue
+		}
+
+		// The proof survives serialization.
+		var buf bytes.Buffer
+		err := mBlock.BtcEncode(&buf, wire.ProtocolVersion, wire.BaseEncoding)
+		if err != nil {
+			t.Errorf("%s: BtcEncode failed: %v", test.name, err)
+			continue
+		}
+		var decoded wire.MsgMerkleBlock
+		err = decoded.BtcDecode(&buf, wire.ProtocolVersion, wire.BaseEncoding)
+		if err != nil {
+			t.Errorf("%s: BtcDecode failed: %v", test.name, err)
+			continue
+		}
+
+		root, matches, err := bloom.ExtractMerkleBlockMatches(&decoded)
+		if err != nil {
+			t.Errorf("%s: ExtractMerkleBlockMatches failed: %v",
+				test.name, err)
+			continue
+		}
+		if !root.IsEqual(&block.MsgBlock().Header.MerkleRoot) {
+			t.Errorf("%s: got root %v, want %v", test.name, root,
+				block.MsgBlock().Header.MerkleRoot)
+		}
+		if len(matches) != len(test.matched) {
+			t.Errorf("%s: got %d extracted matches, want %d",
+				test.name, len(matches), len(test.matched))
+			continue
+		}
+		for i, match := range matches {
+			if !match.IsEqual(txs[test.matched[i]].Hash()) {
+				t.Errorf("%s: got match %v, want %v", test.name,
+					match, txs[test.matched[i]].Hash())
+			}
+		}
+	}
+
+	// Transactions are not matched by their wtxid.
+	txIDs := map[chainhash.Hash]struct{}{*txs[0].WitnessHash(): {}}
+	if _, indices := bloom.NewMerkleBlockWithTxIDs(block, txIDs); len(indices) != 0 {
+		t.Errorf("wtxid matched transactions %v", indices)
+	}
+}
+
+func TestExtractMerkleBlockMatchesInvalid(t *testing.T) {
+	txns := make([]*wire.MsgTx, 3)
+	for i := range txns {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: uint32(i)}, nil, nil))
+		txns[i] = tx
+	}
+	block := testMerkleBlock(txns)
+	last := map[chainhash.Hash]struct{}{*block.Transactions()[2].Hash(): {}}
+
+	// Duplicating the last transaction keeps the merkle root of the block
+	// (CVE-2012-2459), but the proof must be rejected.
+	duplicated := testMerkleBlock(append(txns, txns[2]))
+	if duplicated.MsgBlock().Header.MerkleRoot != block.MsgBlock().Header.MerkleRoot {
+		t.Fatalf("duplicating the last transaction changed the root")
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*wire.MsgMerkleBlock)
+	}{
+		{"no transactions", func(m *wire.MsgMerkleBlock) {
+			m.Transactions = 0
+		}},
+		{"too many transactions", func(m *wire.MsgMerkleBlock) {
+			m.Transactions = wire.MaxBlockPayload
+		}},
+		{"missing hash", func(m *wire.MsgMerkleBlock) {
+			m.Hashes = m.Hashes[:len(m.Hashes)-1]
+		}},
+		{"extra hash", func(m *wire.MsgMerkleBlock) {
+			m.Hashes = append(m.Hashes, m.Hashes[0])
+		}},
+		{"extra flags", func(m *wire.MsgMerkleBlock) {
+			m.Flags = append(m.Flags, 0x00)
+		}},
+		{"missing flags", func(m *wire.MsgMerkleBlock) {
+			m.Flags = nil
+		}},
+	}
+	for _, test := range tests {
+		mBlock, _ := bloom.NewMerkleBlockWithTxIDs(block, last)
+		test.modify(mBlock)
+		if _, _, err := bloom.ExtractMerkleBlockMatches(mBlock); err == nil {
+			t.Errorf("%s: invalid merkle block was accepted", test.name)
+		}
+	}
+
+	mBlock, _ := bloom.NewMerkleBlockWithTxIDs(duplicated, last)
+	if _, _, err := bloom.ExtractMerkleBlockMatches(mBlock); err == nil {
+		t.Errorf("merkle block with duplicated transactions was accepted")
+	}
+}
@@ -209,6 +209,21 @@ type Params struct {
 	// regtest like networks.
 	PoWNoRetargeting bool
 
+	// PoWDisabled defines whether blocks are produced without proof of
+	// work, such as by a consensus engine.  The bits of every block must be
+	// PowLimitBits, so the difficulty is never retargeted.
+	PoWDisabled bool
+
+	// MaxFutureBlockTime is the maximum duration a block time is allowed
+	// to be ahead of the current time.  It defaults to 2 hours when zero.
+	MaxFutureBlockTime time.Duration
+
+	// MonotonicTimestamps defines whether a block time must not be before
+	// the time of its parent rather than after the median time of the last
+	// several blocks.  This suits networks producing blocks every few
+	// seconds, where the median time lags behind the current time.
+	MonotonicTimestamps bool
+
 	// EnforceBIP94 enforces timewarp attack mitigation and on testnet4
 	// this also enforces the block storm mitigation.
 	EnforceBIP94 bool
@@ -281,7 +296,8 @@ type Params struct {
 	RelayNonStdTxs bool
 
 	// Human-readable part for Bech32 encoded segwit addresses, as defined
-	// in BIP 173.
+	// in BIP 173.  Bech32m encoded taproot addresses use the same
+	// human-readable part, as defined in BIP 350.
 	Bech32HRPSegwit string
 
 	// Address encoding magics
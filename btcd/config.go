@@ -49,6 +49,9 @@ const (
 	defaultMaxRPCClients         = 10
 	defaultMaxRPCWebsockets      = 25
 	defaultMaxRPCConcurrentReqs  = 20
+	defaultRPCMaxBatchSize       = 100
+	defaultRPCBatchParallelism   = 4
+	defaultRPCMaxWsSubs          = 1000
 	defaultDbType                = "ffldb"
 	defaultFreeTxRelayLimit      = 15.0
 	defaultTrickleInterval       = peer.DefaultTrickleInterval
@@ -68,6 +71,7 @@ const (
 	sampleConfigFilename         = "sample-btcd.conf"
 	defaultTxIndex               = false
 	defaultAddrIndex             = false
+	defaultSpentIndex            = false
 	pruneMinSize                 = 1536
 )
 
@@ -125,20 +129,32 @@ type Config struct {
 	DropAddrIndex        bool          `json:"dropAddrIndex"        long:"dropaddrindex"        description:"Deletes the address-based transaction index from the database on start up and then exits."`
 	DropCfIndex          bool          `json:"dropCfIndex"          long:"dropcfindex"          description:"Deletes the index used for committed filtering (CF) support from the database on start up and then exits."`
 	DropTxIndex          bool          `json:"dropTxIndex"          long:"droptxindex"          description:"Deletes the hash-based transaction index from the database on start up and then exits."`
+	ReindexSpentIndex    bool          `json:"reindexSpentIndex"    long:"reindexspentindex"    description:"Deletes the spent output index from the database on start up and rebuilds it from the genesis block."`
 	ExternalIPs          []string      `json:"externalIPs"          long:"externalip"           description:"Add an ip to the list of local addresses we claim to listen on to peers"`
 	Generate             bool          `json:"generate"             long:"generate"             description:"Generate (mine) bitcoins using the CPU"`
 	FreeTxRelayLimit     float64       `json:"freeTxRelayLimit"     long:"limitfreerelay"       description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
 	Listeners            []string      `json:"listeners"            long:"listen"               description:"Add an interface/port to listen for connections (default all interfaces port: 8333, testnet: 18333)"`
 	LogDir               string        `json:"logDir"               long:"logdir"               description:"Directory to log output."`
 	MaxOrphanTxs         int           `json:"maxOrphanTxs"         long:"maxorphantx"          description:"Max number of orphan transactions to keep in memory"`
+	MaxOrphanTxSize      int           `json:"maxOrphanTxSize"      long:"maxorphantxsize"      description:"Max size in bytes of orphan transactions to keep in memory"`
+	MaxAncestorCount     int           `json:"maxAncestorCount"     long:"maxancestorcount"     description:"Max number of unconfirmed ancestors of a transaction, including itself, to accept it into the mempool -- 0 disables the limit"`
+	MaxAncestorSize      int64         `json:"maxAncestorSize"      long:"maxancestorsize"      description:"Max virtual size of the unconfirmed ancestors of a transaction, including itself, to accept it into the mempool -- 0 disables the limit"`
+	MaxDataCarrierSize   uint32        `json:"maxDataCarrierSize"   long:"datacarriersize"      description:"Max number of bytes of data carried by the OP_RETURN outputs of a transaction accepted into the mempool"`
+	MaxMempoolBytes      int64         `json:"maxMempoolBytes"      long:"maxmempool"           description:"Max total serialized size in bytes of the transactions in the mempool -- The transactions paying the lowest fee rates are evicted once exceeded, raising the min fee rate of accepted transactions -- 0 disables the limit"`
 	MaxPeers             int           `json:"maxPeers"             long:"maxpeers"             description:"Max number of inbound and outbound peers"`
+	MaxScriptWorkers     int           `json:"maxScriptWorkers"     long:"maxscriptworkers"     description:"Max number of goroutines used to validate the scripts of a block (default: three per CPU core)"`
 	MiningAddrs          []string      `json:"miningAddrs"          long:"miningaddr"           description:"Add the specified payment address to the list of addresses to use for generated blocks -- At least one address is required if the generate option is set"`
 	MinRelayTxFee        float64       `json:"minRelayTxFee"        long:"minrelaytxfee"        description:"The minimum transaction fee in BTC/kB to be considered a non-zero fee."`
+	IncrementalRelayFee  float64       `json:"incrementalRelayFee"  long:"incrementalrelayfee"  description:"The fee in BTC/kB a replacement transaction must pay on top of the fees of the transactions it replaces."`
+	MempoolFullRBF       bool          `json:"mempoolFullRBF"       long:"mempoolfullrbf"       description:"Accept replacement transactions regardless of whether the transactions they replace signal replaceability."`
+	MinGossipFeeRate     float64       `json:"minGossipFeeRate"     long:"mingossipfeerate"     description:"The minimum fee rate in sat/vB of transactions accepted from gossip"`
+	MinRelayFeeRate      float64       `json:"minRelayFeeRate"      long:"minrelayfeerate"      description:"The minimum fee rate in sat/vB of transactions gossiped to peers"`
 	DisableBanning       bool          `json:"disableBanning"       long:"nobanning"            description:"Disable banning of misbehaving peers"`
 	NoCFilters           bool          `json:"noCFilters"           long:"nocfilters"           description:"Disable committed filtering (CF) support"`
 	DisableCheckpoints   bool          `json:"disableCheckpoints"   long:"nocheckpoints"        description:"Disable built-in checkpoints.  Don't do this unless you know what you're doing."`
 	DisableDNSSeed       bool          `json:"disableDNSSeed"       long:"nodnsseed"            description:"Disable DNS seeding for peers"`
 	DisableListen        bool          `json:"disableListen"        long:"nolisten"             description:"Disable listening for incoming connections -- NOTE: Listening is automatically disabled if the --connect or --proxy options are used without also specifying listen interfaces via --listen"`
+	NoDataCarrier        bool          `json:"noDataCarrier"        long:"nodatacarrier"        description:"Reject transactions with OP_RETURN outputs from the mempool"`
 	NoOnion              bool          `json:"noOnion"              long:"noonion"              description:"Disable connecting to tor hidden services"`
 	NoPeerBloomFilters   bool          `json:"noPeerBloomFilters"   long:"nopeerbloomfilters"   description:"Disable bloom filtering support"`
 	NoRelayPriority      bool          `json:"noRelayPriority"      long:"norelaypriority"      description:"Do not require free or low-fee transactions to have high priority for relaying"`
@@ -165,15 +181,19 @@ type Config struct {
 	RPCListeners         []string      `json:"rpcListeners"         long:"rpclisten"            description:"Add an interface/port to listen for RPC connections (default port: 8334, testnet: 18334)"`
 	RPCMaxClients        int           `json:"rpcMaxClients"        long:"rpcmaxclients"        description:"Max number of RPC clients for standard connections"`
 	RPCMaxConcurrentReqs int           `json:"rpcMaxConcurrentReqs" long:"rpcmaxconcurrentreqs" description:"Max number of concurrent RPC requests that may be processed concurrently"`
+	RPCMaxBatchSize      int           `json:"rpcMaxBatchSize"      long:"rpcmaxbatchsize"      description:"Max number of requests in a batched JSON-RPC request"`
+	RPCBatchParallelism  int           `json:"rpcBatchParallelism"  long:"rpcbatchparallelism"  description:"Max number of requests of a batched JSON-RPC request that are processed concurrently"`
 	RPCMaxWebsockets     int           `json:"rpcMaxWebsockets"     long:"rpcmaxwebsockets"     description:"Max number of RPC websocket connections"`
+	RPCMaxWsSubs         int           `json:"rpcMaxWsSubs"         long:"rpcmaxwssubs"         description:"Max number of addresses and outpoints a websocket client may request notifications for"`
 	RPCQuirks            bool          `json:"rpcQuirks"            long:"rpcquirks"            description:"Mirror some JSON-RPC quirks of Bitcoin Core -- NOTE: Discouraged unless interoperability issues need to be worked around"`
 	RPCPass              string        `json:"rpcPass"              long:"rpcpass"              description:"Password for RPC connections"                                                                                                                                                                                                                                                      short:"P" default-mask:"-"`
 	RPCUser              string        `json:"rpcUser"              long:"rpcuser"              description:"Username for RPC connections"                                                                                                                                                                                                                                                      short:"u"`
-	SigCacheMaxSize      uint          `json:"sigCacheMaxSize"      long:"sigcachemaxsize"      description:"The maximum number of entries in the signature verification cache"`
+	SigCacheMaxSize      uint          `json:"sigCacheMaxSize"      long:"sigcachemaxsize"      description:"The maximum number of entries in the signature verification and script validation caches"`
 	SimNet               bool          `json:"simNet"               long:"simnet"               description:"Use the simulation test network"`
 	SigNet               bool          `json:"sigNet"               long:"signet"               description:"Use the signet test network"`
 	SigNetChallenge      string        `json:"sigNetChallenge"      long:"signetchallenge"      description:"Connect to a custom signet network defined by this challenge instead of using the global default signet network -- Can be specified multiple times"`
 	SigNetSeedNode       []string      `json:"sigNetSeedNode"       long:"signetseednode"       description:"Specify a seed node for the signet network instead of using the global default signet network seed nodes"`
+	SpentIndex           bool          `json:"spentIndex"           long:"spentindex"           description:"Maintain an index of the transactions spending each output which makes the getspentinfo RPC available"`
 	TestNet              bool          `json:"testNet"              long:"testnet"              description:"Use the test network"`
 	TorIsolation         bool          `json:"torIsolation"         long:"torisolation"         description:"Enable Tor stream isolation by randomizing user credentials for each connection."`
 	TrickleInterval      time.Duration `json:"trickleInterval"      long:"trickleinterval"      description:"Minimum time between attempts to send new inventory to a connected peer"`
@@ -188,7 +208,9 @@ type Config struct {
 	dial                 func(string, string, time.Duration) (net.Conn, error)
 	addCheckpoints       []chaincfg.Checkpoint
 	miningAddrs          []btcutil.Address
+	coinbaseTag          []byte
 	minRelayTxFee        btcutil.Amount
+	incrementalRelayFee  btcutil.Amount
 	whitelists           []*net.IPNet
 }
 
@@ -198,6 +220,13 @@ type serviceOptions struct {
 	ServiceCommand string `short:"s" long:"service" description:"Service command {install, remove, start, stop}"`
 }
 
+// NetDataDir returns the data directory namespaced by the active network
+// under the passed directory, the way the data directory of a loaded config
+// is.
+func NetDataDir(dataDir string) string {
+	return filepath.Join(cleanAndExpandPath(dataDir), netName(activeNetParams))
+}
+
 // cleanAndExpandPath expands environment variables and leading ~ in the
 // passed path, cleans the result, and returns it.
 func cleanAndExpandPath(path string) string {
@@ -383,6 +412,13 @@ func parseCheckpoints(checkpointStrings []string) ([]chaincfg.Checkpoint, error)
 	return checkpoints, nil
 }
 
+// AppendCheckpoints adds checkpoints to the ones parsed from the
+// AddCheckpoints option.  As with those, a checkpoint replaces any earlier
+// checkpoint at the same height.
+func (c *Config) AppendCheckpoints(checkpoints ...chaincfg.Checkpoint) {
+	c.addCheckpoints = append(c.addCheckpoints, checkpoints...)
+}
+
 // fileExists reports whether the named file or directory exists.
 func fileExists(name string) bool {
 	if _, err := os.Stat(name); err != nil {
@@ -402,6 +438,23 @@ func newConfigParser(cfg *Config, so *serviceOptions, options flags.Options) *fl
 	return parser
 }
 
+// SetMiningAddrs sets the addresses to use for generated blocks, replacing
+// those given by MiningAddrs. The caller is responsible for checking they are
+// for the active network.
+func (c *Config) SetMiningAddrs(addrs []btcutil.Address) {
+	c.MiningAddrs = make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		c.MiningAddrs = append(c.MiningAddrs, addr.String())
+	}
+	c.miningAddrs = addrs
+}
+
+// SetCoinbaseTag sets the data pushed by an OP_RETURN output of the coinbase
+// of generated blocks. No output is added if tag is empty.
+func (c *Config) SetCoinbaseTag(tag []byte) {
+	c.coinbaseTag = tag
+}
+
 // mergeConfigs merges non-zero values from override into base config using reflection
 func mergeConfigs(base *Config, override *Config) {
 	if override == nil {
@@ -450,7 +503,11 @@ func mergeConfigs(base *Config, override *Config) {
 // The above results in btcd functioning properly without any config settings
 // while still allowing the user to override settings with config files and
 // command line options.  Command line options always take precedence.
-func LoadConfig(nodeId string, overrideCfg *Config) (*Config, []string, error) {
+//
+// The command line options are read from args rather than from os.Args so
+// that an embedding process, whose own command line is not meant for btcd,
+// can pass none.
+func LoadConfig(nodeId string, overrideCfg *Config, args []string) (*Config, []string, error) {
 	// TODO 2025-12-03: should parse the configBytes as json and merge it with the default at end
 	defaultHomeDir = btcutil.AppDataDir("btcdvm/"+nodeId, false)
 	defaultConfigFile = filepath.Join(defaultHomeDir, defaultConfigFilename)
@@ -469,12 +526,16 @@ func LoadConfig(nodeId string, overrideCfg *Config) (*Config, []string, error) {
 		RPCMaxClients:        defaultMaxRPCClients,
 		RPCMaxWebsockets:     defaultMaxRPCWebsockets,
 		RPCMaxConcurrentReqs: defaultMaxRPCConcurrentReqs,
+		RPCMaxBatchSize:      defaultRPCMaxBatchSize,
+		RPCBatchParallelism:  defaultRPCBatchParallelism,
+		RPCMaxWsSubs:         defaultRPCMaxWsSubs,
 		DataDir:              defaultDataDir,
 		LogDir:               defaultLogDir,
 		DbType:               defaultDbType,
 		RPCKey:               defaultRPCKeyFile,
 		RPCCert:              defaultRPCCertFile,
 		MinRelayTxFee:        mempool.DefaultMinRelayTxFee.ToBTC(),
+		IncrementalRelayFee:  mempool.DefaultIncrementalRelayFee.ToBTC(),
 		FreeTxRelayLimit:     defaultFreeTxRelayLimit,
 		TrickleInterval:      defaultTrickleInterval,
 		BlockMinSize:         defaultBlockMinSize,
@@ -483,11 +544,17 @@ func LoadConfig(nodeId string, overrideCfg *Config) (*Config, []string, error) {
 		BlockMaxWeight:       defaultBlockMaxWeight,
 		BlockPrioritySize:    mempool.DefaultBlockPrioritySize,
 		MaxOrphanTxs:         defaultMaxOrphanTransactions,
+		MaxOrphanTxSize:      defaultMaxOrphanTxSize,
+		MaxAncestorCount:     mempool.DefaultMaxAncestorCount,
+		MaxAncestorSize:      mempool.DefaultMaxAncestorSize,
+		MaxDataCarrierSize:   mempool.DefaultMaxDataCarrierSize,
+		MaxMempoolBytes:      mempool.DefaultMaxPoolSize,
 		SigCacheMaxSize:      defaultSigCacheMaxSize,
 		UtxoCacheMaxSizeMiB:  defaultUtxoCacheMaxSizeMiB,
 		Generate:             defaultGenerate,
 		TxIndex:              defaultTxIndex,
 		AddrIndex:            defaultAddrIndex,
+		SpentIndex:           defaultSpentIndex,
 	}
 
 	// Merge override config if provided
@@ -504,7 +571,7 @@ func LoadConfig(nodeId string, overrideCfg *Config) (*Config, []string, error) {
 	// the final parse below.
 	preCfg := cfg
 	preParser := newConfigParser(&preCfg, &serviceOpts, flags.HelpFlag)
-	_, err := preParser.Parse()
+	_, err := preParser.ParseArgs(args)
 	if err != nil {
 		if e, ok := err.(*flags.Error); ok && e.Type == flags.ErrHelp {
 			fmt.Fprintln(os.Stderr, err)
@@ -564,7 +631,7 @@ func LoadConfig(nodeId string, overrideCfg *Config) (*Config, []string, error) {
 	}
 
 	// Parse command line options again to ensure they take precedence.
-	remainingArgs, err := parser.Parse()
+	remainingArgs, err := parser.ParseArgs(args)
 	if err != nil {
 		if e, ok := err.(*flags.Error); !ok || e.Type != flags.ErrHelp {
 			fmt.Fprintln(os.Stderr, usageMessage)
@@ -612,6 +679,13 @@ func LoadConfig(nodeId string, overrideCfg *Config) (*Config, []string, error) {
 		return nil, nil, err
 	}
 
+	// The chain params default to the active network.  They may be replaced
+	// before the server is created, such as to override consensus rules
+	// given by the genesis of the VM.
+	if cfg.ChainParams == nil {
+		cfg.ChainParams = activeNetParams.Params
+	}
+
 	// If mainnet is active, then we won't allow the stall handler to be
 	// disabled.
 	if activeNetParams.Params.Net == wire.MainNet && cfg.DisableStallHandler {
@@ -819,6 +893,33 @@ func LoadConfig(nodeId string, overrideCfg *Config) (*Config, []string, error) {
 		return nil, nil, err
 	}
 
+	if cfg.RPCMaxBatchSize < 1 {
+		str := "%s: The rpcmaxbatchsize option may not be less than 1 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.RPCMaxBatchSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.RPCBatchParallelism < 1 {
+		str := "%s: The rpcbatchparallelism option may not be less " +
+			"than 1 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.RPCBatchParallelism)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.RPCMaxWsSubs < 1 {
+		str := "%s: The rpcmaxwssubs option may not be less than 1 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.RPCMaxWsSubs)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Validate the minrelaytxfee.
 	cfg.minRelayTxFee, err = btcutil.NewAmount(cfg.MinRelayTxFee)
 	if err != nil {
@@ -829,6 +930,19 @@ func LoadConfig(nodeId string, overrideCfg *Config) (*Config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Validate the incrementalrelayfee.
+	cfg.incrementalRelayFee, err = btcutil.NewAmount(cfg.IncrementalRelayFee)
+	if err == nil && cfg.incrementalRelayFee < 0 {
+		err = fmt.Errorf("fee may not be negative")
+	}
+	if err != nil {
+		str := "%s: invalid incrementalrelayfee: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Limit the max block size to a sane value.
 	if cfg.BlockMaxSize < blockMaxSizeMin || cfg.BlockMaxSize >
 		blockMaxSizeMax {
@@ -864,6 +978,48 @@ func LoadConfig(nodeId string, overrideCfg *Config) (*Config, []string, error) {
 		fmt.Fprintln(os.Stderr, usageMessage)
 		return nil, nil, err
 	}
+	if cfg.MaxOrphanTxSize < 0 {
+		str := "%s: The maxorphantxsize option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxOrphanTxSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.MaxAncestorCount < 0 {
+		str := "%s: The maxancestorcount option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxAncestorCount)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.MaxAncestorSize < 0 {
+		str := "%s: The maxancestorsize option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxAncestorSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.MaxMempoolBytes < 0 {
+		str := "%s: The maxmempool option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxMempoolBytes)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Don't allow a negative number of script validation workers.
+	if cfg.MaxScriptWorkers < 0 {
+		str := "%s: The maxscriptworkers option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxScriptWorkers)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
 
 	// Limit the block priority and minimum block sizes to max block size.
 	cfg.BlockPrioritySize = minUint32(cfg.BlockPrioritySize, cfg.BlockMaxSize)
@@ -931,6 +1087,15 @@ func LoadConfig(nodeId string, overrideCfg *Config) (*Config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --reindexspentindex rebuilds the index enabled by --spentindex.
+	if !cfg.SpentIndex && cfg.ReindexSpentIndex {
+		err := fmt.Errorf("%s: the --reindexspentindex option requires "+
+			"the --spentindex option", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Check mining addresses are valid and saved parsed versions.
 	cfg.miningAddrs = make([]btcutil.Address, 0, len(cfg.MiningAddrs))
 	for _, strAddr := range cfg.MiningAddrs {
@@ -1167,6 +1332,14 @@ func LoadConfig(nodeId string, overrideCfg *Config) (*Config, []string, error) {
 		return nil, nil, err
 	}
 
+	if cfg.Prune != 0 && cfg.SpentIndex {
+		err := fmt.Errorf("%s: the --prune and --spentindex options may "+
+			"not be activated at the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Warn about missing config file only after all other configuration is
 	// done.  This prevents the warning on help messages and invalid
 	// options.  Note this should go directly before the return.
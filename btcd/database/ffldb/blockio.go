@@ -177,12 +177,14 @@ type blockStore struct {
 	// new blocks are written to.
 	writeCursor *writeCursor
 
-	// These functions are set to openFile, openWriteFile, and deleteFile by
-	// default, but are exposed here to allow the whitebox tests to replace
-	// them when working with mock files.
+	// These functions are set to openFile, openWriteFile, deleteFile, and
+	// scanFiles by default, but are exposed here to allow the whitebox tests
+	// and the in-memory database to replace them when working with files
+	// that are not on disk.
 	openFileFunc      func(fileNum uint32) (*lockableFile, error)
 	openWriteFileFunc func(fileNum uint32) (filer, error)
 	deleteFileFunc    func(fileNum uint32) error
+	scanFilesFunc     func() (int, int, uint32, error)
 }
 
 // blockLocation identifies a particular block file and location.
@@ -790,6 +792,12 @@ func scanBlockFiles(dbPath string) (int, int, uint32, error) {
 	return firstFile, lastFile, lastFileLen, err
 }
 
+// scanFiles searches the database directory of the block store for all flat
+// block files.  See scanBlockFiles.
+func (s *blockStore) scanFiles() (int, int, uint32, error) {
+	return scanBlockFiles(s.basePath)
+}
+
 // newBlockStore returns a new block store with the current block file number
 // and offset set and all fields initialized.
 func newBlockStore(basePath string, network wire.BitcoinNet) (*blockStore, error) {
@@ -800,12 +808,25 @@ func newBlockStore(basePath string, network wire.BitcoinNet) (*blockStore, error
 	if err != nil {
 		return nil, err
 	}
+
+	store := makeBlockStore(basePath, network, fileNum, fileOff)
+	store.openFileFunc = store.openFile
+	store.openWriteFileFunc = store.openWriteFile
+	store.deleteFileFunc = store.deleteFile
+	store.scanFilesFunc = store.scanFiles
+	return store, nil
+}
+
+// makeBlockStore returns a new block store whose write cursor is at the
+// passed offset of the passed last block file, or at the start of the first
+// block file when there is none (-1).  The file functions are left unset.
+func makeBlockStore(basePath string, network wire.BitcoinNet, fileNum int, fileOff uint32) *blockStore {
 	if fileNum == -1 {
 		fileNum = 0
 		fileOff = 0
 	}
 
-	store := &blockStore{
+	return &blockStore{
 		network:          network,
 		basePath:         basePath,
 		maxBlockFileSize: maxBlockFileSize,
@@ -819,8 +840,4 @@ func newBlockStore(basePath string, network wire.BitcoinNet) (*blockStore, error
 			curOffset:  fileOff,
 		},
 	}
-	store.openFileFunc = store.openFile
-	store.openWriteFileFunc = store.openWriteFile
-	store.deleteFileFunc = store.deleteFile
-	return store, nil
 }
@@ -7,12 +7,14 @@ package ffldb
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
 	"sort"
 	"sync"
+	"syscall"
 
 	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
 	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
@@ -147,6 +149,9 @@ func convertErr(desc string, ldbErr error) database.Error {
 	// Database open/create errors.
 	case ldbErr == leveldb.ErrClosed:
 		code = database.ErrDbNotOpen
+	case errors.Is(ldbErr, syscall.EWOULDBLOCK):
+		// The lock of the database is held by another process.
+		code = database.ErrDbAlreadyOpen
 
 	// Transaction errors.
 	case ldbErr == leveldb.ErrSnapshotReleased:
@@ -1716,7 +1721,7 @@ func (tx *transaction) PruneBlocks(targetSize uint64) ([]chainhash.Hash, error)
 			targetSize, maxSize)
 	}
 
-	first, last, lastFileSize, err := scanBlockFiles(tx.db.store.basePath)
+	first, last, lastFileSize, err := tx.db.store.scanFilesFunc()
 	if err != nil {
 		return nil, err
 	}
@@ -1791,7 +1796,7 @@ func (tx *transaction) PruneBlocks(targetSize uint64) ([]chainhash.Hash, error)
 //
 // This function is part of the database.Tx interface implementation.
 func (tx *transaction) BeenPruned() (bool, error) {
-	first, last, _, err := scanBlockFiles(tx.db.store.basePath)
+	first, last, _, err := tx.db.store.scanFilesFunc()
 	if err != nil {
 		return false, err
 	}
@@ -1865,16 +1870,24 @@ type db struct {
 	closed    bool         // Is the database closed?
 	store     *blockStore  // Handles read/writing blocks to flat files.
 	cache     *dbCache     // Cache layer which wraps underlying leveldb DB.
+	inMemory  bool         // Is the database stored in memory?
+	readOnly  bool         // Is the database opened read-only?
 }
 
-// Enforce db implements the database.DB interface.
-var _ database.DB = (*db)(nil)
+// Enforce db implements the database.DB and database.Compacter interfaces.
+var (
+	_ database.DB        = (*db)(nil)
+	_ database.Compacter = (*db)(nil)
+)
 
 // Type returns the database driver type the current database instance was
 // created with.
 //
 // This function is part of the database.DB interface implementation.
 func (db *db) Type() string {
+	if db.inMemory {
+		return memDbType
+	}
 	return dbType
 }
 
@@ -1885,6 +1898,12 @@ func (db *db) Type() string {
 // which is used by the managed transaction code while the database method
 // returns the interface.
 func (db *db) begin(writable bool) (*transaction, error) {
+	// Writable transactions can't be started on a read-only database.
+	if writable && db.readOnly {
+		str := "write transaction on a database opened read-only"
+		return nil, makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
 	// Whenever a new writable transaction is started, grab the write lock
 	// to ensure only a single write transaction can be active at the same
 	// time.  This lock will not be released until the transaction is
@@ -2031,6 +2050,40 @@ func (db *db) Update(fn func(database.Tx) error) error {
 	return tx.Commit()
 }
 
+// Compact flushes the database cache and compacts the whole underlying
+// leveldb database, which discards the tombstones of the deleted keys and the
+// overwritten values.  Write transactions wait for the cache flush, but not
+// for the compaction itself.
+//
+// This function is part of the database.Compacter interface implementation.
+func (db *db) Compact() error {
+	// Prevent the database from being closed while it is compacted.
+	db.closeLock.RLock()
+	defer db.closeLock.RUnlock()
+
+	if db.closed {
+		return makeDbErr(database.ErrDbNotOpen, errDbNotOpenStr, nil)
+	}
+	if db.readOnly {
+		str := "compaction of a database opened read-only"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// The cache is only flushed by write transactions otherwise, so hold
+	// the write lock to flush it.
+	db.writeLock.Lock()
+	err := db.cache.flush()
+	db.writeLock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := db.cache.ldb.CompactRange(util.Range{}); err != nil {
+		return convertErr("failed to compact database", err)
+	}
+	return nil
+}
+
 // Close cleanly shuts down the database and syncs all data.  It will block
 // until all database transactions have been finalized (rolled back or
 // committed).
@@ -2115,7 +2168,10 @@ func initDB(ldb *leveldb.DB) error {
 
 // openDB opens the database at the provided path.  database.ErrDbDoesNotExist
 // is returned if the database doesn't exist and the create flag is not set.
-func openDB(dbPath string, network wire.BitcoinNet, create bool) (database.DB, error) {
+// When the readOnly flag is set, the database is opened without modifying it
+// and only read-only transactions can be started.  database.ErrDbAlreadyOpen
+// is returned if another process has the database open.
+func openDB(dbPath string, network wire.BitcoinNet, create, readOnly bool) (database.DB, error) {
 	// Error if the database doesn't exist and the create flag is not set.
 	metadataDbPath := filepath.Join(dbPath, metadataDbName)
 	dbExists := fileExists(metadataDbPath)
@@ -2135,13 +2191,16 @@ func openDB(dbPath string, network wire.BitcoinNet, create bool) (database.DB, e
 	// Open the metadata database (will create it if needed).
 	opts := opt.Options{
 		ErrorIfExist: create,
+		ReadOnly:     readOnly,
 		Strict:       opt.DefaultStrict,
 		Compression:  opt.NoCompression,
 		Filter:       filter.NewBloomFilter(10),
 	}
 	ldb, err := leveldb.OpenFile(metadataDbPath, &opts)
 	if err != nil {
-		return nil, convertErr(err.Error(), err)
+		str := fmt.Sprintf("failed to open database %q: %v",
+			metadataDbPath, err)
+		return nil, convertErr(str, err)
 	}
 
 	// Create the block store which includes scanning the existing flat
@@ -2154,7 +2213,7 @@ func openDB(dbPath string, network wire.BitcoinNet, create bool) (database.DB, e
 		return nil, convertErr(err.Error(), err)
 	}
 	cache := newDbCache(ldb, store, defaultCacheSize, defaultFlushSecs)
-	pdb := &db{store: store, cache: cache}
+	pdb := &db{store: store, cache: cache, readOnly: readOnly}
 
 	// Perform any reconciliation needed between the block and metadata as
 	// well as database initialization, if needed.
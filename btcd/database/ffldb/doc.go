@@ -25,5 +25,14 @@ database path as a string and the block network:
 	if err != nil {
 		// Handle error
 	}
+
+Open takes an optional read-only flag as a third parameter.  A database opened
+read-only is not modified and only read-only transactions can be started on it,
+while the process writing to it, if any, is refused access until it is closed:
+
+	db, err := database.Open("ffldb", "path/to/database", wire.MainNet, true)
+	if err != nil {
+		// Handle error
+	}
 */
 package ffldb
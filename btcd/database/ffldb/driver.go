@@ -42,14 +42,23 @@ func parseArgs(funcName string, args ...interface{}) (string, wire.BitcoinNet, e
 }
 
 // openDBDriver is the callback provided during driver registration that opens
-// an existing database for use.
+// an existing database for use.  An optional third argument opens the database
+// read-only when true.
 func openDBDriver(args ...interface{}) (database.DB, error) {
+	var readOnly bool
+	if len(args) == 3 {
+		if flag, ok := args[2].(bool); ok {
+			readOnly = flag
+			args = args[:2]
+		}
+	}
+
 	dbPath, network, err := parseArgs("Open", args...)
 	if err != nil {
 		return nil, err
 	}
 
-	return openDB(dbPath, network, false)
+	return openDB(dbPath, network, false, readOnly)
 }
 
 // createDBDriver is the callback provided during driver registration that
@@ -60,7 +69,7 @@ func createDBDriver(args ...interface{}) (database.DB, error) {
 		return nil, err
 	}
 
-	return openDB(dbPath, network, true)
+	return openDB(dbPath, network, true, false)
 }
 
 // useLogger is the callback provided during driver registration that sets the
@@ -81,4 +90,16 @@ func init() {
 		panic(fmt.Sprintf("Failed to register database driver '%s': %v",
 			dbType, err))
 	}
+
+	// Register the in-memory driver.
+	memDriver := database.Driver{
+		DbType:    memDbType,
+		Create:    createMemDBDriver,
+		Open:      openMemDBDriver,
+		UseLogger: useLogger,
+	}
+	if err := database.RegisterDriver(memDriver); err != nil {
+		panic(fmt.Sprintf("Failed to register database driver '%s': %v",
+			memDbType, err))
+	}
 }
@@ -470,3 +470,198 @@ func TestInterface(t *testing.T) {
 		testInterface(t, db)
 	})
 }
+
+// TestMemDBInterface performs all interfaces tests for the in-memory database
+// driver.
+func TestMemDBInterface(t *testing.T) {
+	t.Parallel()
+
+	// Ensure that attempting to open an in-memory database returns the
+	// expected error since it never exists before being created.
+	_, err := database.Open("memdb", blockDataNet)
+	if !checkDbError(t, "Open", err, database.ErrDbDoesNotExist) {
+		return
+	}
+
+	// Create a new database to run tests against.
+	db, err := database.Create("memdb", blockDataNet)
+	if err != nil {
+		t.Errorf("Failed to create test database (%s) %v", "memdb", err)
+		return
+	}
+	defer db.Close()
+
+	// Ensure the driver type is the expected value.
+	gotDbType := db.Type()
+	if gotDbType != "memdb" {
+		t.Errorf("Type: unexpected driver type - got %v, want %v",
+			gotDbType, "memdb")
+		return
+	}
+
+	// Run all of the interface tests against the database with a small
+	// maximum file size to force multiple flat files in memory.
+	ffldb.TstRunWithMaxBlockFileSize(db, 2048, func() {
+		testInterface(t, db)
+	})
+}
+
+// TestReadOnly ensures that a database opened read-only can be read but not
+// written, and that it can't be opened read-only while another process has it
+// open or the other way around.
+func TestReadOnly(t *testing.T) {
+	t.Parallel()
+
+	// Create a new database and store a block in it.
+	dbPath := filepath.Join(t.TempDir(), "ffldb-readonlytest")
+	db, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, err)
+		return
+	}
+	genesisBlock := btcutil.NewBlock(chaincfg.MainNetParams.GenesisBlock)
+	genesisHash := chaincfg.MainNetParams.GenesisHash
+	err = db.Update(func(tx database.Tx) error {
+		return tx.StoreBlock(genesisBlock)
+	})
+	if err != nil {
+		t.Errorf("Update: unexpected error: %v", err)
+		return
+	}
+
+	// Ensure the database can't be opened read-only while it is open.
+	_, err = database.Open(dbType, dbPath, blockDataNet, true)
+	if !checkDbError(t, "Open read-only", err, database.ErrDbAlreadyOpen) {
+		return
+	}
+
+	// Close and reopen the database read-only to ensure the block can be
+	// read.
+	db.Close()
+	db, err = database.Open(dbType, dbPath, blockDataNet, true)
+	if err != nil {
+		t.Errorf("Failed to open test database read-only (%s) %v",
+			dbType, err)
+		return
+	}
+	defer db.Close()
+	err = db.View(func(tx database.Tx) error {
+		_, err := tx.FetchBlock(genesisHash)
+		return err
+	})
+	if err != nil {
+		t.Errorf("View: unexpected error: %v", err)
+		return
+	}
+
+	// Ensure writable transactions are refused.
+	err = db.Update(func(tx database.Tx) error {
+		return nil
+	})
+	if !checkDbError(t, "Update", err, database.ErrTxNotWritable) {
+		return
+	}
+
+	// Ensure the database can't be compacted.
+	err = db.(database.Compacter).Compact()
+	if !checkDbError(t, "Compact", err, database.ErrTxNotWritable) {
+		return
+	}
+
+	// Ensure the database can't be opened for writing while it is open
+	// read-only.
+	_, err = database.Open(dbType, dbPath, blockDataNet)
+	if !checkDbError(t, "Open", err, database.ErrDbAlreadyOpen) {
+		return
+	}
+}
+
+// TestCompact ensures that compacting a database keeps its metadata and
+// blocks, including the metadata still in the database cache.
+func TestCompact(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "ffldb-compacttest")
+	db, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, err)
+		return
+	}
+	defer db.Close()
+
+	// Store a block along with keys of which half are deleted again, which
+	// leaves tombstones for the compaction to discard.
+	genesisBlock := btcutil.NewBlock(chaincfg.MainNetParams.GenesisBlock)
+	genesisHash := chaincfg.MainNetParams.GenesisHash
+	bucketKey := []byte("compacttest")
+	err = db.Update(func(tx database.Tx) error {
+		if err := tx.StoreBlock(genesisBlock); err != nil {
+			return err
+		}
+		bucket, err := tx.Metadata().CreateBucket(bucketKey)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 1000; i++ {
+			key := []byte(fmt.Sprintf("key%04d", i))
+			if err := bucket.Put(key, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Update: unexpected error: %v", err)
+		return
+	}
+	err = db.Update(func(tx database.Tx) error {
+		bucket := tx.Metadata().Bucket(bucketKey)
+		for i := 0; i < 1000; i += 2 {
+			key := []byte(fmt.Sprintf("key%04d", i))
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Update: unexpected error: %v", err)
+		return
+	}
+
+	if err := db.(database.Compacter).Compact(); err != nil {
+		t.Errorf("Compact: unexpected error: %v", err)
+		return
+	}
+
+	// Ensure the block and the remaining keys are unchanged.
+	err = db.View(func(tx database.Tx) error {
+		if _, err := tx.FetchBlock(genesisHash); err != nil {
+			return err
+		}
+		bucket := tx.Metadata().Bucket(bucketKey)
+		for i := 0; i < 1000; i++ {
+			key := []byte(fmt.Sprintf("key%04d", i))
+			value := bucket.Get(key)
+			if i%2 == 0 && value != nil {
+				return fmt.Errorf("deleted key %s has value %s", key,
+					value)
+			}
+			if i%2 != 0 && !bytes.Equal(value, key) {
+				return fmt.Errorf("key %s has value %s", key, value)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("View: unexpected error: %v", err)
+		return
+	}
+
+	// Ensure a closed database can't be compacted.
+	db.Close()
+	err = db.(database.Compacter).Compact()
+	if !checkDbError(t, "Compact", err, database.ErrDbNotOpen) {
+		return
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package ffldb
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/MetalBlockchain/btcvm/btcd/database"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/filter"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+const (
+	// memDbType is the type of the database which stores the metadata and
+	// the flat block files of a database in memory instead of on disk.  It
+	// is otherwise identical to ffldb, and is intended for tests and
+	// ephemeral networks.
+	memDbType = "memdb"
+)
+
+// memFile implements the filer interface for a flat block file in memory.
+// Closing it does not release its data so that it can be opened again.
+type memFile struct {
+	sync.RWMutex
+	data []byte
+}
+
+// Close does nothing for files in memory.
+//
+// This is part of the filer implementation.
+func (f *memFile) Close() error {
+	return nil
+}
+
+// ReadAt reads len(b) bytes from the file starting at byte offset off.  It
+// returns the number of bytes read and the error, if any.  ReadAt always
+// returns a non-nil error when n < len(b).  At end of file, that error is
+// io.EOF.
+//
+// This is part of the filer implementation.
+func (f *memFile) ReadAt(b []byte, off int64) (int, error) {
+	f.RLock()
+	defer f.RUnlock()
+
+	if off < 0 || off > int64(len(f.data)) {
+		return 0, fmt.Errorf("invalid offset %d", off)
+	}
+	n := copy(b, f.data[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt writes len(b) bytes to the file starting at byte offset off,
+// growing the file as needed.
+//
+// This is part of the filer implementation.
+func (f *memFile) WriteAt(b []byte, off int64) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if off < 0 {
+		return 0, fmt.Errorf("invalid offset %d", off)
+	}
+	if end := off + int64(len(b)); end > int64(len(f.data)) {
+		data := make([]byte, end)
+		copy(data, f.data)
+		f.data = data
+	}
+	return copy(f.data[off:], b), nil
+}
+
+// Truncate changes the size of the file.
+//
+// This is part of the filer implementation.
+func (f *memFile) Truncate(size int64) error {
+	f.Lock()
+	defer f.Unlock()
+
+	if size < 0 || size > int64(len(f.data)) {
+		return fmt.Errorf("invalid size %d", size)
+	}
+	f.data = f.data[:size]
+	return nil
+}
+
+// Sync does nothing for files in memory.
+//
+// This is part of the filer implementation.
+func (f *memFile) Sync() error {
+	return nil
+}
+
+// Ensure the memFile type implements the filer interface.
+var _ filer = (*memFile)(nil)
+
+// memFiles houses the flat block files of a block store in memory.
+type memFiles struct {
+	mtx   sync.Mutex
+	files map[uint32]*memFile
+}
+
+// file returns the file for the passed flat file number, creating it if
+// needed.
+func (m *memFiles) file(fileNum uint32) *memFile {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	file, ok := m.files[fileNum]
+	if !ok {
+		file = &memFile{}
+		m.files[fileNum] = file
+	}
+	return file
+}
+
+// openFile returns the file for the passed flat file number.  Files in memory
+// do not hold any resources, so unlike blockStore.openFile, it does not keep
+// track of the open files.
+func (m *memFiles) openFile(fileNum uint32) (*lockableFile, error) {
+	return &lockableFile{file: m.file(fileNum)}, nil
+}
+
+// openWriteFile returns the file for the passed flat file number.
+func (m *memFiles) openWriteFile(fileNum uint32) (filer, error) {
+	return m.file(fileNum), nil
+}
+
+// deleteFile removes the file for the passed flat file number.
+func (m *memFiles) deleteFile(fileNum uint32) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if _, ok := m.files[fileNum]; !ok {
+		str := fmt.Sprintf("file %d does not exist", fileNum)
+		return makeDbErr(database.ErrDriverSpecific, str, nil)
+	}
+	delete(m.files, fileNum)
+	return nil
+}
+
+// scanFiles returns the first file, last file, and the length of the last
+// file, the way scanBlockFiles does for the files on disk.
+func (m *memFiles) scanFiles() (int, int, uint32, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if len(m.files) == 0 {
+		return -1, -1, 0, nil
+	}
+	fileNums := make([]int, 0, len(m.files))
+	for fileNum := range m.files {
+		fileNums = append(fileNums, int(fileNum))
+	}
+	sort.Ints(fileNums)
+
+	first, last := fileNums[0], fileNums[len(fileNums)-1]
+	lastFile := m.files[uint32(last)]
+	lastFile.RLock()
+	lastFileLen := uint32(len(lastFile.data))
+	lastFile.RUnlock()
+	return first, last, lastFileLen, nil
+}
+
+// createMemDB creates and opens a database whose metadata and flat block
+// files are stored in memory.
+func createMemDB(network wire.BitcoinNet) (database.DB, error) {
+	opts := opt.Options{
+		Strict:      opt.DefaultStrict,
+		Compression: opt.NoCompression,
+		Filter:      filter.NewBloomFilter(10),
+	}
+	ldb, err := leveldb.Open(storage.NewMemStorage(), &opts)
+	if err != nil {
+		return nil, convertErr(err.Error(), err)
+	}
+
+	files := &memFiles{files: make(map[uint32]*memFile)}
+	store := makeBlockStore("", network, -1, 0)
+	store.openFileFunc = files.openFile
+	store.openWriteFileFunc = files.openWriteFile
+	store.deleteFileFunc = files.deleteFile
+	store.scanFilesFunc = files.scanFiles
+	cache := newDbCache(ldb, store, defaultCacheSize, defaultFlushSecs)
+	pdb := &db{store: store, cache: cache, inMemory: true}
+
+	// Perform the database initialization.
+	return reconcileDB(pdb, true)
+}
+
+// parseMemArgs parses the arguments from the in-memory database Create
+// method.
+func parseMemArgs(funcName string, args ...interface{}) (wire.BitcoinNet, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("invalid arguments to %s.%s -- "+
+			"expected block network", memDbType, funcName)
+	}
+
+	network, ok := args[0].(wire.BitcoinNet)
+	if !ok {
+		return 0, fmt.Errorf("first argument to %s.%s is invalid -- "+
+			"expected block network", memDbType, funcName)
+	}
+
+	return network, nil
+}
+
+// createMemDBDriver is the callback provided during driver registration that
+// creates, initializes, and opens an in-memory database for use.
+func createMemDBDriver(args ...interface{}) (database.DB, error) {
+	network, err := parseMemArgs("Create", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return createMemDB(network)
+}
+
+// openMemDBDriver is the callback provided during driver registration.  An
+// in-memory database does not outlive the process that created it, so there
+// is never an existing database to open.
+func openMemDBDriver(args ...interface{}) (database.DB, error) {
+	if _, err := parseMemArgs("Open", args...); err != nil {
+		return nil, err
+	}
+
+	str := "in-memory databases cannot be opened -- create one instead"
+	return nil, makeDbErr(database.ErrDbDoesNotExist, str, nil)
+}
@@ -484,3 +484,13 @@ type DB interface {
 	// back or committed).
 	Close() error
 }
+
+// Compacter is implemented by the databases which can reclaim the space of the
+// deleted and overwritten metadata on demand, rather than only as a side effect
+// of writes.
+type Compacter interface {
+	// Compact flushes any cached metadata and compacts the underlying
+	// storage.  It blocks write transactions while the cache is flushed,
+	// but not while the storage is compacted.
+	Compact() error
+}
@@ -138,7 +138,8 @@ Application Options:
 	-P, --rpcpass=              Password for RPC connections
 	-u, --rpcuser=              Username for RPC connections
 	    --sigcachemaxsize=      The maximum number of entries in the signature
-	                            verification cache (default: 100000)
+	                            verification and script validation caches
+	                            (default: 100000)
 	    --simnet                Use the simulation test network
 	    --testnet               Use the test network
 	    --torisolation          Enable Tor stream isolation by randomizing user
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 
 	"github.com/MetalBlockchain/btcvm/btcd/addrmgr"
 	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
@@ -37,7 +38,8 @@ func (logWriter) Write(p []byte) (n int, err error) {
 }
 
 // Loggers per subsystem.  A single backend logger is created and all subsystem
-// loggers created from it will write to the backend.  When adding new
+// loggers created from it will write to the backend, or to the log sink while
+// one is set.  When adding new
 // subsystems, add the subsystem logger variable here and to the
 // subsystemLoggers map.
 //
@@ -54,23 +56,178 @@ var (
 	// application shutdown.
 	logRotator *rotator.Rotator
 
-	adxrLog = backendLog.Logger("ADXR")
-	amgrLog = backendLog.Logger("AMGR")
-	cmgrLog = backendLog.Logger("CMGR")
-	bcdbLog = backendLog.Logger("BCDB")
-	btcdLog = backendLog.Logger("BTCD")
-	chanLog = backendLog.Logger("CHAN")
-	discLog = backendLog.Logger("DISC")
-	indxLog = backendLog.Logger("INDX")
-	minrLog = backendLog.Logger("MINR")
-	peerLog = backendLog.Logger("PEER")
-	rpcsLog = backendLog.Logger("RPCS")
-	scrpLog = backendLog.Logger("SCRP")
-	srvrLog = backendLog.Logger("SRVR")
-	syncLog = backendLog.Logger("SYNC")
-	txmpLog = backendLog.Logger("TXMP")
+	adxrLog = newSinkLogger("ADXR")
+	amgrLog = newSinkLogger("AMGR")
+	cmgrLog = newSinkLogger("CMGR")
+	bcdbLog = newSinkLogger("BCDB")
+	btcdLog = newSinkLogger("BTCD")
+	chanLog = newSinkLogger("CHAN")
+	discLog = newSinkLogger("DISC")
+	indxLog = newSinkLogger("INDX")
+	minrLog = newSinkLogger("MINR")
+	peerLog = newSinkLogger("PEER")
+	rpcsLog = newSinkLogger("RPCS")
+	scrpLog = newSinkLogger("SCRP")
+	srvrLog = newSinkLogger("SRVR")
+	syncLog = newSinkLogger("SYNC")
+	txmpLog = newSinkLogger("TXMP")
 )
 
+// LogSink receives the messages of the btcd subsystems in place of the log
+// rotator, such as to write them to the log of the node running the VM.
+// Messages below the level of their subsystem are not passed to the sink.
+type LogSink interface {
+	Log(subsystemID string, level btclog.Level, msg string)
+}
+
+// logSinkRef holds the log sink, which is shared by the subsystem loggers of
+// every VM of the process
+type logSinkRef struct {
+	sink LogSink
+}
+
+var logSink atomic.Pointer[logSinkRef]
+
+// SetLogSink routes the messages of the btcd subsystems to sink, or back to
+// the log rotator if sink is nil.
+func SetLogSink(sink LogSink) {
+	if sink == nil {
+		logSink.Store(nil)
+		return
+	}
+	logSink.Store(&logSinkRef{sink: sink})
+}
+
+// RemoveLogSink routes the messages of the btcd subsystems back to the log
+// rotator if sink is the current sink, so that a VM shutting down leaves the
+// sink of another VM of the process in place.
+func RemoveLogSink(sink LogSink) {
+	if ref := logSink.Load(); ref != nil && ref.sink == sink {
+		logSink.CompareAndSwap(ref, nil)
+	}
+}
+
+// sinkLogger is the logger of a btcd subsystem. It passes its messages to the
+// log sink if one is set, and to the backend otherwise.
+type sinkLogger struct {
+	btclog.Logger
+	subsystemID string
+}
+
+func newSinkLogger(subsystemID string) *sinkLogger {
+	return &sinkLogger{
+		Logger:      backendLog.Logger(subsystemID),
+		subsystemID: subsystemID,
+	}
+}
+
+// sink returns the log sink, or nil if the messages go to the backend
+func (l *sinkLogger) sink() LogSink {
+	ref := logSink.Load()
+	if ref == nil {
+		return nil
+	}
+	return ref.sink
+}
+
+// logf passes a formatted message at level to the log sink, returning false
+// if no sink is set
+func (l *sinkLogger) logf(level btclog.Level, format string, params []interface{}) bool {
+	sink := l.sink()
+	if sink == nil {
+		return false
+	}
+	if level >= l.Level() {
+		sink.Log(l.subsystemID, level, fmt.Sprintf(format, params...))
+	}
+	return true
+}
+
+// log passes a message of the default formats of v at level to the log sink,
+// returning false if no sink is set
+func (l *sinkLogger) log(level btclog.Level, v []interface{}) bool {
+	sink := l.sink()
+	if sink == nil {
+		return false
+	}
+	if level >= l.Level() {
+		sink.Log(l.subsystemID, level, fmt.Sprint(v...))
+	}
+	return true
+}
+
+func (l *sinkLogger) Tracef(format string, params ...interface{}) {
+	if !l.logf(btclog.LevelTrace, format, params) {
+		l.Logger.Tracef(format, params...)
+	}
+}
+
+func (l *sinkLogger) Debugf(format string, params ...interface{}) {
+	if !l.logf(btclog.LevelDebug, format, params) {
+		l.Logger.Debugf(format, params...)
+	}
+}
+
+func (l *sinkLogger) Infof(format string, params ...interface{}) {
+	if !l.logf(btclog.LevelInfo, format, params) {
+		l.Logger.Infof(format, params...)
+	}
+}
+
+func (l *sinkLogger) Warnf(format string, params ...interface{}) {
+	if !l.logf(btclog.LevelWarn, format, params) {
+		l.Logger.Warnf(format, params...)
+	}
+}
+
+func (l *sinkLogger) Errorf(format string, params ...interface{}) {
+	if !l.logf(btclog.LevelError, format, params) {
+		l.Logger.Errorf(format, params...)
+	}
+}
+
+func (l *sinkLogger) Criticalf(format string, params ...interface{}) {
+	if !l.logf(btclog.LevelCritical, format, params) {
+		l.Logger.Criticalf(format, params...)
+	}
+}
+
+func (l *sinkLogger) Trace(v ...interface{}) {
+	if !l.log(btclog.LevelTrace, v) {
+		l.Logger.Trace(v...)
+	}
+}
+
+func (l *sinkLogger) Debug(v ...interface{}) {
+	if !l.log(btclog.LevelDebug, v) {
+		l.Logger.Debug(v...)
+	}
+}
+
+func (l *sinkLogger) Info(v ...interface{}) {
+	if !l.log(btclog.LevelInfo, v) {
+		l.Logger.Info(v...)
+	}
+}
+
+func (l *sinkLogger) Warn(v ...interface{}) {
+	if !l.log(btclog.LevelWarn, v) {
+		l.Logger.Warn(v...)
+	}
+}
+
+func (l *sinkLogger) Error(v ...interface{}) {
+	if !l.log(btclog.LevelError, v) {
+		l.Logger.Error(v...)
+	}
+}
+
+func (l *sinkLogger) Critical(v ...interface{}) {
+	if !l.log(btclog.LevelCritical, v) {
+		l.Logger.Critical(v...)
+	}
+}
+
 // Initialize package-global logger variables.
 func init() {
 	addrmgr.UseLogger(amgrLog)
@@ -35,6 +35,11 @@ func (e RuleError) Error() string {
 type TxRuleError struct {
 	RejectCode  wire.RejectCode // The code to send with reject messages
 	Description string          // Human readable description of the issue
+
+	// MissingInputs is set when the transaction was rejected as an orphan,
+	// spending outputs of transactions which are unknown or fully spent.
+	// Such a transaction may become valid once its parents are known.
+	MissingInputs bool
 }
 
 // Error satisfies the error interface and prints human-readable errors.
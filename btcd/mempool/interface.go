@@ -24,10 +24,28 @@ type TxMempool interface {
 	// populated btcjson result.
 	RawMempoolVerbose() map[string]*btcjson.GetRawMempoolVerboseResult
 
+	// MempoolEntry returns the transaction with the passed hash in the
+	// main pool as a fully populated btcjson result, including the
+	// statistics of its unconfirmed ancestors and descendants.
+	MempoolEntry(hash *chainhash.Hash) (*btcjson.GetMempoolEntryResult, error)
+
+	// MempoolAncestors returns the unconfirmed ancestors of the
+	// transaction with the passed hash in the main pool as fully
+	// populated btcjson results keyed by their hash.
+	MempoolAncestors(hash *chainhash.Hash) (map[string]*btcjson.GetMempoolEntryResult, error)
+
+	// MempoolDescendants returns the unconfirmed descendants of the
+	// transaction with the passed hash in the main pool as fully
+	// populated btcjson results keyed by their hash.
+	MempoolDescendants(hash *chainhash.Hash) (map[string]*btcjson.GetMempoolEntryResult, error)
+
 	// Count returns the number of transactions in the main pool. It does
 	// not include the orphan pool.
 	Count() int
 
+	// OrphanCount returns the number of transactions in the orphan pool.
+	OrphanCount() int
+
 	// FetchTransaction returns the requested transaction from the
 	// transaction pool. This only fetches from the main transaction pool
 	// and does not include orphans.
@@ -64,6 +82,11 @@ type TxMempool interface {
 	// actions based on it.
 	CheckMempoolAcceptance(tx *btcutil.Tx) (*MempoolAcceptResult, error)
 
+	// MinFeeRate returns the minimum fee rate in Satoshi/kB of
+	// transactions accepted to the pool, which is raised above the minimum
+	// relay fee by the evictions of a full pool.
+	MinFeeRate() btcutil.Amount
+
 	// CheckSpend checks whether the passed outpoint is already spent by
 	// a transaction in the mempool. If that's the case the spending
 	// transaction will be returned, if not nil will be returned.
@@ -5,10 +5,12 @@
 package mempool
 
 import (
+	"cmp"
 	"container/list"
 	"fmt"
 	"maps"
 	"math"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -54,6 +56,27 @@ const (
 	// Transactions smaller than 65 non-witness bytes are not relayed to
 	// mitigate CVE-2017-12842.
 	MinStandardTxNonWitnessSize = 65
+
+	// DefaultMaxAncestorCount is the default maximum number of
+	// transactions in the mempool a transaction and its unconfirmed
+	// ancestors can add up to.
+	DefaultMaxAncestorCount = 25
+
+	// DefaultMaxAncestorSize is the default maximum virtual size in bytes
+	// of a transaction and its unconfirmed ancestors.
+	DefaultMaxAncestorSize = 101000
+
+	// DefaultMaxDataCarrierSize is the default maximum number of bytes of
+	// data carried by the null data output of a standard transaction.
+	DefaultMaxDataCarrierSize = txscript.MaxDataCarrierSize
+
+	// DefaultMaxPoolSize is the default maximum total serialized size in
+	// bytes of the transactions in the pool.
+	DefaultMaxPoolSize = 300000000
+
+	// rollingMinFeeHalfLife is the time it takes the minimum fee rate
+	// raised by the evictions of a full pool to decay by half.
+	rollingMinFeeHalfLife = 12 * time.Hour
 )
 
 // Tag represents an identifier to use for tagging orphan transactions.  The
@@ -101,6 +124,12 @@ type Config struct {
 	// HashCache defines the transaction hash mid-state cache to use.
 	HashCache *txscript.HashCache
 
+	// ScriptCache defines the cache of transactions whose scripts were
+	// validated to use.  It is shared with block validation so that the
+	// scripts of accepted transactions are not executed again when they
+	// are included in a block.
+	ScriptCache *blockchain.ScriptCache
+
 	// AddrIndex defines the optional address index instance to use for
 	// indexing the unconfirmed transactions in the memory pool.
 	// This can be nil if the address index is not enabled.
@@ -154,6 +183,41 @@ type Policy struct {
 	// transactions using the Replace-By-Fee (RBF) signaling policy into
 	// the mempool.
 	RejectReplacement bool
+
+	// FullRBF, if true, allows replacing transactions in the mempool
+	// regardless of whether they signal replaceability.  It has no effect
+	// if RejectReplacement is set.
+	FullRBF bool
+
+	// IncrementalRelayFee defines the fee in BTC/kB that a replacement
+	// transaction must pay on top of the fees of the transactions it
+	// replaces.
+	IncrementalRelayFee btcutil.Amount
+
+	// MaxAncestorCount and MaxAncestorSize are the maximum number of
+	// transactions, and their maximum virtual size, a transaction and its
+	// unconfirmed ancestors can add up to.  They bound the packages of
+	// transactions selected together when generating block templates.
+	// Zero disables the limit.
+	MaxAncestorCount int
+	MaxAncestorSize  int64
+
+	// RejectDataCarrier, if true, rejects transactions with outputs which
+	// only carry data (OP_RETURN) as non-standard.
+	RejectDataCarrier bool
+
+	// MaxDataCarrierSize is the maximum number of bytes of data the
+	// outputs which only carry data of a standard transaction can push in
+	// total.  Unlike the other standardness rules, both data carrier rules
+	// also apply when non-standard transactions are accepted.
+	MaxDataCarrierSize int
+
+	// MaxPoolSize is the maximum total serialized size in bytes of the
+	// transactions in the pool.  Once exceeded, the transactions with the
+	// lowest fee rates, along with their descendants, are evicted and the
+	// minimum fee rate of accepted transactions is raised above theirs.
+	// Zero disables the limit.
+	MaxPoolSize int64
 }
 
 // TxDesc is a descriptor containing a transaction in the mempool along with
@@ -180,16 +244,25 @@ type orphanTx struct {
 // peers.
 type TxPool struct {
 	// The following variables must only be used atomically.
-	lastUpdated int64 // last time pool was updated
+	lastUpdated int64  // last time pool was updated
+	numUpdates  uint64 // number of times pool was updated
 
 	mtx           sync.RWMutex
 	cfg           Config
 	pool          map[chainhash.Hash]*TxDesc
+	witnessHashes map[chainhash.Hash]struct{} // wtxids of the pool transactions
 	orphans       map[chainhash.Hash]*orphanTx
 	orphansByPrev map[wire.OutPoint]map[chainhash.Hash]*btcutil.Tx
 	outpoints     map[wire.OutPoint]*btcutil.Tx
 	pennyTotal    float64 // exponentially decaying total for penny spends.
 	lastPennyUnix int64   // unix time of last ``penny spend''
+	poolSize      int64   // total serialized size of the pool transactions
+
+	// rollingMinFee is the minimum fee rate in Satoshi/kB of accepted
+	// transactions as last raised by the evictions of a full pool, at
+	// rollingMinFeeUpdated.  It decays over time, see rollingMinFeeRate.
+	rollingMinFee        float64
+	rollingMinFeeUpdated time.Time
 
 	// nextExpireScan is the time after which the orphan pool will be
 	// scanned in order to evict orphans.  This is NOT a hard deadline as
@@ -200,8 +273,92 @@ type TxPool struct {
 	// onTxAccepted is called when a transaction is accepted to the mempool
 	onTxAccepted    func(*btcutil.Tx)
 	onTxAcceptedMtx sync.RWMutex
+
+	// onTxAdded is called with the pool lock held when a transaction is
+	// added to the pool
+	onTxAdded func(*TxDesc)
+
+	// onOrphanEvicted is called with the pool lock held when an orphan
+	// transaction is evicted from the orphan pool
+	onOrphanEvicted func(*btcutil.Tx, OrphanEvictionReason)
+
+	// onTxReplaced is called with the pool lock held when a transaction,
+	// or a descendant of it, is evicted by a replacement transaction
+	onTxReplaced func(replaced, replacement *btcutil.Tx)
+
+	// onDoubleSpend is called with the pool lock held when a transaction
+	// spending the same outputs as a transaction in the pool is seen
+	onDoubleSpend func(*DoubleSpend)
+
+	// onTxEvicted is called with the pool lock held when a transaction is
+	// evicted from the pool because it is full or expired
+	onTxEvicted func(*btcutil.Tx, TxEvictionReason)
+}
+
+// DoubleSpend describes a transaction spending outputs which are already spent
+// by a transaction in the pool.
+type DoubleSpend struct {
+	// Tx is the transaction spending the outputs.  It was either rejected
+	// from the pool, or confirmed by a block connected to the main chain.
+	Tx *btcutil.Tx
+
+	// Conflict is the transaction in the pool spending the same outputs.
+	// It is evicted from the pool if Tx is confirmed.
+	Conflict *btcutil.Tx
+
+	// OutPoints are the outputs spent by both transactions.
+	OutPoints []wire.OutPoint
+
+	// Confirmed is whether Tx is in a block connected to the main chain.
+	Confirmed bool
 }
 
+// OrphanEvictionReason is the reason an orphan transaction is evicted from
+// the orphan pool.
+type OrphanEvictionReason string
+
+// Reasons orphan transactions are evicted from the orphan pool.
+const (
+	// OrphanAccepted is not an eviction: the orphan left the orphan pool
+	// for the main pool.
+	OrphanAccepted OrphanEvictionReason = ""
+
+	// OrphanExpired is the eviction of an orphan whose parents did not
+	// arrive within the orphan TTL, or of an orphan redeeming it.
+	OrphanExpired OrphanEvictionReason = "expired"
+
+	// OrphanPoolFull is the random eviction of an orphan to make room for a
+	// new one.
+	OrphanPoolFull OrphanEvictionReason = "pool_full"
+
+	// OrphanInvalid is the eviction of an orphan found invalid once its
+	// parents arrived, or of an orphan redeeming it.
+	OrphanInvalid OrphanEvictionReason = "invalid"
+
+	// OrphanDoubleSpend is the eviction of an orphan spending an output
+	// spent by a transaction accepted to the main pool, or of an orphan
+	// redeeming it.
+	OrphanDoubleSpend OrphanEvictionReason = "double_spend"
+
+	// OrphanRemoved is the eviction of an orphan requested by the caller of
+	// RemoveOrphan or RemoveOrphansByTag, or of an orphan redeeming it.
+	OrphanRemoved OrphanEvictionReason = "removed"
+)
+
+// TxEvictionReason is the reason a transaction is evicted from the pool.
+type TxEvictionReason string
+
+// Reasons transactions are evicted from the pool.
+const (
+	// TxPoolFull is the eviction of a transaction paying one of the lowest
+	// fee rates to make room for others, or of a transaction redeeming it.
+	TxPoolFull TxEvictionReason = "pool_full"
+
+	// TxExpired is the eviction of a transaction which stayed in the pool
+	// longer than the expiry, or of a transaction redeeming it.
+	TxExpired TxEvictionReason = "expired"
+)
+
 // Ensure the TxPool type implements the mining.TxSource interface.
 var _ mining.TxSource = (*TxPool)(nil)
 
@@ -209,10 +366,12 @@ var _ mining.TxSource = (*TxPool)(nil)
 var _ TxMempool = (*TxPool)(nil)
 
 // removeOrphan is the internal function which implements the public
-// RemoveOrphan.  See the comment for RemoveOrphan for more details.
+// RemoveOrphan.  See the comment for RemoveOrphan for more details.  Unless
+// the reason is OrphanAccepted, the orphan and the redeemers removed with it
+// are reported as evicted for that reason.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) removeOrphan(tx *btcutil.Tx, removeRedeemers bool) {
+func (mp *TxPool) removeOrphan(tx *btcutil.Tx, removeRedeemers bool, reason OrphanEvictionReason) {
 	// Nothing to do if passed tx is not an orphan.
 	txHash := tx.Hash()
 	otx, exists := mp.orphans[*txHash]
@@ -240,13 +399,21 @@ func (mp *TxPool) removeOrphan(tx *btcutil.Tx, removeRedeemers bool) {
 		for txOutIdx := range tx.MsgTx().TxOut {
 			prevOut.Index = uint32(txOutIdx)
 			for _, orphan := range mp.orphansByPrev[prevOut] {
-				mp.removeOrphan(orphan, true)
+				mp.removeOrphan(orphan, true, reason)
 			}
 		}
 	}
 
 	// Remove the transaction from the orphan pool.
 	delete(mp.orphans, *txHash)
+
+	if reason != OrphanAccepted {
+		log.Debugf("Evicted orphan transaction %v (reason: %s, "+
+			"remaining: %d)", txHash, reason, len(mp.orphans))
+		if mp.onOrphanEvicted != nil {
+			mp.onOrphanEvicted(tx, reason)
+		}
+	}
 }
 
 // RemoveOrphan removes the passed orphan transaction from the orphan pool and
@@ -255,7 +422,7 @@ func (mp *TxPool) removeOrphan(tx *btcutil.Tx, removeRedeemers bool) {
 // This function is safe for concurrent access.
 func (mp *TxPool) RemoveOrphan(tx *btcutil.Tx) {
 	mp.mtx.Lock()
-	mp.removeOrphan(tx, false)
+	mp.removeOrphan(tx, false, OrphanRemoved)
 	mp.mtx.Unlock()
 }
 
@@ -268,7 +435,7 @@ func (mp *TxPool) RemoveOrphansByTag(tag Tag) uint64 {
 	mp.mtx.Lock()
 	for _, otx := range mp.orphans {
 		if otx.tag == tag {
-			mp.removeOrphan(otx.tx, true)
+			mp.removeOrphan(otx.tx, true, OrphanRemoved)
 			numEvicted++
 		}
 	}
@@ -292,7 +459,7 @@ func (mp *TxPool) limitNumOrphans() error {
 				// parents are very unlikely to ever materialize
 				// since the orphan has already been around more
 				// than long enough for them to be delivered.
-				mp.removeOrphan(otx.tx, true)
+				mp.removeOrphan(otx.tx, true, OrphanExpired)
 			}
 		}
 
@@ -322,7 +489,7 @@ func (mp *TxPool) limitNumOrphans() error {
 	for _, otx := range mp.orphans {
 		// Don't remove redeemers in the case of a random eviction since
 		// it is quite possible it might be needed again shortly.
-		mp.removeOrphan(otx.tx, false)
+		mp.removeOrphan(otx.tx, false, OrphanPoolFull)
 		break
 	}
 
@@ -399,7 +566,7 @@ func (mp *TxPool) removeOrphanDoubleSpends(tx *btcutil.Tx) {
 	msgTx := tx.MsgTx()
 	for _, txIn := range msgTx.TxIn {
 		for _, orphan := range mp.orphansByPrev[txIn.PreviousOutPoint] {
-			mp.removeOrphan(orphan, true)
+			mp.removeOrphan(orphan, true, OrphanDoubleSpend)
 		}
 	}
 }
@@ -429,6 +596,20 @@ func (mp *TxPool) IsTransactionInPool(hash *chainhash.Hash) bool {
 	return inPool
 }
 
+// IsWitnessHashInPool returns whether or not a transaction with the passed
+// witness hash (wtxid) already exists in the main pool. Unlike the txid, the
+// wtxid tells apart the versions of a transaction differing by their witness.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) IsWitnessHashInPool(wtxid *chainhash.Hash) bool {
+	// Protect concurrent access.
+	mp.mtx.RLock()
+	_, inPool := mp.witnessHashes[*wtxid]
+	mp.mtx.RUnlock()
+
+	return inPool
+}
+
 // isOrphanInPool returns whether or not the passed transaction already exists
 // in the orphan pool.
 //
@@ -504,7 +685,10 @@ func (mp *TxPool) removeTransaction(tx *btcutil.Tx, removeRedeemers bool) {
 			delete(mp.outpoints, txIn.PreviousOutPoint)
 		}
 		delete(mp.pool, *txHash)
+		delete(mp.witnessHashes, *txDesc.Tx.WitnessHash())
+		mp.poolSize -= int64(tx.MsgTx().SerializeSize())
 		atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
+		atomic.AddUint64(&mp.numUpdates, 1)
 	}
 }
 
@@ -531,16 +715,84 @@ func (mp *TxPool) RemoveTransaction(tx *btcutil.Tx, removeRedeemers bool) {
 func (mp *TxPool) RemoveDoubleSpends(tx *btcutil.Tx) {
 	// Protect concurrent access.
 	mp.mtx.Lock()
-	for _, txIn := range tx.MsgTx().TxIn {
-		if txRedeemer, ok := mp.outpoints[txIn.PreviousOutPoint]; ok {
-			if !txRedeemer.Hash().IsEqual(tx.Hash()) {
-				mp.removeTransaction(txRedeemer, true)
-			}
+	for _, doubleSpend := range mp.doubleSpends(tx) {
+		doubleSpend.Confirmed = true
+		if mp.onDoubleSpend != nil {
+			mp.onDoubleSpend(doubleSpend)
 		}
+		mp.removeTransaction(doubleSpend.Conflict, true)
 	}
 	mp.mtx.Unlock()
 }
 
+// doubleSpends returns the transactions in the pool, other than tx itself,
+// spending outputs spent by tx, along with the outputs they both spend.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) doubleSpends(tx *btcutil.Tx) []*DoubleSpend {
+	var doubleSpends []*DoubleSpend
+	for _, txIn := range tx.MsgTx().TxIn {
+		conflict, ok := mp.outpoints[txIn.PreviousOutPoint]
+		if !ok || conflict.Hash().IsEqual(tx.Hash()) {
+			continue
+		}
+
+		idx := slices.IndexFunc(doubleSpends, func(ds *DoubleSpend) bool {
+			return ds.Conflict == conflict
+		})
+		if idx < 0 {
+			doubleSpends = append(doubleSpends, &DoubleSpend{
+				Tx:       tx,
+				Conflict: conflict,
+			})
+			idx = len(doubleSpends) - 1
+		}
+		doubleSpends[idx].OutPoints = append(
+			doubleSpends[idx].OutPoints, txIn.PreviousOutPoint,
+		)
+	}
+	return doubleSpends
+}
+
+// reportDoubleSpends reports the transactions in the pool spending outputs
+// spent by tx, which was rejected from the pool.  Only transactions with valid
+// scripts are reported, so that false alarms can't be raised by transactions
+// spending outputs their creator can't spend.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) reportDoubleSpends(tx *btcutil.Tx) {
+	if mp.onDoubleSpend == nil {
+		return
+	}
+	doubleSpends := mp.doubleSpends(tx)
+	if len(doubleSpends) == 0 {
+		return
+	}
+
+	utxoView, err := mp.fetchInputUtxos(tx)
+	if err != nil {
+		return
+	}
+	for _, txIn := range tx.MsgTx().TxIn {
+		entry := utxoView.LookupEntry(txIn.PreviousOutPoint)
+		if entry == nil || entry.IsSpent() {
+			return
+		}
+	}
+	err = blockchain.ValidateTransactionScripts(tx, utxoView,
+		txscript.StandardVerifyFlags, mp.cfg.SigCache,
+		mp.cfg.HashCache, mp.cfg.ScriptCache)
+	if err != nil {
+		return
+	}
+
+	for _, doubleSpend := range doubleSpends {
+		log.Debugf("Transaction %v double spends %v", tx.Hash(),
+			doubleSpend.Conflict.Hash())
+		mp.onDoubleSpend(doubleSpend)
+	}
+}
+
 // addTransaction adds the passed transaction to the memory pool.  It should
 // not be called directly as it doesn't perform any validation.  This is a
 // helper for maybeAcceptTransaction.
@@ -561,10 +813,13 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *btcutil
 	}
 
 	mp.pool[*tx.Hash()] = txD
+	mp.witnessHashes[*tx.WitnessHash()] = struct{}{}
 	for _, txIn := range tx.MsgTx().TxIn {
 		mp.outpoints[txIn.PreviousOutPoint] = tx
 	}
+	mp.poolSize += int64(tx.MsgTx().SerializeSize())
 	atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
+	atomic.AddUint64(&mp.numUpdates, 1)
 
 	// Trigger callback for VM block builder
 	mp.triggerTxAccepted(tx)
@@ -579,6 +834,9 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *btcutil
 	if mp.cfg.FeeEstimator != nil {
 		mp.cfg.FeeEstimator.ObserveTransaction(txD)
 	}
+	if mp.onTxAdded != nil {
+		mp.onTxAdded(txD)
+	}
 
 	return txD
 }
@@ -586,10 +844,10 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *btcutil
 // checkPoolDoubleSpend checks whether or not the passed transaction is
 // attempting to spend coins already spent by other transactions in the pool.
 // If it does, we'll check whether each of those transactions are signaling for
-// replacement. If just one of them isn't, an error is returned. Otherwise, a
-// boolean is returned signaling that the transaction is a replacement. Note it
-// does not check for double spends against transactions already in the main
-// chain.
+// replacement, unless the full RBF policy is enabled. If just one of them
+// isn't, an error is returned. Otherwise, a boolean is returned signaling that
+// the transaction is a replacement. Note it does not check for double spends
+// against transactions already in the main chain.
 //
 // This function MUST be called with the mempool lock held (for reads).
 func (mp *TxPool) checkPoolDoubleSpend(tx *btcutil.Tx) (bool, error) {
@@ -601,9 +859,10 @@ func (mp *TxPool) checkPoolDoubleSpend(tx *btcutil.Tx) (bool, error) {
 		}
 
 		// Reject the transaction if we don't accept replacement
-		// transactions or if it doesn't signal replacement.
-		if mp.cfg.Policy.RejectReplacement ||
-			!mp.signalsReplacement(conflict, nil) {
+		// transactions or if it doesn't signal replacement and we
+		// only replace signaling transactions.
+		if mp.cfg.Policy.RejectReplacement || (!mp.cfg.Policy.FullRBF &&
+			!mp.signalsReplacement(conflict, nil)) {
 			str := fmt.Sprintf("output already spent in mempool: "+
 				"output=%v, tx=%v", txIn.PreviousOutPoint,
 				conflict.Hash())
@@ -820,6 +1079,36 @@ func (mp *TxPool) fetchInputUtxos(tx *btcutil.Tx) (*blockchain.UtxoViewpoint, er
 	return utxoView, nil
 }
 
+// FetchTxFee returns the fee paid by the passed transaction, computed from the
+// utxo details of its inputs from the viewpoint of the main chain and the
+// transaction pool.  The returned bool is false when any of the inputs is not
+// found, such as for orphan transactions.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) FetchTxFee(tx *btcutil.Tx) (int64, bool, error) {
+	mp.mtx.RLock()
+	utxoView, err := mp.fetchInputUtxos(tx)
+	mp.mtx.RUnlock()
+	if err != nil {
+		return 0, false, err
+	}
+
+	var totalIn int64
+	for _, txIn := range tx.MsgTx().TxIn {
+		entry := utxoView.LookupEntry(txIn.PreviousOutPoint)
+		if entry == nil || entry.IsSpent() {
+			return 0, false, nil
+		}
+		totalIn += entry.Amount()
+	}
+
+	var totalOut int64
+	for _, txOut := range tx.MsgTx().TxOut {
+		totalOut += txOut.Value
+	}
+	return totalIn - totalOut, true, nil
+}
+
 // FetchTransaction returns the requested transaction from the transaction pool.
 // This only fetches from the main transaction pool and does not include
 // orphans.
@@ -903,8 +1192,8 @@ func (mp *TxPool) validateReplacement(tx *btcutil.Tx,
 
 	// It should also have an absolute fee greater than all of the
 	// transactions it intends to replace and pay for its own bandwidth,
-	// which is determined by our minimum relay fee.
-	minFee := calcMinRequiredTxRelayFee(txSize, mp.cfg.Policy.MinRelayTxFee)
+	// which is determined by our incremental relay fee.
+	minFee := calcMinRequiredTxRelayFee(txSize, mp.cfg.Policy.IncrementalRelayFee)
 	if txFee < conflictsFee+minFee {
 		str := fmt.Sprintf("%v: replacement transaction has an "+
 			"insufficient absolute fee: needs %v, has %v",
@@ -968,9 +1257,22 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit,
 		// each one, so we don't need to remove the redeemers within
 		// this call as they'll be removed eventually.
 		mp.removeTransaction(conflict, false)
+		if mp.onTxReplaced != nil {
+			mp.onTxReplaced(conflict, tx)
+		}
 	}
 	txD := mp.addTransaction(r.utxoView, tx, r.bestHeight, int64(r.TxFee))
 
+	// Make room for the transaction if the pool is full.  It can be the
+	// one paying the lowest fee rate, in which case it is evicted right
+	// away.
+	mp.trimToSize()
+	if !mp.isTransactionInPool(txHash) {
+		str := fmt.Sprintf("transaction %v evicted from the full "+
+			"mempool", txHash)
+		return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
+	}
+
 	log.Debugf("Accepted transaction %v (pool size: %v)", txHash,
 		len(mp.pool))
 
@@ -1040,7 +1342,7 @@ func (mp *TxPool) processOrphans(acceptedTx *btcutil.Tx) []*TxDesc {
 					// is no way any other orphans which
 					// redeem any of its outputs can be
 					// accepted.  Remove them.
-					mp.removeOrphan(tx, true)
+					mp.removeOrphan(tx, true, OrphanInvalid)
 					break
 				}
 
@@ -1058,7 +1360,7 @@ func (mp *TxPool) processOrphans(acceptedTx *btcutil.Tx) []*TxDesc {
 				// transactions to process so any orphans that
 				// depend on it are handled too.
 				acceptedTxns = append(acceptedTxns, txD)
-				mp.removeOrphan(tx, false)
+				mp.removeOrphan(tx, false, OrphanAccepted)
 				processList.PushBack(tx)
 
 				// Only one transaction for this outpoint can be
@@ -1120,6 +1422,7 @@ func (mp *TxPool) ProcessTransaction(tx *btcutil.Tx, allowOrphan, rateLimit bool
 	missingParents, txD, err := mp.maybeAcceptTransaction(tx, true, rateLimit,
 		true)
 	if err != nil {
+		mp.reportDoubleSpends(tx)
 		return nil, err
 	}
 
@@ -1154,7 +1457,11 @@ func (mp *TxPool) ProcessTransaction(tx *btcutil.Tx, allowOrphan, rateLimit bool
 		str := fmt.Sprintf("orphan transaction %v references "+
 			"outputs of unknown or fully-spent "+
 			"transaction %v", tx.Hash(), missingParents[0])
-		return nil, txRuleError(wire.RejectDuplicate, str)
+		return nil, RuleError{Err: TxRuleError{
+			RejectCode:    wire.RejectDuplicate,
+			Description:   str,
+			MissingInputs: true,
+		}}
 	}
 
 	// Potentially add the orphan transaction to the orphan pool.
@@ -1162,6 +1469,17 @@ func (mp *TxPool) ProcessTransaction(tx *btcutil.Tx, allowOrphan, rateLimit bool
 	return nil, err
 }
 
+// OrphanCount returns the number of transactions in the orphan pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) OrphanCount() int {
+	mp.mtx.RLock()
+	count := len(mp.orphans)
+	mp.mtx.RUnlock()
+
+	return count
+}
+
 // Count returns the number of transactions in the main pool.  It does not
 // include the orphan pool.
 //
@@ -1276,6 +1594,145 @@ func (mp *TxPool) RawMempoolVerbose() map[string]*btcjson.GetRawMempoolVerboseRe
 	return result
 }
 
+// MempoolEntry returns the transaction with the passed hash in the main pool
+// as a fully populated btcjson result, including the statistics of its
+// unconfirmed ancestors and descendants.  As in bitcoind, the ancestor and
+// descendant statistics include the transaction itself.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MempoolEntry(hash *chainhash.Hash) (*btcjson.GetMempoolEntryResult, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	desc, exists := mp.pool[*hash]
+	if !exists {
+		return nil, fmt.Errorf("transaction is not in the pool")
+	}
+
+	return mp.mempoolEntry(desc, nil, nil), nil
+}
+
+// MempoolAncestors returns the unconfirmed ancestors of the transaction with
+// the passed hash in the main pool as fully populated btcjson results keyed by
+// their hash.  All of the entries are taken from the same state of the pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MempoolAncestors(hash *chainhash.Hash) (map[string]*btcjson.GetMempoolEntryResult, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	desc, exists := mp.pool[*hash]
+	if !exists {
+		return nil, fmt.Errorf("transaction is not in the pool")
+	}
+
+	return mp.mempoolEntries(mp.txAncestors(desc.Tx, nil)), nil
+}
+
+// MempoolDescendants returns the unconfirmed descendants of the transaction
+// with the passed hash in the main pool as fully populated btcjson results
+// keyed by their hash.  All of the entries are taken from the same state of
+// the pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MempoolDescendants(hash *chainhash.Hash) (map[string]*btcjson.GetMempoolEntryResult, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	desc, exists := mp.pool[*hash]
+	if !exists {
+		return nil, fmt.Errorf("transaction is not in the pool")
+	}
+
+	return mp.mempoolEntries(mp.txDescendants(desc.Tx, nil)), nil
+}
+
+// mempoolEntries returns the entries of the passed transactions keyed by their
+// hash.  The ancestors and descendants of the transactions are cached across
+// the entries since they usually belong to the same package.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) mempoolEntries(txns map[chainhash.Hash]*btcutil.Tx) map[string]*btcjson.GetMempoolEntryResult {
+	ancestorCache := make(map[chainhash.Hash]map[chainhash.Hash]*btcutil.Tx)
+	descendantCache := make(map[chainhash.Hash]map[chainhash.Hash]*btcutil.Tx)
+	entries := make(map[string]*btcjson.GetMempoolEntryResult, len(txns))
+	for hash := range txns {
+		entries[hash.String()] = mp.mempoolEntry(mp.pool[hash],
+			ancestorCache, descendantCache)
+	}
+
+	return entries
+}
+
+// mempoolEntry returns the passed transaction of the main pool as a fully
+// populated btcjson result.  Caches of the ancestors and descendants of the
+// transactions of the pool can be provided to compute several entries.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) mempoolEntry(desc *TxDesc, ancestorCache,
+	descendantCache map[chainhash.Hash]map[chainhash.Hash]*btcutil.Tx) *btcjson.GetMempoolEntryResult {
+
+	tx := desc.Tx
+	vsize := GetTxVirtualSize(tx)
+
+	ancestorSize, ancestorFees := vsize, desc.Fee
+	ancestors := mp.txAncestors(tx, ancestorCache)
+	for ancestorHash, ancestor := range ancestors {
+		ancestorSize += GetTxVirtualSize(ancestor)
+		ancestorFees += mp.pool[ancestorHash].Fee
+	}
+	descendantSize, descendantFees := vsize, desc.Fee
+	descendants := mp.txDescendants(tx, descendantCache)
+	for descendantHash, descendant := range descendants {
+		descendantSize += GetTxVirtualSize(descendant)
+		descendantFees += mp.pool[descendantHash].Fee
+	}
+
+	fee := btcutil.Amount(desc.Fee).ToBTC()
+	entry := &btcjson.GetMempoolEntryResult{
+		VSize:           int32(vsize),
+		Size:            int32(tx.MsgTx().SerializeSize()),
+		Weight:          blockchain.GetTransactionWeight(tx),
+		Fee:             fee,
+		ModifiedFee:     fee,
+		Time:            desc.Added.Unix(),
+		Height:          int64(desc.Height),
+		DescendantCount: int64(len(descendants) + 1),
+		DescendantSize:  descendantSize,
+		DescendantFees:  float64(descendantFees),
+		AncestorCount:   int64(len(ancestors) + 1),
+		AncestorSize:    ancestorSize,
+		AncestorFees:    float64(ancestorFees),
+		WTxId:           tx.WitnessHash().String(),
+		Fees: btcjson.MempoolFees{
+			Base:       fee,
+			Modified:   fee,
+			Ancestor:   btcutil.Amount(ancestorFees).ToBTC(),
+			Descendant: btcutil.Amount(descendantFees).ToBTC(),
+		},
+		Depends: make([]string, 0),
+		SpentBy: make([]string, 0),
+	}
+	for _, txIn := range tx.MsgTx().TxIn {
+		parentHash := txIn.PreviousOutPoint.Hash
+		if _, ok := ancestors[parentHash]; ok &&
+			!slices.Contains(entry.Depends, parentHash.String()) {
+
+			entry.Depends = append(entry.Depends, parentHash.String())
+		}
+	}
+	op := wire.OutPoint{Hash: *tx.Hash()}
+	for i := range tx.MsgTx().TxOut {
+		op.Index = uint32(i)
+		child, ok := mp.outpoints[op]
+		if ok && !slices.Contains(entry.SpentBy, child.Hash().String()) {
+			entry.SpentBy = append(entry.SpentBy, child.Hash().String())
+		}
+	}
+
+	return entry
+}
+
 // LastUpdated returns the last time a transaction was added to or removed from
 // the main pool.  It does not include the orphan pool.
 //
@@ -1284,6 +1741,15 @@ func (mp *TxPool) LastUpdated() time.Time {
 	return time.Unix(atomic.LoadInt64(&mp.lastUpdated), 0)
 }
 
+// NumUpdates returns the number of times a transaction was added to or removed
+// from the main pool.  Unlike LastUpdated, it changes on every update, so it
+// can be used to tell whether the pool changed since it was last inspected.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) NumUpdates() uint64 {
+	return atomic.LoadUint64(&mp.numUpdates)
+}
+
 // MempoolAcceptResult holds the result from mempool acceptance check.
 type MempoolAcceptResult struct {
 	// TxFee is the fees paid in satoshi.
@@ -1529,6 +1995,20 @@ func (mp *TxPool) checkMempoolAcceptance(tx *btcutil.Tx,
 		return nil, err
 	}
 
+	// Don't allow transactions paying less than the transactions evicted
+	// from the pool when it was full.
+	if isNew {
+		if err := mp.validatePoolMinFee(tx, txFee, txSize); err != nil {
+			return nil, err
+		}
+	}
+
+	// Don't allow chains of unconfirmed transactions too long to be mined
+	// together.
+	if err := mp.validateAncestorLimits(tx, txSize); err != nil {
+		return nil, err
+	}
+
 	// If the transaction has any conflicts, and we've made it this far,
 	// then we're processing a potential replacement.
 	var conflicts map[chainhash.Hash]*btcutil.Tx
@@ -1543,7 +2023,7 @@ func (mp *TxPool) checkMempoolAcceptance(tx *btcutil.Tx,
 	// if any don't verify.
 	err = blockchain.ValidateTransactionScripts(tx, utxoView,
 		txscript.StandardVerifyFlags, mp.cfg.SigCache,
-		mp.cfg.HashCache)
+		mp.cfg.HashCache, mp.cfg.ScriptCache)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
 			return nil, chainRuleError(cerr)
@@ -1562,6 +2042,37 @@ func (mp *TxPool) checkMempoolAcceptance(tx *btcutil.Tx,
 	return result, nil
 }
 
+// validateAncestorLimits checks that the transaction and its unconfirmed
+// ancestors don't exceed the ancestor limits of the mempool policy.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) validateAncestorLimits(tx *btcutil.Tx, txSize int64) error {
+	maxCount, maxSize := mp.cfg.Policy.MaxAncestorCount, mp.cfg.Policy.MaxAncestorSize
+	if maxCount <= 0 && maxSize <= 0 {
+		return nil
+	}
+
+	ancestors := mp.txAncestors(tx, nil)
+	if maxCount > 0 && len(ancestors)+1 > maxCount {
+		str := fmt.Sprintf("transaction %v has too many unconfirmed "+
+			"ancestors: %d transactions > %d", tx.Hash(),
+			len(ancestors)+1, maxCount)
+		return txRuleError(wire.RejectNonstandard, str)
+	}
+
+	size := txSize
+	for _, ancestor := range ancestors {
+		size += GetTxVirtualSize(ancestor)
+	}
+	if maxSize > 0 && size > maxSize {
+		str := fmt.Sprintf("transaction %v has too large unconfirmed "+
+			"ancestors: %d bytes > %d", tx.Hash(), size, maxSize)
+		return txRuleError(wire.RejectNonstandard, str)
+	}
+
+	return nil
+}
+
 // validateSegWitDeployment checks that when a transaction has witness data,
 // segwit must be active.
 func (mp *TxPool) validateSegWitDeployment(tx *btcutil.Tx) error {
@@ -1597,6 +2108,23 @@ func (mp *TxPool) validateSegWitDeployment(tx *btcutil.Tx) error {
 	return txRuleError(wire.RejectNonstandard, str)
 }
 
+// CheckDataCarriers checks the outputs of the passed transaction which only
+// carry data (OP_RETURN) against the data carrier policy of the pool.  It lets
+// callers drop transactions before processing them, which only checks the
+// standardness of orphans once their parents are known.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) CheckDataCarriers(tx *btcutil.Tx) error {
+	err := checkDataCarriers(tx, !mp.cfg.Policy.RejectDataCarrier,
+		mp.cfg.Policy.MaxDataCarrierSize)
+	if err != nil {
+		str := fmt.Sprintf("transaction %v is not standard: %v",
+			tx.Hash(), err)
+		return txRuleError(wire.RejectNonstandard, str)
+	}
+	return nil
+}
+
 // validateStandardness checks the transaction passes both transaction standard
 // and input standard.
 func (mp *TxPool) validateStandardness(tx *btcutil.Tx, nextBlockHeight int32,
@@ -1608,13 +2136,14 @@ func (mp *TxPool) validateStandardness(tx *btcutil.Tx, nextBlockHeight int32,
 	// you should add code here to check that the transaction does a
 	// reasonable number of ECDSA signature verifications.
 	if mp.cfg.Policy.AcceptNonStd {
-		return nil
+		return mp.CheckDataCarriers(tx)
 	}
 
 	// Check the transaction standard.
 	err := CheckTransactionStandard(
 		tx, nextBlockHeight, medianTimePast,
 		mp.cfg.Policy.MinRelayTxFee, mp.cfg.Policy.MaxTxVersion,
+		!mp.cfg.Policy.RejectDataCarrier, mp.cfg.Policy.MaxDataCarrierSize,
 	)
 	if err != nil {
 		// Attempt to extract a reject code from the error so it can be
@@ -1762,12 +2291,174 @@ func (mp *TxPool) validateRelayFeeMet(tx *btcutil.Tx, txFee, txSize int64,
 	return nil
 }
 
+// validatePoolMinFee checks that the transaction pays the minimum fee rate
+// raised by the evictions of a full pool.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) validatePoolMinFee(tx *btcutil.Tx, txFee, txSize int64) error {
+	rate := mp.rollingMinFeeRate(time.Now())
+	if rate == 0 {
+		return nil
+	}
+
+	minFee := calcMinRequiredTxRelayFee(txSize, rate)
+	if txFee < minFee {
+		str := fmt.Sprintf("transaction %v has %d fees which is under "+
+			"the mempool min fee of %d", tx.Hash(), txFee, minFee)
+		return txRuleError(wire.RejectInsufficientFee, str)
+	}
+	return nil
+}
+
+// rollingMinFeeRate returns the minimum fee rate in Satoshi/kB of accepted
+// transactions raised by the evictions of a full pool, halved every
+// rollingMinFeeHalfLife since it was last raised.  It drops to zero once it
+// decays below half the incremental relay fee.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) rollingMinFeeRate(now time.Time) btcutil.Amount {
+	if mp.rollingMinFee == 0 {
+		return 0
+	}
+
+	elapsed := now.Sub(mp.rollingMinFeeUpdated)
+	rate := mp.rollingMinFee * math.Pow(0.5,
+		elapsed.Seconds()/rollingMinFeeHalfLife.Seconds())
+	if rate < float64(mp.cfg.Policy.IncrementalRelayFee)/2 {
+		return 0
+	}
+	return btcutil.Amount(rate)
+}
+
+// MinFeeRate returns the minimum fee rate in Satoshi/kB of transactions
+// accepted to the pool: the minimum relay fee, or the rate raised by the
+// evictions of a full pool if higher.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MinFeeRate() btcutil.Amount {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	return max(mp.rollingMinFeeRate(time.Now()), mp.cfg.Policy.MinRelayTxFee)
+}
+
+// descendantScore returns the fee rate in Satoshi/kB a transaction is
+// evicted by: the highest of its own fee rate and the fee rate of the
+// package of its descendants, so that a transaction whose fees are bumped by
+// its children is not evicted before them.  A cache of descendants can be
+// provided as for txDescendants.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) descendantScore(txD *TxDesc,
+	cache map[chainhash.Hash]map[chainhash.Hash]*btcutil.Tx) int64 {
+
+	fees, size := txD.Fee, GetTxVirtualSize(txD.Tx)
+	for hash, descendant := range mp.txDescendants(txD.Tx, cache) {
+		fees += mp.pool[hash].Fee
+		size += GetTxVirtualSize(descendant)
+	}
+	return max(txD.FeePerKB, fees*1000/size)
+}
+
+// trimToSize evicts the transactions with the lowest descendant score, along
+// with their descendants, until the pool fits in its maximum size.  The
+// minimum fee rate of accepted transactions is raised above the score of each
+// evicted transaction, so that it can't be accepted again right away.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) trimToSize() {
+	maxSize := mp.cfg.Policy.MaxPoolSize
+	if maxSize <= 0 || mp.poolSize <= maxSize {
+		return
+	}
+
+	type scoredTx struct {
+		tx    *btcutil.Tx
+		score int64
+	}
+	scored := make([]scoredTx, 0, len(mp.pool))
+	cache := make(map[chainhash.Hash]map[chainhash.Hash]*btcutil.Tx)
+	for _, txD := range mp.pool {
+		scored = append(scored, scoredTx{
+			tx:    txD.Tx,
+			score: mp.descendantScore(txD, cache),
+		})
+	}
+	slices.SortFunc(scored, func(a, b scoredTx) int {
+		return cmp.Compare(a.score, b.score)
+	})
+
+	// The scores are not updated as descendants are evicted, which only
+	// lowers the scores of their ancestors.
+	for _, s := range scored {
+		if mp.poolSize <= maxSize {
+			break
+		}
+		if !mp.isTransactionInPool(s.tx.Hash()) {
+			continue
+		}
+
+		rate := s.score + int64(mp.cfg.Policy.IncrementalRelayFee)
+		now := time.Now()
+		if btcutil.Amount(rate) > mp.rollingMinFeeRate(now) {
+			mp.rollingMinFee = float64(rate)
+			mp.rollingMinFeeUpdated = now
+		}
+		mp.evictTransaction(s.tx, TxPoolFull)
+	}
+
+	log.Debugf("Trimmed mempool to %d bytes (min fee rate: %v sat/kb)",
+		mp.poolSize, mp.rollingMinFeeRate(time.Now()))
+}
+
+// evictTransaction removes the passed transaction and its descendants from
+// the pool, reports them as evicted for the passed reason and returns how
+// many transactions were evicted.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) evictTransaction(tx *btcutil.Tx, reason TxEvictionReason) int {
+	evicted := []*btcutil.Tx{tx}
+	for _, descendant := range mp.txDescendants(tx, nil) {
+		evicted = append(evicted, descendant)
+	}
+	mp.removeTransaction(tx, true)
+
+	for _, evictedTx := range evicted {
+		log.Debugf("Evicted transaction %v (reason: %s)",
+			evictedTx.Hash(), reason)
+		if mp.onTxEvicted != nil {
+			mp.onTxEvicted(evictedTx, reason)
+		}
+	}
+	return len(evicted)
+}
+
+// Expire evicts the transactions added to the pool before the passed cutoff,
+// along with their descendants, and returns the number of transactions
+// evicted.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Expire(cutoff time.Time) int {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	var evicted int
+	for hash, txD := range mp.pool {
+		if !txD.Added.Before(cutoff) || !mp.isTransactionInPool(&hash) {
+			continue
+		}
+		evicted += mp.evictTransaction(txD.Tx, TxExpired)
+	}
+	return evicted
+}
+
 // New returns a new memory pool for validating and storing standalone
 // transactions until they are mined into a block.
 func New(cfg *Config) *TxPool {
 	return &TxPool{
 		cfg:            *cfg,
 		pool:           make(map[chainhash.Hash]*TxDesc),
+		witnessHashes:  make(map[chainhash.Hash]struct{}),
 		orphans:        make(map[chainhash.Hash]*orphanTx),
 		orphansByPrev:  make(map[wire.OutPoint]map[chainhash.Hash]*btcutil.Tx),
 		nextExpireScan: time.Now().Add(orphanExpireScanInterval),
@@ -1782,6 +2473,55 @@ func (mp *TxPool) SetOnTxAccepted(callback func(*btcutil.Tx)) {
 	mp.onTxAccepted = callback
 }
 
+// SetOnTxAdded sets the callback called when a transaction is added to the
+// pool. The callback is called synchronously with the pool lock held, so it
+// must not call back into the pool.
+func (mp *TxPool) SetOnTxAdded(callback func(*TxDesc)) {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+	mp.onTxAdded = callback
+}
+
+// SetOnOrphanEvicted sets the callback called when an orphan transaction is
+// evicted from the orphan pool. The callback is called synchronously with the
+// pool lock held, so it must not call back into the pool.
+func (mp *TxPool) SetOnOrphanEvicted(callback func(*btcutil.Tx, OrphanEvictionReason)) {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+	mp.onOrphanEvicted = callback
+}
+
+// SetOnDoubleSpend sets the callback called when a transaction spending the
+// same outputs as a transaction in the pool is rejected from the pool, or is
+// confirmed in a block connected to the main chain. The callback is called
+// synchronously with the pool lock held, so it must not call back into the
+// pool.
+func (mp *TxPool) SetOnDoubleSpend(callback func(*DoubleSpend)) {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+	mp.onDoubleSpend = callback
+}
+
+// SetOnTxReplaced sets the callback called when a transaction is evicted from
+// the pool by a replacement transaction, including the descendants of the
+// replaced transactions. The callback is called synchronously with the pool
+// lock held, so it must not call back into the pool.
+func (mp *TxPool) SetOnTxReplaced(callback func(replaced, replacement *btcutil.Tx)) {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+	mp.onTxReplaced = callback
+}
+
+// SetOnTxEvicted sets the callback called when a transaction is evicted from
+// the pool because it is full or expired, including the descendants evicted
+// with it. The callback is called synchronously with the pool lock held, so it
+// must not call back into the pool.
+func (mp *TxPool) SetOnTxEvicted(callback func(*btcutil.Tx, TxEvictionReason)) {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+	mp.onTxEvicted = callback
+}
+
 // triggerTxAccepted calls the tx accepted callback if set
 func (mp *TxPool) triggerTxAccepted(tx *btcutil.Tx) {
 	mp.onTxAcceptedMtx.RLock()
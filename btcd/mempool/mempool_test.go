@@ -323,6 +323,7 @@ func newPoolHarness(chainParams *chaincfg.Params) (*poolHarness, []spendableOutp
 				MaxOrphanTxSize:      1000,
 				MaxSigOpCostPerTx:    blockchain.MaxBlockSigOpsCost / 4,
 				MinRelayTxFee:        1000, // 1 Satoshi per byte
+				IncrementalRelayFee:  1000, // 1 Satoshi per byte
 				MaxTxVersion:         1,
 			},
 			ChainParams:      chainParams,
@@ -756,7 +757,7 @@ func TestOrphanChainRemoval(t *testing.T) {
 	// remove redeemer flag set and ensure that only the first orphan was
 	// removed.
 	harness.txPool.mtx.Lock()
-	harness.txPool.removeOrphan(chainedTxns[1], false)
+	harness.txPool.removeOrphan(chainedTxns[1], false, OrphanRemoved)
 	harness.txPool.mtx.Unlock()
 	testPoolMembership(tc, chainedTxns[1], false, false)
 	for _, tx := range chainedTxns[2 : maxOrphans+1] {
@@ -766,13 +767,96 @@ func TestOrphanChainRemoval(t *testing.T) {
 	// Remove the first remaining orphan that starts the orphan chain with
 	// the remove redeemer flag set and ensure they are all removed.
 	harness.txPool.mtx.Lock()
-	harness.txPool.removeOrphan(chainedTxns[2], true)
+	harness.txPool.removeOrphan(chainedTxns[2], true, OrphanRemoved)
 	harness.txPool.mtx.Unlock()
 	for _, tx := range chainedTxns[2 : maxOrphans+1] {
 		testPoolMembership(tc, tx, false, false)
 	}
 }
 
+// TestOrphanEvictionReasons ensures that orphans leaving the orphan pool are
+// reported as evicted with the reason they were removed for, and that orphans
+// accepted to the main pool are not reported.
+func TestOrphanEvictionReasons(t *testing.T) {
+	t.Parallel()
+
+	harness, spendableOuts, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	harness.txPool.cfg.Policy.MaxOrphanTxs = 2
+	evicted := make(map[chainhash.Hash]OrphanEvictionReason)
+	harness.txPool.SetOnOrphanEvicted(func(tx *btcutil.Tx, reason OrphanEvictionReason) {
+		evicted[*tx.Hash()] = reason
+	})
+
+	chainedTxns, err := harness.CreateTxChain(spendableOuts[0], 3)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	var unknownParentTxns []*btcutil.Tx
+	for i := uint32(0); i < 3; i++ {
+		tx, err := harness.CreateSignedTx([]spendableOutput{{
+			amount:   btcutil.Amount(5000000000),
+			outPoint: wire.OutPoint{Hash: chainhash.Hash{}, Index: i},
+		}}, 1, 0, false)
+		if err != nil {
+			t.Fatalf("unable to create signed tx: %v", err)
+		}
+		unknownParentTxns = append(unknownParentTxns, tx)
+	}
+	processOrphans := func(txns []*btcutil.Tx) {
+		for _, tx := range txns {
+			_, err := harness.txPool.ProcessTransaction(tx, true, false, 0)
+			if err != nil {
+				t.Fatalf("ProcessTransaction: failed to accept valid "+
+					"orphan %v", err)
+			}
+		}
+	}
+
+	// Orphans accepted once their parent arrives are not evicted.
+	processOrphans(chainedTxns[1:])
+	if count := harness.txPool.OrphanCount(); count != 2 {
+		t.Fatalf("OrphanCount: got %d, want 2", count)
+	}
+	processOrphans(chainedTxns[:1])
+	if count := harness.txPool.OrphanCount(); count != 0 {
+		t.Fatalf("OrphanCount: got %d, want 0", count)
+	}
+	if len(evicted) != 0 {
+		t.Fatalf("accepted orphans reported as evicted: %v", evicted)
+	}
+
+	// Filling the orphan pool evicts a random orphan to make room for the
+	// new one.
+	processOrphans(unknownParentTxns)
+	if len(evicted) != 1 {
+		t.Fatalf("got %d evicted orphans, want 1", len(evicted))
+	}
+	for hash, reason := range evicted {
+		if reason != OrphanPoolFull {
+			t.Fatalf("orphan %v evicted for %q, want %q", hash,
+				reason, OrphanPoolFull)
+		}
+	}
+
+	// Removing the orphans by tag reports them as removed.
+	remaining := harness.txPool.OrphanCount()
+	clear(evicted)
+	harness.txPool.RemoveOrphansByTag(0)
+	if len(evicted) != remaining {
+		t.Fatalf("got %d evicted orphans, want %d", len(evicted),
+			remaining)
+	}
+	for hash, reason := range evicted {
+		if reason != OrphanRemoved {
+			t.Fatalf("orphan %v evicted for %q, want %q", hash,
+				reason, OrphanRemoved)
+		}
+	}
+}
+
 // TestMultiInputOrphanDoubleSpend ensures that orphans that spend from an
 // output that is spend by another transaction entering the pool are removed.
 func TestMultiInputOrphanDoubleSpend(t *testing.T) {
@@ -931,6 +1015,56 @@ func TestCheckSpend(t *testing.T) {
 	}
 }
 
+// TestFetchTxFee tests that the fee of a transaction is computed from inputs
+// in both the main chain and the transaction pool, and is not known for
+// orphans.
+func TestFetchTxFee(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+
+	// The input of the transaction is in the main chain.
+	const fee = btcutil.Amount(1000)
+	tx, err := harness.CreateSignedTx(outputs[:1], 1, fee, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	gotFee, ok, err := harness.txPool.FetchTxFee(tx)
+	if err != nil || !ok || gotFee != int64(fee) {
+		t.Fatalf("FetchTxFee: got fee %d (found %v, err %v), want %d",
+			gotFee, ok, err, fee)
+	}
+
+	// The input of the second transaction of a chain spending it is in the
+	// transaction pool once the first is accepted, and unknown before.
+	_, err = harness.txPool.ProcessTransaction(tx, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept tx: %v", err)
+	}
+	chainedTxns, err := harness.CreateTxChain(txOutToSpendableOut(tx, 0), 2)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	_, ok, err = harness.txPool.FetchTxFee(chainedTxns[1])
+	if err != nil || ok {
+		t.Fatalf("FetchTxFee: found fee of orphan (err %v)", err)
+	}
+
+	_, err = harness.txPool.ProcessTransaction(chainedTxns[0], false,
+		false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept tx: %v", err)
+	}
+	gotFee, ok, err = harness.txPool.FetchTxFee(chainedTxns[1])
+	if err != nil || !ok || gotFee != 0 {
+		t.Fatalf("FetchTxFee: got fee %d (found %v, err %v), want 0",
+			gotFee, ok, err)
+	}
+}
+
 // TestSignalsReplacement tests that transactions properly signal they can be
 // replaced using RBF.
 func TestSignalsReplacement(t *testing.T) {
@@ -1452,6 +1586,363 @@ func TestAncestorsDescendants(t *testing.T) {
 	}
 }
 
+// TestAncestorLimits ensures that transactions exceeding the ancestor limits
+// of the mempool policy are rejected, and that the ancestor and descendant
+// statistics of the accepted transactions are reported.
+func TestAncestorLimits(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	harness.txPool.cfg.Policy.MaxAncestorCount = 3
+
+	// A fee paying parent is spent by a chain of three zero-fee
+	// transactions, of which the last one exceeds the ancestor count.
+	const fee = btcutil.Amount(1000)
+	parent := ctx.addSignedTx(outputs[:1], 1, fee, false, false)
+	chainedTxns, err := harness.CreateTxChain(
+		txOutToSpendableOut(parent, 0), 3,
+	)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	for _, tx := range chainedTxns[:2] {
+		_, err := harness.txPool.ProcessTransaction(tx, false, false, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept tx: %v",
+				err)
+		}
+	}
+	_, err = harness.txPool.ProcessTransaction(chainedTxns[2], false,
+		false, 0)
+	if err == nil || !strings.Contains(err.Error(), "too many unconfirmed ancestors") {
+		t.Fatalf("ProcessTransaction: accepted tx exceeding the "+
+			"ancestor count (err %v)", err)
+	}
+	testPoolMembership(ctx, chainedTxns[2], false, false)
+
+	// The middle transaction of the accepted chain has one ancestor and
+	// one descendant, and the fees of the parent are only counted for its
+	// ancestors.
+	entry, err := harness.txPool.MempoolEntry(chainedTxns[0].Hash())
+	if err != nil {
+		t.Fatalf("MempoolEntry: %v", err)
+	}
+	if entry.AncestorCount != 2 || entry.DescendantCount != 2 {
+		t.Fatalf("MempoolEntry: got %d ancestors and %d descendants, "+
+			"want 2 and 2", entry.AncestorCount,
+			entry.DescendantCount)
+	}
+	if entry.AncestorFees != float64(fee) || entry.DescendantFees != 0 {
+		t.Fatalf("MempoolEntry: got ancestor fees %v and descendant "+
+			"fees %v, want %v and 0", entry.AncestorFees,
+			entry.DescendantFees, float64(fee))
+	}
+	wantDepends := []string{parent.Hash().String()}
+	if !reflect.DeepEqual(entry.Depends, wantDepends) {
+		t.Fatalf("MempoolEntry: got depends %v, want %v",
+			entry.Depends, wantDepends)
+	}
+	if _, err := harness.txPool.MempoolEntry(chainedTxns[2].Hash()); err == nil {
+		t.Fatalf("MempoolEntry: found rejected transaction")
+	}
+
+	// The ancestor size is limited as well.
+	harness.txPool.cfg.Policy.MaxAncestorCount = 0
+	harness.txPool.cfg.Policy.MaxAncestorSize = entry.AncestorSize
+	_, err = harness.txPool.ProcessTransaction(chainedTxns[2], false,
+		false, 0)
+	if err == nil || !strings.Contains(err.Error(), "too large unconfirmed ancestors") {
+		t.Fatalf("ProcessTransaction: accepted tx exceeding the "+
+			"ancestor size (err %v)", err)
+	}
+}
+
+// TestMempoolFamily ensures that the entries of a chain of unconfirmed
+// transactions report their parents and children, that their ancestors and
+// descendants are returned, and that they stay consistent while the chain is
+// mutated.
+func TestMempoolFamily(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+
+	// We'll be creating a chain of three generations where B spends both
+	// outputs of A and C spends B.
+	a := ctx.addSignedTx(outputs[:1], 2, 1000, false, false)
+	b := ctx.addSignedTx([]spendableOutput{
+		txOutToSpendableOut(a, 0), txOutToSpendableOut(a, 1),
+	}, 1, 2000, false, false)
+	c := ctx.addSignedTx([]spendableOutput{
+		txOutToSpendableOut(b, 0),
+	}, 1, 3000, false, false)
+
+	// The entry of B depends on A once and is spent by C.
+	entry, err := harness.txPool.MempoolEntry(b.Hash())
+	if err != nil {
+		t.Fatalf("MempoolEntry: %v", err)
+	}
+	wantDepends := []string{a.Hash().String()}
+	if !reflect.DeepEqual(entry.Depends, wantDepends) {
+		t.Fatalf("MempoolEntry: got depends %v, want %v",
+			entry.Depends, wantDepends)
+	}
+	wantSpentBy := []string{c.Hash().String()}
+	if !reflect.DeepEqual(entry.SpentBy, wantSpentBy) {
+		t.Fatalf("MempoolEntry: got spentby %v, want %v",
+			entry.SpentBy, wantSpentBy)
+	}
+	if entry.AncestorFees != 3000 || entry.DescendantFees != 5000 {
+		t.Fatalf("MempoolEntry: got ancestor fees %v and descendant "+
+			"fees %v, want 3000 and 5000", entry.AncestorFees,
+			entry.DescendantFees)
+	}
+	entry, err = harness.txPool.MempoolEntry(c.Hash())
+	if err != nil {
+		t.Fatalf("MempoolEntry: %v", err)
+	}
+	if len(entry.SpentBy) != 0 {
+		t.Fatalf("MempoolEntry: got spentby %v for the last "+
+			"transaction of the chain", entry.SpentBy)
+	}
+
+	// The ancestors of C are A and B, and the descendants of A are B and C,
+	// each with their own entry.
+	ancestors, err := harness.txPool.MempoolAncestors(c.Hash())
+	if err != nil {
+		t.Fatalf("MempoolAncestors: %v", err)
+	}
+	if len(ancestors) != 2 || ancestors[a.Hash().String()] == nil ||
+		ancestors[b.Hash().String()] == nil {
+
+		t.Fatalf("MempoolAncestors: got %v, want A and B", ancestors)
+	}
+	if ancestors[a.Hash().String()].DescendantCount != 3 {
+		t.Fatalf("MempoolAncestors: got %d descendants for A, want 3",
+			ancestors[a.Hash().String()].DescendantCount)
+	}
+	descendants, err := harness.txPool.MempoolDescendants(a.Hash())
+	if err != nil {
+		t.Fatalf("MempoolDescendants: %v", err)
+	}
+	if len(descendants) != 2 || descendants[b.Hash().String()] == nil ||
+		descendants[c.Hash().String()] == nil {
+
+		t.Fatalf("MempoolDescendants: got %v, want B and C",
+			descendants)
+	}
+	if descendants[c.Hash().String()].AncestorCount != 3 {
+		t.Fatalf("MempoolDescendants: got %d ancestors for C, want 3",
+			descendants[c.Hash().String()].AncestorCount)
+	}
+	if _, err := harness.txPool.MempoolDescendants(&chainhash.Hash{}); err == nil {
+		t.Fatalf("MempoolDescendants: found unknown transaction")
+	}
+
+	// The descendants returned while C is removed and added back all
+	// belong to the same state of the pool.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			harness.txPool.RemoveTransaction(c, false)
+			_, err := harness.txPool.ProcessTransaction(c, false,
+				false, 0)
+			if err != nil {
+				t.Errorf("ProcessTransaction: %v", err)
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		descendants, err := harness.txPool.MempoolDescendants(a.Hash())
+		if err != nil {
+			t.Fatalf("MempoolDescendants: %v", err)
+		}
+		entryB := descendants[b.Hash().String()]
+		if int(entryB.DescendantCount) != len(descendants) ||
+			len(entryB.SpentBy) != len(descendants)-1 {
+
+			t.Fatalf("MempoolDescendants: got %d descendants with "+
+				"B spent by %v and counting %d descendants",
+				len(descendants), entryB.SpentBy,
+				entryB.DescendantCount)
+		}
+	}
+}
+
+// TestPoolSizeLimit ensures that the transactions paying the lowest fee rates,
+// counting the fees of their descendants, are evicted once the pool exceeds
+// its maximum size, that the minimum fee rate of accepted transactions rises
+// above theirs, and that expired transactions are evicted.
+func TestPoolSizeLimit(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	evicted := make(map[chainhash.Hash]TxEvictionReason)
+	harness.txPool.SetOnTxEvicted(func(tx *btcutil.Tx, reason TxEvictionReason) {
+		evicted[*tx.Hash()] = reason
+	})
+
+	// The cheapest transaction has no descendants, while the parent paying
+	// even less fees is bumped by its child.
+	coinbase := ctx.addCoinbaseTx(5)
+	cheapest := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 0)}, 1, 1000,
+		false, false,
+	)
+	parent := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 1)}, 1, 500,
+		false, false,
+	)
+	child := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(parent, 0)}, 1, 10000,
+		false, false,
+	)
+	ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 2)}, 1, 3000,
+		false, false,
+	)
+	if rate := harness.txPool.MinFeeRate(); rate != 1000 {
+		t.Fatalf("MinFeeRate: got %v, want the min relay fee", rate)
+	}
+
+	// The pool is full once it holds these transactions, leaving some
+	// slack for the different sizes of signatures.
+	harness.txPool.cfg.Policy.MaxPoolSize = harness.txPool.poolSize + 10
+	ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 3)}, 1, 5000,
+		false, false,
+	)
+	testPoolMembership(ctx, cheapest, false, false)
+	testPoolMembership(ctx, parent, false, true)
+	testPoolMembership(ctx, child, false, true)
+	wantEvicted := map[chainhash.Hash]TxEvictionReason{
+		*cheapest.Hash(): TxPoolFull,
+	}
+	if !reflect.DeepEqual(evicted, wantEvicted) {
+		t.Fatalf("evicted: got %v, want %v", evicted, wantEvicted)
+	}
+
+	// The min fee rate rose above the fee rate of the evicted transaction,
+	// so that it is rejected when relayed again.
+	cheapestRate := btcutil.Amount(1000 * 1000 / GetTxVirtualSize(cheapest))
+	if rate := harness.txPool.MinFeeRate(); rate <= cheapestRate {
+		t.Fatalf("MinFeeRate: got %v, want above %v", rate,
+			cheapestRate)
+	}
+	_, err = harness.txPool.ProcessTransaction(cheapest, false, false, 0)
+	if err == nil || !strings.Contains(err.Error(), "mempool min fee") {
+		t.Fatalf("ProcessTransaction: accepted tx under the mempool "+
+			"min fee (err %v)", err)
+	}
+
+	// Expired transactions are evicted along with their descendants.
+	clear(evicted)
+	count := harness.txPool.Expire(time.Now().Add(time.Second))
+	if count != 4 || harness.txPool.Count() != 0 {
+		t.Fatalf("Expire: evicted %d transactions, %d left in pool",
+			count, harness.txPool.Count())
+	}
+	if evicted[*child.Hash()] != TxExpired {
+		t.Fatalf("Expire: child evicted with reason %q",
+			evicted[*child.Hash()])
+	}
+	if harness.txPool.poolSize != 0 {
+		t.Fatalf("poolSize: got %d for empty pool",
+			harness.txPool.poolSize)
+	}
+}
+
+// TestDoubleSpends ensures that transactions conflicting with the mempool are
+// reported when they are rejected with valid scripts or confirmed in a block.
+func TestDoubleSpends(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	coinbase := ctx.addCoinbaseTx(2)
+	outputs := []spendableOutput{
+		txOutToSpendableOut(coinbase, 0),
+		txOutToSpendableOut(coinbase, 1),
+	}
+
+	var doubleSpends []*DoubleSpend
+	harness.txPool.SetOnDoubleSpend(func(doubleSpend *DoubleSpend) {
+		doubleSpends = append(doubleSpends, doubleSpend)
+	})
+
+	// A transaction spending the output of a non-signaling pool transaction
+	// along with another output is rejected and reported.
+	const fee = btcutil.Amount(1000)
+	conflict := ctx.addSignedTx(outputs[:1], 1, fee, false, false)
+	tx, err := harness.CreateSignedTx(outputs[:2], 1, fee*10, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	if _, err := harness.txPool.ProcessTransaction(tx, false, false, 0); err == nil {
+		t.Fatalf("ProcessTransaction: accepted double spend")
+	}
+	testPoolMembership(ctx, tx, false, false)
+	if len(doubleSpends) != 1 {
+		t.Fatalf("got %d double spends, want 1", len(doubleSpends))
+	}
+	want := &DoubleSpend{
+		Tx:        tx,
+		Conflict:  conflict,
+		OutPoints: []wire.OutPoint{outputs[0].outPoint},
+	}
+	if !reflect.DeepEqual(doubleSpends[0], want) {
+		t.Fatalf("got double spend %v, want %v", doubleSpends[0], want)
+	}
+
+	// A transaction with invalid scripts is not reported.
+	invalid, err := harness.CreateSignedTx(outputs[:1], 1, fee*10, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	msgTx := invalid.MsgTx().Copy()
+	msgTx.TxOut[0].Value--
+	invalid = btcutil.NewTx(msgTx)
+	if _, err := harness.txPool.ProcessTransaction(invalid, false, false, 0); err == nil {
+		t.Fatalf("ProcessTransaction: accepted double spend")
+	}
+	if len(doubleSpends) != 1 {
+		t.Fatalf("got %d double spends, want 1", len(doubleSpends))
+	}
+
+	// A confirmed transaction is reported and evicts its conflict.
+	harness.txPool.RemoveDoubleSpends(tx)
+	if len(doubleSpends) != 2 {
+		t.Fatalf("got %d double spends, want 2", len(doubleSpends))
+	}
+	want.Confirmed = true
+	if !reflect.DeepEqual(doubleSpends[1], want) {
+		t.Fatalf("got double spend %v, want %v", doubleSpends[1], want)
+	}
+	testPoolMembership(ctx, conflict, false, false)
+}
+
 // TestRBF tests the different cases required for a transaction to properly
 // replace its conflicts given that they all signal replacement.
 func TestRBF(t *testing.T) {
@@ -1790,6 +2281,168 @@ func TestRBF(t *testing.T) {
 			},
 			err: "",
 		},
+		{
+			// A transaction can replace another that doesn't
+			// signal replacement, along with its descendants, if
+			// we accept full replacement.
+			name: "full replacement policy",
+			setup: func(ctx *testContext) (*btcutil.Tx, []*btcutil.Tx) {
+				ctx.harness.txPool.cfg.Policy.FullRBF = true
+
+				coinbase := ctx.addCoinbaseTx(1)
+
+				// Create a transaction that spends the coinbase
+				// output and doesn't signal for replacement,
+				// along with a descendant.
+				coinbaseOut := txOutToSpendableOut(coinbase, 0)
+				outs := []spendableOutput{coinbaseOut}
+				parent := ctx.addSignedTx(
+					outs, 1, defaultFee, false, false,
+				)
+				parentOut := txOutToSpendableOut(parent, 0)
+				outs = []spendableOutput{parentOut}
+				child := ctx.addSignedTx(
+					outs, 1, defaultFee, false, false,
+				)
+
+				outs = []spendableOutput{coinbaseOut}
+				tx, err := ctx.harness.CreateSignedTx(
+					outs, 1, defaultFee*3, false,
+				)
+				if err != nil {
+					ctx.t.Fatalf("unable to create "+
+						"transaction: %v", err)
+				}
+
+				return tx, []*btcutil.Tx{parent, child}
+			},
+			err: "",
+		},
+		{
+			// A transaction cannot replace another, even under
+			// the full replacement policy, if we don't allow
+			// accepting replacement transactions.
+			name: "full replacement with reject replacement policy",
+			setup: func(ctx *testContext) (*btcutil.Tx, []*btcutil.Tx) {
+				ctx.harness.txPool.cfg.Policy.FullRBF = true
+				ctx.harness.txPool.cfg.Policy.RejectReplacement = true
+
+				coinbase := ctx.addCoinbaseTx(1)
+				coinbaseOut := txOutToSpendableOut(coinbase, 0)
+				outs := []spendableOutput{coinbaseOut}
+				parent := ctx.addSignedTx(
+					outs, 1, defaultFee, true, false,
+				)
+
+				tx, err := ctx.harness.CreateSignedTx(
+					outs, 1, defaultFee*3, false,
+				)
+				if err != nil {
+					ctx.t.Fatalf("unable to create "+
+						"transaction: %v", err)
+				}
+
+				return tx, []*btcutil.Tx{parent}
+			},
+			err: "already spent in mempool",
+		},
+		{
+			// A replacement must pay for its own bandwidth at the
+			// incremental relay fee rate on top of the fees of the
+			// transactions it replaces.
+			name: "insufficient incremental relay fee",
+			setup: func(ctx *testContext) (*btcutil.Tx, []*btcutil.Tx) {
+				ctx.harness.txPool.cfg.Policy.IncrementalRelayFee =
+					btcutil.SatoshiPerBitcoin * 10
+
+				coinbase := ctx.addCoinbaseTx(1)
+				coinbaseOut := txOutToSpendableOut(coinbase, 0)
+				outs := []spendableOutput{coinbaseOut}
+				parent := ctx.addSignedTx(
+					outs, 1, defaultFee, true, false,
+				)
+
+				tx, err := ctx.harness.CreateSignedTx(
+					outs, 1, defaultFee*2, false,
+				)
+				if err != nil {
+					ctx.t.Fatalf("unable to create "+
+						"transaction: %v", err)
+				}
+
+				return tx, []*btcutil.Tx{parent}
+			},
+			err: "insufficient absolute fee",
+		},
+		{
+			// A replacement can itself be replaced, evicting the
+			// descendants it gained in the meantime.
+			name: "replacement chain",
+			setup: func(ctx *testContext) (*btcutil.Tx, []*btcutil.Tx) {
+				coinbase := ctx.addCoinbaseTx(1)
+				coinbaseOut := txOutToSpendableOut(coinbase, 0)
+				outs := []spendableOutput{coinbaseOut}
+				original := ctx.addSignedTx(
+					outs, 1, defaultFee, true, false,
+				)
+
+				// The first replacement signals replacement
+				// too, and gets a descendant.
+				replacement := ctx.addSignedTx(
+					outs, 1, defaultFee*2, true, false,
+				)
+				testPoolMembership(ctx, original, false, false)
+				replacementOut := txOutToSpendableOut(replacement, 0)
+				child := ctx.addSignedTx(
+					[]spendableOutput{replacementOut}, 1,
+					defaultFee, false, false,
+				)
+
+				// The second replacement must pay for both the
+				// first one and its descendant.
+				tx, err := ctx.harness.CreateSignedTx(
+					outs, 1, defaultFee*4, false,
+				)
+				if err != nil {
+					ctx.t.Fatalf("unable to create "+
+						"transaction: %v", err)
+				}
+
+				return tx, []*btcutil.Tx{replacement, child}
+			},
+			err: "",
+		},
+		{
+			// The descendants of the replaced transactions count
+			// towards the absolute fee the replacement must pay.
+			name: "insufficient fee for descendants",
+			setup: func(ctx *testContext) (*btcutil.Tx, []*btcutil.Tx) {
+				coinbase := ctx.addCoinbaseTx(1)
+				coinbaseOut := txOutToSpendableOut(coinbase, 0)
+				outs := []spendableOutput{coinbaseOut}
+				parent := ctx.addSignedTx(
+					outs, 1, defaultFee, true, false,
+				)
+				parentOut := txOutToSpendableOut(parent, 0)
+				child := ctx.addSignedTx(
+					[]spendableOutput{parentOut}, 1,
+					defaultFee, false, false,
+				)
+
+				// The replacement pays more than the parent,
+				// but less than the parent and child together.
+				tx, err := ctx.harness.CreateSignedTx(
+					outs, 1, defaultFee*3/2, false,
+				)
+				if err != nil {
+					ctx.t.Fatalf("unable to create "+
+						"transaction: %v", err)
+				}
+
+				return tx, []*btcutil.Tx{parent, child}
+			},
+			err: "insufficient absolute fee",
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -1813,6 +2466,19 @@ func TestRBF(t *testing.T) {
 			ctx := &testContext{t, harness}
 			replacementTx, replacedTxs := testCase.setup(ctx)
 
+			// Track the transactions evicted by the replacement,
+			// which include the descendants of its conflicts.
+			evicted := make(map[chainhash.Hash]struct{})
+			harness.txPool.SetOnTxReplaced(func(replaced,
+				replacement *btcutil.Tx) {
+
+				if replacement != replacementTx {
+					t.Fatalf("unexpected replacement %v",
+						replacement.Hash())
+				}
+				evicted[*replaced.Hash()] = struct{}{}
+			})
+
 			// Attempt to process the replacement transaction. If
 			// it's not a valid one, we should see the error
 			// expected by the test.
@@ -1843,6 +2509,15 @@ func TestRBF(t *testing.T) {
 			valid := testCase.err == ""
 			for _, tx := range replacedTxs {
 				testPoolMembership(ctx, tx, false, !valid)
+				if _, ok := evicted[*tx.Hash()]; ok != valid {
+					ctx.t.Fatalf("expected eviction of %v "+
+						"to be reported: %v", tx.Hash(),
+						valid)
+				}
+			}
+			if valid && len(evicted) != len(replacedTxs) {
+				ctx.t.Fatalf("expected %d evictions, got %d",
+					len(replacedTxs), len(evicted))
 			}
 			testPoolMembership(ctx, replacementTx, false, valid)
 		})
@@ -1851,3 +2526,86 @@ func TestRBF(t *testing.T) {
 		}
 	}
 }
+
+// TestWitnessHashInPool ensures the pool tells apart the versions of a
+// transaction differing by their witness by their witness hash.
+func TestWitnessHashInPool(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	harness.txPool.cfg.IsDeploymentActive = func(uint32) (bool, error) {
+		return true, nil
+	}
+	harness.txPool.cfg.HashCache = txscript.NewHashCache(10)
+
+	// Fund a pay-to-witness-pubkey-hash output of the signing key.
+	witnessAddr, err := btcutil.NewAddressWitnessPubKeyHash(
+		btcutil.Hash160(harness.signKey.PubKey().SerializeCompressed()),
+		harness.chainParams)
+	if err != nil {
+		t.Fatalf("unable to create witness address: %v", err)
+	}
+	witnessScript, err := txscript.PayToAddrScript(witnessAddr)
+	if err != nil {
+		t.Fatalf("unable to create witness script: %v", err)
+	}
+	funding, err := harness.CreateSignedTx(outputs, 1, 1000, false)
+	if err != nil {
+		t.Fatalf("unable to create funding transaction: %v", err)
+	}
+	funding.MsgTx().TxOut[0].PkScript = witnessScript
+	funding = btcutil.NewTx(funding.MsgTx())
+	harness.chain.utxos.AddTxOuts(funding, harness.chain.BestHeight()+1)
+	prevOut := funding.MsgTx().TxOut[0]
+
+	// Spend it twice, signing with different hash types, which changes the
+	// witness but not the txid.
+	spend := func(hashType txscript.SigHashType) *btcutil.Tx {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(funding.Hash(), 0), nil, nil))
+		tx.AddTxOut(wire.NewTxOut(prevOut.Value-1000, harness.payScript))
+		fetcher := txscript.NewCannedPrevOutputFetcher(prevOut.PkScript, prevOut.Value)
+		witness, err := txscript.WitnessSignature(tx,
+			txscript.NewTxSigHashes(tx, fetcher), 0, prevOut.Value,
+			prevOut.PkScript, hashType, harness.signKey, true)
+		if err != nil {
+			t.Fatalf("unable to sign transaction: %v", err)
+		}
+		tx.TxIn[0].Witness = witness
+		return btcutil.NewTx(tx)
+	}
+	first := spend(txscript.SigHashAll)
+	second := spend(txscript.SigHashAll | txscript.SigHashAnyOneCanPay)
+	if *first.Hash() != *second.Hash() {
+		t.Fatalf("versions have different txids %v and %v",
+			first.Hash(), second.Hash())
+	}
+	if *first.WitnessHash() == *second.WitnessHash() {
+		t.Fatalf("versions have the same wtxid %v", first.WitnessHash())
+	}
+
+	// Only the version in the pool is known by its witness hash, while both
+	// are known by their txid.
+	_, err = harness.txPool.ProcessTransaction(first, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+	}
+	if !harness.txPool.HaveTransaction(second.Hash()) {
+		t.Fatal("HaveTransaction: transaction not found by txid")
+	}
+	if !harness.txPool.IsWitnessHashInPool(first.WitnessHash()) {
+		t.Fatal("IsWitnessHashInPool: pool version not found")
+	}
+	if harness.txPool.IsWitnessHashInPool(second.WitnessHash()) {
+		t.Fatal("IsWitnessHashInPool: other version found")
+	}
+
+	// The witness hash leaves the pool along with the transaction.
+	harness.txPool.RemoveTransaction(first, false)
+	if harness.txPool.IsWitnessHashInPool(first.WitnessHash()) {
+		t.Fatal("IsWitnessHashInPool: removed transaction found")
+	}
+}
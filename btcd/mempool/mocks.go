@@ -40,6 +40,48 @@ func (m *MockTxMempool) RawMempoolVerbose() map[string]*btcjson.
 	return args.Get(0).(map[string]*btcjson.GetRawMempoolVerboseResult)
 }
 
+// MempoolEntry returns the transaction with the passed hash in the main pool
+// as a fully populated btcjson result.
+func (m *MockTxMempool) MempoolEntry(
+	hash *chainhash.Hash) (*btcjson.GetMempoolEntryResult, error) {
+
+	args := m.Called(hash)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*btcjson.GetMempoolEntryResult), args.Error(1)
+}
+
+// MempoolAncestors returns the unconfirmed ancestors of the transaction with
+// the passed hash in the main pool as fully populated btcjson results.
+func (m *MockTxMempool) MempoolAncestors(
+	hash *chainhash.Hash) (map[string]*btcjson.GetMempoolEntryResult, error) {
+
+	args := m.Called(hash)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(map[string]*btcjson.GetMempoolEntryResult), args.Error(1)
+}
+
+// MempoolDescendants returns the unconfirmed descendants of the transaction
+// with the passed hash in the main pool as fully populated btcjson results.
+func (m *MockTxMempool) MempoolDescendants(
+	hash *chainhash.Hash) (map[string]*btcjson.GetMempoolEntryResult, error) {
+
+	args := m.Called(hash)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(map[string]*btcjson.GetMempoolEntryResult), args.Error(1)
+}
+
 // Count returns the number of transactions in the main pool. It does not
 // include the orphan pool.
 func (m *MockTxMempool) Count() int {
@@ -47,6 +89,12 @@ func (m *MockTxMempool) Count() int {
 	return args.Get(0).(int)
 }
 
+// OrphanCount returns the number of transactions in the orphan pool.
+func (m *MockTxMempool) OrphanCount() int {
+	args := m.Called()
+	return args.Get(0).(int)
+}
+
 // FetchTransaction returns the requested transaction from the transaction
 // pool. This only fetches from the main transaction pool and does not include
 // orphans.
@@ -123,3 +171,10 @@ func (m *MockTxMempool) CheckSpend(op wire.OutPoint) *btcutil.Tx {
 
 	return args.Get(0).(*btcutil.Tx)
 }
+
+// MinFeeRate returns the minimum fee rate in Satoshi/kB of transactions
+// accepted to the pool.
+func (m *MockTxMempool) MinFeeRate() btcutil.Amount {
+	args := m.Called()
+	return args.Get(0).(btcutil.Amount)
+}
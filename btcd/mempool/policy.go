@@ -49,6 +49,11 @@ const (
 	// for larger transactions.  This value is in Satoshi/1000 bytes.
 	DefaultMinRelayTxFee = btcutil.Amount(1000)
 
+	// DefaultIncrementalRelayFee is the minimum fee in satoshi per 1000
+	// bytes that a replacement transaction must pay for its own bandwidth
+	// on top of the fees of the transactions it replaces.
+	DefaultIncrementalRelayFee = btcutil.Amount(1000)
+
 	// maxStandardMultiSigKeys is the maximum number of public keys allowed
 	// in a multi-signature transaction output script for it to be
 	// considered standard.
@@ -275,16 +280,47 @@ func IsDust(txOut *wire.TxOut, minRelayTxFee btcutil.Amount) bool {
 	return txOut.Value*1000/GetDustThreshold(txOut) < int64(minRelayTxFee)
 }
 
+// checkDataCarriers checks that the passed transaction has no outputs which
+// only carry data (OP_RETURN) unless acceptDataCarrier is true, and that the
+// data they push is at most maxDataCarrierSize bytes in total.
+func checkDataCarriers(tx *btcutil.Tx, acceptDataCarrier bool,
+	maxDataCarrierSize int) error {
+
+	dataSize := 0
+	for i, txOut := range tx.MsgTx().TxOut {
+		data, ok := txscript.ExtractNullData(txOut.PkScript)
+		if !ok {
+			continue
+		}
+		if !acceptDataCarrier {
+			str := fmt.Sprintf("transaction output %d: data carrier "+
+				"outputs are not accepted", i)
+			return txRuleError(wire.RejectNonstandard, str)
+		}
+		dataSize += len(data)
+	}
+
+	if dataSize > maxDataCarrierSize {
+		str := fmt.Sprintf("data carrier size %d is larger than max "+
+			"allowed size %d", dataSize, maxDataCarrierSize)
+		return txRuleError(wire.RejectNonstandard, str)
+	}
+	return nil
+}
+
 // CheckTransactionStandard performs a series of checks on a transaction to
 // ensure it is a "standard" transaction.  A standard transaction is one that
 // conforms to several additional limiting cases over what is considered a
 // "sane" transaction such as having a version in the supported range, being
 // finalized, conforming to more stringent size constraints, having scripts
-// of recognized forms, and not containing "dust" outputs (those that are
-// so small it costs more to process them than they are worth).
+// of recognized forms, not containing "dust" outputs (those that are so small
+// it costs more to process them than they are worth), and carrying at most
+// maxDataCarrierSize bytes of data in a null data output, if
+// acceptDataCarrier allows one at all.
 func CheckTransactionStandard(tx *btcutil.Tx, height int32,
 	medianTimePast time.Time, minRelayTxFee btcutil.Amount,
-	maxTxVersion int32) error {
+	maxTxVersion int32, acceptDataCarrier bool,
+	maxDataCarrierSize int) error {
 
 	// The transaction must be a currently supported version.
 	msgTx := tx.MsgTx()
@@ -335,10 +371,23 @@ func CheckTransactionStandard(tx *btcutil.Tx, height int32,
 		}
 	}
 
+	// Outputs which only carry data are standard up to the data carrier
+	// size of the policy, which may exceed the MaxDataCarrierSize of the
+	// null data script class.
+	err := checkDataCarriers(tx, acceptDataCarrier, maxDataCarrierSize)
+	if err != nil {
+		return err
+	}
+
 	// None of the output public key scripts can be a non-standard script or
 	// be "dust" (except when the script is a null data script).
 	numNullDataOutputs := 0
 	for i, txOut := range msgTx.TxOut {
+		if _, ok := txscript.ExtractNullData(txOut.PkScript); ok {
+			numNullDataOutputs++
+			continue
+		}
+
 		scriptClass := txscript.GetScriptClass(txOut.PkScript)
 		err := checkPkScriptStandard(txOut.PkScript, scriptClass)
 		if err != nil {
@@ -353,12 +402,8 @@ func CheckTransactionStandard(tx *btcutil.Tx, height int32,
 			return txRuleError(rejectCode, str)
 		}
 
-		// Accumulate the number of outputs which only carry data.  For
-		// all other script types, ensure the output value is not
-		// "dust".
-		if scriptClass == txscript.NullDataTy {
-			numNullDataOutputs++
-		} else if IsDust(txOut, minRelayTxFee) {
+		// Ensure the output value is not "dust".
+		if IsDust(txOut, minRelayTxFee) {
 			str := fmt.Sprintf("transaction output %d: payment is "+
 				"dust: %v", i, txOut.Value)
 			return txRuleError(wire.RejectDust, str)
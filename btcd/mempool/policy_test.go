@@ -468,7 +468,8 @@ func TestCheckTransactionStandard(t *testing.T) {
 	for _, test := range tests {
 		// Ensure standardness is as expected.
 		err := CheckTransactionStandard(btcutil.NewTx(&test.tx),
-			test.height, pastMedianTime, DefaultMinRelayTxFee, 1)
+			test.height, pastMedianTime, DefaultMinRelayTxFee, 1, true,
+			DefaultMaxDataCarrierSize)
 		if err == nil && test.isStandard {
 			// Test passes since function returned standard for a
 			// transaction which is intended to be standard.
@@ -508,3 +509,88 @@ func TestCheckTransactionStandard(t *testing.T) {
 		}
 	}
 }
+
+// TestCheckTransactionStandardDataCarrier tests the data carrier policy of
+// CheckTransactionStandard.
+func TestCheckTransactionStandardDataCarrier(t *testing.T) {
+	prevOutHash, err := chainhash.NewHashFromStr("01")
+	if err != nil {
+		t.Fatalf("NewShaHashFromStr: unexpected error: %v", err)
+	}
+	dummyTxIn := wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: *prevOutHash, Index: 1},
+		SignatureScript:  bytes.Repeat([]byte{0x00}, 65),
+		Sequence:         wire.MaxTxInSequenceNum,
+	}
+	nullData := func(size int) *wire.TxOut {
+		pkScript, err := txscript.NewScriptBuilder().
+			AddOp(txscript.OP_RETURN).
+			AddData(bytes.Repeat([]byte{0x01}, size)).
+			Script()
+		if err != nil {
+			t.Fatalf("unable to build null data script: %v", err)
+		}
+		return wire.NewTxOut(0, pkScript)
+	}
+
+	tests := []struct {
+		name       string
+		txOuts     []*wire.TxOut
+		accept     bool
+		maxSize    int
+		isStandard bool
+	}{
+		{
+			name:       "data at the default limit",
+			txOuts:     []*wire.TxOut{nullData(DefaultMaxDataCarrierSize)},
+			accept:     true,
+			maxSize:    DefaultMaxDataCarrierSize,
+			isStandard: true,
+		},
+		{
+			name:    "data one byte over the default limit",
+			txOuts:  []*wire.TxOut{nullData(DefaultMaxDataCarrierSize + 1)},
+			accept:  true,
+			maxSize: DefaultMaxDataCarrierSize,
+		},
+		{
+			name:       "data at a limit over the default",
+			txOuts:     []*wire.TxOut{nullData(500)},
+			accept:     true,
+			maxSize:    500,
+			isStandard: true,
+		},
+		{
+			name:    "data one byte over a limit under the default",
+			txOuts:  []*wire.TxOut{nullData(11)},
+			accept:  true,
+			maxSize: 10,
+		},
+		{
+			name:    "data carriers not accepted",
+			txOuts:  []*wire.TxOut{{PkScript: []byte{txscript.OP_RETURN}}},
+			maxSize: DefaultMaxDataCarrierSize,
+		},
+		{
+			name:    "two data carriers within the limit",
+			txOuts:  []*wire.TxOut{nullData(10), nullData(10)},
+			accept:  true,
+			maxSize: DefaultMaxDataCarrierSize,
+		},
+	}
+
+	for _, test := range tests {
+		tx := wire.MsgTx{
+			Version: 1,
+			TxIn:    []*wire.TxIn{&dummyTxIn},
+			TxOut:   test.txOuts,
+		}
+		err := CheckTransactionStandard(btcutil.NewTx(&tx), 300000,
+			time.Now(), DefaultMinRelayTxFee, 1, test.accept,
+			test.maxSize)
+		if (err == nil) != test.isStandard {
+			t.Errorf("%s: got error %v, want standard %v", test.name,
+				err, test.isStandard)
+		}
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"bytes"
 	"container/heap"
 	"fmt"
+	"maps"
+	"sort"
 	"time"
 
 	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
@@ -81,11 +83,18 @@ type txPrioItem struct {
 	priority float64
 	feePerKB int64
 
+	// weight is the weight of the transaction.
+	weight int64
+
 	// dependsOn holds a map of transaction hashes which this one depends
 	// on.  It will only be set when the transaction references other
 	// transactions in the source pool and hence must come after them in
 	// a block.
 	dependsOn map[chainhash.Hash]struct{}
+
+	// parents holds the same transaction hashes as dependsOn, but is not
+	// updated as they are added to the block.
+	parents map[chainhash.Hash]struct{}
 }
 
 // txPriorityQueueLessFunc describes a function that can be used as a compare
@@ -219,6 +228,175 @@ type BlockTemplate struct {
 	WitnessCommitment []byte
 }
 
+// txPackage houses a transaction along with its ancestors in the source pool
+// which are not in the block being generated yet.  Transactions are selected
+// by the fee rate of their package so that a child paying a high fee can bring
+// its low fee parents into the block, which is known as child-pays-for-parent.
+type txPackage struct {
+	item      *txPrioItem
+	ancestors map[chainhash.Hash]*txPrioItem
+
+	// fee, size and weight are the total fee, virtual size and weight of
+	// the transaction and its ancestors.
+	fee    int64
+	size   int64
+	weight int64
+
+	// skipped is set once the package is skipped because it doesn't fit
+	// in the block.  Its ancestors may still be selected in other
+	// packages.
+	skipped bool
+}
+
+// newTxPackage returns a package holding only the passed transaction.
+func newTxPackage(item *txPrioItem) *txPackage {
+	return &txPackage{
+		item:      item,
+		ancestors: make(map[chainhash.Hash]*txPrioItem),
+		fee:       item.fee,
+		size:      virtualSize(item.weight),
+		weight:    item.weight,
+	}
+}
+
+// virtualSize returns the virtual size of a transaction with the passed
+// weight.
+func virtualSize(weight int64) int64 {
+	return (weight + blockchain.WitnessScaleFactor - 1) / blockchain.WitnessScaleFactor
+}
+
+// addAncestors adds the ancestors of the transaction which are not included
+// in the block to the package.  It returns false if an ancestor is not one of
+// the candidates, in which case the transaction can't be included.
+func (p *txPackage) addAncestors(candidates map[chainhash.Hash]*txPrioItem,
+	included map[chainhash.Hash]struct{}) bool {
+
+	stack := []*txPrioItem{p.item}
+	for len(stack) > 0 {
+		item := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for parentHash := range item.parents {
+			if _, ok := included[parentHash]; ok {
+				continue
+			}
+			if _, ok := p.ancestors[parentHash]; ok {
+				continue
+			}
+			parent, ok := candidates[parentHash]
+			if !ok {
+				return false
+			}
+			p.ancestors[parentHash] = parent
+			p.fee += parent.fee
+			p.size += virtualSize(parent.weight)
+			p.weight += parent.weight
+			stack = append(stack, parent)
+		}
+	}
+	return true
+}
+
+// removeAncestor removes an ancestor which was included in the block from the
+// package.
+func (p *txPackage) removeAncestor(ancestor *txPrioItem) {
+	hash := *ancestor.tx.Hash()
+	if _, ok := p.ancestors[hash]; !ok {
+		return
+	}
+	delete(p.ancestors, hash)
+	p.fee -= ancestor.fee
+	p.size -= virtualSize(ancestor.weight)
+	p.weight -= ancestor.weight
+}
+
+// feePerKB returns the fee rate of the package in Satoshi per 1000 bytes.
+func (p *txPackage) feePerKB() int64 {
+	return p.fee * 1000 / p.size
+}
+
+// entry returns an entry of the package for a package queue.
+func (p *txPackage) entry() txPackageEntry {
+	return txPackageEntry{pkg: p, fee: p.fee, size: p.size}
+}
+
+// descendantPackages returns the packages of the transactions depending on
+// the passed transaction, directly or not.
+func descendantPackages(hash chainhash.Hash,
+	dependers map[chainhash.Hash]map[chainhash.Hash]*txPrioItem,
+	packages map[chainhash.Hash]*txPackage) []*txPackage {
+
+	var descendants []*txPackage
+	visited := make(map[chainhash.Hash]struct{})
+	stack := []chainhash.Hash{hash}
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for depHash := range dependers[hash] {
+			if _, ok := visited[depHash]; ok {
+				continue
+			}
+			visited[depHash] = struct{}{}
+			if pkg, ok := packages[depHash]; ok {
+				descendants = append(descendants, pkg)
+			}
+			stack = append(stack, depHash)
+		}
+	}
+	return descendants
+}
+
+// txPackageEntry is an entry of a package in a package queue.  It records the
+// fee and size of the package when it was queued, so that entries of packages
+// which have changed since then can be told apart.
+type txPackageEntry struct {
+	pkg  *txPackage
+	fee  int64
+	size int64
+}
+
+// stale returns whether the package changed since the entry was queued.
+func (e txPackageEntry) stale() bool {
+	return e.fee != e.pkg.fee || e.size != e.pkg.size
+}
+
+// txPackageQueue implements a priority queue of package entries ordered by
+// descending fee rate.
+type txPackageQueue []txPackageEntry
+
+// Len returns the number of entries in the queue.  It is part of the
+// heap.Interface implementation.
+func (pq txPackageQueue) Len() int {
+	return len(pq)
+}
+
+// Less returns whether the entry at index i has a higher fee rate than the
+// entry at index j.  It is part of the heap.Interface implementation.
+func (pq txPackageQueue) Less(i, j int) bool {
+	return float64(pq[i].fee)/float64(pq[i].size) >
+		float64(pq[j].fee)/float64(pq[j].size)
+}
+
+// Swap swaps the entries at the passed indices.  It is part of the
+// heap.Interface implementation.
+func (pq txPackageQueue) Swap(i, j int) {
+	pq[i], pq[j] = pq[j], pq[i]
+}
+
+// Push pushes the passed entry onto the queue.  It is part of the
+// heap.Interface implementation.
+func (pq *txPackageQueue) Push(x interface{}) {
+	*pq = append(*pq, x.(txPackageEntry))
+}
+
+// Pop removes the entry with the highest fee rate from the queue and returns
+// it.  It is part of the heap.Interface implementation.
+func (pq *txPackageQueue) Pop() interface{} {
+	n := len(*pq)
+	entry := (*pq)[n-1]
+	*pq = (*pq)[0 : n-1]
+	return entry
+}
+
 // mergeUtxoView adds all of the entries in viewB to viewA.  The result is that
 // viewA will contain all of its original entries plus all of the entries
 // in viewB.  It will replace any entries in viewB which also exist in viewA
@@ -237,20 +415,24 @@ func mergeUtxoView(viewA *blockchain.UtxoViewpoint, viewB *blockchain.UtxoViewpo
 // standardCoinbaseScript returns a standard script suitable for use as the
 // signature script of the coinbase transaction of a new block.  In particular,
 // it starts with the block height that is required by version 2 blocks and adds
-// the extra nonce as well as additional coinbase flags.
-func standardCoinbaseScript(nextBlockHeight int32, extraNonce uint64) ([]byte, error) {
-	return txscript.NewScriptBuilder().AddInt64(int64(nextBlockHeight)).
-		AddInt64(int64(extraNonce)).AddData([]byte(CoinbaseFlags)).
-		Script()
+// the extra nonce, the extra data if any, as well as additional coinbase flags.
+func standardCoinbaseScript(nextBlockHeight int32, extraNonce uint64, extraData []byte) ([]byte, error) {
+	builder := txscript.NewScriptBuilder().AddInt64(int64(nextBlockHeight)).
+		AddInt64(int64(extraNonce))
+	if len(extraData) > 0 {
+		builder.AddData(extraData)
+	}
+	return builder.AddData([]byte(CoinbaseFlags)).Script()
 }
 
 // createCoinbaseTx returns a coinbase transaction paying an appropriate subsidy
 // based on the passed block height to the provided address.  When the address
-// is nil, the coinbase transaction will instead be redeemable by anyone.
+// is nil, the coinbase transaction will instead be redeemable by anyone.  A
+// non-empty tag is pushed by an additional OP_RETURN output.
 //
 // See the comment for NewBlockTemplate for more information about why the nil
 // address handling is useful.
-func createCoinbaseTx(params *chaincfg.Params, coinbaseScript []byte, nextBlockHeight int32, addr btcutil.Address) (*btcutil.Tx, error) {
+func createCoinbaseTx(params *chaincfg.Params, coinbaseScript []byte, nextBlockHeight int32, addr btcutil.Address, tag []byte) (*btcutil.Tx, error) {
 	// Create the script to pay to the provided payment address if one was
 	// specified.  Otherwise create a script that allows the coinbase to be
 	// redeemable by anyone.
@@ -283,6 +465,13 @@ func createCoinbaseTx(params *chaincfg.Params, coinbaseScript []byte, nextBlockH
 		Value:    blockchain.CalcBlockSubsidy(nextBlockHeight, params),
 		PkScript: pkScript,
 	})
+	if len(tag) > 0 {
+		tagScript, err := txscript.NullDataScript(tag)
+		if err != nil {
+			return nil, err
+		}
+		tx.AddTxOut(wire.NewTxOut(0, tagScript))
+	}
 	return btcutil.NewTx(tx), nil
 }
 
@@ -322,18 +511,31 @@ func MinimumMedianTime(chainState *blockchain.BestState) time.Time {
 	return chainState.MedianTime.Add(time.Second)
 }
 
+// MinimumBlockTime returns the minimum allowed timestamp for a block building
+// on the end of the provided best chain.  On networks with monotonic
+// timestamps, it is the timestamp of the best block, and otherwise it is
+// MinimumMedianTime.
+func MinimumBlockTime(chainState *blockchain.BestState, params *chaincfg.Params) time.Time {
+	if params.MonotonicTimestamps {
+		return chainState.Timestamp
+	}
+	return MinimumMedianTime(chainState)
+}
+
 // medianAdjustedTime returns the current time adjusted to ensure it is at least
-// one second after the median timestamp of the last several blocks per the
-// chain consensus rules.
-func medianAdjustedTime(chainState *blockchain.BestState, timeSource blockchain.MedianTimeSource) time.Time {
+// the minimum allowed timestamp per the chain consensus rules.
+func medianAdjustedTime(chainState *blockchain.BestState, params *chaincfg.Params,
+	timeSource blockchain.MedianTimeSource) time.Time {
+
 	// The timestamp for the block must not be before the median timestamp
-	// of the last several blocks.  Thus, choose the maximum between the
-	// current time and one second after the past median time.  The current
+	// of the last several blocks, or the timestamp of the best block on
+	// networks with monotonic timestamps.  Thus, choose the maximum between
+	// the current time and the minimum allowed timestamp.  The current
 	// timestamp is truncated to a second boundary before comparison since a
 	// block timestamp does not supported a precision greater than one
 	// second.
 	newTimestamp := timeSource.AdjustedTime()
-	minTimestamp := MinimumMedianTime(chainState)
+	minTimestamp := MinimumBlockTime(chainState, params)
 	if newTimestamp.Before(minTimestamp) {
 		newTimestamp = minTimestamp
 	}
@@ -353,6 +555,7 @@ type BlkTmplGenerator struct {
 	timeSource  blockchain.MedianTimeSource
 	sigCache    *txscript.SigCache
 	hashCache   *txscript.HashCache
+	scriptCache *blockchain.ScriptCache
 }
 
 // NewBlkTmplGenerator returns a new block template generator for the given
@@ -365,7 +568,8 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 	txSource TxSource, chain *blockchain.BlockChain,
 	timeSource blockchain.MedianTimeSource,
 	sigCache *txscript.SigCache,
-	hashCache *txscript.HashCache) *BlkTmplGenerator {
+	hashCache *txscript.HashCache,
+	scriptCache *blockchain.ScriptCache) *BlkTmplGenerator {
 
 	return &BlkTmplGenerator{
 		policy:      policy,
@@ -375,6 +579,7 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 		timeSource:  timeSource,
 		sigCache:    sigCache,
 		hashCache:   hashCache,
+		scriptCache: scriptCache,
 	}
 }
 
@@ -395,24 +600,26 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 // higher fee per kilobyte are preferred.  Finally, the block generation related
 // policy settings are all taken into account.
 //
-// Transactions which only spend outputs from other transactions already in the
-// block chain are immediately added to a priority queue which either
-// prioritizes based on the priority (then fee per kilobyte) or the fee per
-// kilobyte (then priority) depending on whether or not the BlockPrioritySize
-// policy setting allots space for high-priority transactions.  Transactions
+// When the BlockPrioritySize policy setting allots space for high-priority
+// transactions, transactions which only spend outputs from other transactions
+// already in the block chain are immediately added to a priority queue which
+// prioritizes based on the priority (then fee per kilobyte).  Transactions
 // which spend outputs from other transactions in the source pool are added to a
 // dependency map so they can be added to the priority queue once the
 // transactions they depend on have been included.
 //
 // Once the high-priority area (if configured) has been filled with
 // transactions, or the priority falls below what is considered high-priority,
-// the priority queue is updated to prioritize by fees per kilobyte (then
-// priority).
+// the rest of the block is filled with packages made of a transaction and its
+// ancestors which are not in the block yet, by descending fee per kilobyte of
+// the whole package.  This way a child paying a high fee brings its low fee
+// parents into the block (child-pays-for-parent).  The size of packages is
+// bounded by the ancestor limits of the source pool.
 //
-// When the fees per kilobyte drop below the TxMinFreeFee policy setting, the
-// transaction will be skipped unless the BlockMinSize policy setting is
-// nonzero, in which case the block will be filled with the low-fee/free
-// transactions until the block size reaches that minimum size.
+// When the fees per kilobyte of a package drop below the TxMinFreeFee policy
+// setting, the package will be skipped unless the BlockMinSize policy setting
+// is nonzero, in which case the block will be filled with the low-fee/free
+// packages until the block size reaches that minimum size.
 //
 // Any transactions which would cause the block to exceed the BlockMaxSize
 // policy setting, exceed the maximum allowed signature operations per block, or
@@ -430,7 +637,7 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 //	|                                   |   |
 //	|                                   |   |
 //	|                                   |   |--- policy.BlockMaxSize
-//	|  Transactions prioritized by fee  |   |
+//	|  Packages prioritized by fee rate |   |
 //	|  until <= policy.TxMinFreeFee     |   |
 //	|                                   |   |
 //	|                                   |   |
@@ -441,6 +648,15 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 //	|  <= policy.BlockMinSize)          |   |
 //	 -----------------------------------  --
 func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress btcutil.Address) (*BlockTemplate, error) {
+	return g.NewBlockTemplateWithExtraData(payToAddress, 0, nil)
+}
+
+// NewBlockTemplateWithExtraData is NewBlockTemplate with the passed extra nonce
+// and extra data, if not empty, pushed to the coinbase script after the block
+// height, so that the blocks built by different miners on the same parent,
+// or by the same miner more than once, differ.  The coinbase script counts
+// towards the block size and weight limits like the rest of the coinbase.
+func (g *BlkTmplGenerator) NewBlockTemplateWithExtraData(payToAddress btcutil.Address, extraNonce uint64, extraData []byte) (*BlockTemplate, error) {
 	// Extend the most recently known best block.
 	best := g.chain.BestSnapshot()
 	nextBlockHeight := best.Height + 1
@@ -453,13 +669,18 @@ func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress btcutil.Address) (*Bloc
 	// ensure the transaction is not a duplicate transaction (paying the
 	// same value to the same public key address would otherwise be an
 	// identical transaction for block version 1).
-	extraNonce := uint64(0)
-	coinbaseScript, err := standardCoinbaseScript(nextBlockHeight, extraNonce)
+	coinbaseScript, err := standardCoinbaseScript(nextBlockHeight, extraNonce, extraData)
 	if err != nil {
 		return nil, err
 	}
+	if len(coinbaseScript) > blockchain.MaxCoinbaseScriptLen {
+		return nil, fmt.Errorf("coinbase transaction script length "+
+			"of %d is out of range (min: %d, max: %d)",
+			len(coinbaseScript), blockchain.MinCoinbaseScriptLen,
+			blockchain.MaxCoinbaseScriptLen)
+	}
 	coinbaseTx, err := createCoinbaseTx(g.chainParams, coinbaseScript,
-		nextBlockHeight, payToAddress)
+		nextBlockHeight, payToAddress, g.policy.CoinbaseTag)
 	if err != nil {
 		return nil, err
 	}
@@ -490,6 +711,10 @@ func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress btcutil.Address) (*Bloc
 	// in the block once each transaction has been included.
 	dependers := make(map[chainhash.Hash]map[chainhash.Hash]*txPrioItem)
 
+	// candidates holds every transaction which may be included in the
+	// block once the transactions it depends on are.
+	candidates := make(map[chainhash.Hash]*txPrioItem, len(sourceTxns))
+
 	// Create slices to hold the fees and number of signature operations
 	// for each of the selected transactions and add an entry for the
 	// coinbase.  This allows the code below to simply append details about
@@ -520,6 +745,14 @@ mempoolLoop:
 			continue
 		}
 
+		// The transaction source is not required to enforce the data
+		// carrier policy, so it is checked again here.
+		if !g.policy.allowsDataCarriers(tx) {
+			log.Tracef("Skipping tx %s since its data carriers are "+
+				"not allowed", tx.Hash())
+			continue
+		}
+
 		// Fetch all of the utxos referenced by this transaction.
 		// NOTE: This intentionally does not fetch inputs from the
 		// mempool since a transaction which depends on other
@@ -575,6 +808,9 @@ mempoolLoop:
 		// Calculate the fee in Satoshi/kB.
 		prioItem.feePerKB = txDesc.FeePerKB
 		prioItem.fee = txDesc.Fee
+		prioItem.weight = blockchain.GetTransactionWeight(tx)
+		prioItem.parents = maps.Clone(prioItem.dependsOn)
+		candidates[*tx.Hash()] = prioItem
 
 		// Add the transaction to the priority queue to mark it ready
 		// for inclusion in the block unless it has dependencies.
@@ -611,18 +847,22 @@ mempoolLoop:
 
 	witnessIncluded := false
 
-	// Choose which transactions make it into the block.
-	for priorityQueue.Len() > 0 {
-		// Grab the highest priority (or highest fee per kilobyte
-		// depending on the sort order) transaction.
-		prioItem := heap.Pop(priorityQueue).(*txPrioItem)
+	// included and excluded track the transactions which were added to the
+	// block and the ones which were skipped.  Transactions spending an
+	// excluded transaction can't be added to the block either.
+	included := make(map[chainhash.Hash]struct{})
+	excluded := make(map[chainhash.Hash]struct{})
+
+	// addTx adds the transaction to the block unless it would make the
+	// block invalid, and returns whether it was added.
+	addTx := func(prioItem *txPrioItem) bool {
 		tx := prioItem.tx
 
 		switch {
 		// If segregated witness has not been activated yet, then we
 		// shouldn't include any witness transactions in the block.
 		case !segwitActive && tx.HasWitness():
-			continue
+			return false
 
 		// Otherwise, Keep track of if we've included a transaction
 		// with witness data or not. If so, then we'll need to include
@@ -657,19 +897,15 @@ mempoolLoop:
 			witnessIncluded = true
 		}
 
-		// Grab any transactions which depend on this one.
-		deps := dependers[*tx.Hash()]
-
 		// Enforce maximum block size.  Also check for overflow.
-		txWeight := uint32(blockchain.GetTransactionWeight(tx))
+		txWeight := uint32(prioItem.weight)
 		blockPlusTxWeight := blockWeight + txWeight
 		if blockPlusTxWeight < blockWeight ||
 			blockPlusTxWeight >= g.policy.BlockMaxWeight {
 
 			log.Tracef("Skipping tx %s because it would exceed "+
 				"the max block weight", tx.Hash())
-			logSkippedDeps(tx, deps)
-			continue
+			return false
 		}
 
 		// Enforce maximum signature operation cost per block.  Also
@@ -679,59 +915,13 @@ mempoolLoop:
 		if err != nil {
 			log.Tracef("Skipping tx %s due to error in "+
 				"GetSigOpCost: %v", tx.Hash(), err)
-			logSkippedDeps(tx, deps)
-			continue
+			return false
 		}
 		if blockSigOpCost+int64(sigOpCost) < blockSigOpCost ||
 			blockSigOpCost+int64(sigOpCost) > blockchain.MaxBlockSigOpsCost {
 			log.Tracef("Skipping tx %s because it would "+
 				"exceed the maximum sigops per block", tx.Hash())
-			logSkippedDeps(tx, deps)
-			continue
-		}
-
-		// Skip free transactions once the block is larger than the
-		// minimum block size.
-		if sortedByFee &&
-			prioItem.feePerKB < int64(g.policy.TxMinFreeFee) &&
-			blockPlusTxWeight >= g.policy.BlockMinWeight {
-
-			log.Tracef("Skipping tx %s with feePerKB %d "+
-				"< TxMinFreeFee %d and block weight %d >= "+
-				"minBlockWeight %d", tx.Hash(), prioItem.feePerKB,
-				g.policy.TxMinFreeFee, blockPlusTxWeight,
-				g.policy.BlockMinWeight)
-			logSkippedDeps(tx, deps)
-			continue
-		}
-
-		// Prioritize by fee per kilobyte once the block is larger than
-		// the priority size or there are no more high-priority
-		// transactions.
-		if !sortedByFee && (blockPlusTxWeight >= g.policy.BlockPrioritySize ||
-			prioItem.priority <= MinHighPriority) {
-
-			log.Tracef("Switching to sort by fees per "+
-				"kilobyte blockSize %d >= BlockPrioritySize "+
-				"%d || priority %.2f <= minHighPriority %.2f",
-				blockPlusTxWeight, g.policy.BlockPrioritySize,
-				prioItem.priority, MinHighPriority)
-
-			sortedByFee = true
-			priorityQueue.SetLessFunc(txPQByFee)
-
-			// Put the transaction back into the priority queue and
-			// skip it so it is re-priortized by fees if it won't
-			// fit into the high-priority section or the priority
-			// is too low.  Otherwise this transaction will be the
-			// final one in the high-priority section, so just fall
-			// though to the code below so it is added now.
-			if blockPlusTxWeight > g.policy.BlockPrioritySize ||
-				prioItem.priority < MinHighPriority {
-
-				heap.Push(priorityQueue, prioItem)
-				continue
-			}
+			return false
 		}
 
 		// Ensure the transaction inputs pass all of the necessary
@@ -741,17 +931,15 @@ mempoolLoop:
 		if err != nil {
 			log.Tracef("Skipping tx %s due to error in "+
 				"CheckTransactionInputs: %v", tx.Hash(), err)
-			logSkippedDeps(tx, deps)
-			continue
+			return false
 		}
 		err = blockchain.ValidateTransactionScripts(tx, blockUtxos,
 			txscript.StandardVerifyFlags, g.sigCache,
-			g.hashCache)
+			g.hashCache, g.scriptCache)
 		if err != nil {
 			log.Tracef("Skipping tx %s due to error in "+
 				"ValidateTransactionScripts: %v", tx.Hash(), err)
-			logSkippedDeps(tx, deps)
-			continue
+			return false
 		}
 
 		// Spend the transaction inputs in the block utxo view and add
@@ -769,9 +957,56 @@ mempoolLoop:
 		totalFees += prioItem.fee
 		txFees = append(txFees, prioItem.fee)
 		txSigOpCosts = append(txSigOpCosts, int64(sigOpCost))
+		included[*tx.Hash()] = struct{}{}
 
-		log.Tracef("Adding tx %s (priority %.2f, feePerKB %.2f)",
+		log.Tracef("Adding tx %s (priority %.2f, feePerKB %d)",
 			prioItem.tx.Hash(), prioItem.priority, prioItem.feePerKB)
+		return true
+	}
+
+	// Fill the high-priority area of the block, if any, by priority.
+	for !sortedByFee && priorityQueue.Len() > 0 {
+		// Grab the highest priority transaction.
+		prioItem := heap.Pop(priorityQueue).(*txPrioItem)
+		tx := prioItem.tx
+
+		// Grab any transactions which depend on this one.
+		deps := dependers[*tx.Hash()]
+
+		// Switch to selecting packages by fee rate once the block is
+		// larger than the priority size or there are no more
+		// high-priority transactions.
+		txWeight := uint32(prioItem.weight)
+		blockPlusTxWeight := blockWeight + txWeight
+		if blockPlusTxWeight >= g.policy.BlockPrioritySize ||
+			prioItem.priority <= MinHighPriority {
+
+			log.Tracef("Switching to sort by fees per "+
+				"kilobyte blockSize %d >= BlockPrioritySize "+
+				"%d || priority %.2f <= minHighPriority %.2f",
+				blockPlusTxWeight, g.policy.BlockPrioritySize,
+				prioItem.priority, MinHighPriority)
+
+			sortedByFee = true
+
+			// Skip the transaction so it is selected by fee rate
+			// if it won't fit into the high-priority section or
+			// the priority is too low.  Otherwise this transaction
+			// will be the final one in the high-priority section,
+			// so just fall though to the code below so it is
+			// added now.
+			if blockPlusTxWeight > g.policy.BlockPrioritySize ||
+				prioItem.priority < MinHighPriority {
+
+				break
+			}
+		}
+
+		if !addTx(prioItem) {
+			excluded[*tx.Hash()] = struct{}{}
+			logSkippedDeps(tx, deps)
+			continue
+		}
 
 		// Add transactions which depend on this one (and also do not
 		// have any other unsatisified dependencies) to the priority
@@ -786,6 +1021,107 @@ mempoolLoop:
 		}
 	}
 
+	// Fill the rest of the block with packages of transactions along with
+	// their ancestors which are not in the block yet, by descending fee
+	// rate of the package.  This allows a child paying a high fee to bring
+	// its low fee parent into the block.  Package sizes are bounded by the
+	// ancestor limits of the source pool.
+	packages := make(map[chainhash.Hash]*txPackage, len(candidates))
+	packageQueue := &txPackageQueue{}
+	for hash, prioItem := range candidates {
+		if _, ok := included[hash]; ok {
+			continue
+		}
+		pkg := newTxPackage(prioItem)
+		if !pkg.addAncestors(candidates, included) {
+			log.Tracef("Skipping tx %s because it depends on a "+
+				"transaction which can't be mined", hash)
+			continue
+		}
+		packages[hash] = pkg
+		heap.Push(packageQueue, pkg.entry())
+	}
+
+packageLoop:
+	for packageQueue.Len() > 0 {
+		entry := heap.Pop(packageQueue).(txPackageEntry)
+		pkg := entry.pkg
+		hash := *pkg.item.tx.Hash()
+		if pkg.skipped || entry.stale() {
+			continue
+		}
+		if _, ok := included[hash]; ok {
+			continue
+		}
+		for ancestorHash := range pkg.ancestors {
+			if _, ok := excluded[ancestorHash]; ok {
+				log.Tracef("Skipping tx %s since it depends on %s",
+					hash, ancestorHash)
+				excluded[hash] = struct{}{}
+				continue packageLoop
+			}
+		}
+
+		// Skip the package, but not its ancestors, if it would make
+		// the block too large or pays too low a fee rate.
+		packageWeight := blockWeight + uint32(pkg.weight)
+		if packageWeight < blockWeight ||
+			packageWeight >= g.policy.BlockMaxWeight {
+
+			log.Tracef("Skipping package of tx %s because it "+
+				"would exceed the max block weight", hash)
+			pkg.skipped = true
+			continue
+		}
+		if pkg.feePerKB() < int64(g.policy.TxMinFreeFee) &&
+			packageWeight >= g.policy.BlockMinWeight {
+
+			log.Tracef("Skipping package of tx %s with feePerKB "+
+				"%d < TxMinFreeFee %d and block weight %d >= "+
+				"minBlockWeight %d", hash, pkg.feePerKB(),
+				g.policy.TxMinFreeFee, packageWeight,
+				g.policy.BlockMinWeight)
+			pkg.skipped = true
+			continue
+		}
+
+		// Add the package parents first.  A transaction has fewer
+		// ancestors outside of the block than any of its descendants.
+		members := make([]*txPackage, 0, len(pkg.ancestors)+1)
+		for ancestorHash := range pkg.ancestors {
+			members = append(members, packages[ancestorHash])
+		}
+		sort.Slice(members, func(i, j int) bool {
+			return len(members[i].ancestors) < len(members[j].ancestors)
+		})
+		members = append(members, pkg)
+
+		log.Tracef("Adding package of tx %s (%d transactions, "+
+			"feePerKB %d)", hash, len(members), pkg.feePerKB())
+
+		for _, member := range members {
+			memberHash := *member.item.tx.Hash()
+			dependsOnExcluded := false
+			for parentHash := range member.item.parents {
+				if _, ok := excluded[parentHash]; ok {
+					dependsOnExcluded = true
+				}
+			}
+			if dependsOnExcluded || !addTx(member.item) {
+				excluded[memberHash] = struct{}{}
+				logSkippedDeps(member.item.tx, dependers[memberHash])
+				continue
+			}
+
+			// The transactions depending on the member no longer
+			// need it in their package.
+			for _, descendant := range descendantPackages(memberHash, dependers, packages) {
+				descendant.removeAncestor(member.item)
+				heap.Push(packageQueue, descendant.entry())
+			}
+		}
+	}
+
 	// Now that the actual transactions have been selected, update the
 	// block weight for the real transaction count and coinbase value with
 	// the total fees accordingly.
@@ -806,7 +1142,7 @@ mempoolLoop:
 	// Calculate the required difficulty for the block.  The timestamp
 	// is potentially adjusted to ensure it comes after the median time of
 	// the last several blocks per the chain consensus rules.
-	ts := medianAdjustedTime(best, g.timeSource)
+	ts := medianAdjustedTime(best, g.chainParams, g.timeSource)
 	reqDifficulty, err := g.chain.CalcNextRequiredDifficulty(ts)
 	if err != nil {
 		return nil, err
@@ -909,7 +1245,17 @@ func (g *BlkTmplGenerator) UpdateBlockTime(msgBlock *wire.MsgBlock) error {
 	// The new timestamp is potentially adjusted to ensure it comes after
 	// the median time of the last several blocks per the chain consensus
 	// rules.
-	newTime := medianAdjustedTime(g.chain.BestSnapshot(), g.timeSource)
+	newTime := medianAdjustedTime(g.chain.BestSnapshot(), g.chainParams,
+		g.timeSource)
+	return g.SetBlockTime(msgBlock, newTime)
+}
+
+// SetBlockTime sets the timestamp of the passed block to the passed time and
+// updates the target difficulty if needed based on the new time for the test
+// networks since their target difficulty can change based upon time.  The
+// caller is responsible for the time being valid per the chain consensus
+// rules.
+func (g *BlkTmplGenerator) SetBlockTime(msgBlock *wire.MsgBlock, newTime time.Time) error {
 	msgBlock.Header.Timestamp = newTime
 
 	// Recalculate the difficulty if running on a network that requires it.
@@ -929,7 +1275,7 @@ func (g *BlkTmplGenerator) UpdateBlockTime(msgBlock *wire.MsgBlock) error {
 // height.  It also recalculates and updates the new merkle root that results
 // from changing the coinbase script.
 func (g *BlkTmplGenerator) UpdateExtraNonce(msgBlock *wire.MsgBlock, blockHeight int32, extraNonce uint64) error {
-	coinbaseScript, err := standardCoinbaseScript(blockHeight, extraNonce)
+	coinbaseScript, err := standardCoinbaseScript(blockHeight, extraNonce, nil)
 	if err != nil {
 		return err
 	}
@@ -5,11 +5,16 @@
 package mining
 
 import (
+	"bytes"
 	"container/heap"
 	"math/rand"
 	"testing"
+	"time"
 
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
 	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
 )
 
 // TestTxFeePrioHeap ensures the priority queue for transaction fees and
@@ -108,3 +113,73 @@ func TestTxFeePrioHeap(t *testing.T) {
 		highest = prioItem
 	}
 }
+
+// TestMedianAdjustedTime ensures block templates are not timestamped before
+// the time of the best block on networks with monotonic timestamps, even when
+// it was proposed by a node with a clock ahead of the local clock.
+func TestMedianAdjustedTime(t *testing.T) {
+	timeSource := blockchain.NewMedianTime()
+	now := time.Unix(timeSource.AdjustedTime().Unix(), 0)
+	best := &blockchain.BestState{
+		Timestamp:  now.Add(3 * time.Second),
+		MedianTime: now.Add(-20 * time.Second),
+	}
+
+	medianParams := chaincfg.RegressionNetParams
+	ts := medianAdjustedTime(best, &medianParams, timeSource)
+	if ts.Before(now) || !ts.Before(best.Timestamp) {
+		t.Errorf("medianAdjustedTime: got %v, want the current time %v",
+			ts, now)
+	}
+
+	monotonicParams := chaincfg.RegressionNetParams
+	monotonicParams.MonotonicTimestamps = true
+	ts = medianAdjustedTime(best, &monotonicParams, timeSource)
+	if !ts.Equal(best.Timestamp) {
+		t.Errorf("medianAdjustedTime: got %v, want the best block time %v",
+			ts, best.Timestamp)
+	}
+}
+
+// TestCreateCoinbaseTxTag ensures the coinbase tag is pushed by an additional
+// OP_RETURN output which adds to the weight of the coinbase.
+func TestCreateCoinbaseTxTag(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	coinbaseScript, err := standardCoinbaseScript(1, 0, nil)
+	if err != nil {
+		t.Fatalf("standardCoinbaseScript: %v", err)
+	}
+
+	untagged, err := createCoinbaseTx(params, coinbaseScript, 1, nil, nil)
+	if err != nil {
+		t.Fatalf("createCoinbaseTx: %v", err)
+	}
+	if len(untagged.MsgTx().TxOut) != 1 {
+		t.Fatalf("untagged coinbase has %d outputs, want 1",
+			len(untagged.MsgTx().TxOut))
+	}
+
+	tag := []byte("proposer")
+	tagged, err := createCoinbaseTx(params, coinbaseScript, 1, nil, tag)
+	if err != nil {
+		t.Fatalf("createCoinbaseTx: %v", err)
+	}
+	txOuts := tagged.MsgTx().TxOut
+	if len(txOuts) != 2 {
+		t.Fatalf("tagged coinbase has %d outputs, want 2", len(txOuts))
+	}
+	if txOuts[1].Value != 0 {
+		t.Errorf("tag output has value %d, want 0", txOuts[1].Value)
+	}
+	data, ok := txscript.ExtractNullData(txOuts[1].PkScript)
+	if !ok || !bytes.Equal(data, tag) {
+		t.Errorf("tag output pushes %x, want %x", data, tag)
+	}
+
+	weightDiff := blockchain.GetTransactionWeight(tagged) -
+		blockchain.GetTransactionWeight(untagged)
+	wantDiff := int64(txOuts[1].SerializeSize() * blockchain.WitnessScaleFactor)
+	if weightDiff != wantDiff {
+		t.Errorf("tag output adds weight %d, want %d", weightDiff, wantDiff)
+	}
+}
@@ -7,6 +7,7 @@ package mining
 import (
 	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
 	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
 	"github.com/MetalBlockchain/btcvm/btcd/wire"
 )
 
@@ -45,6 +46,37 @@ type Policy struct {
 	// required for a transaction to be treated as free for mining purposes
 	// (block template generation).
 	TxMinFreeFee btcutil.Amount
+
+	// RejectDataCarrier, if true, excludes transactions with outputs which
+	// only carry data (OP_RETURN) from block templates.
+	RejectDataCarrier bool
+
+	// MaxDataCarrierSize is the maximum number of bytes of data the outputs
+	// which only carry data of a transaction included in a block template
+	// can push in total.
+	MaxDataCarrierSize int
+
+	// CoinbaseTag, if not empty, is pushed by an OP_RETURN output of the
+	// coinbase of generated block templates.  The output is counted
+	// against the block weight like the rest of the coinbase.
+	CoinbaseTag []byte
+}
+
+// allowsDataCarriers returns whether the outputs of the passed transaction
+// which only carry data (OP_RETURN) conform to the data carrier policy.
+func (p *Policy) allowsDataCarriers(tx *btcutil.Tx) bool {
+	dataSize := 0
+	for _, txOut := range tx.MsgTx().TxOut {
+		data, ok := txscript.ExtractNullData(txOut.PkScript)
+		if !ok {
+			continue
+		}
+		if p.RejectDataCarrier {
+			return false
+		}
+		dataSize += len(data)
+	}
+	return dataSize <= p.MaxDataCarrierSize
 }
 
 // minInt is a helper function to return the minimum of two ints.  This avoids
@@ -5,12 +5,14 @@
 package mining
 
 import (
+	"bytes"
 	"encoding/hex"
 	"testing"
 
 	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
 	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
 	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
 	"github.com/MetalBlockchain/btcvm/btcd/wire"
 )
 
@@ -166,3 +168,60 @@ func TestCalcPriority(t *testing.T) {
 		}
 	}
 }
+
+// TestAllowsDataCarriers ensures the data carrier policy of block templates
+// is enforced on the total data of the outputs which only carry data.
+func TestAllowsDataCarriers(t *testing.T) {
+	nullData := func(size int) *wire.TxOut {
+		pkScript, err := txscript.NewScriptBuilder().
+			AddOp(txscript.OP_RETURN).
+			AddData(bytes.Repeat([]byte{0x01}, size)).
+			Script()
+		if err != nil {
+			t.Fatalf("unable to build null data script: %v", err)
+		}
+		return wire.NewTxOut(0, pkScript)
+	}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		txOuts []*wire.TxOut
+		want   bool
+	}{
+		{
+			name:   "no data carrier",
+			policy: Policy{RejectDataCarrier: true},
+			txOuts: []*wire.TxOut{wire.NewTxOut(1, []byte{txscript.OP_TRUE})},
+			want:   true,
+		},
+		{
+			name:   "data at the limit",
+			policy: Policy{MaxDataCarrierSize: 100},
+			txOuts: []*wire.TxOut{nullData(100)},
+			want:   true,
+		},
+		{
+			name:   "data one byte over the limit",
+			policy: Policy{MaxDataCarrierSize: 100},
+			txOuts: []*wire.TxOut{nullData(101)},
+		},
+		{
+			name:   "data of several outputs over the limit",
+			policy: Policy{MaxDataCarrierSize: 100},
+			txOuts: []*wire.TxOut{nullData(50), nullData(51)},
+		},
+		{
+			name:   "data carriers rejected",
+			policy: Policy{RejectDataCarrier: true, MaxDataCarrierSize: 100},
+			txOuts: []*wire.TxOut{nullData(0)},
+		},
+	}
+
+	for _, test := range tests {
+		tx := btcutil.NewTx(&wire.MsgTx{Version: 1, TxOut: test.txOuts})
+		if got := test.policy.allowsDataCarriers(tx); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -201,12 +201,13 @@ var BtcvmTestNetParms = chaincfg.Params{
 	RelayNonStdTxs: true,
 
 	// Human-readable part for Bech32 encoded segwit addresses, as defined in
-	// BIP 173.
+	// BIP 173, and Bech32m encoded taproot addresses, as defined in BIP 350.
+	// It is the one of simnet, which registers it for address decoding.
 	Bech32HRPSegwit: "sb", // always sb for sim net
 
 	// Address encoding magics
 	PubKeyHashAddrID:        0x3f, // starts with S
-	ScriptHashAddrID:        0x7b, // starts with s
+	ScriptHashAddrID:        0x7b, // starts with r
 	PrivateKeyID:            0x64, // starts with 4 (uncompressed) or F (compressed)
 	WitnessPubKeyHashAddrID: 0x19, // starts with Gg
 	WitnessScriptHashAddrID: 0x28, // starts with ?
@@ -223,6 +223,15 @@ func (cm *rpcConnManager) RelayTransactions(txns []*mempool.TxDesc) {
 	cm.server.relayTransactions(txns)
 }
 
+// RelayLocalTransactions relays the passed transactions, submitted to the node
+// by a client, to all connected peers right away.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) RelayLocalTransactions(txns []*mempool.TxDesc) {
+	cm.server.relayLocalTransactions(txns)
+}
+
 // NodeAddresses returns an array consisting node addresses which can
 // potentially be used to find new nodes in the network.
 //
@@ -260,6 +269,18 @@ func (b *rpcSyncMgr) SubmitBlock(block *btcutil.Block, flags blockchain.Behavior
 	return b.syncMgr.ProcessBlock(block, flags)
 }
 
+// SubmitBlockToVM hands the provided block to the VM and returns the status of
+// the submission. It returns false if the VM does not handle submitted blocks.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverSyncManager interface implementation.
+func (b *rpcSyncMgr) SubmitBlockToVM(block *btcutil.Block) (string, bool) {
+	if b.server.OnSubmitBlock == nil {
+		return "", false
+	}
+	return b.server.OnSubmitBlock(block), true
+}
+
 // Pause pauses the sync manager until the returned channel is closed.
 //
 // This function is safe for concurrent access and is part of the
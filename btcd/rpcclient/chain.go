@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"time"
 
 	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
 	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
@@ -418,6 +419,217 @@ func (c *Client) GetDifficulty() (float64, error) {
 	return c.GetDifficultyAsync().Receive()
 }
 
+// FutureGetConsensusInfoResult is a future promise to deliver the result of a
+// GetConsensusInfoAsync RPC invocation (or an applicable error).
+type FutureGetConsensusInfoResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the
+// description of the consensus the chain is run by.
+func (r FutureGetConsensusInfoResult) Receive() (*btcjson.ConsensusInfo, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var consensusInfo btcjson.ConsensusInfo
+	if err := json.Unmarshal(res, &consensusInfo); err != nil {
+		return nil, err
+	}
+	return &consensusInfo, nil
+}
+
+// GetConsensusInfoAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetConsensusInfo for the blocking version and more details.
+func (c *Client) GetConsensusInfoAsync() FutureGetConsensusInfoResult {
+	cmd := btcjson.NewGetConsensusInfoCmd()
+	return c.SendCmd(cmd)
+}
+
+// GetConsensusInfo returns a description of the Snowman consensus the chain is
+// run by on its Metal subnet.
+//
+// NOTE: This is a btcvm extension.
+func (c *Client) GetConsensusInfo() (*btcjson.ConsensusInfo, error) {
+	return c.GetConsensusInfoAsync().Receive()
+}
+
+// FutureGetDoubleSpendsResult is a future promise to deliver the result of a
+// GetDoubleSpendsAsync RPC invocation (or an applicable error).
+type FutureGetDoubleSpendsResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the
+// recently seen double spends involving the transaction.
+func (r FutureGetDoubleSpendsResult) Receive() ([]btcjson.DoubleSpendResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var doubleSpends []btcjson.DoubleSpendResult
+	if err := json.Unmarshal(res, &doubleSpends); err != nil {
+		return nil, err
+	}
+	return doubleSpends, nil
+}
+
+// GetDoubleSpendsAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetDoubleSpends for the blocking version and more details.
+func (c *Client) GetDoubleSpendsAsync(txHash *chainhash.Hash) FutureGetDoubleSpendsResult {
+	hash := ""
+	if txHash != nil {
+		hash = txHash.String()
+	}
+
+	cmd := btcjson.NewGetDoubleSpendsCmd(hash)
+	return c.SendCmd(cmd)
+}
+
+// GetDoubleSpends returns the recently seen double spends involving the
+// transaction with the given hash.
+//
+// NOTE: This is a btcvm extension.
+func (c *Client) GetDoubleSpends(txHash *chainhash.Hash) ([]btcjson.DoubleSpendResult, error) {
+	return c.GetDoubleSpendsAsync(txHash).Receive()
+}
+
+// FutureGetSpentInfoResult is a future promise to deliver the result of a
+// GetSpentInfoAsync RPC invocation (or an applicable error).
+type FutureGetSpentInfoResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the
+// transaction of the main chain spending the output.
+func (r FutureGetSpentInfoResult) Receive() (*btcjson.GetSpentInfoResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var spentInfo btcjson.GetSpentInfoResult
+	if err := json.Unmarshal(res, &spentInfo); err != nil {
+		return nil, err
+	}
+	return &spentInfo, nil
+}
+
+// GetSpentInfoAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See GetSpentInfo for the blocking version and more details.
+func (c *Client) GetSpentInfoAsync(outPoint *wire.OutPoint) FutureGetSpentInfoResult {
+	cmd := btcjson.NewGetSpentInfoCmd(outPoint.Hash.String(), outPoint.Index)
+	return c.SendCmd(cmd)
+}
+
+// GetSpentInfo returns the transaction of the main chain spending the given
+// output.  It requires the spent output index to be enabled.
+//
+// NOTE: This is a btcvm extension.
+func (c *Client) GetSpentInfo(outPoint *wire.OutPoint) (*btcjson.GetSpentInfoResult, error) {
+	return c.GetSpentInfoAsync(outPoint).Receive()
+}
+
+// FutureGetCheckpointResult is a future promise to deliver the result of a
+// GetCheckpointAsync RPC invocation (or an applicable error).
+type FutureGetCheckpointResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the last
+// accepted block as a checkpoint.
+func (r FutureGetCheckpointResult) Receive() (*btcjson.GetCheckpointResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoint btcjson.GetCheckpointResult
+	if err := json.Unmarshal(res, &checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// GetCheckpointAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See GetCheckpoint for the blocking version and more details.
+func (c *Client) GetCheckpointAsync() FutureGetCheckpointResult {
+	cmd := btcjson.NewGetCheckpointCmd()
+	return c.SendCmd(cmd)
+}
+
+// GetCheckpoint returns the last accepted block of the server as a checkpoint
+// for the config of other nodes.
+//
+// NOTE: This is a btcvm extension.
+func (c *Client) GetCheckpoint() (*btcjson.GetCheckpointResult, error) {
+	return c.GetCheckpointAsync().Receive()
+}
+
+// FutureWaitForBlockResult is a future promise to deliver the result of a
+// WaitForNewBlockAsync or WaitForBlockHeightAsync RPC invocation (or an
+// applicable error).
+type FutureWaitForBlockResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the last
+// block accepted by consensus when the wait ended.
+func (r FutureWaitForBlockResult) Receive() (*btcjson.WaitForBlockResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var tip btcjson.WaitForBlockResult
+	if err := json.Unmarshal(res, &tip); err != nil {
+		return nil, err
+	}
+	return &tip, nil
+}
+
+// WaitForNewBlockAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See WaitForNewBlock for the blocking version and more details.
+func (c *Client) WaitForNewBlockAsync(timeout time.Duration) FutureWaitForBlockResult {
+	cmd := btcjson.NewWaitForNewBlockCmd(btcjson.Int64(timeout.Milliseconds()))
+	return c.SendCmd(cmd)
+}
+
+// WaitForNewBlock waits until a new block is accepted by consensus or the
+// timeout elapses, and returns the last accepted block.  A timeout of zero
+// waits indefinitely.
+//
+// NOTE: This is a btcvm extension.
+func (c *Client) WaitForNewBlock(timeout time.Duration) (*btcjson.WaitForBlockResult, error) {
+	return c.WaitForNewBlockAsync(timeout).Receive()
+}
+
+// WaitForBlockHeightAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See WaitForBlockHeight for the blocking version and more details.
+func (c *Client) WaitForBlockHeightAsync(height int64, timeout time.Duration) FutureWaitForBlockResult {
+	cmd := btcjson.NewWaitForBlockHeightCmd(height, btcjson.Int64(timeout.Milliseconds()))
+	return c.SendCmd(cmd)
+}
+
+// WaitForBlockHeight waits until a block at or above height is accepted by
+// consensus or the timeout elapses, and returns the last accepted block.  A
+// timeout of zero waits indefinitely.
+//
+// NOTE: This is a btcvm extension.
+func (c *Client) WaitForBlockHeight(height int64, timeout time.Duration) (*btcjson.WaitForBlockResult, error) {
+	return c.WaitForBlockHeightAsync(height, timeout).Receive()
+}
+
 // FutureGetBlockChainInfoResult is a promise to deliver the result of a
 // GetBlockChainInfoAsync RPC invocation (or an applicable error).
 type FutureGetBlockChainInfoResult struct {
@@ -926,6 +1138,117 @@ func (c *Client) EstimateSmartFee(confTarget int64, mode *btcjson.EstimateSmartF
 	return c.EstimateSmartFeeAsync(confTarget, mode).Receive()
 }
 
+// EstimateFeeByTimeAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See EstimateFeeByTime for the blocking version and more details.
+func (c *Client) EstimateFeeByTimeAsync(seconds int64, mode *btcjson.EstimateSmartFeeMode) FutureEstimateSmartFeeResult {
+	cmd := btcjson.NewEstimateFeeByTimeCmd(seconds, mode)
+	return c.SendCmd(cmd)
+}
+
+// EstimateFeeByTime requests the server to estimate the fee level for a
+// transaction to be confirmed within the given number of seconds.
+//
+// NOTE: This is a btcvm extension.
+func (c *Client) EstimateFeeByTime(seconds int64, mode *btcjson.EstimateSmartFeeMode) (*btcjson.EstimateSmartFeeResult, error) {
+	return c.EstimateFeeByTimeAsync(seconds, mode).Receive()
+}
+
+// FutureExportChainStateResult is a future promise to deliver the result of
+// an ExportChainStateAsync RPC invocation (or an applicable error).
+type FutureExportChainStateResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the
+// description of the export written by the server.
+func (r FutureExportChainStateResult) Receive() (*btcjson.ExportChainStateResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var result btcjson.ExportChainStateResult
+	if err := json.Unmarshal(res, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ExportChainStateAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See ExportChainState for the blocking version and more details.
+func (c *Client) ExportChainStateAsync(dir string) FutureExportChainStateResult {
+	cmd := btcjson.NewExportChainStateCmd(dir)
+	return c.SendCmd(cmd)
+}
+
+// ExportChainState requests the server to write the blocks of its accepted
+// chain to a new directory on the server.
+//
+// NOTE: This is a btcvm extension.
+func (c *Client) ExportChainState(dir string) (*btcjson.ExportChainStateResult, error) {
+	return c.ExportChainStateAsync(dir).Receive()
+}
+
+// FutureResyncChainStateResult is a future promise to deliver the result of
+// a ResyncChainStateAsync or ResyncChainStateStatusAsync RPC invocation (or
+// an applicable error).
+type FutureResyncChainStateResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the
+// status of the chain state resync of the server.
+func (r FutureResyncChainStateResult) Receive() (*btcjson.ResyncChainStateResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var result btcjson.ResyncChainStateResult
+	if err := json.Unmarshal(res, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ResyncChainStateAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See ResyncChainState for the blocking version and more details.
+func (c *Client) ResyncChainStateAsync() FutureResyncChainStateResult {
+	cmd := btcjson.NewResyncChainStateCmd(nil)
+	return c.SendCmd(cmd)
+}
+
+// ResyncChainState requests the server to rebuild its chain state from the
+// accepted chain in the background.
+//
+// NOTE: This is a btcvm extension.
+func (c *Client) ResyncChainState() (*btcjson.ResyncChainStateResult, error) {
+	return c.ResyncChainStateAsync().Receive()
+}
+
+// ResyncChainStateStatusAsync returns an instance of a type that can be used
+// to get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See ResyncChainStateStatus for the blocking version and more details.
+func (c *Client) ResyncChainStateStatusAsync() FutureResyncChainStateResult {
+	cmd := btcjson.NewResyncChainStateCmd(btcjson.Bool(true))
+	return c.SendCmd(cmd)
+}
+
+// ResyncChainStateStatus returns the status of the last chain state resync
+// of the server without starting one.
+//
+// NOTE: This is a btcvm extension.
+func (c *Client) ResyncChainStateStatus() (*btcjson.ResyncChainStateResult, error) {
+	return c.ResyncChainStateStatusAsync().Receive()
+}
+
 // FutureVerifyChainResult is a future promise to deliver the result of a
 // VerifyChainAsync, VerifyChainLevelAsyncRPC, or VerifyChainBlocksAsync
 // invocation (or an applicable error).
@@ -1102,6 +1425,124 @@ func (c *Client) GetTxOutSetInfo() (*btcjson.GetTxOutSetInfoResult, error) {
 	return c.GetTxOutSetInfoAsync().Receive()
 }
 
+// FutureGetTxOutProofResult is a future promise to deliver the result of a
+// GetTxOutProofAsync RPC invocation (or an applicable error).
+type FutureGetTxOutProofResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the
+// merkle block proving the inclusion of the requested transactions.
+func (r FutureGetTxOutProofResult) Receive() (*wire.MsgMerkleBlock, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a string.
+	var proofHex string
+	err = json.Unmarshal(res, &proofHex)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode the serialized merkle block hex to raw bytes.
+	serializedProof, err := hex.DecodeString(proofHex)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deserialize the merkle block and return it.
+	var proof wire.MsgMerkleBlock
+	err = proof.BtcDecode(bytes.NewReader(serializedProof),
+		wire.ProtocolVersion, wire.BaseEncoding)
+	if err != nil {
+		return nil, err
+	}
+	return &proof, nil
+}
+
+// GetTxOutProofAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetTxOutProof for the blocking version and more details.
+func (c *Client) GetTxOutProofAsync(txHashes []*chainhash.Hash, blockHash *chainhash.Hash) FutureGetTxOutProofResult {
+	txIDs := make([]string, 0, len(txHashes))
+	for _, txHash := range txHashes {
+		txIDs = append(txIDs, txHash.String())
+	}
+
+	var hash *string
+	if blockHash != nil {
+		hash = btcjson.String(blockHash.String())
+	}
+
+	cmd := btcjson.NewGetTxOutProofCmd(txIDs, hash)
+	return c.SendCmd(cmd)
+}
+
+// GetTxOutProof returns a merkle block proving that the transactions with the
+// given txids are included in the block with the given hash.  The block hash
+// may be nil if the server has the transaction index enabled.
+func (c *Client) GetTxOutProof(txHashes []*chainhash.Hash, blockHash *chainhash.Hash) (*wire.MsgMerkleBlock, error) {
+	return c.GetTxOutProofAsync(txHashes, blockHash).Receive()
+}
+
+// FutureVerifyTxOutProofResult is a future promise to deliver the result of a
+// VerifyTxOutProofAsync RPC invocation (or an applicable error).
+type FutureVerifyTxOutProofResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the
+// txids proven by the merkle block.
+func (r FutureVerifyTxOutProofResult) Receive() ([]*chainhash.Hash, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as an array of strings.
+	var txIDs []string
+	err = json.Unmarshal(res, &txIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	txHashes := make([]*chainhash.Hash, 0, len(txIDs))
+	for _, txID := range txIDs {
+		txHash, err := chainhash.NewHashFromStr(txID)
+		if err != nil {
+			return nil, err
+		}
+		txHashes = append(txHashes, txHash)
+	}
+	return txHashes, nil
+}
+
+// VerifyTxOutProofAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See VerifyTxOutProof for the blocking version and more details.
+func (c *Client) VerifyTxOutProofAsync(proof *wire.MsgMerkleBlock) FutureVerifyTxOutProofResult {
+	proofHex := ""
+	if proof != nil {
+		var buf bytes.Buffer
+		if err := proof.BtcEncode(&buf, wire.ProtocolVersion, wire.BaseEncoding); err != nil {
+			return newFutureError(err)
+		}
+		proofHex = hex.EncodeToString(buf.Bytes())
+	}
+
+	cmd := btcjson.NewVerifyTxOutProofCmd(proofHex)
+	return c.SendCmd(cmd)
+}
+
+// VerifyTxOutProof verifies a merkle block built by GetTxOutProof against the
+// main chain of the server and returns the txids it proves, which are empty if
+// the proof is invalid.
+func (c *Client) VerifyTxOutProof(proof *wire.MsgMerkleBlock) ([]*chainhash.Hash, error) {
+	return c.VerifyTxOutProofAsync(proof).Receive()
+}
+
 // FutureRescanBlocksResult is a future promise to deliver the result of a
 // RescanBlocksAsync RPC invocation (or an applicable error).
 //
@@ -1189,6 +1630,48 @@ func (c *Client) InvalidateBlock(blockHash *chainhash.Hash) error {
 	return c.InvalidateBlockAsync(blockHash).Receive()
 }
 
+// FutureGetCFHeadersResult is a future promise to deliver the result of a
+// GetCFHeadersAsync RPC invocation (or an applicable error).
+type FutureGetCFHeadersResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the
+// filter hashes of the requested blocks and the filter header preceding them.
+func (r FutureGetCFHeadersResult) Receive() (*btcjson.GetCFHeadersResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfHeaders btcjson.GetCFHeadersResult
+	if err := json.Unmarshal(res, &cfHeaders); err != nil {
+		return nil, err
+	}
+	return &cfHeaders, nil
+}
+
+// GetCFHeadersAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See GetCFHeaders for the blocking version and more details.
+func (c *Client) GetCFHeadersAsync(startHeight uint32, stopHash chainhash.Hash,
+	filterType *btcjson.FilterTypeName) FutureGetCFHeadersResult {
+
+	cmd := btcjson.NewGetCFHeadersCmd(startHeight, stopHash.String(), filterType)
+	return c.SendCmd(cmd)
+}
+
+// GetCFHeaders returns the BIP0158 filter hashes of the blocks from
+// startHeight to stopHash and the filter header preceding them, from which the
+// filter headers of the blocks are derived.
+//
+// NOTE: This is a btcvm extension.
+func (c *Client) GetCFHeaders(startHeight uint32, stopHash chainhash.Hash,
+	filterType *btcjson.FilterTypeName) (*btcjson.GetCFHeadersResult, error) {
+
+	return c.GetCFHeadersAsync(startHeight, stopHash, filterType).Receive()
+}
+
 // FutureGetCFilterResult is a future promise to deliver the result of a
 // GetCFilterAsync RPC invocation (or an applicable error).
 type FutureGetCFilterResult chan *Response
@@ -67,6 +67,68 @@ func (c *Client) DebugLevel(levelSpec string) (string, error) {
 	return c.DebugLevelAsync(levelSpec).Receive()
 }
 
+// FutureSetLogLevelResult is a future promise to deliver the result of a
+// SetLogLevelAsync RPC invocation (or an applicable error).
+type FutureSetLogLevelResult chan *Response
+
+// Receive waits for the Response promised by the future and returns an error
+// if the log level could not be set.
+func (r FutureSetLogLevelResult) Receive() error {
+	_, err := ReceiveFuture(r)
+	return err
+}
+
+// SetLogLevelAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See SetLogLevel for the blocking version and more details.
+func (c *Client) SetLogLevelAsync(subsystem, level string) FutureSetLogLevelResult {
+	cmd := btcjson.NewSetLogLevelCmd(subsystem, level)
+	return c.SendCmd(cmd)
+}
+
+// SetLogLevel sets the log level of a subsystem of the VM, which is one of
+// mempool, chain, rpc, gossip or builder, until the node restarts.
+func (c *Client) SetLogLevel(subsystem, level string) error {
+	return c.SetLogLevelAsync(subsystem, level).Receive()
+}
+
+// FutureGetGossipInfoResult is a future promise to deliver the result of a
+// GetGossipInfoAsync RPC invocation (or an applicable error).
+type FutureGetGossipInfoResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the state
+// of the gossip of the VM.
+func (r FutureGetGossipInfoResult) Receive() (*btcjson.GetGossipInfoResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var gossipInfo btcjson.GetGossipInfoResult
+	if err := json.Unmarshal(res, &gossipInfo); err != nil {
+		return nil, err
+	}
+	return &gossipInfo, nil
+}
+
+// GetGossipInfoAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetGossipInfo for the blocking version and more details.
+func (c *Client) GetGossipInfoAsync() FutureGetGossipInfoResult {
+	cmd := btcjson.NewGetGossipInfoCmd()
+	return c.SendCmd(cmd)
+}
+
+// GetGossipInfo returns the state of the bloom filter of the gossiped items and
+// the activity of the push and pull gossip loops of the VM.
+func (c *Client) GetGossipInfo() (*btcjson.GetGossipInfoResult, error) {
+	return c.GetGossipInfoAsync().Receive()
+}
+
 // FutureCreateEncryptedWalletResult is a future promise to deliver the error
 // result of a CreateEncryptedWalletAsync RPC invocation.
 type FutureCreateEncryptedWalletResult chan *Response
@@ -179,6 +179,14 @@ type NotificationHandlers struct {
 	// made to register for the notification and the function is non-nil.
 	OnTxAcceptedVerbose func(txDetails *btcjson.TxRawResult)
 
+	// OnDoubleSpendSeen is invoked when a transaction conflicting with the
+	// memory pool is seen.  It will only be invoked if a preceding call to
+	// NotifyNewTransactions or NotifySpent has been made to register for
+	// the notification and the function is non-nil.
+	//
+	// NOTE: This is a btcvm extension.
+	OnDoubleSpendSeen func(doubleSpend *btcjson.DoubleSpendResult)
+
 	// OnBtcdConnected is invoked when a wallet connects or disconnects from
 	// btcd.
 	//
@@ -262,9 +270,14 @@ func (c *Client) handleNotification(ntfn *rawNotification) {
 			return
 		}
 
-		blockHash, blockHeight, blockTime, err := parseChainNtfnParams(ntfn.Params)
+		// The reverted transactions may follow the block.
+		params := ntfn.Params
+		if len(params) == 4 {
+			params = params[:3]
+		}
+		blockHash, blockHeight, blockTime, err := parseChainNtfnParams(params)
 		if err != nil {
-			log.Warnf("Received invalid block connected "+
+			log.Warnf("Received invalid block disconnected "+
 				"notification: %v", err)
 			return
 		}
@@ -409,6 +422,23 @@ func (c *Client) handleNotification(ntfn *rawNotification) {
 
 		c.ntfnHandlers.OnTxAcceptedVerbose(rawTx)
 
+	// OnDoubleSpendSeen
+	case btcjson.DoubleSpendSeenNtfnMethod:
+		// Ignore the notification if the client is not interested in
+		// it.
+		if c.ntfnHandlers.OnDoubleSpendSeen == nil {
+			return
+		}
+
+		doubleSpend, err := parseDoubleSpendSeenNtfnParams(ntfn.Params)
+		if err != nil {
+			log.Warnf("Received invalid double spend seen "+
+				"notification: %v", err)
+			return
+		}
+
+		c.ntfnHandlers.OnDoubleSpendSeen(doubleSpend)
+
 	// OnBtcdConnected
 	case btcjson.BtcdConnectedNtfnMethod:
 		// Ignore the notification if the client is not interested in
@@ -775,6 +805,23 @@ func parseTxAcceptedVerboseNtfnParams(params []json.RawMessage) (*btcjson.TxRawR
 	return &rawTx, nil
 }
 
+// parseDoubleSpendSeenNtfnParams parses out the double spend from the
+// parameters of a doublespendseen notification.
+func parseDoubleSpendSeenNtfnParams(params []json.RawMessage) (*btcjson.DoubleSpendResult,
+	error) {
+
+	if len(params) != 1 {
+		return nil, wrongNumParams(len(params))
+	}
+
+	var doubleSpend btcjson.DoubleSpendResult
+	err := json.Unmarshal(params[0], &doubleSpend)
+	if err != nil {
+		return nil, err
+	}
+	return &doubleSpend, nil
+}
+
 // parseBtcdConnectedNtfnParams parses out the connection status of btcd
 // and btcwallet from the parameters of a btcdconnected notification.
 func parseBtcdConnectedNtfnParams(params []json.RawMessage) (bool, error) {
@@ -7,6 +7,7 @@ package btcd
 
 import (
 	"bytes"
+	"compress/gzip"
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
@@ -16,11 +17,13 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"math/big"
 	"math/rand"
 	"net"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -32,6 +35,7 @@ import (
 	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2/ecdsa"
 	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
 	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil/bloom"
 	"github.com/MetalBlockchain/btcvm/btcd/chaincfg"
 	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
 	"github.com/MetalBlockchain/btcvm/btcd/database"
@@ -42,6 +46,7 @@ import (
 	"github.com/MetalBlockchain/btcvm/btcd/txscript"
 	"github.com/MetalBlockchain/btcvm/btcd/wire"
 	"github.com/btcsuite/websocket"
+	"github.com/decred/dcrd/lru"
 )
 
 // API version constants
@@ -79,6 +84,23 @@ const (
 	// defaultMaxFeeRate is the default value to use(0.1 BTC/kvB) when the
 	// `MaxFee` field is not set when calling `testmempoolaccept`.
 	defaultMaxFeeRate = 0.1
+
+	// blockStatsCacheSize is the max number of blocks whose statistics are
+	// cached for the getblockstats RPC.
+	blockStatsCacheSize = 1000
+
+	// gzipMinReplySize is the min size of the replies compressed for HTTP
+	// clients accepting gzip.  Smaller replies fit in a packet anyway.
+	gzipMinReplySize = 1400
+
+	// perUTXOOverhead is the size of the outpoint, height and coinbase flag
+	// stored with every unspent output, used to estimate the growth of the
+	// utxo set in the same way as Bitcoin Core.
+	perUTXOOverhead = chainhash.HashSize + 4 + 4 + 1
+
+	// maxBlockHeadersPerRequest is the max number of headers returned by a
+	// getblockheaders request.
+	maxBlockHeadersPerRequest = 2000
 )
 
 var (
@@ -106,6 +128,41 @@ var (
 	// invocation for constant data.
 	gbtCapabilities = []string{"proposal"}
 
+	// blockStatsNeedSpentOutputs maps the statistics of the getblockstats
+	// RPC to whether computing them requires the outputs spent by the
+	// block, which are read from its spend journal.
+	blockStatsNeedSpentOutputs = map[string]bool{
+		"avgfee":              true,
+		"avgfeerate":          true,
+		"avgtxsize":           false,
+		"blockhash":           false,
+		"feerate_percentiles": true,
+		"height":              false,
+		"ins":                 false,
+		"maxfee":              true,
+		"maxfeerate":          true,
+		"maxtxsize":           false,
+		"medianfee":           true,
+		"mediantime":          false,
+		"mediantxsize":        false,
+		"minfee":              true,
+		"minfeerate":          true,
+		"mintxsize":           false,
+		"outs":                false,
+		"subsidy":             false,
+		"swtotal_size":        false,
+		"swtotal_weight":      false,
+		"swtxs":               false,
+		"time":                false,
+		"total_out":           false,
+		"total_size":          false,
+		"total_weight":        false,
+		"totalfee":            true,
+		"txs":                 false,
+		"utxo_increase":       false,
+		"utxo_size_inc":       true,
+	}
+
 	// JSON 2.0 batched request prefix
 	batchedRequestPrefix = []byte("[")
 )
@@ -125,6 +182,13 @@ var (
 		Code:    btcjson.ErrRPCNoWallet,
 		Message: "This implementation does not implement wallet commands",
 	}
+
+	// errRPCUnauthorized is an error returned to RPC clients rejected by the
+	// Auth callback or calling a method it does not allow.
+	errRPCUnauthorized = &btcjson.RPCError{
+		Code:    btcjson.ErrRPCInvalidRequest.Code,
+		Message: "Unauthorized",
+	}
 )
 
 type commandHandler func(*rpcServer, any, <-chan struct{}) (any, error)
@@ -141,26 +205,41 @@ var (
 		"decoderawtransaction":   handleDecodeRawTransaction,
 		"decodescript":           handleDecodeScript,
 		"estimatefee":            handleEstimateFee,
+		"estimatefeebytime":      handleEstimateFeeByTime,
+		"estimatesmartfee":       handleEstimateSmartFee,
+		"exportchainstate":       handleExportChainState,
 		"generate":               handleGenerate,
+		"generatetoaddress":      handleGenerateToAddress,
 		"getaddednodeinfo":       handleGetAddedNodeInfo,
 		"getbestblock":           handleGetBestBlock,
 		"getbestblockhash":       handleGetBestBlockHash,
 		"getblock":               handleGetBlock,
 		"getblockchaininfo":      handleGetBlockChainInfo,
 		"getblockcount":          handleGetBlockCount,
+		"getblockfilter":         handleGetBlockFilter,
 		"getblockhash":           handleGetBlockHash,
 		"getblockheader":         handleGetBlockHeader,
+		"getblockheaders":        handleGetBlockHeaders,
+		"getblockstats":          handleGetBlockStats,
 		"getblocktemplate":       handleGetBlockTemplate,
 		"getchaintips":           handleGetChainTips,
+		"getcheckpoint":          handleGetCheckpoint,
+		"getcfheaders":           handleGetCFHeaders,
 		"getcfilter":             handleGetCFilter,
 		"getcfilterheader":       handleGetCFilterHeader,
 		"getconnectioncount":     handleGetConnectionCount,
+		"getconsensusinfo":       handleGetConsensusInfo,
 		"getcurrentnet":          handleGetCurrentNet,
 		"getdifficulty":          handleGetDifficulty,
+		"getdoublespends":        handleGetDoubleSpends,
 		"getgenerate":            handleGetGenerate,
+		"getgossipinfo":          handleGetGossipInfo,
 		"gethashespersec":        handleGetHashesPerSec,
 		"getheaders":             handleGetHeaders,
 		"getinfo":                handleGetInfo,
+		"getmempoolancestors":    handleGetMempoolAncestors,
+		"getmempooldescendants":  handleGetMempoolDescendants,
+		"getmempoolentry":        handleGetMempoolEntry,
 		"getmempoolinfo":         handleGetMempoolInfo,
 		"getmininginfo":          handleGetMiningInfo,
 		"getnettotals":           handleGetNetTotals,
@@ -170,15 +249,21 @@ var (
 		"getpeerinfo":            handleGetPeerInfo,
 		"getrawmempool":          handleGetRawMempool,
 		"getrawtransaction":      handleGetRawTransaction,
+		"getspentinfo":           handleGetSpentInfo,
+		"gettxconfirmations":     handleGetTxConfirmations,
 		"gettxout":               handleGetTxOut,
+		"gettxoutproof":          handleGetTxOutProof,
 		"help":                   handleHelp,
 		"invalidateblock":        handleInvalidateBlock,
 		"node":                   handleNode,
 		"ping":                   handlePing,
 		"reconsiderblock":        handleReconsiderBlock,
+		"resyncchainstate":       handleResyncChainState,
+		"runmaintenance":         handleRunMaintenance,
 		"searchrawtransactions":  handleSearchRawTransactions,
 		"sendrawtransaction":     handleSendRawTransaction,
 		"setgenerate":            handleSetGenerate,
+		"setloglevel":            handleSetLogLevel,
 		"signmessagewithprivkey": handleSignMessageWithPrivKey,
 		"stop":                   handleStop,
 		"submitblock":            handleSubmitBlock,
@@ -186,7 +271,10 @@ var (
 		"validateaddress":        handleValidateAddress,
 		"verifychain":            handleVerifyChain,
 		"verifymessage":          handleVerifyMessage,
+		"verifytxoutproof":       handleVerifyTxOutProof,
 		"version":                handleVersion,
+		"waitforblockheight":     handleWaitForBlockHeight,
+		"waitfornewblock":        handleWaitForNewBlock,
 		"testmempoolaccept":      handleTestMempoolAccept,
 		"gettxspendingprevout":   handleGetTxSpendingPrevOut,
 	}
@@ -243,7 +331,6 @@ var rpcAskWallet = map[string]struct{}{
 // Commands that are currently unimplemented, but should ultimately be.
 var rpcUnimplemented = map[string]struct{}{
 	"estimatepriority": {},
-	"getmempoolentry":  {},
 	"getwork":          {},
 	"preciousblock":    {},
 }
@@ -268,33 +355,48 @@ var rpcLimited = map[string]struct{}{
 	"decoderawtransaction":  {},
 	"decodescript":          {},
 	"estimatefee":           {},
+	"estimatefeebytime":     {},
+	"estimatesmartfee":      {},
 	"getbestblock":          {},
 	"getbestblockhash":      {},
 	"getblock":              {},
 	"getblockcount":         {},
+	"getblockfilter":        {},
 	"getblockhash":          {},
 	"getblockheader":        {},
+	"getblockheaders":       {},
+	"getblockstats":         {},
 	"getchaintips":          {},
+	"getconsensusinfo":      {},
+	"getcfheaders":          {},
 	"getcfilter":            {},
 	"getcfilterheader":      {},
 	"getcurrentnet":         {},
 	"getdifficulty":         {},
+	"getdoublespends":       {},
 	"getheaders":            {},
 	"getinfo":               {},
+	"getmempoolancestors":   {},
+	"getmempooldescendants": {},
+	"getmempoolentry":       {},
 	"getnettotals":          {},
 	"getnetworkhashps":      {},
 	"getrawmempool":         {},
 	"getrawtransaction":     {},
+	"getspentinfo":          {},
+	"gettxconfirmations":    {},
 	"gettxout":              {},
-	"invalidateblock":       {},
-	"reconsiderblock":       {},
+	"gettxoutproof":         {},
 	"searchrawtransactions": {},
 	"sendrawtransaction":    {},
 	"submitblock":           {},
 	"uptime":                {},
 	"validateaddress":       {},
 	"verifymessage":         {},
+	"verifytxoutproof":      {},
 	"version":               {},
+	"waitforblockheight":    {},
+	"waitfornewblock":       {},
 }
 
 // builderScript is a convenience function which is used for hard-coded scripts
@@ -351,14 +453,18 @@ type gbtWorkState struct {
 	template      *mining.BlockTemplate
 	notifyMap     map[chainhash.Hash]map[int64]chan struct{}
 	timeSource    blockchain.MedianTimeSource
+	maxTimeOffset time.Duration
 }
 
 // newGbtWorkState returns a new instance of a gbtWorkState with all internal
 // fields initialized and ready to use.
-func newGbtWorkState(timeSource blockchain.MedianTimeSource) *gbtWorkState {
+func newGbtWorkState(timeSource blockchain.MedianTimeSource,
+	params *chaincfg.Params) *gbtWorkState {
+
 	return &gbtWorkState{
-		notifyMap:  make(map[chainhash.Hash]map[int64]chan struct{}),
-		timeSource: timeSource,
+		notifyMap:     make(map[chainhash.Hash]map[int64]chan struct{}),
+		timeSource:    timeSource,
+		maxTimeOffset: blockchain.MaxTimeOffset(params),
 	}
 }
 
@@ -854,7 +960,12 @@ func handleDecodeScript(s *rpcServer, cmd any, closeChan <-chan struct{}) (any,
 		Type:      scriptClass.String(),
 		Addresses: addresses,
 	}
-	if scriptClass != txscript.ScriptHashTy {
+	// Taproot outputs can't be spent through a pay-to-script-hash
+	// wrapper, since their spends are only validated as witness v1
+	// programs when found in the output script itself.
+	if scriptClass != txscript.ScriptHashTy &&
+		scriptClass != txscript.WitnessV1TaprootTy {
+
 		reply.P2sh = p2sh.EncodeAddress()
 	}
 
@@ -888,6 +999,119 @@ func handleEstimateFee(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, e
 	return float64(feeRate), nil
 }
 
+// parseEstimateMode returns whether mode asks for a conservative estimate.
+func parseEstimateMode(mode *btcjson.EstimateSmartFeeMode) (bool, error) {
+	if mode == nil {
+		return true, nil
+	}
+	switch *mode {
+	case btcjson.EstimateModeConservative, btcjson.EstimateModeUnset:
+		return true, nil
+	case btcjson.EstimateModeEconomical:
+		return false, nil
+	default:
+		return false, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Invalid estimate mode %q", *mode),
+		}
+	}
+}
+
+// estimateSmartFeeResult returns the estimatesmartfee result for an estimate
+// of feeRate for confirmation within blocks blocks.
+func estimateSmartFeeResult(feeRate btcutil.Amount, blocks uint32, err error) (any, error) {
+	if errors.Is(err, ErrInsufficientFeeData) {
+		return &btcjson.EstimateSmartFeeResult{
+			Errors: []string{err.Error()},
+			Blocks: int64(blocks),
+		}, nil
+	}
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInternal.Code,
+			Message: err.Error(),
+		}
+	}
+
+	btcPerKvB := feeRate.ToBTC()
+	return &btcjson.EstimateSmartFeeResult{
+		FeeRate: &btcPerKvB,
+		Blocks:  int64(blocks),
+	}, nil
+}
+
+// handleEstimateSmartFee implements the estimatesmartfee command.
+func handleEstimateSmartFee(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	c := cmd.(*btcjson.EstimateSmartFeeCmd)
+
+	if s.cfg.SmartFeeEstimator == nil {
+		return nil, errors.New("Fee estimation disabled")
+	}
+
+	if c.ConfTarget <= 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Parameter ConfTarget must be positive",
+		}
+	}
+	conservative, err := parseEstimateMode(c.EstimateMode)
+	if err != nil {
+		return nil, err
+	}
+
+	confTarget := uint32(c.ConfTarget)
+	if c.ConfTarget > math.MaxUint32 {
+		confTarget = math.MaxUint32
+	}
+	return estimateSmartFeeResult(
+		s.cfg.SmartFeeEstimator.EstimateSmartFee(confTarget, conservative))
+}
+
+// handleEstimateFeeByTime implements the estimatefeebytime command.
+func handleEstimateFeeByTime(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	c := cmd.(*btcjson.EstimateFeeByTimeCmd)
+
+	if s.cfg.SmartFeeEstimator == nil {
+		return nil, errors.New("Fee estimation disabled")
+	}
+
+	if c.Seconds <= 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Parameter Seconds must be positive",
+		}
+	}
+	conservative, err := parseEstimateMode(c.EstimateMode)
+	if err != nil {
+		return nil, err
+	}
+
+	return estimateSmartFeeResult(s.cfg.SmartFeeEstimator.EstimateFeeByTime(
+		time.Duration(c.Seconds)*time.Second, conservative))
+}
+
+// handleExportChainState implements the exportchainstate command.
+func handleExportChainState(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	c := cmd.(*btcjson.ExportChainStateCmd)
+
+	if s.cfg.ExportChainState == nil {
+		return nil, errors.New("Chain state export unavailable")
+	}
+	if c.Dir == "" {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Parameter Dir must be set",
+		}
+	}
+
+	result, err := s.cfg.ExportChainState(c.Dir)
+	if err != nil {
+		context := "Failed to export chain state"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	return result, nil
+}
+
 // handleGenerate handles generate commands.
 func handleGenerate(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
 	// Respond with an error if there are no addresses to pay the
@@ -942,6 +1166,61 @@ func handleGenerate(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, erro
 	return reply, nil
 }
 
+// handleGenerateToAddress handles generatetoaddress commands.
+func handleGenerateToAddress(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	// Respond with an error if blocks are not generated on demand on the
+	// current network.
+	if !s.cfg.ChainParams.GenerateSupported || s.cfg.GenerateToAddress == nil {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCDifficulty,
+			Message: fmt.Sprintf("No support for `generatetoaddress` "+
+				"on the current network, %s.", s.cfg.ChainParams.Net),
+		}
+	}
+
+	c := cmd.(*btcjson.GenerateToAddressCmd)
+
+	// Respond with an error if the client is requesting 0 blocks to be
+	// generated.
+	if c.NumBlocks <= 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Please request a positive number of blocks to generate.",
+		}
+	}
+
+	// The generated blocks must pay to an address on the active network.
+	payToAddr, err := btcutil.DecodeAddress(c.Address, s.cfg.ChainParams)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Invalid address: " + err.Error(),
+		}
+	}
+	if !payToAddr.IsForNet(s.cfg.ChainParams) {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Invalid address: " + c.Address +
+				" is for the wrong network",
+		}
+	}
+
+	blockHashes, err := s.cfg.GenerateToAddress(uint32(c.NumBlocks),
+		payToAddr, closeChan)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInternal.Code,
+			Message: err.Error(),
+		}
+	}
+
+	reply := make([]string, len(blockHashes))
+	for i, hash := range blockHashes {
+		reply[i] = hash.String()
+	}
+	return reply, nil
+}
+
 // handleGetAddedNodeInfo handles getaddednodeinfo commands.
 func handleGetAddedNodeInfo(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
 	c := cmd.(*btcjson.GetAddedNodeInfoCmd)
@@ -1127,49 +1406,152 @@ func handleGetBlock(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, erro
 	}
 
 	params := s.cfg.ChainParams
+	blockReply := blockVerboseResult(blk, len(blkBytes), best.Height, params)
+	blockReply.NextHash = nextHashString
+	if s.cfg.BlockProposer != nil {
+		blockReply.Proposer = s.cfg.BlockProposer(blk)
+	}
+
+	if *c.Verbosity == 1 {
+		transactions := blk.Transactions()
+		txNames := make([]string, len(transactions))
+		for i, tx := range transactions {
+			txNames[i] = tx.Hash().String()
+		}
+
+		blockReply.Tx = txNames
+		return blockReply, nil
+	}
+
+	// The transactions of a full block can take many megabytes of JSON, so
+	// they are encoded one at a time as the reply is written.
+	return &getBlockVerboseTxReply{
+		GetBlockVerboseResult: blockReply,
+		params:                params,
+		block:                 blk,
+		chainHeight:           best.Height,
+	}, nil
+}
+
+// blockVerboseResult returns the reply to a getblock command with a verbosity
+// of 1 for blk, a block of the main chain with the passed serialized size, less
+// the hash of the next block and the proposer.
+func blockVerboseResult(blk *btcutil.Block, blockSize int, chainHeight int32,
+	params *chaincfg.Params) btcjson.GetBlockVerboseResult {
+
 	blockHeader := &blk.MsgBlock().Header
-	blockReply := btcjson.GetBlockVerboseResult{
-		Hash:          c.Hash,
+	return btcjson.GetBlockVerboseResult{
+		Hash:          blk.Hash().String(),
 		Version:       blockHeader.Version,
 		VersionHex:    fmt.Sprintf("%08x", blockHeader.Version),
 		MerkleRoot:    blockHeader.MerkleRoot.String(),
 		PreviousHash:  blockHeader.PrevBlock.String(),
 		Nonce:         blockHeader.Nonce,
 		Time:          blockHeader.Timestamp.Unix(),
-		Confirmations: int64(1 + best.Height - blockHeight),
-		Height:        int64(blockHeight),
-		Size:          int32(len(blkBytes)),
+		Confirmations: int64(1 + chainHeight - blk.Height()),
+		Height:        int64(blk.Height()),
+		Size:          int32(blockSize),
 		StrippedSize:  int32(blk.MsgBlock().SerializeSizeStripped()),
 		Weight:        int32(blockchain.GetBlockWeight(blk)),
 		Bits:          strconv.FormatInt(int64(blockHeader.Bits), 16),
 		Difficulty:    getDifficultyRatio(blockHeader.Bits, params),
-		NextHash:      nextHashString,
 	}
+}
 
-	if *c.Verbosity == 1 {
-		transactions := blk.Transactions()
-		txNames := make([]string, len(transactions))
-		for i, tx := range transactions {
-			txNames[i] = tx.Hash().String()
-		}
+// DecodeBlock returns the JSON object of blk, a block of the main chain whose
+// tip is at chainHeight, as returned by a getblock command with a verbosity of
+// 2, less the hash of the next block and the proposer.  It is used to decode
+// blocks outside of the RPC server.
+func DecodeBlock(blk *btcutil.Block, chainHeight int32, params *chaincfg.Params) json.Marshaler {
+	return &getBlockVerboseTxReply{
+		GetBlockVerboseResult: blockVerboseResult(blk,
+			blk.MsgBlock().SerializeSize(), chainHeight, params),
+		params:      params,
+		block:       blk,
+		chainHeight: chainHeight,
+	}
+}
 
-		blockReply.Tx = txNames
-	} else {
-		txns := blk.Transactions()
-		rawTxns := make([]btcjson.TxRawResult, len(txns))
-		for i, tx := range txns {
-			rawTxn, err := createTxRawResult(params, tx.MsgTx(),
-				tx.Hash().String(), blockHeader, hash.String(),
-				blockHeight, best.Height)
-			if err != nil {
-				return nil, err
+// rpcStreamer is implemented by results which are written to the reply of a
+// single HTTP request as they are encoded, instead of being marshalled in
+// memory first.  They are still marshalled whole where the reply is
+// buffered, as for websocket clients and the entries of a batch.
+type rpcStreamer interface {
+	json.Marshaler
+
+	// writeJSON writes the JSON encoding of the result to w.
+	writeJSON(w io.Writer) error
+}
+
+// getBlockVerboseTxReply is the reply to a getblock command with a verbosity
+// of 2, which encodes the transactions of the block as it is written.
+type getBlockVerboseTxReply struct {
+	btcjson.GetBlockVerboseResult
+
+	params      *chaincfg.Params
+	block       *btcutil.Block
+	chainHeight int32
+}
+
+// MarshalJSON returns the JSON encoding of the reply.
+func (r *getBlockVerboseTxReply) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := r.writeJSON(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeJSON writes the JSON encoding of the reply to w, which is the same as
+// that of the GetBlockVerboseResult holding the results of all transactions.
+func (r *getBlockVerboseTxReply) writeJSON(w io.Writer) error {
+	// Encode the block with a single empty transaction result to find where
+	// the results of the transactions go.
+	reply := r.GetBlockVerboseResult
+	reply.RawTx = []btcjson.TxRawResult{{}}
+	replyJSON, err := json.Marshal(&reply)
+	if err != nil {
+		return err
+	}
+	emptyTxJSON, err := json.Marshal(&reply.RawTx[0])
+	if err != nil {
+		return err
+	}
+	const rawTxKey = `"rawtx":[`
+	start := bytes.Index(replyJSON, []byte(rawTxKey+string(emptyTxJSON)))
+	if start == -1 {
+		return errors.New("failed to find transactions in block reply")
+	}
+	start += len(rawTxKey)
+	if _, err := w.Write(replyJSON[:start]); err != nil {
+		return err
+	}
+
+	blockHeader := &r.block.MsgBlock().Header
+	blockHash := r.block.Hash().String()
+	for i, tx := range r.block.Transactions() {
+		rawTxn, err := createTxRawResult(r.params, tx.MsgTx(),
+			tx.Hash().String(), blockHeader, blockHash,
+			r.block.Height(), r.chainHeight)
+		if err != nil {
+			return err
+		}
+		txJSON, err := json.Marshal(rawTxn)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
 			}
-			rawTxns[i] = *rawTxn
 		}
-		blockReply.RawTx = rawTxns
+		if _, err := w.Write(txJSON); err != nil {
+			return err
+		}
 	}
 
-	return blockReply, nil
+	_, err = w.Write(replyJSON[start+len(emptyTxJSON):])
+	return err
 }
 
 // softForkStatus converts a ThresholdState state into a human readable string
@@ -1317,6 +1699,11 @@ func handleGetBlockChainInfo(s *rpcServer, cmd any, closeChan <-chan struct{}) (
 		}
 	}
 
+	// Describe the consensus the chain is run by when provided by the VM.
+	if s.cfg.ConsensusInfo != nil {
+		chainInfo.ConsensusInfo = s.cfg.ConsensusInfo()
+	}
+
 	return chainInfo, nil
 }
 
@@ -1326,6 +1713,47 @@ func handleGetBlockCount(s *rpcServer, cmd any, closeChan <-chan struct{}) (any,
 	return int64(best.Height), nil
 }
 
+// checkBlockFilterType returns an error unless filterType is nil or the basic
+// filter type, the only type of filter the VM builds.
+func checkBlockFilterType(filterType *btcjson.FilterTypeName) error {
+	if filterType != nil && *filterType != btcjson.FilterTypeBasic {
+		return &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Unknown filtertype",
+		}
+	}
+	return nil
+}
+
+// handleGetBlockFilter implements the getblockfilter command.
+func handleGetBlockFilter(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	c := cmd.(*btcjson.GetBlockFilterCmd)
+
+	if s.cfg.BlockFilter == nil {
+		return nil, errors.New("Block filters unavailable")
+	}
+	if err := checkBlockFilterType(c.FilterType); err != nil {
+		return nil, err
+	}
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+
+	result, err := s.cfg.BlockFilter(hash)
+	if err != nil {
+		context := "Failed to get block filter"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	if result == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Filter not found",
+		}
+	}
+	return result, nil
+}
+
 // handleGetBlockHash implements the getblockhash command.
 func handleGetBlockHash(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
 	c := cmd.(*btcjson.GetBlockHashCmd)
@@ -1390,81 +1818,462 @@ func handleGetBlockHeader(s *rpcServer, cmd any, closeChan <-chan struct{}) (any
 		nextHashString = nextHash.String()
 	}
 
-	params := s.cfg.ChainParams
-	blockHeaderReply := btcjson.GetBlockHeaderVerboseResult{
-		Hash:          c.Hash,
-		Confirmations: int64(1 + best.Height - blockHeight),
+	return s.blockHeaderVerboseResult(&blockHeader, c.Hash, blockHeight,
+		nextHashString, best.Height), nil
+}
+
+// blockHeaderVerboseResult returns the JSON object describing the block header
+// of the block with the given hash and height.
+func (s *rpcServer) blockHeaderVerboseResult(blockHeader *wire.BlockHeader,
+	hash string, blockHeight int32, nextHash string,
+	bestHeight int32) btcjson.GetBlockHeaderVerboseResult {
+
+	return btcjson.GetBlockHeaderVerboseResult{
+		Hash:          hash,
+		Confirmations: int64(1 + bestHeight - blockHeight),
 		Height:        blockHeight,
 		Version:       blockHeader.Version,
 		VersionHex:    fmt.Sprintf("%08x", blockHeader.Version),
 		MerkleRoot:    blockHeader.MerkleRoot.String(),
-		NextHash:      nextHashString,
+		NextHash:      nextHash,
 		PreviousHash:  blockHeader.PrevBlock.String(),
 		Nonce:         uint64(blockHeader.Nonce),
 		Time:          blockHeader.Timestamp.Unix(),
 		Bits:          strconv.FormatInt(int64(blockHeader.Bits), 16),
-		Difficulty:    getDifficultyRatio(blockHeader.Bits, params),
+		Difficulty:    getDifficultyRatio(blockHeader.Bits, s.cfg.ChainParams),
 	}
-	return blockHeaderReply, nil
 }
 
-// encodeTemplateID encodes the passed details into an ID that can be used to
-// uniquely identify a block template.
-func encodeTemplateID(prevHash *chainhash.Hash, lastGenerated time.Time) string {
-	return fmt.Sprintf("%s-%d", prevHash.String(), lastGenerated.Unix())
-}
+// handleGetBlockHeaders implements the getblockheaders command.  The headers
+// are read from the block index, so the block data is never loaded.
+func handleGetBlockHeaders(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	c := cmd.(*btcjson.GetBlockHeadersCmd)
 
-// decodeTemplateID decodes an ID that is used to uniquely identify a block
-// template.  This is mainly used as a mechanism to track when to update clients
-// that are using long polling for block templates.  The ID consists of the
-// previous block hash for the associated template and the time the associated
-// template was generated.
-func decodeTemplateID(templateID string) (*chainhash.Hash, int64, error) {
-	fields := strings.Split(templateID, "-")
-	if len(fields) != 2 {
-		return nil, 0, errors.New("invalid longpollid format")
+	if c.Count <= 0 || c.Count > maxBlockHeadersPerRequest {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Count must be between 1 and %d",
+				maxBlockHeadersPerRequest),
+		}
 	}
 
-	prevHash, err := chainhash.NewHashFromStr(fields[0])
+	// Fetch one more header than requested so the last header knows the
+	// hash of its next block.
+	headers, err := s.cfg.Chain.MainChainHeaders(c.StartHeight,
+		int(c.Count)+1)
 	if err != nil {
-		return nil, 0, errors.New("invalid longpollid format")
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCOutOfRange,
+			Message: "Block number out of range",
+		}
 	}
-	lastGenerated, err := strconv.ParseInt(fields[1], 10, 64)
-	if err != nil {
-		return nil, 0, errors.New("invalid longpollid format")
+	var next *blockchain.IndexedHeader
+	if len(headers) > int(c.Count) {
+		next = &headers[c.Count]
+		headers = headers[:c.Count]
 	}
 
-	return prevHash, lastGenerated, nil
-}
-
-// notifyLongPollers notifies any channels that have been registered to be
-// notified when block templates are stale.
-//
-// This function MUST be called with the state locked.
-func (state *gbtWorkState) notifyLongPollers(latestHash *chainhash.Hash, lastGenerated time.Time) {
-	// Notify anything that is waiting for a block template update from a
-	// hash which is not the hash of the tip of the best chain since their
-	// work is now invalid.
-	for hash, channels := range state.notifyMap {
-		if !hash.IsEqual(latestHash) {
-			for _, c := range channels {
-				close(c)
+	// When the verbose flag isn't set, simply return the serialized block
+	// headers as hex-encoded strings.
+	if c.Verbose != nil && !*c.Verbose {
+		hexHeaders := make([]string, 0, len(headers))
+		for i := range headers {
+			var headerBuf bytes.Buffer
+			err := headers[i].Header.Serialize(&headerBuf)
+			if err != nil {
+				context := "Failed to serialize block header"
+				return nil, internalRPCError(err.Error(), context)
 			}
-			delete(state.notifyMap, hash)
+			hexHeaders = append(hexHeaders,
+				hex.EncodeToString(headerBuf.Bytes()))
 		}
+		return hexHeaders, nil
 	}
 
-	// Return now if the provided last generated timestamp has not been
-	// initialized.
-	if lastGenerated.IsZero() {
-		return
-	}
-
-	// Return now if there is nothing registered for updates to the current
-	// best block hash.
-	channels, ok := state.notifyMap[*latestHash]
-	if !ok {
-		return
+	best := s.cfg.Chain.BestSnapshot()
+	results := make([]btcjson.GetBlockHeaderVerboseResult, 0, len(headers))
+	for i := range headers {
+		var nextHash string
+		switch {
+		case i+1 < len(headers):
+			nextHash = headers[i+1].Hash.String()
+		case next != nil:
+			nextHash = next.Hash.String()
+		}
+		results = append(results, s.blockHeaderVerboseResult(
+			&headers[i].Header, headers[i].Hash.String(),
+			headers[i].Height, nextHash, best.Height))
+	}
+	return results, nil
+}
+
+// handleGetBlockStats implements the getblockstats command.
+func handleGetBlockStats(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	c := cmd.(*btcjson.GetBlockStatsCmd)
+
+	// Ensure the selected statistics are known and find whether they need
+	// the outputs spent by the block.
+	needSpentOutputs := c.Stats == nil || len(*c.Stats) == 0
+	if c.Stats != nil {
+		for _, stat := range *c.Stats {
+			needs, ok := blockStatsNeedSpentOutputs[stat]
+			if !ok {
+				return nil, &btcjson.RPCError{
+					Code:    btcjson.ErrRPCInvalidParameter,
+					Message: fmt.Sprintf("Invalid selected statistic %s", stat),
+				}
+			}
+			needSpentOutputs = needSpentOutputs || needs
+		}
+	}
+
+	// Load the block from the main chain by height or hash.
+	var block *btcutil.Block
+	switch v := c.HashOrHeight.Value.(type) {
+	case int:
+		best := s.cfg.Chain.BestSnapshot()
+		if v < 0 || v > int(best.Height) {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Target block height %d out of "+
+					"range [0, %d]", v, best.Height),
+			}
+		}
+		var err error
+		block, err = s.cfg.Chain.BlockByHeight(int32(v))
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCBlockNotFound,
+				Message: "Block not found",
+			}
+		}
+	case string:
+		hash, err := chainhash.NewHashFromStr(v)
+		if err != nil {
+			return nil, rpcDecodeHexError(v)
+		}
+		block, err = s.cfg.Chain.BlockByHash(hash)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCBlockNotFound,
+				Message: "Block not found",
+			}
+		}
+	default:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Block must be given by height or hash",
+		}
+	}
+
+	// The statistics of a block only depend on the block and its ancestors,
+	// which are committed to by its hash, so cached statistics never need
+	// to be invalidated.  Statistics computed without the spent outputs
+	// are incomplete and are not cached.
+	var stats *btcjson.GetBlockStatsResult
+	if cached, ok := s.blockStatsCache.Lookup(*block.Hash()); ok {
+		stats = cached.(*btcjson.GetBlockStatsResult)
+	} else {
+		var stxos []blockchain.SpentTxOut
+		if needSpentOutputs {
+			var err error
+			stxos, err = s.cfg.Chain.FetchSpendJournal(block)
+			if err != nil {
+				context := "Failed to load spent outputs"
+				return nil, internalRPCError(err.Error(), context)
+			}
+		}
+
+		// The median time of the block is the median time past of a
+		// block built on top of it.
+		medianTime, err := s.cfg.Chain.PastMedianTime(&wire.BlockHeader{
+			PrevBlock: *block.Hash(),
+		})
+		if err != nil {
+			context := "Failed to obtain median time"
+			return nil, internalRPCError(err.Error(), context)
+		}
+
+		stats, err = calcBlockStats(block, stxos, needSpentOutputs,
+			medianTime, s.cfg.ChainParams)
+		if err != nil {
+			context := "Failed to compute block statistics"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		if needSpentOutputs {
+			s.blockStatsCache.Add(*block.Hash(), stats)
+		}
+	}
+
+	if c.Stats == nil || len(*c.Stats) == 0 {
+		return stats, nil
+	}
+
+	// Only return the selected statistics.
+	marshalled, err := json.Marshal(stats)
+	if err != nil {
+		context := "Failed to marshal block statistics"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(marshalled, &all); err != nil {
+		context := "Failed to unmarshal block statistics"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	selected := make(map[string]json.RawMessage, len(*c.Stats))
+	for _, stat := range *c.Stats {
+		selected[stat] = all[stat]
+	}
+	return selected, nil
+}
+
+// calcBlockStats computes the statistics of the passed block for the
+// getblockstats RPC.  The coinbase transaction is excluded from the fee and
+// size statistics.  The passed spent outputs must be those of the spend
+// journal of the block in the order they are spent, and are only used when
+// withSpentOutputs is set, otherwise the statistics that need them are left
+// zero.
+func calcBlockStats(block *btcutil.Block, stxos []blockchain.SpentTxOut,
+	withSpentOutputs bool, medianTime time.Time,
+	params *chaincfg.Params) (*btcjson.GetBlockStatsResult, error) {
+
+	header := &block.MsgBlock().Header
+	txs := block.Transactions()
+	stats := &btcjson.GetBlockStatsResult{
+		Hash:               block.Hash().String(),
+		Height:             int64(block.Height()),
+		Time:               header.Timestamp.Unix(),
+		MedianTime:         medianTime.Unix(),
+		Subsidy:            blockchain.CalcBlockSubsidy(block.Height(), params),
+		Txs:                int64(len(txs)),
+		FeeratePercentiles: []int64{0, 0, 0, 0, 0},
+	}
+
+	var (
+		fees     []int64
+		sizes    []int64
+		feeRates []weightedFeeRate
+		stxoIdx  int
+	)
+	for i, tx := range txs {
+		msgTx := tx.MsgTx()
+
+		stats.Outs += int64(len(msgTx.TxOut))
+		var totalOut int64
+		for _, txOut := range msgTx.TxOut {
+			totalOut += txOut.Value
+			if txscript.IsUnspendable(txOut.PkScript) {
+				continue
+			}
+			stats.UTXOIncrease++
+			stats.UTXOSizeIncrease += int64(txOut.SerializeSize() +
+				perUTXOOverhead)
+		}
+
+		// The coinbase does not spend outputs and does not pay fees.
+		if i == 0 {
+			continue
+		}
+
+		stats.Ins += int64(len(msgTx.TxIn))
+		stats.UTXOIncrease -= int64(len(msgTx.TxIn))
+		stats.TotalOut += totalOut
+
+		size := int64(msgTx.SerializeSize())
+		weight := blockchain.GetTransactionWeight(tx)
+		sizes = append(sizes, size)
+		stats.TotalSize += size
+		stats.TotalWeight += weight
+		if msgTx.HasWitness() {
+			stats.SegWitTxs++
+			stats.SegWitTotalSize += size
+			stats.SegWitTotalWeight += weight
+		}
+
+		if !withSpentOutputs {
+			continue
+		}
+		if stxoIdx+len(msgTx.TxIn) > len(stxos) {
+			return nil, fmt.Errorf("spend journal of block %v has %d "+
+				"entries, which is less than its inputs",
+				block.Hash(), len(stxos))
+		}
+		var totalIn int64
+		for _, stxo := range stxos[stxoIdx : stxoIdx+len(msgTx.TxIn)] {
+			totalIn += stxo.Amount
+			spent := wire.NewTxOut(stxo.Amount, stxo.PkScript)
+			stats.UTXOSizeIncrease -= int64(spent.SerializeSize() +
+				perUTXOOverhead)
+		}
+		stxoIdx += len(msgTx.TxIn)
+
+		// Fee rates are in satoshis per virtual byte.
+		fee := totalIn - totalOut
+		var feeRate int64
+		if weight > 0 {
+			feeRate = fee * blockchain.WitnessScaleFactor / weight
+		}
+		fees = append(fees, fee)
+		feeRates = append(feeRates, weightedFeeRate{
+			feeRate: feeRate,
+			weight:  weight,
+		})
+		stats.TotalFee += fee
+	}
+	if withSpentOutputs && stxoIdx != len(stxos) {
+		return nil, fmt.Errorf("spend journal of block %v has %d entries, "+
+			"but the block has %d inputs", block.Hash(), len(stxos),
+			stxoIdx)
+	}
+
+	if len(sizes) > 0 {
+		stats.AverageTxSize = stats.TotalSize / int64(len(sizes))
+		stats.MinTxSize, stats.MaxTxSize = minMaxInt64(sizes)
+		stats.MedianTxSize = medianInt64(sizes)
+	}
+	if len(fees) > 0 {
+		stats.AverageFee = stats.TotalFee / int64(len(fees))
+		stats.MinFee, stats.MaxFee = minMaxInt64(fees)
+		stats.MedianFee = medianInt64(fees)
+
+		rates := make([]int64, len(feeRates))
+		for i, feeRate := range feeRates {
+			rates[i] = feeRate.feeRate
+		}
+		stats.MinFeeRate, stats.MaxFeeRate = minMaxInt64(rates)
+		if stats.TotalWeight > 0 {
+			stats.AverageFeeRate = stats.TotalFee *
+				blockchain.WitnessScaleFactor / stats.TotalWeight
+		}
+		stats.FeeratePercentiles = feeRatePercentiles(feeRates,
+			stats.TotalWeight)
+	}
+
+	return stats, nil
+}
+
+// weightedFeeRate is the fee rate of a transaction along with its weight.
+type weightedFeeRate struct {
+	feeRate int64
+	weight  int64
+}
+
+// feeRatePercentiles returns the 10th, 25th, 50th, 75th and 90th percentiles
+// of the passed fee rates weighted by the weight of their transactions.
+func feeRatePercentiles(feeRates []weightedFeeRate, totalWeight int64) []int64 {
+	sorted := make([]weightedFeeRate, len(feeRates))
+	copy(sorted, feeRates)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].feeRate < sorted[j].feeRate
+	})
+
+	thresholds := []float64{0.10, 0.25, 0.50, 0.75, 0.90}
+	percentiles := make([]int64, len(thresholds))
+	var cumulative int64
+	next := 0
+	for _, feeRate := range sorted {
+		cumulative += feeRate.weight
+		for next < len(thresholds) &&
+			float64(cumulative) >= float64(totalWeight)*thresholds[next] {
+
+			percentiles[next] = feeRate.feeRate
+			next++
+		}
+	}
+
+	// Rounding may leave the highest percentiles unset, which are then the
+	// highest fee rate.
+	for ; next < len(thresholds) && len(sorted) > 0; next++ {
+		percentiles[next] = sorted[len(sorted)-1].feeRate
+	}
+	return percentiles
+}
+
+// minMaxInt64 returns the min and max of the passed non-empty values.
+func minMaxInt64(values []int64) (int64, int64) {
+	minimum, maximum := values[0], values[0]
+	for _, v := range values[1:] {
+		if v < minimum {
+			minimum = v
+		}
+		if v > maximum {
+			maximum = v
+		}
+	}
+	return minimum, maximum
+}
+
+// medianInt64 returns the median of the passed non-empty values, truncated to
+// an integer when there are an even number of values.
+func medianInt64(values []int64) int64 {
+	sorted := make([]int64, len(values))
+	copy(sorted, values)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// encodeTemplateID encodes the passed details into an ID that can be used to
+// uniquely identify a block template.
+func encodeTemplateID(prevHash *chainhash.Hash, lastGenerated time.Time) string {
+	return fmt.Sprintf("%s-%d", prevHash.String(), lastGenerated.Unix())
+}
+
+// decodeTemplateID decodes an ID that is used to uniquely identify a block
+// template.  This is mainly used as a mechanism to track when to update clients
+// that are using long polling for block templates.  The ID consists of the
+// previous block hash for the associated template and the time the associated
+// template was generated.
+func decodeTemplateID(templateID string) (*chainhash.Hash, int64, error) {
+	fields := strings.Split(templateID, "-")
+	if len(fields) != 2 {
+		return nil, 0, errors.New("invalid longpollid format")
+	}
+
+	prevHash, err := chainhash.NewHashFromStr(fields[0])
+	if err != nil {
+		return nil, 0, errors.New("invalid longpollid format")
+	}
+	lastGenerated, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return nil, 0, errors.New("invalid longpollid format")
+	}
+
+	return prevHash, lastGenerated, nil
+}
+
+// notifyLongPollers notifies any channels that have been registered to be
+// notified when block templates are stale.
+//
+// This function MUST be called with the state locked.
+func (state *gbtWorkState) notifyLongPollers(latestHash *chainhash.Hash, lastGenerated time.Time) {
+	// Notify anything that is waiting for a block template update from a
+	// hash which is not the hash of the tip of the best chain since their
+	// work is now invalid.
+	for hash, channels := range state.notifyMap {
+		if !hash.IsEqual(latestHash) {
+			for _, c := range channels {
+				close(c)
+			}
+			delete(state.notifyMap, hash)
+		}
+	}
+
+	// Return now if the provided last generated timestamp has not been
+	// initialized.
+	if lastGenerated.IsZero() {
+		return
+	}
+
+	// Return now if there is nothing registered for updates to the current
+	// best block hash.
+	channels, ok := state.notifyMap[*latestHash]
+	if !ok {
+		return
 	}
 
 	// Notify anything that is waiting for a block template update from a
@@ -1610,10 +2419,10 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 			blockchain.CompactToBig(msgBlock.Header.Bits))
 
 		// Get the minimum allowed timestamp for the block based on the
-		// median timestamp of the last several blocks per the chain
-		// consensus rules.
+		// median timestamp of the last several blocks, or the timestamp
+		// of the best block, per the chain consensus rules.
 		best := s.cfg.Chain.BestSnapshot()
-		minTimestamp := mining.MinimumMedianTime(best)
+		minTimestamp := mining.MinimumBlockTime(best, s.cfg.ChainParams)
 
 		// Update work state to ensure another block template isn't
 		// generated until needed.
@@ -1700,7 +2509,7 @@ func (state *gbtWorkState) blockTemplateResult(
 	msgBlock := template.Block
 	header := &msgBlock.Header
 	adjustedTime := state.timeSource.AdjustedTime()
-	maxTime := adjustedTime.Add(time.Second * blockchain.MaxTimeOffsetSeconds)
+	maxTime := adjustedTime.Add(state.maxTimeOffset)
 	if header.Timestamp.After(maxTime) {
 		return nil, &btcjson.RPCError{
 			Code: btcjson.ErrRPCOutOfRange,
@@ -2219,22 +3028,52 @@ func handleGetChainTips(s *rpcServer, cmd any, closeChan <-chan struct{}) (any,
 
 	ret := make([]btcjson.GetChainTipsResult, 0, len(chainTips))
 	for _, chainTip := range chainTips {
-		ret = append(ret, struct {
-			Height    int32  "json:\"height\""
-			Hash      string "json:\"hash\""
-			BranchLen int32  "json:\"branchlen\""
-			Status    string "json:\"status\""
-		}{
+		result := btcjson.GetChainTipsResult{
 			Height:    chainTip.Height,
 			Hash:      chainTip.BlockHash.String(),
 			BranchLen: chainTip.BranchLen,
 			Status:    chainTip.Status.String(),
-		})
+		}
+		if s.cfg.ChainTipStatus != nil {
+			result.ConsensusStatus = s.cfg.ChainTipStatus(&chainTip.BlockHash, chainTip.Height)
+		}
+		ret = append(ret, result)
 	}
 
 	return ret, nil
 }
 
+// handleGetCFHeaders implements the getcfheaders command.
+func handleGetCFHeaders(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	c := cmd.(*btcjson.GetCFHeadersCmd)
+
+	if s.cfg.CFHeaders == nil {
+		return nil, errors.New("Block filters unavailable")
+	}
+	if err := checkBlockFilterType(c.FilterType); err != nil {
+		return nil, err
+	}
+	stopHash, err := chainhash.NewHashFromStr(c.StopHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.StopHash)
+	}
+
+	result, err := s.cfg.CFHeaders(c.StartHeight, stopHash)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+	if result == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Filter not found",
+		}
+	}
+	return result, nil
+}
+
 // handleGetCFilter implements the getcfilter command.
 func handleGetCFilter(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
 	if s.cfg.CfIndex == nil {
@@ -2295,6 +3134,20 @@ func handleGetCFilterHeader(s *rpcServer, cmd any, closeChan <-chan struct{}) (a
 	return hash.String(), nil
 }
 
+// handleGetCheckpoint implements the getcheckpoint command.
+func handleGetCheckpoint(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	if s.cfg.Checkpoint == nil {
+		return nil, errors.New("Checkpoint unavailable")
+	}
+
+	result, err := s.cfg.Checkpoint()
+	if err != nil {
+		context := "Failed to get checkpoint"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	return result, nil
+}
+
 // handleGetConnectionCount implements the getconnectioncount command.
 func handleGetConnectionCount(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
 	return s.cfg.ConnMgr.ConnectedCount(), nil
@@ -2305,17 +3158,58 @@ func handleGetCurrentNet(s *rpcServer, cmd any, closeChan <-chan struct{}) (any,
 	return s.cfg.ChainParams.Net, nil
 }
 
-// handleGetDifficulty implements the getdifficulty command.
+// handleGetConsensusInfo implements the getconsensusinfo command.
+func handleGetConsensusInfo(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	if s.cfg.ConsensusInfo == nil {
+		return nil, errors.New("Consensus info unavailable")
+	}
+	return s.cfg.ConsensusInfo(), nil
+}
+
+// handleGetDifficulty implements the getdifficulty command.  Blocks of chains
+// without proof of work are all at the minimum difficulty, which is 1.
 func handleGetDifficulty(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	if s.cfg.ChainParams.PoWDisabled {
+		return float64(1), nil
+	}
 	best := s.cfg.Chain.BestSnapshot()
 	return getDifficultyRatio(best.Bits, s.cfg.ChainParams), nil
 }
 
+// handleGetDoubleSpends implements the getdoublespends command.
+func handleGetDoubleSpends(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	c := cmd.(*btcjson.GetDoubleSpendsCmd)
+
+	txHash, err := chainhash.NewHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+
+	if s.cfg.DoubleSpends == nil {
+		return nil, errors.New("Double spends unavailable")
+	}
+	return s.cfg.DoubleSpends(txHash), nil
+}
+
 // handleGetGenerate implements the getgenerate command.
 func handleGetGenerate(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
 	return s.cfg.CPUMiner.IsMining(), nil
 }
 
+// handleGetGossipInfo implements the getgossipinfo command.
+func handleGetGossipInfo(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	if s.cfg.GossipInfo == nil {
+		return nil, errors.New("Gossip info unavailable")
+	}
+
+	result, err := s.cfg.GossipInfo()
+	if err != nil {
+		context := "Failed to get gossip info"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	return result, nil
+}
+
 // handleGetHashesPerSec implements the gethashespersec command.
 func handleGetHashesPerSec(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
 	return int64(s.cfg.CPUMiner.HashesPerSecond()), nil
@@ -2382,6 +3276,69 @@ func handleGetInfo(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error
 	return ret, nil
 }
 
+// handleGetMempoolAncestors implements the getmempoolancestors command.
+func handleGetMempoolAncestors(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	c := cmd.(*btcjson.GetMempoolAncestorsCmd)
+	return mempoolFamily(c.TxID, c.Verbose, s.cfg.TxMemPool.MempoolAncestors)
+}
+
+// handleGetMempoolDescendants implements the getmempooldescendants command.
+func handleGetMempoolDescendants(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	c := cmd.(*btcjson.GetMempoolDescendantsCmd)
+	return mempoolFamily(c.TxID, c.Verbose, s.cfg.TxMemPool.MempoolDescendants)
+}
+
+// mempoolFamily returns the entries returned by family for the mempool
+// transaction with the passed hash, or only their sorted hashes if the verbose
+// flag is not set.
+func mempoolFamily(txID string, verbose *bool,
+	family func(*chainhash.Hash) (map[string]*btcjson.GetMempoolEntryResult, error)) (any, error) {
+
+	txHash, err := chainhash.NewHashFromStr(txID)
+	if err != nil {
+		return nil, rpcDecodeHexError(txID)
+	}
+
+	entries, err := family(txHash)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCNoTxInfo,
+			Message: "Transaction not in mempool",
+		}
+	}
+
+	if verbose != nil && *verbose {
+		return entries, nil
+	}
+	hashStrings := make([]string, 0, len(entries))
+	for hash := range entries {
+		hashStrings = append(hashStrings, hash)
+	}
+	sort.Strings(hashStrings)
+
+	return hashStrings, nil
+}
+
+// handleGetMempoolEntry implements the getmempoolentry command.
+func handleGetMempoolEntry(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	c := cmd.(*btcjson.GetMempoolEntryCmd)
+
+	txHash, err := chainhash.NewHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+
+	entry, err := s.cfg.TxMemPool.MempoolEntry(txHash)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCNoTxInfo,
+			Message: "Transaction not in mempool",
+		}
+	}
+
+	return entry, nil
+}
+
 // handleGetMempoolInfo implements the getmempoolinfo command.
 func handleGetMempoolInfo(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
 	mempoolTxns := s.cfg.TxMemPool.TxDescs()
@@ -2392,8 +3349,15 @@ func handleGetMempoolInfo(s *rpcServer, cmd any, closeChan <-chan struct{}) (any
 	}
 
 	ret := &btcjson.GetMempoolInfoResult{
-		Size:  int64(len(mempoolTxns)),
-		Bytes: numBytes,
+		Size:               int64(len(mempoolTxns)),
+		Bytes:              numBytes,
+		Orphans:            int64(s.cfg.TxMemPool.OrphanCount()),
+		MaxMempool:         cfg.MaxMempoolBytes,
+		MempoolMinFee:      float64(s.cfg.TxMemPool.MinFeeRate()) / 1000,
+		MinGossipFeeRate:   cfg.MinGossipFeeRate,
+		MinRelayFeeRate:    cfg.MinRelayFeeRate,
+		DataCarrier:        !cfg.NoDataCarrier,
+		MaxDataCarrierSize: cfg.MaxDataCarrierSize,
 	}
 
 	return ret, nil
@@ -2431,6 +3395,20 @@ func handleGetMiningInfo(s *rpcServer, cmd any, closeChan <-chan struct{}) (any,
 		NetworkHashPS:      networkHashesPerSec,
 		PooledTx:           uint64(s.cfg.TxMemPool.Count()),
 		TestNet:            cfg.TestNet,
+		BlockMaxWeight:     cfg.BlockMaxWeight,
+		BlockMaxSize:       cfg.BlockMaxSize,
+	}
+	if s.cfg.MiningInfo != nil {
+		result.Metal = s.cfg.MiningInfo()
+	}
+
+	// Blocks of chains without proof of work are built rather than mined,
+	// so the node generates blocks when its block builder is enabled.
+	if s.cfg.ChainParams.PoWDisabled {
+		result.Difficulty = 1
+		result.Generate = result.Metal != nil && result.Metal.BuilderEnabled
+		result.GenProcLimit = -1
+		result.HashesPerSec = 0
 	}
 	return &result, nil
 }
@@ -2480,6 +3458,21 @@ func handleGetNetworkInfo(s *rpcServer, cmd any, closeChan <-chan struct{}) (any
 		IncrementalFee:  0.00001, // Standard incremental relay fee
 		LocalAddresses:  []btcjson.LocalAddressesResult{},
 		Warnings:        btcjson.StringOrArray{},
+
+		MinGossipFeeRate: cfg.MinGossipFeeRate,
+		MinRelayFeeRate:  cfg.MinRelayFeeRate,
+	}
+
+	// Peers are connected through the Metal network, which does not tell
+	// inbound and outbound connections apart.
+	if s.cfg.NetworkInfo != nil {
+		info := s.cfg.NetworkInfo()
+		reply.Version = info.Version
+		reply.SubVersion = info.SubVersion
+		reply.Connections = info.Metal.Peers
+		reply.ConnectionsIn = 0
+		reply.ConnectionsOut = info.Metal.Peers
+		reply.Metal = info.Metal
 	}
 
 	return reply, nil
@@ -2493,6 +3486,11 @@ func handleGetNetworkHashPS(s *rpcServer, cmd any, closeChan <-chan struct{}) (a
 
 	c := cmd.(*btcjson.GetNetworkHashPSCmd)
 
+	// Blocks of chains without proof of work are not mined.
+	if s.cfg.ChainParams.PoWDisabled {
+		return float64(0), nil
+	}
+
 	// When the passed height is too high or zero, just return 0 now
 	// since we can't reasonably calculate the number of network hashes
 	// per second from invalid values.  When it's negative, use the current
@@ -2618,6 +3616,10 @@ func handleGetNodeAddresses(s *rpcServer, cmd any, closeChan <-chan struct{}) (a
 
 // handleGetPeerInfo implements the getpeerinfo command.
 func handleGetPeerInfo(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	if s.cfg.PeerInfo != nil {
+		return s.cfg.PeerInfo(), nil
+	}
+
 	peers := s.cfg.ConnMgr.ConnectedPeers()
 	syncPeerID := s.cfg.SyncMgr.SyncPeerID()
 	infos := make([]*btcjson.GetPeerInfoResult, 0, len(peers))
@@ -2791,9 +3793,166 @@ func handleGetRawTransaction(s *rpcServer, cmd any, closeChan <-chan struct{}) (
 	if err != nil {
 		return nil, err
 	}
-	return *rawTxn, nil
-}
-
+	if blkHash != nil {
+		rawTxn.Finalized = blockFinalized(s, blkHeight)
+	} else {
+		rawTxn.Finalized = btcjson.Bool(false)
+	}
+
+	// Describe the outputs spent by a transaction of the main chain when
+	// the spent output index is enabled.
+	if blkHash != nil && s.cfg.SpentIndex != nil {
+		err := addVinPrevOuts(s, txHash, mtx, rawTxn.Vin)
+		if err != nil {
+			context := "Failed to retrieve spent outputs"
+			return nil, internalRPCError(err.Error(), context)
+		}
+	}
+	return *rawTxn, nil
+}
+
+// blockFinalized returns whether the block of the main chain at the passed
+// height is accepted by consensus, and thus final, or nil when the last
+// accepted height is not known yet.
+func blockFinalized(s *rpcServer, height int32) *bool {
+	tip, _ := s.ntfnMgr.AcceptedTip()
+	if tip == nil {
+		return nil
+	}
+	return btcjson.Bool(int64(height) <= tip.Height)
+}
+
+// handleGetTxConfirmations implements the gettxconfirmations command.  A
+// transaction is finalized once the block containing it is accepted by
+// consensus, regardless of its number of confirmations.
+func handleGetTxConfirmations(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	c := cmd.(*btcjson.GetTxConfirmationsCmd)
+
+	// Convert the provided transaction hash hex to a Hash.
+	txHash, err := chainhash.NewHashFromStr(c.Txid)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Txid)
+	}
+
+	tip, _ := s.ntfnMgr.AcceptedTip()
+	if tip == nil {
+		return nil, errAcceptedTipUnavailable
+	}
+	result := &btcjson.GetTxConfirmationsResult{
+		AcceptedHeight: int32(tip.Height),
+	}
+
+	// Transactions of the memory pool are not confirmed yet.
+	if s.cfg.TxMemPool.HaveTransaction(txHash) {
+		return result, nil
+	}
+
+	if s.cfg.TxIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCNoTxInfo,
+			Message: "The transaction index must be " +
+				"enabled to query the blockchain " +
+				"(specify --txindex)",
+		}
+	}
+
+	// Look up the block containing the transaction.
+	blockRegion, err := s.cfg.TxIndex.TxBlockRegion(txHash)
+	if err != nil {
+		context := "Failed to retrieve transaction location"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	if blockRegion == nil {
+		return nil, rpcNoTxInfoError(txHash)
+	}
+	blkHeight, err := s.cfg.Chain.BlockHeightByHash(blockRegion.Hash)
+	if err != nil {
+		context := "Failed to retrieve block height"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	chainHeight := s.cfg.Chain.BestSnapshot().Height
+	result.BlockHash = blockRegion.Hash.String()
+	result.BlockHeight = blkHeight
+	result.Confirmations = int64(1 + chainHeight - blkHeight)
+	result.Finalized = int64(blkHeight) <= tip.Height
+	return result, nil
+}
+
+// addVinPrevOuts sets the previous output information of the inputs of the
+// passed transaction from the spent output index.  Inputs which the index
+// doesn't record as spent by the transaction are left unchanged.
+func addVinPrevOuts(s *rpcServer, txHash *chainhash.Hash, mtx *wire.MsgTx,
+	vinList []btcjson.Vin) error {
+
+	if blockchain.IsCoinBaseTx(mtx) {
+		return nil
+	}
+
+	for i, txIn := range mtx.TxIn {
+		info, err := s.cfg.SpentIndex.SpentInfo(&txIn.PreviousOutPoint)
+		if err != nil {
+			return err
+		}
+		if info == nil || info.TxHash != *txHash {
+			continue
+		}
+
+		// Ignore the error here since an error means the script
+		// couldn't parse and there is no additional information about
+		// it anyways.
+		_, addrs, _, _ := txscript.ExtractPkScriptAddrs(info.PkScript,
+			s.cfg.ChainParams)
+		encodedAddrs := make([]string, len(addrs))
+		for j, addr := range addrs {
+			encodedAddrs[j] = addr.EncodeAddress()
+		}
+		vinList[i].PrevOut = &btcjson.PrevOut{
+			Addresses: encodedAddrs,
+			Value:     btcutil.Amount(info.Amount).ToBTC(),
+		}
+	}
+	return nil
+}
+
+// handleGetSpentInfo implements the getspentinfo command.
+func handleGetSpentInfo(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	c := cmd.(*btcjson.GetSpentInfoCmd)
+
+	if s.cfg.SpentIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCNoTxInfo,
+			Message: "The spent output index must be enabled " +
+				"(specify --spentindex)",
+		}
+	}
+
+	// Convert the provided transaction hash hex to a Hash.
+	txHash, err := chainhash.NewHashFromStr(c.Txid)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Txid)
+	}
+
+	info, err := s.cfg.SpentIndex.SpentInfo(wire.NewOutPoint(txHash, c.Vout))
+	if err != nil {
+		context := "Failed to retrieve spent output"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	if info == nil {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidAddressOrKey,
+			Message: fmt.Sprintf("Output %v:%d is not spent in the "+
+				"main chain", txHash, c.Vout),
+		}
+	}
+
+	return &btcjson.GetSpentInfoResult{
+		Txid:   info.TxHash.String(),
+		Index:  info.InputIndex,
+		Height: info.Height,
+	}, nil
+}
+
 // handleGetTxOut handles gettxout commands.
 func handleGetTxOut(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
 	c := cmd.(*btcjson.GetTxOutCmd)
@@ -2910,6 +4069,98 @@ func handleGetTxOut(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, erro
 	return txOutReply, nil
 }
 
+// handleGetTxOutProof implements the gettxoutproof command.
+func handleGetTxOutProof(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	c := cmd.(*btcjson.GetTxOutProofCmd)
+
+	if len(c.TxIDs) == 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Parameter 'txids' cannot be empty",
+		}
+	}
+	txIDs := make(map[chainhash.Hash]struct{}, len(c.TxIDs))
+	var firstTxID *chainhash.Hash
+	for _, txID := range c.TxIDs {
+		hash, err := chainhash.NewHashFromStr(txID)
+		if err != nil {
+			return nil, rpcDecodeHexError(txID)
+		}
+		if _, ok := txIDs[*hash]; ok {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "Invalid parameter, duplicated txid: " + txID,
+			}
+		}
+		txIDs[*hash] = struct{}{}
+		if firstTxID == nil {
+			firstTxID = hash
+		}
+	}
+
+	// Look up the block of the transactions in the transaction index when
+	// it is not provided.
+	var blockHash *chainhash.Hash
+	if c.BlockHash != nil {
+		var err error
+		blockHash, err = chainhash.NewHashFromStr(*c.BlockHash)
+		if err != nil {
+			return nil, rpcDecodeHexError(*c.BlockHash)
+		}
+	} else {
+		if s.cfg.TxIndex == nil {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCNoTxInfo,
+				Message: "The transaction index must be " +
+					"enabled to find the block of the " +
+					"transactions (specify --txindex or a " +
+					"block hash)",
+			}
+		}
+		blockRegion, err := s.cfg.TxIndex.TxBlockRegion(firstTxID)
+		if err != nil {
+			context := "Failed to retrieve transaction location"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		if blockRegion == nil {
+			return nil, rpcNoTxInfoError(firstTxID)
+		}
+		blockHash = blockRegion.Hash
+	}
+
+	block, err := s.cfg.Chain.BlockByHash(blockHash)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+
+	// The merkle root of the header commits to the txids of the
+	// transactions, so a proof cannot be built for their wtxids.
+	mBlock, matched := bloom.NewMerkleBlockWithTxIDs(block, txIDs)
+	if len(matched) != len(txIDs) {
+		for _, tx := range block.Transactions() {
+			if _, ok := txIDs[*tx.WitnessHash()]; ok && tx.HasWitness() {
+				return nil, &btcjson.RPCError{
+					Code: btcjson.ErrRPCInvalidAddressOrKey,
+					Message: fmt.Sprintf("%v is the wtxid of "+
+						"transaction %v, proofs are built "+
+						"from txids", tx.WitnessHash(),
+						tx.Hash()),
+				}
+			}
+		}
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Not all transactions found in specified or " +
+				"retrieved block",
+		}
+	}
+
+	return messageToHex(mBlock)
+}
+
 // handleInvalidateBlock implements the invalidateblock command.
 func handleInvalidateBlock(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
 	c := cmd.(*btcjson.InvalidateBlockCmd)
@@ -2923,8 +4174,35 @@ func handleInvalidateBlock(s *rpcServer, cmd any, closeChan <-chan struct{}) (an
 		}
 	}
 
+	block, err := s.cfg.Chain.BlockByHashAny(invalidateHash)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+
+	// Blocks accepted by consensus are final, invalidating them would only
+	// make the node diverge from the network.
+	if tip, _ := s.ntfnMgr.AcceptedTip(); tip != nil && int64(block.Height()) <= tip.Height {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Block at height %d is at or below the "+
+				"last accepted height %d", block.Height(), tip.Height),
+		}
+	}
+
 	err = s.cfg.Chain.InvalidateBlock(invalidateHash)
-	return nil, err
+	if err != nil {
+		return nil, err
+	}
+
+	rpcsLog.Infof("Invalidated block %v at height %d", invalidateHash,
+		block.Height())
+	if s.cfg.BlockValidityChanged != nil {
+		s.cfg.BlockValidityChanged(invalidateHash, block.Height(), false)
+	}
+	return nil, nil
 }
 
 // handleHelp implements the help command.
@@ -3223,8 +4501,55 @@ func handleReconsiderBlock(s *rpcServer, cmd any, closeChan <-chan struct{}) (an
 		}
 	}
 
+	block, err := s.cfg.Chain.BlockByHashAny(reconsiderHash)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+
 	err = s.cfg.Chain.ReconsiderBlock(reconsiderHash)
-	return nil, err
+	if err != nil {
+		return nil, err
+	}
+
+	rpcsLog.Infof("Reconsidered block %v at height %d", reconsiderHash,
+		block.Height())
+	if s.cfg.BlockValidityChanged != nil {
+		s.cfg.BlockValidityChanged(reconsiderHash, block.Height(), true)
+	}
+	return nil, nil
+}
+
+// handleResyncChainState implements the resyncchainstate command.
+func handleResyncChainState(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	c := cmd.(*btcjson.ResyncChainStateCmd)
+
+	if s.cfg.ResyncChainState == nil {
+		return nil, errors.New("Chain state resync unavailable")
+	}
+
+	result, err := s.cfg.ResyncChainState(c.StatusOnly != nil && *c.StatusOnly)
+	if err != nil {
+		context := "Failed to resync chain state"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	return result, nil
+}
+
+// handleRunMaintenance implements the runmaintenance command.
+func handleRunMaintenance(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	if s.cfg.RunMaintenance == nil {
+		return nil, errors.New("Maintenance unavailable")
+	}
+
+	result, err := s.cfg.RunMaintenance()
+	if err != nil {
+		context := "Failed to run maintenance"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	return result, nil
 }
 
 // handleSearchRawTransactions implements the searchrawtransactions command.
@@ -3512,52 +4837,112 @@ func handleSendRawTransaction(s *rpcServer, cmd any, closeChan <-chan struct{})
 		}
 	}
 
-	// Use 0 for the tag to represent local node.
+	maxFeeRate, err := sendRawTxMaxFeeRate(c.FeeSetting)
+	if err != nil {
+		return nil, err
+	}
 	tx := btcutil.NewTx(&msgTx)
-	acceptedTxs, err := s.cfg.TxMemPool.ProcessTransaction(tx, false, false, 0)
+	acceptedTxs, err := AcceptLocalTransaction(s.cfg.TxMemPool, tx, maxFeeRate)
 	if err != nil {
-		// When the error is a rule error, it means the transaction was
-		// simply rejected as opposed to something actually going wrong,
-		// so log it as such. Otherwise, something really did go wrong,
-		// so log it as an actual error and return.
-		ruleErr, ok := err.(mempool.RuleError)
-		if !ok {
-			rpcsLog.Errorf("Failed to process transaction %v: %v",
-				tx.Hash(), err)
+		return nil, err
+	}
+
+	// Relay the transaction and the orphans it accepted right away, as
+	// they were submitted by a client.
+	s.cfg.ConnMgr.RelayLocalTransactions(acceptedTxs)
+
+	// Notify both websocket and getblocktemplate long poll clients of all
+	// newly accepted transactions.
+	s.NotifyNewTransactions(acceptedTxs)
+
+	// Keep track of all the sendrawtransaction request txns so that they
+	// can be rebroadcast if they don't make their way into a block.
+	txD := acceptedTxs[0]
+	iv := wire.NewInvVect(wire.InvTypeTx, txD.Tx.Hash())
+	s.cfg.ConnMgr.AddRebroadcastInventory(iv, txD)
+
+	return tx.Hash().String(), nil
+}
+
+// sendRawTxMaxFeeRate returns the max fee rate in BTC/kvB of the transaction
+// of a sendrawtransaction command with the given fee setting, following
+// bitcoind: nil for the default of defaultMaxFeeRate, or zero if the fee rate
+// is not limited, which is requested by a zero maxfeerate or by the legacy
+// allowhighfees flag.
+func sendRawTxMaxFeeRate(setting *btcjson.AllowHighFeesOrMaxFeeRate) (*float64, error) {
+	if setting == nil {
+		return nil, nil
+	}
 
+	switch value := setting.Value.(type) {
+	case nil:
+		return nil, nil
+
+	case *bool:
+		if value == nil || !*value {
+			return nil, nil
+		}
+		return btcjson.Float64(0), nil
+
+	case *float64:
+		if value != nil && *value < 0 {
 			return nil, &btcjson.RPCError{
-				Code:    btcjson.ErrRPCTxError,
-				Message: "TX rejected: " + err.Error(),
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "maxfeerate must not be negative",
 			}
 		}
+		return value, nil
 
-		rpcsLog.Debugf("Rejected transaction %v: %v", tx.Hash(), err)
+	default:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("invalid maxfeerate %v", value),
+		}
+	}
+}
 
-		// We'll then map the rule error to the appropriate RPC error,
-		// matching bitcoind's behavior.
-		code := btcjson.ErrRPCTxError
-		if txRuleErr, ok := ruleErr.Err.(mempool.TxRuleError); ok {
-			errDesc := txRuleErr.Description
-			switch {
-			case strings.Contains(
-				strings.ToLower(errDesc), "orphan transaction",
-			):
-				code = btcjson.ErrRPCTxError
+// AcceptLocalTransaction accepts tx, submitted to the node by a client, into
+// pool and returns it along with the orphans it accepted.  Transactions paying
+// a fee rate above maxFeeRate BTC/kvB are rejected, unless it is zero.  A nil
+// maxFeeRate defaults to 0.10 BTC/kvB, as in bitcoind.
+//
+// Rejections are returned as a *btcjson.RPCError with the code bitcoind
+// returns and a *btcjson.TxRejection as its data.
+func AcceptLocalTransaction(pool mempool.TxMempool, tx *btcutil.Tx,
+	maxFeeRate *float64) ([]*mempool.TxDesc, error) {
 
-			case strings.Contains(
-				strings.ToLower(errDesc), "transaction already exists",
-			):
-				code = btcjson.ErrRPCTxAlreadyInChain
+	limit := defaultMaxFeeRate
+	if maxFeeRate != nil {
+		limit = *maxFeeRate
+	}
+	if limit > 0 {
+		result, err := pool.CheckMempoolAcceptance(tx)
+		if err != nil {
+			return nil, txRejectionError(pool, tx, err)
+		}
 
-			default:
-				code = btcjson.ErrRPCTxRejected
+		// Orphans are rejected below, without a fee to check.
+		if result.MissingParents == nil {
+			feeRate := (result.TxFee * 1e3 /
+				btcutil.Amount(result.TxSize)).ToBTC()
+			if feeRate > limit {
+				return nil, &btcjson.RPCError{
+					Code: btcjson.ErrRPCTxError,
+					Message: fmt.Sprintf("TX rejected: fee rate "+
+						"%v BTC/kvB exceeds maxfeerate %v "+
+						"BTC/kvB", feeRate, limit),
+					Data: &btcjson.TxRejection{
+						Reason: btcjson.TxRejectMaxFeeExceeded,
+					},
+				}
 			}
 		}
+	}
 
-		return nil, &btcjson.RPCError{
-			Code:    code,
-			Message: "TX rejected: " + err.Error(),
-		}
+	// Use 0 for the tag to represent local node.
+	acceptedTxs, err := pool.ProcessTransaction(tx, false, false, 0)
+	if err != nil {
+		return nil, txRejectionError(pool, tx, err)
 	}
 
 	// When the transaction was accepted it should be the first item in the
@@ -3568,29 +4953,93 @@ func handleSendRawTransaction(s *rpcServer, cmd any, closeChan <-chan struct{})
 	// Also, since an error is being returned to the caller, ensure the
 	// transaction is removed from the memory pool.
 	if len(acceptedTxs) == 0 || !acceptedTxs[0].Tx.Hash().IsEqual(tx.Hash()) {
-		s.cfg.TxMemPool.RemoveTransaction(tx, true)
+		pool.RemoveTransaction(tx, true)
 
 		errStr := fmt.Sprintf("transaction %v is not in accepted list",
 			tx.Hash())
 		return nil, internalRPCError(errStr, "")
 	}
 
-	// Generate and relay inventory vectors for all newly accepted
-	// transactions into the memory pool due to the original being
-	// accepted.
-	s.cfg.ConnMgr.RelayTransactions(acceptedTxs)
+	return acceptedTxs, nil
+}
 
-	// Notify both websocket and getblocktemplate long poll clients of all
-	// newly accepted transactions.
-	s.NotifyNewTransactions(acceptedTxs)
+// txRejectionError maps the error of pool rejecting tx to the error bitcoind
+// returns, with the reason of the rejection and the mempool transactions tx
+// conflicts with as its data.
+func txRejectionError(pool mempool.TxMempool, tx *btcutil.Tx, err error) *btcjson.RPCError {
+	// When the error is a rule error, it means the transaction was simply
+	// rejected as opposed to something actually going wrong, so log it as
+	// such. Otherwise, something really did go wrong, so log it as an
+	// actual error and return.
+	var ruleErr mempool.RuleError
+	if !errors.As(err, &ruleErr) {
+		rpcsLog.Errorf("Failed to process transaction %v: %v",
+			tx.Hash(), err)
+
+		return &btcjson.RPCError{
+			Code:    btcjson.ErrRPCTxError,
+			Message: "TX rejected: " + err.Error(),
+		}
+	}
 
-	// Keep track of all the sendrawtransaction request txns so that they
-	// can be rebroadcast if they don't make their way into a block.
-	txD := acceptedTxs[0]
-	iv := wire.NewInvVect(wire.InvTypeTx, txD.Tx.Hash())
-	s.cfg.ConnMgr.AddRebroadcastInventory(iv, txD)
+	rpcsLog.Debugf("Rejected transaction %v: %v", tx.Hash(), err)
 
-	return tx.Hash().String(), nil
+	// We'll then map the rule error to the appropriate RPC error and
+	// reason, matching bitcoind's behavior.
+	code := btcjson.ErrRPCTxRejected
+	rejection := &btcjson.TxRejection{Reason: btcjson.TxRejectInvalid}
+	switch ruleErr := ruleErr.Err.(type) {
+	case mempool.TxRuleError:
+		errDesc := strings.ToLower(ruleErr.Description)
+		switch {
+		case strings.Contains(errDesc, "orphan transaction"):
+			code = btcjson.ErrRPCTxError
+			rejection.Reason = btcjson.TxRejectMissingInputs
+
+		case strings.Contains(errDesc, "transaction already exists"):
+			code = btcjson.ErrRPCTxAlreadyInChain
+			rejection.Reason = btcjson.TxRejectAlreadyInChain
+
+		case strings.Contains(errDesc, "already spent in mempool"):
+			rejection.Reason = btcjson.TxRejectConflict
+
+		case ruleErr.RejectCode == wire.RejectInsufficientFee:
+			rejection.Reason = btcjson.TxRejectLowFee
+
+		case ruleErr.RejectCode == wire.RejectNonstandard,
+			ruleErr.RejectCode == wire.RejectDust:
+
+			rejection.Reason = btcjson.TxRejectNonStandard
+		}
+
+	case blockchain.RuleError:
+		if ruleErr.ErrorCode == blockchain.ErrMissingTxOut {
+			code = btcjson.ErrRPCTxError
+			rejection.Reason = btcjson.TxRejectMissingInputs
+		}
+	}
+
+	// Report the mempool transactions spending the same outputs, which
+	// tx could not replace.
+	seen := make(map[chainhash.Hash]struct{})
+	for _, txIn := range tx.MsgTx().TxIn {
+		conflict := pool.CheckSpend(txIn.PreviousOutPoint)
+		if conflict == nil || conflict.Hash().IsEqual(tx.Hash()) {
+			continue
+		}
+		if _, ok := seen[*conflict.Hash()]; ok {
+			continue
+		}
+		seen[*conflict.Hash()] = struct{}{}
+		rejection.ConflictingTxids = append(rejection.ConflictingTxids,
+			conflict.Hash().String())
+	}
+
+	return &btcjson.RPCError{
+		Code:    code,
+		Message: "TX rejected: " + err.Error(),
+		Data:    rejection,
+	}
 }
 
 // handleSetGenerate implements the setgenerate command.
@@ -3629,6 +5078,22 @@ func handleSetGenerate(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, e
 	return nil, nil
 }
 
+// handleSetLogLevel implements the setloglevel command.
+func handleSetLogLevel(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	c := cmd.(*btcjson.SetLogLevelCmd)
+
+	if s.cfg.SetLogLevel == nil {
+		return nil, errors.New("Log levels unavailable")
+	}
+	if err := s.cfg.SetLogLevel(c.Subsystem, c.Level); err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+	return nil, nil
+}
+
 // Text used to signify that a signed message follows and to prevent
 // inadvertently signing a transaction.
 const messageSignatureHeader = "Bitcoin Signed Message:\n"
@@ -3700,6 +5165,13 @@ func handleSubmitBlock(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, e
 		}
 	}
 
+	// The VM processes the block like the blocks of its peers, so that it is
+	// only connected through consensus, and reports its status.
+	if status, ok := s.cfg.SyncMgr.SubmitBlockToVM(block); ok {
+		rpcsLog.Infof("Submitted block %s: %s", block.Hash(), status)
+		return status, nil
+	}
+
 	// Process this block using the same rules as blocks coming from other
 	// nodes.  This will in turn relay it to the network like normal.
 	_, err = s.cfg.SyncMgr.SubmitBlock(block, blockchain.BFNone)
@@ -3752,6 +5224,12 @@ func handleValidateAddress(s *rpcServer, cmd any, closeChan <-chan struct{}) (an
 		result.WitnessVersion = btcjson.Int32(int32(addr.WitnessVersion()))
 		result.WitnessProgram = btcjson.String(hex.EncodeToString(addr.WitnessProgram()))
 
+	case *btcutil.AddressTaproot:
+		result.IsScript = btcjson.Bool(true)
+		result.IsWitness = btcjson.Bool(true)
+		result.WitnessVersion = btcjson.Int32(int32(addr.WitnessVersion()))
+		result.WitnessProgram = btcjson.String(hex.EncodeToString(addr.WitnessProgram()))
+
 	default:
 		// Handle the case when a new Address is supported by btcutil, but none
 		// of the cases were matched in the switch block. The current behaviour
@@ -3878,6 +5356,48 @@ func handleVerifyMessage(s *rpcServer, cmd any, closeChan <-chan struct{}) (any,
 	return address.EncodeAddress() == c.Address, nil
 }
 
+// handleVerifyTxOutProof implements the verifytxoutproof command.
+func handleVerifyTxOutProof(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	c := cmd.(*btcjson.VerifyTxOutProofCmd)
+
+	serialized, err := hex.DecodeString(c.Proof)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Proof)
+	}
+	var mBlock wire.MsgMerkleBlock
+	err = mBlock.BtcDecode(bytes.NewReader(serialized), maxProtocolVersion,
+		wire.BaseEncoding)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDeserialization,
+			Message: "Proof decode failed: " + err.Error(),
+		}
+	}
+
+	// Proofs which are malformed or do not match the merkle root of their
+	// header prove nothing.
+	root, matches, err := bloom.ExtractMerkleBlockMatches(&mBlock)
+	if err != nil || !root.IsEqual(&mBlock.Header.MerkleRoot) {
+		return []string{}, nil
+	}
+
+	// The header hash commits to the merkle root, so the proof is valid if
+	// the block is in the main chain.
+	blockHash := mBlock.Header.BlockHash()
+	if !s.cfg.Chain.MainChainHasBlock(&blockHash) {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Block not found in chain",
+		}
+	}
+
+	txIDs := make([]string, 0, len(matches))
+	for _, match := range matches {
+		txIDs = append(txIDs, match.String())
+	}
+	return txIDs, nil
+}
+
 // handleVersion implements the version command.
 //
 // NOTE: This is a btcsuite extension ported from github.com/decred/dcrd.
@@ -3893,6 +5413,80 @@ func handleVersion(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error
 	return result, nil
 }
 
+// handleWaitForBlockHeight implements the waitforblockheight command.
+func handleWaitForBlockHeight(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	c := cmd.(*btcjson.WaitForBlockHeightCmd)
+	return s.waitForAcceptedTip(c.Timeout, closeChan,
+		func(tip *btcjson.WaitForBlockResult) bool {
+			return tip.Height >= c.Height
+		})
+}
+
+// handleWaitForNewBlock implements the waitfornewblock command.
+func handleWaitForNewBlock(s *rpcServer, cmd any, closeChan <-chan struct{}) (any, error) {
+	c := cmd.(*btcjson.WaitForNewBlockCmd)
+	prevTip, _ := s.ntfnMgr.AcceptedTip()
+	if prevTip == nil {
+		return nil, errAcceptedTipUnavailable
+	}
+	return s.waitForAcceptedTip(c.Timeout, closeChan,
+		func(tip *btcjson.WaitForBlockResult) bool {
+			return tip.Hash != prevTip.Hash
+		})
+}
+
+// errAcceptedTipUnavailable is returned by the commands waiting for blocks
+// when the VM has not set the last block accepted by consensus.
+var errAcceptedTipUnavailable = errors.New("Accepted tip unavailable")
+
+// waitForAcceptedTip waits until done reports true for the last block accepted
+// by consensus, the timeout in milliseconds elapses, or the client goes away.
+// It returns the tip at that point.  A timeout of zero waits indefinitely.
+//
+// Blocks connected by btcd do not wake the waiters until consensus accepts
+// them, so the returned tip is final.
+func (s *rpcServer) waitForAcceptedTip(timeoutMs *int64, closeChan <-chan struct{},
+	done func(tip *btcjson.WaitForBlockResult) bool) (any, error) {
+
+	var timeout <-chan time.Time
+	if timeoutMs != nil {
+		if *timeoutMs < 0 {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "Negative timeout",
+			}
+		}
+		if *timeoutMs > 0 {
+			timer := time.NewTimer(time.Duration(*timeoutMs) * time.Millisecond)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+	}
+
+	tip, changed := s.ntfnMgr.AcceptedTip()
+	if tip == nil {
+		return nil, errAcceptedTipUnavailable
+	}
+	for !done(tip) {
+		select {
+		case <-changed:
+			tip, changed = s.ntfnMgr.AcceptedTip()
+
+		case <-timeout:
+			return tip, nil
+
+		// When the client closes before it's time to send a reply,
+		// just return now so the goroutine doesn't hang around.
+		case <-closeChan:
+			return nil, ErrClientQuit
+
+		case <-s.quit:
+			return nil, ErrClientQuit
+		}
+	}
+	return tip, nil
+}
+
 // handleTestMempoolAccept implements the testmempoolaccept command.
 func handleTestMempoolAccept(s *rpcServer, cmd any,
 	closeChan <-chan struct{},
@@ -4068,6 +5662,7 @@ type rpcServer struct {
 	wg                     sync.WaitGroup
 	gbtWorkState           *gbtWorkState
 	helpCacher             *helpCacher
+	blockStatsCache        lru.KVCache
 	requestProcessShutdown chan struct{}
 	quit                   chan int
 }
@@ -4164,6 +5759,15 @@ func (s *rpcServer) NotifyNewTransactions(txns []*mempool.TxDesc) {
 	}
 }
 
+// NotifyDoubleSpend notifies websocket clients of a transaction conflicting
+// with the mempool.  Notifications are dropped until the server is started.
+func (s *rpcServer) NotifyDoubleSpend(doubleSpend *btcjson.DoubleSpendResult) {
+	if atomic.LoadInt32(&s.started) == 0 {
+		return
+	}
+	s.ntfnMgr.NotifyDoubleSpend(doubleSpend)
+}
+
 // limitConnections responds with a 503 service unavailable and returns true if
 // adding another client would exceed the maximum allow RPC clients.
 //
@@ -4333,70 +5937,142 @@ func createMarshalledReply(
 
 // processRequest determines the incoming request type (single or batched),
 // parses it and returns a marshalled response.
-func (s *rpcServer) processRequest(request *btcjson.Request, isAdmin bool, closeChan <-chan struct{}) []byte {
-	var result any
-	var err error
-	var jsonErr *btcjson.RPCError
+func (s *rpcServer) processRequest(request *btcjson.Request, isAdmin bool,
+	methods RPCMethodFilter, closeChan <-chan struct{}) []byte {
+
+	result, jsonErr, respond := s.requestResult(request, isAdmin, methods,
+		closeChan)
+	if !respond {
+		return nil
+	}
+
+	// Marshal the response.
+	msg, err := createMarshalledReply(request.Jsonrpc, request.ID, result, jsonErr)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal reply: %v", err)
+		return nil
+	}
+	return msg
+}
 
+// requestResult runs the command of a request and returns its result or
+// error.  It returns false when the request must not be responded to.
+func (s *rpcServer) requestResult(request *btcjson.Request, isAdmin bool,
+	methods RPCMethodFilter, closeChan <-chan struct{}) (any, *btcjson.RPCError, bool) {
+
+	if methods != nil && !methods(request.Method) {
+		return nil, errRPCUnauthorized, true
+	}
 	if !isAdmin {
 		if _, ok := rpcLimited[request.Method]; !ok {
-			jsonErr = internalRPCError("limited user not "+
-				"authorized for this method", "")
+			return nil, internalRPCError("limited user not "+
+				"authorized for this method", ""), true
 		}
 	}
 
-	if jsonErr == nil {
-		if request.Method == "" || request.Params == nil {
-			jsonErr = &btcjson.RPCError{
-				Code:    btcjson.ErrRPCInvalidRequest.Code,
-				Message: "Invalid request: malformed",
-			}
-			msg, err := createMarshalledReply(request.Jsonrpc, request.ID, result, jsonErr)
-			if err != nil {
-				rpcsLog.Errorf("Failed to marshal reply: %v", err)
-				return nil
-			}
-			return msg
-		}
+	if request.Method == "" || request.Params == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidRequest.Code,
+			Message: "Invalid request: malformed",
+		}, true
+	}
 
-		// Valid requests with no ID (notifications) must not have a response
-		// per the JSON-RPC spec.
-		if request.ID == nil {
-			return nil
+	// Valid requests with no ID (notifications) must not have a response
+	// per the JSON-RPC spec.
+	if request.ID == nil {
+		return nil, nil, false
+	}
+
+	// Attempt to parse the JSON-RPC request into a known
+	// concrete command.
+	parsedCmd := parseCmd(request)
+	if parsedCmd.err != nil {
+		return nil, parsedCmd.err, true
+	}
+	result, err := s.standardCmdResult(parsedCmd, closeChan)
+	if err != nil {
+		if rpcErr, ok := err.(*btcjson.RPCError); ok {
+			return nil, rpcErr, true
 		}
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidRequest.Code,
+			Message: "Invalid request: malformed",
+		}, true
+	}
+	return result, nil, true
+}
 
-		// Attempt to parse the JSON-RPC request into a known
-		// concrete command.
-		parsedCmd := parseCmd(request)
-		if parsedCmd.err != nil {
-			jsonErr = parsedCmd.err
-		} else {
-			result, err = s.standardCmdResult(parsedCmd,
-				closeChan)
-			if err != nil {
-				if rpcErr, ok := err.(*btcjson.RPCError); ok {
-					jsonErr = rpcErr
-				} else {
-					jsonErr = &btcjson.RPCError{
-						Code:    btcjson.ErrRPCInvalidRequest.Code,
-						Message: "Invalid request: malformed",
-					}
-				}
-			}
+// processBatchEntry parses a single entry of a batched request and returns
+// its marshalled response, nil for notifications.
+func (s *rpcServer) processBatchEntry(entry any, isAdmin bool,
+	methods RPCMethodFilter, closeChan <-chan struct{}) []byte {
+
+	reqBytes, err := json.Marshal(entry)
+	if err != nil {
+		jsonErr := &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidRequest.Code,
+			Message: fmt.Sprintf("Invalid request: %v",
+				err),
 		}
+		resp, err := btcjson.MarshalResponse(btcjson.RpcVersion2, nil, nil, jsonErr)
+		if err != nil {
+			rpcsLog.Errorf("Failed to create reply: %v", err)
+		}
+		return resp
 	}
 
-	// Marshal the response.
-	msg, err := createMarshalledReply(request.Jsonrpc, request.ID, result, jsonErr)
+	var req btcjson.Request
+	err = json.Unmarshal(reqBytes, &req)
 	if err != nil {
-		rpcsLog.Errorf("Failed to marshal reply: %v", err)
-		return nil
+		jsonErr := &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidRequest.Code,
+			Message: fmt.Sprintf("Invalid request: %v",
+				err),
+		}
+		resp, err := btcjson.MarshalResponse("", nil, nil, jsonErr)
+		if err != nil {
+			rpcsLog.Errorf("Failed to create reply: %v", err)
+		}
+		return resp
 	}
-	return msg
+
+	return s.processRequest(&req, isAdmin, methods, closeChan)
+}
+
+// processBatch processes the entries of a batched request concurrently, at
+// most cfg.RPCBatchParallelism at a time, and returns their responses in the
+// order of the requests.  A failed entry only fails its own response.
+func (s *rpcServer) processBatch(batchedRequests []any, isAdmin bool,
+	methods RPCMethodFilter, closeChan <-chan struct{}) []json.RawMessage {
+
+	responses := make([][]byte, len(batchedRequests))
+	sem := make(chan struct{}, max(cfg.RPCBatchParallelism, 1))
+	var wg sync.WaitGroup
+	for i, entry := range batchedRequests {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, entry any) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			responses[i] = s.processBatchEntry(entry, isAdmin, methods, closeChan)
+		}(i, entry)
+	}
+	wg.Wait()
+
+	results := make([]json.RawMessage, 0, len(responses))
+	for _, resp := range responses {
+		if resp != nil {
+			results = append(results, resp)
+		}
+	}
+	return results
 }
 
-// jsonRPCRead handles reading and responding to RPC messages.
-func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin bool) {
+// jsonRPCRead handles reading and responding to RPC messages.  When methods is
+// not nil, it restricts the methods the client may call.
+func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin bool, methods RPCMethodFilter) {
 	if atomic.LoadInt32(&s.shutdown) != 0 {
 		return
 	}
@@ -4466,15 +6142,17 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 	var results []json.RawMessage
 	var batchSize int
 	var batchedRequest bool
+	var req btcjson.Request
+	var streamed rpcStreamer
+	status := http.StatusOK
 
-	// Determine request type
-	if bytes.HasPrefix(body, batchedRequestPrefix) {
+	// Determine request type, allowing whitespace before the batch
+	if bytes.HasPrefix(bytes.TrimLeft(body, " \t\r\n"), batchedRequestPrefix) {
 		batchedRequest = true
 	}
 
 	// Process a single request
 	if !batchedRequest {
-		var req btcjson.Request
 		var resp json.RawMessage
 		err = json.Unmarshal(body, &req)
 		if err != nil {
@@ -4511,7 +6189,24 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 			if req.ID == nil && !(cfg.RPCQuirks && req.Jsonrpc == "") {
 				return
 			}
-			resp = s.processRequest(&req, isAdmin, closeChan)
+
+			// A single request for a method the client may not call
+			// is answered with an HTTP 401 status.  Entries of a
+			// batch only fail their own response.
+			if methods != nil && !methods(req.Method) {
+				status = http.StatusUnauthorized
+			}
+			result, jsonErr, respond := s.requestResult(&req, isAdmin,
+				methods, closeChan)
+			if streamer, ok := result.(rpcStreamer); ok && jsonErr == nil {
+				streamed = streamer
+			} else if respond {
+				resp, err = createMarshalledReply(req.Jsonrpc, req.ID,
+					result, jsonErr)
+				if err != nil {
+					rpcsLog.Errorf("Failed to marshal reply: %v", err)
+				}
+			}
 		}
 
 		if resp != nil {
@@ -4557,54 +6252,26 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 				}
 			}
 
-			// Process each batch entry individually
-			if len(batchedRequests) > 0 {
-				batchSize = len(batchedRequests)
+			// Reject batches above the configured size as a whole
+			if len(batchedRequests) > cfg.RPCMaxBatchSize {
+				jsonErr := &btcjson.RPCError{
+					Code: btcjson.ErrRPCInvalidRequest.Code,
+					Message: fmt.Sprintf("Invalid request: batch of %d "+
+						"requests exceeds max of %d",
+						len(batchedRequests), cfg.RPCMaxBatchSize),
+				}
+				resp, err = btcjson.MarshalResponse(btcjson.RpcVersion2, nil, nil, jsonErr)
+				if err != nil {
+					rpcsLog.Errorf("Failed to marshal reply: %v", err)
+				}
 
-				for _, entry := range batchedRequests {
-					var reqBytes []byte
-					reqBytes, err = json.Marshal(entry)
-					if err != nil {
-						jsonErr := &btcjson.RPCError{
-							Code: btcjson.ErrRPCInvalidRequest.Code,
-							Message: fmt.Sprintf("Invalid request: %v",
-								err),
-						}
-						resp, err = btcjson.MarshalResponse(btcjson.RpcVersion2, nil, nil, jsonErr)
-						if err != nil {
-							rpcsLog.Errorf("Failed to create reply: %v", err)
-						}
-
-						if resp != nil {
-							results = append(results, resp)
-						}
-						continue
-					}
-
-					var req btcjson.Request
-					err := json.Unmarshal(reqBytes, &req)
-					if err != nil {
-						jsonErr := &btcjson.RPCError{
-							Code: btcjson.ErrRPCInvalidRequest.Code,
-							Message: fmt.Sprintf("Invalid request: %v",
-								err),
-						}
-						resp, err = btcjson.MarshalResponse("", nil, nil, jsonErr)
-						if err != nil {
-							rpcsLog.Errorf("Failed to create reply: %v", err)
-						}
-
-						if resp != nil {
-							results = append(results, resp)
-						}
-						continue
-					}
-
-					resp = s.processRequest(&req, isAdmin, closeChan)
-					if resp != nil {
-						results = append(results, resp)
-					}
+				if resp != nil {
+					results = append(results, resp)
 				}
+			} else if len(batchedRequests) > 0 {
+				// Process each batch entry individually
+				batchSize = len(batchedRequests)
+				results = s.processBatch(batchedRequests, isAdmin, methods, closeChan)
 			}
 		}
 	}
@@ -4635,18 +6302,37 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 		}
 	}
 
+	// Compress large replies for clients accepting it.
+	compress := (streamed != nil || len(msg) >= gzipMinReplySize) &&
+		acceptsGzip(r)
+	w.Header().Add("Vary", "Accept-Encoding")
+	if compress {
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+
 	// Write the response.
 	if hijacked {
-		err = s.writeHTTPResponseHeaders(r, w.Header(), http.StatusOK, writer)
+		err = s.writeHTTPResponseHeaders(r, w.Header(), status, writer)
 		if err != nil {
 			rpcsLog.Error(err)
 			return
 		}
 	} else {
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(status)
 	}
 
-	if _, err := writer.Write(msg); err != nil {
+	var gzipWriter *gzip.Writer
+	if compress {
+		gzipWriter = gzip.NewWriter(writer)
+		writer = gzipWriter
+	}
+
+	if streamed != nil {
+		err := writeStreamedReply(writer, req.Jsonrpc, req.ID, streamed)
+		if err != nil {
+			rpcsLog.Errorf("Failed to write streamed reply: %v", err)
+		}
+	} else if _, err := writer.Write(msg); err != nil {
 		rpcsLog.Errorf("Failed to write marshalled reply: %v", err)
 	}
 
@@ -4654,6 +6340,59 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 	if _, err := writer.Write([]byte{'\n'}); err != nil {
 		rpcsLog.Errorf("Failed to append terminating newline to reply: %v", err)
 	}
+
+	if gzipWriter != nil {
+		if err := gzipWriter.Close(); err != nil {
+			rpcsLog.Errorf("Failed to finish compressed reply: %v", err)
+		}
+	}
+}
+
+// writeStreamedReply writes the JSON-RPC response with the result of a
+// request to w as the result is encoded.  The response is the same as the one
+// marshalled by createMarshalledReply.
+func writeStreamedReply(w io.Writer, rpcVersion btcjson.RPCVersion, id any,
+	result rpcStreamer) error {
+
+	// Marshal the response around a null result to write the result in its
+	// place.
+	const nullResult = `"result":null`
+	envelope, err := btcjson.MarshalResponse(rpcVersion, id, nil, nil)
+	if err != nil {
+		return err
+	}
+	start := bytes.Index(envelope, []byte(nullResult))
+	if start == -1 {
+		return errors.New("failed to find result in response")
+	}
+	start += len(nullResult) - len("null")
+
+	if _, err := w.Write(envelope[:start]); err != nil {
+		return err
+	}
+	if err := result.writeJSON(w); err != nil {
+		return err
+	}
+	_, err = w.Write(envelope[start+len("null"):])
+	return err
+}
+
+// acceptsGzip returns whether the client of r accepts gzip compressed replies.
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(encoding, ";")
+		if strings.TrimSpace(name) != "gzip" {
+			continue
+		}
+		// A quality of zero rejects the encoding.
+		quality, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !ok {
+			return true
+		}
+		q, err := strconv.ParseFloat(quality, 64)
+		return err == nil && q > 0
+	}
+	return false
 }
 
 // jsonAuthFail sends a message back to the client if the http auth is rejected.
@@ -4662,6 +6401,48 @@ func jsonAuthFail(w http.ResponseWriter) {
 	http.Error(w, "401 Unauthorized.", http.StatusUnauthorized)
 }
 
+// jsonUnauthorized sends a JSON-RPC error back to the client if it is rejected
+// by the Auth callback.
+func jsonUnauthorized(w http.ResponseWriter) {
+	reply, err := createMarshalledReply(btcjson.RpcVersion1, nil, nil, errRPCUnauthorized)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal reply: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Add("WWW-Authenticate", `Bearer realm="btcd RPC"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write(append(reply, '\n'))
+}
+
+// authenticate checks the credentials of the client of r with the Auth
+// callback when one is provided and with checkAuth otherwise.  It returns
+// whether the client is authenticated and an admin, and the filter of the
+// methods it may call, which is nil without the Auth callback.
+func (s *rpcServer) authenticate(r *http.Request, require bool) (bool, bool, RPCMethodFilter, error) {
+	if s.cfg.Auth == nil {
+		authenticated, isAdmin, err := s.checkAuth(r, require)
+		return authenticated, isAdmin, nil, err
+	}
+
+	methods, err := s.cfg.Auth(r)
+	if err != nil {
+		rpcsLog.Warnf("RPC authentication failure from %s: %v",
+			r.RemoteAddr, err)
+		return false, false, nil, err
+	}
+	return true, true, methods, nil
+}
+
+// authFail sends a message back to the client if its authentication failed.
+func (s *rpcServer) authFail(w http.ResponseWriter) {
+	if s.cfg.Auth != nil {
+		jsonUnauthorized(w)
+		return
+	}
+	jsonAuthFail(w)
+}
+
 // Start is used by server.go to start the rpc listener.
 // Start initializes the RPC server and returns the HTTP handler for VM integration.
 // In VM mode, Metal handles HTTP serving, so we return the mux handler
@@ -4687,21 +6468,21 @@ func (s *rpcServer) Start() (http.Handler, http.Handler) {
 		// Keep track of the number of connected clients.
 		s.incrementClients()
 		defer s.decrementClients()
-		_, isAdmin, err := s.checkAuth(r, true)
+		_, isAdmin, methods, err := s.authenticate(r, true)
 		if err != nil {
-			jsonAuthFail(w)
+			s.authFail(w)
 			return
 		}
 
 		// Read and respond to the request.
-		s.jsonRPCRead(w, r, isAdmin)
+		s.jsonRPCRead(w, r, isAdmin, methods)
 	})
 
 	// Websocket endpoint.
 	wsHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authenticated, isAdmin, err := s.checkAuth(r, false)
+		authenticated, isAdmin, methods, err := s.authenticate(r, false)
 		if err != nil {
-			jsonAuthFail(w)
+			s.authFail(w)
 			return
 		}
 
@@ -4716,11 +6497,9 @@ func (s *rpcServer) Start() (http.Handler, http.Handler) {
 			http.Error(w, "400 Bad Request.", http.StatusBadRequest)
 			return
 		}
-		s.WebsocketHandler(ws, r.RemoteAddr, authenticated, isAdmin)
+		s.WebsocketHandler(ws, r.RemoteAddr, authenticated, isAdmin, methods)
 	})
 
-	s.ntfnMgr.Start()
-
 	// Return the mux handler for VM to use with Metal HTTP
 	return rpcHandler, wsHandler
 }
@@ -4830,6 +6609,10 @@ type rpcserverConnManager interface {
 	// the passed transactions to all connected peers.
 	RelayTransactions(txns []*mempool.TxDesc)
 
+	// RelayLocalTransactions relays the passed transactions, submitted to
+	// the node by a client, to all connected peers right away.
+	RelayLocalTransactions(txns []*mempool.TxDesc)
+
 	// NodeAddresses returns an array consisting node addresses which can
 	// potentially be used to find new nodes in the network.
 	NodeAddresses() []*wire.NetAddressV2
@@ -4848,6 +6631,11 @@ type rpcserverSyncManager interface {
 	// processing it locally.
 	SubmitBlock(block *btcutil.Block, flags blockchain.BehaviorFlags) (bool, error)
 
+	// SubmitBlockToVM hands the provided block to the VM and returns the
+	// status of the submission. It returns false if the VM does not handle
+	// submitted blocks.
+	SubmitBlockToVM(block *btcutil.Block) (string, bool)
+
 	// Pause pauses the sync manager until the returned channel is closed.
 	Pause() chan<- struct{}
 
@@ -4862,6 +6650,115 @@ type rpcserverSyncManager interface {
 	LocateHeaders(locators []*chainhash.Hash, hashStop *chainhash.Hash) []wire.BlockHeader
 }
 
+// GenerateToAddressFunc generates numBlocks blocks paying payToAddr and
+// returns their hashes in order.  Blocks are produced through consensus rather
+// than mined, so the function blocks until each block is accepted.
+// Generation is abandoned when quit is closed.
+type GenerateToAddressFunc func(numBlocks uint32, payToAddr btcutil.Address,
+	quit <-chan struct{}) ([]*chainhash.Hash, error)
+
+// ErrInsufficientFeeData is returned by a SmartFeeEstimator which has not
+// observed enough transactions to estimate a fee rate.
+var ErrInsufficientFeeData = errors.New("Insufficient data or no feerate found")
+
+// SmartFeeEstimator estimates the fee rate for a transaction to be confirmed
+// within a number of blocks, or within a duration.  Both methods return the
+// fee rate per kilo virtual byte and the number of blocks the estimate is for,
+// which may differ from the requested target.
+type SmartFeeEstimator interface {
+	EstimateSmartFee(confTarget uint32, conservative bool) (btcutil.Amount, uint32, error)
+	EstimateFeeByTime(d time.Duration, conservative bool) (btcutil.Amount, uint32, error)
+}
+
+// ExportChainStateFunc writes the accepted chain to the directory dir for
+// the exportchainstate command.
+type ExportChainStateFunc func(dir string) (*btcjson.ExportChainStateResult, error)
+
+// ResyncChainStateFunc starts rebuilding the chain state from the accepted
+// chain, unless statusOnly is set, and returns the status of the resync for
+// the resyncchainstate command.
+type ResyncChainStateFunc func(statusOnly bool) (*btcjson.ResyncChainStateResult, error)
+
+// RunMaintenanceFunc flushes the chain state and compacts the database for the
+// runmaintenance command.
+type RunMaintenanceFunc func() (*btcjson.RunMaintenanceResult, error)
+
+// CheckpointFunc returns the last accepted block as a checkpoint for the
+// getcheckpoint command.
+type CheckpointFunc func() (*btcjson.GetCheckpointResult, error)
+
+// ChainTipStatusFunc returns the consensus status of the chain tip with the
+// given hash and height for the getchaintips command.
+type ChainTipStatusFunc func(hash *chainhash.Hash, height int32) string
+
+// BlockProposerFunc returns the proposer recorded in the coinbase of block for
+// the getblock command, or an empty string if it records none.
+type BlockProposerFunc func(block *btcutil.Block) string
+
+// BlockValidityFunc is called when the invalidateblock or reconsiderblock
+// command marks the block with the given hash and height as invalid or valid.
+type BlockValidityFunc func(hash *chainhash.Hash, height int32, valid bool)
+
+// LogLevelFunc sets the log level of a subsystem for the setloglevel command.
+type LogLevelFunc func(subsystem, level string) error
+
+// BlockFilterFunc returns the basic filter of an accepted block and its
+// header for the getblockfilter command, or nil if the block has no filter.
+type BlockFilterFunc func(hash *chainhash.Hash) (*btcjson.GetBlockFilterResult, error)
+
+// CFHeadersFunc returns the basic filter hashes of the accepted blocks from
+// startHeight to stopHash for the getcfheaders command, or nil if stopHash has
+// no filter.
+type CFHeadersFunc func(startHeight uint32, stopHash *chainhash.Hash) (*btcjson.GetCFHeadersResult, error)
+
+// RPCMethodFilter reports whether a client may call an RPC method.
+type RPCMethodFilter func(method string) bool
+
+// RPCAuthFunc authenticates the client of a request to the RPC or websocket
+// endpoint and returns the filter of the methods it may call.  It returns an
+// error if the client is not authenticated.
+type RPCAuthFunc func(r *http.Request) (RPCMethodFilter, error)
+
+// RPCLimitFunc is called with the name of a limit of the RPC server each time
+// a client exceeds it.
+type RPCLimitFunc func(limit string)
+
+// ConsensusInfoFunc returns a description of the consensus the chain is run
+// by for the getconsensusinfo and getblockchaininfo commands.
+type ConsensusInfoFunc func() *btcjson.ConsensusInfo
+
+// GossipInfoFunc returns the state of the gossip of the VM for the
+// getgossipinfo command.
+type GossipInfoFunc func() (*btcjson.GetGossipInfoResult, error)
+
+// DoubleSpendsFunc returns the recently seen double spends involving the
+// transaction with the given hash for the getdoublespends command.
+type DoubleSpendsFunc func(txHash *chainhash.Hash) []btcjson.DoubleSpendResult
+
+// NetworkInfo describes the connectivity of the node for the getnetworkinfo
+// command when peers are managed by the VM rather than the legacy
+// peer-to-peer network.
+type NetworkInfo struct {
+	// Version and SubVersion identify the node software.
+	Version    int32
+	SubVersion string
+
+	// Metal describes the Metal network the node is connected to.
+	Metal *btcjson.MetalNetworkInfo
+}
+
+// NetworkInfoFunc returns the connectivity of the node for the
+// getnetworkinfo command.
+type NetworkInfoFunc func() *NetworkInfo
+
+// PeerInfoFunc returns the peers the node is connected to for the
+// getpeerinfo command.
+type PeerInfoFunc func() []*btcjson.GetPeerInfoResult
+
+// MiningInfoFunc returns the state of the block builder of the VM for the
+// getmininginfo command.
+type MiningInfoFunc func() *btcjson.MetalMiningInfo
+
 // rpcserverConfig is a descriptor containing the RPC server configuration.
 type rpcserverConfig struct {
 	// StartupTime is the unix timestamp for when the server that is hosting
@@ -4895,11 +6792,91 @@ type rpcserverConfig struct {
 	Generator *mining.BlkTmplGenerator
 	CPUMiner  *cpuminer.CPUMiner
 
+	// GenerateToAddress generates blocks on demand for the
+	// generatetoaddress command.  It is nil unless provided by the VM.
+	GenerateToAddress GenerateToAddressFunc
+
+	// SmartFeeEstimator answers the estimatesmartfee and estimatefeebytime
+	// commands.  It is nil unless provided by the VM.
+	SmartFeeEstimator SmartFeeEstimator
+
+	// ConsensusInfo describes the consensus the chain is run by for the
+	// getconsensusinfo and getblockchaininfo commands.  It is nil unless
+	// provided by the VM.
+	ConsensusInfo ConsensusInfoFunc
+
+	// GossipInfo returns the state of the bloom filter and the gossip loops
+	// for the getgossipinfo command.  It is nil unless provided by the VM.
+	GossipInfo GossipInfoFunc
+
+	// MiningInfo returns the state of the block builder for the
+	// getmininginfo command.  It is nil unless provided by the VM.
+	MiningInfo MiningInfoFunc
+
+	// DoubleSpends returns the recently seen double spends of a transaction
+	// for the getdoublespends command.  It is nil unless provided by the VM.
+	DoubleSpends DoubleSpendsFunc
+
+	// NetworkInfo and PeerInfo report the peers of the node on the Metal
+	// network for the getnetworkinfo and getpeerinfo commands.  They are
+	// nil unless provided by the VM.
+	NetworkInfo NetworkInfoFunc
+	PeerInfo    PeerInfoFunc
+
+	// ExportChainState writes the accepted chain to a directory for the
+	// exportchainstate command.  It is nil unless provided by the VM.
+	ExportChainState ExportChainStateFunc
+
+	// ResyncChainState rebuilds the chain state from the accepted chain for
+	// the resyncchainstate command.  It is nil unless provided by the VM.
+	ResyncChainState ResyncChainStateFunc
+
+	// RunMaintenance flushes the chain state and compacts the database for
+	// the runmaintenance command.  It is nil unless provided by the VM.
+	RunMaintenance RunMaintenanceFunc
+
+	// Checkpoint returns the last accepted block as a checkpoint for the
+	// getcheckpoint command.  It is nil unless provided by the VM.
+	Checkpoint CheckpointFunc
+
+	// ChainTipStatus returns the consensus status of the chain tips for the
+	// getchaintips command.  It is nil unless provided by the VM.
+	ChainTipStatus ChainTipStatusFunc
+
+	// BlockProposer returns the proposer recorded in the coinbase of a block
+	// for the getblock command.  It is nil unless provided by the VM.
+	BlockProposer BlockProposerFunc
+
+	// BlockValidityChanged is called when the invalidateblock and
+	// reconsiderblock commands change the validity of a block.  It is nil
+	// unless provided by the VM.
+	BlockValidityChanged BlockValidityFunc
+
+	// SetLogLevel sets the log level of a subsystem for the setloglevel
+	// command.  It is nil unless provided by the VM.
+	SetLogLevel LogLevelFunc
+
+	// Auth authenticates clients and authorizes the methods they call in
+	// place of the rpcuser and rpclimituser credentials.  It is nil unless
+	// provided by the VM.
+	Auth RPCAuthFunc
+
+	// LimitExceeded is called when a websocket client exceeds its max number
+	// of subscriptions.  It is nil unless provided by the VM.
+	LimitExceeded RPCLimitFunc
+
+	// BlockFilter and CFHeaders serve the compact filters of accepted blocks
+	// for the getblockfilter and getcfheaders commands.  They are nil unless
+	// provided by the VM.
+	BlockFilter BlockFilterFunc
+	CFHeaders   CFHeadersFunc
+
 	// These fields define any optional indexes the RPC server can make use
 	// of to provide additional data when queried.
-	TxIndex   *indexers.TxIndex
-	AddrIndex *indexers.AddrIndex
-	CfIndex   *indexers.CfIndex
+	TxIndex    *indexers.TxIndex
+	AddrIndex  *indexers.AddrIndex
+	SpentIndex *indexers.SpentIndex
+	CfIndex    *indexers.CfIndex
 
 	// The fee estimator keeps track of how long transactions are left in
 	// the mempool before they are mined into blocks.
@@ -4914,8 +6891,9 @@ func newRPCServer(config *rpcserverConfig) (*rpcServer, error) {
 	rpc := rpcServer{
 		cfg:                    *config,
 		statusLines:            make(map[int]string),
-		gbtWorkState:           newGbtWorkState(config.TimeSource),
+		gbtWorkState:           newGbtWorkState(config.TimeSource, config.ChainParams),
 		helpCacher:             newHelpCacher(),
+		blockStatsCache:        lru.NewKVCache(blockStatsCacheSize),
 		requestProcessShutdown: make(chan struct{}),
 		quit:                   make(chan int),
 	}
@@ -4929,7 +6907,11 @@ func newRPCServer(config *rpcserverConfig) (*rpcServer, error) {
 		auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
 		rpc.limitauthsha = sha256.Sum256([]byte(auth))
 	}
+	// The notification manager is started with the server rather than
+	// when the handlers are requested, since the chain and the mempool
+	// block on delivering notifications to it until it runs.
 	rpc.ntfnMgr = newWsNotificationManager(&rpc)
+	rpc.ntfnMgr.Start()
 	rpc.cfg.Chain.Subscribe(rpc.handleBlockchainNotification)
 
 	return &rpc, nil
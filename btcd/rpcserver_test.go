@@ -1,14 +1,24 @@
 package btcd
 
 import (
+	"bytes"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
 	"testing"
+	"time"
 
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
 	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
 	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg"
 	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
 	"github.com/MetalBlockchain/btcvm/btcd/mempool"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
 	"github.com/MetalBlockchain/btcvm/btcd/wire"
 	"github.com/stretchr/testify/require"
 )
@@ -495,3 +505,359 @@ func TestGetTxSpendingPrevOut(t *testing.T) {
 	require.NoError(err)
 	require.Equal(expectedResults, results)
 }
+
+// TestCalcBlockStats checks that calcBlockStats computes the statistics of a
+// block with known fees.
+func TestCalcBlockStats(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	pkScript := append([]byte{0x76, 0xa9, 0x14}, make([]byte, 22)...)
+	nullData := []byte{txscript.OP_RETURN, 0x01, 0x00}
+	params := &chaincfg.RegressionNetParams
+
+	// The coinbase creates a spendable and an unspendable output.
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(wire.NewTxIn(
+		wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex),
+		[]byte{0x51, 0x51}, nil,
+	))
+	coinbase.AddTxOut(wire.NewTxOut(50_0000_0000, pkScript))
+	coinbase.AddTxOut(wire.NewTxOut(0, nullData))
+
+	// A legacy transaction pays a fee of 1,000 satoshis and a segwit
+	// transaction spending two outputs pays a fee of 5,000 satoshis.
+	legacy := wire.NewMsgTx(wire.TxVersion)
+	legacy.AddTxIn(wire.NewTxIn(
+		wire.NewOutPoint(&chainhash.Hash{1}, 0), []byte{0x51}, nil,
+	))
+	legacy.AddTxOut(wire.NewTxOut(60_000, pkScript))
+	legacy.AddTxOut(wire.NewTxOut(39_000, pkScript))
+
+	segwit := wire.NewMsgTx(wire.TxVersion)
+	segwit.AddTxIn(wire.NewTxIn(
+		wire.NewOutPoint(&chainhash.Hash{2}, 0), nil,
+		wire.TxWitness{make([]byte, 72), make([]byte, 33)},
+	))
+	segwit.AddTxIn(wire.NewTxIn(
+		wire.NewOutPoint(&chainhash.Hash{2}, 1), nil,
+		wire.TxWitness{make([]byte, 72), make([]byte, 33)},
+	))
+	segwit.AddTxOut(wire.NewTxOut(195_000, pkScript))
+
+	block := btcutil.NewBlock(&wire.MsgBlock{
+		Header: wire.BlockHeader{Timestamp: time.Unix(1_700_000_000, 0)},
+		Transactions: []*wire.MsgTx{
+			coinbase, legacy, segwit,
+		},
+	})
+	block.SetHeight(10)
+	stxos := []blockchain.SpentTxOut{
+		{Amount: 100_000, PkScript: pkScript},
+		{Amount: 150_000, PkScript: pkScript},
+		{Amount: 50_000, PkScript: pkScript},
+	}
+	medianTime := time.Unix(1_699_999_000, 0)
+
+	legacySize := int64(legacy.SerializeSize())
+	segwitSize := int64(segwit.SerializeSize())
+	legacyWeight := blockchain.GetTransactionWeight(btcutil.NewTx(legacy))
+	segwitWeight := blockchain.GetTransactionWeight(btcutil.NewTx(segwit))
+	legacyFeeRate := 1_000 * blockchain.WitnessScaleFactor / legacyWeight
+	segwitFeeRate := 5_000 * blockchain.WitnessScaleFactor / segwitWeight
+	require.Less(legacyFeeRate, segwitFeeRate)
+
+	// The legacy transaction is lighter than the segwit transaction, so it
+	// only makes up the lowest percentiles.
+	totalWeight := legacyWeight + segwitWeight
+	percentiles := make([]int64, 0, 5)
+	for _, threshold := range []float64{0.10, 0.25, 0.50, 0.75, 0.90} {
+		feeRate := segwitFeeRate
+		if float64(legacyWeight) >= float64(totalWeight)*threshold {
+			feeRate = legacyFeeRate
+		}
+		percentiles = append(percentiles, feeRate)
+	}
+
+	spentSize := int64(wire.NewTxOut(0, pkScript).SerializeSize() +
+		perUTXOOverhead)
+	stats, err := calcBlockStats(block, stxos, true, medianTime, params)
+	require.NoError(err)
+	require.Equal(&btcjson.GetBlockStatsResult{
+		AverageFee:         3_000,
+		AverageFeeRate:     6_000 * blockchain.WitnessScaleFactor / totalWeight,
+		AverageTxSize:      (legacySize + segwitSize) / 2,
+		FeeratePercentiles: percentiles,
+		Hash:               block.Hash().String(),
+		Height:             10,
+		Ins:                3,
+		MaxFee:             5_000,
+		MaxFeeRate:         segwitFeeRate,
+		MaxTxSize:          max(legacySize, segwitSize),
+		MedianFee:          3_000,
+		MedianTime:         medianTime.Unix(),
+		MedianTxSize:       (legacySize + segwitSize) / 2,
+		MinFee:             1_000,
+		MinFeeRate:         legacyFeeRate,
+		MinTxSize:          min(legacySize, segwitSize),
+		Outs:               5,
+		SegWitTotalSize:    segwitSize,
+		SegWitTotalWeight:  segwitWeight,
+		SegWitTxs:          1,
+		Subsidy:            blockchain.CalcBlockSubsidy(10, params),
+		Time:               1_700_000_000,
+		TotalFee:           6_000,
+		TotalOut:           294_000,
+		TotalSize:          legacySize + segwitSize,
+		TotalWeight:        totalWeight,
+		Txs:                3,
+		UTXOIncrease:       1,
+		UTXOSizeIncrease:   spentSize,
+	}, stats)
+
+	// Without the spent outputs, the statistics that need them are zero.
+	stats, err = calcBlockStats(block, nil, false, medianTime, params)
+	require.NoError(err)
+	require.Zero(stats.TotalFee)
+	require.Zero(stats.MaxFeeRate)
+	require.Equal([]int64{0, 0, 0, 0, 0}, stats.FeeratePercentiles)
+	require.Equal(totalWeight, stats.TotalWeight)
+	require.Equal(int64(1), stats.UTXOIncrease)
+
+	// The spend journal must match the inputs of the block.
+	_, err = calcBlockStats(block, stxos[:2], true, medianTime, params)
+	require.Error(err)
+	_, err = calcBlockStats(block, append(stxos, stxos[0]), true,
+		medianTime, params)
+	require.Error(err)
+}
+
+// TestFeeRatePercentiles checks that the fee rate percentiles are weighted by
+// the weight of the transactions.
+func TestFeeRatePercentiles(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		feeRates []weightedFeeRate
+		expected []int64
+	}{
+		{
+			name:     "no transactions",
+			expected: []int64{0, 0, 0, 0, 0},
+		},
+		{
+			name:     "single transaction",
+			feeRates: []weightedFeeRate{{feeRate: 7, weight: 400}},
+			expected: []int64{7, 7, 7, 7, 7},
+		},
+		{
+			name: "unsorted transactions",
+			feeRates: []weightedFeeRate{
+				{feeRate: 3, weight: 600},
+				{feeRate: 1, weight: 100},
+				{feeRate: 2, weight: 300},
+			},
+			expected: []int64{1, 2, 3, 3, 3},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var totalWeight int64
+			for _, feeRate := range tc.feeRates {
+				totalWeight += feeRate.weight
+			}
+			require.Equal(t, tc.expected,
+				feeRatePercentiles(tc.feeRates, totalWeight))
+		})
+	}
+}
+
+// newTestVerboseBlock returns a block of numTxs transactions besides the
+// coinbase, each spending an input to numOutputs outputs.
+func newTestVerboseBlock(numTxs, numOutputs int) *btcutil.Block {
+	pkScript := append([]byte{0x76, 0xa9, 0x14}, make([]byte, 20)...)
+	pkScript = append(pkScript, txscript.OP_EQUALVERIFY, txscript.OP_CHECKSIG)
+
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(wire.NewTxIn(
+		wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex),
+		[]byte{0x51, 0x51}, nil,
+	))
+	coinbase.AddTxOut(wire.NewTxOut(50_0000_0000, pkScript))
+	msgBlock := &wire.MsgBlock{
+		Header:       wire.BlockHeader{Timestamp: time.Unix(1_700_000_000, 0)},
+		Transactions: []*wire.MsgTx{coinbase},
+	}
+	for i := 0; i < numTxs; i++ {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(
+			wire.NewOutPoint(&chainhash.Hash{byte(i), byte(i >> 8)}, 0),
+			make([]byte, 107), nil,
+		))
+		for j := 0; j < numOutputs; j++ {
+			tx.AddTxOut(wire.NewTxOut(int64(1_000+j), pkScript))
+		}
+		msgBlock.Transactions = append(msgBlock.Transactions, tx)
+	}
+
+	block := btcutil.NewBlock(msgBlock)
+	block.SetHeight(10)
+	return block
+}
+
+// bufferedVerboseTxReply returns the reply to a getblock command with a
+// verbosity of 2 for block, marshalled in memory as a whole.
+func bufferedVerboseTxReply(params *chaincfg.Params, block *btcutil.Block,
+	chainHeight int32) ([]byte, error) {
+
+	header := &block.MsgBlock().Header
+	reply := btcjson.GetBlockVerboseResult{
+		Hash:   block.Hash().String(),
+		Height: int64(block.Height()),
+		Time:   header.Timestamp.Unix(),
+	}
+	for _, tx := range block.Transactions() {
+		rawTxn, err := createTxRawResult(params, tx.MsgTx(),
+			tx.Hash().String(), header, block.Hash().String(),
+			block.Height(), chainHeight)
+		if err != nil {
+			return nil, err
+		}
+		reply.RawTx = append(reply.RawTx, *rawTxn)
+	}
+	return createMarshalledReply(btcjson.RpcVersion1, 1, reply, nil)
+}
+
+// TestGetBlockVerboseTxReply checks that the streamed reply to a getblock
+// command with a verbosity of 2 matches the reply marshalled as a whole.
+func TestGetBlockVerboseTxReply(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	params := &chaincfg.RegressionNetParams
+	block := newTestVerboseBlock(3, 2)
+	expected, err := bufferedVerboseTxReply(params, block, 12)
+	require.NoError(err)
+
+	header := &block.MsgBlock().Header
+	reply := &getBlockVerboseTxReply{
+		GetBlockVerboseResult: btcjson.GetBlockVerboseResult{
+			Hash:   block.Hash().String(),
+			Height: int64(block.Height()),
+			Time:   header.Timestamp.Unix(),
+		},
+		params:      params,
+		block:       block,
+		chainHeight: 12,
+	}
+	var streamed bytes.Buffer
+	require.NoError(writeStreamedReply(&streamed, btcjson.RpcVersion1, 1, reply))
+	require.Equal(string(expected), streamed.String())
+
+	// Buffered replies, such as those of websocket clients, marshal the
+	// streamed result as a whole.
+	marshalled, err := createMarshalledReply(btcjson.RpcVersion1, 1, reply, nil)
+	require.NoError(err)
+	require.Equal(string(expected), string(marshalled))
+
+	var response btcjson.Response
+	require.NoError(json.Unmarshal(streamed.Bytes(), &response))
+	var result btcjson.GetBlockVerboseResult
+	require.NoError(json.Unmarshal(response.Result, &result))
+	require.Len(result.RawTx, 4)
+	require.Equal(block.Transactions()[3].Hash().String(), result.RawTx[3].Txid)
+}
+
+// TestAcceptsGzip checks the parsing of the encodings accepted by clients.
+func TestAcceptsGzip(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		acceptEncoding string
+		expected       bool
+	}{
+		{acceptEncoding: "", expected: false},
+		{acceptEncoding: "gzip", expected: true},
+		{acceptEncoding: "deflate, gzip;q=0.5", expected: true},
+		{acceptEncoding: "gzip;q=0", expected: false},
+		{acceptEncoding: "br, identity", expected: false},
+	}
+	for _, test := range testCases {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set("Accept-Encoding", test.acceptEncoding)
+		require.Equal(t, test.expected, acceptsGzip(r), test.acceptEncoding)
+	}
+}
+
+// peakHeapWriter discards what is written to it while sampling the size of
+// the heap.
+type peakHeapWriter struct {
+	writes   int
+	peakHeap uint64
+}
+
+func (w *peakHeapWriter) Write(p []byte) (int, error) {
+	if w.writes%64 == 0 {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		w.peakHeap = max(w.peakHeap, stats.HeapAlloc)
+	}
+	w.writes++
+	return len(p), nil
+}
+
+// BenchmarkGetBlockVerboseTxReply compares the peak heap size of writing the
+// reply to a getblock command with a verbosity of 2 for a 4MB block marshalled
+// as a whole and streamed.
+func BenchmarkGetBlockVerboseTxReply(b *testing.B) {
+	params := &chaincfg.RegressionNetParams
+	block := newTestVerboseBlock(2_000, 55)
+	require.Greater(b, block.MsgBlock().SerializeSize(), 4_000_000)
+
+	run := func(b *testing.B, write func(w io.Writer) error) {
+		b.ReportAllocs()
+		var peakHeap uint64
+		for i := 0; i < b.N; i++ {
+			runtime.GC()
+			var stats runtime.MemStats
+			runtime.ReadMemStats(&stats)
+			w := &peakHeapWriter{}
+			require.NoError(b, write(w))
+			peakHeap = max(peakHeap, w.peakHeap-min(w.peakHeap, stats.HeapAlloc))
+		}
+		b.ReportMetric(float64(peakHeap), "peak-heap-B")
+	}
+
+	b.Run("buffered", func(b *testing.B) {
+		run(b, func(w io.Writer) error {
+			reply, err := bufferedVerboseTxReply(params, block, 12)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(reply)
+			return err
+		})
+	})
+	b.Run("streamed", func(b *testing.B) {
+		run(b, func(w io.Writer) error {
+			return writeStreamedReply(w, btcjson.RpcVersion1, 1,
+				&getBlockVerboseTxReply{
+					GetBlockVerboseResult: btcjson.GetBlockVerboseResult{
+						Hash:   block.Hash().String(),
+						Height: int64(block.Height()),
+					},
+					params:      params,
+					block:       block,
+					chainHeight: 12,
+				})
+		})
+	})
+}
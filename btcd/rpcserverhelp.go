@@ -80,6 +80,7 @@ var helpDescsEnUS = map[string]string{
 	"vin-scriptSig":   "The signature script used to redeem the origin transaction as a JSON object (non-coinbase txns only)",
 	"vin-txinwitness": "The witness used to redeem the input encoded as a string array of its items",
 	"vin-sequence":    "The script sequence number",
+	"vin-prevOut":     "Data from the origin transaction output with index vout, when the spent output index is enabled (non-coinbase txns only)",
 
 	// ScriptPubKeyResult help.
 	"scriptpubkeyresult-asm":       "Disassembly of the script",
@@ -111,7 +112,7 @@ var helpDescsEnUS = map[string]string{
 	"decodescriptresult-type":      "The type of the script (e.g. 'pubkeyhash')",
 	"decodescriptresult-address":   "The bitcoin address associated with this script (only if a well-defined address exists)",
 	"decodescriptresult-addresses": "(DEPRECATED) The bitcoin addresses associated with this script",
-	"decodescriptresult-p2sh":      "The script hash for use in pay-to-script-hash transactions (only present if the provided redeem script is not already a pay-to-script-hash script)",
+	"decodescriptresult-p2sh":      "The script hash for use in pay-to-script-hash transactions (only present if the provided redeem script is not already a pay-to-script-hash or taproot script)",
 
 	// DecodeScriptCmd help.
 	"decodescript--synopsis": "Returns a JSON object with information about the provided hex-encoded script.",
@@ -126,12 +127,48 @@ var helpDescsEnUS = map[string]string{
 	"estimatefee--result0": "Estimated fee per kilobyte in satoshis for a block to " +
 		"be mined in the next NumBlocks blocks.",
 
+	// EstimateSmartFeeCmd help.
+	"estimatesmartfee--synopsis": "Estimate the fee rate required for a transaction to be confirmed within a " +
+		"number of blocks of the target block time.",
+	"estimatesmartfee-conftarget":   "The number of blocks the transaction should be confirmed within",
+	"estimatesmartfee-estimatemode": "The estimate mode: ECONOMICAL, or CONSERVATIVE to require a higher likelihood of confirmation",
+
+	// EstimateFeeByTimeCmd help.
+	"estimatefeebytime--synopsis": "Estimate the fee rate required for a transaction to be confirmed within a " +
+		"number of seconds.",
+	"estimatefeebytime-seconds":      "The number of seconds the transaction should be confirmed within",
+	"estimatefeebytime-estimatemode": "The estimate mode: ECONOMICAL, or CONSERVATIVE to require a higher likelihood of confirmation",
+
+	// EstimateSmartFeeResult help.
+	"estimatesmartfeeresult-feerate": "Estimated fee rate in BTC/kvB",
+	"estimatesmartfeeresult-errors":  "Errors encountered during processing",
+	"estimatesmartfeeresult-blocks":  "Number of blocks the estimate is for",
+
+	// ExportChainStateCmd help.
+	"exportchainstate--synopsis": "Write the blocks of the accepted chain from genesis to the last accepted block to a new directory,\n" +
+		"in the bitcoind blk file format, along with a manifest of the tip and a checksum for seeding other nodes.",
+	"exportchainstate-dir": "The directory on the server to write the export to",
+
+	// ExportChainStateResult help.
+	"exportchainstateresult-dir":       "The directory the export was written to",
+	"exportchainstateresult-tipheight": "The height of the last exported block",
+	"exportchainstateresult-tiphash":   "The hash of the last exported block",
+	"exportchainstateresult-checksum":  "The hex-encoded SHA-256 of the blocks file",
+
 	// GenerateCmd help
 	"generate--synopsis": "Generates a set number of blocks (simnet or regtest only) and returns a JSON\n" +
 		" array of their hashes.",
 	"generate-numblocks": "Number of blocks to generate",
 	"generate--result0":  "The hashes, in order, of blocks generated by the call",
 
+	// GenerateToAddressCmd help
+	"generatetoaddress--synopsis": "Generates a set number of blocks paying the given address and returns a JSON\n" +
+		" array of their hashes. Blocks are built and accepted through consensus, so the call waits for each block to be accepted.",
+	"generatetoaddress-numblocks": "Number of blocks to generate",
+	"generatetoaddress-address":   "The address to send the newly generated bitcoin to",
+	"generatetoaddress-maxtries":  "Unused, blocks are not mined",
+	"generatetoaddress--result0":  "The hashes, in order, of blocks generated by the call",
+
 	// GetAddedNodeInfoResultAddr help.
 	"getaddednodeinforesultaddr-address":   "The ip address for this DNS entry",
 	"getaddednodeinforesultaddr-connected": "The connection 'direction' (inbound/outbound/false)",
@@ -187,6 +224,7 @@ var helpDescsEnUS = map[string]string{
 	"getblockchaininforesult-initialblockdownload": "Estimate of whether this node is in Initial Block Download mode",
 	"getblockchaininforesult-softforks":            "The status of the super-majority soft-forks",
 	"getblockchaininforesult-unifiedsoftforks":     "The status of the super-majority soft-forks used by bitcoind on or after v0.19.0",
+	"getblockchaininforesult-consensusinfo":        "The consensus the chain is run by (btcvm only)",
 
 	// SoftForkDescription help.
 	"softforkdescription-reject":  "The current activation status of the softfork",
@@ -207,6 +245,15 @@ var helpDescsEnUS = map[string]string{
 	"unifiedsoftforks-softforks--value": "An object describing an active softfork deployment used by bitcoind on or after v0.19.0",
 	"unifiedsoftforks-softforks--desc":  "JSON object describing an active softfork deployment used by bitcoind on or after v0.19.0",
 
+	// ConsensusInfo help.
+	"consensusinfo-engine":           "The consensus engine accepting blocks",
+	"consensusinfo-lastaccepted":     "The ID of the last accepted block in Metal format",
+	"consensusinfo-targetblocktime":  "The target interval between blocks in seconds",
+	"consensusinfo-powenforced":      "Whether block headers must satisfy the proof of work target",
+	"consensusinfo-coinbasematurity": "The number of blocks before a coinbase output can be spent",
+	"consensusinfo-subnetid":         "The ID of the subnet validating the chain",
+	"consensusinfo-chainid":          "The ID of the chain",
+
 	// TxRawResult help.
 	"txrawresult-hex":           "Hex-encoded transaction",
 	"txrawresult-txid":          "The hash of the transaction",
@@ -221,6 +268,7 @@ var helpDescsEnUS = map[string]string{
 	"txrawresult-size":          "The size of the transaction in bytes",
 	"txrawresult-vsize":         "The virtual size of the transaction in bytes",
 	"txrawresult-weight":        "The transaction's weight (between vsize*4-3 and vsize*4)",
+	"txrawresult-finalized":     "Whether the block of the transaction is accepted by consensus, omitted when the last accepted height is not known yet",
 	"txrawresult-hash":          "The wtxid of the transaction",
 
 	// SearchRawTransactionsResult help.
@@ -257,11 +305,21 @@ var helpDescsEnUS = map[string]string{
 	"getblockverboseresult-nextblockhash":     "The hash of the next block (only if there is one)",
 	"getblockverboseresult-strippedsize":      "The size of the block without witness data",
 	"getblockverboseresult-weight":            "The weight of the block",
+	"getblockverboseresult-proposer":          "The NodeID of the validator which built the block (only if its coinbase records one)",
 
 	// GetBlockCountCmd help.
 	"getblockcount--synopsis": "Returns the number of blocks in the longest block chain.",
 	"getblockcount--result0":  "The current block count",
 
+	// GetBlockFilterCmd help.
+	"getblockfilter--synopsis":  "Returns the BIP0158 filter of an accepted block and its filter header.",
+	"getblockfilter-blockhash":  "The hash of the block",
+	"getblockfilter-filtertype": "The type name of the filter (basic)",
+
+	// GetBlockFilterResult help.
+	"getblockfilterresult-filter": "The hex-encoded filter",
+	"getblockfilterresult-header": "The hex-encoded filter header",
+
 	// GetBlockHashCmd help.
 	"getblockhash--synopsis": "Returns hash of the block in best block chain at the given height.",
 	"getblockhash-index":     "The block height",
@@ -275,6 +333,15 @@ var helpDescsEnUS = map[string]string{
 	"getblockheader--condition1": "verbose=true",
 	"getblockheader--result0":    "The block header hash",
 
+	// GetBlockHeadersCmd help.
+	"getblockheaders--synopsis":   "Returns the headers of consecutive main chain blocks, read from the block index without loading the blocks.",
+	"getblockheaders-startheight": "The height of the first block",
+	"getblockheaders-count":       "The number of headers to return, at most 2000 (fewer are returned if the main chain ends before)",
+	"getblockheaders-verbose":     "Specifies the block headers are returned as JSON objects instead of hex-encoded strings",
+	"getblockheaders--condition0": "verbose=false",
+	"getblockheaders--condition1": "verbose=true",
+	"getblockheaders--result0":    "The hex-encoded block headers",
+
 	// GetBlockHeaderVerboseResult help.
 	"getblockheaderverboseresult-hash":              "The hash of the block (same as provided)",
 	"getblockheaderverboseresult-confirmations":     "The number of confirmations",
@@ -289,6 +356,43 @@ var helpDescsEnUS = map[string]string{
 	"getblockheaderverboseresult-previousblockhash": "The hash of the previous block",
 	"getblockheaderverboseresult-nextblockhash":     "The hash of the next block (only if there is one)",
 
+	// GetBlockStatsCmd help.
+	"getblockstats--synopsis":    "Returns fee, size and weight statistics of a block of the main chain, computed from the outputs it spends. Only the selected statistics are returned when stats is given. The coinbase transaction is excluded from the fee and size statistics.",
+	"getblockstats-hashorheight": "The hash or height of the block",
+	"hashorheight-value":         "The hash or height of the block",
+	"getblockstats-stats":        "The statistics to return, which are all returned when omitted",
+
+	// GetBlockStatsResult help.
+	"getblockstatsresult-avgfee":              "The average fee of the transactions in satoshis",
+	"getblockstatsresult-avgfeerate":          "The average fee rate of the transactions in satoshis per virtual byte",
+	"getblockstatsresult-avgtxsize":           "The average size of the transactions in bytes",
+	"getblockstatsresult-feerate_percentiles": "The 10th, 25th, 50th (median), 75th and 90th percentiles of the fee rates in satoshis per virtual byte, weighted by the weight of the transactions",
+	"getblockstatsresult-blockhash":           "The hash of the block",
+	"getblockstatsresult-height":              "The height of the block",
+	"getblockstatsresult-ins":                 "The number of inputs",
+	"getblockstatsresult-maxfee":              "The max fee of the transactions in satoshis",
+	"getblockstatsresult-maxfeerate":          "The max fee rate of the transactions in satoshis per virtual byte",
+	"getblockstatsresult-maxtxsize":           "The max size of the transactions in bytes",
+	"getblockstatsresult-medianfee":           "The median fee of the transactions in satoshis",
+	"getblockstatsresult-mediantime":          "The median time past of the block in seconds since 1 Jan 1970 GMT",
+	"getblockstatsresult-mediantxsize":        "The median size of the transactions in bytes",
+	"getblockstatsresult-minfee":              "The min fee of the transactions in satoshis",
+	"getblockstatsresult-minfeerate":          "The min fee rate of the transactions in satoshis per virtual byte",
+	"getblockstatsresult-mintxsize":           "The min size of the transactions in bytes",
+	"getblockstatsresult-outs":                "The number of outputs, including those of the coinbase transaction",
+	"getblockstatsresult-swtotal_size":        "The total size of the segwit transactions in bytes",
+	"getblockstatsresult-swtotal_weight":      "The total weight of the segwit transactions",
+	"getblockstatsresult-swtxs":               "The number of segwit transactions",
+	"getblockstatsresult-subsidy":             "The block subsidy in satoshis",
+	"getblockstatsresult-time":                "The block time in seconds since 1 Jan 1970 GMT",
+	"getblockstatsresult-totalfee":            "The total fee of the transactions in satoshis",
+	"getblockstatsresult-total_out":           "The total amount of the outputs of the transactions in satoshis",
+	"getblockstatsresult-total_size":          "The total size of the transactions in bytes",
+	"getblockstatsresult-total_weight":        "The total weight of the transactions",
+	"getblockstatsresult-txs":                 "The number of transactions, including the coinbase transaction",
+	"getblockstatsresult-utxo_increase":       "The number of unspent outputs created minus the number of outputs spent",
+	"getblockstatsresult-utxo_size_inc":       "The increase of the size of the unspent outputs in bytes",
+
 	// TemplateRequest help.
 	"templaterequest-mode":         "This is 'template', 'proposal', or omitted",
 	"templaterequest-capabilities": "List of capabilities",
@@ -350,14 +454,26 @@ var helpDescsEnUS = map[string]string{
 	"getblocktemplate--result1":    "An error string which represents why the proposal was rejected or nothing if accepted",
 
 	// GetChainTipsResult help.
-	"getchaintipsresult-chaintips": "The chaintips that this node is aware of",
-	"getchaintipsresult-height":    "The height of the chain tip",
-	"getchaintipsresult-hash":      "The block hash of the chain tip",
-	"getchaintipsresult-branchlen": "Returns zero for main chain. Otherwise is the length of branch connecting the tip to the main chain",
-	"getchaintipsresult-status":    "Status of the chain. Returns \"active\" for the main chain",
+	"getchaintipsresult-chaintips":       "The chaintips that this node is aware of",
+	"getchaintipsresult-height":          "The height of the chain tip",
+	"getchaintipsresult-hash":            "The block hash of the chain tip",
+	"getchaintipsresult-branchlen":       "Returns zero for main chain. Otherwise is the length of branch connecting the tip to the main chain",
+	"getchaintipsresult-status":          "Status of the chain. Returns \"active\" for the main chain",
+	"getchaintipsresult-consensusstatus": "Status of the tip in consensus: \"accepted\", \"processing\" if it is not decided yet, \"rejected\", or \"orphaned\" if consensus does not know it",
 	// GetChainTipsCmd help.
 	"getchaintips--synopsis": "Returns information about all known tips in the block tree, including the main chain as well as orphaned branches.",
 
+	// GetCFHeadersCmd help.
+	"getcfheaders--synopsis":   "Returns the BIP0158 filter hashes of a range of accepted blocks and the filter header preceding them, as in the cfheaders message of BIP0157.",
+	"getcfheaders-startheight": "The height of the first block",
+	"getcfheaders-stophash":    "The hash of the last block",
+	"getcfheaders-filtertype":  "The type name of the filters (basic)",
+
+	// GetCFHeadersResult help.
+	"getcfheadersresult-stophash":         "The hash of the last block",
+	"getcfheadersresult-prevfilterheader": "The filter header of the block before the first block",
+	"getcfheadersresult-filterhashes":     "The filter hashes of the blocks, in order of height",
+
 	// GetCFilterCmd help.
 	"getcfilter--synopsis":  "Returns a block's committed filter given its hash.",
 	"getcfilter-filtertype": "The type of filter to return (0=regular)",
@@ -370,16 +486,26 @@ var helpDescsEnUS = map[string]string{
 	"getcfilterheader-hash":       "The hash of the block",
 	"getcfilterheader--result0":   "The block's gcs filter header",
 
+	// GetCheckpointCmd help.
+	"getcheckpoint--synopsis": "Returns the last accepted block as a checkpoint, in the format of the checkpoints of the VM config.",
+
+	// GetCheckpointResult help.
+	"getcheckpointresult-height": "The height of the last accepted block",
+	"getcheckpointresult-hash":   "The hash of the last accepted block",
+
 	// GetConnectionCountCmd help.
 	"getconnectioncount--synopsis": "Returns the number of active connections to other peers.",
 	"getconnectioncount--result0":  "The number of connections",
 
+	// GetConsensusInfoCmd help.
+	"getconsensusinfo--synopsis": "Returns information about the Snowman consensus the chain is run by on its Metal subnet.",
+
 	// GetCurrentNetCmd help.
 	"getcurrentnet--synopsis": "Get bitcoin network the server is running on.",
 	"getcurrentnet--result0":  "The network identifier",
 
 	// GetDifficultyCmd help.
-	"getdifficulty--synopsis": "Returns the proof-of-work difficulty as a multiple of the minimum difficulty.",
+	"getdifficulty--synopsis": "Returns the proof-of-work difficulty as a multiple of the minimum difficulty, which is 1 on chains without proof of work.",
 	"getdifficulty--result0":  "The difficulty",
 
 	// GetGenerateCmd help.
@@ -426,15 +552,110 @@ var helpDescsEnUS = map[string]string{
 	"getheaders-hashstop":      "Block hash to stop including block headers for; if not found, all headers to the latest known block are returned.",
 	"getheaders--result0":      "Serialized block headers of all located blocks, limited to some arbitrary maximum number of hashes (currently 2000, which matches the wire protocol headers message, but this is not guaranteed)",
 
+	// GetDoubleSpendsCmd help.
+	"getdoublespends--synopsis": "Returns the recently seen double spends involving the given transaction, either as the mempool transaction or as the transaction conflicting with it.",
+	"getdoublespends-txid":      "The hash of the transaction",
+
+	// DoubleSpendResult help.
+	"doublespendresult-txid":         "The hash of the transaction conflicting with the mempool",
+	"doublespendresult-conflicttxid": "The hash of the mempool transaction it conflicts with",
+	"doublespendresult-outpoints":    "The outpoints spent by both transactions",
+	"doublespendresult-confirmed":    "Whether the conflicting transaction was confirmed in a block",
+	"doublespendresult-time":         "The time the double spend was seen in seconds since 1 Jan 1970 GMT",
+
+	// GetGossipInfoCmd help.
+	"getgossipinfo--synopsis": "Returns the state of the bloom filter of the gossiped items and the activity of the push and pull gossip loops.",
+
+	// GetGossipInfoResult help.
+	"getgossipinforesult-bloom":          "The bloom filter of the gossiped items",
+	"getgossipinforesult-push":           "The push gossip loop, counting the items pushed to peers",
+	"getgossipinforesult-pull":           "The pull gossip loop, counting the items received in responses to pull requests",
+	"getgossipinforesult-pushqueuedepth": "The number of items waiting to be pushed for the first time",
+	"getgossipinforesult-bytessent":      "The number of bytes of items sent by push gossip and in responses to pull requests of peers",
+	"getgossipinforesult-bytesreceived":  "The number of bytes of items received by push gossip of peers and in responses to pull requests",
+
+	// GossipBloomInfo help.
+	"gossipbloominfo-elements":               "The estimated number of elements added to the bloom filter since it was last reset",
+	"gossipbloominfo-maxelements":            "The number of elements after which the bloom filter is reset",
+	"gossipbloominfo-size":                   "The target number of elements of the bloom filter",
+	"gossipbloominfo-falsepositiverate":      "The target false positive rate of the bloom filter",
+	"gossipbloominfo-resetfalsepositiverate": "The false positive rate at which the bloom filter is reset",
+	"gossipbloominfo-resets":                 "The number of times the bloom filter was reset",
+	"gossipbloominfo-rotations":              "The number of resets due to the timed rotation of the salt rather than to the filter filling up",
+
+	// GossipLoopInfo help.
+	"gossiploopinfo-items":             "The number of items moved by the loop",
+	"gossiploopinfo-bytes":             "The number of bytes of the items moved by the loop",
+	"gossiploopinfo-lastintervalitems": "The number of items moved between the last two cycles of the loop",
+	"gossiploopinfo-lastcycle":         "The time of the last cycle of the loop in seconds since 1 Jan 1970 GMT, or 0 if it has not run",
+
 	// GetInfoCmd help.
 	"getinfo--synopsis": "Returns a JSON object containing various state info.",
 
+	// GetMempoolAncestorsCmd help.
+	"getmempoolancestors--synopsis":       "Returns the unconfirmed ancestors of the given transaction in the memory pool.",
+	"getmempoolancestors-txid":            "The hash of the transaction",
+	"getmempoolancestors-verbose":         "Returns JSON object of mempool entries when true or an array of transaction hashes when false",
+	"getmempoolancestors--condition0":     "verbose=false",
+	"getmempoolancestors--condition1":     "verbose=true",
+	"getmempoolancestors--result0":        "Array of transaction hashes",
+	"getmempoolancestors--result1--desc":  "Mempool data keyed by the transaction hash",
+	"getmempoolancestors--result1--key":   "Transaction hash",
+	"getmempoolancestors--result1--value": "Object containing the mempool data of the transaction",
+
+	// GetMempoolDescendantsCmd help.
+	"getmempooldescendants--synopsis":       "Returns the unconfirmed descendants of the given transaction in the memory pool.",
+	"getmempooldescendants-txid":            "The hash of the transaction",
+	"getmempooldescendants-verbose":         "Returns JSON object of mempool entries when true or an array of transaction hashes when false",
+	"getmempooldescendants--condition0":     "verbose=false",
+	"getmempooldescendants--condition1":     "verbose=true",
+	"getmempooldescendants--result0":        "Array of transaction hashes",
+	"getmempooldescendants--result1--desc":  "Mempool data keyed by the transaction hash",
+	"getmempooldescendants--result1--key":   "Transaction hash",
+	"getmempooldescendants--result1--value": "Object containing the mempool data of the transaction",
+
+	// GetMempoolEntryCmd help.
+	"getmempoolentry--synopsis": "Returns mempool data for the given transaction, along with the statistics of its unconfirmed ancestors and descendants.",
+	"getmempoolentry-txid":      "The hash of the transaction",
+
+	// GetMempoolEntryResult help.
+	"getmempoolentryresult-vsize":           "Transaction virtual size",
+	"getmempoolentryresult-size":            "Transaction size in bytes",
+	"getmempoolentryresult-weight":          "Transaction weight",
+	"getmempoolentryresult-fee":             "Transaction fee in bitcoins",
+	"getmempoolentryresult-modifiedfee":     "Transaction fee in bitcoins used for mining priority",
+	"getmempoolentryresult-time":            "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
+	"getmempoolentryresult-height":          "Block height when transaction entered the pool",
+	"getmempoolentryresult-descendantcount": "Number of in-mempool descendant transactions, including this one",
+	"getmempoolentryresult-descendantsize":  "Virtual size of in-mempool descendants, including this one",
+	"getmempoolentryresult-descendantfees":  "Fees in satoshis of in-mempool descendants, including this one",
+	"getmempoolentryresult-ancestorcount":   "Number of in-mempool ancestor transactions, including this one",
+	"getmempoolentryresult-ancestorsize":    "Virtual size of in-mempool ancestors, including this one",
+	"getmempoolentryresult-ancestorfees":    "Fees in satoshis of in-mempool ancestors, including this one",
+	"getmempoolentryresult-wtxid":           "The hash of the serialized transaction, including witness data",
+	"getmempoolentryresult-fees":            "The fees of the transaction and of its ancestors and descendants in bitcoins",
+	"getmempoolentryresult-depends":         "Unconfirmed transactions used as inputs for this transaction",
+	"getmempoolentryresult-spentby":         "Unconfirmed transactions spending outputs of this transaction",
+
+	// MempoolFees help.
+	"mempoolfees-base":       "Transaction fee in bitcoins",
+	"mempoolfees-modified":   "Transaction fee in bitcoins used for mining priority",
+	"mempoolfees-ancestor":   "Fees in bitcoins of in-mempool ancestors, including this one",
+	"mempoolfees-descendant": "Fees in bitcoins of in-mempool descendants, including this one",
+
 	// GetMempoolInfoCmd help.
 	"getmempoolinfo--synopsis": "Returns memory pool information",
 
 	// GetMempoolInfoResult help.
-	"getmempoolinforesult-bytes": "Size in bytes of the mempool",
-	"getmempoolinforesult-size":  "Number of transactions in the mempool",
+	"getmempoolinforesult-bytes":              "Size in bytes of the mempool",
+	"getmempoolinforesult-size":               "Number of transactions in the mempool",
+	"getmempoolinforesult-orphans":            "Number of orphan transactions waiting for their parents",
+	"getmempoolinforesult-maxmempool":         "Maximum size in bytes of the mempool, 0 if unlimited",
+	"getmempoolinforesult-mempoolminfee":      "Minimum fee rate in sat/vB of transactions accepted to the mempool, raised above the minimum relay fee rate once it is full",
+	"getmempoolinforesult-mingossipfeerate":   "Minimum fee rate in sat/vB of transactions accepted from gossip",
+	"getmempoolinforesult-minrelayfeerate":    "Minimum fee rate in sat/vB of transactions gossiped to peers",
+	"getmempoolinforesult-datacarrier":        "Whether transactions with OP_RETURN outputs are accepted",
+	"getmempoolinforesult-maxdatacarriersize": "Maximum number of bytes of data carried by the OP_RETURN outputs of an accepted transaction",
 
 	// GetMiningInfoResult help.
 	"getmininginforesult-blocks":             "Height of the latest best block",
@@ -449,12 +670,24 @@ var helpDescsEnUS = map[string]string{
 	"getmininginforesult-networkhashps":      "Estimated network hashes per second for the most recent blocks",
 	"getmininginforesult-pooledtx":           "Number of transactions in the memory pool",
 	"getmininginforesult-testnet":            "Whether or not server is using testnet",
+	"getmininginforesult-blockmaxweight":     "Maximum weight of blocks built by the server",
+	"getmininginforesult-blockmaxsize":       "Maximum size of blocks built by the server, excluding witness data",
+	"getmininginforesult-metal":              "The block builder of the node on the Metal network",
+
+	// MetalMiningInfo help.
+	"metalmininginfo-builderenabled":  "Whether the node builds blocks to propose to consensus",
+	"metalmininginfo-miningaddrs":     "The addresses paid by the coinbase of the blocks built by the node",
+	"metalmininginfo-targetblocktime": "The target time between blocks in seconds",
+	"metalmininginfo-powdisabled":     "Whether blocks carry no proof of work, in which case the difficulty is 1 and the network hashes per second 0",
+	"metalmininginfo-lastbuiltblock":  "The hash of the last block built by the node",
+	"metalmininginfo-lastbuiltheight": "The height of the last block built by the node",
+	"metalmininginfo-lastbuilttime":   "The time the last block was built by the node in seconds since 1 Jan 1970 GMT",
 
 	// GetMiningInfoCmd help.
 	"getmininginfo--synopsis": "Returns a JSON object containing mining-related information.",
 
 	// GetNetworkHashPSCmd help.
-	"getnetworkhashps--synopsis": "Returns the estimated network hashes per second for the block heights provided by the parameters.",
+	"getnetworkhashps--synopsis": "Returns the estimated network hashes per second for the block heights provided by the parameters, which is 0 on chains without proof of work.",
 	"getnetworkhashps-blocks":    "The number of blocks, or -1 for blocks since last difficulty change",
 	"getnetworkhashps-height":    "Perform estimate ending with this height or -1 for current best chain block height",
 	"getnetworkhashps--result0":  "Estimated hashes per second",
@@ -467,6 +700,49 @@ var helpDescsEnUS = map[string]string{
 	"getnettotalsresult-totalbytessent": "Total bytes sent",
 	"getnettotalsresult-timemillis":     "Number of milliseconds since 1 Jan 1970 GMT",
 
+	// GetNetworkInfoCmd help.
+	"getnetworkinfo--synopsis": "Returns information about the node and its connections to the network.",
+
+	// GetNetworkInfoResult help.
+	"getnetworkinforesult-version":          "The version of the node",
+	"getnetworkinforesult-subversion":       "The user agent of the node",
+	"getnetworkinforesult-protocolversion":  "The protocol version of the node",
+	"getnetworkinforesult-localservices":    "Services bitmask which represents the services supported by the node",
+	"getnetworkinforesult-localrelay":       "Whether transactions are relayed to peers",
+	"getnetworkinforesult-timeoffset":       "The time offset of the node",
+	"getnetworkinforesult-connections":      "The number of connected peers",
+	"getnetworkinforesult-connections_in":   "The number of inbound connections",
+	"getnetworkinforesult-connections_out":  "The number of outbound connections",
+	"getnetworkinforesult-networkactive":    "Whether networking is enabled",
+	"getnetworkinforesult-networks":         "Information about each network the node can connect to",
+	"getnetworkinforesult-relayfee":         "Minimum fee in bitcoins per kB for transactions to be relayed",
+	"getnetworkinforesult-incrementalfee":   "Minimum fee rate increase in bitcoins per kB for mempool replacement",
+	"getnetworkinforesult-localaddresses":   "The addresses the node listens on",
+	"getnetworkinforesult-warnings":         "Any network warnings",
+	"getnetworkinforesult-mingossipfeerate": "Minimum fee rate in sat/vB of transactions accepted from gossip",
+	"getnetworkinforesult-minrelayfeerate":  "Minimum fee rate in sat/vB of transactions gossiped to peers",
+	"getnetworkinforesult-metal":            "The connectivity of the node on the Metal network",
+
+	// NetworksResult help.
+	"networksresult-name":                        "The name of the network",
+	"networksresult-limited":                     "Whether the network is limited using -onlynet",
+	"networksresult-reachable":                   "Whether the network is reachable",
+	"networksresult-proxy":                       "The proxy used for the network",
+	"networksresult-proxy_randomize_credentials": "Whether random credentials are used for the proxy",
+
+	// LocalAddressesResult help.
+	"localaddressesresult-address": "The local address",
+	"localaddressesresult-port":    "The port of the local address",
+	"localaddressesresult-score":   "The relative score of the local address",
+
+	// MetalNetworkInfo help.
+	"metalnetworkinfo-nodeid":         "The ID of the node on the Metal network",
+	"metalnetworkinfo-networkid":      "The ID of the Metal network",
+	"metalnetworkinfo-subnetid":       "The ID of the subnet validating the chain",
+	"metalnetworkinfo-chainid":        "The ID of the chain",
+	"metalnetworkinfo-peers":          "The number of connected peers",
+	"metalnetworkinfo-validatorpeers": "The number of connected peers validating the subnet",
+
 	// GetNodeAddressesResult help.
 	"getnodeaddressesresult-time":     "Timestamp in seconds since epoch (Jan 1 1970 GMT) keeping track of when the node was last seen",
 	"getnodeaddressesresult-services": "The services offered",
@@ -497,9 +773,18 @@ var helpDescsEnUS = map[string]string{
 	"getpeerinforesult-inbound":        "Whether or not the peer is an inbound connection",
 	"getpeerinforesult-startingheight": "The latest block height the peer knew about when the connection was established",
 	"getpeerinforesult-currentheight":  "The current height of the peer",
-	"getpeerinforesult-banscore":       "The ban score",
+	"getpeerinforesult-banscore":       "The ban score, which decays over time for the peers on the Metal network",
 	"getpeerinforesult-feefilter":      "The requested minimum fee a transaction must have to be announced to the peer",
 	"getpeerinforesult-syncnode":       "Whether or not the peer is the sync peer",
+	"getpeerinforesult-v2_connection":  "Whether or not the connection uses the v2 transport protocol",
+	"getpeerinforesult-gossip":         "The items the peer pushed on the Metal network, by outcome",
+
+	// MetalPeerGossipInfo help.
+	"metalpeergossipinfo-usefulitems":    "The number of new transactions and blocks",
+	"metalpeergossipinfo-duplicateitems": "The number of transactions and blocks already known or recently rejected",
+	"metalpeergossipinfo-invalidtxs":     "The number of transactions which failed validation or could not be decoded",
+	"metalpeergossipinfo-invalidblocks":  "The number of blocks which failed validation or could not be decoded",
+	"metalpeergossipinfo-oversizeditems": "The number of items larger than any valid block",
 
 	// GetPeerInfoCmd help.
 	"getpeerinfo--synopsis": "Returns data about each connected network peer as an array of json objects.",
@@ -530,6 +815,28 @@ var helpDescsEnUS = map[string]string{
 	"getrawtransaction--condition1": "verbose=true",
 	"getrawtransaction--result0":    "Hex-encoded bytes of the serialized transaction",
 
+	// GetSpentInfoCmd help.
+	"getspentinfo--synopsis": "Returns the transaction of the main chain spending a transaction output.  Requires the spent output index to be enabled.",
+	"getspentinfo-txid":      "The hash of the transaction",
+	"getspentinfo-vout":      "The index of the output",
+
+	// GetSpentInfoResult help.
+	"getspentinforesult-txid":   "The hash of the spending transaction",
+	"getspentinforesult-index":  "The index of the input of the spending transaction",
+	"getspentinforesult-height": "The height of the block containing the spending transaction",
+
+	// GetTxConfirmationsCmd help.
+	"gettxconfirmations--synopsis": "Returns the confirmations of a transaction and whether the block containing it is accepted by consensus.\n" +
+		"Transactions of the main chain are only found when the transaction index is enabled.",
+	"gettxconfirmations-txid": "The hash of the transaction",
+
+	// GetTxConfirmationsResult help.
+	"gettxconfirmationsresult-blockhash":      "The hash of the block containing the transaction, omitted for mempool transactions",
+	"gettxconfirmationsresult-blockheight":    "The height of the block containing the transaction, omitted for mempool transactions",
+	"gettxconfirmationsresult-acceptedheight": "The height of the last block accepted by consensus",
+	"gettxconfirmationsresult-confirmations":  "The number of confirmations, counting blocks not accepted by consensus yet",
+	"gettxconfirmationsresult-finalized":      "Whether the block containing the transaction is at or below the last accepted height",
+
 	// GetTxOutResult help.
 	"gettxoutresult-bestblock":     "The block hash that contains the transaction output",
 	"gettxoutresult-confirmations": "The number of confirmations",
@@ -544,8 +851,14 @@ var helpDescsEnUS = map[string]string{
 	"gettxout-vout":           "The index of the output",
 	"gettxout-includemempool": "Include the mempool when true",
 
+	// GetTxOutProofCmd help.
+	"gettxoutproof--synopsis": "Returns a hex-encoded proof that the transactions are included in a block, serialized as a merkleblock message.",
+	"gettxoutproof-txids":     "The txids of the transactions to prove, which must be in the same block. Witness txids are not accepted",
+	"gettxoutproof-blockhash": "The hash of the block of the transactions, required unless the transaction index is enabled",
+	"gettxoutproof--result0":  "The hex-encoded proof",
+
 	// InvalidateBlockCmd help.
-	"invalidateblock--synopsis": "Invalidates the block of the given block hash. To re-validate the invalidated block, use the reconsiderblock rpc",
+	"invalidateblock--synopsis": "Invalidates the block of the given block hash, disconnecting it and its descendants and returning their transactions to the mempool. Blocks at or below the height of the last block accepted by consensus cannot be invalidated. To re-validate the invalidated block, use the reconsiderblock rpc",
 	"invalidateblock-blockhash": "The block hash of the block to invalidate",
 
 	// HelpCmd help.
@@ -580,7 +893,7 @@ var helpDescsEnUS = map[string]string{
 	// SendRawTransactionCmd help.
 	"sendrawtransaction--synopsis":    "Submits the serialized, hex-encoded transaction to the local peer and relays it to the network.",
 	"sendrawtransaction-hextx":        "Serialized, hex-encoded signed transaction",
-	"sendrawtransaction-feesetting":   "Whether or not to allow insanely high fees in bitcoind < v0.19.0 or the max fee rate for bitcoind v0.19.0 and later (btcd does not yet implement this parameter, so it has no effect)",
+	"sendrawtransaction-feesetting":   "Whether or not to allow insanely high fees in bitcoind < v0.19.0 or the max fee rate in BTC/kvB for bitcoind v0.19.0 and later (default 0.10, 0 or true to not limit the fee rate)",
 	"sendrawtransaction--result0":     "The hash of the transaction",
 	"allowhighfeesormaxfeerate-value": "Either the boolean value for the allowhighfees parameter in bitcoind < v0.19.0 or the numerical value for the maxfeerate field in bitcoind v0.19.0 and later",
 
@@ -589,6 +902,11 @@ var helpDescsEnUS = map[string]string{
 	"setgenerate-generate":     "Use true to enable generation, false to disable it",
 	"setgenerate-genproclimit": "The number of processors (cores) to limit generation to or -1 for default",
 
+	// SetLogLevelCmd help.
+	"setloglevel--synopsis": "Sets the log level of a subsystem of the VM (mempool, chain, rpc, gossip or builder) until the node restarts.",
+	"setloglevel-subsystem": "The subsystem to set the log level of",
+	"setloglevel-level":     "The log level (verbo, debug, trace, info, warn, error or fatal)",
+
 	// SignMessageWithPrivKeyCmd help.
 	"signmessagewithprivkey--synopsis": "Sign a message with the private key of an address",
 	"signmessagewithprivkey-privkey":   "The private key to sign the message with",
@@ -608,7 +926,7 @@ var helpDescsEnUS = map[string]string{
 	"submitblock-options":     "This parameter is currently ignored",
 	"submitblock--condition0": "Block successfully submitted",
 	"submitblock--condition1": "Block rejected",
-	"submitblock--result1":    "The reason the block was rejected",
+	"submitblock--result1":    "The reason the block was rejected, or the status of a block submitted to the VM: duplicate, orphan, rejected: <reason> or accepted-pending-consensus",
 
 	// ValidateAddressResult help.
 	"validateaddresschainresult-isvalid":         "Whether or not the address is valid",
@@ -639,6 +957,24 @@ var helpDescsEnUS = map[string]string{
 	"verifymessage-message":   "The signed message",
 	"verifymessage--result0":  "Whether or not the signature verified",
 
+	// VerifyTxOutProofCmd help.
+	"verifytxoutproof--synopsis": "Verifies a proof built by gettxoutproof against the main chain and returns the txids it proves, or an empty array if the proof is invalid.",
+	"verifytxoutproof-proof":     "The hex-encoded proof",
+	"verifytxoutproof--result0":  "The txids proven by the proof",
+
+	// WaitForBlockHeightCmd help.
+	"waitforblockheight--synopsis": "Waits until a block at or above a height is accepted by consensus or the timeout elapses, and returns the last accepted block.",
+	"waitforblockheight-height":    "The height to wait for",
+	"waitforblockheight-timeout":   "The time to wait in milliseconds, 0 to wait indefinitely",
+
+	// WaitForNewBlockCmd help.
+	"waitfornewblock--synopsis": "Waits until a new block is accepted by consensus or the timeout elapses, and returns the last accepted block.",
+	"waitfornewblock-timeout":   "The time to wait in milliseconds, 0 to wait indefinitely",
+
+	// WaitForBlockResult help.
+	"waitforblockresult-hash":   "The hash of the last accepted block",
+	"waitforblockresult-height": "The height of the last accepted block",
+
 	// -------- Websocket-specific help --------
 
 	// Session help.
@@ -689,6 +1025,27 @@ var helpDescsEnUS = map[string]string{
 	"reconsiderblock--synopsis": "Reconsiders the block of the given block hash. Can be used to re-validate blocks invalidated with invalidateblock",
 	"reconsiderblock-blockhash": "The block hash of the block to reconsider",
 
+	// ResyncChainStateCmd help.
+	"resyncchainstate--synopsis": "Rebuild the chain state, UTXO set and indexes included, by re-applying the blocks of the accepted chain recorded by consensus\n" +
+		"from the last height the chain state agrees with it. The resync runs in the background and is refused while the block builder is active.",
+	"resyncchainstate-statusonly": "Only return the status of the last resync without starting one",
+
+	// ResyncChainStateResult help.
+	"resyncchainstateresult-running":      "Whether the resync is running",
+	"resyncchainstateresult-startheight":  "The last height the chain state agreed with the accepted chain at",
+	"resyncchainstateresult-height":       "The height of the chain state tip",
+	"resyncchainstateresult-targetheight": "The height of the last accepted block",
+	"resyncchainstateresult-error":        "The error the resync stopped with, if any",
+
+	// RunMaintenanceCmd help.
+	"runmaintenance--synopsis": "Flush the UTXO cache and compact the chain database now rather than at the next maintenance window.\n" +
+		"No block is built or verified until the maintenance completes.",
+
+	// RunMaintenanceResult help.
+	"runmaintenanceresult-flushduration":   "The seconds spent flushing the UTXO cache",
+	"runmaintenanceresult-compacted":       "Whether the database was compacted, which is only supported by the ffldb and memdb backends",
+	"runmaintenanceresult-compactduration": "The seconds spent compacting the database",
+
 	// Rescan help.
 	"rescan--synopsis": "Rescan block chain for transactions to addresses.\n" +
 		"When the endblock parameter is omitted, the rescan continues through the best block in the main chain.\n" +
@@ -765,43 +1122,65 @@ var rpcResultTypes = map[string][]interface{}{
 	"decoderawtransaction":   {(*btcjson.TxRawDecodeResult)(nil)},
 	"decodescript":           {(*btcjson.DecodeScriptResult)(nil)},
 	"estimatefee":            {(*float64)(nil)},
+	"estimatefeebytime":      {(*btcjson.EstimateSmartFeeResult)(nil)},
+	"estimatesmartfee":       {(*btcjson.EstimateSmartFeeResult)(nil)},
+	"exportchainstate":       {(*btcjson.ExportChainStateResult)(nil)},
 	"generate":               {(*[]string)(nil)},
+	"generatetoaddress":      {(*[]string)(nil)},
 	"getaddednodeinfo":       {(*[]string)(nil), (*[]btcjson.GetAddedNodeInfoResult)(nil)},
 	"getbestblock":           {(*btcjson.GetBestBlockResult)(nil)},
 	"getbestblockhash":       {(*string)(nil)},
 	"getblock":               {(*string)(nil), (*btcjson.GetBlockVerboseResult)(nil)},
 	"getblockcount":          {(*int64)(nil)},
 	"getblockhash":           {(*string)(nil)},
+	"getblockfilter":         {(*btcjson.GetBlockFilterResult)(nil)},
 	"getblockheader":         {(*string)(nil), (*btcjson.GetBlockHeaderVerboseResult)(nil)},
+	"getblockheaders":        {(*[]string)(nil), (*[]btcjson.GetBlockHeaderVerboseResult)(nil)},
+	"getblockstats":          {(*btcjson.GetBlockStatsResult)(nil)},
 	"getblocktemplate":       {(*btcjson.GetBlockTemplateResult)(nil), (*string)(nil), nil},
 	"getblockchaininfo":      {(*btcjson.GetBlockChainInfoResult)(nil)},
 	"getchaintips":           {(*[]btcjson.GetChainTipsResult)(nil)},
+	"getcfheaders":           {(*btcjson.GetCFHeadersResult)(nil)},
 	"getcfilter":             {(*string)(nil)},
 	"getcfilterheader":       {(*string)(nil)},
+	"getcheckpoint":          {(*btcjson.GetCheckpointResult)(nil)},
 	"getconnectioncount":     {(*int32)(nil)},
+	"getconsensusinfo":       {(*btcjson.ConsensusInfo)(nil)},
 	"getcurrentnet":          {(*uint32)(nil)},
 	"getdifficulty":          {(*float64)(nil)},
+	"getdoublespends":        {(*[]btcjson.DoubleSpendResult)(nil)},
 	"getgenerate":            {(*bool)(nil)},
+	"getgossipinfo":          {(*btcjson.GetGossipInfoResult)(nil)},
 	"gethashespersec":        {(*float64)(nil)},
 	"getheaders":             {(*[]string)(nil)},
 	"getinfo":                {(*btcjson.InfoChainResult)(nil)},
+	"getmempoolancestors":    {(*[]string)(nil), (*map[string]btcjson.GetMempoolEntryResult)(nil)},
+	"getmempooldescendants":  {(*[]string)(nil), (*map[string]btcjson.GetMempoolEntryResult)(nil)},
+	"getmempoolentry":        {(*btcjson.GetMempoolEntryResult)(nil)},
 	"getmempoolinfo":         {(*btcjson.GetMempoolInfoResult)(nil)},
 	"getmininginfo":          {(*btcjson.GetMiningInfoResult)(nil)},
 	"getnettotals":           {(*btcjson.GetNetTotalsResult)(nil)},
 	"getnetworkhashps":       {(*float64)(nil)},
 	"getnodeaddresses":       {(*[]btcjson.GetNodeAddressesResult)(nil)},
+	"getnetworkinfo":         {(*btcjson.GetNetworkInfoResult)(nil)},
 	"getpeerinfo":            {(*[]btcjson.GetPeerInfoResult)(nil)},
 	"getrawmempool":          {(*[]string)(nil), (*btcjson.GetRawMempoolVerboseResult)(nil)},
 	"getrawtransaction":      {(*string)(nil), (*btcjson.TxRawResult)(nil)},
+	"getspentinfo":           {(*btcjson.GetSpentInfoResult)(nil)},
+	"gettxconfirmations":     {(*btcjson.GetTxConfirmationsResult)(nil)},
 	"gettxout":               {(*btcjson.GetTxOutResult)(nil)},
+	"gettxoutproof":          {(*string)(nil)},
 	"node":                   nil,
 	"help":                   {(*string)(nil), (*string)(nil)},
 	"invalidateblock":        nil,
 	"ping":                   nil,
 	"reconsiderblock":        nil,
+	"resyncchainstate":       {(*btcjson.ResyncChainStateResult)(nil)},
+	"runmaintenance":         {(*btcjson.RunMaintenanceResult)(nil)},
 	"searchrawtransactions":  {(*string)(nil), (*[]btcjson.SearchRawTransactionsResult)(nil)},
 	"sendrawtransaction":     {(*string)(nil)},
 	"setgenerate":            nil,
+	"setloglevel":            nil,
 	"signmessagewithprivkey": {(*string)(nil)},
 	"stop":                   {(*string)(nil)},
 	"submitblock":            {nil, (*string)(nil)},
@@ -809,7 +1188,10 @@ var rpcResultTypes = map[string][]interface{}{
 	"validateaddress":        {(*btcjson.ValidateAddressChainResult)(nil)},
 	"verifychain":            {(*bool)(nil)},
 	"verifymessage":          {(*bool)(nil)},
+	"verifytxoutproof":       {(*[]string)(nil)},
 	"version":                {(*map[string]btcjson.VersionResult)(nil)},
+	"waitforblockheight":     {(*btcjson.WaitForBlockResult)(nil)},
+	"waitfornewblock":        {(*btcjson.WaitForBlockResult)(nil)},
 	"testmempoolaccept":      {(*[]btcjson.TestMempoolAcceptResult)(nil)},
 	"gettxspendingprevout":   {(*[]btcjson.GetTxSpendingPrevOutResult)(nil)},
 
@@ -84,7 +84,7 @@ var wsHandlersBeforeInit = map[string]wsCommandHandler{
 // server handler which runs each new connection in a new goroutine thereby
 // satisfying the requirement.
 func (s *rpcServer) WebsocketHandler(conn *websocket.Conn, remoteAddr string,
-	authenticated bool, isAdmin bool) {
+	authenticated bool, isAdmin bool, methods RPCMethodFilter) {
 
 	// Clear the read deadline that was set before the websocket hijacked
 	// the connection.
@@ -103,7 +103,7 @@ func (s *rpcServer) WebsocketHandler(conn *websocket.Conn, remoteAddr string,
 	// Create a new websocket client to handle the new websocket connection
 	// and wait for it to shutdown.  Once it has shutdown (and hence
 	// disconnected), remove it and any notifications it registered for.
-	client, err := newWebsocketClient(s, conn, remoteAddr, authenticated, isAdmin)
+	client, err := newWebsocketClient(s, conn, remoteAddr, authenticated, isAdmin, methods)
 	if err != nil {
 		rpcsLog.Errorf("Failed to serve client %s: %v", remoteAddr, err)
 		conn.Close()
@@ -139,6 +139,14 @@ type wsNotificationManager struct {
 	// Access channel for current number of connected clients.
 	numClients chan int
 
+	// acceptedTip is the last block accepted by consensus, nil until the VM
+	// sets it.  acceptedTipChanged is closed and replaced each time the tip
+	// changes so that every request waiting for a new block is woken at
+	// once.  Both are protected by acceptedTipMtx.
+	acceptedTipMtx     sync.Mutex
+	acceptedTip        *btcjson.WaitForBlockResult
+	acceptedTipChanged chan struct{}
+
 	// Shutdown handling
 	wg   sync.WaitGroup
 	quit chan struct{}
@@ -246,6 +254,19 @@ func (m *wsNotificationManager) NotifyMempoolTx(tx *btcutil.Tx, isNew bool) {
 	}
 }
 
+// NotifyDoubleSpend passes a transaction conflicting with the mempool to the
+// notification manager for double spend notification processing.
+func (m *wsNotificationManager) NotifyDoubleSpend(doubleSpend *btcjson.DoubleSpendResult) {
+	// As NotifyDoubleSpend will be called by mempool and the RPC server
+	// may no longer be running, use a select statement to unblock
+	// enqueuing the notification once the RPC server has begun
+	// shutting down.
+	select {
+	case m.queueNotification <- (*notificationDoubleSpendSeen)(doubleSpend):
+	case <-m.quit:
+	}
+}
+
 // wsClientFilter tracks relevant addresses for each websocket client for
 // the `rescanblocks` extension. It is modified by the `loadtxfilter` command.
 //
@@ -444,6 +465,13 @@ func (f *wsClientFilter) removeUnspentOutPoint(op *wire.OutPoint) {
 	delete(f.unspent, *op)
 }
 
+// size returns the number of addresses and outpoints in the filter.
+func (f *wsClientFilter) size() int {
+	return len(f.pubKeyHashes) + len(f.scriptHashes) +
+		len(f.compressedPubKeys) + len(f.uncompressedPubKeys) +
+		len(f.otherAddresses) + len(f.unspent)
+}
+
 // Notification types
 type notificationBlockConnected btcutil.Block
 type notificationBlockDisconnected btcutil.Block
@@ -451,6 +479,7 @@ type notificationTxAcceptedByMempool struct {
 	isNew bool
 	tx    *btcutil.Tx
 }
+type notificationDoubleSpendSeen btcjson.DoubleSpendResult
 
 // Notification control requests
 type notificationRegisterClient wsClient
@@ -539,6 +568,10 @@ out:
 				m.notifyForTx(watchedOutPoints, watchedAddrs, n.tx, nil)
 				m.notifyRelevantTxAccepted(n.tx, clients)
 
+			case *notificationDoubleSpendSeen:
+				m.notifyDoubleSpendSeen(txNotifications,
+					watchedOutPoints, (*btcjson.DoubleSpendResult)(n))
+
 			case *notificationRegisterBlocks:
 				wsc := (*wsClient)(n)
 				blockNotifications[wsc.quit] = wsc
@@ -625,6 +658,45 @@ func (m *wsNotificationManager) UnregisterBlockUpdates(wsc *wsClient) {
 	m.queueNotification <- (*notificationUnregisterBlocks)(wsc)
 }
 
+// notifyDoubleSpendSeen notifies websocket clients that have registered for
+// new mempool transactions or for any of the conflicting outpoints of a double
+// spend.
+func (m *wsNotificationManager) notifyDoubleSpendSeen(txClients map[chan struct{}]*wsClient,
+	ops map[wire.OutPoint]map[chan struct{}]*wsClient,
+	doubleSpend *btcjson.DoubleSpendResult) {
+
+	// Use a map of client quit channels as keys to prevent duplicates when
+	// a client is registered for several of the outpoints.
+	clients := make(map[chan struct{}]*wsClient)
+	for quitChan, wsc := range txClients {
+		clients[quitChan] = wsc
+	}
+	for _, outPoint := range doubleSpend.OutPoints {
+		hash, err := chainhash.NewHashFromStr(outPoint.Hash)
+		if err != nil {
+			continue
+		}
+		op := wire.OutPoint{Hash: *hash, Index: outPoint.Index}
+		for quitChan, wsc := range ops[op] {
+			clients[quitChan] = wsc
+		}
+	}
+	if len(clients) == 0 {
+		return
+	}
+
+	ntfn := btcjson.NewDoubleSpendSeenNtfn(*doubleSpend)
+	marshalledJSON, err := btcjson.MarshalCmd(btcjson.RpcVersion1, nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal double spend notification: "+
+			"%v", err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
 // subscribedClients returns the set of all websocket client quit channels that
 // are registered to receive notifications regarding tx, either due to tx
 // spending a watched output or outputting to a watched address.  Matching
@@ -716,9 +788,15 @@ func (*wsNotificationManager) notifyBlockDisconnected(clients map[chan struct{}]
 		return
 	}
 
-	// Notify interested websocket clients about the disconnected block.
+	// Notify interested websocket clients about the disconnected block and
+	// the transactions it reverted.
 	ntfn := btcjson.NewBlockDisconnectedNtfn(block.Hash().String(),
 		block.Height(), block.MsgBlock().Header.Timestamp.Unix())
+	txids := make([]string, 0, len(block.Transactions()))
+	for _, tx := range block.Transactions() {
+		txids = append(txids, tx.Hash().String())
+	}
+	ntfn.Txids = &txids
 	marshalledJSON, err := btcjson.MarshalCmd(btcjson.RpcVersion1, nil, ntfn)
 	if err != nil {
 		rpcsLog.Errorf("Failed to marshal block disconnected "+
@@ -1100,6 +1178,9 @@ func (m *wsNotificationManager) notifyForTxIns(ops map[wire.OutPoint]map[chan st
 			for wscQuit, wsc := range cmap {
 				if block != nil {
 					m.removeSpentRequest(ops, wsc, prevOut)
+					wsc.Lock()
+					delete(wsc.watchedOutPoints, *prevOut)
+					wsc.Unlock()
 				}
 
 				if _, ok := wscNotified[wscQuit]; !ok {
@@ -1214,14 +1295,38 @@ func (m *wsNotificationManager) Shutdown() {
 // See wsNotificationManager for more details.
 func newWsNotificationManager(server *rpcServer) *wsNotificationManager {
 	return &wsNotificationManager{
-		server:            server,
-		queueNotification: make(chan interface{}),
-		notificationMsgs:  make(chan interface{}),
-		numClients:        make(chan int),
-		quit:              make(chan struct{}),
+		server:             server,
+		queueNotification:  make(chan interface{}),
+		notificationMsgs:   make(chan interface{}),
+		numClients:         make(chan int),
+		acceptedTipChanged: make(chan struct{}),
+		quit:               make(chan struct{}),
 	}
 }
 
+// NotifyBlockAccepted sets the last block accepted by consensus and wakes the
+// requests waiting for a new block.
+func (m *wsNotificationManager) NotifyBlockAccepted(hash *chainhash.Hash, height int32) {
+	m.acceptedTipMtx.Lock()
+	defer m.acceptedTipMtx.Unlock()
+
+	m.acceptedTip = &btcjson.WaitForBlockResult{
+		Hash:   hash.String(),
+		Height: int64(height),
+	}
+	close(m.acceptedTipChanged)
+	m.acceptedTipChanged = make(chan struct{})
+}
+
+// AcceptedTip returns the last block accepted by consensus, or nil if it is
+// not known yet, and a channel that is closed once it changes.
+func (m *wsNotificationManager) AcceptedTip() (*btcjson.WaitForBlockResult, <-chan struct{}) {
+	m.acceptedTipMtx.Lock()
+	defer m.acceptedTipMtx.Unlock()
+
+	return m.acceptedTip, m.acceptedTipChanged
+}
+
 // wsResponse houses a message to send to a connected websocket client as
 // well as a channel to reply on when the message is sent.
 type wsResponse struct {
@@ -1268,6 +1373,10 @@ type wsClient struct {
 	// false means its access is only to the limited set of RPC calls.
 	isAdmin bool
 
+	// methods restricts the methods the client may call when it is
+	// authenticated by the Auth callback of the server.
+	methods RPCMethodFilter
+
 	// sessionID is a random ID generated for each client when connected.
 	// These IDs may be queried by a client using the session RPC.  A change
 	// to the session ID indicates that the client reconnected.
@@ -1287,6 +1396,14 @@ type wsClient struct {
 	// Owned by the notification manager.
 	spentRequests map[wire.OutPoint]struct{}
 
+	// watchedAddrs and watchedOutPoints are the addresses and outpoints the
+	// client requested notifications for with notifyreceived and
+	// notifyspent.  Unlike addrRequests and spentRequests, they are
+	// protected by the client lock and only used to enforce the max number
+	// of subscriptions.
+	watchedAddrs     map[string]struct{}
+	watchedOutPoints map[wire.OutPoint]struct{}
+
 	// filterData is the new generation transaction filter backported from
 	// github.com/decred/dcrd for the new backported `loadtxfilter` and
 	// `rescanblocks` methods.
@@ -1453,6 +1570,19 @@ out:
 				}
 			}
 
+			// Error when the client is not authorized to call the
+			// supplied RPC by the Auth callback.
+			if c.methods != nil && !c.methods(req.Method) {
+				reply, err = createMarshalledReply(req.Jsonrpc, req.ID, nil, errRPCUnauthorized)
+				if err != nil {
+					rpcsLog.Errorf("Failed to marshal parse failure "+
+						"reply: %v", err)
+					continue
+				}
+				c.SendMessage(reply, nil)
+				continue
+			}
+
 			// Asynchronously handle the request.  A semaphore is used to
 			// limit the number of concurrent requests currently being
 			// serviced.  If the semaphore can not be acquired, simply wait
@@ -1697,6 +1827,22 @@ out:
 							}
 						}
 
+						// Error when the client is not authorized to call the
+						// supplied RPC by the Auth callback.
+						if c.methods != nil && !c.methods(req.Method) {
+							reply, err = createMarshalledReply(req.Jsonrpc, req.ID, nil, errRPCUnauthorized)
+							if err != nil {
+								rpcsLog.Errorf("Failed to marshal parse failure "+
+									"reply: %v", err)
+								continue
+							}
+
+							if reply != nil {
+								results = append(results, reply)
+							}
+							continue
+						}
+
 						// Lookup the websocket extension for the command, if it doesn't
 						// exist fallback to handling the command as a standard command.
 						var resp interface{}
@@ -1991,7 +2137,8 @@ func (c *wsClient) WaitForShutdown() {
 // incoming and outgoing messages in separate goroutines complete with queuing
 // and asynchrous handling for long-running operations.
 func newWebsocketClient(server *rpcServer, conn *websocket.Conn,
-	remoteAddr string, authenticated bool, isAdmin bool) (*wsClient, error) {
+	remoteAddr string, authenticated bool, isAdmin bool,
+	methods RPCMethodFilter) (*wsClient, error) {
 
 	sessionID, err := wire.RandomUint64()
 	if err != nil {
@@ -2003,10 +2150,13 @@ func newWebsocketClient(server *rpcServer, conn *websocket.Conn,
 		addr:              remoteAddr,
 		authenticated:     authenticated,
 		isAdmin:           isAdmin,
+		methods:           methods,
 		sessionID:         sessionID,
 		server:            server,
 		addrRequests:      make(map[string]struct{}),
 		spentRequests:     make(map[wire.OutPoint]struct{}),
+		watchedAddrs:      make(map[string]struct{}),
+		watchedOutPoints:  make(map[wire.OutPoint]struct{}),
 		serviceRequestSem: makeSemaphore(cfg.RPCMaxConcurrentReqs),
 		ntfnChan:          make(chan []byte, 1), // nonblocking sync
 		sendChan:          make(chan wsResponse, websocketSendBufferSize),
@@ -2015,6 +2165,77 @@ func newWebsocketClient(server *rpcServer, conn *websocket.Conn,
 	return client, nil
 }
 
+// numSubscriptions returns the number of addresses and outpoints the client
+// requested notifications for.  The transaction filter is left out when
+// withFilter is false.  The client lock must be held.
+func (c *wsClient) numSubscriptions(withFilter bool) int {
+	n := len(c.watchedAddrs) + len(c.watchedOutPoints)
+	if withFilter && c.filterData != nil {
+		c.filterData.mu.Lock()
+		n += c.filterData.size()
+		c.filterData.mu.Unlock()
+	}
+	return n
+}
+
+// checkSubscriptions returns an error if n subscriptions exceed the max number
+// of subscriptions of a client.
+func (c *wsClient) checkSubscriptions(n int) error {
+	if n <= cfg.RPCMaxWsSubs {
+		return nil
+	}
+	if c.server.cfg.LimitExceeded != nil {
+		c.server.cfg.LimitExceeded("ws_subscriptions")
+	}
+	return &btcjson.RPCError{
+		Code: btcjson.ErrRPCLimitExceeded,
+		Message: fmt.Sprintf("Too many subscriptions, max %d",
+			cfg.RPCMaxWsSubs),
+	}
+}
+
+// watchAddrs records addrs as watched by the client unless it would exceed
+// the max number of subscriptions.
+func (c *wsClient) watchAddrs(addrs []string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	var added int
+	for _, addr := range addrs {
+		if _, ok := c.watchedAddrs[addr]; !ok {
+			added++
+		}
+	}
+	if err := c.checkSubscriptions(c.numSubscriptions(true) + added); err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		c.watchedAddrs[addr] = struct{}{}
+	}
+	return nil
+}
+
+// watchOutPoints records ops as watched by the client unless it would exceed
+// the max number of subscriptions.
+func (c *wsClient) watchOutPoints(ops []*wire.OutPoint) error {
+	c.Lock()
+	defer c.Unlock()
+
+	var added int
+	for _, op := range ops {
+		if _, ok := c.watchedOutPoints[*op]; !ok {
+			added++
+		}
+	}
+	if err := c.checkSubscriptions(c.numSubscriptions(true) + added); err != nil {
+		return err
+	}
+	for _, op := range ops {
+		c.watchedOutPoints[*op] = struct{}{}
+	}
+	return nil
+}
+
 // handleWebsocketHelp implements the help command for websocket connections.
 func handleWebsocketHelp(wsc *wsClient, icmd interface{}) (interface{}, error) {
 	cmd, ok := icmd.(*btcjson.HelpCmd)
@@ -2087,6 +2308,11 @@ func handleLoadTxFilter(wsc *wsClient, icmd interface{}) (interface{}, error) {
 	params := wsc.server.cfg.ChainParams
 
 	wsc.Lock()
+	n := wsc.numSubscriptions(!cmd.Reload) + len(cmd.Addresses) + len(outPoints)
+	if err := wsc.checkSubscriptions(n); err != nil {
+		wsc.Unlock()
+		return nil, err
+	}
 	if cmd.Reload || wsc.filterData == nil {
 		wsc.filterData = newWSClientFilter(cmd.Addresses, outPoints,
 			params)
@@ -2140,6 +2366,10 @@ func handleNotifySpent(wsc *wsClient, icmd interface{}) (interface{}, error) {
 		return nil, err
 	}
 
+	if err := wsc.watchOutPoints(outpoints); err != nil {
+		return nil, err
+	}
+
 	wsc.server.ntfnMgr.RegisterSpentRequests(wsc, outpoints)
 	return nil, nil
 }
@@ -2179,6 +2409,10 @@ func handleNotifyReceived(wsc *wsClient, icmd interface{}) (interface{}, error)
 		return nil, err
 	}
 
+	if err := wsc.watchAddrs(cmd.Addresses); err != nil {
+		return nil, err
+	}
+
 	wsc.server.ntfnMgr.RegisterTxOutAddressRequests(wsc, cmd.Addresses)
 	return nil, nil
 }
@@ -2196,6 +2430,12 @@ func handleStopNotifySpent(wsc *wsClient, icmd interface{}) (interface{}, error)
 		return nil, err
 	}
 
+	wsc.Lock()
+	for _, outpoint := range outpoints {
+		delete(wsc.watchedOutPoints, *outpoint)
+	}
+	wsc.Unlock()
+
 	for _, outpoint := range outpoints {
 		wsc.server.ntfnMgr.UnregisterSpentRequest(wsc, outpoint)
 	}
@@ -2218,6 +2458,12 @@ func handleStopNotifyReceived(wsc *wsClient, icmd interface{}) (interface{}, err
 		return nil, err
 	}
 
+	wsc.Lock()
+	for _, addr := range cmd.Addresses {
+		delete(wsc.watchedAddrs, addr)
+	}
+	wsc.Unlock()
+
 	for _, addr := range cmd.Addresses {
 		wsc.server.ntfnMgr.UnregisterTxOutAddressRequest(wsc, addr)
 	}
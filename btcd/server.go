@@ -201,6 +201,7 @@ type Server struct {
 	connManager          *connmgr.ConnManager
 	sigCache             *txscript.SigCache
 	hashCache            *txscript.HashCache
+	scriptCache          *blockchain.ScriptCache
 	rpcServer            *rpcServer
 	syncManager          *netsync.SyncManager
 	chain                *blockchain.BlockChain
@@ -216,6 +217,7 @@ type Server struct {
 	peerHeightsUpdate    chan updatePeerHeightsMsg
 	wg                   sync.WaitGroup
 	quit                 chan struct{}
+	interrupt            chan struct{}
 	nat                  NAT
 	db                   database.DB
 	timeSource           blockchain.MedianTimeSource
@@ -225,9 +227,10 @@ type Server struct {
 	// if the associated index is not enabled.  These fields are set during
 	// initial creation of the server and never changed afterwards, so they
 	// do not need to be protected for concurrent access.
-	txIndex   *indexers.TxIndex
-	addrIndex *indexers.AddrIndex
-	cfIndex   *indexers.CfIndex
+	txIndex    *indexers.TxIndex
+	addrIndex  *indexers.AddrIndex
+	spentIndex *indexers.SpentIndex
+	cfIndex    *indexers.CfIndex
 
 	// The fee estimator keeps track of how long transactions are left in
 	// the mempool before they are mined into blocks.
@@ -250,10 +253,27 @@ type Server struct {
 	// This is used by the VM to gossip transactions via the Metal network.
 	OnTxRelay func([]*mempool.TxDesc)
 
+	// OnLocalTxRelay is called instead of OnTxRelay with the transactions
+	// submitted to the node by a client and the orphans they accepted, so
+	// that the VM can push them to the Metal network right away.
+	OnLocalTxRelay func([]*mempool.TxDesc)
+
 	// OnBlockRelay is a callback that is called when blocks are to be relayed.
 	// This is used by the VM to gossip blocks via the Metal network.
 	OnBlockRelay func(*btcutil.Block)
 
+	// OnSubmitBlock is called instead of processing the blocks submitted
+	// with submitblock, so that the VM hands them to consensus rather than
+	// connecting them. It returns the status of the submission.
+	OnSubmitBlock func(*btcutil.Block) string
+
+	// OnBlockConnected and OnBlockDisconnected are callbacks that are called
+	// when blocks are connected to or disconnected from the main chain, in
+	// the order btcd reorganizes the chain. They are called with the chain
+	// lock held and must not call back into the chain.
+	OnBlockConnected    func(*btcutil.Block)
+	OnBlockDisconnected func(*btcutil.Block)
+
 	// CustomProcessBlock is an optional callback for custom block processing.
 	// If set, this will be called instead of the default blockchain processing.
 	// This is useful for integrating with consensus mechanisms like Metal.
@@ -1511,6 +1531,27 @@ func (s *Server) relayTransactions(txns []*mempool.TxDesc) {
 	}
 }
 
+// relayLocalTransactions relays the passed transactions, submitted to the node
+// by a client, through OnLocalTxRelay if it is set.
+func (s *Server) relayLocalTransactions(txns []*mempool.TxDesc) {
+	if s.OnLocalTxRelay != nil {
+		s.OnLocalTxRelay(txns)
+		return
+	}
+
+	s.relayTransactions(txns)
+}
+
+// AnnounceLocalTransactions is AnnounceNewTransactions for transactions
+// submitted to the node by a client, which are relayed right away.
+func (s *Server) AnnounceLocalTransactions(txns []*mempool.TxDesc) {
+	s.relayLocalTransactions(txns)
+
+	if s.rpcServer != nil {
+		s.rpcServer.NotifyNewTransactions(txns)
+	}
+}
+
 // AnnounceNewTransactions generates and relays inventory vectors and notifies
 // both websocket and getblocktemplate long poll clients of the passed
 // transactions.  This function should be called whenever new transactions
@@ -2526,9 +2567,20 @@ func (s *Server) Stop() error {
 		return nil
 	})
 
-	// Signal the remaining goroutines to quit.
+	// Signal the remaining goroutines to quit, and interrupt the long
+	// running operations of the chain and its indexes.
 	close(s.quit)
-	return nil
+	if s.interrupt != nil {
+		close(s.interrupt)
+	}
+
+	// Flush the utxo cache and close the database, which releases its lock
+	// so that it can be opened by another process.
+	if err := s.chain.FlushUtxoCache(blockchain.FlushRequired); err != nil {
+		srvrLog.Errorf("Error while flushing blockchain caches: %v", err)
+	}
+	srvrLog.Infof("Gracefully shutting down the database...")
+	return s.db.Close()
 }
 
 // WaitForShutdown blocks until the main listener and peer handlers are stopped.
@@ -2761,6 +2813,7 @@ func newServer(
 		services:             services,
 		sigCache:             txscript.NewSigCache(cfg.SigCacheMaxSize),
 		hashCache:            txscript.NewHashCache(cfg.SigCacheMaxSize),
+		scriptCache:          blockchain.NewScriptCache(cfg.SigCacheMaxSize),
 		cfCheckptCaches:      make(map[wire.FilterType][]cfHeaderKV),
 	}
 
@@ -2790,6 +2843,11 @@ func newServer(
 		s.addrIndex = indexers.NewAddrIndex(db, chainParams)
 		indexes = append(indexes, s.addrIndex)
 	}
+	if cfg.SpentIndex {
+		indxLog.Info("Spent output index is enabled")
+		s.spentIndex = indexers.NewSpentIndex(db)
+		indexes = append(indexes, s.spentIndex)
+	}
 	if !cfg.NoCFilters {
 		indxLog.Info("Committed filter index is enabled")
 		s.cfIndex = indexers.NewCfIndex(db, chainParams)
@@ -2824,8 +2882,11 @@ func newServer(
 		SigCache:         s.sigCache,
 		IndexManager:     indexManager,
 		HashCache:        s.hashCache,
+		ScriptCache:      s.scriptCache,
 		Prune:            cfg.Prune * 1024 * 1024,
 		UtxoCacheMaxSize: uint64(cfg.UtxoCacheMaxSizeMiB) * 1024 * 1024,
+
+		MaxScriptValidationWorkers: cfg.MaxScriptWorkers,
 	})
 	if err != nil {
 		return nil, err
@@ -2866,11 +2927,18 @@ func newServer(
 			AcceptNonStd:         cfg.RelayNonStd,
 			FreeTxRelayLimit:     cfg.FreeTxRelayLimit,
 			MaxOrphanTxs:         cfg.MaxOrphanTxs,
-			MaxOrphanTxSize:      defaultMaxOrphanTxSize,
+			MaxOrphanTxSize:      cfg.MaxOrphanTxSize,
+			MaxAncestorCount:     cfg.MaxAncestorCount,
+			MaxAncestorSize:      cfg.MaxAncestorSize,
+			RejectDataCarrier:    cfg.NoDataCarrier,
+			MaxDataCarrierSize:   int(cfg.MaxDataCarrierSize),
+			MaxPoolSize:          cfg.MaxMempoolBytes,
 			MaxSigOpCostPerTx:    blockchain.MaxBlockSigOpsCost / 4,
 			MinRelayTxFee:        cfg.minRelayTxFee,
 			MaxTxVersion:         2,
 			RejectReplacement:    cfg.RejectReplacement,
+			FullRBF:              cfg.MempoolFullRBF,
+			IncrementalRelayFee:  cfg.incrementalRelayFee,
 		},
 		ChainParams:    chainParams,
 		FetchUtxoView:  s.chain.FetchUtxoView,
@@ -2882,6 +2950,7 @@ func newServer(
 		IsDeploymentActive: s.chain.IsDeploymentActive,
 		SigCache:           s.sigCache,
 		HashCache:          s.hashCache,
+		ScriptCache:        s.scriptCache,
 		AddrIndex:          s.addrIndex,
 		FeeEstimator:       s.feeEstimator,
 	}
@@ -2906,12 +2975,15 @@ func newServer(
 	// NOTE: The CPU miner relies on the mempool, so the mempool has to be
 	// created before calling the function to create the CPU miner.
 	policy := mining.Policy{
-		BlockMinWeight:    cfg.BlockMinWeight,
-		BlockMaxWeight:    cfg.BlockMaxWeight,
-		BlockMinSize:      cfg.BlockMinSize,
-		BlockMaxSize:      cfg.BlockMaxSize,
-		BlockPrioritySize: cfg.BlockPrioritySize,
-		TxMinFreeFee:      cfg.minRelayTxFee,
+		BlockMinWeight:     cfg.BlockMinWeight,
+		BlockMaxWeight:     cfg.BlockMaxWeight,
+		BlockMinSize:       cfg.BlockMinSize,
+		BlockMaxSize:       cfg.BlockMaxSize,
+		BlockPrioritySize:  cfg.BlockPrioritySize,
+		TxMinFreeFee:       cfg.minRelayTxFee,
+		RejectDataCarrier:  cfg.NoDataCarrier,
+		MaxDataCarrierSize: int(cfg.MaxDataCarrierSize),
+		CoinbaseTag:        cfg.coinbaseTag,
 	}
 	blockTemplateGenerator := mining.NewBlkTmplGenerator(
 		&policy,
@@ -2921,6 +2993,7 @@ func newServer(
 		s.timeSource,
 		s.sigCache,
 		s.hashCache,
+		s.scriptCache,
 	)
 	s.cpuMiner = cpuminer.New(&cpuminer.Config{
 		ChainParams:            chainParams,
@@ -2945,6 +3018,7 @@ func newServer(
 			CPUMiner:     s.cpuMiner,
 			TxIndex:      s.txIndex,
 			AddrIndex:    s.addrIndex,
+			SpentIndex:   s.spentIndex,
 			CfIndex:      s.cfIndex,
 			FeeEstimator: s.feeEstimator,
 			Services:     s.services,
@@ -2953,10 +3027,15 @@ func newServer(
 			return nil, err
 		}
 
-		// Signal process shutdown when the RPC server requests it.
+		// The node running the VM manages the lifecycle of the server, so
+		// shutdown requests of the RPC server are only logged.
 		go func() {
-			<-s.rpcServer.RequestedProcessShutdown()
-			shutdownRequestChannel <- struct{}{}
+			select {
+			case <-s.rpcServer.RequestedProcessShutdown():
+				srvrLog.Warnf("Ignoring shutdown request, the VM is " +
+					"stopped by the node running it")
+			case <-s.quit:
+			}
 		}()
 	}
 
@@ -3320,12 +3399,32 @@ func (s *Server) handleBlockchainNotification(notification *blockchain.Notificat
 		// (handled by existing netsync manager)
 
 	case blockchain.NTBlockConnected:
-		// Optional: Could add additional logic here
-		srvrLog.Debugf("Block connected to main chain")
+		block, ok := notification.Data.(*btcutil.Block)
+		if !ok {
+			srvrLog.Warnf("Block connected notification has invalid data type")
+			return
+		}
+
+		srvrLog.Debugf("Block connected to main chain: %s (height %d)",
+			block.Hash(), block.Height())
+
+		if s.OnBlockConnected != nil {
+			s.OnBlockConnected(block)
+		}
 
 	case blockchain.NTBlockDisconnected:
-		// Optional: Could add additional logic here
-		srvrLog.Debugf("Block disconnected from main chain")
+		block, ok := notification.Data.(*btcutil.Block)
+		if !ok {
+			srvrLog.Warnf("Block disconnected notification has invalid data type")
+			return
+		}
+
+		srvrLog.Debugf("Block disconnected from main chain: %s (height %d)",
+			block.Hash(), block.Height())
+
+		if s.OnBlockDisconnected != nil {
+			s.OnBlockDisconnected(block)
+		}
 	}
 }
 
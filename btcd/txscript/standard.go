@@ -506,23 +506,41 @@ func isNullDataScript(scriptVersion uint16, script []byte) bool {
 	//
 	// Thus, it can either be a single OP_RETURN or an OP_RETURN followed by a
 	// data push up to MaxDataCarrierSize bytes.
+	data, ok := extractNullData(scriptVersion, script)
+	return ok && len(data) <= MaxDataCarrierSize
+}
 
+// extractNullData returns the data pushed by a script of the form
+// OP_RETURN <optional data>, whatever its size, and whether the script is of
+// that form.
+func extractNullData(scriptVersion uint16, script []byte) ([]byte, bool) {
 	// The script can't possibly be a null data script if it doesn't start
 	// with OP_RETURN.  Fail fast to avoid more work below.
 	if len(script) < 1 || script[0] != OP_RETURN {
-		return false
+		return nil, false
 	}
 
 	// Single OP_RETURN.
 	if len(script) == 1 {
-		return true
+		return nil, true
 	}
 
-	// OP_RETURN followed by data push up to MaxDataCarrierSize bytes.
+	// OP_RETURN followed by a single data push.
 	tokenizer := MakeScriptTokenizer(scriptVersion, script[1:])
-	return tokenizer.Next() && tokenizer.Done() &&
-		(IsSmallInt(tokenizer.Opcode()) || tokenizer.Opcode() <= OP_PUSHDATA4) &&
-		len(tokenizer.Data()) <= MaxDataCarrierSize
+	if !tokenizer.Next() || !tokenizer.Done() ||
+		!(IsSmallInt(tokenizer.Opcode()) || tokenizer.Opcode() <= OP_PUSHDATA4) {
+
+		return nil, false
+	}
+	return tokenizer.Data(), true
+}
+
+// ExtractNullData returns the data carried by a version 0 script of the form
+// OP_RETURN <optional data> and whether the script is of that form.  Unlike
+// the NullDataTy class, the data may exceed MaxDataCarrierSize bytes so that
+// policies allowing larger data carriers can be enforced.
+func ExtractNullData(script []byte) ([]byte, bool) {
+	return extractNullData(0, script)
 }
 
 // scriptType returns the type of the script being inspected from the known
@@ -1313,3 +1313,64 @@ func TestNewScriptClass(t *testing.T) {
 		})
 	}
 }
+
+// TestExtractNullData ensures the data of null data scripts is extracted
+// regardless of its size, and that other scripts are not mistaken for them.
+func TestExtractNullData(t *testing.T) {
+	t.Parallel()
+
+	large := bytes.Repeat([]byte{0x01}, MaxDataCarrierSize+1)
+	largeScript, err := NewScriptBuilder().AddOp(OP_RETURN).AddData(large).Script()
+	if err != nil {
+		t.Fatalf("unable to build script: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		script []byte
+		data   []byte
+		ok     bool
+	}{
+		{
+			name:   "bare OP_RETURN",
+			script: mustParseShortForm("RETURN"),
+			ok:     true,
+		},
+		{
+			name:   "small int",
+			script: mustParseShortForm("RETURN 1"),
+			ok:     true,
+		},
+		{
+			name:   "push at the standard limit",
+			script: mustParseShortForm("RETURN PUSHDATA1 0x50 0x" + hex.EncodeToString(large[:MaxDataCarrierSize])),
+			data:   large[:MaxDataCarrierSize],
+			ok:     true,
+		},
+		{
+			name:   "push over the standard limit",
+			script: largeScript,
+			data:   large,
+			ok:     true,
+		},
+		{
+			name:   "two pushes",
+			script: mustParseShortForm("RETURN DATA_1 0x01 DATA_1 0x02"),
+		},
+		{
+			name:   "non-push opcode",
+			script: mustParseShortForm("RETURN CHECKSIG"),
+		},
+		{
+			name:   "not OP_RETURN",
+			script: mustParseShortForm("DATA_1 0x01"),
+		},
+	}
+	for _, test := range tests {
+		data, ok := ExtractNullData(test.script)
+		if ok != test.ok || !bytes.Equal(data, test.data) {
+			t.Errorf("%s: got (%x, %v), want (%x, %v)", test.name,
+				data, ok, test.data, test.ok)
+		}
+	}
+}
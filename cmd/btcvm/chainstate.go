@@ -0,0 +1,115 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/spf13/cobra"
+
+	"github.com/MetalBlockchain/btcvm/vm"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// chainStateConfig defines the configuration options of the export and
+// import commands
+type chainStateConfig struct {
+	GenesisFile string
+	ConfigFile  string
+	NodeID      string
+	LogLevel    string
+}
+
+// newExportCmd returns the command exporting the accepted chain of a stopped
+// node
+func newExportCmd() *cobra.Command {
+	ccfg := &chainStateConfig{}
+	cmd := &cobra.Command{
+		Use:   "export <dir>",
+		Short: "Export the accepted chain of a stopped node",
+		Long: "Write the blocks of the accepted chain, from genesis to the last accepted block, " +
+			"to a new directory in the bitcoind blk file format, along with a manifest of the " +
+			"tip and a checksum. The node must be stopped; the exportchainstate RPC exports " +
+			"the chain of a running node.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runChainState(ccfg, func(btcvm *vm.VM) error {
+				manifest, err := btcvm.ExportChainState(args[0])
+				if err != nil {
+					return fmt.Errorf("failed to export chain state: %w", err)
+				}
+				log.Info("Exported chain state", "dir", args[0],
+					"tipHeight", manifest.TipHeight, "tipHash", manifest.TipHash)
+				return nil
+			})
+		},
+	}
+	addChainStateFlags(cmd, ccfg)
+	return cmd
+}
+
+// newImportCmd returns the command importing an export into a stopped node
+func newImportCmd() *cobra.Command {
+	ccfg := &chainStateConfig{}
+	cmd := &cobra.Command{
+		Use:   "import <dir>",
+		Short: "Import an exported chain into a stopped node",
+		Long: "Validate the export in a directory and replay its blocks, skipping transaction " +
+			"validation up to the checkpoint of its manifest. The node must be stopped, and " +
+			"bootstraps the remaining blocks from its peers when started.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runChainState(ccfg, func(btcvm *vm.VM) error {
+				if err := btcvm.ImportChainState(args[0]); err != nil {
+					return fmt.Errorf("failed to import chain state: %w", err)
+				}
+				log.Info("Imported chain state", "dir", args[0])
+				return nil
+			})
+		},
+	}
+	addChainStateFlags(cmd, ccfg)
+	return cmd
+}
+
+// addChainStateFlags adds the flags of ccfg to cmd
+func addChainStateFlags(cmd *cobra.Command, ccfg *chainStateConfig) {
+	flags := cmd.Flags()
+	flags.StringVar(&ccfg.GenesisFile, "genesis-file", "", "Path to the genesis JSON file of the chain")
+	flags.StringVar(&ccfg.ConfigFile, "config-file", "", "Path to the VM config JSON file of the node")
+	flags.StringVar(&ccfg.NodeID, "node-id", ids.EmptyNodeID.String(), "ID of the node whose data directory is used")
+	flags.StringVar(&ccfg.LogLevel, "log-level", "info", "VM log level (verbo, debug, trace, info, warn, error, fatal)")
+	_ = cmd.MarkFlagRequired("genesis-file")
+}
+
+// runChainState calls fn with the VM of the node described by ccfg
+func runChainState(ccfg *chainStateConfig, fn func(*vm.VM) error) (err error) {
+	level, err := logging.ToLevel(ccfg.LogLevel)
+	if err != nil {
+		return fmt.Errorf("invalid log level: %w", err)
+	}
+	logger := logging.NewLogger("btcvm", logging.NewWrappedCore(level, os.Stdout, logging.Plain.ConsoleEncoder()))
+	nodeID, err := ids.NodeIDFromString(ccfg.NodeID)
+	if err != nil {
+		return fmt.Errorf("invalid node ID: %w", err)
+	}
+
+	ctx := context.Background()
+	btcvm, err := initializeLocalVM(ctx, logger, nodeID, ccfg.GenesisFile, ccfg.ConfigFile, nil)
+	if err != nil {
+		return err
+	}
+	defer shutdownLocalVM(ctx, btcvm, &err)
+
+	// Blocks are connected once the RPC server, if enabled, has started
+	// handling their notifications
+	_, _ = btcvm.CreateHandlers(ctx)
+
+	return fn(btcvm)
+}
@@ -15,8 +15,9 @@ import (
 // config defines the configuration options for btcvm
 type config struct {
 	// Logging
-	LogLevel string
-	LogDir   string
+	LogLevel  string
+	LogFormat string
+	LogDir    string
 
 	// Profiling
 	CPUProfile  string
@@ -42,6 +43,7 @@ func defaultConfig() *config {
 
 	return &config{
 		LogLevel:    "info",
+		LogFormat:   logFormatLogfmt,
 		LogDir:      defaultLogDir,
 		DataDir:     defaultDataDir,
 		CPUProfile:  "",
@@ -57,6 +59,7 @@ func loadConfig() (*config, error) {
 
 	// Define flags
 	flag.StringVar(&cfg.LogLevel, "loglevel", cfg.LogLevel, "Log level (trace, debug, info, warn, error, crit)")
+	flag.StringVar(&cfg.LogFormat, "logformat", cfg.LogFormat, "Format of the log file (logfmt, json)")
 	flag.StringVar(&cfg.LogDir, "logdir", cfg.LogDir, "Directory for log files")
 	flag.StringVar(&cfg.DataDir, "datadir", cfg.DataDir, "Directory for data files")
 	flag.StringVar(&cfg.CPUProfile, "cpuprofile", cfg.CPUProfile, "Write CPU profile to file")
@@ -96,6 +99,11 @@ func (c *config) validate() error {
 		return fmt.Errorf("invalid log level: %s (valid: %v)", c.LogLevel, validLevels)
 	}
 
+	// Validate log format
+	if c.LogFormat != logFormatLogfmt && c.LogFormat != logFormatJSON {
+		return fmt.Errorf("invalid log format: %s (valid: %v)", c.LogFormat, []string{logFormatLogfmt, logFormatJSON})
+	}
+
 	// Ensure directories exist
 	dirs := []string{c.DataDir}
 	if c.LogDir != "" {
@@ -120,6 +128,7 @@ func version() string {
 func (c *config) show() {
 	log.Info("Configuration",
 		"logLevel", c.LogLevel,
+		"logFormat", c.LogFormat,
 		"logDir", c.LogDir,
 		"dataDir", c.DataDir,
 		"cpuProfile", c.CPUProfile,
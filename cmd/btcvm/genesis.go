@@ -0,0 +1,146 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/spf13/cobra"
+
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/vm"
+)
+
+var errChainIDRequired = errors.New("chain ID required, the chain params set distinctNetworkMagic")
+
+// genesisConfig defines the configuration options of the genesis command
+type genesisConfig struct {
+	ChainID string
+}
+
+// genesisOutput is the output of the genesis verify command, the values a
+// node derives from the genesis
+type genesisOutput struct {
+	GenesisHash          string   `json:"genesisHash"`
+	Network              string   `json:"network"`
+	NetworkMagic         uint32   `json:"networkMagic"`
+	GenesisBlockHash     string   `json:"genesisBlockHash"`
+	Bech32HRP            string   `json:"bech32HRP"`
+	PubKeyHashAddrID     byte     `json:"pubKeyHashAddrID"`
+	ScriptHashAddrID     byte     `json:"scriptHashAddrID"`
+	PrivateKeyID         byte     `json:"privateKeyID"`
+	TargetBlockTime      int64    `json:"targetBlockTime"`
+	CoinbaseMaturity     uint16   `json:"coinbaseMaturity"`
+	PoWDisabled          bool     `json:"powDisabled"`
+	MonotonicTimestamps  bool     `json:"monotonicTimestamps"`
+	IncreasingTimestamps bool     `json:"increasingTimestamps"`
+	MaxFutureBlockTime   int64    `json:"maxFutureBlockTime"`
+	AcceptDataCarrier    bool     `json:"acceptDataCarrier"`
+	MaxDataCarrierSize   uint32   `json:"maxDataCarrierSize"`
+	MiningAddrs          []string `json:"miningAddrs"`
+}
+
+// newGenesisCmd returns the command checking genesis files before a chain is
+// launched
+func newGenesisCmd() *cobra.Command {
+	gcfg := &genesisConfig{}
+	cmd := &cobra.Command{
+		Use:   "genesis",
+		Short: "Check a genesis file before launching a chain",
+		Long: "Derive the chain config of a genesis file the way the VM does when it is " +
+			"initialized, so that misconfigurations are caught before the chain is launched.",
+	}
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&gcfg.ChainID, "chain-id", "", "ID of the chain, required if its chain params set distinctNetworkMagic")
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "verify <genesis-file>",
+			Short: "Print the values a node derives from the genesis as JSON",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return runGenesis(gcfg, args[0], cmd.OutOrStdout(), verifyGenesis)
+			},
+		},
+		&cobra.Command{
+			Use:   "hash <genesis-file>",
+			Short: "Print the genesis hash, the expectedGenesisHash of the nodes of the chain",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return runGenesis(gcfg, args[0], cmd.OutOrStdout(), printGenesisHash)
+			},
+		},
+	)
+	return cmd
+}
+
+// runGenesis loads the genesis file of the chain described by gcfg and writes
+// its output by fn to w
+func runGenesis(gcfg *genesisConfig, file string, w io.Writer, fn func(*vm.Genesis, io.Writer) error) error {
+	chainID := ids.Empty
+	if gcfg.ChainID != "" {
+		var err error
+		chainID, err = ids.FromString(gcfg.ChainID)
+		if err != nil {
+			return fmt.Errorf("invalid chain ID: %w", err)
+		}
+	}
+
+	genesisBytes, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read genesis: %w", err)
+	}
+	genesis, err := vm.LoadGenesis(genesisBytes, chainID, ids.EmptyNodeID)
+	if err != nil {
+		return err
+	}
+	if genesis.ChainParams.DistinctNetworkMagic && chainID == ids.Empty {
+		return errChainIDRequired
+	}
+	return fn(genesis, w)
+}
+
+// verifyGenesis checks the mining addresses of genesis and writes the values
+// derived from it as JSON to w
+func verifyGenesis(genesis *vm.Genesis, w io.Writer) error {
+	if _, err := genesis.DecodeMiningAddrs(); err != nil {
+		return err
+	}
+
+	params := genesis.Config.ChainParams
+	output := &genesisOutput{
+		GenesisHash:          hex.EncodeToString(genesis.Hash[:]),
+		Network:              params.Name,
+		NetworkMagic:         uint32(params.Net),
+		GenesisBlockHash:     params.GenesisHash.String(),
+		Bech32HRP:            params.Bech32HRPSegwit,
+		PubKeyHashAddrID:     params.PubKeyHashAddrID,
+		ScriptHashAddrID:     params.ScriptHashAddrID,
+		PrivateKeyID:         params.PrivateKeyID,
+		TargetBlockTime:      int64(vm.TargetBlockTime.Seconds()),
+		CoinbaseMaturity:     params.CoinbaseMaturity,
+		PoWDisabled:          params.PoWDisabled,
+		MonotonicTimestamps:  params.MonotonicTimestamps,
+		IncreasingTimestamps: genesis.ChainParams.IncreasingTimestamps,
+		MaxFutureBlockTime:   int64(blockchain.MaxTimeOffset(params).Seconds()),
+		AcceptDataCarrier:    !genesis.Config.NoDataCarrier,
+		MaxDataCarrierSize:   genesis.Config.MaxDataCarrierSize,
+		MiningAddrs:          genesis.MiningAddrs,
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(output)
+}
+
+// printGenesisHash writes the hash of genesis to w
+func printGenesisHash(genesis *vm.Genesis, w io.Writer) error {
+	_, err := fmt.Fprintln(w, hex.EncodeToString(genesis.Hash[:]))
+	return err
+}
@@ -0,0 +1,101 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/stretchr/testify/require"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg"
+	"github.com/MetalBlockchain/btcvm/vm"
+)
+
+// runGenesisCmd runs the genesis command with args and returns its output
+func runGenesisCmd(args ...string) (string, error) {
+	cmd := newGenesisCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestGenesisVerify(t *testing.T) {
+	require := require.New(t)
+
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	chainID := ids.GenerateTestID()
+
+	// The mining address of a chain overriding the segwit HRP must use it
+	params := btcd.BtcvmTestNetParms
+	params.Bech32HRPSegwit = "gentest"
+	hash := bytes.Repeat([]byte{1}, 20)
+	addr, err := btcutil.NewAddressWitnessPubKeyHash(hash, &params)
+	require.NoError(err)
+	writeGenesis := func(name string, miningAddr btcutil.Address) string {
+		genesis := `{"config":{"testNet":true,"miningAddrs":["` + miningAddr.EncodeAddress() + `"]},` +
+			`"chainParams":{"coinbaseMaturity":100,"monotonicTimestamps":true,"distinctNetworkMagic":true,` +
+			`"addresses":{"bech32HRP":"gentest"}}}`
+		file := filepath.Join(dir, name)
+		require.NoError(os.WriteFile(file, []byte(genesis), 0o600))
+		return file
+	}
+	good := writeGenesis("good.json", addr)
+
+	out, err := runGenesisCmd("verify", "--chain-id", chainID.String(), good)
+	require.NoError(err)
+	var output genesisOutput
+	require.NoError(json.Unmarshal([]byte(out), &output))
+	genesisBytes, err := os.ReadFile(good)
+	require.NoError(err)
+	genesisHash := sha256.Sum256(genesisBytes)
+	require.Equal(genesisOutput{
+		GenesisHash:         hex.EncodeToString(genesisHash[:]),
+		Network:             params.Name,
+		NetworkMagic:        uint32(vm.NetworkMagic(chainID)),
+		GenesisBlockHash:    params.GenesisHash.String(),
+		Bech32HRP:           "gentest",
+		PubKeyHashAddrID:    params.PubKeyHashAddrID,
+		ScriptHashAddrID:    params.ScriptHashAddrID,
+		PrivateKeyID:        params.PrivateKeyID,
+		TargetBlockTime:     int64(vm.TargetBlockTime.Seconds()),
+		CoinbaseMaturity:    100,
+		MonotonicTimestamps: true,
+		MaxFutureBlockTime:  vm.DefaultMaxFutureBlockTime,
+		AcceptDataCarrier:   true,
+		MaxDataCarrierSize:  80,
+		MiningAddrs:         []string{addr.EncodeAddress()},
+	}, output)
+
+	// The hash is the expectedGenesisHash of the nodes of the chain
+	out, err = runGenesisCmd("hash", "--chain-id", chainID.String(), good)
+	require.NoError(err)
+	require.Equal(output.GenesisHash, strings.TrimSpace(out))
+
+	// The network magic is derived from the chain ID
+	_, err = runGenesisCmd("verify", good)
+	require.ErrorIs(err, errChainIDRequired)
+
+	// A mining address left with the HRP of the network fails verification
+	// rather than the first validators building blocks
+	staleAddr, err := btcutil.NewAddressWitnessPubKeyHash(hash, &chaincfg.SimNetParams)
+	require.NoError(err)
+	broken := writeGenesis("broken.json", staleAddr)
+	_, err = runGenesisCmd("verify", "--chain-id", chainID.String(), broken)
+	require.ErrorContains(err, "invalid mining addresses")
+	require.ErrorContains(err, staleAddr.EncodeAddress())
+}
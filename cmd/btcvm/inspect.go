@@ -0,0 +1,272 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/spf13/cobra"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/database"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/MetalBlockchain/btcvm/vm"
+)
+
+// inspectConfig defines the configuration options of the inspect command
+type inspectConfig struct {
+	DataDir string
+	DbType  string
+	ChainID string
+}
+
+// tipOutput is the output of the inspect tip command
+type tipOutput struct {
+	Hash      string `json:"hash"`
+	Height    int32  `json:"height"`
+	TotalTxns uint64 `json:"totalTxns"`
+
+	// UtxoHash is the block up to which the utxo set is consistent, when it
+	// isn't the tip
+	UtxoHash string `json:"utxoHash,omitempty"`
+}
+
+// utxoOutput is the output of the inspect utxo command
+type utxoOutput struct {
+	Txid         string   `json:"txid"`
+	Vout         uint32   `json:"vout"`
+	Value        float64  `json:"value"`
+	Height       int32    `json:"height"`
+	Coinbase     bool     `json:"coinbase"`
+	ScriptPubKey string   `json:"scriptPubKey"`
+	Type         string   `json:"type"`
+	Addresses    []string `json:"addresses,omitempty"`
+}
+
+// statsOutput is the output of the inspect stats command
+type statsOutput struct {
+	DbSize int64  `json:"dbSize"`
+	Blocks uint64 `json:"blocks"`
+	Utxos  uint64 `json:"utxos"`
+}
+
+// newInspectCmd returns the command inspecting the chain database of a
+// stopped node
+func newInspectCmd() *cobra.Command {
+	icfg := &inspectConfig{}
+	cmd := &cobra.Command{
+		Use:   "inspect",
+		Short: "Inspect the chain database of a stopped node",
+		Long: "Print the chain state of a chain database as JSON, without starting the VM. " +
+			"The database is opened read-only and the node must be stopped, since the " +
+			"database can't be opened while another process holds its lock.",
+	}
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&icfg.DataDir, "datadir", "", "Data directory of the chain database, the dbPath logged by the VM at startup")
+	flags.StringVar(&icfg.DbType, "dbtype", "ffldb", "Backend of the chain database")
+	flags.StringVar(&icfg.ChainID, "chain-id", "", "ID of the chain, required if its chain params set distinctNetworkMagic")
+	_ = cmd.MarkPersistentFlagRequired("datadir")
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "tip",
+			Short: "Print the hash and height of the tip of the chain",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, _ []string) error {
+				return runInspect(icfg, cmd.OutOrStdout(), inspectTip)
+			},
+		},
+		&cobra.Command{
+			Use:   "block <hash|height>",
+			Short: "Print a block of the chain, decoded as by the getblock RPC",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return runInspect(icfg, cmd.OutOrStdout(), func(db database.DB, params *chaincfg.Params) (any, error) {
+					return inspectBlock(db, params, args[0])
+				})
+			},
+		},
+		&cobra.Command{
+			Use:   "utxo <txid:vout>",
+			Short: "Print an unspent transaction output",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return runInspect(icfg, cmd.OutOrStdout(), func(db database.DB, params *chaincfg.Params) (any, error) {
+					return inspectUtxo(db, params, args[0])
+				})
+			},
+		},
+		&cobra.Command{
+			Use:   "stats",
+			Short: "Print the size of the database and its numbers of blocks and utxos",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, _ []string) error {
+				return runInspect(icfg, cmd.OutOrStdout(), func(db database.DB, _ *chaincfg.Params) (any, error) {
+					return inspectStats(db, btcd.BlockDBPath(icfg.DataDir, icfg.DbType))
+				})
+			},
+		},
+	)
+	return cmd
+}
+
+// runInspect opens the chain database described by icfg read-only and writes
+// the output of fn as JSON to w
+func runInspect(icfg *inspectConfig, w io.Writer, fn func(database.DB, *chaincfg.Params) (any, error)) (err error) {
+	params := btcd.BtcvmTestNetParms
+	if icfg.ChainID != "" {
+		chainID, err := ids.FromString(icfg.ChainID)
+		if err != nil {
+			return fmt.Errorf("invalid chain ID: %w", err)
+		}
+		params.Net = vm.NetworkMagic(chainID)
+	}
+
+	db, err := btcd.OpenBlockDB(icfg.DataDir, icfg.DbType, params.Net, true)
+	var dbErr database.Error
+	if errors.As(err, &dbErr) && dbErr.ErrorCode == database.ErrDbAlreadyOpen {
+		return fmt.Errorf("chain database is in use by another process, stop the node first: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open chain database: %w", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close chain database: %w", closeErr)
+		}
+	}()
+
+	output, err := fn(db, &params)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(output)
+}
+
+// inspectTip returns the tip of the chain in db
+func inspectTip(db database.DB, _ *chaincfg.Params) (any, error) {
+	state, err := blockchain.DBFetchChainState(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chain state: %w", err)
+	}
+	tip := &tipOutput{
+		Hash:      state.Hash.String(),
+		Height:    state.Height,
+		TotalTxns: state.TotalTxns,
+	}
+	if state.UtxoHash != nil {
+		tip.UtxoHash = state.UtxoHash.String()
+	}
+	return tip, nil
+}
+
+// inspectBlock returns the decoded block of the chain in db with the hash or at
+// the height arg
+func inspectBlock(db database.DB, params *chaincfg.Params, arg string) (any, error) {
+	state, err := blockchain.DBFetchChainState(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chain state: %w", err)
+	}
+
+	var blk *btcutil.Block
+	if height, parseErr := strconv.ParseInt(arg, 10, 32); parseErr == nil {
+		blk, err = blockchain.DBFetchBlockByHeight(db, int32(height))
+	} else {
+		hash, hashErr := chainhash.NewHashFromStr(arg)
+		if hashErr != nil {
+			return nil, fmt.Errorf("invalid block hash or height %q: %w", arg, hashErr)
+		}
+		blk, err = blockchain.DBFetchBlockByHash(db, hash)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block %s: %w", arg, err)
+	}
+	return btcd.DecodeBlock(blk, state.Height, params), nil
+}
+
+// inspectUtxo returns the unspent output of the chain in db referenced by
+// the outpoint arg
+func inspectUtxo(db database.DB, params *chaincfg.Params, arg string) (any, error) {
+	txid, vout, found := strings.Cut(arg, ":")
+	if !found {
+		return nil, fmt.Errorf("invalid outpoint %q, expected <txid>:<vout>", arg)
+	}
+	hash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid txid %q: %w", txid, err)
+	}
+	index, err := strconv.ParseUint(vout, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vout %q: %w", vout, err)
+	}
+
+	outpoint := wire.OutPoint{Hash: *hash, Index: uint32(index)}
+	entry, err := blockchain.DBFetchUtxoEntry(db, outpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read utxo %s: %w", outpoint, err)
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("output %s is not in the utxo set", outpoint)
+	}
+
+	// The error is ignored since scripts that don't parse have no addresses
+	scriptClass, addrs, _, _ := txscript.ExtractPkScriptAddrs(entry.PkScript(), params)
+	utxo := &utxoOutput{
+		Txid:         hash.String(),
+		Vout:         outpoint.Index,
+		Value:        btcutil.Amount(entry.Amount()).ToBTC(),
+		Height:       entry.BlockHeight(),
+		Coinbase:     entry.IsCoinBase(),
+		ScriptPubKey: hex.EncodeToString(entry.PkScript()),
+		Type:         scriptClass.String(),
+	}
+	for _, addr := range addrs {
+		utxo.Addresses = append(utxo.Addresses, addr.EncodeAddress())
+	}
+	return utxo, nil
+}
+
+// inspectStats returns the size of the chain database at dbPath and the
+// numbers of blocks and utxos in db
+func inspectStats(db database.DB, dbPath string) (any, error) {
+	counts, err := blockchain.DBFetchStats(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count database entries: %w", err)
+	}
+	stats := &statsOutput{
+		Blocks: counts.Blocks,
+		Utxos:  counts.Utxos,
+	}
+	err = filepath.WalkDir(dbPath, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stats.DbSize += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure database size: %w", err)
+	}
+	return stats, nil
+}
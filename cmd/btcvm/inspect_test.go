@@ -0,0 +1,122 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/stretchr/testify/require"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+)
+
+// runInspectCmd runs the inspect command with args and decodes its output
+// into output
+func runInspectCmd(args []string, output any) error {
+	cmd := newInspectCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(args)
+	if err := cmd.Execute(); err != nil {
+		return err
+	}
+	return json.Unmarshal(out.Bytes(), output)
+}
+
+func TestInspect(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	// The VM stores its chain database in an ffldb directory
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	addr, err := btcutil.NewAddressPubKeyHash(btcutil.Hash160(key.PubKey().SerializeCompressed()), &btcd.BtcvmTestNetParms)
+	require.NoError(err)
+	genesisFile := filepath.Join(dir, "genesis.json")
+	require.NoError(os.WriteFile(genesisFile, []byte(`{"config":{"testNet":true,"dbType":"ffldb","miningAddrs":["`+addr.EncodeAddress()+`"]}}`), 0o600))
+	configFile := filepath.Join(dir, "config.json")
+	require.NoError(os.WriteFile(configFile, []byte(`{"dataDir":"`+dir+`"}`), 0o600))
+
+	btcvm, err := initializeLocalVM(ctx, logging.NoLog{}, ids.EmptyNodeID, genesisFile, configFile, nil)
+	require.NoError(err)
+	var blocks []*wire.MsgBlock
+	for range 2 {
+		blk, err := btcvm.BuildBlock(ctx)
+		require.NoError(err)
+		require.NoError(blk.Verify(ctx))
+		require.NoError(btcvm.SetPreference(ctx, blk.ID()))
+		require.NoError(blk.Accept(ctx))
+		btcBlock, err := btcutil.NewBlockFromBytes(blk.Bytes())
+		require.NoError(err)
+		blocks = append(blocks, btcBlock.MsgBlock())
+	}
+	dataDir := btcd.NetDataDir(dir)
+	flags := []string{"--datadir", dataDir}
+
+	// The database can't be inspected while the VM holds its lock
+	var tip tipOutput
+	err = runInspectCmd(append([]string{"tip"}, flags...), &tip)
+	require.ErrorContains(err, "in use by another process")
+	require.NoError(btcvm.Shutdown(ctx))
+
+	require.NoError(runInspectCmd(append([]string{"tip"}, flags...), &tip))
+	tipBlock := blocks[1]
+	require.Equal(tipOutput{
+		Hash:      tipBlock.BlockHash().String(),
+		Height:    2,
+		TotalTxns: 3,
+	}, tip)
+
+	// Blocks are found by height and by hash
+	for _, arg := range []string{"1", blocks[0].BlockHash().String()} {
+		var block btcjson.GetBlockVerboseTxResult
+		require.NoError(runInspectCmd(append([]string{"block", arg}, flags...), &block))
+		require.Equal(blocks[0].BlockHash().String(), block.Hash)
+		require.Equal(int64(1), block.Height)
+		require.Equal(int64(2), block.Confirmations)
+		require.Len(block.RawTx, 1)
+		require.Equal(blocks[0].Transactions[0].TxHash().String(), block.RawTx[0].Txid)
+	}
+	var block btcjson.GetBlockVerboseTxResult
+	require.ErrorContains(runInspectCmd(append([]string{"block", "3"}, flags...), &block), "no block at height 3")
+
+	// The coinbase of the tip is unspent
+	coinbase := tipBlock.Transactions[0]
+	outpoint := coinbase.TxHash().String() + ":0"
+	var utxo utxoOutput
+	require.NoError(runInspectCmd(append([]string{"utxo", outpoint}, flags...), &utxo))
+	require.Equal(utxoOutput{
+		Txid:         coinbase.TxHash().String(),
+		Vout:         0,
+		Value:        btcutil.Amount(coinbase.TxOut[0].Value).ToBTC(),
+		Height:       2,
+		Coinbase:     true,
+		ScriptPubKey: utxo.ScriptPubKey,
+		Type:         "pubkeyhash",
+		Addresses:    []string{addr.EncodeAddress()},
+	}, utxo)
+	require.ErrorContains(runInspectCmd(append([]string{"utxo", coinbase.TxHash().String() + ":" + strconv.Itoa(len(coinbase.TxOut))}, flags...), &utxo),
+		"not in the utxo set")
+
+	var stats statsOutput
+	require.NoError(runInspectCmd(append([]string{"stats"}, flags...), &stats))
+	require.Equal(uint64(3), stats.Blocks)
+	require.Positive(stats.DbSize)
+	require.GreaterOrEqual(stats.Utxos, uint64(3))
+}
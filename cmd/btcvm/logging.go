@@ -8,12 +8,62 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"go.uber.org/zap"
+
 	log "github.com/inconshreveable/log15"
 )
 
+// logSubsystem keys the logs of the plugin process in the node log
+const logSubsystem = "btcvm"
+
+// Formats of the log file
+const (
+	logFormatLogfmt = "logfmt"
+	logFormatJSON   = "json"
+)
+
+// nodeLogHandler writes the records of the plugin process to the log of the
+// node running the VM, keyed by the btcvm subsystem, once the VM is
+// initialized. The records logged before are written by fallback.
+type nodeLogHandler struct {
+	nodeLog  func() logging.Logger
+	fallback log.Handler
+}
+
+func (h *nodeLogHandler) Log(r *log.Record) error {
+	nodeLog := h.nodeLog()
+	if nodeLog == nil {
+		return h.fallback.Log(r)
+	}
+
+	fields := make([]zap.Field, 0, 1+len(r.Ctx)/2)
+	fields = append(fields, zap.String("subsystem", logSubsystem))
+	for i := 0; i+1 < len(r.Ctx); i += 2 {
+		fields = append(fields, zap.Any(fmt.Sprint(r.Ctx[i]), r.Ctx[i+1]))
+	}
+	switch r.Lvl {
+	case log.LvlCrit:
+		nodeLog.Fatal(r.Msg, fields...)
+	case log.LvlError:
+		nodeLog.Error(r.Msg, fields...)
+	case log.LvlWarn:
+		nodeLog.Warn(r.Msg, fields...)
+	case log.LvlInfo:
+		nodeLog.Info(r.Msg, fields...)
+	default:
+		nodeLog.Debug(r.Msg, fields...)
+	}
+	return nil
+}
+
 // initLogging initializes the logging system with proper handlers.
-// It sets up file logging if logDir is provided, otherwise uses stderr only.
-func initLogging(logLevel string, logDir string) error {
+// Once the VM is initialized, nodeLog returns the log of the node, to which
+// the records are written from then on. Until then, it sets up file logging
+// if logDir is provided, otherwise uses stderr only. The log file is written
+// in logFormat, so that it can be shipped to log aggregators as structured
+// JSON.
+func initLogging(logLevel string, logFormat string, logDir string, nodeLog func() logging.Logger) error {
 	// Parse log level
 	level, err := log.LvlFromString(logLevel)
 	if err != nil {
@@ -34,7 +84,11 @@ func initLogging(logLevel string, logDir string) error {
 		logFile := filepath.Join(logDir, "btcvm.log")
 
 		// Try to open log file
-		fileHandler, err := log.FileHandler(logFile, log.LogfmtFormat())
+		format := log.LogfmtFormat()
+		if logFormat == logFormatJSON {
+			format = log.JsonFormat()
+		}
+		fileHandler, err := log.FileHandler(logFile, format)
 		if err != nil {
 			log.Warn("Failed to create file logger, falling back to stderr", "error", err)
 			handler = log.LvlFilterHandler(level, log.StderrHandler)
@@ -44,7 +98,7 @@ func initLogging(logLevel string, logDir string) error {
 				log.LvlFilterHandler(level, log.StderrHandler),
 				log.LvlFilterHandler(level, fileHandler),
 			)
-			log.Info("Logging to file", "path", logFile)
+			log.Info("Logging to file", "path", logFile, "format", logFormat)
 		}
 	} else {
 		// Just use stderr
@@ -52,7 +106,10 @@ func initLogging(logLevel string, logDir string) error {
 	}
 
 	// Set the handler
-	log.Root().SetHandler(handler)
+	log.Root().SetHandler(log.LvlFilterHandler(level, &nodeLogHandler{
+		nodeLog:  nodeLog,
+		fallback: handler,
+	}))
 
 	log.Info("Logging initialized", "level", level.String())
 	return nil
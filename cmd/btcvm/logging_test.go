@@ -0,0 +1,60 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/stretchr/testify/require"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// nopCloser is a writer the node log can close
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func TestNodeLogHandler(t *testing.T) {
+	require := require.New(t)
+
+	var (
+		fallback []*log.Record
+		nodeLog  logging.Logger
+		logs     bytes.Buffer
+	)
+	handler := &nodeLogHandler{
+		nodeLog: func() logging.Logger { return nodeLog },
+		fallback: log.FuncHandler(func(r *log.Record) error {
+			fallback = append(fallback, r)
+			return nil
+		}),
+	}
+	logger := log.New()
+	logger.SetHandler(handler)
+
+	// Records logged before the VM is initialized are written by the
+	// fallback handler
+	logger.Info("starting", "version", "0.1.0")
+	require.Len(fallback, 1)
+	require.Equal("starting", fallback[0].Msg)
+
+	// Records are then written to the node log, keyed by subsystem
+	nodeLog = logging.NewLogger("", logging.NewWrappedCore(logging.Info, nopCloser{Writer: &logs}, logging.Plain.ConsoleEncoder()))
+	logger.Warn("interrupted", "signal", "SIGTERM")
+	logger.Debug("hidden")
+	require.Len(fallback, 1)
+	require.Contains(logs.String(), "WARN")
+	require.Contains(logs.String(), "interrupted")
+	require.Contains(logs.String(), `"subsystem": "btcvm"`)
+	require.Contains(logs.String(), `"signal": "SIGTERM"`)
+	require.NotContains(logs.String(), "hidden")
+}
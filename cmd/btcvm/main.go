@@ -31,8 +31,10 @@ func btcvmMain() error {
 	}
 	cfg = tcfg
 
-	// Initialize logging
-	if err := initLogging(cfg.LogLevel, cfg.LogDir); err != nil {
+	// Initialize logging. The logs go to the node log once the VM is
+	// initialized.
+	btcVM := &vm.VM{}
+	if err := initLogging(cfg.LogLevel, cfg.LogFormat, cfg.LogDir, btcVM.NodeLog); err != nil {
 		return fmt.Errorf("failed to initialize logging: %w", err)
 	}
 	defer log.Info("Shutdown complete")
@@ -72,7 +74,7 @@ func btcvmMain() error {
 	errChan := make(chan error, 1)
 	go func() {
 		log.Info("Starting btcvm RPC chain VM server")
-		errChan <- rpcchainvm.Serve(ctx, &vm.VM{})
+		errChan <- rpcchainvm.Serve(ctx, btcVM)
 	}()
 
 	// Wait for either interrupt or error
@@ -104,6 +106,11 @@ func main() {
 		Long:  "A Bitcoin Virtual Machine implementation running on Metal consensus",
 		RunE:  runFunc,
 	}
+	rootCmd.AddCommand(newStandaloneCmd())
+	rootCmd.AddCommand(newExportCmd())
+	rootCmd.AddCommand(newImportCmd())
+	rootCmd.AddCommand(newInspectCmd())
+	rootCmd.AddCommand(newGenesisCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
@@ -0,0 +1,293 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/MetalBlockchain/metalgo/database/memdb"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/snow/validators"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/MetalBlockchain/metalgo/utils/set"
+	"github.com/spf13/cobra"
+
+	"github.com/MetalBlockchain/btcvm/vm"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// standaloneShutdownTimeout is how long the HTTP server is given to finish
+// in-flight requests on shutdown
+const standaloneShutdownTimeout = 5 * time.Second
+
+// standaloneConfig defines the configuration options of standalone mode
+type standaloneConfig struct {
+	GenesisFile string
+	ConfigFile  string
+	HTTPHost    string
+	HTTPPort    uint16
+	LogLevel    string
+}
+
+// newStandaloneCmd returns the command running the VM without the Metal
+// consensus engine
+func newStandaloneCmd() *cobra.Command {
+	scfg := &standaloneConfig{}
+	cmd := &cobra.Command{
+		Use:   "standalone",
+		Short: "Run the Bitcoin VM as a single node without Metal",
+		Long: "Run the Bitcoin VM as a single node with an in-memory database. Every block " +
+			"the VM builds is accepted immediately and the RPC handlers are served on a " +
+			"local HTTP port. The genesis config must set rpcUser and rpcPass for the RPC " +
+			"handlers to be available.",
+		Args: cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			return runStandalone(scfg)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&scfg.GenesisFile, "genesis-file", "", "Path to the genesis JSON file")
+	flags.StringVar(&scfg.ConfigFile, "config-file", "", "Path to the VM config JSON file")
+	flags.StringVar(&scfg.HTTPHost, "http-host", "127.0.0.1", "Host to serve the RPC handlers on")
+	flags.Uint16Var(&scfg.HTTPPort, "http-port", 9650, "Port to serve the RPC handlers on")
+	flags.StringVar(&scfg.LogLevel, "log-level", "info", "VM log level (verbo, debug, trace, info, warn, error, fatal)")
+	_ = cmd.MarkFlagRequired("genesis-file")
+	return cmd
+}
+
+// runStandalone runs the VM until an interrupt signal is received
+func runStandalone(scfg *standaloneConfig) (err error) {
+	level, err := logging.ToLevel(scfg.LogLevel)
+	if err != nil {
+		return fmt.Errorf("invalid log level: %w", err)
+	}
+	logger := logging.NewLogger("btcvm", logging.NewWrappedCore(level, os.Stdout, logging.Plain.ConsoleEncoder()))
+
+	interrupt := interruptListener()
+
+	ctx := context.Background()
+	toEngine := make(chan common.Message, 1)
+	btcvm, err := initializeLocalVM(ctx, logger, ids.EmptyNodeID, scfg.GenesisFile, scfg.ConfigFile, toEngine)
+	if err != nil {
+		return err
+	}
+	defer shutdownLocalVM(ctx, btcvm, &err)
+
+	for _, state := range []snow.State{snow.Bootstrapping, snow.NormalOp} {
+		if err := btcvm.SetState(ctx, state); err != nil {
+			return fmt.Errorf("failed to set VM state to %s: %w", state, err)
+		}
+	}
+
+	handlers, err := btcvm.CreateHandlers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create handlers: %w", err)
+	}
+	mux := http.NewServeMux()
+	for path, handler := range handlers {
+		mux.Handle(path, handler)
+	}
+
+	addr := net.JoinHostPort(scfg.HTTPHost, strconv.Itoa(int(scfg.HTTPPort)))
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Info("Serving standalone RPC handlers", "addr", addr)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	consensusDone := make(chan struct{})
+	consensusStopped := make(chan struct{})
+	go func() {
+		defer close(consensusStopped)
+		runStandaloneConsensus(ctx, btcvm, toEngine, consensusDone)
+	}()
+
+	select {
+	case <-interrupt:
+		log.Info("Received interrupt signal, shutting down standalone node")
+	case err = <-serverErr:
+		log.Error("Standalone RPC server error", "error", err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, standaloneShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error("Failed to shut down RPC server", "error", err)
+	}
+	close(consensusDone)
+	<-consensusStopped
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// initializeLocalVM initializes a VM outside of a Metal node, with an
+// in-memory VM database and nodeID as the only validator of the chain
+func initializeLocalVM(
+	ctx context.Context,
+	logger logging.Logger,
+	nodeID ids.NodeID,
+	genesisFile string,
+	configFile string,
+	toEngine chan<- common.Message,
+) (*vm.VM, error) {
+	genesisBytes, err := os.ReadFile(genesisFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read genesis file: %w", err)
+	}
+	var configBytes []byte
+	if configFile != "" {
+		configBytes, err = os.ReadFile(configFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+	}
+
+	snowCtx := &snow.Context{
+		NodeID:         nodeID,
+		Log:            logger,
+		ValidatorState: &standaloneValidatorState{nodeID: nodeID},
+	}
+	btcvm := &vm.VM{}
+	err = btcvm.Initialize(
+		ctx,
+		snowCtx,
+		memdb.New(),
+		genesisBytes,
+		nil,
+		configBytes,
+		toEngine,
+		nil,
+		standaloneAppSender{},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize VM: %w", err)
+	}
+	return btcvm, nil
+}
+
+// shutdownLocalVM shuts down btcvm, setting *errp to the shutdown error if it
+// is nil so that a VM failing to stop within its shutdown timeout makes the
+// command fail instead of hanging
+func shutdownLocalVM(ctx context.Context, btcvm *vm.VM, errp *error) {
+	if err := btcvm.Shutdown(ctx); err != nil {
+		log.Error("Failed to shut down VM", "error", err)
+		if *errp == nil {
+			*errp = fmt.Errorf("failed to shut down VM: %w", err)
+		}
+	}
+}
+
+// runStandaloneConsensus accepts every block the VM builds when notified on
+// toEngine, until done is closed
+func runStandaloneConsensus(ctx context.Context, btcvm *vm.VM, toEngine <-chan common.Message, done <-chan struct{}) {
+	for {
+		select {
+		case msg := <-toEngine:
+			if msg != common.PendingTxs {
+				continue
+			}
+		case <-done:
+			return
+		}
+
+		blk, err := btcvm.BuildBlock(ctx)
+		if err != nil {
+			log.Warn("Failed to build block", "error", err)
+			continue
+		}
+		if err := blk.Verify(ctx); err != nil {
+			log.Warn("Built block failed verification", "id", blk.ID(), "error", err)
+			if err := blk.Reject(ctx); err != nil {
+				log.Error("Failed to reject block", "id", blk.ID(), "error", err)
+			}
+			continue
+		}
+		if err := btcvm.SetPreference(ctx, blk.ID()); err != nil {
+			log.Error("Failed to set preference", "id", blk.ID(), "error", err)
+			continue
+		}
+		if err := blk.Accept(ctx); err != nil {
+			log.Error("Failed to accept block", "id", blk.ID(), "error", err)
+			continue
+		}
+		log.Info("Accepted block", "id", blk.ID(), "height", blk.Height())
+	}
+}
+
+var _ validators.State = (*standaloneValidatorState)(nil)
+
+// standaloneValidatorState is a validator set containing only the local node
+type standaloneValidatorState struct {
+	nodeID ids.NodeID
+}
+
+func (*standaloneValidatorState) GetMinimumHeight(context.Context) (uint64, error) {
+	return 0, nil
+}
+
+func (*standaloneValidatorState) GetCurrentHeight(context.Context) (uint64, error) {
+	return 0, nil
+}
+
+func (*standaloneValidatorState) GetSubnetID(context.Context, ids.ID) (ids.ID, error) {
+	return ids.Empty, nil
+}
+
+func (s *standaloneValidatorState) GetValidatorSet(context.Context, uint64, ids.ID) (map[ids.NodeID]*validators.GetValidatorOutput, error) {
+	return map[ids.NodeID]*validators.GetValidatorOutput{
+		s.nodeID: {
+			NodeID: s.nodeID,
+			Weight: 1,
+		},
+	}, nil
+}
+
+func (s *standaloneValidatorState) GetCurrentValidatorSet(context.Context, ids.ID) (map[ids.ID]*validators.GetCurrentValidatorOutput, uint64, error) {
+	return map[ids.ID]*validators.GetCurrentValidatorOutput{
+		ids.Empty: {
+			NodeID: s.nodeID,
+			Weight: 1,
+		},
+	}, 0, nil
+}
+
+var _ common.AppSender = standaloneAppSender{}
+
+// standaloneAppSender drops all messages since a standalone node has no peers
+type standaloneAppSender struct{}
+
+func (standaloneAppSender) SendAppRequest(context.Context, set.Set[ids.NodeID], uint32, []byte) error {
+	return nil
+}
+
+func (standaloneAppSender) SendAppResponse(context.Context, ids.NodeID, uint32, []byte) error {
+	return nil
+}
+
+func (standaloneAppSender) SendAppError(context.Context, ids.NodeID, uint32, int32, string) error {
+	return nil
+}
+
+func (standaloneAppSender) SendAppGossip(context.Context, common.SendConfig, []byte) error {
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+var errVestingScriptMismatch = errors.New("vesting script does not match its template")
+
+// allocation is a premine output of the genesis coinbase. Allocations with a
+// locktime height or timestamp can only be spent from then on.
+type allocation struct {
+	Address           string `json:"address"`
+	Amount            int64  `json:"amount"`
+	LocktimeHeight    uint32 `json:"locktimeHeight,omitempty"`
+	LocktimeTimestamp uint32 `json:"locktimeTimestamp,omitempty"`
+}
+
+// allocationOutput is an allocation with the scripts of its output. The
+// redeem script of vested allocations is the witness script of their P2WSH
+// output.
+type allocationOutput struct {
+	allocation
+	PkScript      string `json:"pkScript"`
+	RedeemScript  string `json:"redeemScript,omitempty"`
+	VestedAddress string `json:"vestedAddress,omitempty"`
+
+	txOut *wire.TxOut
+}
+
+// loadAllocations reads the allocations of the JSON file at path
+func loadAllocations(path string) ([]allocation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read allocations: %w", err)
+	}
+	var allocations []allocation
+	if err := json.Unmarshal(data, &allocations); err != nil {
+		return nil, fmt.Errorf("failed to parse allocations: %w", err)
+	}
+	return allocations, nil
+}
+
+// locktime returns the locktime of the allocation, zero if it is not vested
+func (a *allocation) locktime() (uint32, error) {
+	switch {
+	case a.LocktimeHeight != 0 && a.LocktimeTimestamp != 0:
+		return 0, errors.New("locktimeHeight and locktimeTimestamp cannot both be set")
+	case a.LocktimeHeight >= txscript.LockTimeThreshold:
+		return 0, fmt.Errorf("locktimeHeight must be below %d", uint32(txscript.LockTimeThreshold))
+	case a.LocktimeTimestamp != 0 && a.LocktimeTimestamp < txscript.LockTimeThreshold:
+		return 0, fmt.Errorf("locktimeTimestamp must be at least %d", uint32(txscript.LockTimeThreshold))
+	case a.LocktimeHeight != 0:
+		return a.LocktimeHeight, nil
+	default:
+		return a.LocktimeTimestamp, nil
+	}
+}
+
+// newAllocationOutput creates the output of an allocation. Vested allocations
+// pay to a P2WSH output whose witness script checks the locktime before the
+// signature of the key of the address, which must be P2PKH or P2WPKH.
+func newAllocationOutput(a allocation, netParams *chaincfg.Params) (*allocationOutput, error) {
+	if a.Amount <= 0 || a.Amount > btcutil.MaxSatoshi {
+		return nil, fmt.Errorf("amount must be between 1 and %d satoshis", int64(btcutil.MaxSatoshi))
+	}
+	addr, err := btcutil.DecodeAddress(a.Address, netParams)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address for network %s: %w", netParams.Name, err)
+	}
+	locktime, err := a.locktime()
+	if err != nil {
+		return nil, err
+	}
+
+	output := &allocationOutput{allocation: a}
+	if locktime != 0 {
+		var keyHash []byte
+		switch addr := addr.(type) {
+		case *btcutil.AddressPubKeyHash:
+			keyHash = addr.Hash160()[:]
+		case *btcutil.AddressWitnessPubKeyHash:
+			keyHash = addr.WitnessProgram()
+		default:
+			return nil, fmt.Errorf("vested allocations must pay to a P2PKH or P2WPKH address, got %s", a.Address)
+		}
+
+		redeemScript, err := vestingScript(locktime, keyHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create vesting script: %w", err)
+		}
+		if err := checkVestingScript(redeemScript, locktime, keyHash); err != nil {
+			return nil, err
+		}
+		scriptHash := sha256.Sum256(redeemScript)
+		addr, err = btcutil.NewAddressWitnessScriptHash(scriptHash[:], netParams)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create vested address: %w", err)
+		}
+		output.RedeemScript = hex.EncodeToString(redeemScript)
+		output.VestedAddress = addr.EncodeAddress()
+	}
+
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output script: %w", err)
+	}
+	if locktime != 0 && !txscript.IsPayToWitnessScriptHash(pkScript) {
+		return nil, fmt.Errorf("vested output script %x is not P2WSH", pkScript)
+	}
+	output.PkScript = hex.EncodeToString(pkScript)
+	output.txOut = wire.NewTxOut(a.Amount, pkScript)
+	return output, nil
+}
+
+// vestingScript returns the script paying to keyHash from locktime on:
+//
+//	<locktime> OP_CHECKLOCKTIMEVERIFY OP_DROP
+//	OP_DUP OP_HASH160 <keyHash> OP_EQUALVERIFY OP_CHECKSIG
+func vestingScript(locktime uint32, keyHash []byte) ([]byte, error) {
+	return txscript.NewScriptBuilder().
+		AddInt64(int64(locktime)).
+		AddOp(txscript.OP_CHECKLOCKTIMEVERIFY).
+		AddOp(txscript.OP_DROP).
+		AddOp(txscript.OP_DUP).
+		AddOp(txscript.OP_HASH160).
+		AddData(keyHash).
+		AddOp(txscript.OP_EQUALVERIFY).
+		AddOp(txscript.OP_CHECKSIG).
+		Script()
+}
+
+// checkVestingScript parses script and checks that it is the vesting script
+// of locktime and keyHash
+func checkVestingScript(script []byte, locktime uint32, keyHash []byte) error {
+	lockPush, err := txscript.NewScriptBuilder().AddInt64(int64(locktime)).Script()
+	if err != nil {
+		return err
+	}
+	expected := []struct {
+		opcode byte
+		data   []byte
+	}{
+		{opcode: lockPush[0], data: lockPush[1:]},
+		{opcode: txscript.OP_CHECKLOCKTIMEVERIFY},
+		{opcode: txscript.OP_DROP},
+		{opcode: txscript.OP_DUP},
+		{opcode: txscript.OP_HASH160},
+		{opcode: txscript.OP_DATA_20, data: keyHash},
+		{opcode: txscript.OP_EQUALVERIFY},
+		{opcode: txscript.OP_CHECKSIG},
+	}
+
+	tokenizer := txscript.MakeScriptTokenizer(0, script)
+	numOpcodes := 0
+	for ; tokenizer.Next(); numOpcodes++ {
+		if numOpcodes >= len(expected) {
+			return fmt.Errorf("%w: more than %d opcodes", errVestingScriptMismatch, len(expected))
+		}
+		op := expected[numOpcodes]
+		if tokenizer.Opcode() != op.opcode || !bytes.Equal(tokenizer.Data(), op.data) {
+			return fmt.Errorf("%w: unexpected opcode %d", errVestingScriptMismatch, numOpcodes)
+		}
+	}
+	if err := tokenizer.Err(); err != nil {
+		return fmt.Errorf("failed to parse vesting script: %w", err)
+	}
+	if numOpcodes != len(expected) {
+		return fmt.Errorf("%w: %d opcodes instead of %d", errVestingScriptMismatch, numOpcodes, len(expected))
+	}
+	return nil
+}
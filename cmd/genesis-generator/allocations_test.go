@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAllocationOutput(t *testing.T) {
+	require := require.New(t)
+	netParams := &chaincfg.RegressionNetParams
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	keyHash := btcutil.Hash160(key.PubKey().SerializeCompressed())
+	p2pkh, err := btcutil.NewAddressPubKeyHash(keyHash, netParams)
+	require.NoError(err)
+	p2wpkh, err := btcutil.NewAddressWitnessPubKeyHash(keyHash, netParams)
+	require.NoError(err)
+	p2wsh, err := btcutil.NewAddressWitnessScriptHash(make([]byte, 32), netParams)
+	require.NoError(err)
+
+	// Allocations without a locktime pay to their address
+	output, err := newAllocationOutput(allocation{Address: p2pkh.String(), Amount: 1000}, netParams)
+	require.NoError(err)
+	pkScript, err := txscript.PayToAddrScript(p2pkh)
+	require.NoError(err)
+	require.Equal(pkScript, output.txOut.PkScript)
+	require.Empty(output.RedeemScript)
+
+	// Vested allocations pay to the P2WSH of their redeem script, which is
+	// in the JSON output with the output script
+	for _, a := range []allocation{
+		{Address: p2pkh.String(), Amount: 1000, LocktimeHeight: 10},
+		{Address: p2wpkh.String(), Amount: 1000, LocktimeHeight: 100_000},
+		{Address: p2wpkh.String(), Amount: 1000, LocktimeTimestamp: 1_900_000_000},
+	} {
+		output, err := newAllocationOutput(a, netParams)
+		require.NoError(err)
+		require.True(txscript.IsPayToWitnessScriptHash(output.txOut.PkScript))
+		require.Equal(hex.EncodeToString(output.txOut.PkScript), output.PkScript)
+		redeemScript, err := hex.DecodeString(output.RedeemScript)
+		require.NoError(err)
+		locktime, err := a.locktime()
+		require.NoError(err)
+		require.NoError(checkVestingScript(redeemScript, locktime, keyHash))
+
+		data, err := json.Marshal(output)
+		require.NoError(err)
+		var decoded map[string]interface{}
+		require.NoError(json.Unmarshal(data, &decoded))
+		require.Equal(output.PkScript, decoded["pkScript"])
+		require.Equal(output.RedeemScript, decoded["redeemScript"])
+		require.Equal(output.VestedAddress, decoded["vestedAddress"])
+	}
+
+	for _, a := range []allocation{
+		{Address: p2pkh.String()},
+		{Address: p2pkh.String(), Amount: btcutil.MaxSatoshi + 1},
+		{Address: "invalid", Amount: 1000},
+		{Address: p2pkh.String(), Amount: 1000, LocktimeHeight: 10, LocktimeTimestamp: 1_900_000_000},
+		{Address: p2pkh.String(), Amount: 1000, LocktimeHeight: txscript.LockTimeThreshold},
+		{Address: p2pkh.String(), Amount: 1000, LocktimeTimestamp: 10},
+		{Address: p2wsh.String(), Amount: 1000, LocktimeHeight: 10},
+	} {
+		_, err := newAllocationOutput(a, netParams)
+		require.Error(err, "%+v", a)
+	}
+}
+
+func TestCheckVestingScript(t *testing.T) {
+	require := require.New(t)
+
+	keyHash := make([]byte, 20)
+	script, err := vestingScript(10, keyHash)
+	require.NoError(err)
+	require.NoError(checkVestingScript(script, 10, keyHash))
+
+	require.ErrorIs(checkVestingScript(script, 11, keyHash), errVestingScriptMismatch)
+	require.ErrorIs(checkVestingScript(script, 10, make([]byte, 19)), errVestingScriptMismatch)
+	require.ErrorIs(checkVestingScript(script[:len(script)-1], 10, keyHash), errVestingScriptMismatch)
+	require.ErrorIs(checkVestingScript(append(script, txscript.OP_NOP), 10, keyHash), errVestingScriptMismatch)
+	require.Error(checkVestingScript(script[:7], 10, keyHash))
+}
+
+func TestSpendVestedAllocation(t *testing.T) {
+	const lockHeight = 10
+
+	require := require.New(t)
+	netParams := &chaincfg.RegressionNetParams
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	addr, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(key.PubKey().SerializeCompressed()), netParams)
+	require.NoError(err)
+	output, err := newAllocationOutput(allocation{Address: addr.String(), Amount: 1000, LocktimeHeight: lockHeight}, netParams)
+	require.NoError(err)
+	redeemScript, err := hex.DecodeString(output.RedeemScript)
+	require.NoError(err)
+
+	// spend executes the scripts of a spend of the output with the given
+	// locktime and sequence
+	genesisCoinbase := chainhash.Hash{1}
+	spend := func(lockTime uint32, sequence uint32) error {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: *wire.NewOutPoint(&genesisCoinbase, 1),
+			Sequence:         sequence,
+		})
+		tx.AddTxOut(wire.NewTxOut(900, output.txOut.PkScript))
+		tx.LockTime = lockTime
+
+		prevFetcher := txscript.NewCannedPrevOutputFetcher(output.txOut.PkScript, output.txOut.Value)
+		sigHashes := txscript.NewTxSigHashes(tx, prevFetcher)
+		sig, err := txscript.RawTxInWitnessSignature(tx, sigHashes, 0, output.txOut.Value, redeemScript, txscript.SigHashAll, key)
+		require.NoError(err)
+		tx.TxIn[0].Witness = wire.TxWitness{sig, key.PubKey().SerializeCompressed(), redeemScript}
+
+		engine, err := txscript.NewEngine(output.txOut.PkScript, tx, 0, txscript.StandardVerifyFlags, nil, sigHashes, output.txOut.Value, prevFetcher)
+		require.NoError(err)
+		return engine.Execute()
+	}
+
+	// Spends are only valid in blocks after the lock height, which allow
+	// the locktime of the spend to be the lock height
+	require.ErrorContains(spend(lockHeight-1, 0), "locktime requirement not satisfied")
+	require.ErrorContains(spend(lockHeight, wire.MaxTxInSequenceNum), "transaction input is finalized")
+	require.NoError(spend(lockHeight, 0))
+	require.NoError(spend(lockHeight+100, wire.MaxTxInSequenceNum-1))
+}
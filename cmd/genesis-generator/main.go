@@ -3,8 +3,10 @@ package main
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"math"
 	"math/big"
 	"os"
 	"time"
@@ -25,6 +27,8 @@ func main() {
 	reward := flag.Int64("reward", 5000000000, "Coinbase reward in satoshis (default: 50 BTC)")
 	timestamp := flag.Int64("timestamp", 0, "Block timestamp (unix seconds, default: now)")
 	network := flag.String("net", "mainnet", "Network to use (mainnet, testnet, regtest, simnet, signet)")
+	coinbaseMaturity := flag.Uint("coinbasematurity", 100, "Number of blocks before coinbase outputs can be spent")
+	allocationsFile := flag.String("allocations", "", "JSON file of premine allocations added to the genesis coinbase")
 
 	flag.Parse()
 
@@ -65,6 +69,11 @@ Usage:
 		os.Exit(1)
 	}
 
+	if *coinbaseMaturity > math.MaxUint16 {
+		fmt.Printf("Error: Coinbase maturity must be at most %d\n", math.MaxUint16)
+		os.Exit(1)
+	}
+
 	// Parse address
 	addr, err := btcutil.DecodeAddress(*address, netParams)
 	if err != nil {
@@ -72,8 +81,32 @@ Usage:
 		os.Exit(1)
 	}
 
+	// Create the outputs of the premine allocations
+	var allocations []*allocationOutput
+	if *allocationsFile != "" {
+		loaded, err := loadAllocations(*allocationsFile)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		total := *reward
+		for i, a := range loaded {
+			output, err := newAllocationOutput(a, netParams)
+			if err != nil {
+				fmt.Printf("Error: Invalid allocation %d: %v\n", i, err)
+				os.Exit(1)
+			}
+			allocations = append(allocations, output)
+			total += a.Amount
+			if total > btcutil.MaxSatoshi {
+				fmt.Printf("Error: Genesis coinbase outputs exceed %s\n", btcutil.Amount(btcutil.MaxSatoshi))
+				os.Exit(1)
+			}
+		}
+	}
+
 	// Create genesis block
-	genesisBlock, err := createGenesisBlock(addr, *coinbaseMsg, *reward, *timestamp)
+	genesisBlock, err := createGenesisBlock(addr, *coinbaseMsg, *reward, *timestamp, allocations)
 	if err != nil {
 		fmt.Printf("Error creating genesis block: %v\n", err)
 		os.Exit(1)
@@ -111,6 +144,17 @@ Genesis Block (hex):
 		addr.String(),
 		genesisHex,
 	)
+	printAllocations(allocations)
+
+	allocationsJSON := ""
+	if len(allocations) > 0 {
+		data, err := json.MarshalIndent(allocations, "\t\t  ", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding allocations: %v\n", err)
+			os.Exit(1)
+		}
+		allocationsJSON = fmt.Sprintf("\n\t\t  \"allocations\": %s,", data)
+	}
 	fmt.Printf(`========================================
 		Configuration
 		========================================
@@ -121,7 +165,14 @@ Genesis Block (hex):
 		  "genesisBlock": "%s",
 		  "coinbaseAddress": "%s",
 		  "blockHash": "%s",
-		  "timestamp": %d
+		  "timestamp": %d,%s
+		  "chainParams": {
+		    "coinbaseMaturity": %d,
+		    "powDisabled": true,
+		    "monotonicTimestamps": true,
+		    "increasingTimestamps": true,
+		    "distinctNetworkMagic": true
+		  }
 		}
 		
 		Or save the hex to a file for use with createBlockchain:
@@ -136,6 +187,8 @@ Genesis Block (hex):
 		addr.String(),
 		blockHash.String(),
 		genesisBlock.Header.Timestamp.Unix(),
+		allocationsJSON,
+		*coinbaseMaturity,
 		genesisHex,
 	)
 	printHashAsGoStruct(genesisBlock.Header.MerkleRoot, "btcVMTestNetGenesisMerkleRoot")
@@ -148,6 +201,46 @@ Genesis Block (hex):
 	fmt.Println()
 }
 
+// printAllocations prints the outputs of the allocations and how to spend
+// those that are vested
+func printAllocations(allocations []*allocationOutput) {
+	if len(allocations) == 0 {
+		return
+	}
+	fmt.Print(`========================================
+Premine Allocations
+========================================
+
+`)
+	for i, a := range allocations {
+		fmt.Printf("Output %d: %s to %s\n", i+1, btcutil.Amount(a.Amount), a.Address)
+		if a.RedeemScript == "" {
+			fmt.Println()
+			continue
+		}
+
+		redeemScript, _ := hex.DecodeString(a.RedeemScript)
+		disasm, _ := txscript.DisasmString(redeemScript)
+		if a.LocktimeHeight != 0 {
+			fmt.Printf("  Vested until height: %d\n", a.LocktimeHeight)
+		} else {
+			fmt.Printf("  Vested until: %s\n", time.Unix(int64(a.LocktimeTimestamp), 0).UTC().Format(time.RFC3339))
+		}
+		fmt.Printf(`  P2WSH address: %s
+  Redeem script (hex): %s
+  Redeem script: %s
+  Spend with a transaction whose locktime is at least the vesting locktime,
+  an input sequence below 0xffffffff and the witness:
+    <signature> <compressed public key> <redeem script>
+
+`, a.VestedAddress, a.RedeemScript, disasm)
+	}
+	fmt.Print(`Vested outputs are P2WSH and only protected by their redeem script once
+segwit is active, at height 300 on btcvm chains.
+
+`)
+}
+
 func printHashAsGoStruct(hash chainhash.Hash, varName string) {
 	fmt.Printf("%s = chainhash.Hash([chainhash.HashSize]byte{\n", varName)
 	for i := range chainhash.HashSize {
@@ -355,6 +448,7 @@ func createGenesisBlock(
 	coinbaseMsg string,
 	reward int64,
 	timestamp int64,
+	allocations []*allocationOutput,
 ) (*wire.MsgBlock, error) {
 	// Set timestamp
 	var blockTime time.Time
@@ -389,6 +483,11 @@ func createGenesisBlock(
 		PkScript: pkScript,
 	})
 
+	// Premine allocation outputs
+	for _, a := range allocations {
+		coinbaseTx.AddTxOut(a.txOut)
+	}
+
 	// Calculate merkle root
 	merkleRoot := coinbaseTx.TxHash()
 
@@ -0,0 +1,91 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+// vmid prints the ID of a btcvm-based VM and suggests the address params and
+// network magic of a chain.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// defaultVMName is the name of the btcvm VM
+const defaultVMName = "btcvm"
+
+// output is the JSON output of the tool
+type output struct {
+	VMName      string      `json:"vmName"`
+	VMID        string      `json:"vmID"`
+	PluginFile  string      `json:"pluginFile,omitempty"`
+	ChainName   string      `json:"chainName"`
+	ChainParams chainParams `json:"chainParams"`
+	Warnings    []string    `json:"warnings,omitempty"`
+}
+
+func main() {
+	chainName := flag.String("chain", "", "Chain name the params are derived from (default: the VM name)")
+	plugin := flag.Bool("plugin", false, "Print the plugin filename of the VM")
+	jsonOutput := flag.Bool("json", false, "Print JSON")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: vmid [flags] [vm-name]\n\nThe VM name defaults to %q.\n\n", defaultVMName)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	vmName := defaultVMName
+	if flag.NArg() == 1 {
+		vmName = flag.Arg(0)
+	}
+	if *chainName == "" {
+		*chainName = vmName
+	}
+
+	id, err := vmID(vmName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	params := deriveChainParams(*chainName)
+	out := output{
+		VMName:      vmName,
+		VMID:        id.String(),
+		ChainName:   *chainName,
+		ChainParams: params,
+		Warnings:    params.collisions(),
+	}
+	// metalgo loads the plugin of a VM from the file named after its ID
+	if *plugin {
+		out.PluginFile = id.String()
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(out); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Printf("VM name:           %s\n", out.VMName)
+	fmt.Printf("VM ID:             %s\n", out.VMID)
+	if out.PluginFile != "" {
+		fmt.Printf("Plugin file:       %s\n", out.PluginFile)
+	}
+	fmt.Printf("Chain name:        %s\n", out.ChainName)
+	fmt.Printf("bech32HRP:         %s\n", params.Bech32HRP)
+	fmt.Printf("pubKeyHashAddrID:  %d (%#02x)\n", params.PubKeyHashAddrID, params.PubKeyHashAddrID)
+	fmt.Printf("scriptHashAddrID:  %d (%#02x)\n", params.ScriptHashAddrID, params.ScriptHashAddrID)
+	fmt.Printf("Network magic:     %#08x\n", params.NetworkMagic)
+	for _, warning := range out.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/utils/constants"
+
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg"
+)
+
+// maxHRPLen is the length derived bech32 HRPs are truncated to, keeping
+// addresses short
+const maxHRPLen = 10
+
+// paramsDomain separates the hash chain params are derived from
+const paramsDomain = "btcvm chain params: "
+
+var errInvalidVMName = errors.New("invalid VM name")
+
+// wellKnownNets are the Bitcoin networks derived params must not collide with
+var wellKnownNets = []*chaincfg.Params{
+	&chaincfg.MainNetParams,
+	&chaincfg.TestNet3Params,
+	&chaincfg.TestNet4Params,
+	&chaincfg.RegressionNetParams,
+	&chaincfg.SimNetParams,
+	&chaincfg.SigNetParams,
+}
+
+// chainParams are the params suggested for a chain, named like the address
+// params of the genesis config
+type chainParams struct {
+	Bech32HRP        string `json:"bech32HRP"`
+	PubKeyHashAddrID byte   `json:"pubKeyHashAddrID"`
+	ScriptHashAddrID byte   `json:"scriptHashAddrID"`
+	NetworkMagic     uint32 `json:"networkMagic"`
+}
+
+// vmID returns the ID of the VM name, which is the name padded to 32 bytes
+func vmID(name string) (ids.ID, error) {
+	if name == "" || len(name) > ids.IDLen {
+		return ids.Empty, fmt.Errorf("%w: %q must be 1 to %d bytes", errInvalidVMName, name, ids.IDLen)
+	}
+	var b [ids.IDLen]byte
+	copy(b[:], name)
+	return ids.ToID(b[:])
+}
+
+// deriveChainParams derives the params of the chain name from its hash. The
+// HRP is the lowercase letters and digits of the name, or taken from the hash
+// if there are none.
+func deriveChainParams(name string) chainParams {
+	hash := sha256.Sum256([]byte(paramsDomain + name))
+
+	var hrp strings.Builder
+	for _, c := range strings.ToLower(name) {
+		if hrp.Len() == maxHRPLen {
+			break
+		}
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			hrp.WriteRune(c)
+		}
+	}
+	if hrp.Len() == 0 {
+		fmt.Fprintf(&hrp, "c%x", hash[:2])
+	}
+
+	// The address versions must differ for addresses to be told apart
+	scriptHashAddrID := hash[1]
+	if scriptHashAddrID == hash[0] {
+		scriptHashAddrID++
+	}
+	return chainParams{
+		Bech32HRP:        hrp.String(),
+		PubKeyHashAddrID: hash[0],
+		ScriptHashAddrID: scriptHashAddrID,
+		NetworkMagic:     binary.LittleEndian.Uint32(hash[2:6]),
+	}
+}
+
+// collisions returns the params of p used by the well-known Bitcoin networks
+// or Metal HRPs
+func (p chainParams) collisions() []string {
+	var found []string
+	for _, net := range wellKnownNets {
+		if p.Bech32HRP == net.Bech32HRPSegwit {
+			found = append(found, fmt.Sprintf("bech32HRP %q is the HRP of %s", p.Bech32HRP, net.Name))
+		}
+		for _, addrID := range []byte{p.PubKeyHashAddrID, p.ScriptHashAddrID} {
+			switch addrID {
+			case net.PubKeyHashAddrID, net.ScriptHashAddrID, net.PrivateKeyID:
+				found = append(found, fmt.Sprintf("address version %#02x is a version of %s", addrID, net.Name))
+			}
+		}
+		if p.NetworkMagic == uint32(net.Net) {
+			found = append(found, fmt.Sprintf("network magic %#08x is the magic of %s", p.NetworkMagic, net.Name))
+		}
+	}
+
+	metalHRPs := []string{constants.FallbackHRP}
+	for _, hrp := range constants.NetworkIDToHRP {
+		metalHRPs = append(metalHRPs, hrp)
+	}
+	for _, hrp := range metalHRPs {
+		if p.Bech32HRP == hrp {
+			found = append(found, fmt.Sprintf("bech32HRP %q is a Metal network HRP", p.Bech32HRP))
+		}
+	}
+	return found
+}
@@ -0,0 +1,68 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVMID(t *testing.T) {
+	require := require.New(t)
+
+	// The ID of btcvm is the plugin filename the build script uses
+	id, err := vmID(defaultVMName)
+	require.NoError(err)
+	require.Equal("kMtihm7W3KssmcJb9mzwZfC6gkiPrJhWaa5KMLHdEB9R8Q4pp", id.String())
+
+	_, err = vmID("")
+	require.ErrorIs(err, errInvalidVMName)
+	_, err = vmID(strings.Repeat("a", 33))
+	require.ErrorIs(err, errInvalidVMName)
+}
+
+func TestDeriveChainParams(t *testing.T) {
+	require := require.New(t)
+
+	// The derivation is deterministic
+	params := deriveChainParams("My Chain")
+	require.Equal(params, deriveChainParams("My Chain"))
+	require.Equal(chainParams{
+		Bech32HRP:        "mychain",
+		PubKeyHashAddrID: params.PubKeyHashAddrID,
+		ScriptHashAddrID: params.ScriptHashAddrID,
+		NetworkMagic:     params.NetworkMagic,
+	}, params)
+	require.NotEqual(params.PubKeyHashAddrID, params.ScriptHashAddrID)
+
+	// Chains with different names get different params
+	other := deriveChainParams("my-chain")
+	require.Equal(params.Bech32HRP, other.Bech32HRP)
+	require.NotEqual(params.NetworkMagic, other.NetworkMagic)
+
+	// HRPs are taken from the hash of names without letters or digits
+	hrp := deriveChainParams("!!").Bech32HRP
+	require.Equal(hrp, deriveChainParams("!!").Bech32HRP)
+	require.NotEqual(hrp, deriveChainParams("??").Bech32HRP)
+	require.True(strings.HasPrefix(hrp, "c"))
+
+	require.Len(deriveChainParams("averyveryverylongchainname").Bech32HRP, maxHRPLen)
+}
+
+func TestChainParamsCollisions(t *testing.T) {
+	require := require.New(t)
+
+	params := deriveChainParams("btcvm")
+	params.PubKeyHashAddrID = 0x05
+	params.NetworkMagic = 0xd9b4bef9
+	collisions := params.collisions()
+	require.Len(collisions, 2)
+	require.Contains(collisions[0], "mainnet")
+	require.Contains(collisions[1], "mainnet")
+
+	require.NotEmpty(deriveChainParams("bc").collisions())
+	require.NotEmpty(deriveChainParams("metal").collisions())
+}
@@ -0,0 +1,34 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+var _ Acceptor = noopAcceptor{}
+
+// Acceptor exports the blocks accepted by consensus. OnAccept is called by
+// Accept, in the order of the blocks, while the blocks lock is held, so it
+// must not block: exports doing I/O are queued and run asynchronously.
+type Acceptor interface {
+	OnAccept(block *BlockAdapter)
+}
+
+// noopAcceptor exports nothing. It is the acceptor of nodes which configure
+// no export.
+type noopAcceptor struct{}
+
+func (noopAcceptor) OnAccept(*BlockAdapter) {}
+
+// initializeAcceptor sets the acceptor of the node config and starts it
+func (vm *VM) initializeAcceptor() error {
+	if vm.nodeConfig.AcceptedBlockWebhooks == nil {
+		vm.acceptor = noopAcceptor{}
+		return nil
+	}
+
+	webhooks, err := newWebhookAcceptor(vm, *vm.nodeConfig.AcceptedBlockWebhooks)
+	if err != nil {
+		return err
+	}
+	vm.acceptor = webhooks
+	return nil
+}
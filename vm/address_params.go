@@ -0,0 +1,177 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/MetalBlockchain/metalgo/ids"
+
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+)
+
+// maxBech32HRPLen is the maximum length of the human-readable part of a
+// bech32 string, as defined in BIP 173
+const maxBech32HRPLen = 83
+
+var (
+	errInvalidBech32HRP      = errors.New("invalid bech32HRP")
+	errInvalidHDKeyID        = errors.New("invalid HD key ID")
+	errAddressIDCollision    = errors.New("pubKeyHashAddrID and scriptHashAddrID must differ")
+	errAddressesNeedMagic    = errors.New("addresses require distinctNetworkMagic")
+	errNetworkMagicCollision = errors.New("network magic registered with different addresses")
+
+	// registeredNetsLock protects registeredNets and the registration of
+	// networks with chaincfg
+	registeredNetsLock sync.Mutex
+
+	// registeredNets are the params of the networks registered by the VMs of
+	// the process, by network magic
+	registeredNets = make(map[wire.BitcoinNet]*chaincfg.Params)
+)
+
+// AddressParams overrides the prefixes of the addresses and keys of the
+// network. Unset fields keep the prefixes of the network, which are those of
+// simnet.
+type AddressParams struct {
+	// Bech32HRP is the human-readable part of segwit and taproot addresses
+	Bech32HRP string `json:"bech32HRP"`
+
+	// PubKeyHashAddrID and ScriptHashAddrID are the version bytes of base58
+	// P2PKH and P2SH addresses
+	PubKeyHashAddrID *byte `json:"pubKeyHashAddrID"`
+	ScriptHashAddrID *byte `json:"scriptHashAddrID"`
+
+	// PrivateKeyID is the version byte of WIF private keys
+	PrivateKeyID *byte `json:"privateKeyID"`
+
+	// HDPrivateKeyID and HDPublicKeyID are the hex-encoded 4 version bytes
+	// of BIP 32 extended keys. They are set together.
+	HDPrivateKeyID string `json:"hdPrivateKeyID"`
+	HDPublicKeyID  string `json:"hdPublicKeyID"`
+
+	// HDCoinType is the BIP 44 coin type of the network
+	HDCoinType *uint32 `json:"hdCoinType"`
+}
+
+// Validate checks if the address params are valid
+func (p *AddressParams) Validate() error {
+	if err := validateBech32HRP(p.Bech32HRP); err != nil {
+		return err
+	}
+	if (p.HDPrivateKeyID == "") != (p.HDPublicKeyID == "") {
+		return fmt.Errorf("%w: hdPrivateKeyID and hdPublicKeyID must be set together", errInvalidHDKeyID)
+	}
+	for _, keyID := range []string{p.HDPrivateKeyID, p.HDPublicKeyID} {
+		if keyID == "" {
+			continue
+		}
+		if _, err := decodeHDKeyID(keyID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateBech32HRP checks if hrp, when set, is a valid lowercase
+// human-readable part of bech32 strings
+func validateBech32HRP(hrp string) error {
+	if len(hrp) > maxBech32HRPLen {
+		return fmt.Errorf("%w: %q is longer than %d characters", errInvalidBech32HRP, hrp, maxBech32HRPLen)
+	}
+	for _, c := range hrp {
+		if c < 33 || c > 126 {
+			return fmt.Errorf("%w: %q has invalid character %q", errInvalidBech32HRP, hrp, c)
+		}
+	}
+	if strings.ToLower(hrp) != hrp {
+		return fmt.Errorf("%w: %q is not lowercase", errInvalidBech32HRP, hrp)
+	}
+	return nil
+}
+
+// decodeHDKeyID decodes the hex-encoded version bytes of extended keys
+func decodeHDKeyID(keyID string) ([4]byte, error) {
+	var id [4]byte
+	b, err := hex.DecodeString(keyID)
+	if err != nil {
+		return id, fmt.Errorf("%w: %q: %w", errInvalidHDKeyID, keyID, err)
+	}
+	if len(b) != len(id) {
+		return id, fmt.Errorf("%w: %q is not %d bytes", errInvalidHDKeyID, keyID, len(id))
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+// apply sets the prefixes of params, which must have been validated
+func (p *AddressParams) apply(params *chaincfg.Params) {
+	if p.Bech32HRP != "" {
+		params.Bech32HRPSegwit = p.Bech32HRP
+	}
+	if p.PubKeyHashAddrID != nil {
+		params.PubKeyHashAddrID = *p.PubKeyHashAddrID
+	}
+	if p.ScriptHashAddrID != nil {
+		params.ScriptHashAddrID = *p.ScriptHashAddrID
+	}
+	if p.PrivateKeyID != nil {
+		params.PrivateKeyID = *p.PrivateKeyID
+	}
+	if p.HDPrivateKeyID != "" {
+		params.HDPrivateKeyID, _ = decodeHDKeyID(p.HDPrivateKeyID)
+		params.HDPublicKeyID, _ = decodeHDKeyID(p.HDPublicKeyID)
+	}
+	if p.HDCoinType != nil {
+		params.HDCoinType = *p.HDCoinType
+	}
+}
+
+// NetworkMagic returns the network magic of the chain chainID. Chain IDs are
+// hashes, so their leading bytes tell chains apart.
+func NetworkMagic(chainID ids.ID) wire.BitcoinNet {
+	return wire.BitcoinNet(binary.LittleEndian.Uint32(chainID[:4]))
+}
+
+// registerNetwork registers params with chaincfg, so that the addresses and
+// extended keys of the network are decoded. A VM initialized again for the
+// same chain, as in tests, finds its network registered already, which is
+// only an error if its addresses changed.
+func registerNetwork(params *chaincfg.Params) error {
+	if params.PubKeyHashAddrID == params.ScriptHashAddrID {
+		return errAddressIDCollision
+	}
+
+	registeredNetsLock.Lock()
+	defer registeredNetsLock.Unlock()
+
+	if registered, ok := registeredNets[params.Net]; ok {
+		if !sameAddresses(registered, params) {
+			return fmt.Errorf("%w: %#08x", errNetworkMagicCollision, uint32(params.Net))
+		}
+		return nil
+	}
+	if err := chaincfg.Register(params); err != nil {
+		return fmt.Errorf("failed to register network magic %#08x: %w", uint32(params.Net), err)
+	}
+	registeredNets[params.Net] = params
+	return nil
+}
+
+// sameAddresses returns whether a and b have the same address and key
+// prefixes
+func sameAddresses(a, b *chaincfg.Params) bool {
+	return a.Bech32HRPSegwit == b.Bech32HRPSegwit &&
+		a.PubKeyHashAddrID == b.PubKeyHashAddrID &&
+		a.ScriptHashAddrID == b.ScriptHashAddrID &&
+		a.PrivateKeyID == b.PrivateKeyID &&
+		a.HDPrivateKeyID == b.HDPrivateKeyID &&
+		a.HDPublicKeyID == b.HDPublicKeyID
+}
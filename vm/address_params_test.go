@@ -0,0 +1,195 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MetalBlockchain/metalgo/database/memdb"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/utils/constants"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2/schnorr"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil/hdkeychain"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+)
+
+// customAddresses are the address params of a custom network
+const customAddresses = `{
+	"bech32HRP":"metal",
+	"pubKeyHashAddrID":50,
+	"scriptHashAddrID":55,
+	"privateKeyID":178,
+	"hdPrivateKeyID":"0488ade5",
+	"hdPublicKeyID":"0488b220",
+	"hdCoinType":9000
+}`
+
+// initializeNetworkVM initializes a VM of the chain chainID with the chain
+// params chainParams, mining to miningAddr
+func initializeNetworkVM(t *testing.T, chainID ids.ID, chainParams string, miningAddr string) (*VM, error) {
+	vm := &VM{}
+	err := vm.Initialize(
+		context.Background(),
+		&snow.Context{
+			NetworkID: constants.UnitTestID,
+			ChainID:   chainID,
+			NodeID:    newTestNodeID(t),
+			Log:       logging.NoLog{},
+		},
+		memdb.New(),
+		[]byte(`{
+			"config":{"testNet":true,"dbType":"memdb","rpcUser":"user","rpcPass":"pass","miningAddrs":["`+miningAddr+`"]},
+			"chainParams":`+chainParams+`
+		}`),
+		nil,
+		nil,
+		make(chan common.Message, 1),
+		nil,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		require.NoError(t, vm.Shutdown(context.Background()))
+	})
+	return vm, nil
+}
+
+func TestAddressParamsValidate(t *testing.T) {
+	pkhID := byte(0x7b)
+	tests := []struct {
+		name        string
+		chainParams ChainParams
+		expectedErr error
+	}{
+		{
+			name:        "addresses without distinct network magic",
+			chainParams: ChainParams{Addresses: &AddressParams{Bech32HRP: "metal"}},
+			expectedErr: errAddressesNeedMagic,
+		},
+		{
+			name: "uppercase bech32 HRP",
+			chainParams: ChainParams{
+				DistinctNetworkMagic: true,
+				Addresses:            &AddressParams{Bech32HRP: "Metal"},
+			},
+			expectedErr: errInvalidBech32HRP,
+		},
+		{
+			name: "bech32 HRP with a space",
+			chainParams: ChainParams{
+				DistinctNetworkMagic: true,
+				Addresses:            &AddressParams{Bech32HRP: "me tal"},
+			},
+			expectedErr: errInvalidBech32HRP,
+		},
+		{
+			name: "HD private key ID only",
+			chainParams: ChainParams{
+				DistinctNetworkMagic: true,
+				Addresses:            &AddressParams{HDPrivateKeyID: "0488ade5"},
+			},
+			expectedErr: errInvalidHDKeyID,
+		},
+		{
+			name: "short HD key ID",
+			chainParams: ChainParams{
+				DistinctNetworkMagic: true,
+				Addresses:            &AddressParams{HDPrivateKeyID: "0488ad", HDPublicKeyID: "0488b220"},
+			},
+			expectedErr: errInvalidHDKeyID,
+		},
+		{
+			name: "valid",
+			chainParams: ChainParams{
+				DistinctNetworkMagic: true,
+				Addresses:            &AddressParams{Bech32HRP: "metal", PubKeyHashAddrID: &pkhID},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.ErrorIs(t, test.chainParams.Validate(), test.expectedErr)
+		})
+	}
+}
+
+func TestCustomNetworkAddresses(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	pkHash := btcutil.Hash160(key.PubKey().SerializeCompressed())
+	chainID := ids.GenerateTestID()
+	chainParams := `{"distinctNetworkMagic":true,"addresses":` + customAddresses + `}`
+
+	// The mining address is decoded with the prefixes of the network
+	witnessPKHash, err := btcutil.NewAddressWitnessPubKeyHash(pkHash, &chaincfg.Params{Bech32HRPSegwit: "metal"})
+	require.NoError(err)
+	vm, err := initializeNetworkVM(t, chainID, chainParams, witnessPKHash.EncodeAddress())
+	require.NoError(err)
+	params := vm.config.ChainParams
+	require.Equal(NetworkMagic(chainID), params.Net)
+	require.NotEqual(wire.SimNet, params.Net)
+	require.Equal("metal", params.Bech32HRPSegwit)
+	require.Equal(byte(50), params.PubKeyHashAddrID)
+	require.Equal(uint32(9000), params.HDCoinType)
+
+	// P2PKH, P2WPKH and P2TR addresses are decoded and encoded again
+	pkHashAddr, err := btcutil.NewAddressPubKeyHash(pkHash, params)
+	require.NoError(err)
+	taprootAddr, err := btcutil.NewAddressTaproot(
+		schnorr.SerializePubKey(txscript.ComputeTaprootKeyNoScript(key.PubKey())), params)
+	require.NoError(err)
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	for _, addr := range []btcutil.Address{pkHashAddr, witnessPKHash, taprootAddr} {
+		encoded := addr.EncodeAddress()
+		decoded, err := btcutil.DecodeAddress(encoded, params)
+		require.NoError(err, encoded)
+		require.True(decoded.IsForNet(params), encoded)
+		require.Equal(encoded, decoded.EncodeAddress())
+
+		var validated btcjson.ValidateAddressChainResult
+		callRPC(t, handlers["/rpc"], "validateaddress", []interface{}{encoded}, &validated)
+		require.True(validated.IsValid, encoded)
+		require.Equal(encoded, validated.Address)
+	}
+	require.Equal("metal1p", taprootAddr.EncodeAddress()[:7])
+
+	// WIF keys and extended keys use the prefixes of the network
+	wif, err := btcutil.NewWIF(key, params, true)
+	require.NoError(err)
+	decodedWIF, err := btcutil.DecodeWIF(wif.String())
+	require.NoError(err)
+	require.True(decodedWIF.IsForNet(params))
+	seed := make([]byte, hdkeychain.RecommendedSeedLen)
+	master, err := hdkeychain.NewMaster(seed, params)
+	require.NoError(err)
+	require.Equal("xprv", master.String()[:4])
+	extendedPub, err := master.Neuter()
+	require.NoError(err)
+	require.Equal("xpub", extendedPub.String()[:4])
+	require.True(extendedPub.IsForNet(params))
+
+	// A VM initialized again for the chain finds its network registered,
+	// which fails if its addresses changed
+	_, err = initializeNetworkVM(t, chainID, chainParams, witnessPKHash.EncodeAddress())
+	require.NoError(err)
+	_, err = initializeNetworkVM(t, chainID, `{"distinctNetworkMagic":true}`, mainNetAddr)
+	require.ErrorIs(err, errNetworkMagicCollision)
+}
@@ -3,17 +3,37 @@ package vm
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/MetalBlockchain/metalgo/database"
 	"github.com/MetalBlockchain/metalgo/ids"
 	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
 	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
 	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	btcdb "github.com/MetalBlockchain/btcvm/btcd/database"
 	"github.com/MetalBlockchain/btcvm/btcd/wire"
 	"go.uber.org/zap"
 )
 
+var (
+	errBlockRejected  = errors.New("block was rejected")
+	errParentRejected = errors.New("parent block was rejected")
+	errUnknownBlock   = errors.New("block is unknown to btcd")
+	errBlockMismatch  = errors.New("block transactions do not match its commitments")
+
+	errInvalidWitnessCommitment = errors.New("invalid witness commitment")
+
+	// ErrBlockNotFound is returned for blocks that are not stored, which the
+	// engine fetches from its peers. It is a database.ErrNotFound, as the
+	// engine expects of missing blocks.
+	ErrBlockNotFound = fmt.Errorf("block %w", database.ErrNotFound)
+
+	// ErrBlockCorrupted is returned for stored blocks that can't be read
+	ErrBlockCorrupted = errors.New("block is corrupted")
+)
+
 // BlockAdapter wraps a Bitcoin block and implements the snowman.Block interface
 type BlockAdapter struct {
 	vm        *VM
@@ -23,40 +43,68 @@ type BlockAdapter struct {
 	height    uint64
 	timestamp time.Time
 	bytes     []byte
-}
-
-// NewBlockAdapter creates a new block adapter from a Bitcoin block
-func NewBlockAdapter(vm *VM, btcBlock *btcutil.Block) (*BlockAdapter, error) {
-	// Convert block hash to Metal ID
-	blockHash := btcBlock.Hash()
-	id := hashToID(blockHash)
 
-	// Get parent block hash
-	msgBlock := btcBlock.MsgBlock()
-	parentHash := &msgBlock.Header.PrevBlock
-	parentID := hashToID(parentHash)
+	// pChainHeight is the P-chain height committed in the coinbase, if
+	// hasPChainHeight is set
+	pChainHeight    uint64
+	hasPChainHeight bool
+
+	// proposer is the NodeID tagged in the coinbase, if hasProposer is set
+	proposer    ids.NodeID
+	hasProposer bool
+
+	// Verification state, protected by the VM's block mutex. Consensus
+	// shares a single adapter per block through the block cache, so the
+	// result of Verify is reused by later calls.
+	status    blockStatus
+	verifyErr error
+	// verifiedParent is the parent the block was verified against, if it
+	// was cached at the time
+	verifiedParent *BlockAdapter
+}
 
-	// Get block height
-	height := uint64(btcBlock.Height())
+// blockStatus is the verification and decision state of a block
+type blockStatus uint8
 
-	// Get timestamp
-	timestamp := msgBlock.Header.Timestamp
+const (
+	blockUnverified blockStatus = iota
+	blockVerified
+	blockFailed
+	blockRejected
+)
 
-	// Serialize block to bytes (use btcutil.Block's serialization)
+// NewBlockAdapter creates a new block adapter from a Bitcoin block. Blocks
+// fetched from the database keep the exact bytes they were stored with, which
+// are those they were built or parsed from.
+func NewBlockAdapter(vm *VM, btcBlock *btcutil.Block) (*BlockAdapter, error) {
+	// btcutil.Block returns the bytes it was created from, if any
 	bytes, err := btcBlock.Bytes()
 	if err != nil {
 		return nil, fmt.Errorf("failed to serialize block: %w", err)
 	}
 
+	return newBlockAdapterWithBytes(vm, btcBlock, bytes), nil
+}
+
+// newBlockAdapterWithBytes creates a new block adapter from a Bitcoin block
+// and its serialized bytes, avoiding serializing the block again
+func newBlockAdapterWithBytes(vm *VM, btcBlock *btcutil.Block, bytes []byte) *BlockAdapter {
+	msgBlock := btcBlock.MsgBlock()
+	pChainHeight, hasPChainHeight := committedPChainHeight(btcBlock)
+	proposer, hasProposer := blockProposer(btcBlock)
 	return &BlockAdapter{
-		vm:        vm,
-		btcBlock:  btcBlock,
-		id:        id,
-		parentID:  parentID,
-		height:    height,
-		timestamp: timestamp,
-		bytes:     bytes,
-	}, nil
+		vm:              vm,
+		btcBlock:        btcBlock,
+		id:              hashToID(btcBlock.Hash()),
+		parentID:        hashToID(&msgBlock.Header.PrevBlock),
+		height:          uint64(btcBlock.Height()),
+		timestamp:       msgBlock.Header.Timestamp,
+		bytes:           bytes,
+		pChainHeight:    pChainHeight,
+		hasPChainHeight: hasPChainHeight,
+		proposer:        proposer,
+		hasProposer:     hasProposer,
+	}
 }
 
 // NewBlockAdapterFromHash fetches a block by hash and creates an adapter
@@ -65,12 +113,28 @@ func NewBlockAdapterFromHash(vm *VM, hash *chainhash.Hash) (*BlockAdapter, error
 	// Use BlockByHashAny to retrieve blocks from any chain (main or side)
 	block, err := vm.chain.BlockByHashAny(hash)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get block by hash: %w", err)
+		return nil, blockRetrievalError(hash, err)
 	}
 
 	return NewBlockAdapter(vm, block)
 }
 
+// blockRetrievalError returns the error of reading the block hash from the
+// chain as ErrBlockNotFound if the block is not stored, and as
+// ErrBlockCorrupted if it is stored but can't be read. Reads failing because
+// the database is closed are neither.
+func blockRetrievalError(hash *chainhash.Hash, err error) error {
+	var dbErr btcdb.Error
+	switch {
+	case blockchain.IsBlockNotFoundErr(err):
+		return fmt.Errorf("%w: %w", ErrBlockNotFound, err)
+	case errors.As(err, &dbErr) && (dbErr.ErrorCode == btcdb.ErrDbNotOpen || dbErr.ErrorCode == btcdb.ErrTxClosed):
+		return fmt.Errorf("failed to get block %s: %w", hash, err)
+	default:
+		return fmt.Errorf("%w: %s: %w", ErrBlockCorrupted, hash, err)
+	}
+}
+
 // NewBlockAdapterFromID fetches a block by Metal ID and creates an adapter
 func NewBlockAdapterFromID(vm *VM, blockID ids.ID) (*BlockAdapter, error) {
 	// Convert Metal ID to Bitcoin hash
@@ -79,26 +143,51 @@ func NewBlockAdapterFromID(vm *VM, blockID ids.ID) (*BlockAdapter, error) {
 	return NewBlockAdapterFromHash(vm, hash)
 }
 
-// NewBlockAdapterFromBytes deserializes a block from bytes and processes it through btcd
-func NewBlockAdapterFromBytes(vm *VM, blockBytes []byte) (*BlockAdapter, error) {
-	// Deserialize the Bitcoin block from bytes
+// deserializeBlock deserializes a block from bytes, keeping the bytes so they
+// are not serialized again
+func deserializeBlock(blockBytes []byte) (*btcutil.Block, error) {
 	var msgBlock wire.MsgBlock
 	reader := bytes.NewReader(blockBytes)
 	err := msgBlock.BtcDecode(reader, 0, wire.WitnessEncoding)
 	if err != nil {
 		return nil, fmt.Errorf("failed to deserialize block: %w", err)
 	}
+	if reader.Len() != 0 {
+		return nil, fmt.Errorf("failed to deserialize block: %d trailing bytes", reader.Len())
+	}
+	return btcutil.NewBlockFromBlockAndBytes(&msgBlock, blockBytes), nil
+}
+
+// serializeBlock serializes msgBlock with the encoding deserializeBlock
+// decodes, so that every node identifies the block by the same bytes
+func serializeBlock(msgBlock *wire.MsgBlock) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(msgBlock.SerializeSize())
+	if err := msgBlock.BtcEncode(&buf, 0, wire.WitnessEncoding); err != nil {
+		return nil, fmt.Errorf("failed to serialize block: %w", err)
+	}
+	return buf.Bytes(), nil
+}
 
-	// Wrap in btcutil.Block
-	block := btcutil.NewBlock(&msgBlock)
+// NewBlockAdapterFromBytes deserializes a block from bytes and processes it through btcd
+func NewBlockAdapterFromBytes(vm *VM, blockBytes []byte) (*BlockAdapter, error) {
+	block, err := deserializeBlock(blockBytes)
+	if err != nil {
+		return nil, err
+	}
 	blockHash := block.Hash()
 
 	vm.ctx.Log.Info("Deserialized block from bytes",
 		zap.String("blockHash", blockHash.String()))
 
+	// Alternate histories of the accepted chain are not processed
+	if err := vm.checkFinality(block); err != nil {
+		return nil, err
+	}
+
 	// Process the block through btcd's validation and storage pipeline
 	// This ensures the block is validated and stored in the database
-	isMainChain, isOrphan, err := vm.chain.ProcessBlock(block, blockchain.BFNone)
+	isMainChain, isOrphan, err := vm.processBlock(block, blockchain.BFNone)
 	if err != nil {
 		vm.ctx.Log.Error("Failed to process parsed block",
 			zap.String("blockHash", blockHash.String()),
@@ -113,14 +202,74 @@ func NewBlockAdapterFromBytes(vm *VM, blockBytes []byte) (*BlockAdapter, error)
 		zap.Bool("isOrphan", isOrphan),
 	)
 
-	// Now create the adapter using the stored block
-	// Use BlockByHashAny to retrieve it (works for main and side chains)
-	storedBlock, err := vm.chain.BlockByHashAny(blockHash)
+	// btcd sets the height of blocks it connects, so the adapter can be
+	// created from the parsed block and the bytes it was parsed from
+	if block.Height() != btcutil.BlockHeightUnknown {
+		return newBlockAdapterWithBytes(vm, block, blockBytes), nil
+	}
+
+	// Otherwise the height is taken from the stored block, which works for
+	// main and side chains. The adapter keeps the bytes the block was parsed
+	// from rather than those of the stored block.
+	height, err := vm.chain.BlockHeightByHashAny(blockHash)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve processed block: %w", err)
 	}
+	block.SetHeight(height)
+	return newBlockAdapterWithBytes(vm, block, blockBytes), nil
+}
+
+// newKnownBlockAdapter creates an adapter for a block btcd already processed,
+// such as a block received through gossip, from the bytes it is parsed from.
+// The block is neither processed nor fetched from the database again.
+func newKnownBlockAdapter(vm *VM, blockBytes []byte) (*BlockAdapter, error) {
+	block, err := deserializeBlock(blockBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	height, err := vm.chain.BlockHeightByHashAny(block.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	// The header matches the known block, but the transactions were not
+	// validated with it
+	if err := checkBlockCommitments(block); err != nil {
+		return nil, err
+	}
+
+	block.SetHeight(height)
+	return newBlockAdapterWithBytes(vm, block, blockBytes), nil
+}
+
+// checkBlockCommitments checks that the transactions of block are those its
+// header and coinbase commit to, so that the header of a known block cannot be
+// sent with other transactions
+func checkBlockCommitments(block *btcutil.Block) error {
+	txs := block.Transactions()
+	if len(txs) == 0 {
+		return fmt.Errorf("%w: no transactions", errBlockMismatch)
+	}
+
+	// Duplicated transactions can leave the merkle root unchanged
+	// (CVE-2012-2459), so they are rejected first
+	seen := make(map[chainhash.Hash]struct{}, len(txs))
+	for _, tx := range txs {
+		if _, ok := seen[*tx.Hash()]; ok {
+			return fmt.Errorf("%w: duplicate transaction %s", errBlockMismatch, tx.Hash())
+		}
+		seen[*tx.Hash()] = struct{}{}
+	}
 
-	return NewBlockAdapter(vm, storedBlock)
+	merkleRoot := blockchain.CalcMerkleRoot(txs, false)
+	if !block.MsgBlock().Header.MerkleRoot.IsEqual(&merkleRoot) {
+		return fmt.Errorf("%w: merkle root %s", errBlockMismatch, merkleRoot)
+	}
+	if err := blockchain.ValidateWitnessCommitment(block); err != nil {
+		return fmt.Errorf("%w: %w", errBlockMismatch, err)
+	}
+	return nil
 }
 
 // ID returns the block ID
@@ -148,16 +297,97 @@ func (b *BlockAdapter) Bytes() []byte {
 	return b.bytes
 }
 
-// Verify verifies the block
+// Verify verifies the block. The block is validated at most once unless the
+// parent it was verified against is rejected, or verification failed for a
+// reason that may not recur.
 func (b *BlockAdapter) Verify(ctx context.Context) error {
-	// The block should already be validated by btcd when we retrieve it
-	// from the blockchain. We could add additional validation here if needed.
+	b.vm.blocksMu.Lock()
+	defer b.vm.blocksMu.Unlock()
+
+	// A block verified against a parent that was since rejected is verified
+	// again. The rejected parent is no longer cached, so it is kept to verify
+	// the block against.
+	parent := b.verifiedParent
+	if b.status == blockVerified && parent != nil && parent.status == blockRejected {
+		b.status = blockUnverified
+	}
+
+	switch b.status {
+	case blockVerified:
+		return nil
+	case blockFailed:
+		return b.verifyErr
+	case blockRejected:
+		return errBlockRejected
+	}
+
+	if parent == nil {
+		parent, _ = b.vm.blockCache.Get(b.parentID)
+	}
+	if err := b.vm.blockVerifier(b, parent); err != nil {
+		if permanentVerifyErr(err) {
+			b.status = blockFailed
+			b.verifyErr = err
+		}
+		b.vm.ctx.Log.Debug("Block verification failed",
+			zap.String("id", b.id.String()),
+			zap.Uint64("height", b.height),
+			zap.Error(err))
+		return err
+	}
+
+	b.status = blockVerified
+	b.verifiedParent = parent
+	b.vm.processing.Add(b.id)
 	b.vm.ctx.Log.Debug("Block verified",
 		zap.String("id", b.id.String()),
 		zap.Uint64("height", b.height))
 	return nil
 }
 
+// permanentVerifyErr returns whether a block failed verification with err for
+// breaking a consensus rule, which it breaks whenever it is verified again.
+// Other failures, such as a database error or the block not being stored yet,
+// may not recur.
+func permanentVerifyErr(err error) bool {
+	var ruleErr blockchain.RuleError
+	return errors.As(err, &ruleErr) ||
+		errors.Is(err, errParentRejected) ||
+		errors.Is(err, errBlockTimeNotIncreasing)
+}
+
+// verifyBlock validates a block whose parent is parent, or nil if the parent
+// is not cached. The block was already validated by btcd when it was
+// processed, so this checks that btcd stored it and that its parent was not
+// rejected.
+//
+// The witness data of the block is checked against the BIP141 commitment of
+// its coinbase as well, since it is not covered by the block ID: the same
+// block with other witnesses would otherwise pass as the block btcd
+// validated. On chains with increasing timestamps, the block must be at least
+// a second after its parent.
+func (vm *VM) verifyBlock(b *BlockAdapter, parent *BlockAdapter) error {
+	if parent != nil && parent.status == blockRejected {
+		return fmt.Errorf("%w: %s", errParentRejected, b.parentID)
+	}
+
+	if err := blockchain.ValidateWitnessCommitment(b.btcBlock); err != nil {
+		return fmt.Errorf("%w: %w", errInvalidWitnessCommitment, err)
+	}
+	if err := vm.verifyBlockTime(b); err != nil {
+		return err
+	}
+
+	have, err := vm.chain.HaveBlock(idToHash(b.id))
+	if err != nil {
+		return fmt.Errorf("failed to look up block: %w", err)
+	}
+	if !have {
+		return fmt.Errorf("%w: %s", errUnknownBlock, b.id)
+	}
+	return nil
+}
+
 // Accept accepts the block
 func (b *BlockAdapter) Accept(ctx context.Context) error {
 	b.vm.blocksMu.Lock()
@@ -167,6 +397,19 @@ func (b *BlockAdapter) Accept(ctx context.Context) error {
 	b.vm.lastAccepted = b.id
 	b.vm.preferred = b.id
 
+	// Decided blocks do not reference their parent so that accepted blocks
+	// can be garbage collected
+	b.verifiedParent = nil
+	b.vm.processing.Remove(b.id)
+	b.vm.pruneBlockDecisions(b.height)
+	b.vm.recordAcceptedBlock(b.height, b.id)
+	b.vm.finalize(b.id)
+	b.vm.onBlockDecided(b.id, true)
+	b.vm.registerAcceptedBlock(b.height, b.btcBlock)
+	b.vm.indexAcceptedBlockFilter(b.btcBlock.Hash())
+	b.vm.btcdAdapter.NotifyBlockAccepted(b.btcBlock.Hash(), int32(b.height))
+	b.vm.acceptor.OnAccept(b)
+
 	b.vm.ctx.Log.Info("Block accepted",
 		zap.String("id", b.id.String()),
 		zap.Uint64("height", b.height))
@@ -180,6 +423,17 @@ func (b *BlockAdapter) Accept(ctx context.Context) error {
 
 // Reject rejects the block
 func (b *BlockAdapter) Reject(ctx context.Context) error {
+	b.vm.blocksMu.Lock()
+	b.status = blockRejected
+	b.verifiedParent = nil
+	b.vm.processing.Remove(b.id)
+	b.vm.blocksMu.Unlock()
+	b.vm.recordRejectedBlock(b.height, b.id)
+	b.vm.onBlockDecided(b.id, false)
+
+	// A rejected block will not be requested again by consensus
+	b.vm.blockCache.Evict(b.id)
+
 	b.vm.ctx.Log.Info("Block rejected",
 		zap.String("id", b.id.String()),
 		zap.Uint64("height", b.height))
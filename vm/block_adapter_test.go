@@ -0,0 +1,423 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MetalBlockchain/metalgo/database"
+	"github.com/MetalBlockchain/metalgo/ids"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockCache(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+
+	vms := newTestVMs(t, 2, key)
+	server, client := vms[0], vms[1]
+
+	// Built blocks are cached
+	blk, err := server.BuildBlock(ctx)
+	require.NoError(err)
+	cached, err := server.GetBlock(ctx, blk.ID())
+	require.NoError(err)
+	require.Same(blk, cached)
+
+	// Parsed blocks are cached, and parsing them again returns the same block
+	// instead of processing it again
+	parsed, err := client.ParseBlock(ctx, blk.Bytes())
+	require.NoError(err)
+	require.Equal(blk.ID(), parsed.ID())
+	require.Equal(blk.Height(), parsed.Height())
+	require.Equal(blk.Bytes(), parsed.Bytes())
+
+	reparsed, err := client.ParseBlock(ctx, blk.Bytes())
+	require.NoError(err)
+	require.Same(parsed, reparsed)
+
+	cached, err = client.GetBlock(ctx, blk.ID())
+	require.NoError(err)
+	require.Same(parsed, cached)
+
+	// Rejected blocks are evicted, but remain available from btcd
+	require.NoError(parsed.Reject(ctx))
+	_, ok := client.blockCache.Get(blk.ID())
+	require.False(ok)
+
+	fetched, err := client.GetBlock(ctx, blk.ID())
+	require.NoError(err)
+	require.NotSame(parsed, fetched)
+	require.Equal(blk.Bytes(), fetched.Bytes())
+}
+
+func TestGetBlockErrors(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMs(t, 1, key)[0]
+	buildTestChain(t, vm, 2)
+
+	// Blocks and heights the VM never stored are not found
+	_, err = vm.GetBlock(ctx, ids.GenerateTestID())
+	require.ErrorIs(err, ErrBlockNotFound)
+	require.ErrorIs(err, database.ErrNotFound)
+	_, err = vm.GetBlockIDAtHeight(ctx, 3)
+	require.ErrorIs(err, ErrBlockNotFound)
+	require.ErrorIs(err, database.ErrNotFound)
+	tipID, err := vm.GetBlockIDAtHeight(ctx, 2)
+	require.NoError(err)
+	require.Equal(vm.lastAccepted, tipID)
+
+	// A stored block whose data was truncated is corrupted, rather than
+	// not found
+	vm.blockCache.Flush()
+	blockFile := filepath.Join(btcd.BlockDBPath(vm.config.DataDir, vm.config.DbType), "000000000.fdb")
+	info, err := os.Stat(blockFile)
+	require.NoError(err)
+	require.NoError(os.Truncate(blockFile, info.Size()-8))
+	_, err = vm.GetBlock(ctx, tipID)
+	require.ErrorIs(err, ErrBlockCorrupted)
+	require.NotErrorIs(err, database.ErrNotFound)
+}
+
+func TestParseKnownBlock(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+
+	vms := newTestVMs(t, 2, key)
+	server, client := vms[0], vms[1]
+
+	blks := make([]*BlockAdapter, 2)
+	for i := range blks {
+		blk, err := server.BuildBlock(ctx)
+		require.NoError(err)
+		require.NoError(blk.Verify(ctx))
+		require.NoError(blk.Accept(ctx))
+		blks[i] = blk.(*BlockAdapter)
+	}
+
+	// Blocks received through gossip are processed by btcd before the engine
+	// parses them, which must not process them again
+	for _, blk := range blks {
+		_, _, err := client.chain.ProcessBlock(blk.btcBlock, blockchain.BFNone)
+		require.NoError(err)
+	}
+	parsed, err := client.ParseBlock(ctx, blks[1].Bytes())
+	require.NoError(err)
+	require.Equal(blks[1].ID(), parsed.ID())
+	require.Equal(blks[0].ID(), parsed.Parent())
+	require.Equal(blks[1].Height(), parsed.Height())
+	require.Equal(blks[1].Bytes(), parsed.Bytes())
+	require.NoError(parsed.Verify(ctx))
+
+	// The header of a known block cannot carry other transactions
+	var msgBlock wire.MsgBlock
+	require.NoError(msgBlock.Deserialize(bytes.NewReader(blks[1].Bytes())))
+	msgBlock.Transactions = blks[0].btcBlock.MsgBlock().Transactions
+	var buf bytes.Buffer
+	require.NoError(msgBlock.Serialize(&buf))
+	client.blockCache.Evict(parsed.ID())
+	_, err = client.ParseBlock(ctx, buf.Bytes())
+	require.ErrorIs(err, errBlockMismatch)
+}
+
+func TestVerifyOnce(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+
+	vm := newTestVMs(t, 1, key)[0]
+	verifications := 0
+	vm.blockVerifier = func(blk *BlockAdapter, parent *BlockAdapter) error {
+		verifications++
+		return vm.verifyBlock(blk, parent)
+	}
+
+	parent, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(parent.Verify(ctx))
+	require.NoError(parent.Verify(ctx))
+	require.Equal(1, verifications)
+
+	// The result is shared with other lookups of the same block
+	cached, err := vm.GetBlock(ctx, parent.ID())
+	require.NoError(err)
+	require.NoError(cached.Verify(ctx))
+	require.Equal(1, verifications)
+
+	child, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.Equal(parent.ID(), child.Parent())
+	require.NoError(child.Verify(ctx))
+	require.NoError(child.Verify(ctx))
+	require.Equal(2, verifications)
+
+	// Rejecting the parent invalidates the child's result
+	require.NoError(parent.Reject(ctx))
+	require.ErrorIs(child.Verify(ctx), errParentRejected)
+	require.Equal(3, verifications)
+	require.ErrorIs(child.Verify(ctx), errParentRejected)
+	require.Equal(3, verifications)
+	require.ErrorIs(parent.Verify(ctx), errBlockRejected)
+	require.Equal(3, verifications)
+}
+
+func TestVerifyRetriesTransientFailures(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+
+	vm := newTestVMs(t, 1, key)[0]
+	var verifyErr error
+	verifications := 0
+	vm.blockVerifier = func(blk *BlockAdapter, parent *BlockAdapter) error {
+		verifications++
+		if verifyErr != nil {
+			return verifyErr
+		}
+		return vm.verifyBlock(blk, parent)
+	}
+
+	// A block failing verification for a reason that may not recur, such as
+	// a database error, is verified again
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	errDatabase := errors.New("database closed")
+	verifyErr = errDatabase
+	require.ErrorIs(blk.Verify(ctx), errDatabase)
+	verifyErr = nil
+	require.NoError(blk.Verify(ctx))
+	require.Equal(2, verifications)
+
+	// while a block breaking a consensus rule keeps failing
+	require.NoError(blk.Accept(ctx))
+	blk, err = vm.BuildBlock(ctx)
+	require.NoError(err)
+	verifyErr = fmt.Errorf("%w: %w", errInvalidWitnessCommitment, blockchain.RuleError{ErrorCode: blockchain.ErrWitnessCommitmentMismatch})
+	require.ErrorIs(blk.Verify(ctx), errInvalidWitnessCommitment)
+	verifyErr = nil
+	require.ErrorIs(blk.Verify(ctx), errInvalidWitnessCommitment)
+	require.Equal(3, verifications)
+}
+
+func BenchmarkGetBlock(b *testing.B) {
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(b, err)
+
+	vm := newTestVMs(b, 1, key)[0]
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(b, err)
+	require.NoError(b, blk.Accept(ctx))
+	blkID := blk.ID()
+
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := vm.GetBlock(ctx, blkID); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := NewBlockAdapterFromID(vm, blkID); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkMainChainHeaders(b *testing.B) {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(b, err)
+
+	const numBlocks = 50
+	vm := newTestVMs(b, 1, key)[0]
+	buildTestChain(b, vm, numBlocks)
+
+	// index reads the headers kept in memory by the block index, while blocks
+	// loads each block from the database for its header
+	b.Run("index", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			headers, err := vm.chain.MainChainHeaders(1, numBlocks)
+			if err != nil || len(headers) != numBlocks {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("blocks", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for height := int32(1); height <= numBlocks; height++ {
+				if _, err := vm.chain.BlockByHeight(height); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkParseKnownBlock(b *testing.B) {
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(b, err)
+
+	vms := newTestVMs(b, 2, key)
+	server, client := vms[0], vms[1]
+	blk, err := server.BuildBlock(ctx)
+	require.NoError(b, err)
+	btcBlock := blk.(*BlockAdapter).btcBlock
+	_, _, err = client.chain.ProcessBlock(btcBlock, blockchain.BFNone)
+	require.NoError(b, err)
+	blkBytes := blk.Bytes()
+
+	// known parses the block from its bytes, while fetched is the lookup and
+	// serialization of the stored block ParseBlock made before
+	b.Run("known", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			client.blockCache.Evict(blk.ID())
+			if _, err := client.ParseBlock(ctx, blkBytes); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("fetched", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := NewBlockAdapterFromHash(client, btcBlock.Hash()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestSegwitBlock(t *testing.T) {
+	const fee = 10_000
+
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	upgradeBytes := []byte(`{"activationHeights":{"segwit":1}}`)
+	builder, err := newDeploymentsVM(t, key, `,"dbType":"memdb"`, upgradeBytes)
+	require.NoError(err)
+	verifier, err := newDeploymentsVM(t, key, `,"dbType":"memdb"`, upgradeBytes)
+	require.NoError(err)
+	txPool := builder.btcdAdapter.TxMemPool()
+
+	// build builds a block on builder and accepts it on both VMs, the
+	// verifier validating it from its bytes
+	build := func() *btcutil.Block {
+		blk, err := builder.BuildBlock(ctx)
+		require.NoError(err)
+		for _, vm := range []*VM{builder, verifier} {
+			parsed, err := vm.ParseBlock(ctx, blk.Bytes())
+			require.NoError(err)
+			require.NoError(parsed.Verify(ctx))
+			require.NoError(vm.SetPreference(ctx, parsed.ID()))
+			require.NoError(parsed.Accept(ctx))
+		}
+		return blk.(*BlockAdapter).btcBlock
+	}
+
+	// Fund a P2WPKH output from a coinbase
+	coinbase := build().Transactions()[0].MsgTx()
+	witnessKey, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	addr, err := btcutil.NewAddressWitnessPubKeyHash(
+		btcutil.Hash160(witnessKey.PubKey().SerializeCompressed()),
+		builder.config.ChainParams,
+	)
+	require.NoError(err)
+	pkScript, err := txscript.PayToAddrScript(addr)
+	require.NoError(err)
+	coinbaseHash := coinbase.TxHash()
+	funding := wire.NewMsgTx(wire.TxVersion)
+	funding.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&coinbaseHash, 0), nil, nil))
+	funding.AddTxOut(wire.NewTxOut(coinbase.TxOut[0].Value-fee, pkScript))
+	sigScript, err := txscript.SignatureScript(funding, 0, coinbase.TxOut[0].PkScript, txscript.SigHashAll, key, true)
+	require.NoError(err)
+	funding.TxIn[0].SignatureScript = sigScript
+	_, err = txPool.ProcessTransaction(btcutil.NewTx(funding), false, false, 0)
+	require.NoError(err)
+
+	// A block without witness data has no commitment
+	block := build()
+	require.Len(block.Transactions(), 2)
+	_, found := blockchain.ExtractWitnessCommitment(block.Transactions()[0])
+	require.False(found)
+
+	// Spend the P2WPKH output
+	fundingHash := funding.TxHash()
+	amount := funding.TxOut[0].Value
+	spend := wire.NewMsgTx(wire.TxVersion)
+	spend.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&fundingHash, 0), nil, nil))
+	spend.AddTxOut(wire.NewTxOut(amount-fee, pkScript))
+	fetcher := txscript.NewCannedPrevOutputFetcher(pkScript, amount)
+	witness, err := txscript.WitnessSignature(spend, txscript.NewTxSigHashes(spend, fetcher), 0, amount, pkScript,
+		txscript.SigHashAll, witnessKey, true)
+	require.NoError(err)
+	spend.TxIn[0].Witness = witness
+	_, err = txPool.ProcessTransaction(btcutil.NewTx(spend), false, false, 0)
+	require.NoError(err)
+
+	// The block including it commits to its witness with the reserved value
+	block = build()
+	require.Len(block.Transactions(), 2)
+	require.Equal(spend.WitnessHash(), *block.Transactions()[1].WitnessHash())
+	coinbaseTx := block.Transactions()[0]
+	_, found = blockchain.ExtractWitnessCommitment(coinbaseTx)
+	require.True(found)
+	require.Equal(wire.TxWitness{make([]byte, blockchain.CoinbaseWitnessDataLen)}, coinbaseTx.MsgTx().TxIn[0].Witness)
+	require.Equal(hashToID(block.Hash()), verifier.lastAccepted)
+
+	// The block with its witnesses stripped has the same ID but fails
+	// verification
+	blockBytes, err := block.Bytes()
+	require.NoError(err)
+	var stripped wire.MsgBlock
+	require.NoError(stripped.Deserialize(bytes.NewReader(blockBytes)))
+	stripped.Transactions[1].TxIn[0].Witness = nil
+	strippedBytes, err := serializeBlock(&stripped)
+	require.NoError(err)
+	strippedBlock := newBlockAdapterWithBytes(verifier, btcutil.NewBlock(&stripped), strippedBytes)
+	require.Equal(hashToID(block.Hash()), strippedBlock.ID())
+	require.ErrorIs(strippedBlock.Verify(ctx), errInvalidWitnessCommitment)
+}
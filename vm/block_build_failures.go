@@ -0,0 +1,159 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/MetalBlockchain/metalgo/snow/consensus/snowman"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// unhealthyBuildFailureStreak is the number of consecutive failed builds
+// after which HealthCheck reports the node as unhealthy
+const unhealthyBuildFailureStreak = 3
+
+// Causes of failed builds. BuildBlock wraps its errors in them so that the
+// failures can be broken down by cause.
+var (
+	errBuildMiningAddr = errors.New("invalid mining address")
+	errBuildTemplate   = errors.New("failed to create block template")
+	errBuildProcess    = errors.New("failed to process block")
+	errBuildOrphan     = errors.New("generated block is orphan (parent missing)")
+
+	errBuildFailing = errors.New("block building is failing")
+)
+
+// Labels of the causes of failed builds in the build failure metrics
+const (
+	buildCauseMiningAddr = "mining_address"
+	buildCauseTemplate   = "template"
+	buildCauseProcess    = "process"
+	buildCauseOrphan     = "orphan"
+	buildCauseStale      = "stale_parent"
+	buildCauseOther      = "other"
+)
+
+// buildFailureCause returns the label of the cause of the failed build err
+func buildFailureCause(err error) string {
+	switch {
+	case errors.Is(err, errBuildMiningAddr):
+		return buildCauseMiningAddr
+	case errors.Is(err, errBuildTemplate):
+		return buildCauseTemplate
+	case errors.Is(err, errBuildProcess):
+		return buildCauseProcess
+	case errors.Is(err, errBuildOrphan):
+		return buildCauseOrphan
+	case errors.Is(err, ErrStaleParent):
+		return buildCauseStale
+	default:
+		return buildCauseOther
+	}
+}
+
+// buildFailureTracker follows the outcome of the builds of the VM, so that a
+// node failing to build blocks, which the engine retries forever, is reported
+// by HealthCheck and the metrics rather than only in its logs
+type buildFailureTracker struct {
+	lock        sync.Mutex
+	lastErr     error
+	streak      int
+	lastSuccess time.Time
+
+	// lastBuilt is the last block built successfully
+	lastBuilt snowman.Block
+
+	failures          *prometheus.CounterVec
+	consecutive       prometheus.Gauge
+	lastSuccessMetric prometheus.Gauge
+}
+
+// newBuildFailureTracker creates a tracker and registers its metrics under
+// namespace
+func newBuildFailureTracker(registerer prometheus.Registerer, namespace string) (*buildFailureTracker, error) {
+	t := &buildFailureTracker{
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "build_failures",
+			Help:      "number of failed builds by cause",
+		}, []string{"cause"}),
+		consecutive: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "consecutive_build_failures",
+			Help:      "number of builds that failed since the last successful build",
+		}),
+		lastSuccessMetric: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_build_timestamp",
+			Help:      "unix time in seconds of the last successful build",
+		}),
+	}
+
+	for _, collector := range []prometheus.Collector{t.failures, t.consecutive, t.lastSuccessMetric} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, fmt.Errorf("failed to register build failure metrics: %w", err)
+		}
+	}
+	return t, nil
+}
+
+// record records the outcome of a build finished at now, which built blk
+// unless it failed with err, resetting the failure streak on success
+func (t *buildFailureTracker) record(blk snowman.Block, err error, now time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if err == nil {
+		t.lastErr = nil
+		t.streak = 0
+		t.lastSuccess = now
+		t.lastBuilt = blk
+		t.consecutive.Set(0)
+		t.lastSuccessMetric.Set(float64(now.Unix()))
+		return
+	}
+
+	// A build on a parent that went stale is retried on the new tip, so it
+	// doesn't tell that building is failing
+	t.failures.WithLabelValues(buildFailureCause(err)).Inc()
+	if errors.Is(err, ErrStaleParent) {
+		return
+	}
+	t.lastErr = err
+	t.streak++
+	t.consecutive.Set(float64(t.streak))
+}
+
+// lastBuild returns the last block built successfully and when it was built,
+// or nil if no block was built yet
+func (t *buildFailureTracker) lastBuild() (snowman.Block, time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.lastBuilt, t.lastSuccess
+}
+
+// health adds the state of the builds to details and returns an error if the
+// last unhealthyBuildFailureStreak builds failed
+func (t *buildFailureTracker) health(details map[string]interface{}) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	details["buildFailureStreak"] = t.streak
+	if t.lastErr != nil {
+		details["lastBuildError"] = t.lastErr.Error()
+	}
+	if !t.lastSuccess.IsZero() {
+		details["lastBuildTime"] = t.lastSuccess.UTC().Format(time.RFC3339)
+	}
+
+	if t.streak >= unhealthyBuildFailureStreak {
+		return fmt.Errorf("%w: %d consecutive builds failed, last with: %w", errBuildFailing, t.streak, t.lastErr)
+	}
+	return nil
+}
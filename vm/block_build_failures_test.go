@@ -0,0 +1,82 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/MetalBlockchain/metalgo/utils/timer/mockable"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+)
+
+func TestBuildFailureCause(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{fmt.Errorf("%w: %w", errBuildMiningAddr, errors.New("bad address")), buildCauseMiningAddr},
+		{fmt.Errorf("%w: %w", errBuildTemplate, errors.New("no parent")), buildCauseTemplate},
+		{fmt.Errorf("%w: %w", errBuildProcess, errors.New("bad block")), buildCauseProcess},
+		{errBuildOrphan, buildCauseOrphan},
+		{fmt.Errorf("%w: tip moved", ErrStaleParent), buildCauseStale},
+		{errors.New("failed to get current block"), buildCauseOther},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.expected, buildFailureCause(test.err), test.err.Error())
+	}
+}
+
+func TestBuildFailureHealth(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMs(t, 1, key)[0]
+	clock := &mockable.Clock{}
+	clock.Set(time.Unix(1_700_000_000, 0))
+	vm.Clock = clock
+
+	// Builds fail without a mining address
+	miningAddrs := vm.config.MiningAddrs
+	vm.config.MiningAddrs = nil
+	for i := 1; i <= unhealthyBuildFailureStreak; i++ {
+		_, err := vm.BuildBlock(ctx)
+		require.ErrorIs(err, errBuildMiningAddr)
+
+		health, err := vm.HealthCheck(ctx)
+		details := health.(map[string]interface{})
+		require.Equal(i, details["buildFailureStreak"])
+		require.Contains(details["lastBuildError"], "no mining address configured")
+		require.NotContains(details, "lastBuildTime")
+		if i < unhealthyBuildFailureStreak {
+			require.NoError(err)
+		} else {
+			require.ErrorIs(err, errBuildFailing)
+			require.ErrorIs(err, errBuildMiningAddr)
+		}
+	}
+	require.Equal(float64(unhealthyBuildFailureStreak),
+		testutil.ToFloat64(vm.buildFailures.failures.WithLabelValues(buildCauseMiningAddr)))
+	require.Equal(float64(unhealthyBuildFailureStreak), testutil.ToFloat64(vm.buildFailures.consecutive))
+
+	// A successful build resets the streak
+	vm.config.MiningAddrs = miningAddrs
+	buildTestChain(t, vm, 1)
+	health, err := vm.HealthCheck(ctx)
+	require.NoError(err)
+	details := health.(map[string]interface{})
+	require.Equal(0, details["buildFailureStreak"])
+	require.NotContains(details, "lastBuildError")
+	require.Equal("2023-11-14T22:13:20Z", details["lastBuildTime"])
+	require.Zero(testutil.ToFloat64(vm.buildFailures.consecutive))
+	require.Equal(float64(clock.Time().Unix()), testutil.ToFloat64(vm.buildFailures.lastSuccessMetric))
+}
@@ -5,11 +5,14 @@ package vm
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
 	"sync"
 	"time"
 
 	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
 	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/metalgo/ids"
 	"github.com/MetalBlockchain/metalgo/snow/engine/common"
 	"go.uber.org/zap"
 )
@@ -28,13 +31,36 @@ const (
 // blockBuilder manages the event-driven block building process.
 // It monitors the mempool for pending transactions and signals
 // when a block should be built.
+//
+// The engine learns that a block should be built from WaitForEvent and, if
+// the VM was initialized with one, from notifications sent on the toEngine
+// channel. Without the channel, the builder is in WaitForEvent-only mode: it
+// never schedules or sends notifications, and waitForEvent alone paces the
+// builds.
 type blockBuilder struct {
 	// vm is the parent VM instance
 	vm *VM
 
+	// waitForEventOnly is set if the VM has no toEngine channel
+	waitForEventOnly bool
+
+	// clock is the clock of the VM, from which build times are measured
+	clock Clock
+
+	// staggered is set if builds are delayed by the stagger of the node
+	staggered bool
+
+	metrics *builderMetrics
+
 	// Synchronization
-	lock          sync.Mutex
-	pendingSignal *sync.Cond // Signal when transactions are pending
+	lock sync.Mutex
+	// pendingSignal is closed, and replaced under lock, when transactions
+	// become pending
+	pendingSignal chan struct{}
+	// preferenceSignal is closed, and replaced under lock, when the
+	// preferred block changes, so that waits for the building delay of the
+	// previous preferred block are cut short
+	preferenceSignal chan struct{}
 
 	// Transaction event channel
 	txSubmitChan chan struct{}
@@ -43,31 +69,104 @@ type blockBuilder struct {
 	hasPendingTxs bool // Whether mempool has pending txs
 	shutdownChan  <-chan struct{}
 
+	// buildScheduled is set while a scheduleBlockBuild goroutine is running.
+	// buildGeneration is incremented on every build attempt and success.
+	buildScheduled  bool
+	buildGeneration uint64
+
+	// Lifecycle: started is set, under lock, once the builder runs, and
+	// stopped before the adapter is stopped. wg tracks every goroutine and
+	// call that may touch the adapter.
+	started bool
+	stopped bool
+	wg      sync.WaitGroup
+
 	// Track last build time and parent for delay calculation
 	buildBlockLock      sync.Mutex
 	lastBuildTime       time.Time
 	lastBuildParentHash chainhash.Hash
+	lastBuildSucceeded  bool
+	// lastPreferenceTime is when the preferred block last changed
+	lastPreferenceTime time.Time
 }
 
-// newBlockBuilder creates a new block builder instance
-func newBlockBuilder(vm *VM) *blockBuilder {
+// newBlockBuilder creates a new block builder instance, registering its
+// metrics to the VM's metrics gatherer
+func newBlockBuilder(vm *VM) (*blockBuilder, error) {
+	metrics, err := newBuilderMetrics(vm.metrics, "block_builder")
+	if err != nil {
+		return nil, err
+	}
 	b := &blockBuilder{
-		vm:           vm,
-		txSubmitChan: make(chan struct{}, txSubmitChannelSize),
-		shutdownChan: vm.shutdownChan,
+		vm:               vm,
+		waitForEventOnly: vm.toEngine == nil,
+		clock:            vm.Clock,
+		staggered:        vm.nodeConfig.StaggeredBuilding,
+		metrics:          metrics,
+		pendingSignal:    make(chan struct{}),
+		preferenceSignal: make(chan struct{}),
+		txSubmitChan:     make(chan struct{}, txSubmitChannelSize),
+		shutdownChan:     vm.shutdownChan,
 	}
-	b.pendingSignal = sync.NewCond(&b.lock)
-	return b
+	return b, nil
 }
 
 // start begins the block builder's goroutines
 func (b *blockBuilder) start() {
+	if !b.enter() {
+		return
+	}
+	b.lock.Lock()
+	b.started = true
+	b.lock.Unlock()
 	go b.awaitTxSubmissions()
 }
 
+// active returns true if the builder was started and is not stopped
+func (b *blockBuilder) active() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.started && !b.stopped
+}
+
+// stop marks the builder as stopped and waits for its goroutines and pending
+// calls to return. The VM's shutdown channel must be closed first so that
+// waiting goroutines are released.
+func (b *blockBuilder) stop() {
+	b.lock.Lock()
+	b.stopped = true
+	b.broadcastLocked()
+	b.lock.Unlock()
+
+	b.wg.Wait()
+}
+
+// broadcastLocked wakes all goroutines waiting in waitForNeedToBuild. b.lock
+// must be held.
+func (b *blockBuilder) broadcastLocked() {
+	close(b.pendingSignal)
+	b.pendingSignal = make(chan struct{})
+}
+
+// enter registers a caller that may touch the adapter, returning false if the
+// builder is stopped. Callers returning true must call b.wg.Done when done.
+func (b *blockBuilder) enter() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.stopped {
+		return false
+	}
+	b.wg.Add(1)
+	return true
+}
+
 // awaitTxSubmissions listens for transaction submission events
 // from the mempool and signals when blocks should be built.
 func (b *blockBuilder) awaitTxSubmissions() {
+	defer b.wg.Done()
+
 	for {
 		select {
 		case <-b.txSubmitChan:
@@ -80,94 +179,207 @@ func (b *blockBuilder) awaitTxSubmissions() {
 
 // onTxAccepted is called when a transaction is accepted into the mempool
 func (b *blockBuilder) onTxAccepted(tx *btcutil.Tx) {
-	b.vm.ctx.Log.Info("onTxAccepted called", zap.String("txHash", tx.Hash().String()))
+	b.vm.builderLog.Info("onTxAccepted called", zap.String("txHash", tx.Hash().String()))
 	select {
 	case b.txSubmitChan <- struct{}{}:
-		b.vm.ctx.Log.Info("onTxAccepted sent signal to txSubmitChan")
+		b.vm.builderLog.Info("onTxAccepted sent signal to txSubmitChan")
 	default:
-		b.vm.ctx.Log.Info("onTxAccepted txSubmitChan full, signal dropped")
+		b.vm.builderLog.Info("onTxAccepted txSubmitChan full, signal dropped")
 	}
 }
 
 // signalCanBuild marks that transactions are available and schedules block building
 // It starts a goroutine that waits for the appropriate delay before notifying the engine
 func (b *blockBuilder) signalCanBuild() {
-	b.vm.ctx.Log.Info("signalCanBuild called - transactions are available")
+	b.vm.builderLog.Info("signalCanBuild called - transactions are available")
 
 	b.lock.Lock()
+	if b.stopped {
+		b.lock.Unlock()
+		return
+	}
 	alreadyPending := b.hasPendingTxs
 	b.hasPendingTxs = true
+	if !alreadyPending {
+		b.broadcastLocked()
+	}
+	// At most one scheduler runs at a time, so that the engine is notified
+	// once per build. Without a channel to notify, waitForEvent is woken by
+	// the broadcast alone.
+	alreadyScheduled := b.buildScheduled
+	startScheduler := !alreadyPending && !alreadyScheduled && !b.waitForEventOnly
+	if startScheduler {
+		b.buildScheduled = true
+		b.wg.Add(1)
+	}
 	b.lock.Unlock()
 
 	// If we already have a pending build scheduled, don't start another one
-	if alreadyPending {
-		b.vm.ctx.Log.Info("signalCanBuild: build already scheduled, skipping")
+	if b.waitForEventOnly {
+		b.vm.builderLog.Info("signalCanBuild: no engine channel, leaving the build to WaitForEvent")
+		return
+	}
+	if !startScheduler {
+		b.vm.builderLog.Info("signalCanBuild: build already scheduled, skipping",
+			zap.Bool("pending", alreadyPending),
+			zap.Bool("scheduled", alreadyScheduled))
 		return
 	}
 
-	b.pendingSignal.Broadcast()
-	b.vm.ctx.Log.Info("signalCanBuild broadcasted to condition variable")
+	b.vm.builderLog.Info("signalCanBuild broadcasted to waiters")
 
 	// Start a goroutine to handle the delay and notify the engine
 	go b.scheduleBlockBuild()
 }
 
-// scheduleBlockBuild waits for the appropriate delay and then notifies the engine to build a block
+// scheduleBlockBuild waits for the appropriate delay and then notifies the
+// engine to build a block. If a block is built, or another block becomes
+// preferred, while it waits, the delay is recalculated from the new build
+// attempt or against the new preferred block, so that no sibling of a block
+// already being decided is built.
 func (b *blockBuilder) scheduleBlockBuild() {
-	b.vm.ctx.Log.Info("scheduleBlockBuild started")
+	defer b.wg.Done()
 
-	// Get current block to calculate delay
-	currentBlock, err := b.vm.getCurrentBlock()
-	if err != nil {
-		b.vm.ctx.Log.Error("scheduleBlockBuild failed to get current block", zap.Error(err))
+	b.vm.builderLog.Info("scheduleBlockBuild started")
+
+	for {
 		b.lock.Lock()
-		b.hasPendingTxs = false
+		generation := b.buildGeneration
+		preferenceChanged := b.preferenceSignal
+		b.lock.Unlock()
+		parent := b.vm.preferredBlock()
+
+		// Get current block to calculate delay
+		currentBlock, err := b.vm.getCurrentBlock()
+		if err != nil {
+			b.vm.builderLog.Error("scheduleBlockBuild failed to get current block", zap.Error(err))
+			b.lock.Lock()
+			b.hasPendingTxs = false
+			b.buildScheduled = false
+			b.lock.Unlock()
+			return
+		}
+
+		// Calculate delay based on last build time
+		delay := b.calculateBuildingDelay(*currentBlock.Hash())
+		b.vm.builderLog.Info("scheduleBlockBuild calculated delay", zap.Duration("delay", delay))
+
+		// If delay is needed, wait for it
+		if delay > 0 {
+			b.vm.builderLog.Info("scheduleBlockBuild waiting for delay", zap.Duration("delay", delay))
+			timer := time.NewTimer(delay)
+
+			select {
+			case <-timer.C:
+				b.vm.builderLog.Info("scheduleBlockBuild delay elapsed")
+			case <-preferenceChanged:
+				timer.Stop()
+				b.vm.builderLog.Info("scheduleBlockBuild preferred block changed while waiting, rescheduling")
+				continue
+			case <-b.shutdownChan:
+				timer.Stop()
+				b.vm.builderLog.Info("scheduleBlockBuild cancelled due to shutdown")
+				return
+			}
+		} else {
+			b.vm.builderLog.Info("scheduleBlockBuild no delay needed")
+		}
+
+		// The preferred block may have changed before the wait started
+		if preferred := b.vm.preferredBlock(); preferred != parent {
+			b.vm.builderLog.Info("scheduleBlockBuild preferred block changed, rescheduling",
+				zap.Stringer("parent", parent),
+				zap.Stringer("preferred", preferred))
+			continue
+		}
+
+		b.lock.Lock()
+		if generation != b.buildGeneration {
+			// A block was built while waiting, so wait again from that build
+			b.lock.Unlock()
+			b.vm.builderLog.Info("scheduleBlockBuild block built while waiting, rescheduling")
+			continue
+		}
+
+		// Check if we still need to build (transactions might have been
+		// included in another block). The check is made under lock so that a
+		// signal after it starts a new scheduler.
+		needToBuild := b.needToBuild()
+		if !needToBuild {
+			b.hasPendingTxs = false
+		}
+		b.buildScheduled = false
 		b.lock.Unlock()
+
+		if !needToBuild {
+			b.vm.builderLog.Info("scheduleBlockBuild no transactions to build")
+			return
+		}
+
+		// Notify the engine to build a block
+		b.vm.builderLog.Info("scheduleBlockBuild notifying engine")
+		if b.notifyEngine(generation) {
+			b.vm.builderLog.Info("scheduleBlockBuild successfully notified engine")
+		}
 		return
 	}
+}
+
+// notifyEngine notifies the engine that a block should be built. If the
+// channel is full, the notification is retried with a delay doubling from
+// RetryDelay up to TargetBlockTime until it is sent, a block is built after
+// the build generation, nothing is left to build or the VM shuts down, so
+// that the last pending transactions of a quiet chain are not left in the
+// mempool. It returns true if the notification was sent, and false in
+// WaitForEvent-only mode.
+func (b *blockBuilder) notifyEngine(generation uint64) bool {
+	if b.waitForEventOnly {
+		return false
+	}
 
-	// Calculate delay based on last build time
-	delay := b.calculateBuildingDelay(*currentBlock.Hash())
-	b.vm.ctx.Log.Info("scheduleBlockBuild calculated delay", zap.Duration("delay", delay))
+	delay := RetryDelay
+	for {
+		select {
+		case b.vm.toEngine <- common.PendingTxs:
+			return true
+		default:
+		}
 
-	// If delay is needed, wait for it
-	if delay > 0 {
-		b.vm.ctx.Log.Info("scheduleBlockBuild waiting for delay", zap.Duration("delay", delay))
-		timer := time.NewTimer(delay)
-		defer timer.Stop()
+		b.metrics.notificationsDropped.Inc()
+		b.vm.builderLog.Debug("failed to notify engine (channel full), retrying",
+			zap.Duration("delay", delay))
 
+		timer := time.NewTimer(delay)
 		select {
 		case <-timer.C:
-			b.vm.ctx.Log.Info("scheduleBlockBuild delay elapsed")
 		case <-b.shutdownChan:
-			b.vm.ctx.Log.Info("scheduleBlockBuild cancelled due to shutdown")
-			return
+			timer.Stop()
+			return false
 		}
-	} else {
-		b.vm.ctx.Log.Info("scheduleBlockBuild no delay needed")
-	}
+		delay = min(2*delay, TargetBlockTime)
 
-	// Check if we still need to build (transactions might have been included in another block)
-	if !b.needToBuild() {
-		b.vm.ctx.Log.Info("scheduleBlockBuild no transactions to build")
+		// A block was built since the notification was due, so the engine
+		// is building blocks and will be notified again if needed
 		b.lock.Lock()
-		b.hasPendingTxs = false
+		built := generation != b.buildGeneration
 		b.lock.Unlock()
-		return
-	}
-
-	// Notify the engine to build a block
-	b.vm.ctx.Log.Info("scheduleBlockBuild notifying engine")
-	select {
-	case b.vm.toEngine <- common.PendingTxs:
-		b.vm.ctx.Log.Info("scheduleBlockBuild successfully notified engine")
-	default:
-		b.vm.ctx.Log.Warn("scheduleBlockBuild failed to notify engine (channel full)")
+		if built {
+			return false
+		}
+		if !b.needToBuild() {
+			b.vm.builderLog.Debug("nothing left to build, not retrying engine notification")
+			return false
+		}
+		b.metrics.notificationRetries.Inc()
 	}
 }
 
-// needToBuild returns true if there are pending transactions
+// needToBuild returns true if there are pending transactions or a block was
+// requested through the generatetoaddress RPC
 func (b *blockBuilder) needToBuild() bool {
+	if b.vm.generatePending() {
+		return true
+	}
 	mempool := b.vm.btcdAdapter.TxMemPool()
 	if mempool == nil {
 		return false
@@ -180,111 +392,151 @@ func (b *blockBuilder) calculateBuildingDelay(currentBlockHash chainhash.Hash) t
 	b.buildBlockLock.Lock()
 	defer b.buildBlockLock.Unlock()
 
-	// If we've never built a block, no delay needed
-	if b.lastBuildTime.IsZero() {
-		b.vm.ctx.Log.Debug("first block build, no delay")
-		return 0
+	// Check if this is a retry (same parent as last attempt). A block built
+	// on the same parent may still be waiting for consensus, which is not a
+	// retry.
+	isRetry := isBuildRetry(b.lastBuildParentHash, currentBlockHash, b.lastBuildSucceeded)
+
+	// A block that became preferred since the last build, such as one built
+	// by another validator, is spaced from as if it was built here
+	lastBuildTime := b.lastBuildTime
+	if !isRetry && b.lastPreferenceTime.After(lastBuildTime) {
+		lastBuildTime = b.lastPreferenceTime
 	}
+	var stagger time.Duration
+	if b.staggered {
+		stagger = buildStagger(currentBlockHash, b.vm.ctx.NodeID)
+	}
+	delay := buildingDelay(b.clock.Time(), lastBuildTime, isRetry, stagger)
+	b.vm.builderLog.Debug("calculated building delay",
+		zap.Bool("isRetry", isRetry),
+		zap.Duration("stagger", stagger),
+		zap.Duration("delay", delay),
+	)
+	return delay
+}
 
-	// Check if this is a retry (same parent as last attempt)
-	isRetry := b.lastBuildParentHash.IsEqual(&currentBlockHash)
+// buildStagger returns the offset within TargetBlockTime by which nodeID
+// delays building on parentHash, even once the chain was idle for longer than
+// TargetBlockTime. It is derived from both so that the validators take turns
+// building in an order changing with every block.
+func buildStagger(parentHash chainhash.Hash, nodeID ids.NodeID) time.Duration {
+	h := sha256.New()
+	h.Write(parentHash[:])
+	h.Write(nodeID[:])
+	return time.Duration(binary.BigEndian.Uint64(h.Sum(nil)) % uint64(TargetBlockTime))
+}
+
+// isBuildRetry returns whether building on parentHash retries the last build
+// attempt, made on lastParentHash, which did not succeed
+func isBuildRetry(lastParentHash, parentHash chainhash.Hash, lastSucceeded bool) bool {
+	return lastParentHash.IsEqual(&parentHash) && !lastSucceeded
+}
 
-	var nextBuildTime time.Time
+// buildingDelay returns how long to wait at now before building a block, the
+// last build having been attempted at lastBuildTime. Builds are spaced by
+// TargetBlockTime, or by RetryDelay when retrying a failed build, and are then
+// delayed by stagger unless retrying. No spacing is needed if no block was
+// built yet. If the clock went back before the last build, the spacing is
+// capped to the full spacing rather than growing with the skew.
+func buildingDelay(now, lastBuildTime time.Time, isRetry bool, stagger time.Duration) time.Duration {
+	spacing := TargetBlockTime
 	if isRetry {
-		// Retry scenario: short delay
-		nextBuildTime = b.lastBuildTime.Add(RetryDelay)
-		b.vm.ctx.Log.Debug("retry detected, using retry delay")
-	} else {
-		// Normal scenario: target block time
-		nextBuildTime = b.lastBuildTime.Add(TargetBlockTime)
-		b.vm.ctx.Log.Debug("normal build, using target block time")
+		spacing, stagger = RetryDelay, 0
 	}
-
-	// Calculate remaining delay
-	now := time.Now()
-	remainingDelay := nextBuildTime.Sub(now)
-
-	if remainingDelay < 0 {
-		remainingDelay = 0
+	if lastBuildTime.IsZero() {
+		return stagger
+	}
+	if now.Before(lastBuildTime) {
+		return spacing + stagger
 	}
 
-	b.vm.ctx.Log.Debug("calculated building delay")
-
-	return remainingDelay
+	delay := lastBuildTime.Add(spacing).Sub(now)
+	return max(delay, 0) + stagger
 }
 
 // handleBuildAttempt records that we attempted to build a block
 // Should be called by BuildBlock regardless of success/failure
 func (b *blockBuilder) handleBuildAttempt(parentHash chainhash.Hash) {
+	if !b.enter() {
+		return
+	}
+	defer b.wg.Done()
+
 	b.buildBlockLock.Lock()
-	b.lastBuildTime = time.Now()
+	if !b.lastBuildTime.IsZero() && isBuildRetry(b.lastBuildParentHash, parentHash, b.lastBuildSucceeded) {
+		b.metrics.buildRetries.Inc()
+	}
+	b.lastBuildTime = b.clock.Time()
 	b.lastBuildParentHash = parentHash
+	b.lastBuildSucceeded = false
 	b.buildBlockLock.Unlock()
 
-	b.vm.ctx.Log.Debug("recorded build attempt")
+	b.vm.builderLog.Debug("recorded build attempt")
 
-	// Clear the pending flag and check if we need to schedule another build
+	// Clear the pending flag and check if we need to schedule another build.
+	// A scheduler waiting on the previous build recalculates its delay.
 	b.lock.Lock()
 	b.hasPendingTxs = false
+	b.buildGeneration++
 	b.lock.Unlock()
 
 	// If there are still transactions in mempool, schedule another build
 	if b.needToBuild() {
-		b.vm.ctx.Log.Info("handleBuildAttempt: more transactions pending, scheduling next build")
+		b.vm.builderLog.Info("handleBuildAttempt: more transactions pending, scheduling next build")
 		b.signalCanBuild()
 	}
 }
 
+// onPreferenceChanged records that blockID became the preferred block and
+// wakes the goroutines waiting for the building delay of the previous one, so
+// that they recalculate it against blockID
+func (b *blockBuilder) onPreferenceChanged(blockID ids.ID) {
+	b.buildBlockLock.Lock()
+	b.lastPreferenceTime = b.clock.Time()
+	b.buildBlockLock.Unlock()
+
+	b.lock.Lock()
+	close(b.preferenceSignal)
+	b.preferenceSignal = make(chan struct{})
+	// A pending signal is stale once the preferred block includes the
+	// transactions it was raised for
+	if b.hasPendingTxs && !b.needToBuild() {
+		b.hasPendingTxs = false
+	}
+	b.lock.Unlock()
+	b.vm.builderLog.Debug("preferred block changed", zap.Stringer("id", blockID))
+}
+
 // waitForNeedToBuild blocks until transactions are pending
 func (b *blockBuilder) waitForNeedToBuild(ctx context.Context) error {
 	b.lock.Lock()
-	defer b.lock.Unlock()
-
-	for !b.hasPendingTxs && !b.needToBuild() {
-		b.vm.ctx.Log.Debug("no transactions in mempool, waiting for signal")
-
-		// Create a channel that will be closed when the condition is signaled
-		signaled := make(chan struct{})
+	for !b.stopped && !b.hasPendingTxs && !b.needToBuild() {
+		b.vm.builderLog.Debug("no transactions in mempool, waiting for signal")
 
-		// Start a goroutine to wait on the condition variable
-		go func() {
-			b.lock.Lock()
-			defer b.lock.Unlock()
-			b.pendingSignal.Wait()
-			close(signaled)
-		}()
-
-		// Temporarily release the lock so the goroutine can acquire it
+		// The signal channel is read under lock, so a broadcast after the
+		// condition was checked closes this channel and can't be missed
+		signaled := b.pendingSignal
 		b.lock.Unlock()
 
-		// Wait for either the signal or context cancellation
 		select {
 		case <-signaled:
-			// Condition was signaled, re-acquire lock and check condition
-			b.lock.Lock()
-			// Continue loop to re-check the condition
-
+			// Re-check the condition
 		case <-ctx.Done():
-			// Context was cancelled, broadcast to wake up the waiting goroutine
-			b.pendingSignal.Broadcast()
-			// Wait for the goroutine to finish to prevent leak
-			<-signaled
-			// Re-acquire lock before returning
-			b.lock.Lock()
 			return ctx.Err()
-
 		case <-b.shutdownChan:
-			// Shutdown requested, broadcast to wake up the waiting goroutine
-			b.pendingSignal.Broadcast()
-			// Wait for the goroutine to finish to prevent leak
-			<-signaled
-			// Re-acquire lock before returning
-			b.lock.Lock()
 			return context.Canceled
 		}
+
+		b.lock.Lock()
 	}
+	defer b.lock.Unlock()
 
-	b.vm.ctx.Log.Debug("transactions available in mempool")
+	if b.stopped {
+		return context.Canceled
+	}
+
+	b.vm.builderLog.Debug("transactions available in mempool")
 	b.hasPendingTxs = false
 	return nil
 }
@@ -292,57 +544,106 @@ func (b *blockBuilder) waitForNeedToBuild(ctx context.Context) error {
 // waitForEvent waits for an event that requires block building
 // and returns the appropriate message to the Snowman engine
 func (b *blockBuilder) waitForEvent(ctx context.Context) (common.Message, error) {
-	b.vm.ctx.Log.Info("waitForEvent starting - waiting for transactions")
-
-	// STEP 1: Wait until transactions are available in mempool
-	if err := b.waitForNeedToBuild(ctx); err != nil {
-		b.vm.ctx.Log.Info("waitForEvent waitForNeedToBuild returned error", zap.Error(err))
-		return 0, err
+	if !b.enter() {
+		return 0, context.Canceled
 	}
+	defer b.wg.Done()
 
-	b.vm.ctx.Log.Info("waitForEvent transactions available, calculating delay")
+	b.vm.builderLog.Info("waitForEvent starting - waiting for transactions")
 
-	// STEP 2: Calculate delay based on last build time
-	currentBlock, err := b.vm.getCurrentBlock()
-	if err != nil {
-		b.vm.ctx.Log.Error("failed to get current block", zap.Error(err))
-		return 0, err
-	}
+	for {
+		// STEP 1: Wait until transactions are available in mempool. They may
+		// have been included in a block that became preferred while waiting
+		// for the delay, in which case there is nothing left to build.
+		if err := b.waitForNeedToBuild(ctx); err != nil {
+			b.vm.builderLog.Info("waitForEvent waitForNeedToBuild returned error", zap.Error(err))
+			return 0, err
+		}
 
-	delay := b.calculateBuildingDelay(*currentBlock.Hash())
-	b.vm.ctx.Log.Info("waitForEvent calculated delay", zap.Duration("delay", delay), zap.String("currentBlockHash", currentBlock.Hash().String()))
+		b.vm.builderLog.Info("waitForEvent transactions available, calculating delay")
 
-	// STEP 3: If no delay needed, return immediately
-	if delay <= 0 {
-		b.vm.ctx.Log.Info("waitForEvent no delay needed, returning PendingTxs immediately")
-		return common.PendingTxs, nil
-	}
+		b.lock.Lock()
+		preferenceChanged := b.preferenceSignal
+		b.lock.Unlock()
+
+		// STEP 2: Calculate delay based on last build time
+		currentBlock, err := b.vm.getCurrentBlock()
+		if err != nil {
+			b.vm.builderLog.Error("failed to get current block", zap.Error(err))
+			return 0, err
+		}
 
-	// STEP 4: Wait for delay period
-	b.vm.ctx.Log.Info("waitForEvent waiting for delay period", zap.Duration("delay", delay))
+		delay := b.calculateBuildingDelay(*currentBlock.Hash())
+		b.vm.builderLog.Info("waitForEvent calculated delay", zap.Duration("delay", delay), zap.String("currentBlockHash", currentBlock.Hash().String()))
+
+		// STEP 3: If no delay needed, return immediately. Requested blocks
+		// are built without delay.
+		if delay <= 0 || b.vm.generatePending() {
+			b.vm.builderLog.Info("waitForEvent no delay needed, returning PendingTxs immediately")
+			return common.PendingTxs, nil
+		}
 
-	timer := time.NewTimer(delay)
-	defer timer.Stop()
+		// STEP 4: Wait for delay period. If another block becomes preferred
+		// meanwhile, the delay is recalculated against it.
+		b.vm.builderLog.Info("waitForEvent waiting for delay period", zap.Duration("delay", delay))
 
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			b.vm.builderLog.Info("waitForEvent context cancelled", zap.Error(ctx.Err()))
+			return 0, ctx.Err()
+		case <-timer.C:
+			b.vm.builderLog.Info("waitForEvent delay elapsed, returning PendingTxs")
+			return common.PendingTxs, nil
+		case <-preferenceChanged:
+			timer.Stop()
+			b.vm.builderLog.Info("waitForEvent preferred block changed, recalculating delay")
+		case <-b.shutdownChan:
+			timer.Stop()
+			b.vm.builderLog.Info("waitForEvent shutdown signal received")
+			return 0, context.Canceled
+		}
+	}
+}
+
+// signalGenerate notifies the engine that a block was requested through the
+// generatetoaddress RPC
+func (b *blockBuilder) signalGenerate() {
+	b.lock.Lock()
+	if b.stopped {
+		b.lock.Unlock()
+		return
+	}
+	b.broadcastLocked()
+	b.lock.Unlock()
+
+	// Dropped notifications are not retried here, as generateToAddress
+	// signals again until the requested block is accepted
+	if b.waitForEventOnly {
+		return
+	}
 	select {
-	case <-ctx.Done():
-		b.vm.ctx.Log.Info("waitForEvent context cancelled", zap.Error(ctx.Err()))
-		return 0, ctx.Err()
-	case <-timer.C:
-		b.vm.ctx.Log.Info("waitForEvent delay elapsed, returning PendingTxs")
-		return common.PendingTxs, nil
-	case <-b.shutdownChan:
-		b.vm.ctx.Log.Info("waitForEvent shutdown signal received")
-		return 0, context.Canceled
+	case b.vm.toEngine <- common.PendingTxs:
+	default:
+		b.metrics.notificationsDropped.Inc()
+		b.vm.builderLog.Debug("signalGenerate failed to notify engine (channel full)")
 	}
 }
 
-// clearPendingSignal resets the pending transaction flag
+// clearPendingSignal resets the pending transaction flag and records that the
+// last build attempt succeeded
 // Called after a block is successfully built
 func (b *blockBuilder) clearPendingSignal() {
+	b.buildBlockLock.Lock()
+	b.lastBuildSucceeded = true
+	b.buildBlockLock.Unlock()
+
+	// A scheduler that calculated its delay while the block was being built
+	// recalculates it
 	b.lock.Lock()
 	b.hasPendingTxs = false
+	b.buildGeneration++
 	b.lock.Unlock()
-	b.vm.ctx.Log.Debug("cleared pending transaction signal")
+	b.vm.builderLog.Debug("cleared pending transaction signal")
 }
-
@@ -0,0 +1,93 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// builderMetrics tracks the block building pipeline: how long templates take
+// to generate, how large the built blocks are, how often the engine could not
+// be notified and the notification was retried, how often builds are retried on the same parent and how often
+// the times of built blocks are clamped
+type builderMetrics struct {
+	templateDuration     prometheus.Histogram
+	blockTxs             prometheus.Histogram
+	blockBytes           prometheus.Histogram
+	notificationsDropped prometheus.Counter
+	notificationRetries  prometheus.Counter
+	buildRetries         prometheus.Counter
+	clampedBlockTimes    *prometheus.CounterVec
+}
+
+// newBuilderMetrics creates the block builder metrics and registers them under
+// namespace
+func newBuilderMetrics(registerer prometheus.Registerer, namespace string) (*builderMetrics, error) {
+	m := &builderMetrics{
+		templateDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "template_duration",
+			Help:      "time in seconds taken to generate a block template",
+			Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}),
+		blockTxs: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "block_txs",
+			Help:      "number of transactions, including the coinbase, in built blocks",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+		}),
+		blockBytes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "block_bytes",
+			Help:      "serialized size in bytes of built blocks",
+			Buckets:   prometheus.ExponentialBuckets(256, 4, 8),
+		}),
+		notificationsDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "notifications_dropped",
+			Help:      "number of engine notifications dropped because the channel was full",
+		}),
+		notificationRetries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "notification_retries",
+			Help:      "number of retries of engine notifications dropped because the channel was full",
+		}),
+		buildRetries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "build_retries",
+			Help:      "number of builds on the parent of a failed build",
+		}),
+		clampedBlockTimes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "clamped_block_times",
+			Help:      "number of built blocks whose time was clamped to a second after their parent or to the maximum drift ahead of it",
+		}, []string{"bound"}),
+	}
+
+	for _, collector := range []prometheus.Collector{
+		m.templateDuration,
+		m.blockTxs,
+		m.blockBytes,
+		m.notificationsDropped,
+		m.notificationRetries,
+		m.buildRetries,
+		m.clampedBlockTimes,
+	} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, fmt.Errorf("failed to register block builder metrics: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// observeBuild records a block built from a template generated in
+// templateDuration, with numTxs transactions and size bytes
+func (m *builderMetrics) observeBuild(templateDuration time.Duration, numTxs int, size int) {
+	m.templateDuration.Observe(templateDuration.Seconds())
+	m.blockTxs.Observe(float64(numTxs))
+	m.blockBytes.Observe(float64(size))
+}
@@ -0,0 +1,764 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/utils/timer/mockable"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdownWithPendingBuild(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMs(t, 1, key)[0]
+	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+
+	// A build was just attempted on another parent, so the next build is
+	// scheduled after the target block time
+	builder := vm.blockBuilder
+	builder.handleBuildAttempt(chainhash.Hash{})
+	builder.signalCanBuild()
+
+	waitErr := make(chan error, 1)
+	go func() {
+		_, err := vm.WaitForEvent(ctx)
+		waitErr <- err
+	}()
+
+	start := time.Now()
+	require.NoError(vm.Shutdown(ctx))
+	require.Less(time.Since(start), TargetBlockTime)
+	require.ErrorIs(<-waitErr, context.Canceled)
+
+	// Entry points called after shutdown return without touching the adapter
+	builder.signalCanBuild()
+	builder.signalGenerate()
+	builder.handleBuildAttempt(chainhash.Hash{})
+	_, err = vm.WaitForEvent(ctx)
+	require.ErrorIs(err, context.Canceled)
+
+	// Every goroutine started by the VM and its block builder has exited
+	require.Eventually(func() bool {
+		return vmGoroutines() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestWaitForNeedToBuildStress(t *testing.T) {
+	const (
+		numSignalers = 8
+		numWaiters   = 8
+		numRounds    = 200
+	)
+
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMs(t, 1, key)[0]
+	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+	builder := vm.blockBuilder
+	numVMGoroutines := vmGoroutines()
+
+	var wg sync.WaitGroup
+	for i := 0; i < numSignalers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tx := btcutil.NewTx(wire.NewMsgTx(wire.TxVersion))
+			for j := 0; j < numRounds; j++ {
+				builder.onTxAccepted(tx)
+			}
+		}()
+	}
+	for i := 0; i < numWaiters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < numRounds; j++ {
+				ctx, cancel := context.WithTimeout(ctx, time.Duration(j%3)*time.Millisecond)
+				err := builder.waitForNeedToBuild(ctx)
+				cancel()
+				if err != nil {
+					require.ErrorIs(err, context.DeadlineExceeded)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Cancelled waits leave no goroutines behind
+	require.Eventually(func() bool {
+		return len(builder.txSubmitChan) == 0 && vmGoroutines() <= numVMGoroutines
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Consume any pending signal, then check that a waiter blocks until the
+	// next signal and that signals coalesce into a single wake up. The build
+	// attempt delays the scheduled builds, which would otherwise clear the
+	// signal as the mempool is empty.
+	builder.handleBuildAttempt(chainhash.Hash{})
+	waitErr := make(chan error, numWaiters)
+	for i := 0; i < 2; i++ {
+		go func() {
+			waitErr <- builder.waitForNeedToBuild(ctx)
+		}()
+	}
+	select {
+	case err := <-waitErr:
+		require.FailNow("waiter woke up without a signal", "err: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	builder.signalCanBuild()
+	builder.signalCanBuild()
+	require.NoError(<-waitErr)
+	select {
+	case err := <-waitErr:
+		require.FailNow("coalesced signals woke up two waiters", "err: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	builder.signalCanBuild()
+	require.NoError(<-waitErr)
+}
+
+func TestScheduleBlockBuildNotifiesOnce(t *testing.T) {
+	const (
+		numTxs    = 100
+		batchSize = 10
+	)
+
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMs(t, 1, key)[0]
+	mempool := vm.btcdAdapter.TxMemPool()
+
+	start := time.Now()
+	toEngine := make(chan common.Message, 2*numTxs)
+	vm.toEngine = toEngine
+	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+
+	buildBlock := func() *BlockAdapter {
+		blk, err := vm.BuildBlock(ctx)
+		require.NoError(err)
+		require.NoError(blk.Verify(ctx))
+		require.NoError(vm.SetPreference(ctx, blk.ID()))
+		require.NoError(blk.Accept(ctx))
+		return blk.(*BlockAdapter)
+	}
+
+	// Fund numTxs outputs paying key
+	coinbase := buildBlock().btcBlock.Transactions()[0].MsgTx()
+	split := newTestSplitTx(t, key, coinbase, 0, numTxs)
+	_, err = mempool.ProcessTransaction(split, false, false, 0)
+	require.NoError(err)
+	buildBlock()
+
+	// Accept the transactions in batches, building a block after each batch
+	// but the last as if the engine built them on its own schedule
+	for i := 0; i < numTxs; i++ {
+		spend := newTestSplitTx(t, key, split.MsgTx(), uint32(i), 1)
+		_, err := mempool.ProcessTransaction(spend, false, false, 0)
+		require.NoError(err)
+
+		if (i+1)%batchSize == 0 && i+1 < numTxs {
+			// Wait for the builder to see the transactions
+			require.Eventually(func() bool {
+				return len(vm.blockBuilder.txSubmitChan) == 0
+			}, 5*time.Second, time.Millisecond)
+			require.Len(buildBlock().btcBlock.Transactions(), batchSize+1)
+		}
+	}
+
+	// The engine is notified at most once per target block time, rather than
+	// once per batch
+	var (
+		numNotifications int
+		lastNotification time.Time
+	)
+	for done := false; !done; {
+		select {
+		case msg := <-toEngine:
+			require.Equal(common.PendingTxs, msg)
+			numNotifications++
+			lastNotification = time.Now()
+		case <-time.After(2 * TargetBlockTime):
+			done = true
+		}
+	}
+	require.Positive(numNotifications)
+	require.LessOrEqual(numNotifications, 1+int(lastNotification.Sub(start)/TargetBlockTime))
+}
+
+func TestNotifyEngineRetry(t *testing.T) {
+	require := require.New(t)
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMs(t, 1, key)[0]
+	toEngine := make(chan common.Message, 1)
+	vm.toEngine = toEngine
+	builder := vm.blockBuilder
+	dropped := func() int {
+		return int(testutil.ToFloat64(builder.metrics.notificationsDropped))
+	}
+	generation := func() uint64 {
+		builder.lock.Lock()
+		defer builder.lock.Unlock()
+		return builder.buildGeneration
+	}
+
+	// A transaction is pending
+	buildTestChain(t, vm, 1)
+	blk, err := vm.GetBlock(context.Background(), vm.lastAccepted)
+	require.NoError(err)
+	spend := newTestSpend(t, key, blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx())
+	_, err = vm.btcdAdapter.TxMemPool().ProcessTransaction(spend, false, false, 0)
+	require.NoError(err)
+
+	// Notifications dropped because the channel is full are retried until
+	// the channel has room
+	toEngine <- common.PendingTxs
+	notified := make(chan bool, 1)
+	go func(generation uint64) {
+		notified <- builder.notifyEngine(generation)
+	}(generation())
+	require.Eventually(func() bool {
+		return dropped() >= 4
+	}, 5*time.Second, time.Millisecond)
+	require.Equal(common.PendingTxs, <-toEngine)
+	require.True(<-notified)
+	require.Equal(common.PendingTxs, <-toEngine)
+	require.Equal(float64(dropped()), testutil.ToFloat64(builder.metrics.notificationRetries))
+
+	// Retries stop once a block is built
+	toEngine <- common.PendingTxs
+	go func(generation uint64) {
+		notified <- builder.notifyEngine(generation)
+	}(generation())
+	start := dropped()
+	require.Eventually(func() bool {
+		return dropped() > start
+	}, 5*time.Second, time.Millisecond)
+	builder.clearPendingSignal()
+	require.False(<-notified)
+	require.Len(toEngine, 1)
+
+	// Retries stop once nothing is left to build
+	go func(generation uint64) {
+		notified <- builder.notifyEngine(generation)
+	}(generation())
+	start = dropped()
+	require.Eventually(func() bool {
+		return dropped() > start
+	}, 5*time.Second, time.Millisecond)
+	vm.btcdAdapter.TxMemPool().RemoveTransaction(spend, true)
+	require.False(<-notified)
+	require.Len(toEngine, 1)
+}
+
+func TestBuilderMetrics(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMs(t, 1, key)[0]
+	metrics := vm.blockBuilder.metrics
+
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	btcBlock := blk.(*BlockAdapter).btcBlock
+	require.Equal(1, testutil.CollectAndCount(metrics.templateDuration))
+	require.Equal(1, testutil.CollectAndCount(metrics.blockTxs))
+	require.Zero(testutil.ToFloat64(metrics.buildRetries))
+	families, err := vm.metrics.Gather()
+	require.NoError(err)
+	sums := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			sums[family.GetName()] += metric.GetHistogram().GetSampleSum()
+		}
+	}
+	require.Equal(float64(len(btcBlock.Transactions())), sums["block_builder_block_txs"])
+	require.Equal(float64(btcBlock.MsgBlock().SerializeSize()), sums["block_builder_block_bytes"])
+
+	// Failed builds are retried on the same parent
+	parent := chainhash.Hash{1}
+	vm.blockBuilder.handleBuildAttempt(parent)
+	vm.blockBuilder.handleBuildAttempt(parent)
+	require.Equal(float64(1), testutil.ToFloat64(metrics.buildRetries))
+}
+
+func TestBuildingDelay(t *testing.T) {
+	lastBuildTime := time.Unix(1_000, 0)
+	tests := []struct {
+		name          string
+		now           time.Time
+		lastBuildTime time.Time
+		isRetry       bool
+		stagger       time.Duration
+		want          time.Duration
+	}{
+		{
+			name:    "first build",
+			now:     lastBuildTime,
+			isRetry: true,
+			want:    0,
+		},
+		{
+			name:          "normal build at last build",
+			now:           lastBuildTime,
+			lastBuildTime: lastBuildTime,
+			want:          TargetBlockTime,
+		},
+		{
+			name:          "normal build during target block time",
+			now:           lastBuildTime.Add(TargetBlockTime / 4),
+			lastBuildTime: lastBuildTime,
+			want:          3 * TargetBlockTime / 4,
+		},
+		{
+			name:          "normal build at target block time",
+			now:           lastBuildTime.Add(TargetBlockTime),
+			lastBuildTime: lastBuildTime,
+			want:          0,
+		},
+		{
+			name:          "normal build after target block time",
+			now:           lastBuildTime.Add(time.Hour),
+			lastBuildTime: lastBuildTime,
+			want:          0,
+		},
+		{
+			name:          "staggered build during target block time",
+			now:           lastBuildTime.Add(TargetBlockTime / 4),
+			lastBuildTime: lastBuildTime,
+			stagger:       TargetBlockTime / 2,
+			want:          5 * TargetBlockTime / 4,
+		},
+		{
+			name:          "staggered build after target block time",
+			now:           lastBuildTime.Add(time.Hour),
+			lastBuildTime: lastBuildTime,
+			stagger:       TargetBlockTime / 2,
+			want:          TargetBlockTime / 2,
+		},
+		{
+			name:    "staggered first build",
+			now:     lastBuildTime,
+			stagger: TargetBlockTime / 2,
+			want:    TargetBlockTime / 2,
+		},
+		{
+			name:          "staggered retry",
+			now:           lastBuildTime,
+			lastBuildTime: lastBuildTime,
+			isRetry:       true,
+			stagger:       TargetBlockTime / 2,
+			want:          RetryDelay,
+		},
+		{
+			name:          "retry at last build",
+			now:           lastBuildTime,
+			lastBuildTime: lastBuildTime,
+			isRetry:       true,
+			want:          RetryDelay,
+		},
+		{
+			name:          "retry during retry delay",
+			now:           lastBuildTime.Add(RetryDelay / 4),
+			lastBuildTime: lastBuildTime,
+			isRetry:       true,
+			want:          3 * RetryDelay / 4,
+		},
+		{
+			name:          "retry after retry delay",
+			now:           lastBuildTime.Add(RetryDelay),
+			lastBuildTime: lastBuildTime,
+			isRetry:       true,
+			want:          0,
+		},
+		{
+			name:          "normal build with clock skewed backwards",
+			now:           lastBuildTime.Add(-time.Hour),
+			lastBuildTime: lastBuildTime,
+			want:          TargetBlockTime,
+		},
+		{
+			name:          "retry with clock skewed backwards",
+			now:           lastBuildTime.Add(-time.Nanosecond),
+			lastBuildTime: lastBuildTime,
+			isRetry:       true,
+			want:          RetryDelay,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.want, buildingDelay(test.now, test.lastBuildTime, test.isRetry, test.stagger))
+		})
+	}
+}
+
+func TestBuilderClock(t *testing.T) {
+	require := require.New(t)
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMs(t, 1, key)[0]
+	clock := &mockable.Clock{}
+	clock.Set(time.Unix(1_000, 0))
+	builder := vm.blockBuilder
+	builder.clock = clock
+
+	// A failed build on parent is retried on it after the retry delay, and
+	// builds on other parents wait for the target block time
+	parent := chainhash.Hash{1}
+	builder.handleBuildAttempt(parent)
+	require.Equal(RetryDelay, builder.calculateBuildingDelay(parent))
+	require.Equal(TargetBlockTime, builder.calculateBuildingDelay(chainhash.Hash{2}))
+
+	clock.Set(clock.Time().Add(RetryDelay / 2))
+	require.Equal(RetryDelay/2, builder.calculateBuildingDelay(parent))
+	require.Equal(TargetBlockTime-RetryDelay/2, builder.calculateBuildingDelay(chainhash.Hash{2}))
+
+	// A successful build is not retried
+	builder.clearPendingSignal()
+	require.Equal(TargetBlockTime-RetryDelay/2, builder.calculateBuildingDelay(parent))
+
+	clock.Set(clock.Time().Add(TargetBlockTime))
+	require.Zero(builder.calculateBuildingDelay(parent))
+
+	// The clock going back before the last build doesn't extend the delay
+	// past the target block time
+	clock.Set(time.Unix(0, 0))
+	require.Equal(TargetBlockTime, builder.calculateBuildingDelay(parent))
+}
+
+func TestBuildStagger(t *testing.T) {
+	require := require.New(t)
+
+	// The stagger is bounded by the target block time, and the order of the
+	// validators changes with the parent
+	nodeIDs := []ids.NodeID{ids.GenerateTestNodeID(), ids.GenerateTestNodeID(), ids.GenerateTestNodeID()}
+	first := make(map[ids.NodeID]bool)
+	for i := 0; i < 100; i++ {
+		parent := chainhash.Hash{byte(i), byte(i >> 8)}
+		var earliest ids.NodeID
+		earliestStagger := TargetBlockTime
+		for _, nodeID := range nodeIDs {
+			stagger := buildStagger(parent, nodeID)
+			require.GreaterOrEqual(stagger, time.Duration(0))
+			require.Less(stagger, TargetBlockTime)
+			require.Equal(stagger, buildStagger(parent, nodeID))
+			if stagger < earliestStagger {
+				earliest, earliestStagger = nodeID, stagger
+			}
+		}
+		first[earliest] = true
+	}
+	require.Len(first, len(nodeIDs))
+
+	// The builder delays its builds by its stagger once enabled
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMs(t, 1, key)[0]
+	clock := &mockable.Clock{}
+	clock.Set(time.Unix(1_000, 0))
+	builder := vm.blockBuilder
+	builder.clock = clock
+	builder.handleBuildAttempt(chainhash.Hash{1})
+	builder.clearPendingSignal()
+	parent := chainhash.Hash{2}
+	require.Equal(TargetBlockTime, builder.calculateBuildingDelay(parent))
+	builder.staggered = true
+	require.Equal(TargetBlockTime+buildStagger(parent, vm.ctx.NodeID), builder.calculateBuildingDelay(parent))
+}
+
+func TestStaggeredBuildingTakesTurns(t *testing.T) {
+	require := require.New(t)
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vms := newTestVMsWithConfig(t, 3, key, "", []byte(`{"staggeredBuilding":true}`))
+	clock := &mockable.Clock{}
+	clock.Set(time.Unix(1_000, 0))
+
+	// Every builder built on the previous parent at the same time, as when
+	// they all raced for the last block
+	for _, vm := range vms {
+		require.True(vm.blockBuilder.staggered)
+		vm.blockBuilder.clock = clock
+		vm.blockBuilder.handleBuildAttempt(chainhash.Hash{1})
+		vm.blockBuilder.clearPendingSignal()
+	}
+
+	// The builder with the smallest stagger on the new parent is designated
+	// to build on it first
+	parent := chainhash.Hash{2}
+	designated := vms[0]
+	for _, vm := range vms[1:] {
+		if buildStagger(parent, vm.ctx.NodeID) < buildStagger(parent, designated.ctx.NodeID) {
+			designated = vm
+		}
+	}
+	designatedStagger := buildStagger(parent, designated.ctx.NodeID)
+
+	// Once the target block time passed, every builder waits for its slot,
+	// the designated builder the least
+	clock.Set(clock.Time().Add(TargetBlockTime))
+	require.Equal(designatedStagger, designated.blockBuilder.calculateBuildingDelay(parent))
+	for _, vm := range vms {
+		if vm == designated {
+			continue
+		}
+		stagger := buildStagger(parent, vm.ctx.NodeID)
+		require.Greater(stagger, designatedStagger)
+		require.Equal(stagger, vm.blockBuilder.calculateBuildingDelay(parent))
+	}
+
+	// The block of the designated builder becomes preferred before the slot
+	// of the others, which then wait for their slot on it rather than build
+	// a sibling of it
+	clock.Set(clock.Time().Add(designatedStagger))
+	next := chainhash.Hash{3}
+	for _, vm := range vms {
+		if vm == designated {
+			continue
+		}
+		vm.blockBuilder.onPreferenceChanged(ids.GenerateTestID())
+		require.Equal(TargetBlockTime+buildStagger(next, vm.ctx.NodeID), vm.blockBuilder.calculateBuildingDelay(next))
+	}
+}
+
+func TestWaitForEventOnly(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	// The engine relies on WaitForEvent alone, without a channel to notify
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithEngine(t, 1, key, "", "", nil, false)[0]
+	builder := vm.blockBuilder
+	require.True(builder.waitForEventOnly)
+	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+
+	buildTestChain(t, vm, 1)
+	blk, err := vm.GetBlock(ctx, vm.lastAccepted)
+	require.NoError(err)
+	spend := newTestSpend(t, key, blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx())
+	_, err = vm.btcdAdapter.TxMemPool().ProcessTransaction(spend, false, false, 0)
+	require.NoError(err)
+
+	// The pending transaction is built into a block through WaitForEvent,
+	// without scheduling or dropping notifications
+	waitCtx, cancel := context.WithTimeout(ctx, 5*TargetBlockTime)
+	defer cancel()
+	msg, err := vm.WaitForEvent(waitCtx)
+	require.NoError(err)
+	require.Equal(common.PendingTxs, msg)
+	builder.lock.Lock()
+	require.False(builder.buildScheduled)
+	builder.lock.Unlock()
+	require.False(builder.notifyEngine(0))
+	builder.signalGenerate()
+	require.Zero(testutil.ToFloat64(builder.metrics.notificationsDropped))
+
+	built, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(built.Verify(ctx))
+	require.NoError(vm.SetPreference(ctx, built.ID()))
+	require.NoError(built.Accept(ctx))
+	require.Equal(spend.Hash(), built.(*BlockAdapter).btcBlock.Transactions()[1].Hash())
+	require.False(vm.btcdAdapter.TxMemPool().HaveTransaction(spend.Hash()))
+}
+
+func TestWaitForEventWithChannel(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMs(t, 1, key)[0]
+	require.False(vm.blockBuilder.waitForEventOnly)
+	toEngine := make(chan common.Message, 1)
+	vm.toEngine = toEngine
+	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+
+	buildTestChain(t, vm, 1)
+	blk, err := vm.GetBlock(ctx, vm.lastAccepted)
+	require.NoError(err)
+	spend := newTestSpend(t, key, blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx())
+	_, err = vm.btcdAdapter.TxMemPool().ProcessTransaction(spend, false, false, 0)
+	require.NoError(err)
+
+	// The engine is notified on the channel and by WaitForEvent alike
+	waitCtx, cancel := context.WithTimeout(ctx, 5*TargetBlockTime)
+	defer cancel()
+	msg, err := vm.WaitForEvent(waitCtx)
+	require.NoError(err)
+	require.Equal(common.PendingTxs, msg)
+	select {
+	case msg := <-toEngine:
+		require.Equal(common.PendingTxs, msg)
+	case <-waitCtx.Done():
+		require.FailNow("engine not notified on the channel")
+	}
+}
+
+// vmGoroutines returns the number of goroutines running VM code, other than
+// the calling goroutine
+func vmGoroutines() int {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	// The first goroutine in the dump is the calling goroutine
+	stacks := strings.Split(string(buf), "\n\n")[1:]
+	count := 0
+	for _, stack := range stacks {
+		if strings.Contains(stack, "btcvm/vm.(*") {
+			count++
+		}
+	}
+	return count
+}
+
+func TestBuildBlockRacingGossip(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vms := newTestVMs(t, 2, key)
+	builder, peer := vms[0], vms[1]
+	for _, vm := range vms {
+		require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+		require.NoError(vm.SetState(ctx, snow.NormalOp))
+	}
+
+	buildTestChain(t, peer, 1)
+	tip, err := peer.getCurrentBlock()
+	require.NoError(err)
+	status, err := builder.btcSet.SubmitBlock(tip)
+	require.NoError(err)
+	require.Equal(blockStatusPending, status)
+
+	// Each round, the peer builds a block spending a transaction of the
+	// mempool of the builder, and gossips it while the builder builds
+	const rounds = 20
+	for i := 0; i < rounds; i++ {
+		spend := newTestSpend(t, key, tip.Transactions()[0].MsgTx())
+		require.NoError(peer.btcSet.Add(NewTxGossip(spend)))
+		require.NoError(builder.btcSet.Add(NewTxGossip(spend)))
+		buildTestChain(t, peer, 1)
+		gossiped, err := peer.getCurrentBlock()
+		require.NoError(err)
+		require.Len(gossiped.Transactions(), 2)
+
+		var (
+			wg        sync.WaitGroup
+			submitErr error
+		)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, submitErr = builder.btcSet.SubmitBlock(gossiped)
+		}()
+		built, err := builder.BuildBlock(ctx)
+		wg.Wait()
+		require.NoError(submitErr)
+		require.Equal(blockStatusPending, status)
+
+		// A block built on the tip stays the tip, whether it extends the
+		// gossiped block or the gossiped block became its sibling. It is
+		// then discarded so that the builder follows the peer.
+		if !errors.Is(err, ErrStaleParent) {
+			require.NoError(err)
+			builtHash := built.(*BlockAdapter).btcBlock.Hash()
+			require.Equal(*builtHash, builder.chain.BestSnapshot().Hash)
+			require.NoError(builder.chain.InvalidateBlock(builtHash))
+		}
+		require.Equal(*gossiped.Hash(), builder.chain.BestSnapshot().Hash)
+		require.False(builder.btcdAdapter.TxMemPool().HaveTransaction(spend.Hash()))
+		tip = gossiped
+	}
+	require.Zero(builder.buildFailures.streak)
+}
+
+func TestBuildBlockStaleParent(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vms := newTestVMs(t, 2, key)
+	builder, peer := vms[0], vms[1]
+	buildTestChain(t, peer, 1)
+	gossiped, err := peer.getCurrentBlock()
+	require.NoError(err)
+
+	// The gossiped block connects once the builder read its parent, but
+	// before it built the block
+	parent, err := builder.getCurrentBlock()
+	require.NoError(err)
+	builder.processLock.Lock()
+	buildErr := make(chan error, 1)
+	go func() {
+		_, err := builder.BuildBlock(ctx)
+		buildErr <- err
+	}()
+	require.Eventually(func() bool {
+		builder.blockBuilder.buildBlockLock.Lock()
+		defer builder.blockBuilder.buildBlockLock.Unlock()
+		return builder.blockBuilder.lastBuildParentHash.IsEqual(parent.Hash())
+	}, time.Second, time.Millisecond)
+	isMainChain, _, err := builder.chain.ProcessBlock(gossiped, blockchain.BFNone)
+	require.NoError(err)
+	require.True(isMainChain)
+	builder.processLock.Unlock()
+
+	// The build is retried on the new tip without counting as a failure
+	require.ErrorIs(<-buildErr, ErrStaleParent)
+	require.Zero(builder.buildFailures.streak)
+	require.Equal(float64(1), testutil.ToFloat64(builder.buildFailures.failures.WithLabelValues(buildCauseStale)))
+
+	built, err := builder.BuildBlock(ctx)
+	require.NoError(err)
+	require.Equal(hashToID(gossiped.Hash()), built.Parent())
+}
@@ -0,0 +1,99 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/MetalBlockchain/metalgo/snow/consensus/snowman"
+	"github.com/MetalBlockchain/metalgo/snow/engine/snowman/block"
+)
+
+var (
+	_ block.BuildBlockWithContextChainVM = (*VM)(nil)
+	_ block.WithVerifyContext            = (*BlockAdapter)(nil)
+
+	// pChainHeightMagic prefixes the P-chain height committed in an
+	// OP_RETURN output of the coinbase of blocks built with a context
+	pChainHeightMagic = []byte("btcvm/pchain")
+
+	errPChainHeightMismatch = errors.New("P-chain height mismatch")
+)
+
+// pChainHeightScript returns the coinbase output script committing to
+// pChainHeight
+func pChainHeightScript(pChainHeight uint64) ([]byte, error) {
+	data := make([]byte, len(pChainHeightMagic)+8)
+	copy(data, pChainHeightMagic)
+	binary.BigEndian.PutUint64(data[len(pChainHeightMagic):], pChainHeight)
+	return txscript.NullDataScript(data)
+}
+
+// commitPChainHeight adds an output committing to pChainHeight to the
+// coinbase of msgBlock and updates its merkle root
+func commitPChainHeight(msgBlock *wire.MsgBlock, pChainHeight uint64) error {
+	pkScript, err := pChainHeightScript(pChainHeight)
+	if err != nil {
+		return fmt.Errorf("failed to create P-chain height commitment: %w", err)
+	}
+	msgBlock.Transactions[0].AddTxOut(wire.NewTxOut(0, pkScript))
+
+	block := btcutil.NewBlock(msgBlock)
+	msgBlock.Header.MerkleRoot = blockchain.CalcMerkleRoot(block.Transactions(), false)
+	return nil
+}
+
+// committedPChainHeight returns the P-chain height committed in the coinbase
+// of block, and false if the block was built without a context
+func committedPChainHeight(block *btcutil.Block) (uint64, bool) {
+	transactions := block.MsgBlock().Transactions
+	if len(transactions) == 0 {
+		return 0, false
+	}
+	for _, txOut := range transactions[0].TxOut {
+		if txscript.GetScriptClass(txOut.PkScript) != txscript.NullDataTy {
+			continue
+		}
+		pushes, err := txscript.PushedData(txOut.PkScript)
+		if err != nil || len(pushes) != 1 {
+			continue
+		}
+		data := pushes[0]
+		if len(data) != len(pChainHeightMagic)+8 || !bytes.HasPrefix(data, pChainHeightMagic) {
+			continue
+		}
+		return binary.BigEndian.Uint64(data[len(pChainHeightMagic):]), true
+	}
+	return 0, false
+}
+
+// BuildBlockWithContext builds a block committing to the P-chain height of
+// blockCtx
+func (vm *VM) BuildBlockWithContext(ctx context.Context, blockCtx *block.Context) (snowman.Block, error) {
+	return vm.buildBlock(ctx, blockCtx)
+}
+
+// ShouldVerifyWithContext returns true if the block was built with a context.
+// Blocks built without one are verified by Verify.
+func (b *BlockAdapter) ShouldVerifyWithContext(context.Context) (bool, error) {
+	return b.hasPChainHeight, nil
+}
+
+// VerifyWithContext verifies the block and that it commits to the P-chain
+// height of blockCtx
+func (b *BlockAdapter) VerifyWithContext(ctx context.Context, blockCtx *block.Context) error {
+	if b.hasPChainHeight && b.pChainHeight != blockCtx.PChainHeight {
+		return fmt.Errorf("%w: block commits to %d but context has %d",
+			errPChainHeightMismatch, b.pChainHeight, blockCtx.PChainHeight)
+	}
+	return b.Verify(ctx)
+}
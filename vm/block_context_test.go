@@ -0,0 +1,62 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/metalgo/snow/engine/snowman/block"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildBlockWithContext(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+
+	vms := newTestVMs(t, 2, key)
+	server, client := vms[0], vms[1]
+
+	// The P-chain height is committed in the block
+	blk, err := server.BuildBlockWithContext(ctx, &block.Context{PChainHeight: 42})
+	require.NoError(err)
+	withContext := blk.(block.WithVerifyContext)
+	shouldVerify, err := withContext.ShouldVerifyWithContext(ctx)
+	require.NoError(err)
+	require.True(shouldVerify)
+	require.NoError(withContext.VerifyWithContext(ctx, &block.Context{PChainHeight: 42}))
+
+	// Other nodes read it back from the block bytes
+	parsed, err := client.ParseBlock(ctx, blk.Bytes())
+	require.NoError(err)
+	require.Equal(blk.ID(), parsed.ID())
+	parsedWithContext := parsed.(block.WithVerifyContext)
+	shouldVerify, err = parsedWithContext.ShouldVerifyWithContext(ctx)
+	require.NoError(err)
+	require.True(shouldVerify)
+	require.Equal(uint64(42), parsed.(*BlockAdapter).pChainHeight)
+
+	err = parsedWithContext.VerifyWithContext(ctx, &block.Context{PChainHeight: 43})
+	require.ErrorIs(err, errPChainHeightMismatch)
+	require.NoError(parsedWithContext.VerifyWithContext(ctx, &block.Context{PChainHeight: 42}))
+
+	require.NoError(server.SetPreference(ctx, blk.ID()))
+	require.NoError(blk.Accept(ctx))
+	require.NoError(client.SetPreference(ctx, parsed.ID()))
+	require.NoError(parsed.Accept(ctx))
+
+	// Blocks built without a context are verified without one
+	blk, err = server.BuildBlock(ctx)
+	require.NoError(err)
+	parsed, err = client.ParseBlock(ctx, blk.Bytes())
+	require.NoError(err)
+	shouldVerify, err = parsed.(block.WithVerifyContext).ShouldVerifyWithContext(ctx)
+	require.NoError(err)
+	require.False(shouldVerify)
+	require.NoError(parsed.Verify(ctx))
+}
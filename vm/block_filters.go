@@ -0,0 +1,501 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil/gcs/builder"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/MetalBlockchain/metalgo/database"
+	"github.com/MetalBlockchain/metalgo/database/prefixdb"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/network/p2p"
+	"github.com/MetalBlockchain/metalgo/network/p2p/gossip"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"go.uber.org/zap"
+)
+
+const (
+	// BlockFilterHandlerID is the handler ID used to serve the compact
+	// filters of accepted blocks to peers
+	BlockFilterHandlerID = 104
+
+	// blockFilterTargetResponseSize bounds the size of a filters response.
+	// The filters of the remaining blocks of the range are requested again.
+	blockFilterTargetResponseSize = 1024 * 1024
+)
+
+// blockFilterRequestType identifies the kind of block filter request
+type blockFilterRequestType byte
+
+const (
+	// blockFiltersRequest asks for the filters of a range of blocks. The
+	// payload is a getcfilters message.
+	blockFiltersRequest blockFilterRequestType = 0x01
+
+	// blockFilterHeadersRequest asks for the filter hashes of a range of
+	// blocks and the filter header preceding them. The payload is a
+	// getcfheaders message.
+	blockFilterHeadersRequest blockFilterRequestType = 0x02
+)
+
+var (
+	blockFilterPrefix = []byte("blockFilters")
+
+	errNoBlockFilter         = errors.New("no filter for block")
+	errUnknownFilterType     = errors.New("unknown filter type")
+	errMainChainChanged      = errors.New("main chain changed while building filters")
+	errInvalidFilterResponse = errors.New("invalid filter response")
+
+	_ p2p.Handler = (*blockFilterHandler)(nil)
+)
+
+// initializeBlockFilters opens the filter database, builds the filters of
+// the accepted blocks that do not have one and registers the handler serving
+// them to peers
+func (vm *VM) initializeBlockFilters() error {
+	vm.blockFilterDB = prefixdb.New(blockFilterPrefix, vm.db)
+	vm.btcdAdapter.SetBlockFilters(vm.blockFilterRPC, vm.cfHeadersRPC)
+
+	numBuilt, err := vm.indexBlockFilters(idToHash(vm.lastAccepted))
+	if err != nil {
+		// Filters cannot be built for blocks whose data is not available,
+		// such as the blocks below a state sync summary
+		vm.ctx.Log.Warn("Block filters unavailable",
+			zap.Error(err))
+		vm.blockFiltersUnavailable = true
+	} else if numBuilt > 0 {
+		vm.ctx.Log.Info("Built block filters",
+			zap.Int("numBlocks", numBuilt))
+	}
+
+	handler := &blockFilterHandler{
+		log:                vm.ctx.Log,
+		vm:                 vm,
+		targetResponseSize: blockFilterTargetResponseSize,
+	}
+	if err := vm.p2pNetwork.AddHandler(BlockFilterHandlerID, handler); err != nil {
+		return fmt.Errorf("failed to register block filter handler: %w", err)
+	}
+	vm.blockFilterClient = vm.p2pNetwork.NewClient(BlockFilterHandlerID)
+	vm.ctx.Log.Info("Registered block filter handler",
+		zap.Uint64("handlerID", BlockFilterHandlerID))
+	return nil
+}
+
+// indexAcceptedBlockFilter builds the filter of an accepted block. Failures
+// are logged since the block is accepted regardless.
+func (vm *VM) indexAcceptedBlockFilter(hash *chainhash.Hash) {
+	if vm.blockFiltersUnavailable {
+		return
+	}
+	if _, err := vm.indexBlockFilters(hash); err != nil {
+		vm.ctx.Log.Warn("Failed to build block filter",
+			zap.Stringer("hash", hash),
+			zap.Error(err),
+		)
+	}
+}
+
+// indexBlockFilters builds the filters of the main chain blocks up to hash,
+// starting above the highest block which has one, and returns the number of
+// filters built. Filters only depend on their block and its ancestors, so
+// existing filters never need to be rebuilt.
+func (vm *VM) indexBlockFilters(hash *chainhash.Hash) (int, error) {
+	height, err := vm.chain.BlockHeightByHash(hash)
+	if err != nil {
+		return 0, err
+	}
+
+	// Find the highest block with a filter, usually the parent of the block
+	var (
+		startHeight = height
+		prevHash    chainhash.Hash
+		prevHeader  chainhash.Hash
+	)
+	for ; startHeight >= 0; startHeight-- {
+		blockHash, err := vm.chain.BlockHashByHeight(startHeight)
+		if err != nil {
+			return 0, err
+		}
+		_, header, err := vm.getBlockFilter(blockHash)
+		if err == nil {
+			prevHash, prevHeader = *blockHash, header
+			break
+		}
+		if !errors.Is(err, errNoBlockFilter) {
+			return 0, err
+		}
+	}
+
+	for blockHeight := startHeight + 1; blockHeight <= height; blockHeight++ {
+		block, err := vm.chain.BlockByHeight(blockHeight)
+		if err != nil {
+			return 0, fmt.Errorf("failed to load block at height %d: %w", blockHeight, err)
+		}
+		// The genesis block has no parent, and its filter header commits to
+		// a zero header
+		if blockHeight > 0 && block.MsgBlock().Header.PrevBlock != prevHash {
+			return 0, errMainChainChanged
+		}
+
+		prevHeader, err = vm.buildBlockFilter(block, &prevHeader)
+		if err != nil {
+			return 0, fmt.Errorf("failed to build filter of block %s: %w", block.Hash(), err)
+		}
+		prevHash = *block.Hash()
+	}
+	return int(height - startHeight), nil
+}
+
+// buildBlockFilter builds and stores the basic filter of block, returning its
+// filter header
+func (vm *VM) buildBlockFilter(block *btcutil.Block, prevHeader *chainhash.Hash) (chainhash.Hash, error) {
+	stxos, err := vm.chain.FetchSpendJournal(block)
+	if err != nil {
+		return chainhash.Hash{}, fmt.Errorf("failed to load spent outputs: %w", err)
+	}
+	prevScripts := make([][]byte, len(stxos))
+	for i, stxo := range stxos {
+		prevScripts[i] = stxo.PkScript
+	}
+
+	filter, err := builder.BuildBasicFilter(block.MsgBlock(), prevScripts)
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	filterBytes, err := filter.NBytes()
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	header, err := builder.MakeHeaderForFilter(filter, *prevHeader)
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+
+	// Filters are stored after their header
+	value := make([]byte, 0, chainhash.HashSize+len(filterBytes))
+	value = append(value, header[:]...)
+	value = append(value, filterBytes...)
+	if err := vm.blockFilterDB.Put(block.Hash()[:], value); err != nil {
+		return chainhash.Hash{}, err
+	}
+	return header, nil
+}
+
+// getBlockFilter returns the serialized filter of the block with hash and its
+// filter header
+func (vm *VM) getBlockFilter(hash *chainhash.Hash) ([]byte, chainhash.Hash, error) {
+	value, err := vm.blockFilterDB.Get(hash[:])
+	if err == database.ErrNotFound {
+		return nil, chainhash.Hash{}, fmt.Errorf("%w %s", errNoBlockFilter, hash)
+	}
+	if err != nil {
+		return nil, chainhash.Hash{}, err
+	}
+	if len(value) < chainhash.HashSize {
+		return nil, chainhash.Hash{}, fmt.Errorf("invalid stored filter of block %s", hash)
+	}
+
+	var header chainhash.Hash
+	copy(header[:], value)
+	return value[chainhash.HashSize:], header, nil
+}
+
+// removeBlockFilters deletes the filters of blocks disconnected from the main
+// chain. They are built again if the blocks are connected and accepted. It is
+// called with the chain lock held, so it must not call back into the chain.
+func (vm *VM) removeBlockFilters(blocks []*btcutil.Block) {
+	for _, block := range blocks {
+		if err := vm.blockFilterDB.Delete(block.Hash()[:]); err != nil {
+			vm.ctx.Log.Warn("Failed to remove block filter",
+				zap.Stringer("hash", block.Hash()),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// blockFilterRPC returns the filter of a block for the getblockfilter RPC
+// command, nil if the block has no filter
+func (vm *VM) blockFilterRPC(hash *chainhash.Hash) (*btcjson.GetBlockFilterResult, error) {
+	filterBytes, header, err := vm.getBlockFilter(hash)
+	if errors.Is(err, errNoBlockFilter) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &btcjson.GetBlockFilterResult{
+		Filter: hex.EncodeToString(filterBytes),
+		Header: header.String(),
+	}, nil
+}
+
+// cfHeadersRPC returns the filter hashes of the blocks from startHeight to
+// stopHash for the getcfheaders RPC command
+func (vm *VM) cfHeadersRPC(startHeight uint32, stopHash *chainhash.Hash) (*btcjson.GetCFHeadersResult, error) {
+	msg, err := vm.blockFilterHeaders(startHeight, stopHash)
+	if err != nil {
+		return nil, err
+	}
+
+	filterHashes := make([]string, len(msg.FilterHashes))
+	for i, filterHash := range msg.FilterHashes {
+		filterHashes[i] = filterHash.String()
+	}
+	return &btcjson.GetCFHeadersResult{
+		StopHash:         msg.StopHash.String(),
+		PrevFilterHeader: msg.PrevFilterHeader.String(),
+		FilterHashes:     filterHashes,
+	}, nil
+}
+
+// blockFilterHashRange returns the hashes of the blocks from startHeight to
+// stopHash, which must all have a filter
+func (vm *VM) blockFilterHashRange(startHeight uint32, stopHash *chainhash.Hash, maxResults int) ([]chainhash.Hash, error) {
+	if startHeight > math.MaxInt32 {
+		return nil, fmt.Errorf("start height %d out of range", startHeight)
+	}
+	if _, _, err := vm.getBlockFilter(stopHash); err != nil {
+		return nil, err
+	}
+	return vm.chain.HeightToHashRange(int32(startHeight), stopHash, maxResults)
+}
+
+// blockFilterHeaders returns the filter hashes of the blocks from startHeight
+// to stopHash and the filter header of the block before startHeight, as a
+// cfheaders message
+func (vm *VM) blockFilterHeaders(startHeight uint32, stopHash *chainhash.Hash) (*wire.MsgCFHeaders, error) {
+	hashes, err := vm.blockFilterHashRange(startHeight, stopHash, wire.MaxCFHeadersPerMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &wire.MsgCFHeaders{
+		FilterType:   wire.GCSFilterRegular,
+		StopHash:     *stopHash,
+		FilterHashes: make([]*chainhash.Hash, len(hashes)),
+	}
+	if startHeight > 0 {
+		header, err := vm.chain.HeaderByHash(&hashes[0])
+		if err != nil {
+			return nil, err
+		}
+		_, msg.PrevFilterHeader, err = vm.getBlockFilter(&header.PrevBlock)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := range hashes {
+		filterBytes, _, err := vm.getBlockFilter(&hashes[i])
+		if err != nil {
+			return nil, err
+		}
+		filterHash := chainhash.DoubleHashH(filterBytes)
+		msg.FilterHashes[i] = &filterHash
+	}
+	return msg, nil
+}
+
+// marshalBlockFilterRequest creates a request of requestType for the filters
+// of the blocks from startHeight to stopHash
+func marshalBlockFilterRequest(requestType blockFilterRequestType, startHeight uint32, stopHash *chainhash.Hash) ([]byte, error) {
+	var msg wire.Message
+	switch requestType {
+	case blockFiltersRequest:
+		msg = wire.NewMsgGetCFilters(wire.GCSFilterRegular, startHeight, stopHash)
+	case blockFilterHeadersRequest:
+		msg = wire.NewMsgGetCFHeaders(wire.GCSFilterRegular, startHeight, stopHash)
+	default:
+		return nil, fmt.Errorf("unknown block filter request type: %d", requestType)
+	}
+
+	buf := bytes.NewBuffer([]byte{byte(requestType)})
+	if err := msg.BtcEncode(buf, 0, wire.BaseEncoding); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// blockFilterHandler serves the filters of accepted blocks to peers
+type blockFilterHandler struct {
+	p2p.NoOpHandler
+
+	log                logging.Logger
+	vm                 *VM
+	targetResponseSize int
+}
+
+// AppRequest responds to filter and filter header requests
+func (h *blockFilterHandler) AppRequest(
+	_ context.Context,
+	nodeID ids.NodeID,
+	_ time.Time,
+	requestBytes []byte,
+) ([]byte, *common.AppError) {
+	if len(requestBytes) == 0 {
+		return nil, p2p.ErrUnexpected
+	}
+
+	var (
+		response []byte
+		err      error
+	)
+	switch blockFilterRequestType(requestBytes[0]) {
+	case blockFiltersRequest:
+		response, err = h.handleFiltersRequest(requestBytes[1:])
+	case blockFilterHeadersRequest:
+		response, err = h.handleFilterHeadersRequest(requestBytes[1:])
+	default:
+		err = fmt.Errorf("unknown block filter request type: %d", requestBytes[0])
+	}
+	if err != nil {
+		h.log.Debug("failed to handle block filter request",
+			zap.Stringer("nodeID", nodeID),
+			zap.Error(err),
+		)
+		return nil, p2p.ErrUnexpected
+	}
+	return response, nil
+}
+
+// handleFiltersRequest returns the filters of the requested blocks, each
+// encoded as a cfilter message. The response ends early once it reaches the
+// target response size.
+func (h *blockFilterHandler) handleFiltersRequest(requestBytes []byte) ([]byte, error) {
+	var request wire.MsgGetCFilters
+	if err := request.BtcDecode(bytes.NewReader(requestBytes), 0, wire.BaseEncoding); err != nil {
+		return nil, err
+	}
+	if request.FilterType != wire.GCSFilterRegular {
+		return nil, fmt.Errorf("%w: %d", errUnknownFilterType, request.FilterType)
+	}
+
+	hashes, err := h.vm.blockFilterHashRange(request.StartHeight, &request.StopHash, wire.MaxGetCFiltersReqRange)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		responseSize = 0
+		filters      = make([][]byte, 0, len(hashes))
+	)
+	for i := range hashes {
+		filterBytes, _, err := h.vm.getBlockFilter(&hashes[i])
+		if err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		msg := wire.NewMsgCFilter(wire.GCSFilterRegular, &hashes[i], filterBytes)
+		if err := msg.BtcEncode(&buf, 0, wire.BaseEncoding); err != nil {
+			return nil, err
+		}
+
+		responseSize += buf.Len()
+		if responseSize > h.targetResponseSize && len(filters) > 0 {
+			break
+		}
+		filters = append(filters, buf.Bytes())
+	}
+	return gossip.MarshalAppResponse(filters)
+}
+
+// handleFilterHeadersRequest returns the filter hashes of the requested
+// blocks, encoded as a cfheaders message
+func (h *blockFilterHandler) handleFilterHeadersRequest(requestBytes []byte) ([]byte, error) {
+	var request wire.MsgGetCFHeaders
+	if err := request.BtcDecode(bytes.NewReader(requestBytes), 0, wire.BaseEncoding); err != nil {
+		return nil, err
+	}
+	if request.FilterType != wire.GCSFilterRegular {
+		return nil, fmt.Errorf("%w: %d", errUnknownFilterType, request.FilterType)
+	}
+
+	msg, err := h.vm.blockFilterHeaders(request.StartHeight, &request.StopHash)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, 0, wire.BaseEncoding); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fetchBlockFilters requests the filters of the blocks from startHeight to
+// stopHash from nodeID. The response may end before stopHash, in which case
+// the filters of the remaining blocks must be requested again.
+func (vm *VM) fetchBlockFilters(
+	ctx context.Context,
+	nodeID ids.NodeID,
+	startHeight uint32,
+	stopHash *chainhash.Hash,
+) ([]*wire.MsgCFilter, error) {
+	request, err := marshalBlockFilterRequest(blockFiltersRequest, startHeight, stopHash)
+	if err != nil {
+		return nil, err
+	}
+	response, err := awaitAppRequest(ctx, vm.blockFilterClient, nodeID, request)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := gossip.ParseAppResponse(response)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 || len(items) > wire.MaxGetCFiltersReqRange {
+		return nil, fmt.Errorf("%w: %d filters", errInvalidFilterResponse, len(items))
+	}
+
+	filters := make([]*wire.MsgCFilter, len(items))
+	for i, item := range items {
+		filters[i] = &wire.MsgCFilter{}
+		if err := filters[i].BtcDecode(bytes.NewReader(item), 0, wire.BaseEncoding); err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidFilterResponse, err)
+		}
+	}
+	return filters, nil
+}
+
+// fetchBlockFilterHeaders requests the filter hashes of the blocks from
+// startHeight to stopHash and the filter header preceding them from nodeID
+func (vm *VM) fetchBlockFilterHeaders(
+	ctx context.Context,
+	nodeID ids.NodeID,
+	startHeight uint32,
+	stopHash *chainhash.Hash,
+) (*wire.MsgCFHeaders, error) {
+	request, err := marshalBlockFilterRequest(blockFilterHeadersRequest, startHeight, stopHash)
+	if err != nil {
+		return nil, err
+	}
+	response, err := awaitAppRequest(ctx, vm.blockFilterClient, nodeID, request)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &wire.MsgCFHeaders{}
+	if err := msg.BtcDecode(bytes.NewReader(response), 0, wire.BaseEncoding); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidFilterResponse, err)
+	}
+	if msg.StopHash != *stopHash {
+		return nil, fmt.Errorf("%w: stop hash %s, requested %s", errInvalidFilterResponse, msg.StopHash, stopHash)
+	}
+	return msg, nil
+}
@@ -0,0 +1,142 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil/gcs"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil/gcs/builder"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
+)
+
+func TestBlockFilters(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vms := newTestVMsWithConfig(t, 2, key, `"rpcUser":"user","rpcPass":"pass"`, nil)
+	server, client := vms[0], vms[1]
+	handlers, err := server.CreateHandlers(ctx)
+	require.NoError(err)
+
+	// The second block spends the coinbase of the first
+	buildTestChain(t, server, 1)
+	blk, err := server.GetBlock(ctx, server.lastAccepted)
+	require.NoError(err)
+	prevTx := blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx()
+	spend := newTestSpend(t, key, prevTx)
+	_, err = server.btcdAdapter.TxMemPool().ProcessTransaction(spend, false, false, 0)
+	require.NoError(err)
+	buildTestChain(t, server, 1)
+	blk, err = server.GetBlock(ctx, server.lastAccepted)
+	require.NoError(err)
+	block := blk.(*BlockAdapter).btcBlock
+	require.Len(block.Transactions(), 2)
+
+	// The filter contains the output scripts of the block and the scripts of
+	// the outputs it spends
+	var result btcjson.GetBlockFilterResult
+	callRPC(t, handlers["/rpc"], "getblockfilter", []interface{}{block.Hash().String()}, &result)
+	filterBytes, err := hex.DecodeString(result.Filter)
+	require.NoError(err)
+	filter, err := gcs.FromNBytes(builder.DefaultP, builder.DefaultM, filterBytes)
+	require.NoError(err)
+	filterKey := builder.DeriveKey(block.Hash())
+	var scripts [][]byte
+	for _, tx := range block.MsgBlock().Transactions {
+		for _, txOut := range tx.TxOut {
+			if len(txOut.PkScript) > 0 && txOut.PkScript[0] != txscript.OP_RETURN {
+				scripts = append(scripts, txOut.PkScript)
+			}
+		}
+	}
+	scripts = append(scripts, prevTx.TxOut[0].PkScript)
+	for _, script := range scripts {
+		match, err := filter.Match(filterKey, script)
+		require.NoError(err)
+		require.True(match)
+	}
+	match, err := filter.Match(filterKey, []byte{txscript.OP_TRUE})
+	require.NoError(err)
+	require.False(match)
+
+	// Filter headers chain the filters from genesis
+	var (
+		hashes       = make([]chainhash.Hash, 3)
+		headers      = make([]chainhash.Hash, 3)
+		filterHashes = make([]string, 3)
+		prevHeader   chainhash.Hash
+	)
+	for height := range hashes {
+		hash, err := server.chain.BlockHashByHeight(int32(height))
+		require.NoError(err)
+		hashes[height] = *hash
+
+		var result btcjson.GetBlockFilterResult
+		callRPC(t, handlers["/rpc"], "getblockfilter", []interface{}{hash.String()}, &result)
+		filterBytes, err := hex.DecodeString(result.Filter)
+		require.NoError(err)
+		filter, err := gcs.FromNBytes(builder.DefaultP, builder.DefaultM, filterBytes)
+		require.NoError(err)
+		headers[height], err = builder.MakeHeaderForFilter(filter, prevHeader)
+		require.NoError(err)
+		require.Equal(headers[height].String(), result.Header)
+		filterHash, err := builder.GetFilterHash(filter)
+		require.NoError(err)
+		filterHashes[height] = filterHash.String()
+		prevHeader = headers[height]
+	}
+
+	var cfHeaders btcjson.GetCFHeadersResult
+	callRPC(t, handlers["/rpc"], "getcfheaders", []interface{}{1, block.Hash().String()}, &cfHeaders)
+	require.Equal(btcjson.GetCFHeadersResult{
+		StopHash:         block.Hash().String(),
+		PrevFilterHeader: headers[0].String(),
+		FilterHashes:     filterHashes[1:],
+	}, cfHeaders)
+
+	// Other VMs fetch filters over AppRequest
+	filters, err := client.fetchBlockFilters(ctx, server.ctx.NodeID, 0, block.Hash())
+	require.NoError(err)
+	require.Len(filters, 3)
+	for height, msg := range filters {
+		require.Equal(hashes[height], msg.BlockHash)
+		want, _, err := server.getBlockFilter(&hashes[height])
+		require.NoError(err)
+		require.Equal(want, msg.Data)
+	}
+	headersMsg, err := client.fetchBlockFilterHeaders(ctx, server.ctx.NodeID, 1, block.Hash())
+	require.NoError(err)
+	require.Equal(headers[0], headersMsg.PrevFilterHeader)
+	require.Len(headersMsg.FilterHashes, 2)
+	for i, filterHash := range headersMsg.FilterHashes {
+		require.Equal(filterHashes[i+1], filterHash.String())
+	}
+
+	// The client has no filters past its genesis block
+	_, err = server.fetchBlockFilters(ctx, client.ctx.NodeID, 0, block.Hash())
+	require.Error(err)
+
+	// Filters of disconnected blocks are removed and built again once the
+	// blocks are accepted
+	server.removeBlockFilters([]*btcutil.Block{block})
+	_, _, err = server.getBlockFilter(block.Hash())
+	require.ErrorIs(err, errNoBlockFilter)
+	buildTestChain(t, server, 1)
+	_, header, err := server.getBlockFilter(block.Hash())
+	require.NoError(err)
+	require.Equal(headers[2], header)
+	_, _, err = server.getBlockFilter(idToHash(server.lastAccepted))
+	require.NoError(err)
+}
@@ -0,0 +1,174 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/MetalBlockchain/metalgo/utils/set"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+)
+
+// blockProcessorQueueSize is the number of blocks waiting for the block
+// processor before queuing another one waits for room
+const blockProcessorQueueSize = 256
+
+var errBlockProcessorClosed = errors.New("block processor is closed")
+
+// blockRequest is a block waiting for the block processor. The status of the
+// block is sent to result once it is processed, if result is not nil.
+type blockRequest struct {
+	item   *BTCGossip
+	result chan<- blockResult
+}
+
+// blockResult is the outcome of processing a block: its submitblock status, or
+// the error that kept it from being processed
+type blockResult struct {
+	status string
+	err    error
+}
+
+// blockProcessor is the single goroutine validating and storing the blocks
+// received through gossip or submitted by clients, in the order they were
+// queued. The goroutines receiving blocks only do the cheap checks before
+// queuing them, so that a block slow to validate doesn't hold back the other
+// messages of its peer, and a child queued after its parent is never
+// processed as an orphan.
+//
+// Closing the processor stops it once the queued blocks are processed.
+type blockProcessor struct {
+	set      *UnifiedBTCSet
+	requests chan blockRequest
+
+	// closeLock is held for reading while a block is queued, so that the
+	// requests are not closed under a goroutine waiting for room
+	closeLock sync.RWMutex
+	closed    bool
+
+	// pending holds the hashes of the queued gossiped blocks, so that a block
+	// pushed by several peers is only queued once
+	lock    sync.Mutex
+	pending set.Set[chainhash.Hash]
+
+	queued    prometheus.Gauge
+	processed *prometheus.CounterVec
+}
+
+// newBlockProcessor returns a processor of the blocks of set and registers its
+// metrics under namespace
+func newBlockProcessor(
+	set *UnifiedBTCSet,
+	size int,
+	registerer prometheus.Registerer,
+	namespace string,
+) (*blockProcessor, error) {
+	p := &blockProcessor{
+		set:      set,
+		requests: make(chan blockRequest, size),
+		queued: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "block_processor_queued",
+			Help:      "number of blocks waiting for the block processor",
+		}),
+		processed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "block_processor_processed",
+			Help:      "number of blocks processed by the block processor, by status",
+		}, []string{"status"}),
+	}
+	for _, metric := range []prometheus.Collector{p.queued, p.processed} {
+		if err := registerer.Register(metric); err != nil {
+			return nil, fmt.Errorf("failed to register block processor metrics: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// queue queues the block of item, waiting for room if the queue is full. A
+// block queued without result is skipped if it is already queued.
+func (p *blockProcessor) queue(item *BTCGossip, result chan<- blockResult) error {
+	p.closeLock.RLock()
+	defer p.closeLock.RUnlock()
+
+	if p.closed {
+		return errBlockProcessorClosed
+	}
+	if result == nil && !p.addPending(item.Block.Hash()) {
+		return nil
+	}
+	p.queued.Inc()
+	p.requests <- blockRequest{item: item, result: result}
+	return nil
+}
+
+// addPending marks the gossiped block hash as queued and returns false if it
+// already was
+func (p *blockProcessor) addPending(hash *chainhash.Hash) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.pending.Contains(*hash) {
+		return false
+	}
+	p.pending.Add(*hash)
+	return true
+}
+
+// isPending returns whether the block hash was gossiped and is waiting to be
+// processed
+func (p *blockProcessor) isPending(hash *chainhash.Hash) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.pending.Contains(*hash)
+}
+
+// run processes the queued blocks until the processor is closed and its queue
+// drained
+func (p *blockProcessor) run() {
+	for request := range p.requests {
+		p.queued.Dec()
+		status, err := p.set.processBlock(request.item)
+		if request.result == nil {
+			p.lock.Lock()
+			p.pending.Remove(*request.item.Block.Hash())
+			p.lock.Unlock()
+		}
+		p.processed.WithLabelValues(statusLabel(status, err)).Inc()
+		if request.result != nil {
+			request.result <- blockResult{status: status, err: err}
+		}
+	}
+}
+
+// close stops queuing blocks. The blocks already queued are still processed.
+func (p *blockProcessor) close() {
+	p.closeLock.Lock()
+	defer p.closeLock.Unlock()
+
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.requests)
+}
+
+// statusLabel returns the label of the status of a processed block, or of the
+// error that kept it from being processed
+func statusLabel(status string, err error) string {
+	switch {
+	case err != nil:
+		return "error"
+	case strings.HasPrefix(status, blockStatusRejected):
+		return "rejected"
+	default:
+		return status
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+)
+
+func TestBlockProcessor(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vms := newTestVMs(t, 2, key)
+	vm, peer := vms[0], vms[1]
+
+	const numBlocks = 3
+	buildTestChain(t, peer, numBlocks)
+	blocks := make([]*btcutil.Block, 0, numBlocks)
+	for height := uint64(1); height <= numBlocks; height++ {
+		blkID, err := peer.GetBlockIDAtHeight(ctx, height)
+		require.NoError(err)
+		blk, err := peer.GetBlock(ctx, blkID)
+		require.NoError(err)
+		blocks = append(blocks, blk.(*BlockAdapter).btcBlock)
+	}
+
+	// The processor is run once the blocks are queued
+	reg := prometheus.NewRegistry()
+	bloom, err := newGossipBloomFilter(reg, "bloom", 8192, 0.01, 0.05)
+	require.NoError(err)
+	rejected, err := newRejectedCache(16, time.Hour, reg, "rejected")
+	require.NoError(err)
+	hints, err := newBlockHintTracker(vm, DefaultGossipConfig(), reg, "hints")
+	require.NoError(err)
+	set := NewUnifiedBTCSet(vm, bloom, rejected, hints)
+	processor, err := newBlockProcessor(set, numBlocks+1, reg, "test")
+	require.NoError(err)
+	set.blocks = processor
+
+	// Gossiped blocks are queued after the cheap checks, and known as soon as
+	// they are queued
+	for _, block := range blocks {
+		require.NoError(set.Add(NewBlockGossip(block)))
+	}
+	first := NewBlockGossip(blocks[0])
+	require.True(set.Has(first.GossipID()))
+	have, err := vm.chain.HaveBlock(blocks[0].Hash())
+	require.NoError(err)
+	require.False(have)
+
+	// Blocks pushed again by other peers are only queued once, unlike the
+	// blocks submitted by clients, which wait for their status
+	require.NoError(set.Add(first))
+	require.Equal(float64(numBlocks), testutil.ToFloat64(processor.queued))
+	result := make(chan blockResult, 1)
+	require.NoError(processor.queue(first, result))
+
+	// Closing the processor stops queuing blocks, but the queued blocks are
+	// still processed, in the order they were queued, so that no child is
+	// processed before its parent
+	processor.close()
+	require.ErrorIs(set.Add(NewBlockGossip(blocks[0])), errBlockProcessorClosed)
+	processor.run()
+	for _, block := range blocks {
+		have, err := vm.chain.HaveBlock(block.Hash())
+		require.NoError(err)
+		require.True(have)
+		require.True(set.inBloom(NewBlockGossip(block)))
+	}
+	require.Equal(float64(numBlocks), testutil.ToFloat64(processor.processed.WithLabelValues(blockStatusPending)))
+	require.Zero(testutil.ToFloat64(processor.processed.WithLabelValues(blockStatusOrphan)))
+	require.Equal(blockResult{status: blockStatusDuplicate}, <-result)
+	require.Zero(testutil.ToFloat64(processor.queued))
+	require.False(processor.isPending(blocks[0].Hash()))
+}
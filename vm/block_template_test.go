@@ -0,0 +1,117 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+)
+
+func TestBlockTemplatePackages(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, []byte(`{"maxAncestorCount":3}`))[0]
+	require.Equal(3, vm.config.MaxAncestorCount)
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+	txPool := vm.btcdAdapter.TxMemPool()
+
+	buildBlock := func() *BlockAdapter {
+		blk, err := vm.BuildBlock(ctx)
+		require.NoError(err)
+		require.NoError(blk.Verify(ctx))
+		require.NoError(vm.SetPreference(ctx, blk.ID()))
+		require.NoError(blk.Accept(ctx))
+		return blk.(*BlockAdapter)
+	}
+	blockTxs := func(blk *BlockAdapter) []chainhash.Hash {
+		var hashes []chainhash.Hash
+		for _, tx := range blk.btcBlock.Transactions()[1:] {
+			hashes = append(hashes, *tx.Hash())
+		}
+		return hashes
+	}
+	mempoolEntry := func(tx *btcutil.Tx) btcjson.GetMempoolEntryResult {
+		var result btcjson.GetMempoolEntryResult
+		callRPC(t, handlers["/rpc"], "getmempoolentry", []interface{}{tx.Hash().String()}, &result)
+		return result
+	}
+
+	// Fund small outputs so that their spends have too low a priority for
+	// the high-priority area of the block
+	coinbase := buildBlock().btcBlock.Transactions()[0].MsgTx()
+	split := newTestSplitTx(t, key, coinbase, 0, 10)
+	_, err = txPool.ProcessTransaction(split, false, false, 0)
+	require.NoError(err)
+	buildBlock()
+
+	// A low fee parent is bumped by its child above an unrelated transaction
+	// paying a higher fee rate than the parent alone
+	parent := newTestSpendWithFee(t, key, split.MsgTx(), 1_000)
+	child := newTestSpendWithFee(t, key, parent.MsgTx(), 1_000_000)
+	unrelated := newTestSplitTx(t, key, split.MsgTx(), 1, 1)
+	for _, tx := range []*btcutil.Tx{parent, child, unrelated} {
+		_, err := txPool.ProcessTransaction(tx, false, false, 0)
+		require.NoError(err)
+	}
+
+	parentEntry := mempoolEntry(parent)
+	require.Equal(int64(1), parentEntry.AncestorCount)
+	require.Equal(int64(2), parentEntry.DescendantCount)
+	require.Equal(float64(1_001_000), parentEntry.DescendantFees)
+	require.Empty(parentEntry.Depends)
+	require.Equal([]string{child.Hash().String()}, parentEntry.SpentBy)
+	childEntry := mempoolEntry(child)
+	require.Equal(int64(2), childEntry.AncestorCount)
+	require.Equal(int64(1), childEntry.DescendantCount)
+	require.Equal(float64(1_001_000), childEntry.AncestorFees)
+	require.Equal(parentEntry.VSize+childEntry.VSize, int32(childEntry.AncestorSize))
+	require.Equal([]string{parent.Hash().String()}, childEntry.Depends)
+
+	require.Equal([]chainhash.Hash{*parent.Hash(), *child.Hash(), *unrelated.Hash()}, blockTxs(buildBlock()))
+
+	// A chain longer than the ancestor limit is cut at the limit
+	chain := []*btcutil.Tx{newTestSpend(t, key, child.MsgTx())}
+	for i := 0; i < 3; i++ {
+		chain = append(chain, newTestSpend(t, key, chain[i].MsgTx()))
+	}
+	for _, tx := range chain[:3] {
+		_, err := txPool.ProcessTransaction(tx, false, false, 0)
+		require.NoError(err)
+	}
+	_, err = txPool.ProcessTransaction(chain[3], false, false, 0)
+	require.ErrorContains(err, "too many unconfirmed ancestors")
+	require.False(txPool.HaveTransaction(chain[3].Hash()))
+	require.Equal(int64(3), mempoolEntry(chain[2]).AncestorCount)
+
+	// The generations of the chain are the ancestors and descendants of its
+	// ends
+	var hashes []string
+	callRPC(t, handlers["/rpc"], "getmempoolancestors", []interface{}{chain[2].Hash().String()}, &hashes)
+	require.ElementsMatch([]string{chain[0].Hash().String(), chain[1].Hash().String()}, hashes)
+	require.True(sort.StringsAreSorted(hashes))
+	var entries map[string]btcjson.GetMempoolEntryResult
+	callRPC(t, handlers["/rpc"], "getmempooldescendants", []interface{}{chain[0].Hash().String(), true}, &entries)
+	require.Len(entries, 2)
+	require.Equal([]string{chain[0].Hash().String()}, entries[chain[1].Hash().String()].Depends)
+	require.Equal([]string{chain[2].Hash().String()}, entries[chain[1].Hash().String()].SpentBy)
+	require.Empty(entries[chain[2].Hash().String()].SpentBy)
+
+	// The accepted part of the chain is mined in order
+	require.Equal([]chainhash.Hash{*chain[0].Hash(), *chain[1].Hash(), *chain[2].Hash()}, blockTxs(buildBlock()))
+}
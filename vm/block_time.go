@@ -0,0 +1,100 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/MetalBlockchain/btcvm/btcd/mining"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+)
+
+var errBlockTimeNotIncreasing = errors.New("block time is not after the time of its parent")
+
+// Bounds a built block time is clamped to, by their label in the metrics
+const (
+	// blockTimeBoundParent is the second after the time of the parent,
+	// clamped to when the clock is behind the parent
+	blockTimeBoundParent = "parent"
+
+	// blockTimeBoundDrift is the maximum drift ahead of the parent,
+	// clamped to when the clock is ahead of the parent
+	blockTimeBoundDrift = "drift"
+)
+
+// builtBlockTime returns the time of a block built at now on a parent with
+// time parentTime, which is max(parentTime+1s, min(now, parentTime+maxDrift)),
+// and the bound it was clamped to, if any. Zero maxDrift doesn't bound the
+// time ahead of the parent.
+func builtBlockTime(now time.Time, parentTime time.Time, maxDrift time.Duration) (time.Time, string) {
+	if minTime := parentTime.Add(time.Second); now.Before(minTime) {
+		return minTime, blockTimeBoundParent
+	}
+	if maxTime := parentTime.Add(maxDrift); maxDrift > 0 && now.After(maxTime) {
+		return maxTime, blockTimeBoundDrift
+	}
+	return now, ""
+}
+
+// clampBlockTime clamps the time of msgBlock, built from a template of
+// generator, to the bounds of builtBlockTime, so that the blocks built by the
+// node are after their parent even when proposers' clocks are skewed. A
+// clamped time is counted in the builder metrics and logged, so that operators
+// notice clock problems.
+func (vm *VM) clampBlockTime(generator *mining.BlkTmplGenerator, msgBlock *wire.MsgBlock) error {
+	best := vm.chain.BestSnapshot()
+	if best.Hash != msgBlock.Header.PrevBlock {
+		return fmt.Errorf("chain tip moved to %s while building on %s", best.Hash, msgBlock.Header.PrevBlock)
+	}
+
+	maxDrift := time.Duration(vm.nodeConfig.MaxBlockTimeDriftSeconds) * time.Second
+	templateTime := msgBlock.Header.Timestamp
+	blockTime, bound := builtBlockTime(templateTime, best.Timestamp, maxDrift)
+	if bound == "" {
+		return nil
+	}
+
+	// The time of the template is the earliest allowed by consensus if the
+	// clock is behind it
+	if minTime := mining.MinimumBlockTime(best, vm.config.ChainParams); blockTime.Before(minTime) {
+		blockTime = minTime
+	}
+	if blockTime.Equal(templateTime) {
+		return nil
+	}
+	if err := generator.SetBlockTime(msgBlock, blockTime); err != nil {
+		return fmt.Errorf("failed to set block time: %w", err)
+	}
+
+	if vm.blockBuilder != nil {
+		vm.blockBuilder.metrics.clampedBlockTimes.WithLabelValues(bound).Inc()
+	}
+	vm.builderLog.Warn("Clamped the time of the built block, the clock may be skewed",
+		zap.Time("clock", templateTime),
+		zap.Time("parentTime", best.Timestamp),
+		zap.Time("blockTime", blockTime),
+		zap.String("bound", bound),
+	)
+	return nil
+}
+
+// verifyBlockTime checks that the time of b is after the time of its parent
+// on chains with increasing timestamps
+func (vm *VM) verifyBlockTime(b *BlockAdapter) error {
+	if !vm.increasingTimestamps {
+		return nil
+	}
+	parentHeader, err := vm.chain.HeaderByHash(&b.btcBlock.MsgBlock().Header.PrevBlock)
+	if err != nil {
+		return fmt.Errorf("failed to look up parent header: %w", err)
+	}
+	if minTime := parentHeader.Timestamp.Add(time.Second); b.timestamp.Before(minTime) {
+		return fmt.Errorf("%w: %s, parent %s", errBlockTimeNotIncreasing, b.timestamp, parentHeader.Timestamp)
+	}
+	return nil
+}
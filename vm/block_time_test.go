@@ -0,0 +1,122 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+)
+
+func TestBuiltBlockTime(t *testing.T) {
+	parentTime := time.Unix(1_700_000_000, 0)
+	tests := []struct {
+		name          string
+		now           time.Time
+		maxDrift      time.Duration
+		expectedTime  time.Time
+		expectedBound string
+	}{
+		{"behind parent", parentTime.Add(-time.Minute), time.Minute, parentTime.Add(time.Second), blockTimeBoundParent},
+		{"at parent", parentTime, time.Minute, parentTime.Add(time.Second), blockTimeBoundParent},
+		{"within bounds", parentTime.Add(30 * time.Second), time.Minute, parentTime.Add(30 * time.Second), ""},
+		{"beyond drift", parentTime.Add(time.Hour), time.Minute, parentTime.Add(time.Minute), blockTimeBoundDrift},
+		{"no drift limit", parentTime.Add(time.Hour), 0, parentTime.Add(time.Hour), ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			blockTime, bound := builtBlockTime(test.now, parentTime, test.maxDrift)
+			require.Equal(t, test.expectedTime, blockTime)
+			require.Equal(t, test.expectedBound, bound)
+		})
+	}
+}
+
+func TestBuiltBlockTimeBehindParent(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vms := newTestVMsWithGenesis(t, 2, key, "", `"chainParams":{"monotonicTimestamps":true}`, nil)
+	proposer, validator := vms[0], vms[1]
+
+	// The clock of the proposer is 3 seconds ahead of the clock of the
+	// validator
+	timeSource := proposer.btcdAdapter.TimeSource()
+	for i := 0; i < 5; i++ {
+		timeSource.AddTimeSample(fmt.Sprintf("peer%d", i), time.Now().Add(3*time.Second))
+	}
+	buildTestChain(t, proposer, 1)
+	parent, err := proposer.GetBlock(ctx, proposer.lastAccepted)
+	require.NoError(err)
+	blk, err := validator.ParseBlock(ctx, parent.Bytes())
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(validator.SetPreference(ctx, blk.ID()))
+	require.NoError(blk.Accept(ctx))
+
+	// The validator times its block a second after the parent
+	buildTestChain(t, validator, 1)
+	next, err := validator.GetBlock(ctx, validator.lastAccepted)
+	require.NoError(err)
+	parentTime := parent.(*BlockAdapter).btcBlock.MsgBlock().Header.Timestamp
+	require.Equal(parentTime.Add(time.Second), next.(*BlockAdapter).btcBlock.MsgBlock().Header.Timestamp)
+	require.Equal(float64(1), testutil.ToFloat64(validator.blockBuilder.metrics.clampedBlockTimes.WithLabelValues(blockTimeBoundParent)))
+}
+
+func TestBuiltBlockTimeMaxDrift(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithGenesis(t, 1, key, "", "", []byte(`{"maxBlockTimeDriftSeconds":60}`))[0]
+	genesisTime := vm.chain.BestSnapshot().Timestamp
+	require.True(genesisTime.Add(time.Minute).Before(time.Now()))
+
+	// The clock is far ahead of the genesis, so the block is timed the
+	// maximum drift after it
+	buildTestChain(t, vm, 1)
+	blk, err := vm.GetBlock(ctx, vm.lastAccepted)
+	require.NoError(err)
+	require.Equal(genesisTime.Add(time.Minute), blk.(*BlockAdapter).btcBlock.MsgBlock().Header.Timestamp)
+	require.Equal(float64(1), testutil.ToFloat64(vm.blockBuilder.metrics.clampedBlockTimes.WithLabelValues(blockTimeBoundDrift)))
+}
+
+func TestIncreasingTimestamps(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithGenesis(t, 1, key, "", `"chainParams":{"monotonicTimestamps":true,"increasingTimestamps":true}`, nil)[0]
+	require.True(vm.increasingTimestamps)
+	buildTestChain(t, vm, 1)
+
+	// A block timed as its parent is rejected
+	parent := vm.chain.BestSnapshot()
+	addr, err := btcutil.DecodeAddress(vm.config.MiningAddrs[0], vm.config.ChainParams)
+	require.NoError(err)
+	generator := vm.btcdAdapter.GetBlockTemplateGenerator()
+	template, err := generator.NewBlockTemplate(addr)
+	require.NoError(err)
+	msgBlock := template.Block
+	require.NoError(generator.SetBlockTime(msgBlock, parent.Timestamp))
+	require.Equal(parent.Hash, msgBlock.Header.PrevBlock)
+	blockBytes, err := serializeBlock(msgBlock)
+	require.NoError(err)
+	blk, err := vm.ParseBlock(ctx, blockBytes)
+	if err == nil {
+		err = blk.Verify(ctx)
+	}
+	require.ErrorIs(err, errBlockTimeNotIncreasing)
+}
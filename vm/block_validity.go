@@ -0,0 +1,50 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"fmt"
+
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Actions of the invalidateblock and reconsiderblock RPCs, used as the label
+// of the block validity changes metric
+const (
+	blockValidityInvalidate = "invalidate"
+	blockValidityReconsider = "reconsider"
+)
+
+// initializeBlockValidity registers the metrics of the blocks operators mark
+// as invalid or valid through the admin RPCs
+func (vm *VM) initializeBlockValidity() error {
+	vm.blockValidityChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "block_validity_changes",
+		Help: "number of blocks marked as invalid or valid by the invalidateblock and reconsiderblock RPCs",
+	}, []string{"action"})
+	if err := vm.metrics.Register(vm.blockValidityChanges); err != nil {
+		return fmt.Errorf("failed to register block validity metrics: %w", err)
+	}
+	vm.btcdAdapter.SetBlockValidityChanged(vm.blockValidityChanged)
+	return nil
+}
+
+// blockValidityChanged records that an operator marked the block with the
+// given hash and height as invalid or valid. The block is not accepted by
+// consensus, which may still decide on it.
+func (vm *VM) blockValidityChanged(hash *chainhash.Hash, height int32, valid bool) {
+	action := blockValidityInvalidate
+	if valid {
+		action = blockValidityReconsider
+	}
+	vm.blockValidityChanges.WithLabelValues(action).Inc()
+
+	vm.ctx.Log.Warn("Block validity changed by operator",
+		zap.String("action", action),
+		zap.Stringer("hash", hash),
+		zap.Int32("height", height),
+	)
+}
@@ -0,0 +1,123 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+)
+
+func TestInvalidateAndReconsiderBlockRPC(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	configBytes := []byte(`{"rpcAuth":{
+		"tokens":[{"token":"admin-token"},{"token":"operator-token","role":"operator"}],
+		"roles":{"operator":{}}
+	}}`)
+	vm := newTestVMsWithConfig(t, 1, key, "", configBytes)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+
+	call := func(token string, method string, hash string) *btcjson.RPCError {
+		recorder := httptest.NewRecorder()
+		handlers["/rpc"].ServeHTTP(recorder, rpcAuthRequest("Bearer "+token,
+			`{"jsonrpc":"1.0","id":1,"method":"`+method+`","params":["`+hash+`"]}`))
+		var response batchResponse
+		require.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+		if response.Error == nil {
+			require.Equal(http.StatusOK, recorder.Code)
+		}
+		return response.Error
+	}
+
+	// The block of the spend is connected by btcd but not accepted
+	buildTestChain(t, vm, 1)
+	accepted := acceptedBlocks(t, vm)[0].(*BlockAdapter)
+	tx := newTestSpend(t, key, accepted.btcBlock.Transactions()[0].MsgTx())
+	mempool := vm.btcdAdapter.TxMemPool()
+	_, err = mempool.ProcessTransaction(tx, false, false, 0)
+	require.NoError(err)
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.Len(blk.(*BlockAdapter).btcBlock.Transactions(), 2)
+	require.False(mempool.HaveTransaction(tx.Hash()))
+	hash := idToHash(blk.ID())
+
+	// Only admin tokens may change the validity of blocks
+	for _, method := range []string{"invalidateblock", "reconsiderblock"} {
+		rpcErr := call("operator-token", method, hash.String())
+		require.NotNil(rpcErr, method)
+		require.Equal(btcjson.ErrRPCInvalidRequest.Code, rpcErr.Code, method)
+	}
+
+	// Accepted blocks cannot be invalidated
+	for _, acceptedHash := range []string{
+		btcd.BtcvmTestNetParms.GenesisHash.String(),
+		accepted.btcBlock.Hash().String(),
+	} {
+		rpcErr := call("admin-token", "invalidateblock", acceptedHash)
+		require.NotNil(rpcErr)
+		require.Equal(btcjson.ErrRPCInvalidParameter, rpcErr.Code)
+	}
+
+	// Unknown blocks are not found
+	rpcErr := call("admin-token", "invalidateblock", chainhash.Hash{}.String())
+	require.NotNil(rpcErr)
+	require.Equal(btcjson.ErrRPCBlockNotFound, rpcErr.Code)
+
+	// Invalidating the block returns its transactions to the mempool
+	require.Nil(call("admin-token", "invalidateblock", hash.String()))
+	require.Equal(*accepted.btcBlock.Hash(), vm.chain.BestSnapshot().Hash)
+	require.True(mempool.HaveTransaction(tx.Hash()))
+
+	// Reconsidering it connects it again
+	require.Nil(call("admin-token", "reconsiderblock", hash.String()))
+	require.Equal(*hash, vm.chain.BestSnapshot().Hash)
+	require.False(mempool.HaveTransaction(tx.Hash()))
+
+	require.Equal(float64(1), testutil.ToFloat64(vm.blockValidityChanges.WithLabelValues(blockValidityInvalidate)))
+	require.Equal(float64(1), testutil.ToFloat64(vm.blockValidityChanges.WithLabelValues(blockValidityReconsider)))
+}
+
+func TestInvalidateBlockLimitedUser(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key,
+		`"rpcUser":"user","rpcPass":"pass","rpcLimitUser":"limited","rpcLimitPass":"limitedpass"`, nil)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+
+	// Limited users may not change the validity of blocks
+	hash := btcd.BtcvmTestNetParms.GenesisHash.String()
+	for _, method := range []string{"invalidateblock", "reconsiderblock"} {
+		request := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(
+			`{"jsonrpc":"1.0","id":1,"method":"`+method+`","params":["`+hash+`"]}`))
+		request.SetBasicAuth("limited", "limitedpass")
+		recorder := httptest.NewRecorder()
+		handlers["/rpc"].ServeHTTP(recorder, request)
+		var response batchResponse
+		require.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+		require.NotNil(response.Error, method)
+		require.Equal(btcjson.ErrRPCInternal.Code, response.Error.Code, method)
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/MetalBlockchain/metalgo/database"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+)
+
+const (
+	defaultWebhookQueueSize            = 1024
+	defaultWebhookTimeoutSeconds       = 10
+	defaultWebhookMaxRetryDelaySeconds = 60
+
+	// webhookRetryDelay is the delay before the first retry of a failed
+	// post, doubled on each retry up to the max retry delay
+	webhookRetryDelay = 250 * time.Millisecond
+)
+
+// acceptedBlockWebhookCursorKey is the height of the last accepted block
+// published to every webhook
+var acceptedBlockWebhookCursorKey = []byte("acceptedBlockWebhookCursor")
+
+var _ Acceptor = (*webhookAcceptor)(nil)
+
+// AcceptedBlockWebhooksConfig sets the endpoints accepted blocks are posted
+// to. Each block is posted to every endpoint, in order, at least once: a block
+// is retried until each endpoint answers with a 2xx status, including after a
+// restart.
+type AcceptedBlockWebhooksConfig struct {
+	// URLs are the HTTP endpoints the blocks are posted to
+	URLs []string `json:"urls"`
+
+	// QueueSize is the number of accepted blocks waiting to be posted. Blocks
+	// accepted while the queue is full are posted once it drains. If zero,
+	// defaults to 1024.
+	QueueSize int `json:"queueSize"`
+
+	// TimeoutSeconds is how long a post may take. If zero, defaults to 10.
+	TimeoutSeconds uint `json:"timeoutSeconds"`
+
+	// MaxRetryDelaySeconds bounds the delay between the retries of a failed
+	// post. If zero, defaults to 60.
+	MaxRetryDelaySeconds uint `json:"maxRetryDelaySeconds"`
+}
+
+// Validate checks if the configuration is valid
+func (c *AcceptedBlockWebhooksConfig) Validate() error {
+	if len(c.URLs) == 0 {
+		return errors.New("urls must not be empty")
+	}
+	for _, rawURL := range c.URLs {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return fmt.Errorf("invalid url %q: %w", rawURL, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url must be an absolute http or https url, got %q", rawURL)
+		}
+	}
+	if c.QueueSize < 0 {
+		return fmt.Errorf("queue size must not be negative, got %d", c.QueueSize)
+	}
+	return nil
+}
+
+// withDefaults returns the configuration with the defaults of the unset
+// values
+func (c AcceptedBlockWebhooksConfig) withDefaults() AcceptedBlockWebhooksConfig {
+	if c.QueueSize == 0 {
+		c.QueueSize = defaultWebhookQueueSize
+	}
+	if c.TimeoutSeconds == 0 {
+		c.TimeoutSeconds = defaultWebhookTimeoutSeconds
+	}
+	if c.MaxRetryDelaySeconds == 0 {
+		c.MaxRetryDelaySeconds = defaultWebhookMaxRetryDelaySeconds
+	}
+	return c
+}
+
+// acceptedBlockSummary is the body posted to the webhooks for an accepted
+// block
+type acceptedBlockSummary struct {
+	Hash      string   `json:"hash"`
+	Height    uint64   `json:"height"`
+	TxIDs     []string `json:"txids"`
+	Timestamp int64    `json:"timestamp"`
+}
+
+// newAcceptedBlockSummary returns the summary of block, accepted at height
+func newAcceptedBlockSummary(block *btcutil.Block, height uint64) acceptedBlockSummary {
+	txs := block.Transactions()
+	txIDs := make([]string, len(txs))
+	for i, tx := range txs {
+		txIDs[i] = tx.Hash().String()
+	}
+	return acceptedBlockSummary{
+		Hash:      block.Hash().String(),
+		Height:    height,
+		TxIDs:     txIDs,
+		Timestamp: block.MsgBlock().Header.Timestamp.Unix(),
+	}
+}
+
+// webhookMetrics tracks the posts of accepted blocks to the webhooks
+type webhookMetrics struct {
+	published   prometheus.Counter
+	failedPosts prometheus.Counter
+	dropped     prometheus.Counter
+	cursor      prometheus.Gauge
+}
+
+// newWebhookMetrics creates the webhook metrics and registers them under
+// namespace
+func newWebhookMetrics(registerer prometheus.Registerer, namespace string) (*webhookMetrics, error) {
+	m := &webhookMetrics{
+		published: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "published",
+			Help:      "number of accepted blocks posted to every webhook",
+		}),
+		failedPosts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "failed_posts",
+			Help:      "number of failed posts of accepted blocks, each of which is retried",
+		}),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "dropped",
+			Help:      "number of accepted blocks not queued because the queue was full, which are posted once it drains",
+		}),
+		cursor: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "cursor",
+			Help:      "height of the last accepted block posted to every webhook",
+		}),
+	}
+
+	for _, collector := range []prometheus.Collector{
+		m.published,
+		m.failedPosts,
+		m.dropped,
+		m.cursor,
+	} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, fmt.Errorf("failed to register webhook metrics: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// webhookAcceptor posts the summaries of the accepted blocks to webhooks. The
+// summaries are queued by OnAccept and posted by a goroutine, which persists
+// the height of the last block posted to every webhook as a cursor. Blocks
+// dropped because the queue was full, and those accepted while the node was
+// down, are read back from the accepted blocks after the cursor.
+type webhookAcceptor struct {
+	vm       *VM
+	config   AcceptedBlockWebhooksConfig
+	client   *http.Client
+	metrics  *webhookMetrics
+	queue    chan acceptedBlockSummary
+	catchUp  chan struct{}
+	cursor   uint64
+	maxDelay time.Duration
+}
+
+// newWebhookAcceptor creates the webhook acceptor of config and starts posting
+// the blocks accepted after its cursor. Without a cursor, posting starts with
+// the next accepted block.
+func newWebhookAcceptor(vm *VM, config AcceptedBlockWebhooksConfig) (*webhookAcceptor, error) {
+	config = config.withDefaults()
+	metrics, err := newWebhookMetrics(vm.metrics, "accepted_block_webhooks")
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := database.GetUInt64(vm.db, acceptedBlockWebhookCursorKey)
+	if errors.Is(err, database.ErrNotFound) {
+		cursor, err = database.GetUInt64(vm.db, acceptedHeightKey)
+		if errors.Is(err, database.ErrNotFound) {
+			cursor, err = 0, nil
+		}
+		if err == nil {
+			err = database.PutUInt64(vm.db, acceptedBlockWebhookCursorKey, cursor)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize accepted block webhook cursor: %w", err)
+	}
+	metrics.cursor.Set(float64(cursor))
+
+	w := &webhookAcceptor{
+		vm:       vm,
+		config:   config,
+		client:   &http.Client{Timeout: time.Duration(config.TimeoutSeconds) * time.Second},
+		metrics:  metrics,
+		queue:    make(chan acceptedBlockSummary, config.QueueSize),
+		catchUp:  make(chan struct{}, 1),
+		cursor:   cursor,
+		maxDelay: time.Duration(config.MaxRetryDelaySeconds) * time.Second,
+	}
+
+	// Post the blocks accepted while the node was down
+	w.catchUp <- struct{}{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	vm.shutdownWg.Add(2)
+	go func() {
+		defer vm.shutdownWg.Done()
+		<-vm.shutdownChan
+		cancel()
+	}()
+	go func() {
+		defer vm.shutdownWg.Done()
+		w.run(ctx)
+	}()
+	return w, nil
+}
+
+// OnAccept queues the summary of block. If the queue is full, the block is
+// dropped and posted once the queue drains.
+func (w *webhookAcceptor) OnAccept(block *BlockAdapter) {
+	select {
+	case w.queue <- newAcceptedBlockSummary(block.btcBlock, block.height):
+		return
+	default:
+	}
+
+	w.metrics.dropped.Inc()
+	select {
+	case w.catchUp <- struct{}{}:
+	default:
+	}
+}
+
+// run posts the queued blocks, and the blocks missing from the queue, until
+// ctx is done
+func (w *webhookAcceptor) run(ctx context.Context) {
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case summary := <-w.queue:
+			err = w.publishThrough(ctx, summary.Height-1)
+			if err == nil && summary.Height == w.cursor+1 {
+				err = w.publish(ctx, summary)
+			}
+		case <-w.catchUp:
+			var height uint64
+			height, err = database.GetUInt64(w.vm.db, acceptedHeightKey)
+			if errors.Is(err, database.ErrNotFound) {
+				height, err = 0, nil
+			}
+			if err == nil {
+				err = w.publishThrough(ctx, height)
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// The blocks after the cursor are read back on the next
+			// accepted block
+			w.vm.ctx.Log.Warn("Failed to publish accepted blocks",
+				zap.Uint64("cursor", w.cursor),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// publishThrough posts the accepted blocks after the cursor up to height
+func (w *webhookAcceptor) publishThrough(ctx context.Context, height uint64) error {
+	for w.cursor < height {
+		summary, err := w.acceptedBlockSummary(w.cursor + 1)
+		if err != nil {
+			return err
+		}
+		if err := w.publish(ctx, summary); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acceptedBlockSummary reads back the summary of the accepted block at height
+func (w *webhookAcceptor) acceptedBlockSummary(height uint64) (acceptedBlockSummary, error) {
+	blkID, err := w.vm.acceptedBlockID(height)
+	if err != nil {
+		return acceptedBlockSummary{}, err
+	}
+	block, err := w.vm.chain.BlockByHash(idToHash(blkID))
+	if err != nil {
+		return acceptedBlockSummary{}, fmt.Errorf("failed to read accepted block %s: %w", blkID, err)
+	}
+	return newAcceptedBlockSummary(block, height), nil
+}
+
+// publish posts summary to every webhook, retrying each failed post until it
+// succeeds or ctx is done, and then moves the cursor to summary
+func (w *webhookAcceptor) publish(ctx context.Context, summary acceptedBlockSummary) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("failed to marshal accepted block summary: %w", err)
+	}
+	for _, webhookURL := range w.config.URLs {
+		delay := webhookRetryDelay
+		for {
+			err := w.post(ctx, webhookURL, body)
+			if err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			w.metrics.failedPosts.Inc()
+			w.vm.ctx.Log.Debug("Failed to post accepted block, retrying",
+				zap.String("url", webhookURL),
+				zap.Uint64("height", summary.Height),
+				zap.Duration("delay", delay),
+				zap.Error(err),
+			)
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+			delay = min(2*delay, w.maxDelay)
+		}
+	}
+
+	w.cursor = summary.Height
+	w.metrics.published.Inc()
+	w.metrics.cursor.Set(float64(w.cursor))
+	if err := database.PutUInt64(w.vm.db, acceptedBlockWebhookCursorKey, w.cursor); err != nil {
+		// The blocks since the last persisted cursor are posted again after
+		// a restart
+		w.vm.ctx.Log.Warn("Failed to persist accepted block webhook cursor",
+			zap.Uint64("cursor", w.cursor),
+			zap.Error(err),
+		)
+	}
+	return nil
+}
+
+// post posts body to webhookURL, failing unless the response has a 2xx
+// status
+func (w *webhookAcceptor) post(ctx context.Context, webhookURL string, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := w.client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return nil
+}
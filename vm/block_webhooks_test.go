@@ -0,0 +1,181 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MetalBlockchain/metalgo/database"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+)
+
+// webhookServer records the accepted block summaries posted to it, failing
+// the posts while it is down
+type webhookServer struct {
+	*httptest.Server
+	down atomic.Bool
+
+	lock      sync.Mutex
+	summaries []acceptedBlockSummary
+}
+
+func newWebhookServer(t *testing.T) *webhookServer {
+	s := &webhookServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var summary acceptedBlockSummary
+		if err := json.NewDecoder(r.Body).Decode(&summary); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.lock.Lock()
+		s.summaries = append(s.summaries, summary)
+		s.lock.Unlock()
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// heights returns the heights of the summaries posted so far
+func (s *webhookServer) heights() []uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	heights := make([]uint64, len(s.summaries))
+	for i, summary := range s.summaries {
+		heights[i] = summary.Height
+	}
+	return heights
+}
+
+func TestAcceptedBlockWebhooksConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config AcceptedBlockWebhooksConfig
+		valid  bool
+	}{
+		{"valid", AcceptedBlockWebhooksConfig{URLs: []string{"http://localhost:8080/blocks", "https://example.com"}}, true},
+		{"no urls", AcceptedBlockWebhooksConfig{}, false},
+		{"relative url", AcceptedBlockWebhooksConfig{URLs: []string{"/blocks"}}, false},
+		{"unsupported scheme", AcceptedBlockWebhooksConfig{URLs: []string{"ws://localhost:8080"}}, false},
+		{"negative queue size", AcceptedBlockWebhooksConfig{URLs: []string{"http://localhost"}, QueueSize: -1}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.Validate()
+			if test.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+
+	config := AcceptedBlockWebhooksConfig{URLs: []string{"http://localhost"}}.withDefaults()
+	require.Equal(t, defaultWebhookQueueSize, config.QueueSize)
+	require.Equal(t, uint(defaultWebhookTimeoutSeconds), config.TimeoutSeconds)
+	require.Equal(t, uint(defaultWebhookMaxRetryDelaySeconds), config.MaxRetryDelaySeconds)
+}
+
+func TestAcceptedBlockWebhooks(t *testing.T) {
+	require := require.New(t)
+
+	server := newWebhookServer(t)
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	configBytes := []byte(`{"acceptedBlockWebhooks":{"urls":["` + server.URL + `"],"queueSize":1,"maxRetryDelaySeconds":1}}`)
+	vm := newTestVMsWithGenesis(t, 1, key, "", "", configBytes)[0]
+	webhooks, ok := vm.acceptor.(*webhookAcceptor)
+	require.True(ok)
+
+	// Accepted blocks are posted in order
+	buildTestChain(t, vm, 2)
+	require.Eventually(func() bool {
+		return len(server.heights()) == 2
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Equal([]uint64{1, 2}, server.heights())
+
+	tip := vm.chain.BestSnapshot()
+	block, err := vm.chain.BlockByHash(&tip.Hash)
+	require.NoError(err)
+	server.lock.Lock()
+	summary := server.summaries[1]
+	server.lock.Unlock()
+	require.Equal(newAcceptedBlockSummary(block, 2), summary)
+	require.Equal(tip.Hash.String(), summary.Hash)
+	require.Equal(block.Transactions()[0].Hash().String(), summary.TxIDs[0])
+	require.Equal(tip.Timestamp.Unix(), summary.Timestamp)
+
+	// Blocks accepted during an outage overflow the queue and are posted
+	// once the endpoint is back
+	server.down.Store(true)
+	buildTestChain(t, vm, 4)
+	require.Eventually(func() bool {
+		return testutil.ToFloat64(webhooks.metrics.failedPosts) > 0
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Positive(testutil.ToFloat64(webhooks.metrics.dropped))
+	require.Equal([]uint64{1, 2}, server.heights())
+
+	server.down.Store(false)
+	require.Eventually(func() bool {
+		return len(server.heights()) == 6
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Equal([]uint64{1, 2, 3, 4, 5, 6}, server.heights())
+	require.Eventually(func() bool {
+		cursor, err := database.GetUInt64(vm.db, acceptedBlockWebhookCursorKey)
+		return err == nil && cursor == 6
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Equal(float64(6), testutil.ToFloat64(webhooks.metrics.published))
+}
+
+func TestAcceptedBlockWebhooksCatchUp(t *testing.T) {
+	require := require.New(t)
+
+	server := newWebhookServer(t)
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMs(t, 1, key)[0]
+	require.IsType(noopAcceptor{}, vm.acceptor)
+	buildTestChain(t, vm, 3)
+
+	// A new acceptor starts with the next accepted block
+	config := AcceptedBlockWebhooksConfig{URLs: []string{server.URL}}
+	webhooks, err := newWebhookAcceptor(vm, config)
+	require.NoError(err)
+	require.EqualValues(3, webhooks.cursor)
+
+	cursor, err := database.GetUInt64(vm.db, acceptedBlockWebhookCursorKey)
+	require.NoError(err)
+	require.EqualValues(3, cursor)
+
+	// An acceptor restarted from an earlier cursor, as after the node was
+	// down, posts the blocks accepted since before the next accepted block
+	require.NoError(database.PutUInt64(vm.db, acceptedBlockWebhookCursorKey, 1))
+	vm.metrics = prometheus.NewRegistry()
+	webhooks, err = newWebhookAcceptor(vm, config)
+	require.NoError(err)
+	vm.acceptor = webhooks
+	require.Eventually(func() bool {
+		return len(server.heights()) == 2
+	}, 10*time.Second, 10*time.Millisecond)
+
+	buildTestChain(t, vm, 1)
+	require.Eventually(func() bool {
+		return len(server.heights()) == 3
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Equal([]uint64{2, 3, 4}, server.heights())
+}
@@ -0,0 +1,29 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import "fmt"
+
+// CacheConfig contains the sizes of the VM's in-memory caches
+type CacheConfig struct {
+	// BlockCacheSize is the number of recently used blocks kept deserialized
+	// so that repeated GetBlock and ParseBlock calls do not hit the database
+	// Default: 512
+	BlockCacheSize int
+}
+
+// DefaultCacheConfig returns the default cache configuration
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		BlockCacheSize: 512,
+	}
+}
+
+// Validate checks if the cache configuration is valid
+func (c *CacheConfig) Validate() error {
+	if c.BlockCacheSize <= 0 {
+		return fmt.Errorf("block cache size must be positive, got %d", c.BlockCacheSize)
+	}
+	return nil
+}
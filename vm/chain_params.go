@@ -0,0 +1,176 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"errors"
+	"time"
+
+	"github.com/MetalBlockchain/metalgo/ids"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg"
+)
+
+const (
+	// DefaultCoinbaseMaturity is the coinbase maturity recommended for the
+	// genesis of new chains. Wallets derived from bitcoind do not handle
+	// chains of coinbase spends, which instant finality would otherwise
+	// allow in consecutive blocks.
+	DefaultCoinbaseMaturity = 100
+
+	// legacyCoinbaseMaturity is the coinbase maturity of chains whose
+	// genesis does not set one, which were created when coinbase outputs
+	// could be spent in the next block
+	legacyCoinbaseMaturity = 0
+
+	// DefaultMaxFutureBlockTime is the maximum number of seconds a block
+	// time is allowed to be ahead of the current time on chains with
+	// monotonic timestamps when neither the genesis nor the upgrades set
+	// one. Blocks are produced every couple of seconds, so the 2 hours
+	// allowed by Bitcoin would let proposers with fast clocks push the
+	// block times far ahead of the current time.
+	DefaultMaxFutureBlockTime = 5
+)
+
+var errInvalidMaxFutureBlockTime = errors.New("maxFutureBlockTime must be positive")
+
+// ChainParams overrides consensus rules of the btcd chain params, and policies
+// every node of the network should agree on. They must be the same on every
+// node validating the chain, so they are given by the genesis rather than by
+// the node config.
+type ChainParams struct {
+	// CoinbaseMaturity is the number of blocks before the outputs of a
+	// coinbase can be spent, both in blocks and in the mempool. It defaults
+	// to legacyCoinbaseMaturity so that existing chains keep validating
+	// their blocks.
+	CoinbaseMaturity *uint16 `json:"coinbaseMaturity"`
+
+	// PoWDisabled requires the bits of every block to be the proof of work
+	// limit, as blocks are produced by consensus without mining. Otherwise
+	// the difficulty is retargeted as if blocks were mined, every 2016
+	// blocks, which existing chains keep doing.
+	PoWDisabled bool `json:"powDisabled"`
+
+	// MaxFutureBlockTime is the maximum number of seconds a block time is
+	// allowed to be ahead of the current time of the nodes verifying the
+	// block. It only applies to blocks as they are verified, so the
+	// upgrades can change it. It defaults to DefaultMaxFutureBlockTime with
+	// monotonic timestamps, and to the 2 hours of Bitcoin otherwise, since
+	// blocks built faster than the median time advances must be
+	// timestamped ahead of the current time.
+	MaxFutureBlockTime *uint32 `json:"maxFutureBlockTime"`
+
+	// MonotonicTimestamps requires block times not to be before the time of
+	// their parent rather than after the median time of the last 11 blocks,
+	// which lags about 10 seconds behind the tip and lets block times go
+	// backwards. Existing chains, whose blocks may not all be monotonic,
+	// keep the median time.
+	MonotonicTimestamps bool `json:"monotonicTimestamps"`
+
+	// IncreasingTimestamps requires block times to be at least one second
+	// after the time of their parent, which blocks built by the VM always
+	// are. Proposers pace blocks TargetBlockTime apart, so block times only
+	// run ahead of the current time when blocks come faster than one per
+	// second. Existing chains, whose blocks may share the time of their
+	// parent, don't enforce it.
+	IncreasingTimestamps bool `json:"increasingTimestamps"`
+
+	// AcceptDataCarrier accepts transactions with OP_RETURN outputs
+	// carrying data into the mempool and blocks built by the node. It
+	// defaults to true. Blocks carrying data remain valid either way.
+	AcceptDataCarrier *bool `json:"acceptDataCarrier"`
+
+	// MaxDataCarrierSize is the maximum number of bytes of data carried by
+	// the OP_RETURN outputs of a transaction accepted into the mempool and
+	// blocks built by the node, in total. It defaults to the 80 bytes of
+	// Bitcoin. Standard transactions have a single OP_RETURN output, but
+	// btcvm networks accept non-standard transactions.
+	MaxDataCarrierSize *uint32 `json:"maxDataCarrierSize"`
+
+	// DistinctNetworkMagic derives the network magic of the chain from its
+	// chain ID and registers the network, so that its addresses are told
+	// apart from those of other networks. Existing chains, whose block files
+	// are written with the simnet magic, keep it.
+	DistinctNetworkMagic bool `json:"distinctNetworkMagic"`
+
+	// Addresses overrides the prefixes of the addresses and keys of the
+	// network. It requires DistinctNetworkMagic, as networks are registered
+	// by their magic.
+	Addresses *AddressParams `json:"addresses"`
+}
+
+// Validate checks if the chain params are valid
+func (p *ChainParams) Validate() error {
+	if p.Addresses != nil {
+		if !p.DistinctNetworkMagic {
+			return errAddressesNeedMagic
+		}
+		if err := p.Addresses.Validate(); err != nil {
+			return err
+		}
+	}
+	return validateMaxFutureBlockTime(p.MaxFutureBlockTime)
+}
+
+// validateMaxFutureBlockTime checks if a maximum future block time is
+// positive, when set
+func validateMaxFutureBlockTime(maxFutureBlockTime *uint32) error {
+	if maxFutureBlockTime != nil && *maxFutureBlockTime == 0 {
+		return errInvalidMaxFutureBlockTime
+	}
+	return nil
+}
+
+// coinbaseMaturity returns the coinbase maturity of the chain
+func (p *ChainParams) coinbaseMaturity() uint16 {
+	if p.CoinbaseMaturity == nil {
+		return legacyCoinbaseMaturity
+	}
+	return *p.CoinbaseMaturity
+}
+
+// maxFutureBlockTime returns the maximum future block time of the chain, zero
+// being the btcd default
+func (p *ChainParams) maxFutureBlockTime() time.Duration {
+	if p.MaxFutureBlockTime == nil {
+		if p.MonotonicTimestamps {
+			return DefaultMaxFutureBlockTime * time.Second
+		}
+		return 0
+	}
+	return time.Duration(*p.MaxFutureBlockTime) * time.Second
+}
+
+// apply replaces the chain params of the btcd config with a copy carrying the
+// overrides, leaving the params of the network unchanged, and sets the
+// policies of the btcd config
+func (p *ChainParams) apply(btcdConfig *btcd.Config) {
+	params := *btcdConfig.ChainParams
+	params.CoinbaseMaturity = p.coinbaseMaturity()
+	params.PoWDisabled = p.PoWDisabled
+	params.MaxFutureBlockTime = p.maxFutureBlockTime()
+	params.MonotonicTimestamps = p.MonotonicTimestamps
+	if p.Addresses != nil {
+		p.Addresses.apply(&params)
+	}
+	btcdConfig.ChainParams = &params
+
+	if p.AcceptDataCarrier != nil {
+		btcdConfig.NoDataCarrier = !*p.AcceptDataCarrier
+	}
+	if p.MaxDataCarrierSize != nil {
+		btcdConfig.MaxDataCarrierSize = *p.MaxDataCarrierSize
+	}
+}
+
+// registerNetwork sets the network magic of params, the chain params of the
+// chain chainID, and registers the network when the chain has its own magic
+func (p *ChainParams) registerNetwork(params *chaincfg.Params, chainID ids.ID) error {
+	if !p.DistinctNetworkMagic {
+		return nil
+	}
+	params.Net = NetworkMagic(chainID)
+	return registerNetwork(params)
+}
@@ -0,0 +1,270 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/stretchr/testify/require"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+)
+
+func TestCoinbaseMaturity(t *testing.T) {
+	const maturity = 2
+
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithGenesis(t, 1, key, "", `"chainParams":{"coinbaseMaturity":2}`, nil)[0]
+	require.Equal(uint16(maturity), vm.config.ChainParams.CoinbaseMaturity)
+	require.Zero(btcd.BtcvmTestNetParms.CoinbaseMaturity)
+
+	buildTestChain(t, vm, 1)
+	coinbase := acceptedBlocks(t, vm)[0].(*BlockAdapter).btcBlock.Transactions()[0]
+	mempool := vm.btcdAdapter.TxMemPool()
+
+	// The next block is maturity-1 blocks after the coinbase
+	spend := newTestSpend(t, key, coinbase.MsgTx())
+	_, err = mempool.ProcessTransaction(spend, false, false, 0)
+	require.ErrorContains(err, "before required maturity")
+
+	// The block after it is maturity blocks after the coinbase
+	buildTestChain(t, vm, maturity-1)
+	_, err = mempool.ProcessTransaction(spend, false, false, 0)
+	require.NoError(err)
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.Len(blk.(*BlockAdapter).btcBlock.Transactions(), 2)
+	require.Equal(uint64(1+maturity), blk.Height())
+}
+
+func TestCoinbaseMaturityValidation(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+
+	// Chains whose genesis sets no maturity allow spending coinbases in the
+	// next block
+	legacy := newTestVMs(t, 1, key)[0]
+	require.Equal(uint16(legacyCoinbaseMaturity), legacy.config.ChainParams.CoinbaseMaturity)
+	buildTestChain(t, legacy, 1)
+	coinbase := acceptedBlocks(t, legacy)[0].(*BlockAdapter).btcBlock.Transactions()[0]
+	_, err = legacy.btcdAdapter.TxMemPool().ProcessTransaction(newTestSpend(t, key, coinbase.MsgTx()), false, false, 0)
+	require.NoError(err)
+	buildTestChain(t, legacy, 1)
+	blks := acceptedBlocks(t, legacy)
+	require.Len(blks[1].(*BlockAdapter).btcBlock.Transactions(), 2)
+
+	// Nodes enforcing a maturity reject such blocks
+	vm := newTestVMsWithGenesis(t, 1, key, "", `"chainParams":{"coinbaseMaturity":2}`, nil)[0]
+	_, err = vm.ParseBlock(ctx, blks[0].Bytes())
+	require.NoError(err)
+	_, err = vm.ParseBlock(ctx, blks[1].Bytes())
+	require.ErrorContains(err, "before required maturity")
+}
+
+func TestPoWDisabled(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithGenesis(t, 1, key, "", `"chainParams":{"powDisabled":true}`, nil)[0]
+	require.True(vm.config.ChainParams.PoWDisabled)
+	require.False(btcd.BtcvmTestNetParms.PoWDisabled)
+
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.Equal(vm.config.ChainParams.PowLimitBits, blk.(*BlockAdapter).btcBlock.MsgBlock().Header.Bits)
+	require.NoError(blk.Verify(ctx))
+}
+
+func TestProposerClockAhead(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vms := newTestVMsWithGenesis(t, 2, key, "", `"chainParams":{"monotonicTimestamps":true}`, nil)
+	proposer, validator := vms[0], vms[1]
+	require.True(proposer.config.ChainParams.MonotonicTimestamps)
+	require.Equal(DefaultMaxFutureBlockTime*time.Second, proposer.config.ChainParams.MaxFutureBlockTime)
+
+	// The clock of the proposer is 3 seconds ahead of the clock of the
+	// validator
+	timeSource := proposer.btcdAdapter.TimeSource()
+	for i := 0; i < 5; i++ {
+		timeSource.AddTimeSample(fmt.Sprintf("peer%d", i), time.Now().Add(3*time.Second))
+	}
+	require.Equal(3*time.Second, timeSource.Offset())
+
+	buildTestChain(t, proposer, 1)
+	ahead, err := proposer.GetBlock(ctx, proposer.lastAccepted)
+	require.NoError(err)
+	aheadTime := ahead.(*BlockAdapter).btcBlock.MsgBlock().Header.Timestamp
+	require.True(aheadTime.After(time.Now()))
+
+	// Validators accept blocks within the maximum future block time
+	blk, err := validator.ParseBlock(ctx, ahead.Bytes())
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(validator.SetPreference(ctx, blk.ID()))
+	require.NoError(blk.Accept(ctx))
+
+	// The next block is not timestamped before its parent although the
+	// clock of its proposer is behind the parent
+	buildTestChain(t, validator, 1)
+	next, err := validator.GetBlock(ctx, validator.lastAccepted)
+	require.NoError(err)
+	require.False(next.(*BlockAdapter).btcBlock.MsgBlock().Header.Timestamp.Before(aheadTime))
+	blk, err = proposer.ParseBlock(ctx, next.Bytes())
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+
+	// Nodes allowing block times one second ahead reject the block of the
+	// proposer
+	strict := newTestVMsWithGenesis(t, 1, key, "", `"chainParams":{"monotonicTimestamps":true,"maxFutureBlockTime":1}`, nil)[0]
+	require.Equal(time.Second, strict.config.ChainParams.MaxFutureBlockTime)
+	blk, err = strict.ParseBlock(ctx, ahead.Bytes())
+	if err == nil {
+		err = blk.Verify(ctx)
+	}
+	require.ErrorContains(err, "too far in the future")
+}
+
+func TestMaxFutureBlockTimeUpgrade(t *testing.T) {
+	require := require.New(t)
+
+	zero := uint32(0)
+	require.ErrorIs((&ChainParams{MaxFutureBlockTime: &zero}).Validate(), errInvalidMaxFutureBlockTime)
+
+	upgrades, err := parseUpgradeBytes([]byte(`{"maxFutureBlockTime":0}`))
+	require.NoError(err)
+	require.ErrorIs(upgrades.Validate(), errInvalidMaxFutureBlockTime)
+
+	// The upgrades replace the maximum future block time of the genesis
+	config := &btcd.Config{ChainParams: &btcd.BtcvmTestNetParms}
+	(&ChainParams{}).apply(config)
+	require.Zero(config.ChainParams.MaxFutureBlockTime)
+	(&ChainParams{MonotonicTimestamps: true}).apply(config)
+	require.Equal(DefaultMaxFutureBlockTime*time.Second, config.ChainParams.MaxFutureBlockTime)
+	upgrades, err = parseUpgradeBytes([]byte(`{"maxFutureBlockTime":10}`))
+	require.NoError(err)
+	require.NoError(upgrades.Validate())
+	upgrades.apply(config)
+	require.Equal(10*time.Second, config.ChainParams.MaxFutureBlockTime)
+	require.Zero(btcd.BtcvmTestNetParms.MaxFutureBlockTime)
+}
+
+func TestDataCarrier(t *testing.T) {
+	const maxDataCarrierSize = 100
+
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithGenesis(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, `"chainParams":{"maxDataCarrierSize":100}`, nil)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+	txPool := vm.btcdAdapter.TxMemPool()
+
+	var info btcjson.GetMempoolInfoResult
+	callRPC(t, handlers["/rpc"], "getmempoolinfo", nil, &info)
+	require.True(info.DataCarrier)
+	require.Equal(uint32(maxDataCarrierSize), info.MaxDataCarrierSize)
+
+	// Fund outputs paying key
+	buildTestChain(t, vm, 1)
+	coinbase := acceptedBlocks(t, vm)[0].(*BlockAdapter).btcBlock.Transactions()[0].MsgTx()
+	split := newTestSplitTx(t, key, coinbase, 0, 4)
+	_, err = txPool.ProcessTransaction(split, false, false, 0)
+	require.NoError(err)
+	buildTestChain(t, vm, 1)
+
+	// dataCarrierTx spends the split output at index with an OP_RETURN
+	// output carrying each of dataSizes bytes
+	dataCarrierTx := func(index uint32, dataSizes ...int) *btcutil.Tx {
+		msgTx := newTestSplitTx(t, key, split.MsgTx(), index, 1).MsgTx()
+		for _, size := range dataSizes {
+			pkScript, err := txscript.NewScriptBuilder().
+				AddOp(txscript.OP_RETURN).
+				AddData(bytes.Repeat([]byte{0x01}, size)).
+				Script()
+			require.NoError(err)
+			msgTx.AddTxOut(wire.NewTxOut(0, pkScript))
+		}
+		prevOut := split.MsgTx().TxOut[index]
+		sigScript, err := txscript.SignatureScript(msgTx, 0, prevOut.PkScript, txscript.SigHashAll, key, true)
+		require.NoError(err)
+		msgTx.TxIn[0].SignatureScript = sigScript
+		return btcutil.NewTx(msgTx)
+	}
+
+	// Data beyond the 80 bytes of Bitcoin is accepted up to the limit of
+	// the chain
+	atLimit := dataCarrierTx(0, maxDataCarrierSize)
+	_, err = txPool.ProcessTransaction(atLimit, false, false, 0)
+	require.NoError(err)
+
+	// One byte more is rejected, whether submitted or gossiped
+	overLimit := dataCarrierTx(1, maxDataCarrierSize+1)
+	_, err = txPool.ProcessTransaction(overLimit, false, false, 0)
+	require.ErrorContains(err, "data carrier size 101 is larger than max allowed size 100")
+	err = vm.btcSet.Add(NewTxGossip(overLimit))
+	require.ErrorContains(err, "data carrier size 101 is larger than max allowed size 100")
+	reason, ok := vm.btcSet.rejected.Get(hashToID(overLimit.Hash()))
+	require.True(ok)
+	require.Equal(wire.RejectNonstandard, reason)
+
+	// The limit applies to the data of all the OP_RETURN outputs of a
+	// transaction
+	_, err = txPool.ProcessTransaction(dataCarrierTx(2, 50, 51), false, false, 0)
+	require.ErrorContains(err, "data carrier size 101 is larger than max allowed size 100")
+	multiple := dataCarrierTx(3, 50, 50)
+	_, err = txPool.ProcessTransaction(multiple, false, false, 0)
+	require.NoError(err)
+
+	// Block templates include the transactions within the limit
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	var included []*chainhash.Hash
+	for _, tx := range blk.(*BlockAdapter).btcBlock.Transactions()[1:] {
+		included = append(included, tx.Hash())
+	}
+	require.ElementsMatch([]*chainhash.Hash{atLimit.Hash(), multiple.Hash()}, included)
+
+	// Chains not accepting data carriers reject any OP_RETURN output
+	strict := newTestVMsWithGenesis(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, `"chainParams":{"acceptDataCarrier":false}`, nil)[0]
+	handlers, err = strict.CreateHandlers(ctx)
+	require.NoError(err)
+	callRPC(t, handlers["/rpc"], "getmempoolinfo", nil, &info)
+	require.False(info.DataCarrier)
+	buildTestChain(t, strict, 1)
+	coinbase = acceptedBlocks(t, strict)[0].(*BlockAdapter).btcBlock.Transactions()[0].MsgTx()
+	split = newTestSplitTx(t, key, coinbase, 0, 1)
+	_, err = strict.btcdAdapter.TxMemPool().ProcessTransaction(split, false, false, 0)
+	require.NoError(err)
+	buildTestChain(t, strict, 1)
+	_, err = strict.btcdAdapter.TxMemPool().ProcessTransaction(dataCarrierTx(0, 0), false, false, 0)
+	require.ErrorContains(err, "data carrier outputs are not accepted")
+}
@@ -0,0 +1,403 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/MetalBlockchain/metalgo/database"
+	"github.com/MetalBlockchain/metalgo/database/prefixdb"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"go.uber.org/zap"
+
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+)
+
+// resyncLogInterval is the number of blocks re-applied between the progress
+// logs of a resync
+const resyncLogInterval = 1000
+
+var (
+	// acceptedBlockPrefix is the prefix of the IDs of the accepted blocks by
+	// height. Unlike the main chain of btcd, they only change when consensus
+	// accepts a block, so the chain state is resynced from them.
+	acceptedBlockPrefix = []byte("acceptedBlocks")
+
+	// acceptedHeightKey is the key of the height of the last recorded
+	// accepted block
+	acceptedHeightKey = []byte("acceptedHeight")
+
+	// resyncTargetKey is the key of the height a resync is bringing the
+	// chain state to. It is only set while a resync runs, so that an
+	// interrupted resync is resumed on startup.
+	resyncTargetKey = []byte("resyncTarget")
+)
+
+var (
+	errResyncBuilderActive  = errors.New("chain state can't be resynced while the block builder is active")
+	errResyncInterrupted    = errors.New("chain state resync interrupted by shutdown")
+	errAcceptedBlockMissing = errors.New("accepted block is not stored")
+	errBlockNotReconnected  = errors.New("accepted block was not connected to the main chain")
+)
+
+// chainResync tracks the resync of the chain state, of which at most one
+// runs at a time
+type chainResync struct {
+	lock   sync.Mutex
+	status btcjson.ResyncChainStateResult
+	// done is closed when the running resync returns, nil if none ran
+	done chan struct{}
+}
+
+// start marks a resync as running and returns true, or returns false if one
+// already is
+func (r *chainResync) start() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.status.Running {
+		return false
+	}
+	r.status = btcjson.ResyncChainStateResult{Running: true}
+	r.done = make(chan struct{})
+	return true
+}
+
+// update sets the heights of the running resync
+func (r *chainResync) update(startHeight, height, targetHeight uint64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.status.StartHeight = int64(startHeight)
+	r.status.Height = int64(height)
+	r.status.TargetHeight = int64(targetHeight)
+}
+
+// finish marks the running resync as returned with err
+func (r *chainResync) finish(err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.status.Running = false
+	if err != nil {
+		r.status.Error = err.Error()
+	}
+	close(r.done)
+}
+
+// get returns the status of the last resync
+func (r *chainResync) get() *btcjson.ResyncChainStateResult {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	status := r.status
+	return &status
+}
+
+// wait blocks until the running resync, if any, returns
+func (r *chainResync) wait() {
+	r.lock.Lock()
+	done := r.done
+	r.lock.Unlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+// initializeAcceptedBlocks opens the database of the accepted blocks,
+// recording those of the main chain not recorded yet, and resyncs the chain
+// state if requested by the config or if a resync was interrupted
+func (vm *VM) initializeAcceptedBlocks() error {
+	vm.acceptedBlockDB = prefixdb.New(acceptedBlockPrefix, vm.db)
+	vm.btcdAdapter.SetResyncChainState(vm.resyncChainStateRPC)
+
+	consistent, err := vm.indexAcceptedChain(vm.chain.BestSnapshot().Height)
+	if err != nil {
+		return fmt.Errorf("failed to record accepted blocks: %w", err)
+	}
+	interrupted, err := vm.db.Has(resyncTargetKey)
+	if err != nil {
+		return fmt.Errorf("failed to read chain state resync: %w", err)
+	}
+
+	switch {
+	case interrupted:
+		vm.ctx.Log.Info("Resuming interrupted chain state resync")
+	case vm.nodeConfig.ResyncChainState:
+	case !consistent:
+		vm.ctx.Log.Warn("Chain state diverges from the accepted chain",
+			zap.String("remedy", "resync it with the resyncchainstate RPC or the resyncChainState config"),
+		)
+		return nil
+	default:
+		return nil
+	}
+
+	vm.resync.start()
+	err = vm.resyncChainState()
+	vm.resync.finish(err)
+	if err != nil {
+		return fmt.Errorf("failed to resync chain state: %w", err)
+	}
+	return nil
+}
+
+// indexAcceptedChain records the main chain blocks above the last recorded
+// accepted block, up to tipHeight, as accepted. It returns false, recording
+// nothing, if the main chain does not contain the last recorded accepted
+// block.
+func (vm *VM) indexAcceptedChain(tipHeight int32) (bool, error) {
+	startHeight := int32(0)
+	height, err := database.GetUInt64(vm.db, acceptedHeightKey)
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+	case err != nil:
+		return false, err
+	default:
+		blkID, err := vm.acceptedBlockID(height)
+		if err != nil {
+			return false, err
+		}
+		if !vm.chain.MainChainHasBlock(idToHash(blkID)) {
+			return false, nil
+		}
+		startHeight = int32(height) + 1
+	}
+	if startHeight > tipHeight {
+		return true, nil
+	}
+
+	batch := vm.acceptedBlockDB.NewBatch()
+	for height := startHeight; height <= tipHeight; height++ {
+		hash, err := vm.chain.BlockHashByHeight(height)
+		if err != nil {
+			return false, err
+		}
+		if err := batch.Put(database.PackUInt64(uint64(height)), hash[:]); err != nil {
+			return false, err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return false, err
+	}
+	return true, database.PutUInt64(vm.db, acceptedHeightKey, uint64(tipHeight))
+}
+
+// recordAcceptedBlock persists the acceptance of the block at height.
+// Failures are logged since the block is accepted regardless.
+func (vm *VM) recordAcceptedBlock(height uint64, blkID ids.ID) {
+	err := vm.acceptedBlockDB.Put(database.PackUInt64(height), blkID[:])
+	if err == nil {
+		err = database.PutUInt64(vm.db, acceptedHeightKey, height)
+	}
+	if err != nil {
+		vm.ctx.Log.Warn("Failed to record accepted block",
+			zap.Stringer("id", blkID),
+			zap.Uint64("height", height),
+			zap.Error(err),
+		)
+	}
+}
+
+// acceptedBlockID returns the ID of the accepted block at height
+func (vm *VM) acceptedBlockID(height uint64) (ids.ID, error) {
+	blkID, err := database.GetID(vm.acceptedBlockDB, database.PackUInt64(height))
+	if err != nil {
+		return ids.Empty, fmt.Errorf("failed to read accepted block at height %d: %w", height, err)
+	}
+	return blkID, nil
+}
+
+// resyncChainStateRPC starts a resync of the chain state in the background
+// for the resyncchainstate RPC command, unless statusOnly is set or one is
+// running, and returns its status
+func (vm *VM) resyncChainStateRPC(statusOnly bool) (*btcjson.ResyncChainStateResult, error) {
+	if statusOnly {
+		return vm.resync.get(), nil
+	}
+
+	// The builder is started under builderLock, after any running resync
+	vm.builderLock.Lock()
+	defer vm.builderLock.Unlock()
+	if vm.blockBuilder != nil && vm.blockBuilder.active() {
+		return nil, errResyncBuilderActive
+	}
+	if !vm.resync.start() {
+		return vm.resync.get(), nil
+	}
+
+	vm.shutdownWg.Add(1)
+	go func() {
+		defer vm.shutdownWg.Done()
+
+		err := vm.resyncChainState()
+		if err != nil {
+			vm.ctx.Log.Error("Failed to resync chain state", zap.Error(err))
+		}
+		vm.resync.finish(err)
+	}()
+	return vm.resync.get(), nil
+}
+
+// resyncChainState brings the main chain of btcd back to the recorded
+// accepted chain. The main chain is disconnected back to the last height both
+// agree at, and the accepted blocks above it are connected again, rebuilding
+// the UTXO set and the indexes. Consensus is blocked meanwhile. Progress is
+// only kept by the chain state itself, so an interrupted resync starts over
+// from the height it reached.
+func (vm *VM) resyncChainState() error {
+	vm.blocksMu.Lock()
+	defer vm.blocksMu.Unlock()
+
+	targetHeight, err := database.GetUInt64(vm.db, acceptedHeightKey)
+	if err != nil {
+		return fmt.Errorf("failed to read last accepted height: %w", err)
+	}
+	if err := database.PutUInt64(vm.db, resyncTargetKey, targetHeight); err != nil {
+		return fmt.Errorf("failed to record chain state resync: %w", err)
+	}
+
+	startHeight, err := vm.rewindChainState(targetHeight)
+	if err != nil {
+		return err
+	}
+	vm.resync.update(startHeight, startHeight, targetHeight)
+	vm.ctx.Log.Info("Resyncing chain state",
+		zap.Uint64("startHeight", startHeight),
+		zap.Uint64("targetHeight", targetHeight),
+	)
+
+	height, loggedHeight := startHeight, startHeight
+	for height < targetHeight {
+		select {
+		case <-vm.shutdownChan:
+			return errResyncInterrupted
+		default:
+		}
+
+		blkID, err := vm.acceptedBlockID(height + 1)
+		if err != nil {
+			return err
+		}
+		if err := vm.reconnectBlock(blkID); err != nil {
+			return fmt.Errorf("failed to re-apply block %s at height %d: %w", blkID, height+1, err)
+		}
+		// Connecting a block may connect its descendants as well
+		next, err := vm.rewindChainState(targetHeight)
+		if err != nil {
+			return err
+		}
+		if next <= height {
+			return fmt.Errorf("%w: %s at height %d", errBlockNotReconnected, blkID, height+1)
+		}
+		height = next
+		vm.resync.update(startHeight, height, targetHeight)
+
+		if height-loggedHeight >= resyncLogInterval {
+			loggedHeight = height
+			vm.ctx.Log.Info("Resyncing chain state",
+				zap.Uint64("height", height),
+				zap.Uint64("targetHeight", targetHeight),
+			)
+		}
+	}
+
+	tipID, err := vm.acceptedBlockID(targetHeight)
+	if err != nil {
+		return err
+	}
+	vm.lastAccepted = tipID
+	vm.preferred = tipID
+	vm.finalize(tipID)
+	vm.btcdAdapter.NotifyBlockAccepted(idToHash(tipID), int32(targetHeight))
+	// Report the reorganization of the resync, and build the filters of
+	// the blocks it disconnected, once they are initialized
+	if vm.reorgs != nil {
+		vm.reorgs.complete()
+	}
+	if vm.blockFilterDB != nil {
+		vm.indexAcceptedBlockFilter(idToHash(tipID))
+	}
+	if err := vm.db.Delete(resyncTargetKey); err != nil {
+		return fmt.Errorf("failed to record chain state resync: %w", err)
+	}
+
+	vm.ctx.Log.Info("Resynced chain state",
+		zap.Uint64("startHeight", startHeight),
+		zap.Uint64("targetHeight", targetHeight),
+		zap.Stringer("tipID", tipID),
+	)
+	return nil
+}
+
+// rewindChainState returns the last height up to which the main chain of
+// btcd is the recorded accepted chain, at most targetHeight. Blocks of the
+// main chain conflicting with the accepted chain above it are invalidated, so
+// that it is the tip of the main chain unless it is targetHeight.
+func (vm *VM) rewindChainState(targetHeight uint64) (uint64, error) {
+	for {
+		tipHeight := uint64(vm.chain.BestSnapshot().Height)
+		height := min(targetHeight, tipHeight)
+		for ; height > 0; height-- {
+			blkID, err := vm.acceptedBlockID(height)
+			if err != nil {
+				return 0, err
+			}
+			if vm.chain.MainChainHasBlock(idToHash(blkID)) {
+				break
+			}
+		}
+		if height == targetHeight || height == tipHeight {
+			return height, nil
+		}
+
+		// Invalidating the conflicting block may reorganize the main chain
+		// to another branch, which is checked again
+		hash, err := vm.chain.BlockHashByHeight(int32(height) + 1)
+		if err != nil {
+			return 0, err
+		}
+		vm.ctx.Log.Info("Disconnecting block conflicting with the accepted chain",
+			zap.Stringer("hash", hash),
+			zap.Uint64("height", height+1),
+		)
+		if err := vm.chain.InvalidateBlock(hash); err != nil {
+			return 0, fmt.Errorf("failed to disconnect block %s: %w", hash, err)
+		}
+	}
+}
+
+// reconnectBlock connects the accepted block blkID, whose parent is the tip
+// of the main chain, back to the main chain
+func (vm *VM) reconnectBlock(blkID ids.ID) error {
+	hash := idToHash(blkID)
+	if _, err := vm.chain.BlockByHashAny(hash); err == nil {
+		// btcd only reorganizes to blocks it does not know to be valid, such
+		// as those invalidated by the rewind, so the block is invalidated
+		// first. Reconsidering it connects it with the same checks as when
+		// it was processed.
+		if err := vm.chain.InvalidateBlock(hash); err != nil {
+			return err
+		}
+		return vm.chain.ReconsiderBlock(hash)
+	}
+
+	// Blocks btcd lost are processed again if still cached
+	blk, ok := vm.blockCache.Get(blkID)
+	if !ok {
+		return fmt.Errorf("%w: %s", errAcceptedBlockMissing, blkID)
+	}
+	_, isOrphan, err := vm.processBlock(blk.btcBlock, blockchain.BFNone)
+	if err != nil {
+		return err
+	}
+	if isOrphan {
+		return fmt.Errorf("%w: %s is an orphan", errBlockNotReconnected, blkID)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MetalBlockchain/metalgo/database"
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+)
+
+func TestResyncChainState(t *testing.T) {
+	const numBlocks = 5
+
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, nil)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	buildTestChain(t, vm, numBlocks)
+	tipID := vm.lastAccepted
+	blkID, err := vm.acceptedBlockID(numBlocks)
+	require.NoError(err)
+	require.Equal(tipID, blkID)
+	tipBlock, err := vm.chain.BlockByHash(idToHash(tipID))
+	require.NoError(err)
+	coinbase := wire.OutPoint{Hash: *tipBlock.Transactions()[0].Hash()}
+
+	// corruptTip rolls the tip of the chain state back below height, as a
+	// corrupted tip pointer would
+	corruptTip := func(height int32) {
+		hash, err := vm.chain.BlockHashByHeight(height)
+		require.NoError(err)
+		require.NoError(vm.chain.InvalidateBlock(hash))
+		require.Equal(height-1, vm.chain.BestSnapshot().Height)
+		entry, err := vm.chain.FetchUtxoEntry(coinbase)
+		require.NoError(err)
+		require.Nil(entry)
+	}
+	// requireResynced checks that the chain state is back to the accepted
+	// chain, the coinbase of its tip included
+	requireResynced := func() {
+		best := vm.chain.BestSnapshot()
+		require.Equal(int32(numBlocks), best.Height)
+		require.Equal(idToHash(tipID), &best.Hash)
+		require.Equal(tipID, vm.lastAccepted)
+		entry, err := vm.chain.FetchUtxoEntry(coinbase)
+		require.NoError(err)
+		require.NotNil(entry)
+		has, err := vm.db.Has(resyncTargetKey)
+		require.NoError(err)
+		require.False(has)
+	}
+
+	// The resync runs in the background and is polled over RPC
+	corruptTip(3)
+	var status btcjson.ResyncChainStateResult
+	callRPC(t, handlers["/rpc"], "resyncchainstate", []interface{}{}, &status)
+	require.Eventually(func() bool {
+		callRPC(t, handlers["/rpc"], "resyncchainstate", []interface{}{true}, &status)
+		return !status.Running
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Equal(btcjson.ResyncChainStateResult{
+		StartHeight:  2,
+		Height:       numBlocks,
+		TargetHeight: numBlocks,
+	}, status)
+	requireResynced()
+
+	// A node starting on a corrupted chain state keeps it until asked to
+	// resync, its accepted blocks being left recorded
+	corruptTip(4)
+	require.NoError(vm.initializeAcceptedBlocks())
+	require.Equal(int32(3), vm.chain.BestSnapshot().Height)
+	blkID, err = vm.acceptedBlockID(numBlocks)
+	require.NoError(err)
+	require.Equal(tipID, blkID)
+
+	// An interrupted resync is resumed on startup
+	require.NoError(database.PutUInt64(vm.db, resyncTargetKey, numBlocks))
+	require.NoError(vm.initializeAcceptedBlocks())
+	requireResynced()
+	require.Equal(int64(3), vm.resync.get().StartHeight)
+
+	// The config resyncs on startup as well
+	corruptTip(1)
+	vm.nodeConfig.ResyncChainState = true
+	require.NoError(vm.initializeAcceptedBlocks())
+	requireResynced()
+	require.Zero(vm.resync.get().StartHeight)
+
+	// The resync is refused while blocks are built
+	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+	_, err = vm.resyncChainStateRPC(false)
+	require.ErrorIs(err, errResyncBuilderActive)
+}
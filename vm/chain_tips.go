@@ -0,0 +1,128 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/metalgo/database/prefixdb"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/utils/set"
+	"go.uber.org/zap"
+)
+
+// Consensus statuses of the chain tips reported by getchaintips
+const (
+	chainTipAccepted   = "accepted"
+	chainTipProcessing = "processing"
+	chainTipRejected   = "rejected"
+	chainTipOrphaned   = "orphaned"
+)
+
+// blockDecisionRetention is the number of blocks below the last accepted
+// block whose rejections are kept. Accepted blocks do not need to be recorded
+// as they are the main chain up to the last accepted block.
+const blockDecisionRetention = 4096
+
+var blockDecisionPrefix = []byte("blockDecisions")
+
+// initializeBlockDecisions opens the database of rejected blocks and reports
+// the consensus status of the chain tips to btcd
+func (vm *VM) initializeBlockDecisions() {
+	vm.blockDecisionDB = prefixdb.New(blockDecisionPrefix, vm.db)
+	vm.processing = set.Set[ids.ID]{}
+	vm.btcdAdapter.SetChainTipStatus(vm.chainTipStatus)
+}
+
+// blockDecisionKey returns the key of the rejection of a block. Keys are
+// ordered by height so that old rejections can be pruned.
+func blockDecisionKey(height uint64, blkID ids.ID) []byte {
+	key := make([]byte, 8+ids.IDLen)
+	binary.BigEndian.PutUint64(key, height)
+	copy(key[8:], blkID[:])
+	return key
+}
+
+// recordRejectedBlock persists the rejection of a block
+func (vm *VM) recordRejectedBlock(height uint64, blkID ids.ID) {
+	if err := vm.blockDecisionDB.Put(blockDecisionKey(height, blkID), nil); err != nil {
+		vm.ctx.Log.Warn("Failed to record rejected block",
+			zap.Stringer("id", blkID),
+			zap.Error(err),
+		)
+	}
+}
+
+// pruneBlockDecisions deletes the rejections of the blocks more than
+// blockDecisionRetention below the accepted block at height
+func (vm *VM) pruneBlockDecisions(height uint64) {
+	if height < blockDecisionRetention {
+		return
+	}
+	end := blockDecisionKey(height-blockDecisionRetention, ids.Empty)
+
+	it := vm.blockDecisionDB.NewIterator()
+	defer it.Release()
+	batch := vm.blockDecisionDB.NewBatch()
+	for it.Next() && bytes.Compare(it.Key(), end) < 0 {
+		if err := batch.Delete(slices.Clone(it.Key())); err != nil {
+			vm.ctx.Log.Warn("Failed to prune rejected blocks", zap.Error(err))
+			return
+		}
+	}
+	if err := it.Error(); err != nil {
+		vm.ctx.Log.Warn("Failed to prune rejected blocks", zap.Error(err))
+		return
+	}
+	if batch.Size() == 0 {
+		return
+	}
+	if err := batch.Write(); err != nil {
+		vm.ctx.Log.Warn("Failed to prune rejected blocks", zap.Error(err))
+	}
+}
+
+// chainTipStatus returns the consensus status of the chain tip with the given
+// hash and height. Tips are accepted if they are on the main chain at or
+// below the last accepted block, processing if consensus verified them but
+// did not decide them yet, rejected if consensus rejected them recently, and
+// orphaned otherwise, such as blocks btcd processed but consensus never
+// issued.
+func (vm *VM) chainTipStatus(hash *chainhash.Hash, height int32) string {
+	blkID := hashToID(hash)
+
+	vm.blocksMu.RLock()
+	defer vm.blocksMu.RUnlock()
+
+	if vm.processing.Contains(blkID) {
+		return chainTipProcessing
+	}
+
+	lastAcceptedHeight, err := vm.chain.BlockHeightByHash(idToHash(vm.lastAccepted))
+	if err != nil {
+		vm.ctx.Log.Warn("Failed to look up last accepted block", zap.Error(err))
+		return ""
+	}
+	if height <= lastAcceptedHeight && vm.chain.MainChainHasBlock(hash) {
+		return chainTipAccepted
+	}
+
+	if height >= 0 {
+		rejected, err := vm.blockDecisionDB.Has(blockDecisionKey(uint64(height), blkID))
+		if err != nil {
+			vm.ctx.Log.Warn("Failed to look up rejected block",
+				zap.Stringer("id", blkID),
+				zap.Error(err),
+			)
+			return ""
+		}
+		if rejected {
+			return chainTipRejected
+		}
+	}
+	return chainTipOrphaned
+}
@@ -0,0 +1,77 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/metalgo/ids"
+)
+
+func TestChainTipsConsensusStatus(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, nil)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+
+	// Chains of other keys fork the chain of vm at the genesis block
+	siblingBytes := func() []byte {
+		otherKey, err := btcec.NewPrivateKey()
+		require.NoError(err)
+		other := newTestVMs(t, 1, otherKey)[0]
+		buildTestChain(t, other, 1)
+		return acceptedBlocks(t, other)[0].Bytes()
+	}
+	chainTips := func() map[string]string {
+		var result []btcjson.GetChainTipsResult
+		callRPC(t, handlers["/rpc"], "getchaintips", nil, &result)
+		statuses := make(map[string]string, len(result))
+		for _, tip := range result {
+			statuses[tip.Hash] = tip.ConsensusStatus
+		}
+		return statuses
+	}
+	hash := func(blkID ids.ID) string {
+		return idToHash(blkID).String()
+	}
+
+	// Sibling blocks are processing until consensus decides between them
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	sibling, err := vm.ParseBlock(ctx, siblingBytes())
+	require.NoError(err)
+	require.NoError(sibling.Verify(ctx))
+	require.Equal(blk.Parent(), sibling.Parent())
+	require.Equal(map[string]string{
+		hash(blk.ID()):     chainTipProcessing,
+		hash(sibling.ID()): chainTipProcessing,
+	}, chainTips())
+
+	require.NoError(vm.SetPreference(ctx, blk.ID()))
+	require.NoError(blk.Accept(ctx))
+	require.NoError(sibling.Reject(ctx))
+
+	// Blocks consensus was never asked about are orphaned
+	orphan, err := vm.ParseBlock(ctx, siblingBytes())
+	require.NoError(err)
+	require.Equal(map[string]string{
+		hash(blk.ID()):     chainTipAccepted,
+		hash(sibling.ID()): chainTipRejected,
+		hash(orphan.ID()):  chainTipOrphaned,
+	}, chainTips())
+
+	// Old rejections are pruned
+	vm.pruneBlockDecisions(sibling.Height() + blockDecisionRetention + 1)
+	require.Equal(chainTipOrphaned, chainTips()[hash(sibling.ID())])
+}
@@ -0,0 +1,394 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"go.uber.org/zap"
+)
+
+const (
+	// ChainStateBlocksFile is the file of an export directory holding the
+	// blocks, in the format of the blk files of bitcoind: each block is
+	// prefixed by the network magic and its length, both little-endian.
+	ChainStateBlocksFile = "blocks.dat"
+
+	// ChainStateManifestFile is the file of an export directory holding the
+	// ChainStateManifest as JSON
+	ChainStateManifestFile = "manifest.json"
+
+	// chainStateRecordHeaderLen is the length of the magic and length prefix
+	// of each block
+	chainStateRecordHeaderLen = 8
+)
+
+var (
+	errChainStateExists     = errors.New("chain state export already exists")
+	errInvalidChainState    = errors.New("invalid chain state export")
+	errChainStateConflict   = errors.New("chain state export conflicts with the accepted chain")
+	errImportAfterBootstrap = errors.New("chain state can only be imported before bootstrapping")
+)
+
+// ChainStateCheckpoint is a block trusted by the importer of a chain state
+// export. The transactions of blocks up to the checkpoint are not validated,
+// signatures included, since they are committed to by the checkpoint hash.
+type ChainStateCheckpoint struct {
+	Height uint64 `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+// ChainStateManifest describes the blocks of a chain state export, from
+// genesis to the tip
+type ChainStateManifest struct {
+	Network    string                `json:"network"`
+	Genesis    string                `json:"genesis"`
+	TipHeight  uint64                `json:"tipHeight"`
+	TipHash    string                `json:"tipHash"`
+	Checksum   string                `json:"checksum"`
+	Checkpoint *ChainStateCheckpoint `json:"checkpoint,omitempty"`
+}
+
+// ExportChainState writes the accepted chain to a new directory dir. The
+// blocks file is written before the manifest, so an export is complete once
+// its manifest exists. The tip of the export is its checkpoint.
+func (vm *VM) ExportChainState(dir string) (*ChainStateManifest, error) {
+	if !vm.initialized {
+		return nil, errNotInitialized
+	}
+
+	manifestPath := filepath.Join(dir, ChainStateManifestFile)
+	if _, err := os.Stat(manifestPath); err == nil {
+		return nil, fmt.Errorf("%w: %s", errChainStateExists, manifestPath)
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	vm.blocksMu.RLock()
+	lastAccepted := vm.lastAccepted
+	vm.blocksMu.RUnlock()
+	tipHash := idToHash(lastAccepted)
+	tipHeight, err := vm.chain.BlockHeightByHash(tipHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up last accepted block: %w", err)
+	}
+
+	blocksPath := filepath.Join(dir, ChainStateBlocksFile)
+	checksum, err := vm.writeChainStateBlocks(blocksPath, tipHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	params := vm.config.ChainParams
+	manifest := &ChainStateManifest{
+		Network:   params.Name,
+		Genesis:   params.GenesisHash.String(),
+		TipHeight: uint64(tipHeight),
+		TipHash:   tipHash.String(),
+		Checksum:  checksum,
+		Checkpoint: &ChainStateCheckpoint{
+			Height: uint64(tipHeight),
+			Hash:   tipHash.String(),
+		},
+	}
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := os.WriteFile(manifestPath, manifestBytes, 0o640); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	vm.ctx.Log.Info("Exported chain state",
+		zap.String("dir", dir),
+		zap.Int32("tipHeight", tipHeight),
+		zap.Stringer("tipHash", tipHash),
+	)
+	return manifest, nil
+}
+
+// exportChainStateRPC exports the accepted chain to dir for the
+// exportchainstate RPC command
+func (vm *VM) exportChainStateRPC(dir string) (*btcjson.ExportChainStateResult, error) {
+	manifest, err := vm.ExportChainState(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &btcjson.ExportChainStateResult{
+		Dir:       dir,
+		TipHeight: int64(manifest.TipHeight),
+		TipHash:   manifest.TipHash,
+		Checksum:  manifest.Checksum,
+	}, nil
+}
+
+// writeChainStateBlocks writes the main chain blocks from genesis to
+// tipHeight to path and returns the hex-encoded SHA-256 of the file
+func (vm *VM) writeChainStateBlocks(path string, tipHeight int32) (string, error) {
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o640)
+	if err != nil {
+		return "", fmt.Errorf("failed to create blocks file: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(tmpPath)
+	}()
+
+	var (
+		hash   = sha256.New()
+		writer = bufio.NewWriter(io.MultiWriter(file, hash))
+		header [chainStateRecordHeaderLen]byte
+		buf    bytes.Buffer
+	)
+	binary.LittleEndian.PutUint32(header[:4], uint32(vm.config.ChainParams.Net))
+	for height := int32(0); height <= tipHeight; height++ {
+		block, err := vm.chain.BlockByHeight(height)
+		if err != nil {
+			return "", fmt.Errorf("failed to read block at height %d: %w", height, err)
+		}
+		buf.Reset()
+		if err := block.MsgBlock().Serialize(&buf); err != nil {
+			return "", fmt.Errorf("failed to serialize block at height %d: %w", height, err)
+		}
+		binary.LittleEndian.PutUint32(header[4:], uint32(buf.Len()))
+		if _, err := writer.Write(header[:]); err != nil {
+			return "", fmt.Errorf("failed to write blocks file: %w", err)
+		}
+		if _, err := writer.Write(buf.Bytes()); err != nil {
+			return "", fmt.Errorf("failed to write blocks file: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return "", fmt.Errorf("failed to write blocks file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return "", fmt.Errorf("failed to sync blocks file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return "", fmt.Errorf("failed to rename blocks file: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ImportChainState replays the blocks exported to dir by ExportChainState.
+// The export is validated in full before any block is processed: its
+// checksum, that its blocks link from genesis to its tip, and that it
+// extends the accepted chain. Blocks up to the checkpoint of the manifest are
+// then added without validating their transactions, as in headers-first
+// sync. Blocks already known are skipped, so an interrupted import can be
+// resumed.
+func (vm *VM) ImportChainState(dir string) error {
+	if !vm.initialized {
+		return errNotInitialized
+	}
+	if vm.bootstrapped {
+		return errImportAfterBootstrap
+	}
+
+	manifestBytes, err := os.ReadFile(filepath.Join(dir, ChainStateManifestFile))
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	manifest := &ChainStateManifest{}
+	if err := json.Unmarshal(manifestBytes, manifest); err != nil {
+		return fmt.Errorf("%w: failed to parse manifest: %w", errInvalidChainState, err)
+	}
+	blocksPath := filepath.Join(dir, ChainStateBlocksFile)
+	if err := vm.validateChainState(blocksPath, manifest); err != nil {
+		return err
+	}
+
+	checkpointHeight := int64(-1)
+	if manifest.Checkpoint != nil {
+		checkpointHeight = int64(manifest.Checkpoint.Height)
+	}
+	var imported int
+	err = vm.readChainStateBlocks(blocksPath, func(height int32, block *btcutil.Block) error {
+		have, err := vm.chain.HaveBlock(block.Hash())
+		if err != nil {
+			return fmt.Errorf("failed to look up block %s: %w", block.Hash(), err)
+		}
+		if have {
+			return nil
+		}
+
+		flags := blockchain.BFNone
+		if int64(height) <= checkpointHeight {
+			flags |= blockchain.BFFastAdd
+		}
+		_, isOrphan, err := vm.processBlock(block, flags)
+		if err != nil {
+			return fmt.Errorf("failed to process block %s at height %d: %w", block.Hash(), height, err)
+		}
+		if isOrphan {
+			return fmt.Errorf("%w: block %s at height %d is an orphan", errInvalidChainState, block.Hash(), height)
+		}
+		imported++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	tipHash, err := chainhash.NewHashFromStr(manifest.TipHash)
+	if err != nil {
+		return fmt.Errorf("%w: invalid tip hash: %w", errInvalidChainState, err)
+	}
+	vm.blocksMu.Lock()
+	acceptedHeight, err := vm.chain.BlockHeightByHash(idToHash(vm.lastAccepted))
+	if err == nil && uint64(acceptedHeight) < manifest.TipHeight {
+		vm.lastAccepted = hashToID(tipHash)
+		vm.preferred = vm.lastAccepted
+		vm.btcdAdapter.NotifyBlockAccepted(tipHash, int32(manifest.TipHeight))
+	}
+	vm.blocksMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to look up last accepted block: %w", err)
+	}
+	if _, err := vm.indexAcceptedChain(max(acceptedHeight, int32(manifest.TipHeight))); err != nil {
+		return fmt.Errorf("failed to record accepted blocks: %w", err)
+	}
+	vm.indexAcceptedBlockFilter(idToHash(vm.lastAccepted))
+
+	vm.ctx.Log.Info("Imported chain state",
+		zap.String("dir", dir),
+		zap.Int("imported", imported),
+		zap.Uint64("tipHeight", manifest.TipHeight),
+		zap.String("tipHash", manifest.TipHash),
+	)
+	return nil
+}
+
+// validateChainState checks that the blocks file at path matches manifest
+// and extends the accepted chain, without processing any block
+func (vm *VM) validateChainState(path string, manifest *ChainStateManifest) error {
+	params := vm.config.ChainParams
+	if manifest.Network != params.Name {
+		return fmt.Errorf("%w: network %q, expected %q", errInvalidChainState, manifest.Network, params.Name)
+	}
+	if manifest.Genesis != params.GenesisHash.String() {
+		return fmt.Errorf("%w: genesis %s, expected %s", errInvalidChainState, manifest.Genesis, params.GenesisHash)
+	}
+	if manifest.Checkpoint != nil && manifest.Checkpoint.Height > manifest.TipHeight {
+		return fmt.Errorf("%w: checkpoint at height %d is above the tip", errInvalidChainState, manifest.Checkpoint.Height)
+	}
+
+	vm.blocksMu.RLock()
+	acceptedHash := idToHash(vm.lastAccepted)
+	vm.blocksMu.RUnlock()
+	acceptedHeight, err := vm.chain.BlockHeightByHash(acceptedHash)
+	if err != nil {
+		return fmt.Errorf("failed to look up last accepted block: %w", err)
+	}
+	// The export must contain the accepted block, or the accepted chain
+	// must contain the tip of the export
+	compareHeight := min(uint64(acceptedHeight), manifest.TipHeight)
+	compareHash, err := vm.chain.BlockHashByHeight(int32(compareHeight))
+	if err != nil {
+		return fmt.Errorf("failed to look up accepted block at height %d: %w", compareHeight, err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open blocks file: %w", err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return fmt.Errorf("failed to read blocks file: %w", err)
+	}
+	if checksum := hex.EncodeToString(hash.Sum(nil)); checksum != manifest.Checksum {
+		return fmt.Errorf("%w: checksum %s, expected %s", errInvalidChainState, checksum, manifest.Checksum)
+	}
+
+	var (
+		prevHash chainhash.Hash
+		count    uint64
+	)
+	err = vm.readChainStateBlocks(path, func(height int32, block *btcutil.Block) error {
+		blockHash := block.Hash()
+		switch {
+		case height == 0 && !blockHash.IsEqual(params.GenesisHash):
+			return fmt.Errorf("%w: first block %s is not the genesis block", errInvalidChainState, blockHash)
+		case height > 0 && block.MsgBlock().Header.PrevBlock != prevHash:
+			return fmt.Errorf("%w: block %s at height %d does not extend %s", errInvalidChainState, blockHash, height, prevHash)
+		case uint64(height) == compareHeight && !blockHash.IsEqual(compareHash):
+			return fmt.Errorf("%w: block %s at height %d, accepted %s", errChainStateConflict, blockHash, height, compareHash)
+		case !vm.chain.VerifyCheckpoint(height, blockHash):
+			return fmt.Errorf("%w: block %s at height %d", errCheckpointMismatch, blockHash, height)
+		case manifest.Checkpoint != nil && uint64(height) == manifest.Checkpoint.Height && blockHash.String() != manifest.Checkpoint.Hash:
+			return fmt.Errorf("%w: block %s at height %d, checkpoint %s", errInvalidChainState, blockHash, height, manifest.Checkpoint.Hash)
+		}
+		prevHash = *blockHash
+		count++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if count != manifest.TipHeight+1 || prevHash.String() != manifest.TipHash {
+		return fmt.Errorf("%w: %d blocks ending with %s, expected tip %s at height %d",
+			errInvalidChainState, count, prevHash, manifest.TipHash, manifest.TipHeight)
+	}
+	return nil
+}
+
+// readChainStateBlocks calls fn with each block of the blocks file at path
+// and its height
+func (vm *VM) readChainStateBlocks(path string, fn func(height int32, block *btcutil.Block) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open blocks file: %w", err)
+	}
+	defer file.Close()
+
+	var (
+		reader = bufio.NewReader(file)
+		header [chainStateRecordHeaderLen]byte
+		net    = uint32(vm.config.ChainParams.Net)
+	)
+	for height := int32(0); ; height++ {
+		if _, err := io.ReadFull(reader, header[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%w: failed to read block at height %d: %w", errInvalidChainState, height, err)
+		}
+		if magic := binary.LittleEndian.Uint32(header[:4]); magic != net {
+			return fmt.Errorf("%w: network magic %#x at height %d", errInvalidChainState, magic, height)
+		}
+		length := binary.LittleEndian.Uint32(header[4:])
+		if length > wire.MaxBlockPayload {
+			return fmt.Errorf("%w: block of %d bytes at height %d", errInvalidChainState, length, height)
+		}
+		blockBytes := make([]byte, length)
+		if _, err := io.ReadFull(reader, blockBytes); err != nil {
+			return fmt.Errorf("%w: failed to read block at height %d: %w", errInvalidChainState, height, err)
+		}
+		block, err := btcutil.NewBlockFromBytes(blockBytes)
+		if err != nil {
+			return fmt.Errorf("%w: failed to parse block at height %d: %w", errInvalidChainState, height, err)
+		}
+		block.SetHeight(height)
+		if err := fn(height, block); err != nil {
+			return err
+		}
+	}
+}
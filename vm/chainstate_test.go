@@ -0,0 +1,123 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/stretchr/testify/require"
+)
+
+// buildTestChain builds and accepts numBlocks blocks on vm
+func buildTestChain(t testing.TB, vm *VM, numBlocks int) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	for i := 0; i < numBlocks; i++ {
+		blk, err := vm.BuildBlock(ctx)
+		require.NoError(err)
+		require.NoError(blk.Verify(ctx))
+		require.NoError(vm.SetPreference(ctx, blk.ID()))
+		require.NoError(blk.Accept(ctx))
+	}
+}
+
+func TestChainStateExportImport(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vms := newTestVMsWithConfig(t, 2, key, `"rpcUser":"user","rpcPass":"pass"`, nil)
+	server, client := vms[0], vms[1]
+	handlers, err := server.CreateHandlers(ctx)
+	require.NoError(err)
+	_, err = client.CreateHandlers(ctx)
+	require.NoError(err)
+
+	// The chain has a transaction spending a coinbase, whose signature is not
+	// checked on import
+	buildTestChain(t, server, 1)
+	blk, err := server.GetBlock(ctx, server.lastAccepted)
+	require.NoError(err)
+	spend := newTestSpend(t, key, blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx())
+	_, err = server.btcdAdapter.TxMemPool().ProcessTransaction(spend, false, false, 0)
+	require.NoError(err)
+	buildTestChain(t, server, 49)
+
+	dir := filepath.Join(t.TempDir(), "export")
+	var result btcjson.ExportChainStateResult
+	callRPC(t, handlers["/rpc"], "exportchainstate", []interface{}{dir}, &result)
+	require.Equal(dir, result.Dir)
+	require.Equal(int64(50), result.TipHeight)
+	require.Equal(idToHash(server.lastAccepted).String(), result.TipHash)
+
+	// An export is never overwritten
+	_, err = server.ExportChainState(dir)
+	require.ErrorIs(err, errChainStateExists)
+
+	require.NoError(client.ImportChainState(dir))
+	lastAccepted, err := client.LastAccepted(ctx)
+	require.NoError(err)
+	require.Equal(server.lastAccepted, lastAccepted)
+	for _, height := range []uint64{1, 2, 25, 50} {
+		want, err := server.GetBlockIDAtHeight(ctx, height)
+		require.NoError(err)
+		got, err := client.GetBlockIDAtHeight(ctx, height)
+		require.NoError(err)
+		require.Equal(want, got)
+	}
+	entry, err := client.chain.FetchUtxoEntry(spend.MsgTx().TxIn[0].PreviousOutPoint)
+	require.NoError(err)
+	require.True(entry == nil || entry.IsSpent())
+
+	// Importing again is a no-op, and the imported chain is extended as usual
+	require.NoError(client.ImportChainState(dir))
+	buildTestChain(t, client, 1)
+}
+
+func TestChainStateImportInvalid(t *testing.T) {
+	require := require.New(t)
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vms := newTestVMs(t, 2, key)
+	server, client := vms[0], vms[1]
+	buildTestChain(t, server, 5)
+
+	dir := filepath.Join(t.TempDir(), "export")
+	manifest, err := server.ExportChainState(dir)
+	require.NoError(err)
+	require.Equal(uint64(5), manifest.TipHeight)
+
+	// The checksum covers the blocks file
+	blocksPath := filepath.Join(dir, ChainStateBlocksFile)
+	blocksBytes, err := os.ReadFile(blocksPath)
+	require.NoError(err)
+	corrupted := append([]byte{}, blocksBytes...)
+	corrupted[len(corrupted)-1] ^= 1
+	require.NoError(os.WriteFile(blocksPath, corrupted, 0o600))
+	require.ErrorIs(client.ImportChainState(dir), errInvalidChainState)
+	require.NoError(os.WriteFile(blocksPath, blocksBytes, 0o600))
+
+	// The export must extend the accepted chain
+	otherKey, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	other := newTestVMs(t, 1, otherKey)[0]
+	buildTestChain(t, other, 1)
+	require.ErrorIs(other.ImportChainState(dir), errChainStateConflict)
+
+	// Nothing was imported by the failed attempts
+	lastAccepted, err := client.LastAccepted(context.Background())
+	require.NoError(err)
+	genesis, err := client.GetBlockIDAtHeight(context.Background(), 0)
+	require.NoError(err)
+	require.Equal(genesis, lastAccepted)
+	require.NoError(client.ImportChainState(dir))
+}
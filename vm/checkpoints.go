@@ -0,0 +1,141 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+)
+
+var errCheckpointMismatch = errors.New("accepted chain does not match checkpoint")
+
+// Checkpoint is a block of the accepted chain. Blocks conflicting with a
+// checkpoint are rejected, and the scripts of blocks up to the highest
+// checkpoint are not validated since they are committed to by its hash.
+type Checkpoint struct {
+	Height uint64 `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+// Upgrades is the configuration of the VM shared by every node of the chain,
+// parsed from the upgradeBytes passed to Initialize
+type Upgrades struct {
+	// Checkpoints of the chain. Checkpoints of the node config replace those
+	// at the same height.
+	Checkpoints []Checkpoint `json:"checkpoints"`
+
+	// MaxFutureBlockTime replaces the maximum number of seconds a block time
+	// is allowed to be ahead of the current time set by the genesis
+	MaxFutureBlockTime *uint32 `json:"maxFutureBlockTime"`
+
+	// ActivationHeights are the heights of the first blocks enforcing the
+	// deployments, by their name in getblockchaininfo. Scheduled deployments
+	// activate at their height regardless of version bits signalling.
+	ActivationHeights map[string]uint32 `json:"activationHeights"`
+}
+
+// parseUpgradeBytes parses upgradeBytes
+func parseUpgradeBytes(upgradeBytes []byte) (*Upgrades, error) {
+	upgrades := &Upgrades{}
+	if len(upgradeBytes) == 0 {
+		return upgrades, nil
+	}
+
+	if err := json.Unmarshal(upgradeBytes, upgrades); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal upgrade bytes: %w", err)
+	}
+	return upgrades, nil
+}
+
+// Validate checks if the upgrades are valid
+func (u *Upgrades) Validate() error {
+	if _, err := parseCheckpoints(u.Checkpoints); err != nil {
+		return err
+	}
+	if err := validateMaxFutureBlockTime(u.MaxFutureBlockTime); err != nil {
+		return err
+	}
+	return validateActivationHeights(u.ActivationHeights)
+}
+
+// apply adds the checkpoints of the upgrades to the btcd config, sets its
+// maximum future block time and schedules its deployments. The chain params of the config must be a copy
+// made by ChainParams.apply.
+func (u *Upgrades) apply(btcdConfig *btcd.Config) {
+	checkpoints, _ := parseCheckpoints(u.Checkpoints)
+	btcdConfig.AppendCheckpoints(checkpoints...)
+	if u.MaxFutureBlockTime != nil {
+		btcdConfig.ChainParams.MaxFutureBlockTime = time.Duration(*u.MaxFutureBlockTime) * time.Second
+	}
+	scheduleActivations(btcdConfig.ChainParams, u.ActivationHeights)
+}
+
+// parseCheckpoints converts checkpoints to btcd checkpoints
+func parseCheckpoints(checkpoints []Checkpoint) ([]chaincfg.Checkpoint, error) {
+	parsed := make([]chaincfg.Checkpoint, len(checkpoints))
+	for i, checkpoint := range checkpoints {
+		// The genesis block is given by the chain params
+		if checkpoint.Height == 0 || checkpoint.Height > math.MaxInt32 {
+			return nil, fmt.Errorf("checkpoint height must be between 1 and %d, got %d", math.MaxInt32, checkpoint.Height)
+		}
+		hash, err := chainhash.NewHashFromStr(checkpoint.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hash of checkpoint at height %d: %w", checkpoint.Height, err)
+		}
+		parsed[i] = chaincfg.Checkpoint{
+			Height: int32(checkpoint.Height),
+			Hash:   hash,
+		}
+	}
+	return parsed, nil
+}
+
+// verifyCheckpoints checks that the accepted chain matches the checkpoints
+// up to its tip. Blocks above the tip are checked against the checkpoints by
+// btcd as they are processed.
+func (vm *VM) verifyCheckpoints() error {
+	chain := vm.btcdAdapter.Chain()
+	tipHeight := chain.BestSnapshot().Height
+	for _, checkpoint := range chain.Checkpoints() {
+		if checkpoint.Height > tipHeight {
+			break
+		}
+		hash, err := chain.BlockHashByHeight(checkpoint.Height)
+		if err != nil {
+			return fmt.Errorf("failed to look up block at checkpoint height %d: %w", checkpoint.Height, err)
+		}
+		if !hash.IsEqual(checkpoint.Hash) {
+			return fmt.Errorf("%w: block %s at height %d, checkpoint %s",
+				errCheckpointMismatch, hash, checkpoint.Height, checkpoint.Hash)
+		}
+	}
+	return nil
+}
+
+// checkpoint returns the last accepted block as a checkpoint for the
+// getcheckpoint RPC command. Accepted blocks are final, so the result can be
+// added to the checkpoints of other nodes.
+func (vm *VM) checkpoint() (*btcjson.GetCheckpointResult, error) {
+	vm.blocksMu.RLock()
+	lastAccepted := vm.lastAccepted
+	vm.blocksMu.RUnlock()
+
+	hash := idToHash(lastAccepted)
+	height, err := vm.chain.BlockHeightByHash(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up last accepted block: %w", err)
+	}
+	return &btcjson.GetCheckpointResult{
+		Height: int64(height),
+		Hash:   hash.String(),
+	}, nil
+}
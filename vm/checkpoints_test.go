@@ -0,0 +1,198 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/MetalBlockchain/metalgo/database/memdb"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/MetalBlockchain/metalgo/snow/consensus/snowman"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/utils/constants"
+	"github.com/MetalBlockchain/metalgo/utils/crypto/bls"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/MetalBlockchain/metalgo/vms/platformvm/warp"
+	"github.com/stretchr/testify/require"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+)
+
+// checkpointsBytes returns config or upgrade bytes with the given checkpoints
+func checkpointsBytes(checkpoints ...Checkpoint) []byte {
+	entries := ""
+	for i, checkpoint := range checkpoints {
+		if i > 0 {
+			entries += ","
+		}
+		entries += fmt.Sprintf(`{"height":%d,"hash":%q}`, checkpoint.Height, checkpoint.Hash)
+	}
+	return []byte(`{"checkpoints":[` + entries + `]}`)
+}
+
+// newCheckpointsVM initializes a VM with the given upgrade and config bytes
+func newCheckpointsVM(t *testing.T, upgradeBytes []byte, configBytes []byte) (*VM, error) {
+	sk, err := bls.NewSigner()
+	require.NoError(t, err)
+	chainID := ids.GenerateTestID()
+	vm := &VM{}
+	err = vm.Initialize(
+		context.Background(),
+		&snow.Context{
+			NetworkID:  constants.UnitTestID,
+			ChainID:    chainID,
+			NodeID:     newTestNodeID(t),
+			PublicKey:  sk.PublicKey(),
+			Log:        logging.NoLog{},
+			WarpSigner: warp.NewSigner(sk, constants.UnitTestID, chainID),
+		},
+		memdb.New(),
+		[]byte(`{"config":{"testNet":true}}`),
+		upgradeBytes,
+		configBytes,
+		make(chan common.Message, 1),
+		nil,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		require.NoError(t, vm.Shutdown(context.Background()))
+	})
+	return vm, nil
+}
+
+func TestCheckpointsConfig(t *testing.T) {
+	require := require.New(t)
+	t.Setenv("HOME", t.TempDir())
+
+	hash := func(b byte) string {
+		return fmt.Sprintf("%064x", b)
+	}
+	upgradeBytes := checkpointsBytes(Checkpoint{Height: 10, Hash: hash(1)}, Checkpoint{Height: 20, Hash: hash(2)})
+	configBytes := checkpointsBytes(Checkpoint{Height: 20, Hash: hash(3)}, Checkpoint{Height: 30, Hash: hash(4)})
+
+	// The node config replaces the checkpoints of the upgrades at the same
+	// height
+	vm, err := newCheckpointsVM(t, upgradeBytes, configBytes)
+	require.NoError(err)
+	var checkpoints []Checkpoint
+	for _, checkpoint := range vm.chain.Checkpoints() {
+		checkpoints = append(checkpoints, Checkpoint{
+			Height: uint64(checkpoint.Height),
+			Hash:   checkpoint.Hash.String(),
+		})
+	}
+	require.Equal([]Checkpoint{
+		{Height: 10, Hash: hash(1)},
+		{Height: 20, Hash: hash(3)},
+		{Height: 30, Hash: hash(4)},
+	}, checkpoints)
+	require.Equal(int32(30), vm.chain.LatestCheckpoint().Height)
+
+	for _, checkpoint := range []Checkpoint{
+		{Height: 0, Hash: btcd.BtcvmTestNetParms.GenesisHash.String()},
+		{Height: 1 << 31, Hash: hash(1)},
+		{Height: 1, Hash: "not a hash"},
+	} {
+		_, err := newCheckpointsVM(t, checkpointsBytes(checkpoint), nil)
+		require.Error(err)
+		_, err = newCheckpointsVM(t, nil, checkpointsBytes(checkpoint))
+		require.Error(err)
+	}
+	_, err = newCheckpointsVM(t, []byte(`{"checkpoints":{}}`), nil)
+	require.Error(err)
+}
+
+func TestCheckpointsRejectConflictingBlocks(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, nil)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	buildTestChain(t, vm, 2)
+
+	// The result of the RPC is pasted into the config of the node
+	var checkpoint Checkpoint
+	callRPC(t, handlers["/rpc"], "getcheckpoint", nil, &checkpoint)
+	require.Equal(Checkpoint{Height: 2, Hash: idToHash(vm.lastAccepted).String()}, checkpoint)
+	buildTestChain(t, vm, 1)
+	node := newTestVMsWithConfig(t, 1, key, "", checkpointsBytes(checkpoint))[0]
+
+	// Chains of other keys conflict with the chain of vm
+	conflictingChain := func(numBlocks int) *VM {
+		otherKey, err := btcec.NewPrivateKey()
+		require.NoError(err)
+		other := newTestVMs(t, 1, otherKey)[0]
+		buildTestChain(t, other, numBlocks)
+		return other
+	}
+	requireRuleError := func(err error, codes ...blockchain.ErrorCode) {
+		var ruleErr blockchain.RuleError
+		require.True(errors.As(err, &ruleErr), "%v", err)
+		require.Contains(codes, ruleErr.ErrorCode)
+	}
+
+	// A conflicting block at the checkpoint height is rejected before the
+	// checkpoint is reached
+	other := conflictingChain(2)
+	blks := acceptedBlocks(t, other)
+	_, err = node.ParseBlock(ctx, blks[0].Bytes())
+	require.NoError(err)
+	_, err = node.ParseBlock(ctx, blks[1].Bytes())
+	requireRuleError(err, blockchain.ErrBadCheckpoint)
+
+	// Once the checkpoint is reached, blocks forking the chain below it are
+	// rejected, by their timestamp if it is before the checkpoint
+	for _, blk := range acceptedBlocks(t, vm) {
+		parsed, err := node.ParseBlock(ctx, blk.Bytes())
+		require.NoError(err)
+		require.NoError(parsed.Verify(ctx))
+		require.NoError(node.SetPreference(ctx, parsed.ID()))
+		require.NoError(parsed.Accept(ctx))
+	}
+	blks = acceptedBlocks(t, conflictingChain(1))
+	_, err = node.ParseBlock(ctx, blks[0].Bytes())
+	requireRuleError(err, blockchain.ErrForkTooOld, blockchain.ErrCheckpointTimeTooOld)
+
+	// Blocks above the checkpoint are validated as usual
+	buildTestChain(t, node, 1)
+
+	// The accepted chain of a node must match its checkpoints
+	require.NoError(node.verifyCheckpoints())
+	exportDir := filepath.Join(t.TempDir(), "export")
+	_, err = other.ExportChainState(exportDir)
+	require.NoError(err)
+	fresh := newTestVMsWithConfig(t, 1, key, "", checkpointsBytes(checkpoint))[0]
+	require.ErrorIs(fresh.ImportChainState(exportDir), errCheckpointMismatch)
+}
+
+// acceptedBlocks returns the accepted blocks of vm above genesis
+func acceptedBlocks(t *testing.T, vm *VM) []snowman.Block {
+	require := require.New(t)
+	ctx := context.Background()
+
+	lastAccepted, err := vm.GetBlock(ctx, vm.lastAccepted)
+	require.NoError(err)
+	blks := make([]snowman.Block, 0, lastAccepted.Height())
+	for height := uint64(1); height <= lastAccepted.Height(); height++ {
+		blkID, err := vm.GetBlockIDAtHeight(ctx, height)
+		require.NoError(err)
+		blk, err := vm.GetBlock(ctx, blkID)
+		require.NoError(err)
+		blks = append(blks, blk)
+	}
+	return blks
+}
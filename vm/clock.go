@@ -0,0 +1,18 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"time"
+
+	"github.com/MetalBlockchain/metalgo/utils/timer/mockable"
+)
+
+var _ Clock = (*mockable.Clock)(nil)
+
+// Clock returns the current time of the VM. *mockable.Clock implements it, so
+// tests can control the time seen by the VM.
+type Clock interface {
+	Time() time.Time
+}
@@ -0,0 +1,405 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	btcdb "github.com/MetalBlockchain/btcvm/btcd/database"
+)
+
+// Bounds of the policy limits of built blocks, matching btcd's. The margin
+// below the consensus limits leaves room for the coinbase.
+const (
+	minBlockMaxWeight = 4000
+	maxBlockMaxWeight = blockchain.MaxBlockWeight - 4000
+	minBlockMaxSize   = 1000
+	maxBlockMaxSize   = blockchain.MaxBlockBaseSize - 1000
+)
+
+// Config is the node-specific configuration of the VM, parsed from the
+// configBytes passed to Initialize. Fields that are not set keep the values
+// from the genesis config, which default to btcd's defaults.
+type Config struct {
+	// UtxoCacheMaxSizeMiB is the maximum size in MiB of the UTXO cache used
+	// while validating blocks
+	UtxoCacheMaxSizeMiB uint `json:"utxoCacheMaxSizeMiB"`
+
+	// SigCacheMaxEntries is the maximum number of entries in the signature
+	// verification cache and in the transaction script validation cache
+	// shared by block and mempool validation
+	SigCacheMaxEntries uint `json:"sigCacheMaxEntries"`
+
+	// MaxScriptValidationWorkers is the maximum number of goroutines used to
+	// validate the scripts of a block. Zero uses three per CPU core.
+	MaxScriptValidationWorkers int `json:"maxScriptValidationWorkers"`
+
+	// MinGossipFeeRate is the minimum fee rate in sat/vB of transactions
+	// accepted from gossip. Zero accepts any transaction the mempool accepts.
+	MinGossipFeeRate float64 `json:"minGossipFeeRate"`
+
+	// MinRelayFeeRate is the minimum fee rate in sat/vB of transactions
+	// gossiped to peers. Zero gossips every accepted transaction.
+	MinRelayFeeRate float64 `json:"minRelayFeeRate"`
+
+	// GossipHandlerID is the p2p handler ID transactions and blocks are
+	// gossiped and served on. Every node of the network must serve it.
+	GossipHandlerID uint64 `json:"gossipHandlerID"`
+
+	// GossipMigrationHandlerIDs are handler IDs gossip is served on in
+	// addition to GossipHandlerID during a migration window, so that peers
+	// gossiping on another ID are still served. A network migrates by first
+	// serving the new ID here on every node and then switching
+	// GossipHandlerID to it.
+	GossipMigrationHandlerIDs []uint64 `json:"gossipMigrationHandlerIDs"`
+
+	// GossipWorkers is the number of goroutines adding the transactions
+	// pushed by peers to the mempool, and queuing the blocks they push for
+	// the block processor once checked. Zero uses one per CPU core.
+	GossipWorkers int `json:"gossipWorkers"`
+
+	// GossipQueueSize is the maximum number of pushed transactions and
+	// blocks waiting for a gossip worker. Once reached, pushed transactions
+	// are dropped, while pushed blocks replace queued transactions or wait
+	// for room.
+	GossipQueueSize int `json:"gossipQueueSize"`
+
+	// TxGossipValidatorsOnly pushes transactions to validators only. If
+	// false, they are also pushed to non-validator peers, such as RPC nodes,
+	// which otherwise only learn about them through pull gossip.
+	TxGossipValidatorsOnly bool `json:"txGossipValidatorsOnly"`
+
+	// GossipMisbehaviorThreshold is the decaying misbehavior score above
+	// which a warning is logged about a peer pushing invalid or oversized
+	// items. Peers are not disconnected, as the Metal network manages
+	// connections. Zero disables the warnings.
+	GossipMisbehaviorThreshold uint32 `json:"gossipMisbehaviorThreshold"`
+
+	// GossipBloomRotationMinutes is how often the bloom filter sent in pull
+	// requests is reset with a new salt, so that peers observing it can't
+	// keep suppressing the requests with items colliding with the known
+	// ones. Zero only resets it once it fills up.
+	GossipBloomRotationMinutes uint `json:"gossipBloomRotationMinutes"`
+
+	// WtxidGossip identifies gossiped transactions by their wtxid rather
+	// than their txid, so that versions of a transaction differing by their
+	// witness are gossiped apart. They are gossiped in the
+	// GossipItemTypeTxV1 envelope, which nodes predating it can't parse, so
+	// a network only enables it once every node supports it.
+	WtxidGossip bool `json:"wtxidGossip"`
+
+	// MaxOrphanTxs is the maximum number of gossiped transactions kept in
+	// the orphan pool until their parents arrive. A random orphan is evicted
+	// to make room for a new one. Zero drops orphans.
+	MaxOrphanTxs int `json:"maxOrphanTxs"`
+
+	// MaxOrphanTxSize is the maximum serialized size in bytes of the
+	// transactions kept in the orphan pool
+	MaxOrphanTxSize int `json:"maxOrphanTxSize"`
+
+	// MempoolFullRBF accepts replacement transactions into the mempool
+	// regardless of whether the transactions they replace signal
+	// replaceability as defined by BIP 125
+	MempoolFullRBF bool `json:"mempoolFullRBF"`
+
+	// MaxAncestorCount is the maximum number of unconfirmed ancestors of a
+	// transaction, including itself, accepted into the mempool. It bounds the
+	// packages considered by block building. Zero disables the limit.
+	MaxAncestorCount int `json:"maxAncestorCount"`
+
+	// MaxAncestorSize is the maximum virtual size of the unconfirmed ancestors
+	// of a transaction, including itself, accepted into the mempool. Zero
+	// disables the limit.
+	MaxAncestorSize int64 `json:"maxAncestorSize"`
+
+	// MaxMempoolBytes is the maximum total serialized size in bytes of the
+	// transactions in the mempool. Once exceeded, the transactions paying the
+	// lowest fee rates are evicted and the minimum fee rate of accepted
+	// transactions rises above theirs. Zero disables the limit.
+	MaxMempoolBytes int64 `json:"maxMempoolBytes"`
+
+	// MempoolExpiryHours is how long a transaction stays in the mempool
+	// before it is evicted, along with the transactions spending it. Zero
+	// disables the expiry.
+	MempoolExpiryHours uint `json:"mempoolExpiryHours"`
+
+	// MaintenanceIntervalHours is how often the UTXO cache is flushed and the
+	// chain database compacted, discarding the tombstones of deleted entries.
+	// No block is built or verified while the maintenance runs. Zero disables
+	// the scheduled maintenance, which the runmaintenance RPC still runs.
+	MaintenanceIntervalHours uint `json:"maintenanceIntervalHours"`
+
+	// MaintenanceMaxMempoolTxs postpones the scheduled maintenance while the
+	// mempool holds more transactions, so that it runs at low activity. Zero
+	// runs it on schedule regardless of the mempool.
+	MaintenanceMaxMempoolTxs int `json:"maintenanceMaxMempoolTxs"`
+
+	// BlockMaxWeight is the maximum weight of blocks built by this node. It
+	// only limits block building; blocks of other validators are verified
+	// against the consensus limit.
+	BlockMaxWeight uint32 `json:"blockMaxWeight"`
+
+	// BlockMaxSize is the maximum serialized size without witness data of
+	// blocks built by this node. As with btcd, setting only one of the block
+	// limits derives the other from it.
+	BlockMaxSize uint32 `json:"blockMaxSize"`
+
+	// MaxBlockTimeDriftSeconds is how far ahead of the time of their parent
+	// blocks built by this node are timestamped at most, so that a clock
+	// running ahead can't push the block times ahead. Blocks are always
+	// timestamped at least a second after their parent. Zero disables the
+	// limit.
+	MaxBlockTimeDriftSeconds uint `json:"maxBlockTimeDriftSeconds"`
+
+	// DisableBlockBuilding runs the node as a follower of the chain, such as
+	// an RPC gateway or an indexer, which verifies and accepts the blocks of
+	// other validators but never builds one. No mining address is needed.
+	DisableBlockBuilding bool `json:"disableBlockBuilding"`
+
+	// StaggeredBuilding delays the blocks built by this node by an offset
+	// within TargetBlockTime derived from the parent block and the node ID,
+	// so that validators take turns building rather than proposing sibling
+	// blocks at the same time. A validator that is down delays the next
+	// block by at most TargetBlockTime.
+	StaggeredBuilding bool `json:"staggeredBuilding"`
+
+	// DataDir is the directory of the chain database, namespaced by network.
+	// If empty, the chain data directory given by the node is used.
+	DataDir string `json:"dataDir"`
+
+	// DbType is the backend of the chain database. "memdb" keeps the chain
+	// in memory, for tests and ephemeral networks that do not outlive the
+	// node.
+	DbType string `json:"dbType"`
+
+	// ExpectedGenesisHash is the hex-encoded SHA-256 of the genesis file of
+	// the chain, as printed by sha256sum. If set, the node fails to start when
+	// launched with another genesis.
+	ExpectedGenesisHash string `json:"expectedGenesisHash"`
+
+	// ResyncChainState rebuilds the chain state on startup by re-applying
+	// the blocks accepted by consensus above the last height it agrees with
+	// them at, to recover from a chain state diverging from the accepted
+	// chain such as after a corrupted chain tip.
+	ResyncChainState bool `json:"resyncChainState"`
+
+	// ShutdownTimeoutSeconds is how long Shutdown waits for the subsystems
+	// of the VM to stop. Once it elapses, the goroutines still running are
+	// logged, the remaining subsystems are closed on a best-effort basis and
+	// Shutdown returns an error. Zero waits indefinitely.
+	ShutdownTimeoutSeconds uint `json:"shutdownTimeoutSeconds"`
+
+	// DebugAPIEnabled registers the /debug handlers, which serve profiles and
+	// runtime stats and change log levels
+	DebugAPIEnabled bool `json:"debugAPIEnabled"`
+
+	// Checkpoints are blocks of the accepted chain the node rejects
+	// conflicting blocks with. They are added to the checkpoints of the
+	// upgrades, replacing those at the same height.
+	Checkpoints []Checkpoint `json:"checkpoints"`
+
+	// RPCAuth restricts the RPC endpoints to clients with a bearer token and
+	// the methods they may call. If nil, the RPC credentials of the genesis
+	// config are used.
+	RPCAuth *RPCAuthConfig `json:"rpcAuth"`
+
+	// RPCLimits bounds the requests, response sizes and websocket
+	// subscriptions of each RPC client
+	RPCLimits RPCLimitsConfig `json:"rpcLimits"`
+
+	// GossipLimits bounds the gossip and pull requests of each peer
+	GossipLimits GossipLimitsConfig `json:"gossipLimits"`
+
+	// Logging sets the log levels of the subsystems of the VM
+	Logging LoggingConfig `json:"logging"`
+
+	// AcceptedBlockWebhooks publishes a summary of each accepted block to
+	// HTTP endpoints. If nil, accepted blocks are not published.
+	AcceptedBlockWebhooks *AcceptedBlockWebhooksConfig `json:"acceptedBlockWebhooks"`
+}
+
+// newConfig returns the VM configuration with the values of the btcd config
+func newConfig(btcdConfig *btcd.Config) Config {
+	return Config{
+		UtxoCacheMaxSizeMiB:        btcdConfig.UtxoCacheMaxSizeMiB,
+		SigCacheMaxEntries:         btcdConfig.SigCacheMaxSize,
+		MaxScriptValidationWorkers: btcdConfig.MaxScriptWorkers,
+		MinGossipFeeRate:           btcdConfig.MinGossipFeeRate,
+		MinRelayFeeRate:            btcdConfig.MinRelayFeeRate,
+		GossipHandlerID:            BTCGossipHandlerID,
+		GossipQueueSize:            defaultGossipQueueSize,
+		TxGossipValidatorsOnly:     true,
+		GossipMisbehaviorThreshold: btcdConfig.BanThreshold,
+		GossipBloomRotationMinutes: defaultGossipBloomRotationMinutes,
+		MaxOrphanTxs:               btcdConfig.MaxOrphanTxs,
+		MaxOrphanTxSize:            btcdConfig.MaxOrphanTxSize,
+		MempoolFullRBF:             btcdConfig.MempoolFullRBF,
+		MaxAncestorCount:           btcdConfig.MaxAncestorCount,
+		MaxAncestorSize:            btcdConfig.MaxAncestorSize,
+		MaxMempoolBytes:            btcdConfig.MaxMempoolBytes,
+		MempoolExpiryHours:         defaultMempoolExpiryHours,
+		MaintenanceIntervalHours:   defaultMaintenanceIntervalHours,
+		BlockMaxWeight:             btcdConfig.BlockMaxWeight,
+		BlockMaxSize:               btcdConfig.BlockMaxSize,
+		DbType:                     btcdConfig.DbType,
+		ShutdownTimeoutSeconds:     defaultShutdownTimeoutSeconds,
+		RPCLimits:                  defaultRPCLimitsConfig(btcdConfig.RPCMaxWsSubs),
+		GossipLimits:               defaultGossipLimitsConfig(),
+	}
+}
+
+// parseConfigBytes parses configBytes over config
+func parseConfigBytes(configBytes []byte, config *Config) error {
+	if len(configBytes) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(configBytes, config); err != nil {
+		return fmt.Errorf("failed to unmarshal config bytes: %w", err)
+	}
+	return nil
+}
+
+// Validate checks if the configuration is valid
+func (c *Config) Validate() error {
+	if c.MaxScriptValidationWorkers < 0 {
+		return fmt.Errorf("max script validation workers must not be negative, got %d", c.MaxScriptValidationWorkers)
+	}
+	if c.MinGossipFeeRate < 0 {
+		return fmt.Errorf("min gossip fee rate must not be negative, got %f", c.MinGossipFeeRate)
+	}
+	if c.MinRelayFeeRate < 0 {
+		return fmt.Errorf("min relay fee rate must not be negative, got %f", c.MinRelayFeeRate)
+	}
+	if err := validateGossipHandlerIDs(c.GossipHandlerID, c.GossipMigrationHandlerIDs); err != nil {
+		return err
+	}
+	if c.GossipWorkers < 0 {
+		return fmt.Errorf("gossip workers must not be negative, got %d", c.GossipWorkers)
+	}
+	if c.GossipQueueSize <= 0 {
+		return fmt.Errorf("gossip queue size must be positive, got %d", c.GossipQueueSize)
+	}
+	if c.MaxOrphanTxs < 0 {
+		return fmt.Errorf("max orphan txs must not be negative, got %d", c.MaxOrphanTxs)
+	}
+	if c.MaxOrphanTxSize < 0 {
+		return fmt.Errorf("max orphan tx size must not be negative, got %d", c.MaxOrphanTxSize)
+	}
+	if c.MaxAncestorCount < 0 {
+		return fmt.Errorf("max ancestor count must not be negative, got %d", c.MaxAncestorCount)
+	}
+	if c.MaxAncestorSize < 0 {
+		return fmt.Errorf("max ancestor size must not be negative, got %d", c.MaxAncestorSize)
+	}
+	if c.MaxMempoolBytes < 0 {
+		return fmt.Errorf("max mempool bytes must not be negative, got %d", c.MaxMempoolBytes)
+	}
+	if c.MaintenanceMaxMempoolTxs < 0 {
+		return fmt.Errorf("maintenance max mempool txs must not be negative, got %d", c.MaintenanceMaxMempoolTxs)
+	}
+	if c.BlockMaxWeight < minBlockMaxWeight || c.BlockMaxWeight > maxBlockMaxWeight {
+		return fmt.Errorf("block max weight must be between %d and %d, got %d", minBlockMaxWeight, maxBlockMaxWeight, c.BlockMaxWeight)
+	}
+	if c.BlockMaxSize < minBlockMaxSize || c.BlockMaxSize > maxBlockMaxSize {
+		return fmt.Errorf("block max size must be between %d and %d, got %d", minBlockMaxSize, maxBlockMaxSize, c.BlockMaxSize)
+	}
+	if drivers := btcdb.SupportedDrivers(); !slices.Contains(drivers, c.DbType) {
+		return fmt.Errorf("db type must be one of %v, got %q", drivers, c.DbType)
+	}
+	if err := validateGenesisHash(c.ExpectedGenesisHash); err != nil {
+		return err
+	}
+	if _, err := parseCheckpoints(c.Checkpoints); err != nil {
+		return err
+	}
+	if c.RPCAuth != nil {
+		if err := c.RPCAuth.Validate(); err != nil {
+			return fmt.Errorf("invalid rpc auth: %w", err)
+		}
+	}
+	if err := c.RPCLimits.Validate(); err != nil {
+		return fmt.Errorf("invalid rpc limits: %w", err)
+	}
+	if err := c.GossipLimits.Validate(); err != nil {
+		return fmt.Errorf("invalid gossip limits: %w", err)
+	}
+	if err := c.Logging.Validate(); err != nil {
+		return fmt.Errorf("invalid logging: %w", err)
+	}
+	if c.AcceptedBlockWebhooks != nil {
+		if err := c.AcceptedBlockWebhooks.Validate(); err != nil {
+			return fmt.Errorf("invalid accepted block webhooks: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateGossipHandlerIDs checks that the gossip handler IDs are distinct
+// from each other and from the IDs of the other handlers of the VM
+func validateGossipHandlerIDs(handlerID uint64, migrationHandlerIDs []uint64) error {
+	reserved := []uint64{
+		MempoolSyncHandlerID,
+		StateSyncHandlerID,
+		WarpSignatureHandlerID,
+		BlockFilterHandlerID,
+	}
+	if slices.Contains(reserved, handlerID) {
+		return fmt.Errorf("gossip handler ID %d is used by another handler", handlerID)
+	}
+	for i, id := range migrationHandlerIDs {
+		if slices.Contains(reserved, id) {
+			return fmt.Errorf("gossip migration handler ID %d is used by another handler", id)
+		}
+		if id == handlerID || slices.Contains(migrationHandlerIDs[:i], id) {
+			return fmt.Errorf("gossip migration handler ID %d is duplicated", id)
+		}
+	}
+	return nil
+}
+
+// apply sets the configured values on the btcd config
+func (c *Config) apply(btcdConfig *btcd.Config) {
+	btcdConfig.UtxoCacheMaxSizeMiB = c.UtxoCacheMaxSizeMiB
+	btcdConfig.SigCacheMaxSize = c.SigCacheMaxEntries
+	btcdConfig.MaxScriptWorkers = c.MaxScriptValidationWorkers
+	btcdConfig.MinGossipFeeRate = c.MinGossipFeeRate
+	btcdConfig.MinRelayFeeRate = c.MinRelayFeeRate
+	btcdConfig.MaxOrphanTxs = c.MaxOrphanTxs
+	btcdConfig.MaxOrphanTxSize = c.MaxOrphanTxSize
+	btcdConfig.MempoolFullRBF = c.MempoolFullRBF
+	btcdConfig.MaxAncestorCount = c.MaxAncestorCount
+	btcdConfig.MaxAncestorSize = c.MaxAncestorSize
+	btcdConfig.MaxMempoolBytes = c.MaxMempoolBytes
+	btcdConfig.RPCMaxWsSubs = c.RPCLimits.MaxWebsocketSubscriptions
+	btcdConfig.DbType = c.DbType
+
+	// If only one of the block limits changed, the other one follows it the
+	// way btcd derives them from its flags
+	blockMaxWeight, blockMaxSize := c.BlockMaxWeight, c.BlockMaxSize
+	switch {
+	case blockMaxWeight != btcdConfig.BlockMaxWeight && blockMaxSize == btcdConfig.BlockMaxSize:
+		blockMaxSize = maxBlockMaxSize
+	case blockMaxSize != btcdConfig.BlockMaxSize && blockMaxWeight == btcdConfig.BlockMaxWeight:
+		blockMaxWeight = blockMaxSize * blockchain.WitnessScaleFactor
+	}
+	btcdConfig.BlockMaxWeight = blockMaxWeight
+	btcdConfig.BlockMaxSize = blockMaxSize
+	btcdConfig.BlockMinWeight = min(btcdConfig.BlockMinWeight, blockMaxWeight)
+	btcdConfig.BlockMinSize = min(btcdConfig.BlockMinSize, blockMaxSize)
+	btcdConfig.BlockPrioritySize = min(btcdConfig.BlockPrioritySize, blockMaxSize)
+
+	checkpoints, _ := parseCheckpoints(c.Checkpoints)
+	btcdConfig.AppendCheckpoints(checkpoints...)
+
+	// btcd disables its RPC server without credentials, which are not needed
+	// with token authentication
+	if c.RPCAuth != nil {
+		btcdConfig.DisableRPC = false
+	}
+}
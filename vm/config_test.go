@@ -0,0 +1,413 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/MetalBlockchain/metalgo/snow/consensus/snowman"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigBytes(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+
+	configBytes := []byte(`{"utxoCacheMaxSizeMiB":32,"sigCacheMaxEntries":1000,"maxScriptValidationWorkers":2}`)
+	vm := newTestVMsWithConfig(t, 1, key, "", configBytes)[0]
+	require.Equal(Config{
+		UtxoCacheMaxSizeMiB:        32,
+		SigCacheMaxEntries:         1000,
+		MaxScriptValidationWorkers: 2,
+		GossipHandlerID:            BTCGossipHandlerID,
+		GossipQueueSize:            defaultGossipQueueSize,
+		TxGossipValidatorsOnly:     true,
+		GossipMisbehaviorThreshold: 100,
+		GossipBloomRotationMinutes: defaultGossipBloomRotationMinutes,
+		MaxOrphanTxs:               100,
+		MaxOrphanTxSize:            100_000,
+		MaxAncestorCount:           25,
+		MaxAncestorSize:            101_000,
+		MaxMempoolBytes:            300_000_000,
+		MempoolExpiryHours:         defaultMempoolExpiryHours,
+		MaintenanceIntervalHours:   defaultMaintenanceIntervalHours,
+		BlockMaxWeight:             3_000_000,
+		BlockMaxSize:               750_000,
+		DbType:                     "ffldb",
+		ShutdownTimeoutSeconds:     defaultShutdownTimeoutSeconds,
+		RPCLimits:                  defaultRPCLimitsConfig(1000),
+		GossipLimits:               defaultGossipLimitsConfig(),
+	}, vm.nodeConfig)
+	require.Equal(uint(32), vm.config.UtxoCacheMaxSizeMiB)
+	require.Equal(uint(1000), vm.config.SigCacheMaxSize)
+	require.Equal(2, vm.config.MaxScriptWorkers)
+
+	health, err := vm.HealthCheck(ctx)
+	require.NoError(err)
+	require.Equal(uint64(32*1024*1024), health.(map[string]interface{})["utxoCacheMaxBytes"])
+}
+
+func TestConfigBytesDefaults(t *testing.T) {
+	require := require.New(t)
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+
+	// Values not set by the node config are taken from the genesis config
+	vm := newTestVMsWithConfig(t, 1, key, `"utxoCacheMaxSizeMiB":64`, []byte(`{"sigCacheMaxEntries":10}`))[0]
+	require.Equal(uint(64), vm.config.UtxoCacheMaxSizeMiB)
+	require.Equal(uint(10), vm.config.SigCacheMaxSize)
+	require.Zero(vm.config.MaxScriptWorkers)
+}
+
+func TestConfigBytesGossipLimits(t *testing.T) {
+	require := require.New(t)
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+
+	// Limits left out of the config keep their defaults
+	configBytes := []byte(`{"gossipLimits":{"itemsPerSecond":10,"pullRequestBurst":3}}`)
+	vm := newTestVMsWithConfig(t, 1, key, "", configBytes)[0]
+	expected := DefaultGossipConfig()
+	expected.InboundGossipItemsPerSecond = 10
+	expected.InboundPullRequestBurst = 3
+	require.Equal(expected.InboundGossipItemsPerSecond, vm.gossipConfig.InboundGossipItemsPerSecond)
+	require.Equal(expected.InboundGossipItemBurst, vm.gossipConfig.InboundGossipItemBurst)
+	require.Equal(expected.InboundGossipByteBurst, vm.gossipConfig.InboundGossipByteBurst)
+	require.Equal(expected.InboundPullRequestBurst, vm.gossipConfig.InboundPullRequestBurst)
+}
+
+func TestConfigValidate(t *testing.T) {
+	require := require.New(t)
+
+	valid := Config{
+		GossipHandlerID: BTCGossipHandlerID,
+		GossipQueueSize: defaultGossipQueueSize,
+		BlockMaxWeight:  3_000_000,
+		BlockMaxSize:    750_000,
+		DbType:          "ffldb",
+		RPCLimits:       defaultRPCLimitsConfig(1000),
+		GossipLimits:    defaultGossipLimitsConfig(),
+	}
+	config := valid
+	require.NoError(config.Validate())
+
+	config.MaxScriptValidationWorkers = -1
+	require.Error(config.Validate())
+
+	config = valid
+	config.GossipWorkers = -1
+	require.Error(config.Validate())
+
+	config = valid
+	config.GossipQueueSize = 0
+	require.Error(config.Validate())
+
+	config = valid
+	config.MaxOrphanTxs = -1
+	require.Error(config.Validate())
+
+	config = valid
+	config.MaxOrphanTxSize = -1
+	require.Error(config.Validate())
+
+	config = valid
+	config.MaxAncestorCount = -1
+	require.Error(config.Validate())
+
+	config = valid
+	config.MaintenanceMaxMempoolTxs = -1
+	require.Error(config.Validate())
+
+	config = valid
+	config.MaxAncestorSize = -1
+	require.Error(config.Validate())
+
+	config = valid
+	config.MaxMempoolBytes = -1
+	require.Error(config.Validate())
+
+	// Block limits must be within the consensus limits
+	for _, limits := range [][2]uint32{
+		{minBlockMaxWeight, minBlockMaxSize},
+		{maxBlockMaxWeight, maxBlockMaxSize},
+	} {
+		config = valid
+		config.BlockMaxWeight, config.BlockMaxSize = limits[0], limits[1]
+		require.NoError(config.Validate())
+	}
+	for _, limits := range [][2]uint32{
+		{minBlockMaxWeight - 1, minBlockMaxSize},
+		{maxBlockMaxWeight + 1, maxBlockMaxSize},
+		{minBlockMaxWeight, minBlockMaxSize - 1},
+		{maxBlockMaxWeight, maxBlockMaxSize + 1},
+	} {
+		config = valid
+		config.BlockMaxWeight, config.BlockMaxSize = limits[0], limits[1]
+		require.Error(config.Validate())
+	}
+
+	config = valid
+	config.MinGossipFeeRate = -1
+	require.Error(config.Validate())
+
+	config = valid
+	config.MinRelayFeeRate = -1
+	require.Error(config.Validate())
+
+	// Gossip handler IDs must not collide with each other or other handlers
+	config = valid
+	config.GossipHandlerID = 105
+	config.GossipMigrationHandlerIDs = []uint64{BTCGossipHandlerID}
+	require.NoError(config.Validate())
+	config.GossipMigrationHandlerIDs = []uint64{BTCGossipHandlerID, 105}
+	require.Error(config.Validate())
+	config.GossipMigrationHandlerIDs = []uint64{BTCGossipHandlerID, BTCGossipHandlerID}
+	require.Error(config.Validate())
+	config.GossipMigrationHandlerIDs = []uint64{MempoolSyncHandlerID}
+	require.Error(config.Validate())
+	config.GossipHandlerID = WarpSignatureHandlerID
+	config.GossipMigrationHandlerIDs = nil
+	require.Error(config.Validate())
+
+	config = valid
+	config.GossipLimits.PullRequestBurst = 0
+	require.Error(config.Validate())
+
+	// The byte burst must fit a full block
+	config = valid
+	config.GossipLimits.ByteBurst = wire.MaxBlockPayload
+	require.NoError(config.Validate())
+	config.GossipLimits.ByteBurst--
+	require.Error(config.Validate())
+
+	config = valid
+	config.DbType = "memdb"
+	require.NoError(config.Validate())
+	config.DbType = "leveldb"
+	require.Error(config.Validate())
+
+	config = valid
+	config.Logging.Gossip = "debug"
+	require.NoError(config.Validate())
+	config.Logging.Mempool = "loud"
+	require.Error(config.Validate())
+
+	require.Error(parseConfigBytes([]byte(`{"maxScriptValidationWorkers":"all"}`), &config))
+}
+
+func TestBlockLimits(t *testing.T) {
+	const blockMaxWeight = 4000
+
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+
+	// Setting only the block weight lifts the size limit so that the weight
+	// takes precedence
+	limited := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, []byte(`{"blockMaxWeight":4000}`))[0]
+	require.Equal(uint32(blockMaxWeight), limited.config.BlockMaxWeight)
+	require.Equal(uint32(maxBlockMaxSize), limited.config.BlockMaxSize)
+	handlers, err := limited.CreateHandlers(ctx)
+	require.NoError(err)
+
+	var info btcjson.GetMiningInfoResult
+	callRPC(t, handlers["/rpc"], "getmininginfo", nil, &info)
+	require.Equal(uint32(blockMaxWeight), info.BlockMaxWeight)
+	require.Equal(uint32(maxBlockMaxSize), info.BlockMaxSize)
+
+	// The chain is built by a VM with the default limits and shared with the
+	// limited VM: a block paying key and a block splitting its coinbase
+	server := newTestVMs(t, 1, key)[0]
+	buildBlock := func(txs ...*btcutil.Tx) snowman.Block {
+		for _, tx := range txs {
+			_, err := server.btcdAdapter.TxMemPool().ProcessTransaction(tx, false, false, 0)
+			require.NoError(err)
+		}
+		blk, err := server.BuildBlock(ctx)
+		require.NoError(err)
+		require.Len(blk.(*BlockAdapter).btcBlock.Transactions(), len(txs)+1)
+		require.NoError(blk.Accept(ctx))
+
+		limitedBlk, err := limited.ParseBlock(ctx, blk.Bytes())
+		require.NoError(err)
+		require.NoError(limitedBlk.Verify(ctx))
+		require.NoError(limitedBlk.Accept(ctx))
+		return blk
+	}
+	coinbase := buildBlock().(*BlockAdapter).btcBlock.Transactions()[0].MsgTx()
+	const numTxs = 10
+	split := newTestSplitTx(t, key, coinbase, 0, numTxs)
+	buildBlock(split)
+
+	// The mempools hold more transactions than fit in a block of the limited
+	// VM, each paying a higher fee rate than the previous one
+	txs := make([]*btcutil.Tx, numTxs)
+	for i := range txs {
+		feeRate := int64(10 * (i + 1))
+		txs[i] = newTestFeeTx(t, key, split.MsgTx(), uint32(i), func(vsize int64) int64 {
+			return feeRate * vsize
+		})
+		for _, vm := range []*VM{limited, server} {
+			_, err := vm.btcdAdapter.TxMemPool().ProcessTransaction(txs[i], false, false, 0)
+			require.NoError(err)
+		}
+	}
+
+	// The limited VM builds a block within its limit, keeping the
+	// transactions paying the highest fee rates. A transaction paying less
+	// is only included in the space left by a heavier one paying more.
+	limitedBlk, err := limited.BuildBlock(ctx)
+	require.NoError(err)
+	btcBlock := limitedBlk.(*BlockAdapter).btcBlock
+	require.LessOrEqual(blockchain.GetBlockWeight(btcBlock), int64(blockMaxWeight))
+	included := make(map[chainhash.Hash]struct{})
+	for _, tx := range btcBlock.Transactions()[1:] {
+		included[*tx.Hash()] = struct{}{}
+	}
+	require.NotEmpty(included)
+	require.Less(len(included), numTxs)
+	require.Contains(included, *txs[numTxs-1].Hash())
+	for i, tx := range txs {
+		if _, ok := included[*tx.Hash()]; !ok {
+			continue
+		}
+		for _, excluded := range txs[i+1:] {
+			if _, ok := included[*excluded.Hash()]; !ok {
+				require.Less(blockchain.GetTransactionWeight(tx), blockchain.GetTransactionWeight(excluded))
+			}
+		}
+	}
+
+	// A block of another validator exceeding the limit still verifies
+	blk, err := server.BuildBlock(ctx)
+	require.NoError(err)
+	btcBlock = blk.(*BlockAdapter).btcBlock
+	require.Len(btcBlock.Transactions(), numTxs+1)
+	require.Greater(blockchain.GetBlockWeight(btcBlock), int64(blockMaxWeight))
+	parsed, err := limited.ParseBlock(ctx, blk.Bytes())
+	require.NoError(err)
+	require.NoError(parsed.Verify(ctx))
+}
+
+// BenchmarkValidateBlockCacheConfig validates a block of 1,000 transactions,
+// which were previously accepted to the mempool, under the default cache
+// configuration and with the caches and script validation workers minimized.
+// It also validates the block with none of its transactions in the mempool,
+// whose scripts aren't in the script cache.
+func BenchmarkValidateBlockCacheConfig(b *testing.B) {
+	const numTxs = 1_000
+
+	require := require.New(b)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+
+	// Build the chain on a server: a block paying key, a block splitting its
+	// coinbase into numTxs outputs and a block spending each of them
+	server := newTestVMs(b, 1, key)[0]
+	blks := make([]snowman.Block, 0, 3)
+	buildBlock := func(txs ...*btcutil.Tx) {
+		for _, tx := range txs {
+			_, err := server.btcdAdapter.TxMemPool().ProcessTransaction(tx, false, false, 0)
+			require.NoError(err)
+		}
+		blk, err := server.BuildBlock(ctx)
+		require.NoError(err)
+		require.Len(blk.(*BlockAdapter).btcBlock.Transactions(), len(txs)+1)
+		require.NoError(blk.Accept(ctx))
+		blks = append(blks, blk)
+	}
+
+	buildBlock()
+	coinbase := blks[0].(*BlockAdapter).btcBlock.Transactions()[0].MsgTx()
+	split := newTestSplitTx(b, key, coinbase, 0, numTxs)
+	buildBlock(split)
+	spends := make([]*btcutil.Tx, numTxs)
+	for i := range spends {
+		spends[i] = newTestSplitTx(b, key, split.MsgTx(), uint32(i), 1)
+	}
+	buildBlock(spends...)
+
+	benchmarks := []struct {
+		name        string
+		configBytes []byte
+		notInPool   bool
+	}{
+		{
+			name: "default",
+		},
+		{
+			name:        "minimal",
+			configBytes: []byte(`{"utxoCacheMaxSizeMiB":1,"sigCacheMaxEntries":0,"maxScriptValidationWorkers":1}`),
+		},
+		{
+			name:      "not in mempool",
+			notInPool: true,
+		},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				client := newTestVMsWithConfig(b, 1, key, "", bm.configBytes)[0]
+				for _, blk := range blks[:2] {
+					clientBlk, err := client.ParseBlock(ctx, blk.Bytes())
+					require.NoError(err)
+					require.NoError(clientBlk.Accept(ctx))
+				}
+				if !bm.notInPool {
+					for _, tx := range spends {
+						_, err := client.btcdAdapter.TxMemPool().ProcessTransaction(tx, false, false, 0)
+						require.NoError(err)
+					}
+				}
+				b.StartTimer()
+
+				_, err := client.ParseBlock(ctx, blks[2].Bytes())
+				require.NoError(err)
+
+				b.StopTimer()
+				require.NoError(client.Shutdown(ctx))
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+// newTestSplitTx returns a transaction spending output index of prevTx, which
+// must pay to key, into numOutputs equal outputs paying to key
+func newTestSplitTx(t testing.TB, key *btcec.PrivateKey, prevTx *wire.MsgTx, index uint32, numOutputs int) *btcutil.Tx {
+	require := require.New(t)
+
+	prevOut := prevTx.TxOut[index]
+	prevHash := prevTx.TxHash()
+
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, index), nil, nil))
+	value := (prevOut.Value - 100_000) / int64(numOutputs)
+	for i := 0; i < numOutputs; i++ {
+		msgTx.AddTxOut(wire.NewTxOut(value, prevOut.PkScript))
+	}
+
+	sigScript, err := txscript.SignatureScript(msgTx, 0, prevOut.PkScript, txscript.SigHashAll, key, true)
+	require.NoError(err)
+	msgTx.TxIn[0].SignatureScript = sigScript
+	return btcutil.NewTx(msgTx)
+}
@@ -0,0 +1,30 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+)
+
+// consensusEngine is the consensus engine accepting the blocks of the chain
+const consensusEngine = "snowman"
+
+// consensusInfo describes the consensus the chain is run by for the
+// getconsensusinfo and getblockchaininfo RPC commands. Proof of work is never
+// checked since blocks are ordered by Snowman rather than by work.
+func (vm *VM) consensusInfo() *btcjson.ConsensusInfo {
+	vm.blocksMu.RLock()
+	lastAccepted := vm.lastAccepted
+	vm.blocksMu.RUnlock()
+
+	return &btcjson.ConsensusInfo{
+		Engine:           consensusEngine,
+		LastAccepted:     lastAccepted.String(),
+		TargetBlockTime:  int64(TargetBlockTime.Seconds()),
+		PoWEnforced:      false,
+		CoinbaseMaturity: vm.config.ChainParams.CoinbaseMaturity,
+		SubnetID:         vm.ctx.SubnetID.String(),
+		ChainID:          vm.ctx.ChainID.String(),
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsensusInfoRPC(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, nil)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	handler := handlers["/rpc"]
+
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(vm.SetPreference(ctx, blk.ID()))
+	require.NoError(blk.Accept(ctx))
+
+	expected := &btcjson.ConsensusInfo{
+		Engine:           "snowman",
+		LastAccepted:     blk.ID().String(),
+		TargetBlockTime:  2,
+		PoWEnforced:      false,
+		CoinbaseMaturity: vm.config.ChainParams.CoinbaseMaturity,
+		SubnetID:         vm.ctx.SubnetID.String(),
+		ChainID:          vm.ctx.ChainID.String(),
+	}
+
+	var consensusInfo btcjson.ConsensusInfo
+	callRPC(t, handler, "getconsensusinfo", nil, &consensusInfo)
+	require.Equal(expected, &consensusInfo)
+
+	// getblockchaininfo keeps its standard fields and adds the same data
+	var chainInfo btcjson.GetBlockChainInfoResult
+	callRPC(t, handler, "getblockchaininfo", nil, &chainInfo)
+	require.Equal(vm.config.ChainParams.Name, chainInfo.Chain)
+	require.Equal(idToHash(blk.ID()).String(), chainInfo.BestBlockHash)
+	require.Equal(expected, chainInfo.ConsensusInfo)
+
+	var fields map[string]json.RawMessage
+	callRPC(t, handler, "getblockchaininfo", nil, &fields)
+	for _, field := range []string{
+		"chain", "blocks", "headers", "bestblockhash", "difficulty",
+		"mediantime", "pruned", "bip9_softforks",
+		"engine", "lastaccepted", "targetblocktime", "powenforced",
+		"coinbasematurity", "subnetid", "chainid",
+	} {
+		_, ok := fields[field]
+		require.True(ok, field)
+	}
+}
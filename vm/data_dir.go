@@ -0,0 +1,91 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+)
+
+// resolveDataDir sets the data directory of the btcd config. It is the
+// dataDir of the node config if set, and otherwise the chain data directory
+// given by the node, so that the chains of a node do not share a database.
+// Nodes that do not give one keep the legacy data directory of the btcd
+// config, in the home directory of the node.
+func (vm *VM) resolveDataDir(btcdConfig *btcd.Config) error {
+	legacyDataDir := btcdConfig.DataDir
+	switch {
+	case vm.nodeConfig.DataDir != "":
+		btcdConfig.DataDir = btcd.NetDataDir(vm.nodeConfig.DataDir)
+		return nil
+	case vm.ctx.ChainDataDir == "":
+		return nil
+	}
+
+	btcdConfig.DataDir = btcd.NetDataDir(vm.ctx.ChainDataDir)
+	return vm.migrateDataDir(legacyDataDir, btcdConfig.DataDir, btcdConfig.DbType)
+}
+
+// migrateDataDir moves the database of a chain run before data directories
+// were given by the node from the legacy data directory to dataDir. The
+// legacy data directory is shared by the chains of the node, so its database
+// is only moved if the VM database shows that this chain ran before.
+func (vm *VM) migrateDataDir(legacyDataDir, dataDir, dbType string) error {
+	if dbType == "memdb" || !pathExists(btcd.BlockDBPath(legacyDataDir, dbType)) ||
+		pathExists(btcd.BlockDBPath(dataDir, dbType)) {
+		return nil
+	}
+
+	ranBefore, err := vm.hasState()
+	if err != nil {
+		return err
+	}
+	if !ranBefore {
+		vm.ctx.Log.Warn("Not moving the chain database of the legacy data directory, which may belong to another chain of this node. "+
+			"Set dataDir in the chain config to the parent of the legacy data directory if it belongs to this chain",
+			zap.String("legacyDataDir", legacyDataDir),
+			zap.String("dataDir", dataDir),
+		)
+		return nil
+	}
+
+	vm.ctx.Log.Warn("Moving the chain database from the legacy data directory shared by the chains of this node",
+		zap.String("legacyDataDir", legacyDataDir),
+		zap.String("dataDir", dataDir),
+	)
+	if err := os.MkdirAll(filepath.Dir(dataDir), 0o700); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	if pathExists(dataDir) {
+		if err := os.Remove(dataDir); err != nil {
+			return fmt.Errorf("failed to replace data directory %s without a database: %w", dataDir, err)
+		}
+	}
+	if err := os.Rename(legacyDataDir, dataDir); err != nil {
+		return fmt.Errorf("failed to move legacy data directory %s to %s, move it or set dataDir in the chain config: %w",
+			legacyDataDir, dataDir, err)
+	}
+	return nil
+}
+
+// hasState returns whether the VM database has any record, which the VM
+// writes while running
+func (vm *VM) hasState() (bool, error) {
+	it := vm.db.NewIterator()
+	defer it.Release()
+	hasState := it.Next()
+	return hasState, it.Error()
+}
+
+// pathExists returns whether a file or directory exists at path
+func pathExists(path string) bool {
+	_, err := os.Stat(path)
+	return !errors.Is(err, os.ErrNotExist)
+}
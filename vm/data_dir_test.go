@@ -0,0 +1,210 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MetalBlockchain/metalgo/api/metrics"
+	"github.com/MetalBlockchain/metalgo/database"
+	"github.com/MetalBlockchain/metalgo/database/memdb"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/utils/constants"
+	"github.com/MetalBlockchain/metalgo/utils/crypto/bls"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/MetalBlockchain/metalgo/vms/platformvm/warp"
+	"github.com/stretchr/testify/require"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	btcdb "github.com/MetalBlockchain/btcvm/btcd/database"
+)
+
+// newDataDirVM initializes a VM of a new chain of the node nodeID, whose
+// chain data directory is chainDataDir, mining to key. It is shut down when
+// the test ends.
+func newDataDirVM(t *testing.T, nodeID ids.NodeID, chainDataDir string, db database.Database, key *btcec.PrivateKey, configBytes []byte) *VM {
+	vm, err := initializeDataDirVM(t, ids.GenerateTestID(), nodeID, chainDataDir, db, nil, key, configBytes)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, vm.Shutdown(context.Background()))
+	})
+	return vm
+}
+
+// initializeDataDirVM initializes a VM of the chain chainID of the node
+// nodeID, whose chain data directory is chainDataDir, mining to key. Its
+// metrics are registered with gatherer unless it is nil.
+func initializeDataDirVM(
+	t *testing.T,
+	chainID ids.ID,
+	nodeID ids.NodeID,
+	chainDataDir string,
+	db database.Database,
+	gatherer metrics.MultiGatherer,
+	key *btcec.PrivateKey,
+	configBytes []byte,
+) (*VM, error) {
+	require := require.New(t)
+
+	addr, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160(key.PubKey().SerializeCompressed()),
+		&btcd.BtcvmTestNetParms,
+	)
+	require.NoError(err)
+	sk, err := bls.NewSigner()
+	require.NoError(err)
+	vm := &VM{}
+	return vm, vm.Initialize(
+		context.Background(),
+		&snow.Context{
+			NetworkID:    constants.UnitTestID,
+			ChainID:      chainID,
+			NodeID:       nodeID,
+			PublicKey:    sk.PublicKey(),
+			Log:          logging.NoLog{},
+			Metrics:      gatherer,
+			WarpSigner:   warp.NewSigner(sk, constants.UnitTestID, chainID),
+			ChainDataDir: chainDataDir,
+		},
+		db,
+		[]byte(`{"config":{"testNet":true,"miningAddrs":["`+addr.EncodeAddress()+`"]}}`),
+		nil,
+		configBytes,
+		make(chan common.Message, 1),
+		nil,
+		nil,
+	)
+}
+
+func TestChainDataDir(t *testing.T) {
+	require := require.New(t)
+	t.Setenv("HOME", t.TempDir())
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	nodeID := ids.GenerateTestNodeID()
+
+	// The chains of a node store their databases in their own data
+	// directories
+	first := newDataDirVM(t, nodeID, t.TempDir(), memdb.New(), key, nil)
+	second := newDataDirVM(t, nodeID, t.TempDir(), memdb.New(), key, nil)
+	for _, vm := range []*VM{first, second} {
+		require.Equal(btcd.NetDataDir(vm.ctx.ChainDataDir), vm.config.DataDir)
+		require.True(pathExists(btcd.BlockDBPath(vm.config.DataDir, vm.config.DbType)))
+	}
+
+	buildTestChain(t, first, 2)
+	require.Equal(int32(2), first.btcdAdapter.Chain().BestSnapshot().Height)
+	require.Zero(second.btcdAdapter.Chain().BestSnapshot().Height)
+
+	// The node config can set the data directory
+	dataDir := t.TempDir()
+	vm := newDataDirVM(t, nodeID, t.TempDir(), memdb.New(), key, []byte(`{"dataDir":"`+dataDir+`"}`))
+	require.Equal(btcd.NetDataDir(dataDir), vm.config.DataDir)
+	require.True(pathExists(btcd.BlockDBPath(vm.config.DataDir, vm.config.DbType)))
+}
+
+func TestReinitialize(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	t.Setenv("HOME", t.TempDir())
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	chainID := ids.GenerateTestID()
+	nodeID := ids.GenerateTestNodeID()
+	chainDataDir := t.TempDir()
+	db := memdb.New()
+	gatherer := metrics.NewPrefixGatherer()
+
+	// The node restarting the chain initializes a new VM in the same
+	// process, over the database, data directory and metrics of the VM it
+	// shut down
+	vm, err := initializeDataDirVM(t, chainID, nodeID, chainDataDir, db, gatherer, key, nil)
+	require.NoError(err)
+	buildTestChain(t, vm, 2)
+	tip := vm.chain.BestSnapshot().Hash
+	require.NoError(vm.Shutdown(ctx))
+
+	// The block database was closed before Shutdown returned
+	dbPath := btcd.BlockDBPath(vm.config.DataDir, vm.config.DbType)
+	blockDB, err := btcdb.Open(vm.config.DbType, dbPath, vm.config.ChainParams.Net)
+	require.NoError(err)
+	require.NoError(blockDB.Close())
+
+	// A VM failing to initialize after opening the block database closes
+	// it again
+	mismatch := checkpointsBytes(Checkpoint{Height: 1, Hash: fmt.Sprintf("%064x", 1)})
+	_, err = initializeDataDirVM(t, chainID, nodeID, chainDataDir, db, gatherer, key, mismatch)
+	require.ErrorIs(err, errCheckpointMismatch)
+
+	vm, err = initializeDataDirVM(t, chainID, nodeID, chainDataDir, db, gatherer, key, nil)
+	require.NoError(err)
+	require.Equal(tip, vm.chain.BestSnapshot().Hash)
+	buildTestChain(t, vm, 1)
+	require.Equal(int32(3), vm.chain.BestSnapshot().Height)
+	require.NoError(vm.Shutdown(ctx))
+}
+
+func TestLegacyDataDirMigration(t *testing.T) {
+	require := require.New(t)
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	var nodeID ids.NodeID
+	_, err = rand.Read(nodeID[:])
+	require.NoError(err)
+
+	// The database of a chain run before the node gave data directories is
+	// in the home directory of the node
+	homeDir := btcutil.AppDataDir("btcdvm/"+nodeID.String(), false)
+	t.Cleanup(func() {
+		require.NoError(os.RemoveAll(homeDir))
+	})
+	legacyDataDir := filepath.Join(homeDir, "data", btcd.BtcvmTestNetParms.Name)
+	legacyDBPath := btcd.BlockDBPath(legacyDataDir, "ffldb")
+	require.NoError(os.MkdirAll(legacyDataDir, 0o700))
+	legacyDB, err := btcdb.Create("ffldb", legacyDBPath, btcd.BtcvmTestNetParms.Net)
+	require.NoError(err)
+	require.NoError(legacyDB.Close())
+
+	// It is not moved to the data directory of new chains, which cannot
+	// tell whether it is theirs
+	fresh := newDataDirVM(t, nodeID, t.TempDir(), memdb.New(), key, nil)
+	require.True(pathExists(legacyDBPath))
+	require.True(pathExists(btcd.BlockDBPath(fresh.config.DataDir, fresh.config.DbType)))
+
+	// It is moved to the data directory of chains that ran before
+	db := memdb.New()
+	require.NoError(db.Put(feeEstimatorKey, nil))
+	vm := newDataDirVM(t, nodeID, t.TempDir(), db, key, nil)
+	require.False(pathExists(legacyDataDir))
+	require.True(pathExists(btcd.BlockDBPath(vm.config.DataDir, vm.config.DbType)))
+}
+
+func TestMemDBDataDir(t *testing.T) {
+	require := require.New(t)
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+
+	// Chains in memory leave nothing in their data directory
+	chainDataDir := t.TempDir()
+	vm := newDataDirVM(t, ids.GenerateTestNodeID(), chainDataDir, memdb.New(), key, []byte(`{"dbType":"memdb"}`))
+	require.Equal("memdb", vm.config.DbType)
+	buildTestChain(t, vm, 2)
+	require.NoError(vm.Shutdown(context.Background()))
+	entries, err := os.ReadDir(chainDataDir)
+	require.NoError(err)
+	require.Empty(entries)
+}
@@ -0,0 +1,163 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	runtimepprof "runtime/pprof"
+	"time"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"go.uber.org/zap"
+)
+
+// Endpoints of the debug API. The node routes exact paths only, so each
+// endpoint is registered separately and options are passed as query
+// parameters.
+const (
+	debugPprofEndpoint      = "/debug/pprof"
+	debugGoroutinesEndpoint = "/debug/goroutines"
+	debugGCStatsEndpoint    = "/debug/gcstats"
+	debugLogLevelEndpoint   = "/debug/loglevel"
+)
+
+// debugHandlers returns the handlers of the debug API, keyed by endpoint
+func (vm *VM) debugHandlers() map[string]http.Handler {
+	return map[string]http.Handler{
+		debugPprofEndpoint:      http.HandlerFunc(serveDebugPprof),
+		debugGoroutinesEndpoint: http.HandlerFunc(serveDebugGoroutines),
+		debugGCStatsEndpoint:    http.HandlerFunc(serveDebugGCStats),
+		debugLogLevelEndpoint:   http.HandlerFunc(vm.serveDebugLogLevel),
+	}
+}
+
+// serveDebugPprof serves the pprof profile named by the name parameter: cpu
+// and trace record for the number of seconds in the seconds parameter, other
+// names are looked up in runtime/pprof. Without a name, the available
+// profiles are listed.
+func serveDebugPprof(w http.ResponseWriter, r *http.Request) {
+	switch name := r.FormValue("name"); name {
+	case "":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "cpu")
+		fmt.Fprintln(w, "trace")
+		for _, profile := range runtimepprof.Profiles() {
+			fmt.Fprintln(w, profile.Name())
+		}
+	case "cpu":
+		pprof.Profile(w, r)
+	case "trace":
+		pprof.Trace(w, r)
+	default:
+		if runtimepprof.Lookup(name) == nil {
+			http.Error(w, fmt.Sprintf("unknown profile %q", name), http.StatusNotFound)
+			return
+		}
+		pprof.Handler(name).ServeHTTP(w, r)
+	}
+}
+
+// serveDebugGoroutines writes the stack traces of all goroutines
+func serveDebugGoroutines(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_ = runtimepprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+// debugGCStats are the garbage collector and memory statistics served by the
+// debug API
+type debugGCStats struct {
+	NumGC          int64           `json:"numGC"`
+	LastGC         time.Time       `json:"lastGC"`
+	PauseTotal     time.Duration   `json:"pauseTotal"`
+	RecentPauses   []time.Duration `json:"recentPauses"`
+	HeapAlloc      uint64          `json:"heapAlloc"`
+	HeapInuse      uint64          `json:"heapInuse"`
+	HeapObjects    uint64          `json:"heapObjects"`
+	Sys            uint64          `json:"sys"`
+	NextGC         uint64          `json:"nextGC"`
+	NumGoroutine   int             `json:"numGoroutine"`
+	GCCPUFraction  float64         `json:"gcCPUFraction"`
+	TotalAlloc     uint64          `json:"totalAlloc"`
+	Mallocs        uint64          `json:"mallocs"`
+	Frees          uint64          `json:"frees"`
+	PauseQuantiles []time.Duration `json:"pauseQuantiles"`
+}
+
+// serveDebugGCStats writes the garbage collector and memory statistics as
+// JSON
+func serveDebugGCStats(w http.ResponseWriter, _ *http.Request) {
+	var (
+		gcStats  = debug.GCStats{PauseQuantiles: make([]time.Duration, 5)}
+		memStats runtime.MemStats
+	)
+	debug.ReadGCStats(&gcStats)
+	runtime.ReadMemStats(&memStats)
+
+	recentPauses := gcStats.Pause
+	if len(recentPauses) > 10 {
+		recentPauses = recentPauses[:10]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(debugGCStats{
+		NumGC:          gcStats.NumGC,
+		LastGC:         gcStats.LastGC,
+		PauseTotal:     gcStats.PauseTotal,
+		RecentPauses:   recentPauses,
+		HeapAlloc:      memStats.HeapAlloc,
+		HeapInuse:      memStats.HeapInuse,
+		HeapObjects:    memStats.HeapObjects,
+		Sys:            memStats.Sys,
+		NextGC:         memStats.NextGC,
+		NumGoroutine:   runtime.NumGoroutine(),
+		GCCPUFraction:  memStats.GCCPUFraction,
+		TotalAlloc:     memStats.TotalAlloc,
+		Mallocs:        memStats.Mallocs,
+		Frees:          memStats.Frees,
+		PauseQuantiles: gcStats.PauseQuantiles,
+	})
+}
+
+// serveDebugLogLevel sets the log levels given by the level parameter, for
+// the VM log, and the btcd parameter, for the btcd subsystems in the format of
+// the debuglevel option
+func (vm *VM) serveDebugLogLevel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "log levels must be set with POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	levelStr := r.FormValue("level")
+	btcdLevel := r.FormValue("btcd")
+	if levelStr == "" && btcdLevel == "" {
+		http.Error(w, "level or btcd must be set", http.StatusBadRequest)
+		return
+	}
+
+	if levelStr != "" {
+		level, err := logging.ToLevel(levelStr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		vm.ctx.Log.SetLevel(level)
+	}
+	if btcdLevel != "" {
+		if err := btcd.SetDebugLevels(btcdLevel); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	vm.ctx.Log.Info("Log levels changed through the debug API",
+		zap.String("level", levelStr),
+		zap.String("btcd", btcdLevel))
+	w.WriteHeader(http.StatusNoContent)
+}
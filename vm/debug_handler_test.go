@@ -0,0 +1,100 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugHandlersDisabled(t *testing.T) {
+	require := require.New(t)
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, nil)[0]
+	require.False(vm.nodeConfig.DebugAPIEnabled)
+
+	handlers, err := vm.CreateHandlers(context.Background())
+	require.NoError(err)
+	for endpoint := range handlers {
+		require.False(strings.HasPrefix(endpoint, "/debug"), endpoint)
+	}
+}
+
+func TestDebugHandlersEnabled(t *testing.T) {
+	require := require.New(t)
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, []byte(`{"debugAPIEnabled":true}`))[0]
+
+	handlers, err := vm.CreateHandlers(context.Background())
+	require.NoError(err)
+	for _, endpoint := range []string{
+		debugPprofEndpoint,
+		debugGoroutinesEndpoint,
+		debugGCStatsEndpoint,
+		debugLogLevelEndpoint,
+	} {
+		require.Contains(handlers, endpoint)
+	}
+
+	// The heap profile is a gzipped protobuf
+	recorder := httptest.NewRecorder()
+	handlers[debugPprofEndpoint].ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, debugPprofEndpoint+"?name=heap", nil))
+	require.Equal(http.StatusOK, recorder.Code)
+	reader, err := gzip.NewReader(recorder.Body)
+	require.NoError(err)
+	profile, err := io.ReadAll(reader)
+	require.NoError(err)
+	require.NotEmpty(profile)
+
+	recorder = httptest.NewRecorder()
+	handlers[debugPprofEndpoint].ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, debugPprofEndpoint+"?name=unknown", nil))
+	require.Equal(http.StatusNotFound, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handlers[debugGoroutinesEndpoint].ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, debugGoroutinesEndpoint, nil))
+	require.Equal(http.StatusOK, recorder.Code)
+	require.Contains(recorder.Body.String(), "goroutine")
+
+	recorder = httptest.NewRecorder()
+	handlers[debugGCStatsEndpoint].ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, debugGCStatsEndpoint, nil))
+	require.Equal(http.StatusOK, recorder.Code)
+	require.Contains(recorder.Body.String(), `"numGoroutine"`)
+}
+
+func TestDebugLogLevel(t *testing.T) {
+	require := require.New(t)
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, "", []byte(`{"debugAPIEnabled":true}`))[0]
+	handler := vm.debugHandlers()[debugLogLevelEndpoint]
+
+	setLevels := func(method string, values url.Values) int {
+		request := httptest.NewRequest(method, debugLogLevelEndpoint, bytes.NewBufferString(values.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	require.Equal(http.StatusNoContent, setLevels(http.MethodPost, url.Values{"level": {"debug"}}))
+	require.Equal(http.StatusMethodNotAllowed, setLevels(http.MethodGet, url.Values{"level": {"debug"}}))
+	require.Equal(http.StatusBadRequest, setLevels(http.MethodPost, url.Values{}))
+	require.Equal(http.StatusBadRequest, setLevels(http.MethodPost, url.Values{"level": {"loud"}}))
+	require.Equal(http.StatusBadRequest, setLevels(http.MethodPost, url.Values{"btcd": {"loud"}}))
+}
@@ -0,0 +1,137 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/MetalBlockchain/metalgo/database"
+
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg"
+)
+
+var (
+	errUnknownDeployment       = errors.New("unknown deployment")
+	errActivationHeightPassed  = errors.New("activation height already passed")
+	errActivationLockedIn      = errors.New("deployment already locked in by version bits signalling")
+	errInvalidActivationHeight = errors.New("invalid activation height")
+
+	// activationHeightsKey is the key of the activation heights the chain
+	// was last initialized with
+	activationHeightsKey = []byte("activationHeights")
+)
+
+// deploymentIDs are the deployments whose activation can be scheduled by the
+// upgrades, by their name in getblockchaininfo
+var deploymentIDs = map[string]int{
+	"dummy":                chaincfg.DeploymentTestDummy,
+	"dummy-min-activation": chaincfg.DeploymentTestDummyMinActivation,
+	"csv":                  chaincfg.DeploymentCSV,
+	"segwit":               chaincfg.DeploymentSegwit,
+	"taproot":              chaincfg.DeploymentTaproot,
+	"dummy-always-active":  chaincfg.DeploymentTestDummyAlwaysActive,
+}
+
+// validateActivationHeights checks that activation heights are scheduled for
+// known deployments at block heights
+func validateActivationHeights(heights map[string]uint32) error {
+	for name, height := range heights {
+		if _, ok := deploymentIDs[name]; !ok {
+			return fmt.Errorf("%w: %q", errUnknownDeployment, name)
+		}
+		if height > math.MaxInt32 {
+			return fmt.Errorf("%w: %s at %d, above %d", errInvalidActivationHeight, name, height, math.MaxInt32)
+		}
+	}
+	return nil
+}
+
+// effectiveActivationHeight returns the height of the first block enforcing a
+// deployment activated at height. The genesis block enforces no deployment,
+// so activations at heights 0 and 1 are the same.
+func effectiveActivationHeight(height uint32) uint32 {
+	return max(height, 1)
+}
+
+// scheduleActivations forces the deployments to activate at their activation
+// heights. Scheduled deployments cannot activate earlier by signalling.
+func scheduleActivations(params *chaincfg.Params, heights map[string]uint32) {
+	for name, height := range heights {
+		deployment := &params.Deployments[deploymentIDs[name]]
+		deployment.AlwaysActiveHeight = effectiveActivationHeight(height)
+		deployment.MinActivationHeight = effectiveActivationHeight(height)
+	}
+}
+
+// verifyActivationHeights checks that the activation heights of the upgrades
+// do not move activations at or below the tip of the chain from the heights
+// the chain was last initialized with, or from those of the unscheduled
+// deployments, and records them. Deployments locked in by signalling cannot
+// be scheduled either since their activation height is already decided.
+func (vm *VM) verifyActivationHeights(
+	heights map[string]uint32,
+	deployments [chaincfg.DefinedDeployments]chaincfg.ConsensusDeployment,
+) error {
+	chain := vm.btcdAdapter.Chain()
+	tipHeight := uint32(chain.BestSnapshot().Height)
+
+	var previous map[string]uint32
+	data, err := vm.db.Get(activationHeightsKey)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &previous); err != nil {
+			return fmt.Errorf("failed to parse recorded activation heights: %w", err)
+		}
+	case errors.Is(err, database.ErrNotFound):
+	default:
+		return fmt.Errorf("failed to read recorded activation heights: %w", err)
+	}
+
+	for name, id := range deploymentIDs {
+		activationHeight := deployments[id].EffectiveAlwaysActiveHeight()
+		previousHeight := activationHeight
+		previouslyScheduled, wasScheduled := previous[name]
+		if wasScheduled {
+			previousHeight = effectiveActivationHeight(previouslyScheduled)
+		}
+		height, scheduled := heights[name]
+		if scheduled {
+			activationHeight = effectiveActivationHeight(height)
+		}
+		if activationHeight == previousHeight {
+			continue
+		}
+
+		if min(previousHeight, activationHeight) <= tipHeight {
+			return fmt.Errorf("%w: cannot move activation of %s from height %d to %d with the tip at height %d",
+				errActivationHeightPassed, name, previousHeight, activationHeight, tipHeight)
+		}
+		if !scheduled || wasScheduled {
+			continue
+		}
+		state, err := chain.ThresholdState(uint32(id))
+		if err != nil {
+			return fmt.Errorf("failed to look up state of %s: %w", name, err)
+		}
+		if state == blockchain.ThresholdLockedIn {
+			return fmt.Errorf("%w: cannot activate %s at height %d", errActivationLockedIn, name, height)
+		}
+	}
+
+	if heights == nil {
+		heights = map[string]uint32{}
+	}
+	data, err = json.Marshal(heights)
+	if err != nil {
+		return err
+	}
+	if err := vm.db.Put(activationHeightsKey, data); err != nil {
+		return fmt.Errorf("failed to record activation heights: %w", err)
+	}
+	return nil
+}
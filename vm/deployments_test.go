@@ -0,0 +1,182 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MetalBlockchain/metalgo/database/memdb"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/utils/constants"
+	"github.com/MetalBlockchain/metalgo/utils/crypto/bls"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/MetalBlockchain/metalgo/vms/platformvm/warp"
+	"github.com/stretchr/testify/require"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg"
+)
+
+// newDeploymentsVM initializes a VM mining to key with the given upgrade
+// bytes, extraConfig being added to its genesis config
+func newDeploymentsVM(t *testing.T, key *btcec.PrivateKey, extraConfig string, upgradeBytes []byte) (*VM, error) {
+	addr, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160(key.PubKey().SerializeCompressed()),
+		&btcd.BtcvmTestNetParms,
+	)
+	require.NoError(t, err)
+	sk, err := bls.NewSigner()
+	require.NoError(t, err)
+	chainID := ids.GenerateTestID()
+	vm := &VM{}
+	err = vm.Initialize(
+		context.Background(),
+		&snow.Context{
+			NetworkID:  constants.UnitTestID,
+			ChainID:    chainID,
+			NodeID:     newTestNodeID(t),
+			PublicKey:  sk.PublicKey(),
+			Log:        logging.NoLog{},
+			WarpSigner: warp.NewSigner(sk, constants.UnitTestID, chainID),
+		},
+		memdb.New(),
+		[]byte(`{"config":{"testNet":true,"miningAddrs":["`+addr.EncodeAddress()+`"]`+extraConfig+`}}`),
+		upgradeBytes,
+		nil,
+		make(chan common.Message, 1),
+		nil,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		require.NoError(t, vm.Shutdown(context.Background()))
+	})
+	return vm, nil
+}
+
+func TestActivationHeights(t *testing.T) {
+	const activationHeight = 10
+
+	require := require.New(t)
+	t.Setenv("HOME", t.TempDir())
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm, err := newDeploymentsVM(t, key, "", []byte(`{"activationHeights":{"dummy":10}}`))
+	require.NoError(err)
+	chain := vm.btcdAdapter.Chain()
+	require.Equal(uint32(activationHeight), vm.config.ChainParams.Deployments[chaincfg.DeploymentTestDummy].AlwaysActiveHeight)
+	require.Zero(btcd.BtcvmTestNetParms.Deployments[chaincfg.DeploymentTestDummy].AlwaysActiveHeight)
+
+	// The threshold state is that of the block after the tip. The deployment
+	// is active from the block at its activation height although the first
+	// confirmation window of version bits signalling has not ended.
+	for height := int32(1); height < activationHeight; height++ {
+		state, err := chain.ThresholdState(chaincfg.DeploymentTestDummy)
+		require.NoError(err)
+		require.Equal(blockchain.ThresholdDefined, state, "block %d", height)
+		buildTestChain(t, vm, 1)
+	}
+	state, err := chain.ThresholdState(chaincfg.DeploymentTestDummy)
+	require.NoError(err)
+	require.Equal(blockchain.ThresholdActive, state)
+
+	buildTestChain(t, vm, 1)
+	require.Equal(int32(activationHeight), chain.BestSnapshot().Height)
+	active, err := chain.IsDeploymentActive(chaincfg.DeploymentTestDummy)
+	require.NoError(err)
+	require.True(active)
+
+	// Unscheduled deployments still follow signalling
+	state, err = chain.ThresholdState(chaincfg.DeploymentTaproot)
+	require.NoError(err)
+	require.Equal(blockchain.ThresholdDefined, state)
+
+	// Nodes restarting with upgrades moving the passed activation are
+	// rejected
+	deployments := btcd.BtcvmTestNetParms.Deployments
+	for _, heights := range []map[string]uint32{
+		nil,
+		{"dummy": 5},
+		{"dummy": 20},
+		{"dummy": 10, "csv": 5},
+		{"dummy": 10, "dummy-always-active": 20},
+	} {
+		require.ErrorIs(vm.verifyActivationHeights(heights, deployments), errActivationHeightPassed, "%v", heights)
+	}
+
+	// Activations above the tip can be scheduled and moved
+	for _, heights := range []map[string]uint32{
+		{"dummy": 10, "csv": 20},
+		{"dummy": 10, "csv": 30},
+		{"dummy": 10},
+	} {
+		require.NoError(vm.verifyActivationHeights(heights, deployments), "%v", heights)
+	}
+
+	// Nodes with mismatched upgrades fail to initialize
+	_, err = newDeploymentsVM(t, key, "", []byte(`{"activationHeights":{"taprootActivationHeight":0}}`))
+	require.ErrorIs(err, errUnknownDeployment)
+}
+
+func TestActivationHeightsValidation(t *testing.T) {
+	require := require.New(t)
+
+	for _, upgradeBytes := range []string{
+		`{"activationHeights":{"unknown":10}}`,
+		`{"activationHeights":{"taprootActivationHeight":10}}`,
+	} {
+		upgrades, err := parseUpgradeBytes([]byte(upgradeBytes))
+		require.NoError(err)
+		require.ErrorIs(upgrades.Validate(), errUnknownDeployment, upgradeBytes)
+	}
+
+	upgrades, err := parseUpgradeBytes([]byte(`{"activationHeights":{"segwit":2147483648}}`))
+	require.NoError(err)
+	require.ErrorIs(upgrades.Validate(), errInvalidActivationHeight)
+
+	// Activations at the genesis are enforced from the first block
+	upgrades, err = parseUpgradeBytes([]byte(`{"activationHeights":{"segwit":0,"taproot":100000}}`))
+	require.NoError(err)
+	require.NoError(upgrades.Validate())
+	config := &btcd.Config{ChainParams: &btcd.BtcvmTestNetParms}
+	(&ChainParams{}).apply(config)
+	upgrades.apply(config)
+	segwit := config.ChainParams.Deployments[chaincfg.DeploymentSegwit]
+	require.Equal(uint32(1), segwit.AlwaysActiveHeight)
+	require.Equal(uint32(1), segwit.MinActivationHeight)
+	require.Equal(uint32(100_000), config.ChainParams.Deployments[chaincfg.DeploymentTaproot].AlwaysActiveHeight)
+	require.Zero(btcd.BtcvmTestNetParms.Deployments[chaincfg.DeploymentSegwit].AlwaysActiveHeight)
+}
+
+func TestActivationHeightsLockedIn(t *testing.T) {
+	require := require.New(t)
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMs(t, 1, key)[0]
+	chain := vm.btcdAdapter.Chain()
+
+	// Deployments locked in by signalling cannot be scheduled
+	for {
+		state, err := chain.ThresholdState(chaincfg.DeploymentSegwit)
+		require.NoError(err)
+		if state == blockchain.ThresholdLockedIn {
+			break
+		}
+		buildTestChain(t, vm, 1)
+	}
+	deployments := btcd.BtcvmTestNetParms.Deployments
+	tipHeight := uint32(chain.BestSnapshot().Height)
+	require.ErrorIs(vm.verifyActivationHeights(map[string]uint32{"segwit": tipHeight + 100}, deployments), errActivationLockedIn)
+	require.NoError(vm.verifyActivationHeights(nil, deployments))
+}
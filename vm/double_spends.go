@@ -0,0 +1,141 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/MetalBlockchain/metalgo/cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/mempool"
+)
+
+const (
+	// doubleSpendCacheSize is the number of transactions whose recent double
+	// spends are remembered for getdoublespends
+	doubleSpendCacheSize = 1024
+
+	// maxDoubleSpendsPerTx is the number of double spends remembered for a
+	// single transaction, so that a transaction conflicting with many
+	// others can't grow its entry without bound
+	maxDoubleSpendsPerTx = 16
+)
+
+// Kinds of double spends of mempool transactions
+const (
+	// doubleSpendRelayed is a transaction rejected from the mempool for
+	// conflicting with a mempool transaction
+	doubleSpendRelayed = "relayed"
+
+	// doubleSpendConfirmed is a transaction confirmed in a block, evicting
+	// the mempool transaction it conflicts with
+	doubleSpendConfirmed = "confirmed"
+)
+
+// doubleSpendCache remembers the recent double spends of mempool transactions
+// by the hashes of both transactions involved
+type doubleSpendCache struct {
+	lock    sync.Mutex
+	entries *cache.LRU[chainhash.Hash, []btcjson.DoubleSpendResult]
+}
+
+// add remembers doubleSpend under the hashes of both transactions involved.
+// It returns false if it was already known.
+func (c *doubleSpendCache) add(doubleSpend btcjson.DoubleSpendResult, txHashes ...*chainhash.Hash) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, txHash := range txHashes {
+		doubleSpends, _ := c.entries.Get(*txHash)
+		for _, known := range doubleSpends {
+			if known.TxID == doubleSpend.TxID &&
+				known.ConflictTxID == doubleSpend.ConflictTxID &&
+				known.Confirmed == doubleSpend.Confirmed {
+				return false
+			}
+		}
+	}
+
+	for _, txHash := range txHashes {
+		doubleSpends, _ := c.entries.Get(*txHash)
+		if len(doubleSpends) >= maxDoubleSpendsPerTx {
+			doubleSpends = doubleSpends[1:]
+		}
+		// Copy the entry, as it may have been returned by get
+		doubleSpends = append(slices.Clip(doubleSpends), doubleSpend)
+		c.entries.Put(*txHash, doubleSpends)
+	}
+	return true
+}
+
+// get returns the remembered double spends involving the transaction with the
+// given hash
+func (c *doubleSpendCache) get(txHash *chainhash.Hash) []btcjson.DoubleSpendResult {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	doubleSpends, ok := c.entries.Get(*txHash)
+	if !ok {
+		return []btcjson.DoubleSpendResult{}
+	}
+	return doubleSpends
+}
+
+// initializeDoubleSpends registers the metrics of the double spends of mempool
+// transactions, and reports them over RPC
+func (vm *VM) initializeDoubleSpends() error {
+	vm.doubleSpendsSeen = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "double_spends_seen",
+		Help: "number of transactions seen conflicting with the mempool",
+	}, []string{"kind"})
+	if err := vm.metrics.Register(vm.doubleSpendsSeen); err != nil {
+		return fmt.Errorf("failed to register double spend metrics: %w", err)
+	}
+	vm.doubleSpends = &doubleSpendCache{
+		entries: &cache.LRU[chainhash.Hash, []btcjson.DoubleSpendResult]{Size: doubleSpendCacheSize},
+	}
+	vm.btcdAdapter.SetOnDoubleSpend(vm.doubleSpendSeen)
+	vm.btcdAdapter.SetDoubleSpends(vm.doubleSpends.get)
+	return nil
+}
+
+// doubleSpendSeen records a transaction conflicting with the mempool and
+// notifies the websocket clients watching it. It is called with the mempool
+// lock held.
+func (vm *VM) doubleSpendSeen(doubleSpend *mempool.DoubleSpend) {
+	result := btcjson.DoubleSpendResult{
+		TxID:         doubleSpend.Tx.Hash().String(),
+		ConflictTxID: doubleSpend.Conflict.Hash().String(),
+		OutPoints:    make([]btcjson.OutPoint, 0, len(doubleSpend.OutPoints)),
+		Confirmed:    doubleSpend.Confirmed,
+		Time:         vm.Clock.Time().Unix(),
+	}
+	for _, outPoint := range doubleSpend.OutPoints {
+		result.OutPoints = append(result.OutPoints, btcjson.OutPoint{
+			Hash:  outPoint.Hash.String(),
+			Index: outPoint.Index,
+		})
+	}
+	if !vm.doubleSpends.add(result, doubleSpend.Tx.Hash(), doubleSpend.Conflict.Hash()) {
+		return
+	}
+
+	kind := doubleSpendRelayed
+	if doubleSpend.Confirmed {
+		kind = doubleSpendConfirmed
+	}
+	vm.doubleSpendsSeen.WithLabelValues(kind).Inc()
+	vm.gossipLog.Info("Double spend seen",
+		zap.Stringer("txID", doubleSpend.Tx.Hash()),
+		zap.Stringer("conflictTxID", doubleSpend.Conflict.Hash()),
+		zap.String("kind", kind),
+	)
+	vm.btcdAdapter.NotifyDoubleSpend(&result)
+}
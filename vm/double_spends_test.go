@@ -0,0 +1,154 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+)
+
+func TestDoubleSpendNotifications(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vms := newTestVMsWithConfig(t, 2, key, `"rpcUser":"user","rpcPass":"pass"`, nil)
+	vm, miner := vms[0], vms[1]
+	for _, vm := range vms {
+		require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+		require.NoError(vm.SetState(ctx, snow.NormalOp))
+	}
+
+	// Subscribe to new transaction notifications of vm
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	server := httptest.NewServer(handlers["/ws"])
+	defer server.Close()
+
+	header := http.Header{}
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(err)
+	request.SetBasicAuth("user", "pass")
+	header.Set("Authorization", request.Header.Get("Authorization"))
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	require.NoError(err)
+	defer conn.Close()
+
+	require.NoError(conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "1.0",
+		"method":  "notifynewtransactions",
+		"params":  []interface{}{},
+		"id":      1,
+	}))
+	require.NoError(conn.SetReadDeadline(time.Now().Add(10 * time.Second)))
+	var reply wsNotification
+	require.NoError(conn.ReadJSON(&reply))
+	require.Empty(reply.Method)
+
+	// readDoubleSpend returns the next double spend notification, skipping
+	// the notifications of accepted transactions
+	readDoubleSpend := func() btcjson.DoubleSpendResult {
+		for {
+			require.NoError(conn.SetReadDeadline(time.Now().Add(10 * time.Second)))
+			var ntfn wsNotification
+			require.NoError(conn.ReadJSON(&ntfn))
+			if ntfn.Method != "doublespendseen" {
+				continue
+			}
+			require.Len(ntfn.Params, 1)
+			var doubleSpend btcjson.DoubleSpendResult
+			require.NoError(json.Unmarshal(ntfn.Params[0], &doubleSpend))
+			return doubleSpend
+		}
+	}
+	getDoubleSpends := func(txID string) []btcjson.DoubleSpendResult {
+		var result []btcjson.DoubleSpendResult
+		callRPC(t, handlers["/rpc"], "getdoublespends", []interface{}{txID}, &result)
+		return result
+	}
+
+	// Both VMs accept a block funding the spends
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(vm.SetPreference(ctx, blk.ID()))
+	require.NoError(blk.Accept(ctx))
+	minerBlk, err := miner.ParseBlock(ctx, blk.Bytes())
+	require.NoError(err)
+	require.NoError(minerBlk.Verify(ctx))
+	require.NoError(miner.SetPreference(ctx, minerBlk.ID()))
+	require.NoError(minerBlk.Accept(ctx))
+	coinbase := blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx()
+
+	// A spend of the same output as a non-signaling mempool transaction is
+	// rejected and reported
+	spend := newTestSpend(t, key, coinbase)
+	doubleSpend := newTestSpendWithFee(t, key, coinbase, 100_000)
+	txPool := vm.btcdAdapter.TxMemPool()
+	_, err = txPool.ProcessTransaction(spend, false, false, 0)
+	require.NoError(err)
+	_, err = txPool.ProcessTransaction(doubleSpend, false, false, 0)
+	require.Error(err)
+
+	want := btcjson.DoubleSpendResult{
+		TxID:         doubleSpend.Hash().String(),
+		ConflictTxID: spend.Hash().String(),
+		OutPoints: []btcjson.OutPoint{{
+			Hash:  coinbase.TxHash().String(),
+			Index: 0,
+		}},
+	}
+	got := readDoubleSpend()
+	require.NotZero(got.Time)
+	want.Time = got.Time
+	require.Equal(want, got)
+	require.Equal([]btcjson.DoubleSpendResult{want}, getDoubleSpends(spend.Hash().String()))
+	require.Equal([]btcjson.DoubleSpendResult{want}, getDoubleSpends(doubleSpend.Hash().String()))
+
+	// The same double spend is only reported once
+	_, err = txPool.ProcessTransaction(doubleSpend, false, false, 0)
+	require.Error(err)
+	require.Len(getDoubleSpends(spend.Hash().String()), 1)
+	require.Equal(float64(1), testutil.ToFloat64(vm.doubleSpendsSeen.WithLabelValues(doubleSpendRelayed)))
+
+	// A block confirming the double spend evicts the mempool transaction and
+	// is reported as well
+	_, err = miner.btcdAdapter.TxMemPool().ProcessTransaction(doubleSpend, false, false, 0)
+	require.NoError(err)
+	minerBlk, err = miner.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(minerBlk.Verify(ctx))
+	require.NoError(miner.SetPreference(ctx, minerBlk.ID()))
+	require.NoError(minerBlk.Accept(ctx))
+	blk, err = vm.ParseBlock(ctx, minerBlk.Bytes())
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(vm.SetPreference(ctx, blk.ID()))
+	require.NoError(blk.Accept(ctx))
+
+	got = readDoubleSpend()
+	want.Confirmed = true
+	want.Time = got.Time
+	require.Equal(want, got)
+	require.False(txPool.HaveTransaction(spend.Hash()))
+	require.Len(getDoubleSpends(spend.Hash().String()), 2)
+	require.Equal(float64(1), testutil.ToFloat64(vm.doubleSpendsSeen.WithLabelValues(doubleSpendConfirmed)))
+
+	// Unknown transactions have no double spends
+	require.Empty(getDoubleSpends(coinbase.TxHash().String()))
+}
@@ -0,0 +1,385 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/mempool"
+	"github.com/MetalBlockchain/metalgo/database"
+	"go.uber.org/zap"
+)
+
+const (
+	// feeEstimatorVersion is the version of the fee estimator encoding
+	feeEstimatorVersion = 0
+
+	// feeBucketMinRate and feeBucketMaxRate are the lowest and highest bucket
+	// boundaries in sat/vB. Fee rates below the lowest boundary share the
+	// first bucket and those above the highest share the last bucket.
+	feeBucketMinRate = 1.0
+	feeBucketMaxRate = 10_000.0
+
+	// feeBucketSpacing is the ratio between consecutive bucket boundaries
+	feeBucketSpacing = 1.2
+
+	// maxFeeEstimateTarget is the largest confirmation target, in blocks,
+	// that is tracked. With 2 second blocks it covers about 17 minutes.
+	maxFeeEstimateTarget = 512
+
+	// feeEstimateDecay is applied to the statistics at every accepted block,
+	// giving past blocks a half-life of about 350 blocks
+	feeEstimateDecay = 0.998
+
+	// minFeeEstimateSamples is the decayed number of confirmed transactions
+	// a range of buckets needs for its success rate to be considered
+	minFeeEstimateSamples = 10
+
+	// conservativeSuccessRate and economicalSuccessRate are the fractions of
+	// transactions of a fee rate range that must have been confirmed within
+	// the target for the range to be estimated
+	conservativeSuccessRate = 0.95
+	economicalSuccessRate   = 0.85
+
+	// feeEstimatorSaveInterval is the number of accepted blocks between two
+	// saves of the fee estimator to the database
+	feeEstimatorSaveInterval = 100
+)
+
+var (
+	_ btcd.SmartFeeEstimator = (*feeEstimator)(nil)
+
+	feeEstimatorKey = []byte("feeEstimator")
+
+	errInvalidFeeEstimator = errors.New("invalid fee estimator encoding")
+
+	// feeBucketBounds are the upper boundaries of the fee rate buckets in
+	// sat/vB. The last bucket has no upper boundary.
+	feeBucketBounds = newFeeBucketBounds()
+)
+
+func newFeeBucketBounds() []float64 {
+	var bounds []float64
+	for bound := feeBucketMinRate; bound <= feeBucketMaxRate; bound *= feeBucketSpacing {
+		bounds = append(bounds, bound)
+	}
+	return bounds
+}
+
+// feeBucket returns the index of the bucket of feeRate
+func feeBucket(feeRate float64) int {
+	return sort.SearchFloat64s(feeBucketBounds, feeRate)
+}
+
+// trackedTx is a mempool transaction waiting to be confirmed
+type trackedTx struct {
+	height  int32
+	feeRate float64
+}
+
+// feeEstimator estimates fee rates from the time transactions of each fee
+// rate take to be confirmed, counted in blocks of TargetBlockTime. For each
+// fee rate bucket it tracks the decayed number of confirmed transactions and
+// how many of them were confirmed within each target. Transactions still
+// waiting in the mempool count as failures for the targets they have missed.
+type feeEstimator struct {
+	lock sync.Mutex
+
+	// bestHeight is the height of the last registered block
+	bestHeight int32
+
+	// txCount and feeSum are the decayed number of confirmed transactions
+	// of each bucket and the sum of their fee rates
+	txCount []float64
+	feeSum  []float64
+
+	// confirmed holds, for each target minus one, the decayed number of
+	// transactions of each bucket confirmed within the target
+	confirmed [][]float64
+
+	// tracked are the mempool transactions waiting to be confirmed
+	tracked map[chainhash.Hash]trackedTx
+}
+
+// newFeeEstimator creates an estimator without statistics
+func newFeeEstimator() *feeEstimator {
+	e := &feeEstimator{
+		txCount:   make([]float64, len(feeBucketBounds)+1),
+		feeSum:    make([]float64, len(feeBucketBounds)+1),
+		confirmed: make([][]float64, maxFeeEstimateTarget),
+		tracked:   make(map[chainhash.Hash]trackedTx),
+	}
+	for i := range e.confirmed {
+		e.confirmed[i] = make([]float64, len(feeBucketBounds)+1)
+	}
+	return e
+}
+
+// observeTx starts tracking a transaction added to the mempool. It is called
+// with the mempool lock held.
+func (e *feeEstimator) observeTx(txD *mempool.TxDesc) {
+	vsize := mempool.GetTxVirtualSize(txD.Tx)
+	if vsize == 0 {
+		return
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	// A transaction returned to the mempool by a reorg keeps its first
+	// observation
+	hash := *txD.Tx.Hash()
+	if _, ok := e.tracked[hash]; ok {
+		return
+	}
+	e.tracked[hash] = trackedTx{
+		height:  txD.Height,
+		feeRate: float64(txD.Fee) / float64(vsize),
+	}
+}
+
+// registerBlock records the transactions of the block accepted at height and
+// decays the statistics. Tracked transactions for which inMempool returns
+// false, and which were not confirmed by the block, left the mempool without
+// being confirmed and are no longer tracked. inMempool is called without the
+// estimator lock held, since observeTx is called with the mempool lock held.
+func (e *feeEstimator) registerBlock(height int32, txs []*btcutil.Tx, inMempool func(*chainhash.Hash) bool) {
+	waiting := e.confirmBlock(height, txs)
+
+	var evicted []chainhash.Hash
+	for _, hash := range waiting {
+		if !inMempool(&hash) {
+			evicted = append(evicted, hash)
+		}
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for _, hash := range evicted {
+		delete(e.tracked, hash)
+	}
+}
+
+// confirmBlock decays the statistics and records the tracked transactions
+// confirmed by the block at height. It returns the transactions still
+// tracked.
+func (e *feeEstimator) confirmBlock(height int32, txs []*btcutil.Tx) []chainhash.Hash {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if height <= e.bestHeight {
+		return nil
+	}
+	e.bestHeight = height
+
+	for i := range e.txCount {
+		e.txCount[i] *= feeEstimateDecay
+		e.feeSum[i] *= feeEstimateDecay
+	}
+	for _, confirmed := range e.confirmed {
+		for i := range confirmed {
+			confirmed[i] *= feeEstimateDecay
+		}
+	}
+
+	for _, tx := range txs {
+		hash := *tx.Hash()
+		entry, ok := e.tracked[hash]
+		if !ok {
+			continue
+		}
+		delete(e.tracked, hash)
+
+		blocks := int(height - entry.height)
+		if blocks < 1 {
+			blocks = 1
+		}
+		bucket := feeBucket(entry.feeRate)
+		e.txCount[bucket]++
+		e.feeSum[bucket] += entry.feeRate
+		for target := blocks; target <= maxFeeEstimateTarget; target++ {
+			e.confirmed[target-1][bucket]++
+		}
+	}
+
+	waiting := make([]chainhash.Hash, 0, len(e.tracked))
+	for hash := range e.tracked {
+		waiting = append(waiting, hash)
+	}
+	return waiting
+}
+
+// EstimateSmartFee returns the fee rate in satoshis per kvB for a transaction
+// to be confirmed within confTarget blocks. Targets beyond the tracked range
+// are estimated for the largest tracked target.
+func (e *feeEstimator) EstimateSmartFee(confTarget uint32, conservative bool) (btcutil.Amount, uint32, error) {
+	if confTarget > maxFeeEstimateTarget {
+		confTarget = maxFeeEstimateTarget
+	}
+	if confTarget == 0 {
+		confTarget = 1
+	}
+
+	successRate := economicalSuccessRate
+	if conservative {
+		successRate = conservativeSuccessRate
+	}
+	feeRate, err := e.estimate(int(confTarget), successRate)
+	if err != nil {
+		return 0, confTarget, err
+	}
+	return btcutil.Amount(math.Ceil(feeRate * 1000)), confTarget, nil
+}
+
+// EstimateFeeByTime returns the fee rate in satoshis per kvB for a
+// transaction to be confirmed within d, which is counted in blocks of
+// TargetBlockTime
+func (e *feeEstimator) EstimateFeeByTime(d time.Duration, conservative bool) (btcutil.Amount, uint32, error) {
+	blocks := d / TargetBlockTime
+	if blocks > maxFeeEstimateTarget {
+		blocks = maxFeeEstimateTarget
+	}
+	return e.EstimateSmartFee(uint32(blocks), conservative)
+}
+
+// estimate returns the fee rate in sat/vB of the cheapest range of buckets
+// whose transactions, and all transactions of the more expensive ranges, were
+// confirmed within target blocks at successRate. Buckets are grouped into
+// ranges from the most expensive down until each range has enough samples.
+// The ranges do not depend on the target, so estimates never increase with
+// the target.
+func (e *feeEstimator) estimate(target int, successRate float64) (float64, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	// Waiting transactions which have missed the target are failures
+	failed := make([]float64, len(e.txCount))
+	for _, entry := range e.tracked {
+		if int(e.bestHeight-entry.height) >= target {
+			failed[feeBucket(entry.feeRate)]++
+		}
+	}
+
+	var (
+		confirmed = e.confirmed[target-1]
+		found     bool
+		estimate  float64
+
+		rangeCount, rangeFeeSum, rangeConfirmed, rangeFailed float64
+	)
+	for bucket := len(e.txCount) - 1; bucket >= 0; bucket-- {
+		rangeCount += e.txCount[bucket]
+		rangeFeeSum += e.feeSum[bucket]
+		rangeConfirmed += confirmed[bucket]
+		rangeFailed += failed[bucket]
+		if rangeCount < minFeeEstimateSamples {
+			continue
+		}
+
+		if rangeConfirmed/(rangeCount+rangeFailed) < successRate {
+			break
+		}
+		found = true
+		estimate = rangeFeeSum / rangeCount
+		rangeCount, rangeFeeSum, rangeConfirmed, rangeFailed = 0, 0, 0, 0
+	}
+	if !found {
+		return 0, btcd.ErrInsufficientFeeData
+	}
+	return estimate, nil
+}
+
+// Bytes returns the encoding of the statistics of the estimator. Tracked
+// transactions are not saved since the mempool is not persisted.
+func (e *feeEstimator) Bytes() []byte {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	numBuckets := len(e.txCount)
+	bytes := make([]byte, 1+2+2+4, 1+2+2+4+8*numBuckets*(2+maxFeeEstimateTarget))
+	bytes[0] = feeEstimatorVersion
+	binary.BigEndian.PutUint16(bytes[1:], uint16(numBuckets))
+	binary.BigEndian.PutUint16(bytes[3:], maxFeeEstimateTarget)
+	binary.BigEndian.PutUint32(bytes[5:], uint32(e.bestHeight))
+	for _, values := range append([][]float64{e.txCount, e.feeSum}, e.confirmed...) {
+		for _, value := range values {
+			bytes = binary.BigEndian.AppendUint64(bytes, math.Float64bits(value))
+		}
+	}
+	return bytes
+}
+
+// parseFeeEstimator restores an estimator from bytes. Estimators saved with a
+// different version or bucket layout are rejected.
+func parseFeeEstimator(bytes []byte) (*feeEstimator, error) {
+	e := newFeeEstimator()
+	numBuckets := len(e.txCount)
+	if len(bytes) != 1+2+2+4+8*numBuckets*(2+maxFeeEstimateTarget) ||
+		bytes[0] != feeEstimatorVersion ||
+		binary.BigEndian.Uint16(bytes[1:]) != uint16(numBuckets) ||
+		binary.BigEndian.Uint16(bytes[3:]) != maxFeeEstimateTarget {
+		return nil, errInvalidFeeEstimator
+	}
+
+	e.bestHeight = int32(binary.BigEndian.Uint32(bytes[5:]))
+	bytes = bytes[9:]
+	for _, values := range append([][]float64{e.txCount, e.feeSum}, e.confirmed...) {
+		for i := range values {
+			values[i] = math.Float64frombits(binary.BigEndian.Uint64(bytes))
+			bytes = bytes[8:]
+		}
+	}
+	return e, nil
+}
+
+// initializeFeeEstimator restores the fee estimator from the database, or
+// creates a new one, and registers it with the btcd adapter
+func (vm *VM) initializeFeeEstimator() error {
+	estimatorBytes, err := vm.db.Get(feeEstimatorKey)
+	switch err {
+	case nil:
+		vm.feeEstimator, err = parseFeeEstimator(estimatorBytes)
+		if err != nil {
+			vm.ctx.Log.Warn("Discarding saved fee estimator",
+				zap.Error(err))
+			vm.feeEstimator = newFeeEstimator()
+		}
+	case database.ErrNotFound:
+		vm.feeEstimator = newFeeEstimator()
+	default:
+		return fmt.Errorf("failed to load fee estimator: %w", err)
+	}
+
+	vm.btcdAdapter.SetOnTxAdded(vm.feeEstimator.observeTx)
+	vm.btcdAdapter.SetSmartFeeEstimator(vm.feeEstimator)
+	return nil
+}
+
+// registerAcceptedBlock records the transactions of an accepted block for
+// fee estimation and periodically saves the estimator
+func (vm *VM) registerAcceptedBlock(height uint64, block *btcutil.Block) {
+	txPool := vm.btcdAdapter.TxMemPool()
+	vm.feeEstimator.registerBlock(int32(height), block.Transactions()[1:], txPool.IsTransactionInPool)
+
+	if height%feeEstimatorSaveInterval == 0 {
+		vm.saveFeeEstimator()
+	}
+}
+
+// saveFeeEstimator writes the fee estimator to the database
+func (vm *VM) saveFeeEstimator() {
+	if err := vm.db.Put(feeEstimatorKey, vm.feeEstimator.Bytes()); err != nil {
+		vm.ctx.Log.Warn("Failed to save fee estimator", zap.Error(err))
+	}
+}
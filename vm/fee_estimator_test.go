@@ -0,0 +1,218 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/mempool"
+	"github.com/MetalBlockchain/btcvm/btcd/mining"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+// testFeeClass is a fee rate paid by some synthetic transactions and the
+// number of blocks they wait before being confirmed, 0 if they are never
+// confirmed
+type testFeeClass struct {
+	feeRate int64
+	blocks  int32
+}
+
+var testFeeClasses = []testFeeClass{
+	{feeRate: 100, blocks: 1},
+	{feeRate: 20, blocks: 3},
+	{feeRate: 5, blocks: 10},
+	{feeRate: 2, blocks: 0},
+}
+
+// feedTestFeeEstimator registers numBlocks synthetic blocks with e. Two
+// transactions of each fee class enter the mempool at every height and are
+// confirmed after the number of blocks of their class.
+func feedTestFeeEstimator(t testing.TB, e *feeEstimator, numBlocks int32) {
+	var (
+		lockTime uint32
+		pending  = make(map[int32][]*btcutil.Tx)
+		inPool   = make(map[chainhash.Hash]struct{})
+	)
+	for height := int32(1); height <= numBlocks; height++ {
+		// The block confirms the transactions due at height
+		txs := pending[height]
+		delete(pending, height)
+		for _, tx := range txs {
+			delete(inPool, *tx.Hash())
+		}
+		e.registerBlock(height, txs, func(hash *chainhash.Hash) bool {
+			_, ok := inPool[*hash]
+			return ok
+		})
+
+		for _, class := range testFeeClasses {
+			for i := 0; i < 2; i++ {
+				msgTx := wire.NewMsgTx(wire.TxVersion)
+				msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+				msgTx.AddTxOut(wire.NewTxOut(0, nil))
+				msgTx.LockTime = lockTime
+				lockTime++
+
+				tx := btcutil.NewTx(msgTx)
+				e.observeTx(&mempool.TxDesc{
+					TxDesc: mining.TxDesc{
+						Tx:     tx,
+						Height: height,
+						Fee:    class.feeRate * mempool.GetTxVirtualSize(tx),
+					},
+				})
+				inPool[*tx.Hash()] = struct{}{}
+				if class.blocks > 0 {
+					pending[height+class.blocks] = append(pending[height+class.blocks], tx)
+				}
+			}
+		}
+	}
+	require.Len(t, e.tracked, len(inPool))
+}
+
+func TestFeeEstimator(t *testing.T) {
+	require := require.New(t)
+
+	e := newFeeEstimator()
+	_, blocks, err := e.EstimateSmartFee(6, true)
+	require.ErrorIs(err, btcd.ErrInsufficientFeeData)
+	require.Equal(uint32(6), blocks)
+
+	feedTestFeeEstimator(t, e, 200)
+
+	// Estimates never increase with the target
+	for _, conservative := range []bool{true, false} {
+		previous := btcutil.Amount(-1)
+		for target := uint32(1); target <= maxFeeEstimateTarget; target++ {
+			feeRate, blocks, err := e.EstimateSmartFee(target, conservative)
+			require.NoError(err)
+			require.Equal(target, blocks)
+			if previous >= 0 {
+				require.LessOrEqual(feeRate, previous, "target %d", target)
+			}
+			previous = feeRate
+		}
+	}
+
+	// Each target is estimated at the cheapest fee rate confirmed within it.
+	// The transactions which are never confirmed do not lower the estimates.
+	tests := []struct {
+		target  uint32
+		feeRate btcutil.Amount
+	}{
+		{target: 1, feeRate: 100_000},
+		{target: 2, feeRate: 100_000},
+		{target: 3, feeRate: 20_000},
+		{target: 9, feeRate: 20_000},
+		{target: 10, feeRate: 5_000},
+		{target: maxFeeEstimateTarget, feeRate: 5_000},
+		{target: maxFeeEstimateTarget + 1, feeRate: 5_000},
+	}
+	for _, test := range tests {
+		feeRate, _, err := e.EstimateSmartFee(test.target, true)
+		require.NoError(err)
+		require.Equal(test.feeRate, feeRate, "target %d", test.target)
+	}
+
+	// Durations are converted to blocks of TargetBlockTime
+	for _, test := range []struct {
+		d      time.Duration
+		blocks uint32
+	}{
+		{d: 0, blocks: 1},
+		{d: TargetBlockTime, blocks: 1},
+		{d: 5 * TargetBlockTime / 2, blocks: 2},
+		{d: 10 * TargetBlockTime, blocks: 10},
+		{d: time.Hour, blocks: maxFeeEstimateTarget},
+	} {
+		_, blocks, err := e.EstimateFeeByTime(test.d, true)
+		require.NoError(err)
+		require.Equal(test.blocks, blocks, "duration %s", test.d)
+	}
+
+	// Blocks at or below the best height are ignored
+	saved := e.Bytes()
+	e.registerBlock(100, nil, func(*chainhash.Hash) bool { return true })
+	require.Equal(saved, e.Bytes())
+
+	// The statistics survive a restart
+	restored, err := parseFeeEstimator(saved)
+	require.NoError(err)
+	require.Equal(e.bestHeight, restored.bestHeight)
+	require.Empty(restored.tracked)
+	for _, test := range tests {
+		want, _, err := e.EstimateSmartFee(test.target, true)
+		require.NoError(err)
+		got, _, err := restored.EstimateSmartFee(test.target, true)
+		require.NoError(err)
+		require.Equal(want, got)
+	}
+
+	_, err = parseFeeEstimator(saved[1:])
+	require.ErrorIs(err, errInvalidFeeEstimator)
+}
+
+func TestFeeEstimatorDecay(t *testing.T) {
+	require := require.New(t)
+
+	e := newFeeEstimator()
+	feedTestFeeEstimator(t, e, 200)
+	count := e.txCount[feeBucket(100)]
+
+	// Empty blocks decay the statistics until estimates are no longer
+	// supported by enough transactions
+	inPool := func(*chainhash.Hash) bool { return false }
+	e.registerBlock(201, nil, inPool)
+	require.InDelta(count*feeEstimateDecay, e.txCount[feeBucket(100)], 1e-9)
+	require.Empty(e.tracked)
+
+	for height := int32(202); height < 5000; height++ {
+		e.registerBlock(height, nil, inPool)
+	}
+	_, _, err := e.EstimateSmartFee(1, true)
+	require.ErrorIs(err, btcd.ErrInsufficientFeeData)
+}
+
+func TestFeeEstimatorRPC(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, nil)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	handler := handlers["/rpc"]
+
+	var result btcjson.EstimateSmartFeeResult
+	callRPC(t, handler, "estimatesmartfee", []interface{}{6}, &result)
+	require.Nil(result.FeeRate)
+	require.Equal([]string{btcd.ErrInsufficientFeeData.Error()}, result.Errors)
+	require.Equal(int64(6), result.Blocks)
+
+	feedTestFeeEstimator(t, vm.feeEstimator, 200)
+
+	result = btcjson.EstimateSmartFeeResult{}
+	callRPC(t, handler, "estimatesmartfee", []interface{}{1, "ECONOMICAL"}, &result)
+	require.NotNil(result.FeeRate)
+	require.InDelta(0.001, *result.FeeRate, 1e-12)
+	require.Equal(int64(1), result.Blocks)
+
+	// 20 seconds are 10 blocks
+	result = btcjson.EstimateSmartFeeResult{}
+	callRPC(t, handler, "estimatefeebytime", []interface{}{20}, &result)
+	require.NotNil(result.FeeRate)
+	require.InDelta(0.00005, *result.FeeRate, 1e-12)
+	require.Equal(int64(10), result.Blocks)
+}
@@ -0,0 +1,81 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/metalgo/database"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"go.uber.org/zap"
+)
+
+// finalityAllowance is the number of blocks below the last accepted block a
+// processed block may fork from the accepted chain. Blocks rejected by
+// consensus fork just below the tip, and peers may still relay them.
+const finalityAllowance = 6
+
+// ErrForkBelowFinality is returned for blocks forking from the accepted chain
+// more than finalityAllowance blocks below the last accepted block
+var ErrForkBelowFinality = errors.New("block forks from the accepted chain below the finality allowance")
+
+// checkFinality returns ErrForkBelowFinality if block forks from the accepted
+// chain too deep below the last accepted block. It is checked before btcd
+// processes the block, so that an alternate history is never stored. Orphans
+// pass, as the fork of their ancestry is only known once their parent arrives.
+func (vm *VM) checkFinality(block *btcutil.Block) error {
+	acceptedHeight, err := database.GetUInt64(vm.db, acceptedHeightKey)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read last accepted height: %w", err)
+	}
+	minForkHeight := int64(acceptedHeight) - finalityAllowance
+
+	// Walk the ancestry of the block down to the accepted chain
+	hash := &block.MsgBlock().Header.PrevBlock
+	for {
+		height, err := vm.chain.BlockHeightByHashAny(hash)
+		if blockchain.IsBlockNotFoundErr(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if int64(height) < minForkHeight {
+			return fmt.Errorf("%w: %s forks at height %d or below, last accepted height is %d",
+				ErrForkBelowFinality, block.Hash(), height, acceptedHeight)
+		}
+		if uint64(height) <= acceptedHeight {
+			blkID, err := vm.acceptedBlockID(uint64(height))
+			if err != nil {
+				return err
+			}
+			if blkID == hashToID(hash) {
+				return nil
+			}
+		}
+
+		header, err := vm.chain.HeaderByHash(hash)
+		if err != nil {
+			return err
+		}
+		hash = &header.PrevBlock
+	}
+}
+
+// finalize marks the accepted block blkID as final in btcd, so that blocks
+// processed later never reorganize the chain below it
+func (vm *VM) finalize(blkID ids.ID) {
+	if err := vm.chain.SetFinalizedBlock(idToHash(blkID)); err != nil {
+		vm.ctx.Log.Warn("Failed to finalize accepted block",
+			zap.Stringer("id", blkID),
+			zap.Error(err),
+		)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/MetalBlockchain/metalgo/utils/timer/mockable"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+)
+
+func TestFinalityGuard(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vms := newTestVMs(t, 2, key)
+	vm, alt := vms[0], vms[1]
+
+	// The alternate chain shares the first block and is built later, so
+	// that its blocks differ, up to more work than the accepted chain
+	buildTestChain(t, vm, 1)
+	first, err := vm.GetBlock(ctx, vm.lastAccepted)
+	require.NoError(err)
+	altFirst, err := alt.ParseBlock(ctx, first.Bytes())
+	require.NoError(err)
+	require.NoError(altFirst.Verify(ctx))
+	require.NoError(alt.SetPreference(ctx, altFirst.ID()))
+	require.NoError(altFirst.Accept(ctx))
+
+	clock := &mockable.Clock{}
+	clock.Set(time.Now().Add(10 * time.Minute))
+	alt.Clock = clock
+	buildTestChain(t, alt, 11)
+	buildTestChain(t, vm, 9)
+	tip := vm.chain.BestSnapshot().Hash
+
+	altBlocks := make([]*btcutil.Block, 0, 11)
+	for height := uint64(2); height <= 12; height++ {
+		blkID, err := alt.GetBlockIDAtHeight(ctx, height)
+		require.NoError(err)
+		blk, err := alt.GetBlock(ctx, blkID)
+		require.NoError(err)
+		altBlocks = append(altBlocks, blk.(*BlockAdapter).btcBlock)
+	}
+
+	// The alternate chain forks at height 1, below the allowance under the
+	// last accepted height 10, so its blocks are not parsed
+	blockBytes, err := altBlocks[0].Bytes()
+	require.NoError(err)
+	_, err = vm.ParseBlock(ctx, blockBytes)
+	require.ErrorIs(err, ErrForkBelowFinality)
+	have, err := vm.chain.HaveBlock(altBlocks[0].Hash())
+	require.NoError(err)
+	require.False(have)
+
+	// nor added through gossip
+	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+	status, err := vm.btcSet.SubmitBlock(altBlocks[0])
+	require.NoError(err)
+	require.Contains(status, ErrForkBelowFinality.Error())
+	require.ErrorIs(vm.btcSet.Add(NewBlockGossip(altBlocks[0])), errRecentlyRejected)
+
+	// Processed directly, the blocks are stored, but never disconnect the
+	// accepted blocks although the alternate chain has more work
+	for _, block := range altBlocks {
+		isMainChain, _, err := vm.chain.ProcessBlock(block, blockchain.BFNone)
+		require.NoError(err)
+		require.False(isMainChain)
+	}
+	require.Equal(tip, vm.chain.BestSnapshot().Hash)
+	require.EqualValues(10, vm.chain.BestSnapshot().Height)
+}
@@ -0,0 +1,172 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"go.uber.org/zap"
+)
+
+// generateRetryInterval is how long to wait for the engine to build a
+// requested block before notifying it again
+const generateRetryInterval = TargetBlockTime
+
+var (
+	errGenerateNotSupported = errors.New("block generation is not supported on this network")
+	errGenerateInterrupted  = errors.New("block generation interrupted")
+)
+
+// generateRequest is a block requested through the generatetoaddress RPC
+type generateRequest struct {
+	payToAddr btcutil.Address
+
+	// blockID is the ID of the block built for the request, if built is set
+	blockID ids.ID
+	built   bool
+
+	// accepted receives the hash of the block once it is accepted
+	accepted chan *chainhash.Hash
+}
+
+// generateToAddress builds numBlocks blocks paying payToAddr, one at a time,
+// and returns their hashes. Each block is built and accepted by the consensus
+// engine before the next is requested. Generation is only allowed on networks
+// that support it.
+func (vm *VM) generateToAddress(numBlocks uint32, payToAddr btcutil.Address, quit <-chan struct{}) ([]*chainhash.Hash, error) {
+	if !vm.config.ChainParams.GenerateSupported {
+		return nil, errGenerateNotSupported
+	}
+	if vm.nodeConfig.DisableBlockBuilding {
+		return nil, ErrBlockBuildingDisabled
+	}
+
+	// Generate for one caller at a time so that the blocks of a call are
+	// consecutive
+	vm.generateLock.Lock()
+	defer vm.generateLock.Unlock()
+
+	blockHashes := make([]*chainhash.Hash, 0, numBlocks)
+	for i := uint32(0); i < numBlocks; i++ {
+		blockHash, err := vm.generateBlock(payToAddr, quit)
+		if err != nil {
+			return blockHashes, fmt.Errorf("failed to generate block %d of %d: %w", i+1, numBlocks, err)
+		}
+		blockHashes = append(blockHashes, blockHash)
+	}
+	return blockHashes, nil
+}
+
+// generateBlock requests a block paying payToAddr from the consensus engine
+// and waits for it to be accepted
+func (vm *VM) generateBlock(payToAddr btcutil.Address, quit <-chan struct{}) (*chainhash.Hash, error) {
+	request := &generateRequest{
+		payToAddr: payToAddr,
+		accepted:  make(chan *chainhash.Hash, 1),
+	}
+
+	vm.generateMu.Lock()
+	vm.generating = request
+	vm.generateMu.Unlock()
+	defer func() {
+		vm.generateMu.Lock()
+		vm.generating = nil
+		vm.generateMu.Unlock()
+	}()
+
+	ticker := time.NewTicker(generateRetryInterval)
+	defer ticker.Stop()
+
+	vm.blockBuilder.signalGenerate()
+	for {
+		select {
+		case blockHash := <-request.accepted:
+			vm.ctx.Log.Info("Generated block",
+				zap.Stringer("hash", blockHash),
+				zap.Stringer("payToAddr", payToAddr))
+			return blockHash, nil
+		case <-ticker.C:
+			// The notification may have been dropped, or the block
+			// rejected, before a block for the request was accepted
+			if vm.generatePending() {
+				vm.blockBuilder.signalGenerate()
+			}
+		case <-quit:
+			return nil, errGenerateInterrupted
+		case <-vm.shutdownChan:
+			return nil, errGenerateInterrupted
+		}
+	}
+}
+
+// generatePending returns true if a block has been requested by
+// generateToAddress but not built yet
+func (vm *VM) generatePending() bool {
+	vm.generateMu.Lock()
+	defer vm.generateMu.Unlock()
+
+	return vm.generating != nil && !vm.generating.built
+}
+
+// payToAddr returns the address the next built block pays to: the address
+// of a pending generate request, or the first configured mining address
+func (vm *VM) payToAddr() (btcutil.Address, error) {
+	vm.generateMu.Lock()
+	request := vm.generating
+	vm.generateMu.Unlock()
+
+	if request != nil && !request.built {
+		return request.payToAddr, nil
+	}
+
+	if len(vm.config.MiningAddrs) == 0 {
+		return nil, fmt.Errorf("no mining address configured")
+	}
+
+	payToAddr, err := btcutil.DecodeAddress(vm.config.MiningAddrs[0], vm.config.ChainParams)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode mining address: %w", err)
+	}
+	return payToAddr, nil
+}
+
+// onBlockBuilt records that blockID was built paying payToAddr
+func (vm *VM) onBlockBuilt(blockID ids.ID, payToAddr btcutil.Address) {
+	vm.generateMu.Lock()
+	defer vm.generateMu.Unlock()
+
+	request := vm.generating
+	if request != nil && !request.built && request.payToAddr == payToAddr {
+		request.blockID = blockID
+		request.built = true
+	}
+}
+
+// onBlockDecided completes the pending generate request if its block was
+// accepted, or requests another block if it was rejected
+func (vm *VM) onBlockDecided(blockID ids.ID, accepted bool) {
+	vm.generateMu.Lock()
+	defer vm.generateMu.Unlock()
+
+	request := vm.generating
+	if request == nil || !request.built || request.blockID != blockID {
+		return
+	}
+
+	if !accepted {
+		request.built = false
+		return
+	}
+
+	blockHash := idToHash(blockID)
+	select {
+	case request.accepted <- blockHash:
+	default:
+	}
+}
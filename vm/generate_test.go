@@ -0,0 +1,168 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/stretchr/testify/require"
+)
+
+// runTestEngine builds, verifies and accepts a block for every message sent
+// to vm's engine channel until the test ends
+func runTestEngine(t *testing.T, vm *VM) {
+	toEngine := make(chan common.Message, 1)
+	vm.toEngine = toEngine
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+		<-stopped
+	})
+
+	go func() {
+		defer close(stopped)
+
+		ctx := context.Background()
+		for {
+			select {
+			case <-toEngine:
+			case <-done:
+				return
+			}
+
+			blk, err := vm.BuildBlock(ctx)
+			if err != nil {
+				continue
+			}
+			if err := blk.Verify(ctx); err != nil {
+				_ = blk.Reject(ctx)
+				continue
+			}
+			_ = vm.SetPreference(ctx, blk.ID())
+			_ = blk.Accept(ctx)
+		}
+	}()
+}
+
+// callRPC calls method on the RPC handler of vm and unmarshals its result
+// into result
+func callRPC(t *testing.T, handler http.Handler, method string, params []interface{}, result interface{}) {
+	require := require.New(t)
+
+	request, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "1.0",
+		"id":      1,
+		"method":  method,
+		"params":  params,
+	})
+	require.NoError(err)
+
+	httpRequest := httptest.NewRequest(http.MethodPost, "/rpc", bytes.NewReader(request))
+	httpRequest.SetBasicAuth("user", "pass")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httpRequest)
+	require.Equal(http.StatusOK, recorder.Code)
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	require.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Nil(response.Error)
+	require.NoError(json.Unmarshal(response.Result, result))
+}
+
+func TestGenerateToAddress(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	miningKey, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	// A fixed key, since an address starting with the segwit prefix of a
+	// registered network fails to decode
+	key, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{0x01}, 32))
+	addr, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160(key.PubKey().SerializeCompressed()),
+		&btcd.BtcvmTestNetParms,
+	)
+	require.NoError(err)
+
+	vm := newTestVMsWithConfig(t, 1, miningKey, `"rpcUser":"user","rpcPass":"pass"`, nil)[0]
+	runTestEngine(t, vm)
+
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	rpcHandler := handlers["/rpc"]
+
+	var blockHashes []string
+	callRPC(t, rpcHandler, "generatetoaddress", []interface{}{5, addr.EncodeAddress()}, &blockHashes)
+	require.Len(blockHashes, 5)
+
+	// The blocks were accepted in order and pay to the requested address
+	coinbases := make([]*btcutil.Tx, len(blockHashes))
+	for i, blockHashStr := range blockHashes {
+		blockHash, err := chainhash.NewHashFromStr(blockHashStr)
+		require.NoError(err)
+		blockID, err := vm.GetBlockIDAtHeight(ctx, uint64(i+1))
+		require.NoError(err)
+		require.Equal(hashToID(blockHash), blockID)
+
+		blk, err := vm.GetBlock(ctx, blockID)
+		require.NoError(err)
+		coinbases[i] = blk.(*BlockAdapter).btcBlock.Transactions()[0]
+		require.Equal(addr.ScriptAddress(), coinbases[i].MsgTx().TxOut[0].PkScript[3:23])
+	}
+	lastAccepted, err := vm.LastAccepted(ctx)
+	require.NoError(err)
+	lastHash, err := chainhash.NewHashFromStr(blockHashes[4])
+	require.NoError(err)
+	require.Equal(hashToID(lastHash), lastAccepted)
+
+	// The first coinbase is mature in the next block, at height 6
+	require.LessOrEqual(int(vm.config.ChainParams.CoinbaseMaturity), len(blockHashes))
+	spend := newTestSpend(t, key, coinbases[0].MsgTx())
+	_, err = vm.btcdAdapter.TxMemPool().ProcessTransaction(spend, false, false, 0)
+	require.NoError(err)
+
+	callRPC(t, rpcHandler, "generatetoaddress", []interface{}{1, addr.EncodeAddress()}, &blockHashes)
+	require.Len(blockHashes, 1)
+	blockHash, err := chainhash.NewHashFromStr(blockHashes[0])
+	require.NoError(err)
+	blk, err := vm.GetBlock(ctx, hashToID(blockHash))
+	require.NoError(err)
+	txs := blk.(*BlockAdapter).btcBlock.Transactions()
+	require.Len(txs, 2)
+	require.Equal(spend.Hash(), txs[1].Hash())
+}
+
+func TestGenerateToAddressNotSupported(t *testing.T) {
+	require := require.New(t)
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMs(t, 1, key)[0]
+
+	params := *vm.config.ChainParams
+	params.GenerateSupported = false
+	vm.config.ChainParams = &params
+
+	addr, err := vm.payToAddr()
+	require.NoError(err)
+	_, err = vm.generateToAddress(1, addr, nil)
+	require.ErrorIs(err, errGenerateNotSupported)
+}
@@ -0,0 +1,156 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/MetalBlockchain/metalgo/ids"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	btcdb "github.com/MetalBlockchain/btcvm/btcd/database"
+)
+
+var (
+	errInvalidGenesisHash = errors.New("invalid expectedGenesisHash")
+	errGenesisMismatch    = errors.New("genesis does not match expectedGenesisHash")
+	errForeignDataDir     = errors.New("data directory belongs to another chain")
+
+	// genesisHashKey is the key of the btcd database metadata recording the
+	// hash of the genesis of the chain the database belongs to
+	genesisHashKey = []byte("btcvmgenesishash")
+)
+
+// Genesis is the chain config a VM derives from its genesis bytes
+type Genesis struct {
+	// Hash is the hash of the genesis bytes, which the expectedGenesisHash
+	// of the nodes of the chain must be
+	Hash [sha256.Size]byte
+
+	// Config is the btcd config set by the genesis, carrying the chain
+	// params of the chain
+	Config *btcd.Config
+
+	// ChainParams are the chain params set by the genesis
+	ChainParams ChainParams
+
+	// MiningAddrs are the mining addresses of the genesis. They are not
+	// checked, as nodes not building blocks don't need valid ones.
+	MiningAddrs []string
+}
+
+// LoadGenesis derives the chain config of the chain chainID from its genesis
+// bytes, loading the btcd config for the node nodeID. The chain params set by
+// the genesis override those of the network, and the network of the chain is
+// registered when it has its own magic. Initialize derives its chain config
+// this way, so that tools checking a genesis agree with the nodes.
+func LoadGenesis(genesisBytes []byte, chainID ids.ID, nodeID ids.NodeID) (*Genesis, error) {
+	gb, err := parseGenesisBytes(genesisBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse genesis: %w", err)
+	}
+
+	miningAddrs := gb.Config.MiningAddrs
+	gb.Config.MiningAddrs = nil
+	// The command line of the process belongs to the node hosting the VM, so
+	// only the genesis config and the config file are used
+	config, _, err := btcd.LoadConfig(nodeID.String(), &gb.Config, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	if err := gb.ChainParams.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid chain params: %w", err)
+	}
+	gb.ChainParams.apply(config)
+	if err := gb.ChainParams.registerNetwork(config.ChainParams, chainID); err != nil {
+		return nil, fmt.Errorf("invalid chain params: %w", err)
+	}
+
+	return &Genesis{
+		Hash:        genesisHash(genesisBytes),
+		Config:      config,
+		ChainParams: gb.ChainParams,
+		MiningAddrs: miningAddrs,
+	}, nil
+}
+
+// DecodeMiningAddrs decodes the mining addresses of the genesis on the network
+// of the chain, as nodes building blocks do
+func (g *Genesis) DecodeMiningAddrs() ([]btcutil.Address, error) {
+	return decodeMiningAddrs(g.MiningAddrs, g.Config.ChainParams)
+}
+
+// genesisHash returns the hash of the genesis bytes of a chain, which is the
+// SHA-256 of the genesis file. The chains of the VM share their genesis block,
+// so the genesis bytes, which set their consensus rules, tell them apart.
+func genesisHash(genesisBytes []byte) [sha256.Size]byte {
+	return sha256.Sum256(genesisBytes)
+}
+
+// validateGenesisHash checks if hash, when set, is a hex-encoded SHA-256
+func validateGenesisHash(hash string) error {
+	if hash == "" {
+		return nil
+	}
+	b, err := hex.DecodeString(hash)
+	if err != nil {
+		return fmt.Errorf("%w: %q: %w", errInvalidGenesisHash, hash, err)
+	}
+	if len(b) != sha256.Size {
+		return fmt.Errorf("%w: %q is not %d bytes", errInvalidGenesisHash, hash, sha256.Size)
+	}
+	return nil
+}
+
+// verifyGenesisHash checks that the genesis bytes the VM was initialized with
+// have the expected hash of the node config, if any, so that a node launched
+// with the genesis of another chain fails to start instead of diverging at the
+// first block
+func (vm *VM) verifyGenesisHash() error {
+	expected := vm.nodeConfig.ExpectedGenesisHash
+	if expected == "" {
+		return nil
+	}
+	actual := hex.EncodeToString(vm.genesisHash[:])
+	if !strings.EqualFold(expected, actual) {
+		return fmt.Errorf("%w: expected %s, got %s", errGenesisMismatch, expected, actual)
+	}
+	return nil
+}
+
+// verifyDataDirGenesis checks that the chain database was created for the
+// genesis of the VM. The genesis block of the database must be that of the
+// network, and the genesis hash recorded in the database must be that of the
+// VM. Databases created before genesis hashes were recorded are assumed to
+// belong to the chain and record it from then on.
+func (vm *VM) verifyDataDirGenesis() error {
+	chain := vm.btcdAdapter.Chain()
+	genesisBlockHash, err := chain.BlockHashByHeight(0)
+	if err != nil {
+		return fmt.Errorf("failed to look up genesis block: %w", err)
+	}
+	if !genesisBlockHash.IsEqual(vm.config.ChainParams.GenesisHash) {
+		return fmt.Errorf("%w %s: genesis block %s, expected %s", errForeignDataDir,
+			vm.config.DataDir, genesisBlockHash, vm.config.ChainParams.GenesisHash)
+	}
+
+	return vm.btcdAdapter.DB().Update(func(dbTx btcdb.Tx) error {
+		stored := dbTx.Metadata().Get(genesisHashKey)
+		if stored == nil {
+			return dbTx.Metadata().Put(genesisHashKey, vm.genesisHash[:])
+		}
+		if !bytes.Equal(stored, vm.genesisHash[:]) {
+			return fmt.Errorf("%w %s: genesis hash %x, expected %x", errForeignDataDir,
+				vm.config.DataDir, stored, vm.genesisHash)
+		}
+		return nil
+	})
+}
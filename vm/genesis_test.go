@@ -0,0 +1,133 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/MetalBlockchain/metalgo/database/memdb"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/utils/constants"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/stretchr/testify/require"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+)
+
+// testGenesis returns a genesis mining to a new key, with extraConfig appended
+// to its config and extraGenesis to its fields
+func testGenesis(t *testing.T, extraConfig string, extraGenesis string) string {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	addr, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160(key.PubKey().SerializeCompressed()),
+		&btcd.BtcvmTestNetParms,
+	)
+	require.NoError(t, err)
+	return `{"config":{"testNet":true,"miningAddrs":["` + addr.EncodeAddress() + `"]` + extraConfig + `}` + extraGenesis + `}`
+}
+
+// initializeGenesisVM initializes a VM with genesis and configBytes
+func initializeGenesisVM(t *testing.T, genesis string, configBytes []byte) (*VM, error) {
+	vm := &VM{}
+	err := vm.Initialize(
+		context.Background(),
+		&snow.Context{
+			NetworkID: constants.UnitTestID,
+			ChainID:   ids.GenerateTestID(),
+			NodeID:    newTestNodeID(t),
+			Log:       logging.NoLog{},
+		},
+		memdb.New(),
+		[]byte(genesis),
+		nil,
+		configBytes,
+		make(chan common.Message, 1),
+		nil,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return vm, nil
+}
+
+func TestExpectedGenesisHash(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	genesis := testGenesis(t, `,"dbType":"memdb"`, "")
+	hash := sha256.Sum256([]byte(genesis))
+	tests := []struct {
+		name         string
+		expectedHash string
+		expectedErr  error
+	}{
+		{
+			name:         "matching",
+			expectedHash: hex.EncodeToString(hash[:]),
+		},
+		{
+			name:         "matching uppercase",
+			expectedHash: strings.ToUpper(hex.EncodeToString(hash[:])),
+		},
+		{
+			name:         "mismatched",
+			expectedHash: hex.EncodeToString(make([]byte, sha256.Size)),
+			expectedErr:  errGenesisMismatch,
+		},
+		{
+			name:         "not hex",
+			expectedHash: "genesis",
+			expectedErr:  errInvalidGenesisHash,
+		},
+		{
+			name:         "short",
+			expectedHash: hex.EncodeToString(hash[:16]),
+			expectedErr:  errInvalidGenesisHash,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+
+			vm, err := initializeGenesisVM(t, genesis, []byte(`{"expectedGenesisHash":"`+test.expectedHash+`"}`))
+			require.ErrorIs(err, test.expectedErr)
+			if err == nil {
+				require.Equal(hash, vm.genesisHash)
+				require.NoError(vm.Shutdown(context.Background()))
+			}
+		})
+	}
+}
+
+func TestForeignDataDir(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	t.Setenv("HOME", t.TempDir())
+
+	configBytes := []byte(`{"dataDir":"` + t.TempDir() + `"}`)
+	genesis := testGenesis(t, "", "")
+	vm, err := initializeGenesisVM(t, genesis, configBytes)
+	require.NoError(err)
+	buildTestChain(t, vm, 1)
+	require.NoError(vm.Shutdown(ctx))
+
+	// A chain with another genesis refuses to start with the database
+	otherGenesis := testGenesis(t, "", `,"chainParams":{"coinbaseMaturity":1}`)
+	_, err = initializeGenesisVM(t, otherGenesis, configBytes)
+	require.ErrorIs(err, errForeignDataDir)
+
+	// The chain of the database starts with it again
+	vm, err = initializeGenesisVM(t, genesis, configBytes)
+	require.NoError(err)
+	require.Equal(int32(1), vm.btcdAdapter.Chain().BestSnapshot().Height)
+	require.NoError(vm.Shutdown(ctx))
+}
@@ -5,28 +5,139 @@ package vm
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"sync"
 
 	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
 	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
 	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/mempool"
 	"github.com/MetalBlockchain/btcvm/btcd/wire"
 	"github.com/MetalBlockchain/metalgo/ids"
-	"github.com/MetalBlockchain/metalgo/network/p2p/gossip"
+	"github.com/MetalBlockchain/metalgo/utils/bloom"
 	"go.uber.org/zap"
 )
 
 // Custom handler IDs for btcvm
 // We use values that don't conflict with metalgo's predefined IDs
 const (
-	// BTCGossipHandlerID is the unified handler ID for both tx and block gossip
+	// BTCGossipHandlerID is the default unified handler ID for both tx and
+	// block gossip, which the node config may override
 	// We start at 100 to avoid conflicts with metalgo's handler IDs (0-2)
 	BTCGossipHandlerID = 100
+
+	// bloomChurnMultiplier is the number of times the mempool size the bloom
+	// filter is grown to when it is reset, so that it keeps room for the
+	// items leaving the mempool
+	bloomChurnMultiplier = 3
+)
+
+// Statuses of the blocks submitted with submitblock. Rejected blocks have the
+// reason of the rejection after blockStatusRejected.
+const (
+	blockStatusDuplicate = "duplicate"
+	blockStatusOrphan    = "orphan"
+	blockStatusRejected  = "rejected: "
+	blockStatusPending   = "accepted-pending-consensus"
+)
+
+var (
+	errRecentlyRejected      = errors.New("item was recently rejected")
+	errBelowMinGossipFeeRate = errors.New("transaction fee rate is below the minimum gossip fee rate")
+	errGossipItemOversized   = errors.New("gossip item exceeds the maximum item size")
 )
 
+// belowFeeRate returns true if tx, which pays fee, pays less than minFeeRate
+// sat/vB
+func belowFeeRate(tx *btcutil.Tx, fee int64, minFeeRate float64) bool {
+	return float64(fee) < minFeeRate*float64(mempool.GetTxVirtualSize(tx))
+}
+
+// shouldRelayTx returns false if the mempool transaction txD pays less than
+// the minimum relay fee rate, so it is not gossiped to peers
+func (vm *VM) shouldRelayTx(txD *mempool.TxDesc) bool {
+	minFeeRate := vm.nodeConfig.MinRelayFeeRate
+	return minFeeRate == 0 || !belowFeeRate(txD.Tx, txD.Fee, minFeeRate)
+}
+
+// addTxsToPushGossip adds the mempool transactions txns paying at least the
+// minimum relay fee rate to the push gossiper and returns how many were added
+func (vm *VM) addTxsToPushGossip(txns []*mempool.TxDesc) int {
+	added := 0
+	for _, txD := range txns {
+		if !vm.shouldRelayTx(txD) {
+			vm.gossipLog.Debug("Skipping transaction gossip - below minimum relay fee rate",
+				zap.String("hash", txD.Tx.Hash().String()),
+				zap.Int64("fee", txD.Fee))
+			continue
+		}
+
+		// Use unified gossip if available
+		if pushGossiper := vm.pushGossiper.Load(); pushGossiper != nil {
+			item := vm.newTxGossip(txD.Tx)
+			pushGossiper.Add(item)
+			added++
+			vm.gossipLog.Debug("Gossiped transaction via unified gossip",
+				zap.String("hash", txD.Tx.Hash().String()))
+		}
+	}
+	return added
+}
+
+// pushLocalTxs adds the mempool transactions txns, submitted by a client, to
+// the push gossiper and pushes them right away rather than on the next cycle
+// of the push gossip loop.
+//
+// The push only delays the response to the client: the block builder is
+// signalled of the transactions by the mempool when it accepts them, before
+// they are announced, and the messages are handed to the sender without
+// waiting for the peers.
+func (vm *VM) pushLocalTxs(txns []*mempool.TxDesc) {
+	if vm.addTxsToPushGossip(txns) == 0 {
+		return
+	}
+	if err := vm.gossipStats.push.Gossip(vm.gossipCtx); err != nil {
+		vm.gossipLog.Debug("Failed to push submitted transactions", zap.Error(err))
+	}
+}
+
+// submitBlock adds block, submitted by a client with submitblock, to the
+// unified set like the blocks received through gossip, so that it is only
+// accepted through consensus, and returns the status of the submission
+func (vm *VM) submitBlock(block *btcutil.Block) string {
+	if vm.btcSet == nil {
+		return blockStatusRejected + "node is bootstrapping"
+	}
+
+	status, err := vm.btcSet.SubmitBlock(block)
+	if err != nil {
+		return blockStatusRejected + err.Error()
+	}
+	return status
+}
+
+// blockErrStatus returns the status of a submitted block btcd failed to
+// process with err
+func blockErrStatus(err error) string {
+	var ruleErr blockchain.RuleError
+	if errors.As(err, &ruleErr) && ruleErr.ErrorCode == blockchain.ErrDuplicateBlock {
+		return blockStatusDuplicate
+	}
+	return blockStatusRejected + err.Error()
+}
+
 // BTCGossipMarshaller implements Marshaller[BTCGossip] for unified gossip
-type BTCGossipMarshaller struct{}
+type BTCGossipMarshaller struct {
+	// tipHeight returns the tip height hinted along with the blocks of known
+	// height. Blocks are marshalled without hints if it is nil.
+	tipHeight func() int32
+
+	// witnessIDs identifies the unmarshalled transactions by their wtxid,
+	// whichever envelope they were gossiped in
+	witnessIDs bool
+}
 
 // MarshalGossip serializes a BTCGossip item to bytes
 func (m *BTCGossipMarshaller) MarshalGossip(item *BTCGossip) ([]byte, error) {
@@ -35,14 +146,18 @@ func (m *BTCGossipMarshaller) MarshalGossip(item *BTCGossip) ([]byte, error) {
 	}
 
 	var buf bytes.Buffer
-	// Write type discriminator
-	buf.WriteByte(byte(item.ItemType))
-
 	switch item.ItemType {
 	case GossipItemTypeTx:
 		if item.Tx == nil {
 			return nil, fmt.Errorf("nil transaction in gossip item")
 		}
+		// Transactions identified by their wtxid are gossiped in an envelope
+		// of their own
+		if item.WitnessID {
+			buf.WriteByte(byte(GossipItemTypeTxV1))
+		} else {
+			buf.WriteByte(byte(GossipItemTypeTx))
+		}
 		msgTx := item.Tx.MsgTx()
 		if err := msgTx.BtcEncode(&buf, 0, wire.WitnessEncoding); err != nil {
 			return nil, fmt.Errorf("failed to encode tx: %w", err)
@@ -52,11 +167,24 @@ func (m *BTCGossipMarshaller) MarshalGossip(item *BTCGossip) ([]byte, error) {
 		if item.Block == nil {
 			return nil, fmt.Errorf("nil block in gossip item")
 		}
-		msgBlock := item.Block.MsgBlock()
-		if err := msgBlock.BtcEncode(&buf, 0, wire.WitnessEncoding); err != nil {
+		// Blocks are gossiped with the bytes they were built or parsed
+		// from, which identify them
+		blockBytes, err := item.Block.Bytes()
+		if err != nil {
 			return nil, fmt.Errorf("failed to encode block: %w", err)
 		}
 
+		// Blocks are hinted with their height once it is known, which is the
+		// case of the blocks relayed after btcd connected them
+		if height := item.Block.Height(); m.tipHeight != nil && height != btcutil.BlockHeightUnknown {
+			hints := BlockHints{Height: height, TipHeight: m.tipHeight()}
+			buf.WriteByte(byte(GossipItemTypeBlockV1))
+			buf.Write(hints.marshal(nil))
+		} else {
+			buf.WriteByte(byte(GossipItemTypeBlock))
+		}
+		buf.Write(blockBytes)
+
 	default:
 		return nil, fmt.Errorf("unknown gossip item type: %d", item.ItemType)
 	}
@@ -69,29 +197,48 @@ func (m *BTCGossipMarshaller) UnmarshalGossip(data []byte) (*BTCGossip, error) {
 	if len(data) == 0 {
 		return nil, fmt.Errorf("empty gossip data")
 	}
+	if len(data) > maxGossipItemBytes {
+		return nil, fmt.Errorf("%w: %d bytes", errGossipItemOversized, len(data))
+	}
 
 	itemType := GossipItemType(data[0])
 	buf := bytes.NewReader(data[1:])
 
 	switch itemType {
-	case GossipItemTypeTx:
+	case GossipItemTypeTx, GossipItemTypeTxV1:
 		msgTx := wire.NewMsgTx(wire.TxVersion)
 		if err := msgTx.BtcDecode(buf, 0, wire.WitnessEncoding); err != nil {
 			return nil, fmt.Errorf("failed to decode tx: %w", err)
 		}
 		return &BTCGossip{
-			ItemType: itemType,
-			Tx:       btcutil.NewTx(msgTx),
+			ItemType:  GossipItemTypeTx,
+			Tx:        btcutil.NewTx(msgTx),
+			WitnessID: m.witnessIDs,
 		}, nil
 
 	case GossipItemTypeBlock:
-		msgBlock := &wire.MsgBlock{}
-		if err := msgBlock.BtcDecode(buf, 0, wire.WitnessEncoding); err != nil {
+		block, err := deserializeBlock(data[1:])
+		if err != nil {
 			return nil, fmt.Errorf("failed to decode block: %w", err)
 		}
 		return &BTCGossip{
 			ItemType: itemType,
-			Block:    btcutil.NewBlock(msgBlock),
+			Block:    block,
+		}, nil
+
+	case GossipItemTypeBlockV1:
+		hints, blockBytes, err := parseBlockHints(data[1:])
+		if err != nil {
+			return nil, err
+		}
+		block, err := deserializeBlock(blockBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode block: %w", err)
+		}
+		return &BTCGossip{
+			ItemType: GossipItemTypeBlock,
+			Block:    block,
+			Hints:    &hints,
 		}, nil
 
 	default:
@@ -104,119 +251,432 @@ func (m *BTCGossipMarshaller) UnmarshalGossip(data []byte) (*BTCGossip, error) {
 // Blocks are stored in btcd's database, not cached here
 type UnifiedBTCSet struct {
 	vm    *VM
-	bloom *gossip.BloomFilter
+	bloom *gossipBloomFilter
 	lock  sync.RWMutex
+
+	// rejected holds the IDs of items that recently failed validation so
+	// that peers replaying them do not cause repeated revalidation
+	rejected *rejectedCache
+
+	// hints skips the blocks hinted too far below the tip
+	hints *blockHintTracker
+
+	// blocks validates and stores the blocks of the set, which are only
+	// checked for what is cheap before they are queued for it
+	blocks *blockProcessor
+
+	// bloomSize is the target number of elements of bloom, bloomCount the
+	// number of additions to it since it was last reset, bloomResets the
+	// number of times it was reset and bloomRotations the number of those
+	// resets which were due to its salt getting old rather than to it
+	// filling up
+	bloomSize      int
+	bloomCount     int
+	bloomResets    uint64
+	bloomRotations uint64
 }
 
 // NewUnifiedBTCSet creates a new unified set for gossiped items
-func NewUnifiedBTCSet(vm *VM, bloom *gossip.BloomFilter) *UnifiedBTCSet {
+func NewUnifiedBTCSet(vm *VM, bloom *gossipBloomFilter, rejected *rejectedCache, hints *blockHintTracker) *UnifiedBTCSet {
 	return &UnifiedBTCSet{
-		vm:    vm,
-		bloom: bloom,
+		vm:        vm,
+		bloom:     bloom,
+		rejected:  rejected,
+		hints:     hints,
+		bloomSize: vm.gossipConfig.BloomFilterSize,
 	}
 }
 
-// Add adds a gossip item to the set and processes it
+// Add adds a gossip item to the set and processes it. Blocks are queued for
+// the block processor once they pass the cheap checks.
 func (s *UnifiedBTCSet) Add(item *BTCGossip) error {
-	s.lock.Lock()
-	defer s.lock.Unlock()
+	if item != nil && item.ItemType == GossipItemTypeBlock {
+		return s.queueBlock(item)
+	}
+
+	acceptedTxs, err := s.add(item)
+	if err != nil {
+		return err
+	}
+
+	// Re-gossip accepted transactions, which are filtered by the minimum
+	// relay fee rate. This happens without holding the set lock, as the push
+	// gossiper calls Has while holding its own lock.
+	if len(acceptedTxs) > 0 && s.vm.btcdAdapter.OnTxRelay != nil {
+		s.vm.btcdAdapter.OnTxRelay(acceptedTxs)
+	}
+	return nil
+}
 
+// add processes item and returns the transactions it added to the mempool.
+// The mempool synchronizes the validation of the transaction itself, so that
+// the set lock is only taken to update the bloom filter and gossip workers
+// validate transactions in parallel.
+func (s *UnifiedBTCSet) add(item *BTCGossip) ([]*mempool.TxDesc, error) {
 	if item == nil {
-		return fmt.Errorf("nil gossip item")
+		return nil, fmt.Errorf("nil gossip item")
+	}
+
+	// Drop known-bad items before doing any validation work. They are added
+	// back to the bloom filter, which may have been reset since they were
+	// rejected, so that peers are not asked for them again.
+	if id := item.GossipID(); id != ids.Empty {
+		if reason, ok := s.rejected.Get(id); ok {
+			s.vm.peerGossip.record(item.Sender, gossipOutcomeDuplicate)
+			s.lockedAddToBloom(item)
+			return nil, fmt.Errorf("%w (%s): %s", errRecentlyRejected, reason, id)
+		}
 	}
 
 	switch item.ItemType {
 	case GossipItemTypeTx:
 		if item.Tx == nil {
-			return fmt.Errorf("nil transaction in gossip item")
+			return nil, fmt.Errorf("nil transaction in gossip item")
 		}
 
 		txHash := item.Tx.Hash()
-		s.vm.ctx.Log.Debug("UnifiedBTCSet.Add: received transaction",
+		s.vm.gossipLog.Debug("UnifiedBTCSet.Add: received transaction",
 			zap.String("txID", txHash.String()))
 
+		// The same transaction may have been rejected under its wtxid
+		wtxID := hashToID(item.Tx.WitnessHash())
+		if reason, ok := s.rejected.Get(wtxID); ok {
+			s.vm.peerGossip.record(item.Sender, gossipOutcomeDuplicate)
+			s.lockedAddToBloom(item)
+			return nil, fmt.Errorf("%w (%s): %s", errRecentlyRejected, reason, wtxID)
+		}
+
 		// Check if already in mempool
 		if s.vm.btcdAdapter.TxMemPool().HaveTransaction(txHash) {
-			s.vm.ctx.Log.Debug("UnifiedBTCSet.Add: transaction already known",
+			s.vm.gossipLog.Debug("UnifiedBTCSet.Add: transaction already known",
 				zap.String("txID", txHash.String()))
-			s.bloom.Add(item)
-			return nil
+			s.vm.peerGossip.record(item.Sender, gossipOutcomeDuplicate)
+			s.lockedAddToBloom(item)
+			return nil, nil
+		}
+
+		// Drop transactions paying less than the minimum gossip fee rate
+		// before validating them. The fee of orphans is not known yet.
+		if minFeeRate := s.vm.nodeConfig.MinGossipFeeRate; minFeeRate > 0 {
+			fee, ok, err := s.vm.btcdAdapter.TxMemPool().FetchTxFee(item.Tx)
+			if err != nil {
+				return nil, err
+			}
+			if ok && belowFeeRate(item.Tx, fee, minFeeRate) {
+				s.vm.gossipLog.Debug("UnifiedBTCSet.Add: transaction below minimum gossip fee rate",
+					zap.String("txID", txHash.String()),
+					zap.Int64("fee", fee),
+				)
+				s.rejected.Put(wire.RejectInsufficientFee, hashToID(txHash), wtxID)
+				s.lockedAddToBloom(item)
+				return nil, fmt.Errorf("%w: %s", errBelowMinGossipFeeRate, txHash)
+			}
+		}
+
+		// Drop transactions outside of the data carrier policy of the
+		// network before processing them, which only checks orphans once
+		// their parents arrive
+		if err := s.vm.btcdAdapter.TxMemPool().CheckDataCarriers(item.Tx); err != nil {
+			s.vm.gossipLog.Debug("UnifiedBTCSet.Add: transaction outside of the data carrier policy",
+				zap.String("txID", txHash.String()),
+				zap.Error(err),
+			)
+			s.rejected.Put(wire.RejectNonstandard, hashToID(txHash), wtxID)
+			s.lockedAddToBloom(item)
+			return nil, err
 		}
 
-		// Process the transaction
-		acceptedTxs, err := s.vm.btcdAdapter.TxMemPool().ProcessTransaction(item.Tx, false, false, 0)
+		// Process the transaction. Transactions whose parents have not
+		// arrived yet wait for them in the orphan pool, and are relayed with
+		// the accepted transactions once they do.
+		acceptedTxs, err := s.vm.btcdAdapter.TxMemPool().ProcessTransaction(item.Tx, true, false, 0)
 		if err != nil {
-			s.vm.ctx.Log.Error("UnifiedBTCSet.Add: failed to process transaction",
+			s.vm.gossipLog.Error("UnifiedBTCSet.Add: failed to process transaction",
 				zap.String("txID", txHash.String()),
 				zap.Error(err),
 			)
-			return err
+			if reason, ok := txRejectReason(err); ok {
+				s.rejected.Put(reason, hashToID(txHash), wtxID)
+				// Keep peers from offering it again via pull gossip
+				s.lockedAddToBloom(item)
+				// Only consensus violations are held against the
+				// sender, as policy differs between versions
+				if reason == wire.RejectInvalid {
+					s.vm.peerGossip.record(item.Sender, gossipOutcomeInvalidTx)
+				}
+			}
+			return nil, err
 		}
 
-		s.vm.ctx.Log.Info("UnifiedBTCSet.Add: successfully processed transaction",
+		s.vm.gossipLog.Info("UnifiedBTCSet.Add: successfully processed transaction",
 			zap.String("txID", txHash.String()),
 			zap.Int("acceptedCount", len(acceptedTxs)),
 		)
+		s.vm.peerGossip.record(item.Sender, gossipOutcomeUseful)
 
 		// Add to bloom filter
-		s.bloom.Add(item)
+		s.lockedAddToBloom(item)
+		return acceptedTxs, nil
 
-		// Re-gossip accepted transactions
-		if len(acceptedTxs) > 0 && s.vm.btcdAdapter.OnTxRelay != nil {
-			s.vm.btcdAdapter.OnTxRelay(acceptedTxs)
-		}
+	default:
+		return nil, fmt.Errorf("unknown gossip item type: %d", item.ItemType)
+	}
+}
 
-	case GossipItemTypeBlock:
-		if item.Block == nil {
-			return fmt.Errorf("nil block in gossip item")
+// queueBlock queues the block of item for the block processor unless it is
+// stale, known or fails the header checks
+func (s *UnifiedBTCSet) queueBlock(item *BTCGossip) error {
+	if item.Block == nil {
+		return fmt.Errorf("nil block in gossip item")
+	}
+
+	// Drop known-bad blocks before doing any validation work
+	id := item.GossipID()
+	if reason, ok := s.rejected.Get(id); ok {
+		s.vm.peerGossip.record(item.Sender, gossipOutcomeDuplicate)
+		s.lockedAddToBloom(item)
+		return fmt.Errorf("%w (%s): %s", errRecentlyRejected, reason, id)
+	}
+
+	// Blocks hinted far below the tip are skipped before any lookup. The
+	// hints may be wrong, so the block is not marked as rejected.
+	if err := s.hints.check(item); err != nil {
+		s.vm.gossipLog.Debug("UnifiedBTCSet.Add: skipping stale block",
+			zap.Error(err))
+		return err
+	}
+
+	// Duplicate and rejected blocks are not an error, as when they are
+	// processed
+	if status, err := s.checkBlock(item); status != "" || err != nil {
+		return err
+	}
+	return s.blocks.queue(item, nil)
+}
+
+// SubmitBlock adds a block submitted by a client to the set, the same way as
+// a block received through gossip, and returns the status of the submission
+// once the block processor processed it
+func (s *UnifiedBTCSet) SubmitBlock(block *btcutil.Block) (string, error) {
+	if reason, ok := s.rejected.Get(hashToID(block.Hash())); ok {
+		return fmt.Sprintf("%s%v (%s)", blockStatusRejected, errRecentlyRejected, reason), nil
+	}
+
+	item := NewBlockGossip(block)
+	if status, err := s.checkBlock(item); status != "" || err != nil {
+		return status, err
+	}
+
+	// Wait for the block to be processed to return its status
+	result := make(chan blockResult, 1)
+	if err := s.blocks.queue(item, result); err != nil {
+		return "", err
+	}
+	r := <-result
+	return r.status, r.err
+}
+
+// checkBlock does the checks of the block of item cheap enough to be done
+// before it is queued for the block processor. It returns the status of the
+// block if it failed them, or an empty status if it should be processed.
+func (s *UnifiedBTCSet) checkBlock(item *BTCGossip) (string, error) {
+	blockHash := item.Block.Hash()
+	s.vm.gossipLog.Debug("UnifiedBTCSet.Add: received block",
+		zap.String("blockHash", blockHash.String()))
+	if status, err := s.knownBlock(item); status != "" || err != nil {
+		return status, err
+	}
+
+	if err := s.vm.chain.CheckHeaderSanity(&item.Block.MsgBlock().Header); err != nil {
+		s.vm.gossipLog.Debug("UnifiedBTCSet.Add: block header failed sanity checks",
+			zap.String("blockHash", blockHash.String()),
+			zap.Error(err),
+		)
+		if reason, ok := blockRejectReason(err); ok {
+			s.rejected.Put(reason, hashToID(blockHash))
+			s.vm.peerGossip.record(item.Sender, gossipOutcomeInvalidBlock)
 		}
+		s.lockedAddToBloom(item)
+		return blockErrStatus(err), nil
+	}
+	return "", nil
+}
 
-		blockHash := item.Block.Hash()
-		s.vm.ctx.Log.Debug("UnifiedBTCSet.Add: received block",
+// knownBlock returns blockStatusDuplicate if btcd has the block of item, or an
+// empty status otherwise
+func (s *UnifiedBTCSet) knownBlock(item *BTCGossip) (string, error) {
+	blockHash := item.Block.Hash()
+	if hasBlock, err := s.vm.chain.HaveBlock(blockHash); err != nil {
+		s.vm.gossipLog.Error("UnifiedBTCSet.Add: failed to check for existing block",
+			zap.String("blockHash", blockHash.String()),
+			zap.Error(err),
+		)
+		return "", err
+	} else if hasBlock {
+		s.vm.gossipLog.Debug("UnifiedBTCSet.Add: block already known",
 			zap.String("blockHash", blockHash.String()))
-		if hasBlock, err := s.vm.chain.HaveBlock(blockHash); err != nil {
-			s.vm.ctx.Log.Error("UnifiedBTCSet.Add: failed to check for existing block",
-				zap.String("blockHash", blockHash.String()),
-				zap.Error(err),
-			)
-			return err
-		} else if hasBlock {
-			s.vm.ctx.Log.Debug("UnifiedBTCSet.Add: block already known",
-				zap.String("blockHash", blockHash.String()))
-			s.bloom.Add(item)
-			return nil
-		}
+		s.vm.peerGossip.record(item.Sender, gossipOutcomeDuplicate)
+		s.lockedAddToBloom(item)
+		return blockStatusDuplicate, nil
+	}
+	return "", nil
+}
 
-		// Route through btcd's ProcessBlock for validation and storage
-		// This ensures blocks are properly validated, stored in the database,
-		// and added to the block index before being used by Snowman
-		isMainChain, isOrphan, err := s.vm.chain.ProcessBlock(item.Block, blockchain.BFNone)
-		if err != nil {
-			s.vm.ctx.Log.Debug("UnifiedBTCSet.Add: failed to process block",
-				zap.String("blockHash", blockHash.String()),
-				zap.Error(err),
-			)
-			// Don't return error - block may be orphan or duplicate
-			// Just log and continue
-		} else {
-			s.vm.ctx.Log.Info("UnifiedBTCSet.Add: processed block",
-				zap.String("blockHash", blockHash.String()),
-				zap.Bool("isMainChain", isMainChain),
-				zap.Bool("isOrphan", isOrphan),
-			)
+// processBlock validates and stores the block of item and returns its status.
+// Blocks failing validation are not an error, as they may be orphans or
+// duplicates: their status is returned instead.
+//
+// This function is only called by the block processor, which serializes the
+// blocks given to btcd.
+func (s *UnifiedBTCSet) processBlock(item *BTCGossip) (string, error) {
+	// The block may have been processed since it was queued, such as by
+	// consensus parsing it
+	blockHash := item.Block.Hash()
+	if status, err := s.knownBlock(item); status != "" || err != nil {
+		return status, err
+	}
+
+	// Alternate histories of the accepted chain are rejected before btcd
+	// stores them
+	if err := s.vm.checkFinality(item.Block); errors.Is(err, ErrForkBelowFinality) {
+		s.vm.gossipLog.Debug("UnifiedBTCSet.Add: block forks below the finality allowance",
+			zap.String("blockHash", blockHash.String()),
+			zap.Error(err),
+		)
+		s.rejected.Put(wire.RejectInvalid, hashToID(blockHash))
+		s.vm.peerGossip.record(item.Sender, gossipOutcomeInvalidBlock)
+		s.lockedAddToBloom(item)
+		return blockStatusRejected + err.Error(), nil
+	} else if err != nil {
+		return "", err
+	}
+
+	// Route through btcd's ProcessBlock for validation and storage
+	// This ensures blocks are properly validated, stored in the database,
+	// and added to the block index before being used by Snowman
+	status := blockStatusPending
+	isMainChain, isOrphan, err := s.vm.processBlock(item.Block, blockchain.BFNone)
+	if err != nil {
+		s.vm.gossipLog.Debug("UnifiedBTCSet.Add: failed to process block",
+			zap.String("blockHash", blockHash.String()),
+			zap.Error(err),
+		)
+		if reason, ok := blockRejectReason(err); ok {
+			s.rejected.Put(reason, hashToID(blockHash))
+			s.vm.peerGossip.record(item.Sender, gossipOutcomeInvalidBlock)
 		}
+		status = blockErrStatus(err)
+	} else {
+		s.vm.peerGossip.record(item.Sender, gossipOutcomeUseful)
+		s.vm.gossipLog.Info("UnifiedBTCSet.Add: processed block",
+			zap.String("blockHash", blockHash.String()),
+			zap.Bool("isMainChain", isMainChain),
+			zap.Bool("isOrphan", isOrphan),
+		)
+		if isOrphan {
+			status = blockStatusOrphan
+		}
+	}
 
-		// Add to bloom filter to track that we've seen this block
-		s.bloom.Add(item)
+	// Add to bloom filter to track that we've seen this block
+	s.lockedAddToBloom(item)
 
-		// Note: OnBlockRelay will be triggered automatically via blockchain
-		// notifications when the block is connected to the chain
+	// Note: OnBlockRelay will be triggered automatically via blockchain
+	// notifications when the block is connected to the chain
+	return status, nil
+}
 
-	default:
-		return fmt.Errorf("unknown gossip item type: %d", item.ItemType)
+// addToBloom adds item to the bloom filter, and resets the filter once it holds
+// too many elements for its false positive rate. The mempool transactions are
+// added back to a reset filter, so that peers are not asked for them again.
+//
+// This function MUST be called with the set lock held.
+func (s *UnifiedBTCSet) addToBloom(item *BTCGossip) {
+	s.bloom.Add(item)
+	s.bloomCount++
+	if s.bloom.full() {
+		s.resetBloom(false)
 	}
+}
 
-	return nil
+// rotateBloom resets the bloom filter with a new salt however full it is, so
+// that peers observing our pull requests for long can't keep suppressing them
+// with items colliding with the known ones. The items dropped from the filter
+// may be pulled again, and are then found known and added back to it.
+func (s *UnifiedBTCSet) rotateBloom() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.resetBloom(true)
+}
+
+// resetBloom resets the bloom filter with a new salt and a size growing with
+// the mempool, and adds the mempool transactions back to it. rotation tells
+// whether the filter is reset because its salt got old rather than because
+// it filled up.
+//
+// This function MUST be called with the set lock held.
+func (s *UnifiedBTCSet) resetBloom(rotation bool) {
+	txPool := s.vm.btcdAdapter.TxMemPool()
+	targetElements := max(s.vm.gossipConfig.BloomFilterSize, txPool.Count()*bloomChurnMultiplier)
+	if err := s.bloom.reset(targetElements); err != nil {
+		s.vm.gossipLog.Warn("failed to reset bloom filter", zap.Error(err))
+		return
+	}
+
+	s.bloomSize = targetElements
+	s.bloomCount = 0
+	s.bloomResets++
+	if rotation {
+		s.bloomRotations++
+	}
+	txDescs := txPool.TxDescs()
+	for _, desc := range txDescs {
+		s.bloom.Add(s.vm.newTxGossip(desc.Tx))
+		s.bloomCount++
+	}
+	s.vm.gossipLog.Debug("Reset bloom filter",
+		zap.Int("size", s.bloomSize),
+		zap.Int("mempoolTxs", len(txDescs)),
+		zap.Uint64("resets", s.bloomResets),
+		zap.Bool("rotation", rotation),
+	)
+}
+
+// lockedAddToBloom adds item to the bloom filter like addToBloom, taking the
+// set lock
+func (s *UnifiedBTCSet) lockedAddToBloom(item *BTCGossip) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.addToBloom(item)
+}
+
+// inBloom returns whether item was added to the bloom filter since it was last
+// reset, or is a false positive
+func (s *UnifiedBTCSet) inBloom(item *BTCGossip) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.bloom.Has(item)
+}
+
+// bloomInfo returns the state of the bloom filter for the getgossipinfo RPC
+func (s *UnifiedBTCSet) bloomInfo() btcjson.GossipBloomInfo {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	config := s.vm.gossipConfig
+	numHashes, numEntries := bloom.OptimalParameters(s.bloomSize, config.BloomFalsePositiveRate)
+	return btcjson.GossipBloomInfo{
+		Elements:               int64(s.bloomCount),
+		MaxElements:            int64(bloom.EstimateCount(numHashes, numEntries, config.BloomResetThreshold)),
+		Size:                   int64(s.bloomSize),
+		FalsePositiveRate:      config.BloomFalsePositiveRate,
+		ResetFalsePositiveRate: config.BloomResetThreshold,
+		Resets:                 s.bloomResets,
+		Rotations:              s.bloomRotations,
+	}
 }
 
 // Has checks if the set contains an item with the given ID
@@ -224,10 +684,22 @@ func (s *UnifiedBTCSet) Has(id ids.ID) bool {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 
+	// Recently rejected items are treated as known so they are not requested again
+	if s.rejected.Contains(id) {
+		return true
+	}
+
 	hash := idToHash(id)
 
-	// Check mempool for transactions
-	if s.vm.btcdAdapter.TxMemPool().HaveTransaction(hash) {
+	// Check mempool for transactions, which are gossiped under their wtxid
+	// if the node gossips transactions by wtxid
+	txPool := s.vm.btcdAdapter.TxMemPool()
+	if txPool.HaveTransaction(hash) || (s.vm.nodeConfig.WtxidGossip && txPool.IsWitnessHashInPool(hash)) {
+		return true
+	}
+
+	// Blocks waiting for the block processor are known as well
+	if s.blocks != nil && s.blocks.isPending(hash) {
 		return true
 	}
 
@@ -244,20 +716,16 @@ func (s *UnifiedBTCSet) Iterate(f func(*BTCGossip) bool) {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 
-	s.vm.ctx.Log.Debug("UnifiedBTCSet.Iterate: iterating over gossiped items")
+	s.vm.gossipLog.Debug("UnifiedBTCSet.Iterate: iterating over gossiped items")
 
 	// Iterate transactions from mempool
 	txDescs := s.vm.btcdAdapter.TxMemPool().TxDescs()
-	s.vm.ctx.Log.Debug("UnifiedBTCSet.Iterate: found transactions in mempool",
+	s.vm.gossipLog.Debug("UnifiedBTCSet.Iterate: found transactions in mempool",
 		zap.Int("count", len(txDescs)))
 
 	for _, desc := range txDescs {
-		item := &BTCGossip{
-			ItemType: GossipItemTypeTx,
-			Tx:       desc.Tx,
-		}
-		if !f(item) {
-			s.vm.ctx.Log.Debug("UnifiedBTCSet.Iterate: iteration stopped early during tx iteration")
+		if !f(s.vm.newTxGossip(desc.Tx)) {
+			s.vm.gossipLog.Debug("UnifiedBTCSet.Iterate: iteration stopped early during tx iteration")
 			return
 		}
 	}
@@ -268,16 +736,14 @@ func (s *UnifiedBTCSet) Iterate(f func(*BTCGossip) bool) {
 	// Including blocks here caused continuous re-gossip as Iterate() creates
 	// new BTCGossip objects that bypass the PushGossiper's tracking system.
 
-	s.vm.ctx.Log.Debug("UnifiedBTCSet.Iterate: finished iterating")
+	s.vm.gossipLog.Debug("UnifiedBTCSet.Iterate: finished iterating")
 }
 
-// GetFilter returns the bloom filter and salt for this set
+// GetFilter returns a copy of the bloom filter and salt for this set. The set
+// lock is not taken, as the filter stays consistent while it is reset, so pull
+// requests don't wait for the items being added.
 func (s *UnifiedBTCSet) GetFilter() ([]byte, []byte) {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
-
-	bloom, salt := s.bloom.Marshal()
-	return bloom, salt
+	return s.bloom.Marshal()
 }
 
 // idToHash converts an Avalanche ids.ID to a Bitcoin chainhash.Hash
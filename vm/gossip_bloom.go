@@ -0,0 +1,119 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"crypto/rand"
+	"sync/atomic"
+
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/network/p2p/gossip"
+	"github.com/MetalBlockchain/metalgo/utils/bloom"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultGossipBloomRotationMinutes is how often the salt of the bloom filter
+// is rotated by default
+const defaultGossipBloomRotationMinutes = 10
+
+// bloomGeneration is a filter and the salt of its hashes, replaced as a whole
+// when the filter is reset
+type bloomGeneration struct {
+	filter *bloom.Filter
+	salt   ids.ID
+
+	// maxCount is the number of elements after which the filter exceeds its
+	// reset false positive rate
+	maxCount int
+}
+
+// gossipBloomFilter is the bloom filter of the gossiped items, which is sent
+// to peers in pull requests. Unlike gossip.BloomFilter, it can be reset at any
+// time with a new salt, so that peers observing it can't keep crafting items
+// colliding with the known ones, and it is safe to use concurrently with a
+// reset.
+type gossipBloomFilter struct {
+	minTargetElements      int
+	falsePositiveRate      float64
+	resetFalsePositiveRate float64
+
+	metrics *bloom.Metrics
+
+	current atomic.Pointer[bloomGeneration]
+}
+
+// newGossipBloomFilter returns a filter of at least minTargetElements elements
+// with a false positive rate of falsePositiveRate, which is due for a reset
+// once it exceeds resetFalsePositiveRate
+func newGossipBloomFilter(
+	registerer prometheus.Registerer,
+	namespace string,
+	minTargetElements int,
+	falsePositiveRate float64,
+	resetFalsePositiveRate float64,
+) (*gossipBloomFilter, error) {
+	metrics, err := bloom.NewMetrics(namespace, registerer)
+	if err != nil {
+		return nil, err
+	}
+	b := &gossipBloomFilter{
+		minTargetElements:      minTargetElements,
+		falsePositiveRate:      falsePositiveRate,
+		resetFalsePositiveRate: resetFalsePositiveRate,
+		metrics:                metrics,
+	}
+	return b, b.reset(minTargetElements)
+}
+
+// Add adds gossipable to the filter
+func (b *gossipBloomFilter) Add(gossipable gossip.Gossipable) {
+	generation := b.current.Load()
+	id := gossipable.GossipID()
+	bloom.Add(generation.filter, id[:], generation.salt[:])
+	b.metrics.Count.Inc()
+}
+
+// Has returns whether gossipable was added to the filter since it was last
+// reset, or is a false positive
+func (b *gossipBloomFilter) Has(gossipable gossip.Gossipable) bool {
+	generation := b.current.Load()
+	id := gossipable.GossipID()
+	return bloom.Contains(generation.filter, id[:], generation.salt[:])
+}
+
+// Marshal returns a copy of the filter and its salt, which a concurrent reset
+// leaves unchanged
+func (b *gossipBloomFilter) Marshal() ([]byte, []byte) {
+	generation := b.current.Load()
+	salt := generation.salt
+	return generation.filter.Marshal(), salt[:]
+}
+
+// full returns whether the filter exceeds its reset false positive rate
+func (b *gossipBloomFilter) full() bool {
+	generation := b.current.Load()
+	return generation.filter.Count() > generation.maxCount
+}
+
+// reset replaces the filter with an empty one of at least targetElements
+// elements and a new salt
+func (b *gossipBloomFilter) reset(targetElements int) error {
+	targetElements = max(b.minTargetElements, targetElements)
+	numHashes, numEntries := bloom.OptimalParameters(targetElements, b.falsePositiveRate)
+	filter, err := bloom.New(numHashes, numEntries)
+	if err != nil {
+		return err
+	}
+	generation := &bloomGeneration{
+		filter:   filter,
+		maxCount: bloom.EstimateCount(numHashes, numEntries, b.resetFalsePositiveRate),
+	}
+	if _, err := rand.Read(generation.salt[:]); err != nil {
+		return err
+	}
+
+	b.current.Store(generation)
+	b.metrics.Reset(filter, generation.maxCount)
+	return nil
+}
@@ -6,8 +6,16 @@ package vm
 import (
 	"fmt"
 	"time"
+
+	"github.com/MetalBlockchain/metalgo/network/p2p/gossip"
+
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
 )
 
+// maxGossipItemBytes is the size of the largest gossiped item, a block of the
+// max serialized size after its item type and height hints
+const maxGossipItemBytes = 1 + blockHintsSize + blockchain.MaxBlockWeight
+
 // GossipConfig contains all configuration parameters for the gossip system
 type GossipConfig struct {
 	// Push Gossip Parameters
@@ -16,38 +24,107 @@ type GossipConfig struct {
 	// Default: 0.9 (90% of validator stake)
 	PushGossipPercentStake float64
 
-	// PushGossipNumValidators is the maximum number of validators to push gossip to
+	// TxPushGossipNumValidators is the maximum number of validators to push transactions to
+	// Default: 100
+	TxPushGossipNumValidators int
+
+	// TxPushGossipNumPeers is the maximum number of non-validator peers to push transactions
+	// to, unless TxGossipValidatorsOnly is set
+	// Default: 10
+	TxPushGossipNumPeers int
+
+	// TxGossipValidatorsOnly pushes transactions to validators only, leaving non-validator
+	// peers such as RPC nodes to pull them
+	// Default: true
+	TxGossipValidatorsOnly bool
+
+	// BlockPushGossipNumValidators is the maximum number of validators to push blocks to
 	// Default: 100
-	PushGossipNumValidators int
+	BlockPushGossipNumValidators int
 
-	// PushGossipNumPeers is the maximum number of non-validator peers to push gossip to
+	// BlockPushGossipNumPeers is the maximum number of non-validator peers to push blocks to
 	// Default: 0
-	PushGossipNumPeers int
+	BlockPushGossipNumPeers int
+
+	// PushGossipFallbackNumPeers is the maximum number of non-validator peers to push
+	// gossip to when no validator peer is connected, such as on a single validator subnet
+	// Default: 3
+	PushGossipFallbackNumPeers int
 
 	// PushGossipFrequency is how often to push gossip
 	// Default: 100ms
 	PushGossipFrequency time.Duration
 
+	// PushGossipTargetBytes is the number of bytes of new items pushed per push cycle.
+	// Items are pushed whole, so an item larger than the target is still pushed alone.
+	// Default: 64 KiB
+	PushGossipTargetBytes int
+
+	// PushGossipDiscardedSize is the number of items remembered after leaving the set
+	// before they were pushed, so that they are not pushed again if they come back
+	// Default: 16384
+	PushGossipDiscardedSize int
+
 	// Pull Gossip Parameters
 	//
 	// PullGossipFrequency is how often to pull gossip from peers
 	// Default: 1s
 	PullGossipFrequency time.Duration
 
+	// PullGossipPollSize is the number of peers pulled from per pull cycle. The size of
+	// their responses is bounded by the gossip handler rather than by the pull gossiper.
+	// Default: 10
+	PullGossipPollSize int
+
+	// PullGossipTargetResponseBytes is the number of bytes of items the gossip handler fills
+	// a pull response up to. It must hold a block of the max size so that responses are
+	// never truncated below one.
+	// Default: 4 MiB
+	PullGossipTargetResponseBytes int
+
 	// Regossip Parameters
 	//
-	// PushRegossipNumValidators is the number of validators to regossip to
+	// TxPushRegossipNumValidators is the number of validators to regossip transactions to
+	// Default: 10
+	TxPushRegossipNumValidators int
+
+	// TxPushRegossipNumPeers is the number of non-validator peers to regossip transactions
+	// to, unless TxGossipValidatorsOnly is set
+	// Default: 3
+	TxPushRegossipNumPeers int
+
+	// BlockPushRegossipNumValidators is the number of validators to regossip blocks to
 	// Default: 10
-	PushRegossipNumValidators int
+	BlockPushRegossipNumValidators int
 
-	// PushRegossipNumPeers is the number of non-validator peers to regossip to
+	// BlockPushRegossipNumPeers is the number of non-validator peers to regossip blocks to
 	// Default: 0
-	PushRegossipNumPeers int
+	BlockPushRegossipNumPeers int
 
 	// RegossipFrequency is how often to regossip known items
 	// Default: 30s
 	RegossipFrequency time.Duration
 
+	// BlockRegossipMaxAge is how long after it was first pushed a block is still regossiped
+	// Default: 2m
+	BlockRegossipMaxAge time.Duration
+
+	// BlockRegossipMaxDepth is how far below the accepted tip a block is still regossiped
+	// Default: 30
+	BlockRegossipMaxDepth int
+
+	// Block Height Hints
+	//
+	// BlockHintStaleDepth is how far below the tip a gossiped block may be hinted before it is
+	// skipped without being processed
+	// Default: 30
+	BlockHintStaleDepth int
+
+	// BlockHintBehindDepth is how far above the tip peers may hint their tip before the node
+	// is flagged as behind
+	// Default: 10
+	BlockHintBehindDepth int
+
 	// Bloom Filter Parameters
 	//
 	// BloomFilterSize is the target number of elements in the bloom filter
@@ -61,29 +138,129 @@ type GossipConfig struct {
 	// BloomResetThreshold is the false positive rate that triggers a bloom filter reset
 	// Default: 0.05 (5%)
 	BloomResetThreshold float64
+
+	// BloomRotationInterval is how often the bloom filter is reset with a new salt even if
+	// it is not full, so that peers can't keep crafting items colliding with known ones.
+	// Zero disables the timed rotation.
+	// Default: 10m
+	BloomRotationInterval time.Duration
+
+	// Inbound Gossip Limits
+	//
+	// InboundGossipItemsPerSecond is the sustained number of gossip items accepted per peer per second
+	// Default: 100
+	InboundGossipItemsPerSecond float64
+
+	// InboundGossipItemBurst is the maximum number of gossip items a peer may send in a burst
+	// Default: 500
+	InboundGossipItemBurst int
+
+	// InboundGossipBytesPerSecond is the sustained number of gossip bytes accepted per peer per second
+	// Default: 2 MiB
+	InboundGossipBytesPerSecond float64
+
+	// InboundGossipByteBurst is the maximum number of gossip bytes a peer may send in a burst.
+	// Must be large enough to hold a single full block.
+	// Default: 8 MiB
+	InboundGossipByteBurst int
+
+	// InboundPullRequestsPerSecond is the sustained number of pull requests served per peer
+	// per second. Peers pull from a few peers per pull cycle, so an honest peer stays well
+	// below it.
+	// Default: 2
+	InboundPullRequestsPerSecond float64
+
+	// InboundPullRequestBurst is the maximum number of pull requests a peer may send in a burst
+	// Default: 10
+	InboundPullRequestBurst int
+
+	// RejectedCacheSize is the number of recently rejected item IDs remembered so that
+	// replayed invalid items are dropped without revalidation
+	// Default: 4096
+	RejectedCacheSize int
+
+	// RejectedCacheTTL is how long a rejection is remembered before the item may be revalidated
+	// Default: 10m
+	RejectedCacheTTL time.Duration
+
+	// Mempool Sync Parameters
+	//
+	// MempoolSyncEnabled requests the mempool contents of validators when entering normal operation
+	// Default: true
+	MempoolSyncEnabled bool
+
+	// MempoolSyncNumPeers is the number of validators to request mempool contents from
+	// Default: 3
+	MempoolSyncNumPeers int
+
+	// MempoolSyncBatchSize is the number of transactions requested from a peer at once
+	// Default: 100
+	MempoolSyncBatchSize int
+
+	// MempoolSyncMaxBytes is the maximum number of bytes received during a mempool sync
+	// Default: 32 MiB
+	MempoolSyncMaxBytes int
+
+	// MempoolSyncTimeout is the maximum duration of a mempool sync
+	// Default: 1m
+	MempoolSyncTimeout time.Duration
 }
 
 // DefaultGossipConfig returns production-ready defaults matching subnet-evm/coreth
 func DefaultGossipConfig() GossipConfig {
 	return GossipConfig{
 		// Push Gossip - Fast propagation
-		PushGossipPercentStake:  0.9,  // 90% of validator stake
-		PushGossipNumValidators: 100,  // Up to 100 validators
-		PushGossipNumPeers:      0,    // No non-validator peers by default
-		PushGossipFrequency:     100 * time.Millisecond,
+		PushGossipPercentStake:       0.9,  // 90% of validator stake
+		TxPushGossipNumValidators:    100,  // Up to 100 validators
+		TxPushGossipNumPeers:         10,   // Once enabled for non-validator peers
+		TxGossipValidatorsOnly:       true, // No non-validator peers by default
+		BlockPushGossipNumValidators: 100,
+		BlockPushGossipNumPeers:      0,
+		PushGossipFallbackNumPeers:   3, // Unless no validator is connected
+		PushGossipFrequency:          100 * time.Millisecond,
+		PushGossipTargetBytes:        64 * 1024, // 64 KiB
+		PushGossipDiscardedSize:      16384,
 
 		// Pull Gossip - Reliability and gap-filling
-		PullGossipFrequency: 1 * time.Second,
+		PullGossipFrequency:           1 * time.Second,
+		PullGossipPollSize:            10,
+		PullGossipTargetResponseBytes: 4 * 1024 * 1024, // 4 MiB, a full block and then some
 
 		// Regossip - Ensure network-wide propagation
-		PushRegossipNumValidators: 10,
-		PushRegossipNumPeers:      0,
-		RegossipFrequency:         30 * time.Second,
+		TxPushRegossipNumValidators:    10,
+		TxPushRegossipNumPeers:         3,
+		BlockPushRegossipNumValidators: 10,
+		BlockPushRegossipNumPeers:      0,
+		RegossipFrequency:              30 * time.Second,
+		BlockRegossipMaxAge:            2 * time.Minute,
+		BlockRegossipMaxDepth:          30,
+
+		// Block Height Hints - Skip stale blocks and detect falling behind
+		BlockHintStaleDepth:  30,
+		BlockHintBehindDepth: 10,
 
 		// Bloom Filter - Efficient duplicate detection
 		BloomFilterSize:        8192, // 8K elements
 		BloomFalsePositiveRate: 0.01, // 1% FP rate
 		BloomResetThreshold:    0.05, // Reset at 5% FP
+		BloomRotationInterval:  10 * time.Minute,
+
+		// Inbound Limits - Protect against peers replaying items
+		InboundGossipItemsPerSecond:  100,
+		InboundGossipItemBurst:       500,
+		InboundGossipBytesPerSecond:  2 * 1024 * 1024, // 2 MiB/s
+		InboundGossipByteBurst:       8 * 1024 * 1024, // 8 MiB
+		InboundPullRequestsPerSecond: 2,
+		InboundPullRequestBurst:      10,
+		RejectedCacheSize:            4096,
+		RejectedCacheTTL:             10 * time.Minute,
+
+		// Mempool Sync - Recover pending transactions after a restart
+		MempoolSyncEnabled:   true,
+		MempoolSyncNumPeers:  3,
+		MempoolSyncBatchSize: 100,
+		MempoolSyncMaxBytes:  32 * 1024 * 1024, // 32 MiB
+		MempoolSyncTimeout:   time.Minute,
 	}
 }
 
@@ -93,34 +270,75 @@ func (c *GossipConfig) Validate() error {
 		return fmt.Errorf("push gossip percent stake must be between 0 and 1, got %f", c.PushGossipPercentStake)
 	}
 
-	if c.PushGossipNumValidators < 0 {
-		return fmt.Errorf("push gossip num validators must be non-negative, got %d", c.PushGossipNumValidators)
+	for _, itemType := range []GossipItemType{GossipItemTypeTx, GossipItemTypeBlock} {
+		gossipParams, regossipParams := c.pushParams(itemType)
+		if err := gossipParams.Verify(); err != nil {
+			return fmt.Errorf("invalid push gossip targets of item type %d: %w", itemType, err)
+		}
+		if err := regossipParams.Verify(); err != nil {
+			return fmt.Errorf("invalid push regossip targets of item type %d: %w", itemType, err)
+		}
 	}
 
-	if c.PushGossipNumPeers < 0 {
-		return fmt.Errorf("push gossip num peers must be non-negative, got %d", c.PushGossipNumPeers)
+	// The non-validator peers of transactions are only checked above when
+	// transactions are gossiped to them, which must then reach some
+	if c.TxPushGossipNumPeers < 0 || c.TxPushRegossipNumPeers < 0 {
+		return fmt.Errorf("tx push gossip and regossip num peers must be non-negative, got %d and %d",
+			c.TxPushGossipNumPeers, c.TxPushRegossipNumPeers)
+	}
+	if !c.TxGossipValidatorsOnly && (c.TxPushGossipNumPeers == 0 || c.TxPushRegossipNumPeers == 0) {
+		return fmt.Errorf("tx push gossip and regossip num peers must be positive when transactions are not gossiped to validators only, got %d and %d",
+			c.TxPushGossipNumPeers, c.TxPushRegossipNumPeers)
+	}
+
+	if c.PushGossipFallbackNumPeers < 0 {
+		return fmt.Errorf("push gossip fallback num peers must be non-negative, got %d", c.PushGossipFallbackNumPeers)
 	}
 
 	if c.PushGossipFrequency <= 0 {
 		return fmt.Errorf("push gossip frequency must be positive, got %s", c.PushGossipFrequency)
 	}
 
+	if c.PushGossipTargetBytes <= 0 {
+		return fmt.Errorf("push gossip target bytes must be positive, got %d", c.PushGossipTargetBytes)
+	}
+
+	if c.PushGossipDiscardedSize < 0 {
+		return fmt.Errorf("push gossip discarded size must be non-negative, got %d", c.PushGossipDiscardedSize)
+	}
+
 	if c.PullGossipFrequency <= 0 {
 		return fmt.Errorf("pull gossip frequency must be positive, got %s", c.PullGossipFrequency)
 	}
 
-	if c.PushRegossipNumValidators < 0 {
-		return fmt.Errorf("push regossip num validators must be non-negative, got %d", c.PushRegossipNumValidators)
+	if c.PullGossipPollSize <= 0 {
+		return fmt.Errorf("pull gossip poll size must be positive, got %d", c.PullGossipPollSize)
 	}
 
-	if c.PushRegossipNumPeers < 0 {
-		return fmt.Errorf("push regossip num peers must be non-negative, got %d", c.PushRegossipNumPeers)
+	if c.PullGossipTargetResponseBytes < maxGossipItemBytes {
+		return fmt.Errorf("pull gossip target response bytes must be at least the max gossip item size %d, got %d", maxGossipItemBytes, c.PullGossipTargetResponseBytes)
 	}
 
 	if c.RegossipFrequency <= 0 {
 		return fmt.Errorf("regossip frequency must be positive, got %s", c.RegossipFrequency)
 	}
 
+	if c.BlockRegossipMaxAge <= 0 {
+		return fmt.Errorf("block regossip max age must be positive, got %s", c.BlockRegossipMaxAge)
+	}
+
+	if c.BlockRegossipMaxDepth <= 0 {
+		return fmt.Errorf("block regossip max depth must be positive, got %d", c.BlockRegossipMaxDepth)
+	}
+
+	if c.BlockHintStaleDepth <= 0 {
+		return fmt.Errorf("block hint stale depth must be positive, got %d", c.BlockHintStaleDepth)
+	}
+
+	if c.BlockHintBehindDepth <= 0 {
+		return fmt.Errorf("block hint behind depth must be positive, got %d", c.BlockHintBehindDepth)
+	}
+
 	if c.BloomFilterSize <= 0 {
 		return fmt.Errorf("bloom filter size must be positive, got %d", c.BloomFilterSize)
 	}
@@ -133,5 +351,90 @@ func (c *GossipConfig) Validate() error {
 		return fmt.Errorf("bloom reset threshold must be between 0 and 1, got %f", c.BloomResetThreshold)
 	}
 
+	if c.BloomRotationInterval < 0 {
+		return fmt.Errorf("bloom rotation interval must be non-negative, got %s", c.BloomRotationInterval)
+	}
+
+	if c.InboundGossipItemsPerSecond <= 0 {
+		return fmt.Errorf("inbound gossip items per second must be positive, got %f", c.InboundGossipItemsPerSecond)
+	}
+
+	if c.InboundGossipItemBurst <= 0 {
+		return fmt.Errorf("inbound gossip item burst must be positive, got %d", c.InboundGossipItemBurst)
+	}
+
+	if c.InboundGossipBytesPerSecond <= 0 {
+		return fmt.Errorf("inbound gossip bytes per second must be positive, got %f", c.InboundGossipBytesPerSecond)
+	}
+
+	if c.InboundGossipByteBurst <= 0 {
+		return fmt.Errorf("inbound gossip byte burst must be positive, got %d", c.InboundGossipByteBurst)
+	}
+
+	if c.InboundPullRequestsPerSecond <= 0 {
+		return fmt.Errorf("inbound pull requests per second must be positive, got %f", c.InboundPullRequestsPerSecond)
+	}
+
+	if c.InboundPullRequestBurst <= 0 {
+		return fmt.Errorf("inbound pull request burst must be positive, got %d", c.InboundPullRequestBurst)
+	}
+
+	if c.RejectedCacheSize <= 0 {
+		return fmt.Errorf("rejected cache size must be positive, got %d", c.RejectedCacheSize)
+	}
+
+	if c.RejectedCacheTTL <= 0 {
+		return fmt.Errorf("rejected cache ttl must be positive, got %s", c.RejectedCacheTTL)
+	}
+
+	if c.MempoolSyncEnabled {
+		if c.MempoolSyncNumPeers <= 0 {
+			return fmt.Errorf("mempool sync num peers must be positive, got %d", c.MempoolSyncNumPeers)
+		}
+
+		if c.MempoolSyncBatchSize <= 0 || c.MempoolSyncBatchSize > maxMempoolSyncBatchSize {
+			return fmt.Errorf("mempool sync batch size must be between 1 and %d, got %d", maxMempoolSyncBatchSize, c.MempoolSyncBatchSize)
+		}
+
+		if c.MempoolSyncMaxBytes <= 0 {
+			return fmt.Errorf("mempool sync max bytes must be positive, got %d", c.MempoolSyncMaxBytes)
+		}
+
+		if c.MempoolSyncTimeout <= 0 {
+			return fmt.Errorf("mempool sync timeout must be positive, got %s", c.MempoolSyncTimeout)
+		}
+	}
+
 	return nil
 }
+
+// pushParams returns the branching factors of the push gossip and of the
+// regossip of the items of itemType. The non-validator peers of transactions
+// are left out if they are gossiped to validators only.
+func (c *GossipConfig) pushParams(itemType GossipItemType) (gossip.BranchingFactor, gossip.BranchingFactor) {
+	if itemType == GossipItemTypeBlock {
+		gossipParams := gossip.BranchingFactor{
+			StakePercentage: c.PushGossipPercentStake,
+			Validators:      c.BlockPushGossipNumValidators,
+			NonValidators:   c.BlockPushGossipNumPeers,
+		}
+		regossipParams := gossip.BranchingFactor{
+			Validators:    c.BlockPushRegossipNumValidators,
+			NonValidators: c.BlockPushRegossipNumPeers,
+		}
+		return gossipParams, regossipParams
+	}
+
+	gossipParams := gossip.BranchingFactor{
+		StakePercentage: c.PushGossipPercentStake,
+		Validators:      c.TxPushGossipNumValidators,
+	}
+	regossipParams := gossip.BranchingFactor{
+		Validators: c.TxPushRegossipNumValidators,
+	}
+	if !c.TxGossipValidatorsOnly {
+		gossipParams.NonValidators = c.TxPushGossipNumPeers
+		regossipParams.NonValidators = c.TxPushRegossipNumPeers
+	}
+	return gossipParams, regossipParams
+}
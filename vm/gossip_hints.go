@@ -0,0 +1,168 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// blockHintsSize is the size of the height hints ahead of the block of a
+// GossipItemTypeBlockV1 item
+const blockHintsSize = 8
+
+var (
+	errShortBlockHints = errors.New("block gossip item is too short for its height hints")
+	errInvalidHints    = errors.New("invalid block height hints")
+	errStaleBlockHint  = errors.New("block is hinted too far below the tip")
+)
+
+// BlockHints are the heights a peer gossips along with a block: the height it
+// claims for the block, and the height of its own tip. They are advisory. They
+// order the processing of gossiped blocks and skip the stale ones, but are
+// never trusted to validate a block.
+type BlockHints struct {
+	Height    int32
+	TipHeight int32
+}
+
+// marshal appends the hints to buf
+func (h BlockHints) marshal(buf []byte) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(h.Height))
+	return binary.LittleEndian.AppendUint32(buf, uint32(h.TipHeight))
+}
+
+// parseBlockHints parses the hints at the start of data and returns them with
+// the rest of data
+func parseBlockHints(data []byte) (BlockHints, []byte, error) {
+	if len(data) < blockHintsSize {
+		return BlockHints{}, nil, fmt.Errorf("%w: %d bytes", errShortBlockHints, len(data))
+	}
+	hints := BlockHints{
+		Height:    int32(binary.LittleEndian.Uint32(data)),
+		TipHeight: int32(binary.LittleEndian.Uint32(data[4:])),
+	}
+	if hints.Height < 0 || hints.TipHeight < 0 {
+		return BlockHints{}, nil, fmt.Errorf("%w: height %d, tip height %d", errInvalidHints, hints.Height, hints.TipHeight)
+	}
+	return hints, data[blockHintsSize:], nil
+}
+
+// hintedHeight returns the height hinted for the block of item, or -1 if it
+// came without hints
+func hintedHeight(item *BTCGossip) int32 {
+	if item.Hints == nil {
+		return -1
+	}
+	return item.Hints.Height
+}
+
+// blockHintTracker acts on the hints of the gossiped blocks. It skips the
+// blocks hinted more than staleDepth below our tip before they are looked up,
+// and tracks the highest tip hinted by peers, flagging the node as behind
+// while it is more than behindDepth above our tip.
+type blockHintTracker struct {
+	vm *VM
+
+	staleDepth  int32
+	behindDepth int32
+
+	lock    sync.Mutex
+	peerTip int32
+	behind  bool
+
+	staleSkipped   prometheus.Counter
+	peerTipGauge   prometheus.Gauge
+	behindPeersTip prometheus.Gauge
+}
+
+// newBlockHintTracker returns a tracker for the hints of the blocks gossiped
+// to vm and registers its metrics under namespace
+func newBlockHintTracker(
+	vm *VM,
+	config GossipConfig,
+	registerer prometheus.Registerer,
+	namespace string,
+) (*blockHintTracker, error) {
+	t := &blockHintTracker{
+		vm:          vm,
+		staleDepth:  int32(config.BlockHintStaleDepth),
+		behindDepth: int32(config.BlockHintBehindDepth),
+		staleSkipped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "blocks_hint_stale_skipped",
+			Help:      "number of gossiped blocks skipped because they were hinted too far below the tip",
+		}),
+		peerTipGauge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "peer_tip_height_hint",
+			Help:      "highest tip height hinted by peers gossiping blocks",
+		}),
+		behindPeersTip: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "behind_peer_tip",
+			Help:      "1 if peers hint a tip too far above ours, 0 otherwise",
+		}),
+	}
+	for _, metric := range []prometheus.Collector{t.staleSkipped, t.peerTipGauge, t.behindPeersTip} {
+		if err := registerer.Register(metric); err != nil {
+			return nil, fmt.Errorf("failed to register block hint metrics: %w", err)
+		}
+	}
+	return t, nil
+}
+
+// check records the hints of the block of item and returns errStaleBlockHint
+// if it should be skipped. Blocks gossiped without hints are never skipped.
+func (t *blockHintTracker) check(item *BTCGossip) error {
+	if item.Hints == nil {
+		return nil
+	}
+
+	tip := t.vm.chain.BestSnapshot().Height
+	t.observe(item.Hints.TipHeight, tip)
+	if tip-item.Hints.Height <= t.staleDepth {
+		return nil
+	}
+
+	t.staleSkipped.Inc()
+	return fmt.Errorf("%w: %s hinted at height %d, tip height is %d",
+		errStaleBlockHint, item.Block.Hash(), item.Hints.Height, tip)
+}
+
+// observe records peerTip, the tip hinted by a peer, and flags whether we are
+// behind the highest hinted tip given our tip
+func (t *blockHintTracker) observe(peerTip int32, tip int32) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if peerTip > t.peerTip {
+		t.peerTip = peerTip
+		t.peerTipGauge.Set(float64(peerTip))
+	}
+
+	behind := t.peerTip-tip > t.behindDepth
+	if behind == t.behind {
+		return
+	}
+	t.behind = behind
+	if behind {
+		t.behindPeersTip.Set(1)
+		t.vm.gossipLog.Warn("Peers hint a tip ahead of ours, waiting for consensus to fetch the missing blocks",
+			zap.Int32("tipHeight", tip),
+			zap.Int32("peerTipHeight", t.peerTip),
+		)
+		return
+	}
+	t.behindPeersTip.Set(0)
+	t.vm.gossipLog.Info("Caught up with the tip hinted by peers",
+		zap.Int32("tipHeight", tip),
+		zap.Int32("peerTipHeight", t.peerTip),
+	)
+}
@@ -0,0 +1,111 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+)
+
+func TestBlockHintsMarshal(t *testing.T) {
+	require := require.New(t)
+
+	item := newQueueTestBlock(1)
+	blockBytes, err := item.Block.Bytes()
+	require.NoError(err)
+	marshaller := &BTCGossipMarshaller{tipHeight: func() int32 { return 7 }}
+
+	// Blocks of unknown height are gossiped without hints
+	data, err := marshaller.MarshalGossip(item)
+	require.NoError(err)
+	require.Equal(byte(GossipItemTypeBlock), data[0])
+
+	// Blocks of known height are hinted with it and the tip height
+	item.Block.SetHeight(5)
+	data, err = marshaller.MarshalGossip(item)
+	require.NoError(err)
+	require.Equal(byte(GossipItemTypeBlockV1), data[0])
+	require.Len(data, 1+blockHintsSize+len(blockBytes))
+
+	parsed, err := marshaller.UnmarshalGossip(data)
+	require.NoError(err)
+	require.Equal(GossipItemTypeBlock, parsed.ItemType)
+	require.Equal(&BlockHints{Height: 5, TipHeight: 7}, parsed.Hints)
+	require.Equal(item.GossipID(), parsed.GossipID())
+	parsedBytes, err := parsed.Block.Bytes()
+	require.NoError(err)
+	require.Equal(blockBytes, parsedBytes)
+
+	// Marshallers without a tip never hint blocks
+	data, err = (&BTCGossipMarshaller{}).MarshalGossip(item)
+	require.NoError(err)
+	require.Equal(byte(GossipItemTypeBlock), data[0])
+	parsed, err = marshaller.UnmarshalGossip(data)
+	require.NoError(err)
+	require.Nil(parsed.Hints)
+
+	// Malformed hints are rejected
+	_, err = marshaller.UnmarshalGossip([]byte{byte(GossipItemTypeBlockV1), 1, 0, 0})
+	require.ErrorIs(err, errShortBlockHints)
+	negative := append([]byte{byte(GossipItemTypeBlockV1)}, BlockHints{Height: -1, TipHeight: 7}.marshal(nil)...)
+	_, err = marshaller.UnmarshalGossip(append(negative, blockBytes...))
+	require.ErrorIs(err, errInvalidHints)
+}
+
+func TestStaleBlockHint(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMs(t, 1, key)[0]
+	buildTestChain(t, vm, 5)
+	vm.gossipConfig.PushGossipFrequency = time.Hour
+	vm.gossipConfig.BlockHintStaleDepth = 2
+	vm.gossipConfig.BlockHintBehindDepth = 3
+	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+	hints := vm.btcSet.hints
+
+	// A block hinted far below the tip is skipped before it is looked up or
+	// validated. The hints may be wrong, so it is not remembered as rejected.
+	stale := newQueueTestBlock(1)
+	stale.Hints = &BlockHints{Height: 2, TipHeight: 5}
+	require.ErrorIs(vm.btcSet.Add(stale), errStaleBlockHint)
+	require.Equal(float64(1), testutil.ToFloat64(hints.staleSkipped))
+	require.False(vm.btcSet.Has(stale.GossipID()))
+	require.False(vm.btcSet.inBloom(stale))
+
+	// A block hinted near the tip is processed, and this one is invalid
+	recent := newQueueTestBlock(2)
+	recent.Hints = &BlockHints{Height: 3, TipHeight: 5}
+	require.NotErrorIs(vm.btcSet.Add(recent), errStaleBlockHint)
+	require.Equal(float64(1), testutil.ToFloat64(hints.staleSkipped))
+	require.Eventually(func() bool {
+		return vm.btcSet.inBloom(recent)
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Zero(testutil.ToFloat64(hints.behindPeersTip))
+
+	// Peers hinting a tip too far above ours flag the node as behind until
+	// the chain catches up
+	ahead := newQueueTestBlock(3)
+	ahead.Hints = &BlockHints{Height: 9, TipHeight: 9}
+	require.NotErrorIs(vm.btcSet.Add(ahead), errStaleBlockHint)
+	require.Equal(float64(9), testutil.ToFloat64(hints.peerTipGauge))
+	require.Equal(float64(1), testutil.ToFloat64(hints.behindPeersTip))
+
+	buildTestChain(t, vm, 1)
+	caughtUp := newQueueTestBlock(4)
+	caughtUp.Hints = &BlockHints{Height: 6, TipHeight: 6}
+	require.NotErrorIs(vm.btcSet.Add(caughtUp), errStaleBlockHint)
+	require.Equal(float64(9), testutil.ToFloat64(hints.peerTipGauge))
+	require.Zero(testutil.ToFloat64(hints.behindPeersTip))
+}
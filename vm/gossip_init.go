@@ -5,21 +5,22 @@ package vm
 
 import (
 	"fmt"
+	"runtime"
+	"time"
 
+	"github.com/MetalBlockchain/metalgo/network/p2p"
 	"github.com/MetalBlockchain/metalgo/network/p2p/gossip"
-	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
 
 // initializeGossip initializes the unified gossip system with both push and pull mechanisms
 func (vm *VM) initializeGossip() error {
-	vm.ctx.Log.Info("Initializing unified gossip system")
+	vm.gossipLog.Info("Initializing unified gossip system")
 
-	// Create prometheus registry for gossip metrics
-	reg := prometheus.NewRegistry()
+	reg := vm.metrics
 
 	// Create bloom filter for tracking gossiped items
-	bloom, err := gossip.NewBloomFilter(
+	bloom, err := newGossipBloomFilter(
 		reg,
 		"btc_gossip_bloom",
 		vm.gossipConfig.BloomFilterSize,
@@ -29,33 +30,81 @@ func (vm *VM) initializeGossip() error {
 	if err != nil {
 		return fmt.Errorf("failed to create bloom filter: %w", err)
 	}
-	vm.ctx.Log.Debug("Created bloom filter for gossip",
+	vm.gossipLog.Debug("Created bloom filter for gossip",
 		zap.Int("size", vm.gossipConfig.BloomFilterSize),
 		zap.Float64("fpRate", vm.gossipConfig.BloomFalsePositiveRate),
 	)
 
+	// Create cache of recently rejected items
+	rejected, err := newRejectedCache(
+		vm.gossipConfig.RejectedCacheSize,
+		vm.gossipConfig.RejectedCacheTTL,
+		reg,
+		"btc_gossip",
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create rejected cache: %w", err)
+	}
+
+	// Track the height hints of gossiped blocks
+	hints, err := newBlockHintTracker(vm, vm.gossipConfig, reg, "btc_gossip")
+	if err != nil {
+		return fmt.Errorf("failed to create block hint tracker: %w", err)
+	}
+
 	// Create unified BTC set (handles both transactions and blocks)
 	// Blocks are stored in btcd's database, not cached in memory
-	btcSet := NewUnifiedBTCSet(vm, bloom)
+	btcSet := NewUnifiedBTCSet(vm, bloom, rejected, hints)
 	vm.btcSet = btcSet
-	vm.ctx.Log.Debug("Created unified BTC set")
+	vm.gossipLog.Debug("Created unified BTC set")
+
+	// Validate the blocks of the set on a goroutine of their own
+	blocks, err := newBlockProcessor(btcSet, blockProcessorQueueSize, reg, "btc_gossip")
+	if err != nil {
+		return fmt.Errorf("failed to create block processor: %w", err)
+	}
+	btcSet.blocks = blocks
+
+	// Push from a view of the set which drops blocks once they leave the
+	// relay window, so they are not regossiped forever
+	relaySet, err := newRelayWindowSet(btcSet, vm.gossipConfig, reg, "btc_gossip")
+	if err != nil {
+		return fmt.Errorf("failed to create relay window set: %w", err)
+	}
+	vm.relaySet = relaySet
 
 	// Create gossip metrics
 	metrics, err := gossip.NewMetrics(reg, "btc_gossip")
 	if err != nil {
 		return fmt.Errorf("failed to create gossip metrics: %w", err)
 	}
-	vm.ctx.Log.Debug("Created gossip metrics")
+	vm.gossipLog.Debug("Created gossip metrics")
 
-	// Create the gossip handler that handles protobuf wrapping/unwrapping
-	handler := gossip.NewHandler[*BTCGossip](
-		vm.ctx.Log,
-		&BTCGossipMarshaller{},
-		btcSet,
-		metrics,
-		4*1024*1024, // 4MB target response size (accommodate both txs and blocks)
+	// Count the items moved by each side of gossip for getgossipinfo
+	stats := &gossipStats{}
+
+	// Queue pushed items for a bounded number of workers
+	queue, err := newGossipQueue(btcSet, vm.nodeConfig.GossipQueueSize, vm.gossipLog, reg, "btc_gossip")
+	if err != nil {
+		return fmt.Errorf("failed to create gossip queue: %w", err)
+	}
+	vm.gossipQueue = queue
+
+	handler := vm.newGossipHandler(queue, metrics, stats)
+	vm.gossipLog.Debug("Created gossip handler",
+		zap.Int("targetResponseBytes", vm.gossipConfig.PullGossipTargetResponseBytes))
+
+	// Rate limit inbound gossip per peer before it reaches the set
+	rateLimitedHandler, err := newRateLimitedHandler(
+		handler,
+		newGossipLimiter(vm.gossipConfig),
+		vm.gossipLog,
+		reg,
+		"btc_gossip",
 	)
-	vm.ctx.Log.Debug("Created gossip handler")
+	if err != nil {
+		return fmt.Errorf("failed to create rate limited gossip handler: %w", err)
+	}
 
 	// Initialize validators for stake-weighted gossip
 	if vm.p2pValidators == nil {
@@ -63,109 +112,240 @@ func (vm *VM) initializeGossip() error {
 		if err != nil {
 			return fmt.Errorf("failed to initialize validators: %w", err)
 		}
-		vm.ctx.Log.Info("Initialized validator set for gossip")
+		vm.gossipLog.Info("Initialized validator set for gossip")
 	}
 
 	// Create p2p client for gossip
-	client := vm.p2pNetwork.NewClient(BTCGossipHandlerID)
-	vm.ctx.Log.Debug("Created p2p client", zap.Uint64("handlerID", BTCGossipHandlerID))
+	handlerID := vm.nodeConfig.GossipHandlerID
+	client := vm.p2pNetwork.NewClient(handlerID)
+	vm.gossipLog.Debug("Created p2p client", zap.Uint64("handlerID", handlerID))
 
-	// Configure gossip parameters
-	pushGossipParams := gossip.BranchingFactor{
-		StakePercentage: vm.gossipConfig.PushGossipPercentStake,
-		Validators:      vm.gossipConfig.PushGossipNumValidators,
-		Peers:           vm.gossipConfig.PushGossipNumPeers,
-	}
-	pushRegossipParams := gossip.BranchingFactor{
-		Validators: vm.gossipConfig.PushRegossipNumValidators,
-		Peers:      vm.gossipConfig.PushRegossipNumPeers,
+	// Blocks are pushed by a push gossiper of their own, with metrics of
+	// their own
+	blockMetrics, err := gossip.NewMetrics(reg, "btc_gossip_blocks")
+	if err != nil {
+		return fmt.Errorf("failed to create block gossip metrics: %w", err)
 	}
 
-	vm.ctx.Log.Info("Gossip parameters configured",
-		zap.String("pushParams", fmt.Sprintf("%+v", pushGossipParams)),
-		zap.String("regossipParams", fmt.Sprintf("%+v", pushRegossipParams)),
+	// Configure gossip parameters
+	txPushParams, txRegossipParams := vm.gossipConfig.pushParams(GossipItemTypeTx)
+	blockPushParams, blockRegossipParams := vm.gossipConfig.pushParams(GossipItemTypeBlock)
+
+	vm.gossipLog.Info("Gossip parameters configured",
+		zap.String("txPushParams", fmt.Sprintf("%+v", txPushParams)),
+		zap.String("txRegossipParams", fmt.Sprintf("%+v", txRegossipParams)),
+		zap.String("blockPushParams", fmt.Sprintf("%+v", blockPushParams)),
+		zap.String("blockRegossipParams", fmt.Sprintf("%+v", blockRegossipParams)),
 		zap.Duration("pushFreq", vm.gossipConfig.PushGossipFrequency),
+		zap.Int("pushTargetBytes", vm.gossipConfig.PushGossipTargetBytes),
 		zap.Duration("pullFreq", vm.gossipConfig.PullGossipFrequency),
+		zap.Int("pullPollSize", vm.gossipConfig.PullGossipPollSize),
 		zap.Duration("regossipFreq", vm.gossipConfig.RegossipFrequency),
+		zap.Duration("blockRegossipMaxAge", vm.gossipConfig.BlockRegossipMaxAge),
+		zap.Int("blockRegossipMaxDepth", vm.gossipConfig.BlockRegossipMaxDepth),
+		zap.Int("blockHintStaleDepth", vm.gossipConfig.BlockHintStaleDepth),
+		zap.Int("blockHintBehindDepth", vm.gossipConfig.BlockHintBehindDepth),
 	)
 
-	// Create push gossiper
-	pushGossiper, err := gossip.NewPushGossiper[*BTCGossip](
-		&BTCGossipMarshaller{},
-		btcSet,
-		vm.p2pValidators,
-		client,
-		metrics,
-		pushGossipParams,
-		pushRegossipParams,
-		1000,                                // discardedSize
-		10,                                  // targetGossipSize
-		vm.gossipConfig.RegossipFrequency,   // maxRegossipFrequency
-	)
+	// Create push gossipers
+	txPushGossiper, err := vm.newPushGossiper(relaySet, client, metrics, &stats.pushed, txPushParams, txRegossipParams)
+	if err != nil {
+		return fmt.Errorf("failed to create tx push gossiper: %w", err)
+	}
+	blockPushGossiper, err := vm.newPushGossiper(relaySet, client, blockMetrics, &stats.pushed, blockPushParams, blockRegossipParams)
 	if err != nil {
-		return fmt.Errorf("failed to create push gossiper: %w", err)
+		return fmt.Errorf("failed to create block push gossiper: %w", err)
+	}
+	pushGossiper := &typedPushGossiper{
+		txs:    txPushGossiper,
+		blocks: blockPushGossiper,
 	}
-	vm.pushGossiper = pushGossiper
-	vm.ctx.Log.Info("Created push gossiper successfully")
+	vm.pushGossiper.Store(pushGossiper)
+	vm.gossipLog.Info("Created push gossipers successfully")
 
 	// Create pull gossiper
 	pullGossiper := gossip.NewPullGossiper[*BTCGossip](
-		vm.ctx.Log,
-		&BTCGossipMarshaller{},
+		vm.gossipLog,
+		&countingMarshaller{received: &stats.pulled},
 		btcSet,
 		client,
 		metrics,
-		10, // targetGossipSize
+		vm.gossipConfig.PullGossipPollSize,
 	)
 	vm.pullGossiper = pullGossiper
-	vm.ctx.Log.Info("Created pull gossiper successfully")
+	vm.gossipLog.Info("Created pull gossiper successfully")
 
-	// Register the gossip handler with the p2p network
-	if err := vm.p2pNetwork.AddHandler(BTCGossipHandlerID, handler); err != nil {
+	// The loops run the gossipers through adapters recording their cycles
+	stats.push = &instrumentedGossiper{Gossiper: pushGossiper, clock: vm.Clock, counter: &stats.pushed}
+	stats.pull = &instrumentedGossiper{Gossiper: pullGossiper, clock: vm.Clock, counter: &stats.pulled}
+	vm.gossipStats = stats
+
+	// Register the gossip handler with the p2p network, under the IDs of a
+	// migration window as well
+	if err := vm.p2pNetwork.AddHandler(handlerID, rateLimitedHandler); err != nil {
 		return fmt.Errorf("failed to register gossip handler: %w", err)
 	}
-	vm.ctx.Log.Info("Registered unified gossip handler",
-		zap.Uint64("handlerID", BTCGossipHandlerID))
+	for _, migrationID := range vm.nodeConfig.GossipMigrationHandlerIDs {
+		if err := vm.p2pNetwork.AddHandler(migrationID, rateLimitedHandler); err != nil {
+			return fmt.Errorf("failed to register gossip migration handler %d: %w", migrationID, err)
+		}
+	}
+	vm.gossipLog.Info("Registered unified gossip handler",
+		zap.Uint64("handlerID", handlerID),
+		zap.Uint64s("migrationHandlerIDs", vm.nodeConfig.GossipMigrationHandlerIDs))
 
 	return nil
 }
 
-// startGossipLoops starts the push and pull gossip goroutines
+// newPushGossiper returns a push gossiper of the items of set to the peers of
+// gossipParams and regossipParams, counting the items it pushes in pushed
+func (vm *VM) newPushGossiper(
+	set gossip.Set[*BTCGossip],
+	client *p2p.Client,
+	metrics gossip.Metrics,
+	pushed *gossipCounter,
+	gossipParams gossip.BranchingFactor,
+	regossipParams gossip.BranchingFactor,
+) (*gossip.PushGossiper[*BTCGossip], error) {
+	return gossip.NewPushGossiper[*BTCGossip](
+		&countingMarshaller{BTCGossipMarshaller: vm.gossipMarshaller(), sent: pushed},
+		set,
+		vm.p2pValidators,
+		client,
+		metrics,
+		gossipParams,
+		regossipParams,
+		vm.gossipConfig.PushGossipDiscardedSize,
+		vm.gossipConfig.PushGossipTargetBytes,
+		vm.gossipConfig.RegossipFrequency,
+	)
+}
+
+// newGossipHandler returns the handler serving pull requests from set and
+// accepting pushed items into it, counting both in stats. Pushed items are
+// tagged with their sender, so that the set accounts for them.
+func (vm *VM) newGossipHandler(set gossip.Set[*BTCGossip], metrics gossip.Metrics, stats *gossipStats) *peerGossipHandler {
+	newHandler := func(marshaller gossip.Marshaller[*BTCGossip]) *gossip.Handler[*BTCGossip] {
+		return gossip.NewHandler[*BTCGossip](
+			vm.gossipLog,
+			marshaller,
+			set,
+			metrics,
+			vm.gossipConfig.PullGossipTargetResponseBytes,
+		)
+	}
+	marshaller := &countingMarshaller{BTCGossipMarshaller: vm.gossipMarshaller(), sent: &stats.pullServed, received: &stats.pushReceived}
+	return &peerGossipHandler{
+		Handler:    newHandler(marshaller),
+		newHandler: newHandler,
+		marshaller: marshaller,
+		peers:      vm.peerGossip,
+	}
+}
+
+// gossipMarshaller returns the marshaller of the items gossiped to peers, which
+// hints blocks with the height of the tip and identifies transactions the way
+// the node gossips them
+func (vm *VM) gossipMarshaller() BTCGossipMarshaller {
+	return BTCGossipMarshaller{
+		tipHeight: func() int32 {
+			return vm.chain.BestSnapshot().Height
+		},
+		witnessIDs: vm.nodeConfig.WtxidGossip,
+	}
+}
+
+// startGossipLoops starts the push and pull gossip goroutines, the workers of
+// the gossip queue and the block processor
 func (vm *VM) startGossipLoops() {
-	vm.ctx.Log.Info("Starting gossip loops")
+	vm.gossipLog.Info("Starting gossip loops")
+
+	// Start the gossip workers, stopped by closing their queue
+	workers := vm.nodeConfig.GossipWorkers
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+	for range workers {
+		vm.shutdownWg.Add(1)
+		go func() {
+			defer vm.shutdownWg.Done()
+			vm.gossipQueue.run()
+		}()
+	}
+	vm.shutdownWg.Add(1)
+	go func() {
+		defer vm.shutdownWg.Done()
+		<-vm.gossipCtx.Done()
+		vm.gossipQueue.close()
+	}()
+
+	// Start the block processor, stopped once it processed the blocks queued
+	// before gossip is cancelled, so that it is done before the chain is
+	// closed
+	vm.shutdownWg.Add(1)
+	go func() {
+		defer vm.shutdownWg.Done()
+		vm.btcSet.blocks.run()
+	}()
+	vm.shutdownWg.Add(1)
+	go func() {
+		defer vm.shutdownWg.Done()
+		<-vm.gossipCtx.Done()
+		vm.btcSet.blocks.close()
+	}()
+
+	// Rotate the salt of the bloom filter sent in pull requests
+	if interval := vm.gossipConfig.BloomRotationInterval; interval > 0 {
+		vm.shutdownWg.Add(1)
+		go func() {
+			defer vm.shutdownWg.Done()
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					vm.btcSet.rotateBloom()
+				case <-vm.gossipCtx.Done():
+					return
+				}
+			}
+		}()
+	}
 
 	// Start push gossip loop
 	vm.shutdownWg.Add(1)
 	go func() {
 		defer vm.shutdownWg.Done()
-		vm.ctx.Log.Info("Push gossip loop started",
+		vm.gossipLog.Info("Push gossip loop started",
 			zap.Duration("frequency", vm.gossipConfig.PushGossipFrequency))
 		gossip.Every(
 			vm.gossipCtx,
-			vm.ctx.Log,
-			vm.pushGossiper,
+			vm.gossipLog,
+			vm.gossipStats.push,
 			vm.gossipConfig.PushGossipFrequency,
 		)
-		vm.ctx.Log.Info("Push gossip loop stopped")
+		vm.gossipLog.Info("Push gossip loop stopped")
 	}()
 
 	// Start pull gossip loop
 	vm.shutdownWg.Add(1)
 	go func() {
 		defer vm.shutdownWg.Done()
-		vm.ctx.Log.Info("Pull gossip loop started",
+		vm.gossipLog.Info("Pull gossip loop started",
 			zap.Duration("frequency", vm.gossipConfig.PullGossipFrequency))
 		gossip.Every(
 			vm.gossipCtx,
-			vm.ctx.Log,
-			vm.pullGossiper,
+			vm.gossipLog,
+			vm.gossipStats.pull,
 			vm.gossipConfig.PullGossipFrequency,
 		)
-		vm.ctx.Log.Info("Pull gossip loop stopped")
+		vm.gossipLog.Info("Pull gossip loop stopped")
 	}()
 
-	vm.ctx.Log.Info("Gossip loops started successfully",
+	vm.gossipLog.Info("Gossip loops started successfully",
 		zap.Duration("pushFreq", vm.gossipConfig.PushGossipFrequency),
 		zap.Duration("pullFreq", vm.gossipConfig.PullGossipFrequency),
+		zap.Int("workers", workers),
 	)
 }
@@ -12,4 +12,15 @@ const (
 
 	// GossipItemTypeBlock represents a block gossip item
 	GossipItemTypeBlock GossipItemType = 0x02
+
+	// GossipItemTypeBlockV1 is the envelope of a block gossip item carrying
+	// the height hints of its sender ahead of the block. It is unmarshalled
+	// as a GossipItemTypeBlock item with its hints set.
+	GossipItemTypeBlockV1 GossipItemType = 0x03
+
+	// GossipItemTypeTxV1 is the envelope of a transaction gossip item sent
+	// by a node identifying transactions by their wtxid. It is unmarshalled
+	// as a GossipItemTypeTx item, identified the way the receiving node
+	// identifies transactions.
+	GossipItemTypeTxV1 GossipItemType = 0x04
 )
@@ -0,0 +1,363 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/MetalBlockchain/metalgo/cache"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/network/p2p"
+	"github.com/MetalBlockchain/metalgo/network/p2p/gossip"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/MetalBlockchain/metalgo/utils/timer/mockable"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxRateLimitedPeers bounds the number of per-peer token buckets we keep
+	// in memory. Buckets for the least recently seen peers are evicted first,
+	// which at worst resets an evicted peer to a full burst.
+	maxRateLimitedPeers = 4096
+
+	// rateLimitWarnInterval is how often a peer exceeding its budget is
+	// logged as a warning. Its other dropped messages are logged at debug.
+	rateLimitWarnInterval = time.Minute
+)
+
+var _ p2p.Handler = (*rateLimitedHandler)(nil)
+
+// GossipLimitsConfig bounds the gossip and pull requests each peer may send.
+// Messages of a peer exceeding its budget are dropped before their items are
+// unmarshalled or validated.
+type GossipLimitsConfig struct {
+	// ItemsPerSecond is the sustained number of gossip items accepted per
+	// peer
+	ItemsPerSecond float64 `json:"itemsPerSecond"`
+
+	// ItemBurst is the maximum number of gossip items a peer may send in a
+	// burst
+	ItemBurst int `json:"itemBurst"`
+
+	// BytesPerSecond is the sustained number of gossip bytes accepted per
+	// peer
+	BytesPerSecond float64 `json:"bytesPerSecond"`
+
+	// ByteBurst is the maximum number of gossip bytes a peer may send in a
+	// burst. It must fit a block of the max size.
+	ByteBurst int `json:"byteBurst"`
+
+	// PullRequestsPerSecond is the sustained number of pull and mempool sync
+	// requests served per peer
+	PullRequestsPerSecond float64 `json:"pullRequestsPerSecond"`
+
+	// PullRequestBurst is the maximum number of pull and mempool sync
+	// requests a peer may send in a burst
+	PullRequestBurst int `json:"pullRequestBurst"`
+}
+
+// defaultGossipLimitsConfig returns the inbound limits of the default gossip
+// config
+func defaultGossipLimitsConfig() GossipLimitsConfig {
+	config := DefaultGossipConfig()
+	return GossipLimitsConfig{
+		ItemsPerSecond:        config.InboundGossipItemsPerSecond,
+		ItemBurst:             config.InboundGossipItemBurst,
+		BytesPerSecond:        config.InboundGossipBytesPerSecond,
+		ByteBurst:             config.InboundGossipByteBurst,
+		PullRequestsPerSecond: config.InboundPullRequestsPerSecond,
+		PullRequestBurst:      config.InboundPullRequestBurst,
+	}
+}
+
+// Validate checks if the configuration is valid
+func (c *GossipLimitsConfig) Validate() error {
+	if c.ItemsPerSecond <= 0 {
+		return fmt.Errorf("items per second must be positive, got %f", c.ItemsPerSecond)
+	}
+	if c.ItemBurst <= 0 {
+		return fmt.Errorf("item burst must be positive, got %d", c.ItemBurst)
+	}
+	if c.BytesPerSecond <= 0 {
+		return fmt.Errorf("bytes per second must be positive, got %f", c.BytesPerSecond)
+	}
+	if c.ByteBurst < wire.MaxBlockPayload {
+		return fmt.Errorf("byte burst must be at least the max block size %d, got %d", wire.MaxBlockPayload, c.ByteBurst)
+	}
+	if c.PullRequestsPerSecond <= 0 {
+		return fmt.Errorf("pull requests per second must be positive, got %f", c.PullRequestsPerSecond)
+	}
+	if c.PullRequestBurst <= 0 {
+		return fmt.Errorf("pull request burst must be positive, got %d", c.PullRequestBurst)
+	}
+	return nil
+}
+
+// apply sets the inbound limits of config
+func (c *GossipLimitsConfig) apply(config *GossipConfig) {
+	config.InboundGossipItemsPerSecond = c.ItemsPerSecond
+	config.InboundGossipItemBurst = c.ItemBurst
+	config.InboundGossipBytesPerSecond = c.BytesPerSecond
+	config.InboundGossipByteBurst = c.ByteBurst
+	config.InboundPullRequestsPerSecond = c.PullRequestsPerSecond
+	config.InboundPullRequestBurst = c.PullRequestBurst
+}
+
+// tokenBucket is a classic token bucket refilled continuously at rate
+// tokens per second up to burst tokens.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a bucket that starts full
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// refill adds the tokens accumulated since the last refill
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+// peerBuckets holds the item, byte and pull request budgets of a single peer
+type peerBuckets struct {
+	items    *tokenBucket
+	bytes    *tokenBucket
+	requests *tokenBucket
+
+	// lastWarned is when the peer was last logged for exceeding its budget
+	lastWarned time.Time
+}
+
+// gossipLimiter enforces per-node item and byte budgets on inbound gossip, and
+// a per-node budget of pull requests
+type gossipLimiter struct {
+	itemsPerSecond    float64
+	itemBurst         int
+	bytesPerSecond    float64
+	byteBurst         int
+	requestsPerSecond float64
+	requestBurst      int
+
+	clock mockable.Clock
+
+	lock  sync.Mutex
+	peers *cache.LRU[ids.NodeID, *peerBuckets]
+}
+
+// newGossipLimiter creates a limiter from the inbound limits in the gossip config
+func newGossipLimiter(config GossipConfig) *gossipLimiter {
+	return &gossipLimiter{
+		itemsPerSecond:    config.InboundGossipItemsPerSecond,
+		itemBurst:         config.InboundGossipItemBurst,
+		bytesPerSecond:    config.InboundGossipBytesPerSecond,
+		byteBurst:         config.InboundGossipByteBurst,
+		requestsPerSecond: config.InboundPullRequestsPerSecond,
+		requestBurst:      config.InboundPullRequestBurst,
+		peers:             &cache.LRU[ids.NodeID, *peerBuckets]{Size: maxRateLimitedPeers},
+	}
+}
+
+// buckets returns the budgets of nodeID, refilled up to now
+//
+// This function MUST be called with the limiter lock held.
+func (l *gossipLimiter) buckets(nodeID ids.NodeID) *peerBuckets {
+	now := l.clock.Time()
+	buckets, ok := l.peers.Get(nodeID)
+	if !ok {
+		buckets = &peerBuckets{
+			items:    newTokenBucket(l.itemsPerSecond, l.itemBurst, now),
+			bytes:    newTokenBucket(l.bytesPerSecond, l.byteBurst, now),
+			requests: newTokenBucket(l.requestsPerSecond, l.requestBurst, now),
+		}
+		l.peers.Put(nodeID, buckets)
+	}
+
+	buckets.items.refill(now)
+	buckets.bytes.refill(now)
+	buckets.requests.refill(now)
+	return buckets
+}
+
+// Allow reports whether nodeID may deliver numItems items totalling numBytes
+// bytes. Tokens are only consumed when both budgets can cover the message so
+// that a dropped message does not also eat into the peer's future allowance.
+func (l *gossipLimiter) Allow(nodeID ids.NodeID, numItems int, numBytes int) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	buckets := l.buckets(nodeID)
+	if buckets.items.tokens < float64(numItems) || buckets.bytes.tokens < float64(numBytes) {
+		return false
+	}
+
+	buckets.items.tokens -= float64(numItems)
+	buckets.bytes.tokens -= float64(numBytes)
+	return true
+}
+
+// AllowRequest reports whether nodeID may send a pull request, which carries
+// the bloom filter of the peer and makes us iterate over the mempool
+func (l *gossipLimiter) AllowRequest(nodeID ids.NodeID) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	buckets := l.buckets(nodeID)
+	if buckets.requests.tokens < 1 {
+		return false
+	}
+	buckets.requests.tokens--
+	return true
+}
+
+// ShouldWarn reports whether nodeID, which exceeded its budget, should be
+// logged as a warning, which happens at most once per rateLimitWarnInterval
+func (l *gossipLimiter) ShouldWarn(nodeID ids.NodeID) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	buckets := l.buckets(nodeID)
+	now := l.clock.Time()
+	if !buckets.lastWarned.IsZero() && now.Sub(buckets.lastWarned) < rateLimitWarnInterval {
+		return false
+	}
+	buckets.lastWarned = now
+	return true
+}
+
+// rateLimitedHandler drops AppGossip messages from peers that exceed their
+// inbound gossip budget before any item is unmarshalled or validated.
+// AppRequests of peers exceeding their pull request budget are throttled, as
+// each of them exchanges bloom filters and iterates over the mempool even
+// though its response is bounded by the handler's target response size.
+type rateLimitedHandler struct {
+	handler p2p.Handler
+	limiter *gossipLimiter
+	log     logging.Logger
+
+	droppedMessages prometheus.Counter
+	droppedItems    prometheus.Counter
+	droppedBytes    prometheus.Counter
+	droppedRequests prometheus.Counter
+}
+
+// newRateLimitedHandler wraps handler with the per-node limiter and registers
+// its metrics under namespace
+func newRateLimitedHandler(
+	handler p2p.Handler,
+	limiter *gossipLimiter,
+	log logging.Logger,
+	registerer prometheus.Registerer,
+	namespace string,
+) (*rateLimitedHandler, error) {
+	h := &rateLimitedHandler{
+		handler: handler,
+		limiter: limiter,
+		log:     log,
+		droppedMessages: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_messages",
+			Help:      "number of gossip messages dropped because the sending peer exceeded its rate limit",
+		}),
+		droppedItems: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_items",
+			Help:      "number of gossip items dropped because the sending peer exceeded its rate limit",
+		}),
+		droppedBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_bytes",
+			Help:      "number of gossip bytes dropped because the sending peer exceeded its rate limit",
+		}),
+		droppedRequests: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_requests",
+			Help:      "number of pull requests throttled because the requesting peer exceeded its rate limit",
+		}),
+	}
+
+	for _, c := range []prometheus.Collector{h.droppedMessages, h.droppedItems, h.droppedBytes, h.droppedRequests} {
+		if err := registerer.Register(c); err != nil {
+			return nil, fmt.Errorf("failed to register rate limit metrics: %w", err)
+		}
+	}
+	return h, nil
+}
+
+// AppGossip forwards gossip to the wrapped handler if nodeID is within its budget
+func (h *rateLimitedHandler) AppGossip(ctx context.Context, nodeID ids.NodeID, gossipBytes []byte) {
+	items, err := gossip.ParseAppGossip(gossipBytes)
+	if err != nil {
+		h.log.Debug("failed to parse gossip for rate limiting",
+			zap.Stringer("nodeID", nodeID),
+			zap.Error(err),
+		)
+		return
+	}
+
+	numBytes := 0
+	for _, item := range items {
+		numBytes += len(item)
+	}
+
+	if !h.limiter.Allow(nodeID, len(items), numBytes) {
+		h.droppedMessages.Inc()
+		h.droppedItems.Add(float64(len(items)))
+		h.droppedBytes.Add(float64(numBytes))
+		h.logLimited(nodeID, "dropping gossip from rate limited peer",
+			zap.Int("numItems", len(items)),
+			zap.Int("numBytes", numBytes),
+		)
+		return
+	}
+
+	h.handler.AppGossip(ctx, nodeID, gossipBytes)
+}
+
+// AppRequest forwards the request to the wrapped handler if nodeID is within
+// its pull request budget
+func (h *rateLimitedHandler) AppRequest(
+	ctx context.Context,
+	nodeID ids.NodeID,
+	deadline time.Time,
+	requestBytes []byte,
+) ([]byte, *common.AppError) {
+	if !h.limiter.AllowRequest(nodeID) {
+		h.droppedRequests.Inc()
+		h.logLimited(nodeID, "throttling pull request from rate limited peer")
+		return nil, p2p.ErrThrottled
+	}
+	return h.handler.AppRequest(ctx, nodeID, deadline, requestBytes)
+}
+
+// logLimited logs that a message of nodeID was dropped, as a warning at most
+// once per rateLimitWarnInterval for each peer
+func (h *rateLimitedHandler) logLimited(nodeID ids.NodeID, msg string, fields ...zap.Field) {
+	fields = append([]zap.Field{zap.Stringer("nodeID", nodeID)}, fields...)
+	if h.limiter.ShouldWarn(nodeID) {
+		h.log.Warn(msg, fields...)
+		return
+	}
+	h.log.Debug(msg, fields...)
+}
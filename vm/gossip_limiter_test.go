@@ -0,0 +1,214 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/network/p2p"
+	"github.com/MetalBlockchain/metalgo/network/p2p/gossip"
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// countingHandler counts the gossip messages that make it past the limiter
+type countingHandler struct {
+	handler p2p.Handler
+	count   int
+}
+
+func (h *countingHandler) AppGossip(ctx context.Context, nodeID ids.NodeID, gossipBytes []byte) {
+	h.count++
+	h.handler.AppGossip(ctx, nodeID, gossipBytes)
+}
+
+func (h *countingHandler) AppRequest(
+	ctx context.Context,
+	nodeID ids.NodeID,
+	deadline time.Time,
+	requestBytes []byte,
+) ([]byte, *common.AppError) {
+	return h.handler.AppRequest(ctx, nodeID, deadline, requestBytes)
+}
+
+func testLimiter(itemsPerSecond float64, itemBurst int, bytesPerSecond float64, byteBurst int) *gossipLimiter {
+	config := DefaultGossipConfig()
+	config.InboundGossipItemsPerSecond = itemsPerSecond
+	config.InboundGossipItemBurst = itemBurst
+	config.InboundGossipBytesPerSecond = bytesPerSecond
+	config.InboundGossipByteBurst = byteBurst
+
+	limiter := newGossipLimiter(config)
+	limiter.clock.Set(time.Unix(0, 0))
+	return limiter
+}
+
+func TestGossipLimiterItems(t *testing.T) {
+	require := require.New(t)
+
+	limiter := testLimiter(1, 3, 1024, 1024)
+	nodeID := ids.GenerateTestNodeID()
+
+	require.True(limiter.Allow(nodeID, 2, 1))
+	require.True(limiter.Allow(nodeID, 1, 1))
+	require.False(limiter.Allow(nodeID, 1, 1))
+
+	// One second refills one item
+	limiter.clock.Set(limiter.clock.Time().Add(time.Second))
+	require.True(limiter.Allow(nodeID, 1, 1))
+	require.False(limiter.Allow(nodeID, 1, 1))
+
+	// Refills never exceed the burst
+	limiter.clock.Set(limiter.clock.Time().Add(time.Hour))
+	require.False(limiter.Allow(nodeID, 4, 1))
+	require.True(limiter.Allow(nodeID, 3, 1))
+}
+
+func TestGossipLimiterBytes(t *testing.T) {
+	require := require.New(t)
+
+	limiter := testLimiter(100, 100, 10, 100)
+	nodeID := ids.GenerateTestNodeID()
+
+	require.True(limiter.Allow(nodeID, 1, 60))
+	require.False(limiter.Allow(nodeID, 1, 60))
+
+	// A dropped message must not consume item tokens
+	for i := 0; i < 99; i++ {
+		require.True(limiter.Allow(nodeID, 1, 0))
+	}
+	require.False(limiter.Allow(nodeID, 1, 0))
+
+	limiter.clock.Set(limiter.clock.Time().Add(2 * time.Second))
+	require.True(limiter.Allow(nodeID, 1, 60))
+}
+
+func TestGossipLimiterIsPerNode(t *testing.T) {
+	require := require.New(t)
+
+	limiter := testLimiter(1, 1, 1024, 1024)
+	nodeID0 := ids.GenerateTestNodeID()
+	nodeID1 := ids.GenerateTestNodeID()
+
+	require.True(limiter.Allow(nodeID0, 1, 1))
+	require.False(limiter.Allow(nodeID0, 1, 1))
+	require.True(limiter.Allow(nodeID1, 1, 1))
+}
+
+func TestGossipLimiterShouldWarn(t *testing.T) {
+	require := require.New(t)
+
+	limiter := testLimiter(1, 1, 1024, 1024)
+	nodeID0 := ids.GenerateTestNodeID()
+	nodeID1 := ids.GenerateTestNodeID()
+
+	// Each peer is warned about once per interval
+	require.True(limiter.ShouldWarn(nodeID0))
+	require.False(limiter.ShouldWarn(nodeID0))
+	require.True(limiter.ShouldWarn(nodeID1))
+
+	limiter.clock.Set(limiter.clock.Time().Add(rateLimitWarnInterval - time.Second))
+	require.False(limiter.ShouldWarn(nodeID0))
+	limiter.clock.Set(limiter.clock.Time().Add(time.Second))
+	require.True(limiter.ShouldWarn(nodeID0))
+}
+
+// TestReplayedInvalidTx simulates a peer replaying a single invalid
+// transaction and checks that it is never revalidated.
+func TestReplayedInvalidTx(t *testing.T) {
+	require := require.New(t)
+
+	const numReplays = 10_000
+
+	// The VM has no btcd adapter, so any attempt to revalidate the
+	// transaction would panic.
+	vm := &VM{ctx: &snow.Context{Log: logging.NoLog{}}, gossipLog: logging.NoLog{}}
+
+	reg := prometheus.NewRegistry()
+	bloom, err := newGossipBloomFilter(reg, "bloom", 8192, 0.01, 0.05)
+	require.NoError(err)
+	rejected, err := newRejectedCache(16, time.Hour, reg, "rejected")
+	require.NoError(err)
+	set := NewUnifiedBTCSet(vm, bloom, rejected, nil)
+
+	item := NewTxGossip(btcutil.NewTx(newTestTx(-1)))
+
+	// The first delivery was validated and rejected
+	rejected.Put(wire.RejectInvalid, item.GossipID())
+
+	metrics, err := gossip.NewMetrics(reg, "gossip")
+	require.NoError(err)
+	inner := &countingHandler{
+		handler: gossip.NewHandler[*BTCGossip](logging.NoLog{}, &BTCGossipMarshaller{}, set, metrics, 1024),
+	}
+
+	config := DefaultGossipConfig()
+	limiter := newGossipLimiter(config)
+	limiter.clock.Set(time.Unix(0, 0))
+	handler, err := newRateLimitedHandler(inner, limiter, logging.NoLog{}, reg, "test")
+	require.NoError(err)
+
+	itemBytes, err := (&BTCGossipMarshaller{}).MarshalGossip(item)
+	require.NoError(err)
+	msg, err := gossip.MarshalAppGossip([][]byte{itemBytes})
+	require.NoError(err)
+
+	nodeID := ids.GenerateTestNodeID()
+	for i := 0; i < numReplays; i++ {
+		handler.AppGossip(context.Background(), nodeID, msg)
+	}
+
+	// Only the burst is unmarshalled, and each of those is dropped by the
+	// rejected cache
+	require.Equal(config.InboundGossipItemBurst, inner.count)
+	require.Equal(float64(numReplays-config.InboundGossipItemBurst), testutil.ToFloat64(handler.droppedMessages))
+	require.Equal(float64(numReplays-config.InboundGossipItemBurst), testutil.ToFloat64(handler.droppedItems))
+	require.Equal(float64(config.InboundGossipItemBurst), testutil.ToFloat64(rejected.hits))
+
+	// Another peer is not affected by the misbehaving one
+	handler.AppGossip(context.Background(), ids.GenerateTestNodeID(), msg)
+	require.Equal(config.InboundGossipItemBurst+1, inner.count)
+}
+
+func TestPullRequestLimit(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	config := DefaultGossipConfig()
+	config.InboundPullRequestsPerSecond = 1
+	config.InboundPullRequestBurst = 2
+	limiter := newGossipLimiter(config)
+	limiter.clock.Set(time.Unix(0, 0))
+	handler, err := newRateLimitedHandler(p2p.NoOpHandler{}, limiter, logging.NoLog{}, prometheus.NewRegistry(), "test")
+	require.NoError(err)
+
+	request := func(nodeID ids.NodeID) *common.AppError {
+		_, appErr := handler.AppRequest(ctx, nodeID, time.Time{}, nil)
+		return appErr
+	}
+
+	// A peer requesting our filter too often is throttled, regardless of the
+	// items it gossips
+	nodeID := ids.GenerateTestNodeID()
+	require.Nil(request(nodeID))
+	require.Nil(request(nodeID))
+	require.Equal(p2p.ErrThrottled, request(nodeID))
+	require.True(limiter.Allow(nodeID, 1, 1))
+
+	// Other peers are not affected, and the budget refills over time
+	require.Nil(request(ids.GenerateTestNodeID()))
+	limiter.clock.Set(limiter.clock.Time().Add(time.Second))
+	require.Nil(request(nodeID))
+	require.Equal(p2p.ErrThrottled, request(nodeID))
+	require.Equal(float64(2), testutil.ToFloat64(handler.droppedRequests))
+}
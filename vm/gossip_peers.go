@@ -0,0 +1,225 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/MetalBlockchain/metalgo/cache"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/network/p2p/gossip"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/connmgr"
+)
+
+// maxGossipStatsPeers bounds the number of peers whose gossip is accounted
+// for. The stats of the least recently seen peers are evicted first.
+const maxGossipStatsPeers = 4096
+
+// gossipOutcome is what became of an item pushed by a peer
+type gossipOutcome string
+
+const (
+	gossipOutcomeUseful       gossipOutcome = "useful"
+	gossipOutcomeDuplicate    gossipOutcome = "duplicate"
+	gossipOutcomeInvalidTx    gossipOutcome = "invalid_tx"
+	gossipOutcomeInvalidBlock gossipOutcome = "invalid_block"
+	gossipOutcomeOversized    gossipOutcome = "oversized"
+)
+
+// gossipMisbehaviorScores are the decaying misbehavior scores added to a peer
+// for the outcomes of its items. Duplicates are expected from honest peers
+// pushing the same items at the same time, so they don't score.
+var gossipMisbehaviorScores = map[gossipOutcome]uint32{
+	gossipOutcomeInvalidTx:    10,
+	gossipOutcomeInvalidBlock: 50,
+	gossipOutcomeOversized:    25,
+}
+
+// peerGossipStats are the counts of the items pushed by a peer, and its
+// misbehavior score
+type peerGossipStats struct {
+	info  btcjson.MetalPeerGossipInfo
+	score connmgr.DynamicBanScore
+}
+
+// peerGossipTracker accounts for the items pushed by each peer, so that peers
+// pushing invalid or oversized items stand out. A warning is logged when the
+// misbehavior score of a peer crosses threshold, unless it is zero.
+type peerGossipTracker struct {
+	log       logging.Logger
+	threshold uint32
+
+	lock  sync.Mutex
+	peers *cache.LRU[ids.NodeID, *peerGossipStats]
+
+	items       *prometheus.CounterVec
+	misbehaving prometheus.Counter
+}
+
+// newPeerGossipTracker returns a tracker warning about the peers whose score
+// crosses threshold and registers its metrics under namespace
+func newPeerGossipTracker(
+	threshold uint32,
+	log logging.Logger,
+	registerer prometheus.Registerer,
+	namespace string,
+) (*peerGossipTracker, error) {
+	t := &peerGossipTracker{
+		log:       log,
+		threshold: threshold,
+		peers:     &cache.LRU[ids.NodeID, *peerGossipStats]{Size: maxGossipStatsPeers},
+		items: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "peer_items",
+			Help:      "number of items pushed by peers, by outcome",
+		}, []string{"outcome"}),
+		misbehaving: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "peer_misbehavior_warnings",
+			Help:      "number of times a peer crossed the misbehavior threshold",
+		}),
+	}
+	for _, metric := range []prometheus.Collector{t.items, t.misbehaving} {
+		if err := registerer.Register(metric); err != nil {
+			return nil, fmt.Errorf("failed to register peer gossip metrics: %w", err)
+		}
+	}
+	return t, nil
+}
+
+// record accounts for an item pushed by nodeID with outcome. Items without a
+// sender, such as those pulled from peers or submitted by clients, are not
+// accounted for.
+func (t *peerGossipTracker) record(nodeID ids.NodeID, outcome gossipOutcome) {
+	if t == nil || nodeID == ids.EmptyNodeID {
+		return
+	}
+	t.items.WithLabelValues(string(outcome)).Inc()
+
+	t.lock.Lock()
+	stats, ok := t.peers.Get(nodeID)
+	if !ok {
+		stats = &peerGossipStats{}
+		t.peers.Put(nodeID, stats)
+	}
+	switch outcome {
+	case gossipOutcomeUseful:
+		stats.info.UsefulItems++
+	case gossipOutcomeDuplicate:
+		stats.info.DuplicateItems++
+	case gossipOutcomeInvalidTx:
+		stats.info.InvalidTxs++
+	case gossipOutcomeInvalidBlock:
+		stats.info.InvalidBlocks++
+	case gossipOutcomeOversized:
+		stats.info.OversizedItems++
+	}
+	t.lock.Unlock()
+
+	increase, ok := gossipMisbehaviorScores[outcome]
+	if !ok {
+		return
+	}
+	previous := stats.score.Int()
+	score := stats.score.Increase(0, increase)
+	if t.threshold != 0 && previous <= t.threshold && score > t.threshold {
+		t.misbehaving.Inc()
+		t.log.Warn("Misbehaving gossip peer",
+			zap.Stringer("nodeID", nodeID),
+			zap.String("outcome", string(outcome)),
+			zap.Uint32("score", score),
+			zap.Uint32("threshold", t.threshold),
+		)
+	}
+}
+
+// get returns the counts of the items pushed by nodeID and its misbehavior
+// score
+func (t *peerGossipTracker) get(nodeID ids.NodeID) (btcjson.MetalPeerGossipInfo, uint32) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	stats, ok := t.peers.Get(nodeID)
+	if !ok {
+		return btcjson.MetalPeerGossipInfo{}, 0
+	}
+	return stats.info, stats.score.Int()
+}
+
+// disconnected forgets the stats of nodeID
+func (t *peerGossipTracker) disconnected(nodeID ids.NodeID) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.peers.Evict(nodeID)
+}
+
+// senderMarshaller unmarshals the items pushed by sender, tagging them with
+// its node ID so that the set accounts for them. The items it fails to
+// unmarshal are accounted for right away.
+type senderMarshaller struct {
+	gossip.Marshaller[*BTCGossip]
+
+	sender ids.NodeID
+	peers  *peerGossipTracker
+}
+
+// UnmarshalGossip deserializes data and tags the item with its sender
+func (m *senderMarshaller) UnmarshalGossip(data []byte) (*BTCGossip, error) {
+	item, err := m.Marshaller.UnmarshalGossip(data)
+	if err != nil {
+		if outcome, ok := unmarshalOutcome(data, err); ok {
+			m.peers.record(m.sender, outcome)
+		}
+		return nil, err
+	}
+	item.Sender = m.sender
+	return item, nil
+}
+
+// unmarshalOutcome returns the outcome of an item failing to unmarshal with
+// err. Items of unknown types are not accounted for, as they may come from
+// nodes running a newer version.
+func unmarshalOutcome(data []byte, err error) (gossipOutcome, bool) {
+	if errors.Is(err, errGossipItemOversized) {
+		return gossipOutcomeOversized, true
+	}
+	if len(data) == 0 {
+		return "", false
+	}
+	switch GossipItemType(data[0]) {
+	case GossipItemTypeTx, GossipItemTypeTxV1:
+		return gossipOutcomeInvalidTx, true
+	case GossipItemTypeBlock, GossipItemTypeBlockV1:
+		return gossipOutcomeInvalidBlock, true
+	default:
+		return "", false
+	}
+}
+
+// peerGossipHandler serves pull requests like the handler it wraps, and tags
+// the items pushed by a peer with its node ID
+type peerGossipHandler struct {
+	*gossip.Handler[*BTCGossip]
+
+	// newHandler returns a handler unmarshalling the pushed items with
+	// marshaller
+	newHandler func(marshaller gossip.Marshaller[*BTCGossip]) *gossip.Handler[*BTCGossip]
+	marshaller gossip.Marshaller[*BTCGossip]
+	peers      *peerGossipTracker
+}
+
+// AppGossip adds the items pushed by nodeID to the set, tagged with nodeID
+func (h *peerGossipHandler) AppGossip(ctx context.Context, nodeID ids.NodeID, gossipBytes []byte) {
+	marshaller := &senderMarshaller{Marshaller: h.marshaller, sender: nodeID, peers: h.peers}
+	h.newHandler(marshaller).AppGossip(ctx, nodeID, gossipBytes)
+}
@@ -0,0 +1,109 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"testing"
+
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+)
+
+func TestPeerGossipTracker(t *testing.T) {
+	require := require.New(t)
+
+	tracker, err := newPeerGossipTracker(60, logging.NoLog{}, prometheus.NewRegistry(), "test")
+	require.NoError(err)
+	nodeID := ids.GenerateTestNodeID()
+
+	// Useful and duplicate items are counted without scoring
+	tracker.record(nodeID, gossipOutcomeUseful)
+	tracker.record(nodeID, gossipOutcomeDuplicate)
+	info, score := tracker.get(nodeID)
+	require.Equal(btcjson.MetalPeerGossipInfo{UsefulItems: 1, DuplicateItems: 1}, info)
+	require.Zero(score)
+
+	// Items without a sender are not accounted for
+	tracker.record(ids.EmptyNodeID, gossipOutcomeInvalidBlock)
+	require.Equal(2.0, testutil.ToFloat64(tracker.items.WithLabelValues("useful"))+
+		testutil.ToFloat64(tracker.items.WithLabelValues("duplicate")))
+
+	// The peer is warned about once its score crosses the threshold
+	tracker.record(nodeID, gossipOutcomeInvalidBlock)
+	require.Zero(testutil.ToFloat64(tracker.misbehaving))
+	tracker.record(nodeID, gossipOutcomeOversized)
+	require.Equal(1.0, testutil.ToFloat64(tracker.misbehaving))
+	tracker.record(nodeID, gossipOutcomeInvalidTx)
+	require.Equal(1.0, testutil.ToFloat64(tracker.misbehaving))
+	info, score = tracker.get(nodeID)
+	require.Equal(uint64(1), info.InvalidBlocks)
+	require.Equal(uint64(1), info.OversizedItems)
+	require.Equal(uint64(1), info.InvalidTxs)
+	require.Greater(score, uint32(60))
+
+	// Other peers are not affected, and the stats of a peer are forgotten
+	// once it disconnects
+	_, score = tracker.get(ids.GenerateTestNodeID())
+	require.Zero(score)
+	tracker.disconnected(nodeID)
+	info, score = tracker.get(nodeID)
+	require.Zero(info)
+	require.Zero(score)
+
+	// A nil tracker records nothing
+	var nilTracker *peerGossipTracker
+	nilTracker.record(nodeID, gossipOutcomeInvalidTx)
+}
+
+func TestUnmarshalOutcome(t *testing.T) {
+	marshaller := &BTCGossipMarshaller{}
+	tests := []struct {
+		name    string
+		data    []byte
+		outcome gossipOutcome
+		ok      bool
+	}{
+		{
+			name:    "oversized",
+			data:    append([]byte{byte(GossipItemTypeBlock)}, make([]byte, maxGossipItemBytes)...),
+			outcome: gossipOutcomeOversized,
+			ok:      true,
+		},
+		{
+			name:    "invalid tx",
+			data:    []byte{byte(GossipItemTypeTxV1), 0x01},
+			outcome: gossipOutcomeInvalidTx,
+			ok:      true,
+		},
+		{
+			name:    "invalid block",
+			data:    []byte{byte(GossipItemTypeBlockV1), 0x01},
+			outcome: gossipOutcomeInvalidBlock,
+			ok:      true,
+		},
+		{
+			name: "unknown type",
+			data: []byte{0xff, 0x01},
+		},
+		{
+			name: "empty",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+
+			_, err := marshaller.UnmarshalGossip(test.data)
+			require.Error(err)
+			outcome, ok := unmarshalOutcome(test.data, err)
+			require.Equal(test.ok, ok)
+			require.Equal(test.outcome, outcome)
+		})
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"errors"
+
+	"github.com/MetalBlockchain/metalgo/network/p2p/gossip"
+)
+
+var _ gossip.Gossiper = (*typedPushGossiper)(nil)
+
+// typedPushGossiper pushes transactions and blocks with push gossipers of
+// their own, so that each item type is pushed to the validators and
+// non-validator peers of its push gossip config
+type typedPushGossiper struct {
+	txs    *gossip.PushGossiper[*BTCGossip]
+	blocks *gossip.PushGossiper[*BTCGossip]
+}
+
+// Add queues items to be pushed by the push gossiper of their type
+func (g *typedPushGossiper) Add(items ...*BTCGossip) {
+	for _, item := range items {
+		if item.ItemType == GossipItemTypeBlock {
+			g.blocks.Add(item)
+		} else {
+			g.txs.Add(item)
+		}
+	}
+}
+
+// Gossip pushes the queued transactions and blocks
+func (g *typedPushGossiper) Gossip(ctx context.Context) error {
+	return errors.Join(g.txs.Gossip(ctx), g.blocks.Gossip(ctx))
+}
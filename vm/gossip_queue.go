@@ -0,0 +1,189 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/MetalBlockchain/metalgo/network/p2p/gossip"
+	"github.com/MetalBlockchain/metalgo/utils/buffer"
+	"github.com/MetalBlockchain/metalgo/utils/heap"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// defaultGossipQueueSize is the default number of pushed gossip items waiting
+// for a gossip worker
+const defaultGossipQueueSize = 4096
+
+var (
+	errGossipQueueFull   = errors.New("gossip queue is full")
+	errGossipQueueClosed = errors.New("gossip queue is closed")
+
+	_ gossip.Set[*BTCGossip] = (*gossipQueue)(nil)
+)
+
+// gossipQueue hands the items pushed by peers to a fixed number of workers
+// adding them to the wrapped set, so that a burst of gossip, which the p2p
+// network delivers from as many goroutines as messages, can't pile up
+// goroutines contending for the lock of the set. The rest of the set is
+// served by the wrapped set.
+//
+// At most size items are queued. Blocks are processed before transactions,
+// the highest hinted blocks first and the others in the order they were
+// pushed. A transaction pushed while the queue is full is dropped, as is the
+// oldest queued transaction to make room for a block. Blocks are never
+// dropped: a block pushed while the queue is full of blocks waits for room,
+// holding back the peer delivering it.
+type gossipQueue struct {
+	gossip.Set[*BTCGossip]
+
+	log  logging.Logger
+	size int
+
+	lock   sync.Mutex
+	cond   *sync.Cond
+	blocks heap.Queue[queuedBlock]
+	txs    buffer.Deque[*BTCGossip]
+	closed bool
+
+	// pushed is the number of blocks pushed, which orders the blocks of the
+	// same hinted height
+	pushed uint64
+
+	droppedTxs prometheus.Counter
+}
+
+// queuedBlock is a block waiting in the queue, seq being the number of blocks
+// pushed before it
+type queuedBlock struct {
+	item *BTCGossip
+	seq  uint64
+}
+
+// before returns whether b is processed before other
+func (b queuedBlock) before(other queuedBlock) bool {
+	if height, otherHeight := hintedHeight(b.item), hintedHeight(other.item); height != otherHeight {
+		return height > otherHeight
+	}
+	return b.seq < other.seq
+}
+
+// newGossipQueue returns a queue of at most size items in front of set and
+// registers its metrics under namespace
+func newGossipQueue(
+	set gossip.Set[*BTCGossip],
+	size int,
+	log logging.Logger,
+	registerer prometheus.Registerer,
+	namespace string,
+) (*gossipQueue, error) {
+	q := &gossipQueue{
+		Set:    set,
+		log:    log,
+		size:   size,
+		blocks: heap.NewQueue(queuedBlock.before),
+		txs:    buffer.NewUnboundedDeque[*BTCGossip](0),
+		droppedTxs: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "queue_dropped_txs",
+			Help:      "number of gossiped transactions dropped because the gossip queue was full",
+		}),
+	}
+	q.cond = sync.NewCond(&q.lock)
+
+	if err := registerer.Register(q.droppedTxs); err != nil {
+		return nil, fmt.Errorf("failed to register gossip queue metrics: %w", err)
+	}
+	return q, nil
+}
+
+// Add queues item for the workers, dropping a transaction if the queue is full
+func (q *gossipQueue) Add(item *BTCGossip) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for !q.closed && q.len() >= q.size {
+		if item.ItemType != GossipItemTypeBlock {
+			q.droppedTxs.Inc()
+			return errGossipQueueFull
+		}
+		if _, ok := q.txs.PopLeft(); ok {
+			q.droppedTxs.Inc()
+			break
+		}
+		q.cond.Wait()
+	}
+	if q.closed {
+		return errGossipQueueClosed
+	}
+
+	if item.ItemType == GossipItemTypeBlock {
+		q.blocks.Push(queuedBlock{item: item, seq: q.pushed})
+		q.pushed++
+	} else {
+		q.txs.PushRight(item)
+	}
+	q.cond.Broadcast()
+	return nil
+}
+
+// len returns the number of queued items
+//
+// Assumes the lock is held
+func (q *gossipQueue) len() int {
+	return q.blocks.Len() + q.txs.Len()
+}
+
+// pop waits for an item, blocks first, and returns false once the queue is
+// closed
+func (q *gossipQueue) pop() (*BTCGossip, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for !q.closed && q.len() == 0 {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return nil, false
+	}
+
+	var item *BTCGossip
+	if block, ok := q.blocks.Pop(); ok {
+		item = block.item
+	} else {
+		item, _ = q.txs.PopLeft()
+	}
+	// Wake the blocks waiting for room
+	q.cond.Broadcast()
+	return item, true
+}
+
+// run adds the queued items to the wrapped set until the queue is closed
+func (q *gossipQueue) run() {
+	for {
+		item, ok := q.pop()
+		if !ok {
+			return
+		}
+		if err := q.Set.Add(item); err != nil {
+			q.log.Debug("failed to add queued gossip to the known set",
+				zap.Stringer("id", item.GossipID()),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// close stops the workers and releases the blocks waiting for room. Queued
+// items are dropped.
+func (q *gossipQueue) close() {
+	q.lock.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.lock.Unlock()
+}
@@ -0,0 +1,229 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/network/p2p/gossip"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+)
+
+// gatedGossipSet counts the items added to it, each add waiting for gate to
+// be closed
+type gatedGossipSet struct {
+	testGossipSet
+	gate  chan struct{}
+	added atomic.Int64
+}
+
+func (s *gatedGossipSet) Add(*BTCGossip) error {
+	<-s.gate
+	s.added.Add(1)
+	return nil
+}
+
+// newQueueTestTx returns the gossip of a transaction spending output index of
+// a test outpoint with an output script of scriptSize bytes
+func newQueueTestTx(index uint32, scriptSize int) *BTCGossip {
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{0x01}, index), nil, nil))
+	msgTx.AddTxOut(wire.NewTxOut(1, make([]byte, scriptSize)))
+	return NewTxGossip(btcutil.NewTx(msgTx))
+}
+
+// newQueueTestBlock returns the gossip of an empty block with nonce
+func newQueueTestBlock(nonce uint32) *BTCGossip {
+	return NewBlockGossip(btcutil.NewBlock(wire.NewMsgBlock(&wire.BlockHeader{Nonce: nonce})))
+}
+
+func TestGossipQueuePriority(t *testing.T) {
+	require := require.New(t)
+
+	q, err := newGossipQueue(&testGossipSet{}, 2, logging.NoLog{}, prometheus.NewRegistry(), "test")
+	require.NoError(err)
+
+	// Transactions pushed while the queue is full are dropped
+	tx0, tx1 := newQueueTestTx(0, 0), newQueueTestTx(1, 0)
+	require.NoError(q.Add(tx0))
+	require.NoError(q.Add(tx1))
+	require.ErrorIs(q.Add(newQueueTestTx(2, 0)), errGossipQueueFull)
+	require.Equal(float64(1), testutil.ToFloat64(q.droppedTxs))
+
+	// Blocks replace the oldest queued transactions
+	block0, block1, block2 := newQueueTestBlock(0), newQueueTestBlock(1), newQueueTestBlock(2)
+	require.NoError(q.Add(block0))
+	require.NoError(q.Add(block1))
+	require.Equal(float64(3), testutil.ToFloat64(q.droppedTxs))
+	require.ErrorIs(q.Add(tx0), errGossipQueueFull)
+
+	// A block pushed while the queue is full of blocks waits for room
+	added := make(chan error)
+	go func() {
+		added <- q.Add(block2)
+	}()
+	select {
+	case <-added:
+		require.FailNow("block added to a full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Blocks are popped first, in the order they were pushed
+	item, ok := q.pop()
+	require.True(ok)
+	require.Equal(block0, item)
+	require.NoError(<-added)
+	require.ErrorIs(q.Add(tx1), errGossipQueueFull)
+	for _, expected := range []*BTCGossip{block1, block2} {
+		item, ok := q.pop()
+		require.True(ok)
+		require.Equal(expected, item)
+	}
+	require.Equal(float64(5), testutil.ToFloat64(q.droppedTxs))
+
+	// Closing the queue drops the queued items and releases the waiting
+	// blocks
+	require.NoError(q.Add(newQueueTestBlock(3)))
+	require.NoError(q.Add(newQueueTestBlock(4)))
+	go func() {
+		added <- q.Add(newQueueTestBlock(5))
+	}()
+	q.close()
+	require.ErrorIs(<-added, errGossipQueueClosed)
+	_, ok = q.pop()
+	require.False(ok)
+}
+
+func TestGossipQueueHintedBlocks(t *testing.T) {
+	require := require.New(t)
+
+	q, err := newGossipQueue(&testGossipSet{}, 8, logging.NoLog{}, prometheus.NewRegistry(), "test")
+	require.NoError(err)
+
+	// Hinted blocks are popped highest first, ahead of the blocks without
+	// hints, which keep the order they were pushed in
+	unhinted0, unhinted1 := newQueueTestBlock(0), newQueueTestBlock(1)
+	low, high, tied := newQueueTestBlock(2), newQueueTestBlock(3), newQueueTestBlock(4)
+	low.Hints = &BlockHints{Height: 10, TipHeight: 12}
+	high.Hints = &BlockHints{Height: 12, TipHeight: 12}
+	tied.Hints = &BlockHints{Height: 10, TipHeight: 12}
+	for _, item := range []*BTCGossip{unhinted0, low, high, unhinted1, tied} {
+		require.NoError(q.Add(item))
+	}
+	for _, expected := range []*BTCGossip{high, low, tied, unhinted0, unhinted1} {
+		item, ok := q.pop()
+		require.True(ok)
+		require.Equal(expected, item)
+	}
+}
+
+// TestGossipQueueLoad pushes 10k transactions through the gossip handler
+// from concurrent peers while the workers are stuck, and checks that the
+// goroutines and the memory used are bounded by the workers and the queue.
+func TestGossipQueueLoad(t *testing.T) {
+	const (
+		numTxs     = 10_000
+		numPeers   = 16
+		numWorkers = 4
+		queueSize  = 256
+		scriptSize = 20_000
+	)
+	require := require.New(t)
+
+	set := &gatedGossipSet{gate: make(chan struct{})}
+	q, err := newGossipQueue(set, queueSize, logging.NoLog{}, prometheus.NewRegistry(), "test")
+	require.NoError(err)
+	metrics, err := gossip.NewMetrics(prometheus.NewRegistry(), "test")
+	require.NoError(err)
+	handler := gossip.NewHandler[*BTCGossip](logging.NoLog{}, &BTCGossipMarshaller{}, q, metrics, 1024)
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	baseGoroutines := runtime.NumGoroutine()
+
+	var workers sync.WaitGroup
+	for range numWorkers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			q.run()
+		}()
+	}
+
+	// Sample the goroutines while the peers push
+	done := make(chan struct{})
+	var maxGoroutines atomic.Int64
+	var sampler sync.WaitGroup
+	sampler.Add(1)
+	go func() {
+		defer sampler.Done()
+		for {
+			if n := int64(runtime.NumGoroutine()); n > maxGoroutines.Load() {
+				maxGoroutines.Store(n)
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}()
+
+	var peers sync.WaitGroup
+	for peer := range numPeers {
+		peers.Add(1)
+		go func() {
+			defer peers.Done()
+			nodeID := ids.GenerateTestNodeID()
+			marshaller := &BTCGossipMarshaller{}
+			for i := peer; i < numTxs; i += numPeers {
+				itemBytes, err := marshaller.MarshalGossip(newQueueTestTx(uint32(i), scriptSize))
+				if err != nil {
+					panic(err)
+				}
+				msg, err := gossip.MarshalAppGossip([][]byte{itemBytes})
+				if err != nil {
+					panic(err)
+				}
+				handler.AppGossip(context.Background(), nodeID, msg)
+			}
+		}()
+	}
+	peers.Wait()
+	close(done)
+	sampler.Wait()
+
+	// Only the queued transactions and those of the stuck workers are held,
+	// a small fraction of those pushed
+	runtime.GC()
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	require.Less(int64(after.HeapAlloc)-int64(before.HeapAlloc), int64(numTxs*scriptSize/4))
+	require.LessOrEqual(maxGoroutines.Load(), int64(baseGoroutines+numWorkers+numPeers+1))
+	dropped := testutil.ToFloat64(q.droppedTxs)
+	require.GreaterOrEqual(dropped, float64(numTxs-queueSize-numWorkers))
+
+	// Every transaction is either dropped or added once the workers resume
+	close(set.gate)
+	require.Eventually(func() bool {
+		return float64(set.added.Load())+dropped == numTxs
+	}, 10*time.Second, 10*time.Millisecond)
+	q.close()
+	workers.Wait()
+	require.LessOrEqual(runtime.NumGoroutine(), baseGoroutines)
+}
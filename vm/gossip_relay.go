@@ -0,0 +1,104 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/metalgo/cache"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/network/p2p/gossip"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// relayedBlocksSize is the number of relayed blocks remembered. It covers
+// the regossip window of blocks many times over at the block rate.
+const relayedBlocksSize = 1024
+
+var _ gossip.Set[*BTCGossip] = (*relayWindowSet)(nil)
+
+// relayedBlock records when a block was first pushed and at which height
+type relayedBlock struct {
+	firstRelayed time.Time
+	height       int32
+}
+
+// relayWindowSet is the set of the push gossiper. It is the unified set,
+// except that relayed blocks leave it once they were first pushed more than
+// maxAge ago or are more than maxDepth below the accepted tip, so that the
+// push gossiper stops regossiping them. Blocks are remembered across
+// regossip cycles, from the first push. Pull requests are served from the
+// unified set, so peers can still request the blocks explicitly.
+type relayWindowSet struct {
+	*UnifiedBTCSet
+
+	maxAge   time.Duration
+	maxDepth int32
+
+	relayed    *cache.LRU[ids.ID, relayedBlock]
+	suppressed prometheus.Counter
+}
+
+// newRelayWindowSet wraps set for the push gossiper and registers its metric
+// under namespace
+func newRelayWindowSet(
+	set *UnifiedBTCSet,
+	config GossipConfig,
+	registerer prometheus.Registerer,
+	namespace string,
+) (*relayWindowSet, error) {
+	s := &relayWindowSet{
+		UnifiedBTCSet: set,
+		maxAge:        config.BlockRegossipMaxAge,
+		maxDepth:      int32(config.BlockRegossipMaxDepth),
+		relayed:       &cache.LRU[ids.ID, relayedBlock]{Size: relayedBlocksSize},
+		suppressed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "blocks_regossip_suppressed",
+			Help:      "number of blocks no longer regossiped because they left the relay window",
+		}),
+	}
+	if err := registerer.Register(s.suppressed); err != nil {
+		return nil, fmt.Errorf("failed to register relay window metrics: %w", err)
+	}
+	return s, nil
+}
+
+// relay records that block is pushed, unless it already was
+func (s *relayWindowSet) relay(block *btcutil.Block) {
+	id := hashToID(block.Hash())
+	if _, ok := s.relayed.Get(id); ok {
+		return
+	}
+	s.relayed.Put(id, relayedBlock{
+		firstRelayed: s.vm.Clock.Time(),
+		height:       block.Height(),
+	})
+}
+
+// Has returns false for relayed blocks outside of the relay window, and
+// whether the unified set has the item otherwise
+func (s *relayWindowSet) Has(id ids.ID) bool {
+	if !s.UnifiedBTCSet.Has(id) {
+		return false
+	}
+
+	block, ok := s.relayed.Get(id)
+	if !ok {
+		return true
+	}
+	age := s.vm.Clock.Time().Sub(block.firstRelayed)
+	depth := s.vm.chain.BestSnapshot().Height - block.height
+	if age <= s.maxAge && depth <= s.maxDepth {
+		return true
+	}
+
+	// The push gossiper drops the items missing from its set, so the block
+	// is only suppressed once
+	s.relayed.Evict(id)
+	s.suppressed.Inc()
+	return false
+}
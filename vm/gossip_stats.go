@@ -0,0 +1,170 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/MetalBlockchain/metalgo/network/p2p/gossip"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+)
+
+// pushTrackingMetrics are the gauges of the transaction and block push
+// gossipers counting the items they track, labeled by whether they were sent
+// yet
+var pushTrackingMetrics = []string{"btc_gossip_gossip_tracking", "btc_gossip_blocks_gossip_tracking"}
+
+var errGossipNotInitialized = errors.New("gossip is not initialized")
+
+// gossipCounter counts the items and bytes moved in one direction of gossip
+type gossipCounter struct {
+	items atomic.Uint64
+	bytes atomic.Uint64
+}
+
+// add counts an item of size bytes
+func (c *gossipCounter) add(size int) {
+	c.items.Add(1)
+	c.bytes.Add(uint64(size))
+}
+
+// countingMarshaller counts the items it marshals to gossip in sent, and the
+// items it unmarshals from gossip in received. Either counter may be nil.
+type countingMarshaller struct {
+	BTCGossipMarshaller
+
+	sent     *gossipCounter
+	received *gossipCounter
+}
+
+// MarshalGossip serializes item and counts it as sent
+func (m *countingMarshaller) MarshalGossip(item *BTCGossip) ([]byte, error) {
+	data, err := m.BTCGossipMarshaller.MarshalGossip(item)
+	if err == nil && m.sent != nil {
+		m.sent.add(len(data))
+	}
+	return data, err
+}
+
+// UnmarshalGossip deserializes data and counts it as received
+func (m *countingMarshaller) UnmarshalGossip(data []byte) (*BTCGossip, error) {
+	item, err := m.BTCGossipMarshaller.UnmarshalGossip(data)
+	if err == nil && m.received != nil {
+		m.received.add(len(data))
+	}
+	return item, err
+}
+
+// instrumentedGossiper records the cycles of a gossip loop and the number of
+// items its counter moved between the last two of them
+type instrumentedGossiper struct {
+	gossip.Gossiper
+
+	clock   Clock
+	counter *gossipCounter
+
+	lock              sync.Mutex
+	lastCycle         time.Time
+	lastCycleMark     uint64
+	lastIntervalItems uint64
+}
+
+// Gossip runs a cycle of the wrapped gossiper
+func (g *instrumentedGossiper) Gossip(ctx context.Context) error {
+	err := g.Gossiper.Gossip(ctx)
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	items := g.counter.items.Load()
+	g.lastIntervalItems = items - g.lastCycleMark
+	g.lastCycleMark = items
+	g.lastCycle = g.clock.Time()
+	return err
+}
+
+// info returns the activity of the gossip loop
+func (g *instrumentedGossiper) info() btcjson.GossipLoopInfo {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	info := btcjson.GossipLoopInfo{
+		Items:             g.counter.items.Load(),
+		Bytes:             g.counter.bytes.Load(),
+		LastIntervalItems: g.lastIntervalItems,
+	}
+	if !g.lastCycle.IsZero() {
+		info.LastCycle = g.lastCycle.Unix()
+	}
+	return info
+}
+
+// gossipStats counts the items moved by gossip for the getgossipinfo RPC
+type gossipStats struct {
+	// pushed and pulled are the items sent by the push gossiper and received
+	// by the pull gossiper
+	pushed gossipCounter
+	pulled gossipCounter
+
+	// pushReceived and pullServed are the items received from the push
+	// gossip of peers and sent in responses to their pull requests
+	pushReceived gossipCounter
+	pullServed   gossipCounter
+
+	push *instrumentedGossiper
+	pull *instrumentedGossiper
+}
+
+// gossipInfo returns the state of the bloom filter and the gossip loops for
+// the getgossipinfo RPC
+func (vm *VM) gossipInfo() (*btcjson.GetGossipInfoResult, error) {
+	if vm.btcSet == nil || vm.gossipStats == nil {
+		return nil, errGossipNotInitialized
+	}
+
+	queueDepth, err := pushQueueDepth(vm.metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := vm.gossipStats
+	return &btcjson.GetGossipInfoResult{
+		Bloom:          vm.btcSet.bloomInfo(),
+		Push:           stats.push.info(),
+		Pull:           stats.pull.info(),
+		PushQueueDepth: queueDepth,
+		BytesSent:      stats.pushed.bytes.Load() + stats.pullServed.bytes.Load(),
+		BytesReceived:  stats.pushReceived.bytes.Load() + stats.pulled.bytes.Load(),
+	}, nil
+}
+
+// pushQueueDepth returns the number of items waiting to be pushed for the
+// first time, which the push gossipers only expose through their metrics
+func pushQueueDepth(gatherer prometheus.Gatherer) (int64, error) {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return 0, err
+	}
+	var depth int64
+	for _, family := range families {
+		if !slices.Contains(pushTrackingMetrics, family.GetName()) {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "type" && label.GetValue() == "unsent" {
+					depth += int64(metric.GetGauge().GetValue())
+				}
+			}
+		}
+	}
+	return depth, nil
+}
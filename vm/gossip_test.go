@@ -0,0 +1,654 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/mempool"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/network/p2p"
+	"github.com/MetalBlockchain/metalgo/network/p2p/gossip"
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/MetalBlockchain/metalgo/utils/set"
+	"github.com/MetalBlockchain/metalgo/utils/timer/mockable"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFeeTx returns a transaction spending output index of prevTx, which
+// must pay to key, to a single output paying to key. The fee is the result of
+// feeForSize for the virtual size of the signed transaction.
+func newTestFeeTx(t testing.TB, key *btcec.PrivateKey, prevTx *wire.MsgTx, index uint32, feeForSize func(vsize int64) int64) *btcutil.Tx {
+	prevOut := prevTx.TxOut[index]
+	prevHash := prevTx.TxHash()
+
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, index), nil, nil))
+	msgTx.AddTxOut(wire.NewTxOut(prevOut.Value, prevOut.PkScript))
+
+	// The size of the signature varies, so the fee is set for the size of the
+	// first signature and the lock time is changed until the signature has
+	// that size again
+	msgTx.TxIn[0].SignatureScript = signTestTx(t, key, msgTx, prevOut.PkScript)
+	vsize := mempool.GetTxVirtualSize(btcutil.NewTx(msgTx))
+	msgTx.TxOut[0].Value = prevOut.Value - feeForSize(vsize)
+	for {
+		msgTx.TxIn[0].SignatureScript = signTestTx(t, key, msgTx, prevOut.PkScript)
+		tx := btcutil.NewTx(msgTx)
+		if mempool.GetTxVirtualSize(tx) == vsize {
+			return tx
+		}
+		msgTx.LockTime++
+	}
+}
+
+// signTestTx returns the signature script of the first input of msgTx, which
+// spends pkScript paying to key
+func signTestTx(t testing.TB, key *btcec.PrivateKey, msgTx *wire.MsgTx, pkScript []byte) []byte {
+	sigScript, err := txscript.SignatureScript(msgTx, 0, pkScript, txscript.SigHashAll, key, true)
+	require.NoError(t, err)
+	return sigScript
+}
+
+func TestGossipFeeRates(t *testing.T) {
+	const (
+		minGossipFeeRate = 2
+		minRelayFeeRate  = 3
+	)
+
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, "", []byte(`{"minGossipFeeRate":2,"minRelayFeeRate":3}`))[0]
+	require.Equal(float64(minGossipFeeRate), vm.config.MinGossipFeeRate)
+	require.Equal(float64(minRelayFeeRate), vm.config.MinRelayFeeRate)
+	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+	txPool := vm.btcdAdapter.TxMemPool()
+
+	buildBlock := func() *BlockAdapter {
+		blk, err := vm.BuildBlock(ctx)
+		require.NoError(err)
+		require.NoError(blk.Verify(ctx))
+		require.NoError(vm.SetPreference(ctx, blk.ID()))
+		require.NoError(blk.Accept(ctx))
+		return blk.(*BlockAdapter)
+	}
+
+	// Fund outputs paying key
+	coinbase := buildBlock().btcBlock.Transactions()[0].MsgTx()
+	split := newTestSplitTx(t, key, coinbase, 0, 4)
+	_, err = txPool.ProcessTransaction(split, false, false, 0)
+	require.NoError(err)
+	buildBlock()
+
+	feeRate := func(rate int64, delta int64) func(int64) int64 {
+		return func(vsize int64) int64 {
+			return rate*vsize + delta
+		}
+	}
+
+	// A transaction paying exactly the minimum gossip fee rate is accepted,
+	// but is below the minimum relay fee rate
+	atGossipRate := newTestFeeTx(t, key, split.MsgTx(), 0, feeRate(minGossipFeeRate, 0))
+	require.NoError(vm.btcSet.Add(NewTxGossip(atGossipRate)))
+	require.True(txPool.HaveTransaction(atGossipRate.Hash()))
+
+	// A transaction paying one satoshi less is dropped before validation and
+	// remembered as rejected
+	belowGossipRate := newTestFeeTx(t, key, split.MsgTx(), 1, feeRate(minGossipFeeRate, -1))
+	err = vm.btcSet.Add(NewTxGossip(belowGossipRate))
+	require.ErrorIs(err, errBelowMinGossipFeeRate)
+	require.False(txPool.HaveTransaction(belowGossipRate.Hash()))
+	reason, ok := vm.btcSet.rejected.Get(hashToID(belowGossipRate.Hash()))
+	require.True(ok)
+	require.Equal(wire.RejectInsufficientFee, reason)
+	require.ErrorIs(vm.btcSet.Add(NewTxGossip(belowGossipRate)), errRecentlyRejected)
+
+	// Transactions are gossiped to peers from the minimum relay fee rate
+	atRelayRate := newTestFeeTx(t, key, split.MsgTx(), 2, feeRate(minRelayFeeRate, 0))
+	belowRelayRate := newTestFeeTx(t, key, split.MsgTx(), 3, feeRate(minRelayFeeRate, -1))
+	for _, test := range []struct {
+		tx    *btcutil.Tx
+		relay bool
+	}{
+		{atRelayRate, true},
+		{belowRelayRate, false},
+	} {
+		accepted, err := txPool.ProcessTransaction(test.tx, false, false, 0)
+		require.NoError(err)
+		require.Len(accepted, 1)
+		require.Equal(test.relay, vm.shouldRelayTx(accepted[0]))
+	}
+	for _, txD := range txPool.TxDescs() {
+		if txD.Tx.Hash().IsEqual(atGossipRate.Hash()) {
+			require.False(vm.shouldRelayTx(txD))
+		}
+	}
+}
+
+func TestGossipConfigValidate(t *testing.T) {
+	require := require.New(t)
+
+	config := DefaultGossipConfig()
+	require.NoError(config.Validate())
+
+	config.PushGossipDiscardedSize = 0
+	require.NoError(config.Validate())
+	config.PushGossipDiscardedSize = -1
+	require.Error(config.Validate())
+
+	config = DefaultGossipConfig()
+	config.PushGossipTargetBytes = 0
+	require.Error(config.Validate())
+
+	config = DefaultGossipConfig()
+	config.PullGossipPollSize = 0
+	require.Error(config.Validate())
+
+	// Pull responses must fit a block of the max size
+	config = DefaultGossipConfig()
+	config.PullGossipTargetResponseBytes = maxGossipItemBytes
+	require.NoError(config.Validate())
+	config.PullGossipTargetResponseBytes = maxGossipItemBytes - 1
+	require.Error(config.Validate())
+
+	config = DefaultGossipConfig()
+	config.PushGossipFallbackNumPeers = 0
+	require.NoError(config.Validate())
+	config.PushGossipFallbackNumPeers = -1
+	require.Error(config.Validate())
+
+	config = DefaultGossipConfig()
+	config.BlockRegossipMaxAge = 0
+	require.Error(config.Validate())
+
+	config = DefaultGossipConfig()
+	config.BlockRegossipMaxDepth = 0
+	require.Error(config.Validate())
+
+	config = DefaultGossipConfig()
+	config.BlockHintStaleDepth = 0
+	require.Error(config.Validate())
+
+	config = DefaultGossipConfig()
+	config.BlockHintBehindDepth = -1
+	require.Error(config.Validate())
+
+	// Each item type is pushed to some validators or peers
+	config = DefaultGossipConfig()
+	config.BlockPushGossipNumValidators = 0
+	require.Error(config.Validate())
+	config.BlockPushGossipNumPeers = 5
+	require.NoError(config.Validate())
+
+	config = DefaultGossipConfig()
+	config.TxPushRegossipNumValidators = 0
+	require.Error(config.Validate())
+
+	// The non-validator peers of transactions only count once transactions
+	// are not gossiped to validators only
+	config = DefaultGossipConfig()
+	config.TxPushGossipNumValidators = 0
+	require.Error(config.Validate())
+	config.TxGossipValidatorsOnly = false
+	require.NoError(config.Validate())
+	config.TxPushRegossipNumPeers = 0
+	require.Error(config.Validate())
+
+	config = DefaultGossipConfig()
+	config.TxPushGossipNumPeers = -1
+	require.Error(config.Validate())
+}
+
+func TestGossipConfigPushParams(t *testing.T) {
+	require := require.New(t)
+
+	config := DefaultGossipConfig()
+	config.BlockPushGossipNumPeers = 2
+	txParams, txRegossipParams := config.pushParams(GossipItemTypeTx)
+	require.Equal(gossip.BranchingFactor{StakePercentage: 0.9, Validators: 100}, txParams)
+	require.Equal(gossip.BranchingFactor{Validators: 10}, txRegossipParams)
+	blockParams, blockRegossipParams := config.pushParams(GossipItemTypeBlock)
+	require.Equal(gossip.BranchingFactor{StakePercentage: 0.9, Validators: 100, NonValidators: 2}, blockParams)
+	require.Equal(gossip.BranchingFactor{Validators: 10}, blockRegossipParams)
+
+	// Transactions are pushed to non-validator peers once enabled
+	config.TxGossipValidatorsOnly = false
+	txParams, txRegossipParams = config.pushParams(GossipItemTypeTx)
+	require.Equal(gossip.BranchingFactor{StakePercentage: 0.9, Validators: 100, NonValidators: 10}, txParams)
+	require.Equal(gossip.BranchingFactor{Validators: 10, NonValidators: 3}, txRegossipParams)
+}
+
+func TestPullGossip(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vms := newTestVMs(t, 2, key)
+	server, client := vms[0], vms[1]
+
+	blk, err := server.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+
+	clientBlk, err := client.ParseBlock(ctx, blk.Bytes())
+	require.NoError(err)
+	require.NoError(clientBlk.Verify(ctx))
+	require.NoError(clientBlk.Accept(ctx))
+
+	coinbase := blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx()
+	tx := newTestSpend(t, key, coinbase)
+	_, err = server.btcdAdapter.TxMemPool().ProcessTransaction(tx, false, false, 0)
+	require.NoError(err)
+	require.NoError(server.SetState(ctx, snow.NormalOp))
+
+	// Push gossip is not routed, the mempool sync is disabled and the pull
+	// gossip loop is pushed out past the end of the test, so the transaction
+	// can only reach the client in the response to an explicit pull
+	client.gossipConfig.MempoolSyncEnabled = false
+	client.gossipConfig.PullGossipFrequency = time.Hour
+	require.NoError(client.SetState(ctx, snow.NormalOp))
+	require.False(client.btcdAdapter.TxMemPool().HaveTransaction(tx.Hash()))
+
+	require.NoError(client.pullGossiper.Gossip(ctx))
+	require.Eventually(func() bool {
+		return client.btcdAdapter.TxMemPool().HaveTransaction(tx.Hash())
+	}, 10*time.Second, 10*time.Millisecond)
+
+	// Disconnected peers are no longer sampled for requests
+	require.NoError(client.Disconnected(ctx, server.ctx.NodeID))
+	p2pClient := client.p2pNetwork.NewClient(BTCGossipHandlerID)
+	err = p2pClient.AppRequestAny(ctx, nil, func(context.Context, ids.NodeID, []byte, error) {})
+	require.ErrorIs(err, p2p.ErrNoPeers)
+}
+
+func TestWtxidGossip(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	// Two versions of a transaction differing by their witness share their
+	// txid but not their wtxid
+	variant := func(witness byte) *btcutil.Tx {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{0x01}, 0), nil, wire.TxWitness{{witness}}))
+		msgTx.AddTxOut(wire.NewTxOut(1, nil))
+		return btcutil.NewTx(msgTx)
+	}
+	first, second := variant(1), variant(2)
+	require.Equal(first.Hash(), second.Hash())
+
+	// Identified by txid, the second version is deduplicated as the first
+	require.Equal(NewTxGossip(first).GossipID(), NewTxGossip(second).GossipID())
+	witnessItem := func(tx *btcutil.Tx) *BTCGossip {
+		item := NewTxGossip(tx)
+		item.WitnessID = true
+		return item
+	}
+	require.Equal(hashToID(first.WitnessHash()), witnessItem(first).GossipID())
+	require.NotEqual(witnessItem(first).GossipID(), witnessItem(second).GossipID())
+
+	bloom, err := gossip.NewBloomFilter(prometheus.NewRegistry(), "test", 8192, 0.01, 0.05)
+	require.NoError(err)
+	bloom.Add(witnessItem(first))
+	require.True(bloom.Has(witnessItem(first)))
+	require.False(bloom.Has(witnessItem(second)))
+
+	// Transactions identified by wtxid are gossiped in their own envelope,
+	// parsed by every node, and identified the way the receiving node
+	// identifies transactions
+	witnessMarshaller := BTCGossipMarshaller{witnessIDs: true}
+	txidMarshaller := BTCGossipMarshaller{}
+	txBytes, err := witnessMarshaller.MarshalGossip(witnessItem(second))
+	require.NoError(err)
+	require.Equal(byte(GossipItemTypeTxV1), txBytes[0])
+	item, err := witnessMarshaller.UnmarshalGossip(txBytes)
+	require.NoError(err)
+	require.Equal(GossipItemTypeTx, item.ItemType)
+	require.Equal(hashToID(second.WitnessHash()), item.GossipID())
+	item, err = txidMarshaller.UnmarshalGossip(txBytes)
+	require.NoError(err)
+	require.Equal(hashToID(second.Hash()), item.GossipID())
+	txBytes, err = txidMarshaller.MarshalGossip(NewTxGossip(second))
+	require.NoError(err)
+	require.Equal(byte(GossipItemTypeTx), txBytes[0])
+
+	// Nodes gossiping by wtxid pull transactions from each other
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vms := newTestVMsWithConfig(t, 2, key, "", []byte(`{"wtxidGossip":true}`))
+	server, client := vms[0], vms[1]
+	blk, err := server.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+	clientBlk, err := client.ParseBlock(ctx, blk.Bytes())
+	require.NoError(err)
+	require.NoError(clientBlk.Verify(ctx))
+	require.NoError(clientBlk.Accept(ctx))
+
+	tx := newTestSpend(t, key, blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx())
+	_, err = server.btcdAdapter.TxMemPool().ProcessTransaction(tx, false, false, 0)
+	require.NoError(err)
+	require.NoError(server.SetState(ctx, snow.NormalOp))
+	require.True(server.btcSet.Has(hashToID(tx.WitnessHash())))
+
+	client.gossipConfig.MempoolSyncEnabled = false
+	client.gossipConfig.PullGossipFrequency = time.Hour
+	require.NoError(client.SetState(ctx, snow.NormalOp))
+	require.NoError(client.pullGossiper.Gossip(ctx))
+	require.Eventually(func() bool {
+		return client.btcdAdapter.TxMemPool().HaveTransaction(tx.Hash())
+	}, 10*time.Second, 10*time.Millisecond)
+	require.True(client.btcSet.inBloom(client.newTxGossip(tx)))
+}
+
+// testGossipSet is a gossip set serving a fixed list of items
+type testGossipSet struct {
+	items []*BTCGossip
+}
+
+func (*testGossipSet) Add(*BTCGossip) error {
+	return nil
+}
+
+func (*testGossipSet) Has(ids.ID) bool {
+	return false
+}
+
+func (s *testGossipSet) Iterate(f func(*BTCGossip) bool) {
+	for _, item := range s.items {
+		if !f(item) {
+			return
+		}
+	}
+}
+
+func (*testGossipSet) GetFilter() ([]byte, []byte) {
+	return nil, nil
+}
+
+func TestPullGossipResponseSize(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMs(t, 1, key)[0]
+	vm.gossipConfig.PullGossipTargetResponseBytes = 2 * maxGossipItemBytes
+	require.NoError(vm.gossipConfig.Validate())
+
+	// A block just below the max size, padded by the script of its coinbase
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex}})
+	msgTx.AddTxOut(wire.NewTxOut(0, make([]byte, blockchain.MaxBlockWeight-1000)))
+	msgBlock := wire.NewMsgBlock(&wire.BlockHeader{Version: 1})
+	require.NoError(msgBlock.AddTransaction(msgTx))
+	block := btcutil.NewBlock(msgBlock)
+	blockBytes, err := block.Bytes()
+	require.NoError(err)
+	require.Greater(len(blockBytes), blockchain.MaxBlockWeight-1000)
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: block.Transactions()[0].MsgTx().TxHash()}})
+	tx.AddTxOut(wire.NewTxOut(1, []byte{txscript.OP_TRUE}))
+	set := &testGossipSet{items: []*BTCGossip{
+		NewBlockGossip(block),
+		NewTxGossip(btcutil.NewTx(tx)),
+	}}
+	metrics, err := gossip.NewMetrics(prometheus.NewRegistry(), "test")
+	require.NoError(err)
+	handler := vm.newGossipHandler(set, metrics, &gossipStats{})
+
+	bloom, err := gossip.NewBloomFilter(prometheus.NewRegistry(), "test", 16, 0.01, 0.05)
+	require.NoError(err)
+	request, err := gossip.MarshalAppRequest(bloom.Marshal())
+	require.NoError(err)
+	responseBytes, appErr := handler.AppRequest(ctx, ids.EmptyNodeID, time.Time{}, request)
+	require.Nil(appErr)
+
+	// The block is delivered intact, leaving room for the transaction
+	response, err := gossip.ParseAppResponse(responseBytes)
+	require.NoError(err)
+	require.Len(response, 2)
+	item, err := (&BTCGossipMarshaller{}).UnmarshalGossip(response[0])
+	require.NoError(err)
+	require.Equal(GossipItemTypeBlock, item.ItemType)
+	gossipedBytes, err := item.Block.Bytes()
+	require.NoError(err)
+	require.Equal(blockBytes, gossipedBytes)
+	item, err = (&BTCGossipMarshaller{}).UnmarshalGossip(response[1])
+	require.NoError(err)
+	require.Equal(tx.TxHash(), *item.Tx.Hash())
+}
+
+func TestGossipMigrationHandlerIDs(t *testing.T) {
+	const (
+		migrationHandlerID    = 105
+		unregisteredHandlerID = 106
+	)
+
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vms := newTestVMsWithConfig(t, 2, key, "", []byte(`{"gossipMigrationHandlerIDs":[105]}`))
+	server, client := vms[0], vms[1]
+	require.NoError(server.SetState(ctx, snow.NormalOp))
+
+	bloom, err := gossip.NewBloomFilter(prometheus.NewRegistry(), "test", 16, 0.01, 0.05)
+	require.NoError(err)
+	request, err := gossip.MarshalAppRequest(bloom.Marshal())
+	require.NoError(err)
+
+	// requestPull sends a pull request to the server on handlerID and returns
+	// the error of the response
+	requestPull := func(handlerID uint64) error {
+		done := make(chan error, 1)
+		err := client.p2pNetwork.NewClient(handlerID).AppRequest(
+			ctx,
+			set.Of(server.ctx.NodeID),
+			request,
+			func(_ context.Context, _ ids.NodeID, _ []byte, err error) {
+				done <- err
+			},
+		)
+		require.NoError(err)
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(10 * time.Second):
+			require.FailNow("no response to pull request")
+			return nil
+		}
+	}
+
+	// Gossip is served on both the default and the migration handler IDs
+	require.NoError(requestPull(BTCGossipHandlerID))
+	require.NoError(requestPull(migrationHandlerID))
+	require.ErrorIs(requestPull(unregisteredHandlerID), p2p.ErrUnregisteredHandler)
+}
+
+func TestBloomFilterReset(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMs(t, 1, key)[0]
+	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+
+	// Replace the filter with one small enough to fill up quickly
+	vm.gossipConfig.BloomFilterSize = 16
+	bloom, err := newGossipBloomFilter(
+		prometheus.NewRegistry(),
+		"test",
+		vm.gossipConfig.BloomFilterSize,
+		vm.gossipConfig.BloomFalsePositiveRate,
+		vm.gossipConfig.BloomResetThreshold,
+	)
+	require.NoError(err)
+	set := vm.btcSet
+	set.lock.Lock()
+	set.bloom = bloom
+	set.bloomSize = vm.gossipConfig.BloomFilterSize
+	set.bloomCount = 0
+	set.lock.Unlock()
+
+	info := set.bloomInfo()
+	require.Zero(info.Elements)
+	require.Zero(info.Resets)
+	require.Equal(int64(16), info.Size)
+	require.Positive(info.MaxElements)
+
+	set.lock.Lock()
+	for i := int64(0); i <= info.MaxElements; i++ {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		msgTx.LockTime = uint32(i)
+		set.addToBloom(NewTxGossip(btcutil.NewTx(msgTx)))
+	}
+	set.lock.Unlock()
+
+	// The filter was reset once it held more elements than its false positive
+	// rate allows, and only holds the elements added since
+	info = set.bloomInfo()
+	require.Equal(uint64(1), info.Resets)
+	require.Less(info.Elements, info.MaxElements)
+}
+
+func TestBloomSaltRotation(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMs(t, 1, key)[0]
+	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+	buildTestChain(t, vm, 1)
+	blk, err := vm.GetBlock(ctx, vm.lastAccepted)
+	require.NoError(err)
+	block := blk.(*BlockAdapter).btcBlock
+
+	// The set knows a mempool transaction and a block
+	set := vm.btcSet
+	txItem := vm.newTxGossip(newTestSpend(t, key, block.Transactions()[0].MsgTx()))
+	require.NoError(set.Add(txItem))
+	blockItem := NewBlockGossip(block)
+	require.NoError(set.Add(blockItem))
+
+	// pull returns the items a peer holding both responds with to a pull
+	// request carrying the filter of the set
+	metrics, err := gossip.NewMetrics(prometheus.NewRegistry(), "test")
+	require.NoError(err)
+	peer := vm.newGossipHandler(&testGossipSet{items: []*BTCGossip{blockItem, txItem}}, metrics, &gossipStats{})
+	marshaller := vm.gossipMarshaller()
+	pull := func() []*BTCGossip {
+		request, err := gossip.MarshalAppRequest(set.GetFilter())
+		require.NoError(err)
+		responseBytes, appErr := peer.AppRequest(ctx, ids.EmptyNodeID, time.Time{}, request)
+		require.Nil(appErr)
+		response, err := gossip.ParseAppResponse(responseBytes)
+		require.NoError(err)
+		items := make([]*BTCGossip, 0, len(response))
+		for _, itemBytes := range response {
+			item, err := marshaller.UnmarshalGossip(itemBytes)
+			require.NoError(err)
+			items = append(items, item)
+		}
+		return items
+	}
+	require.Empty(pull())
+
+	// The rotation changes the salt and keeps the mempool transactions
+	_, salt := set.GetFilter()
+	set.rotateBloom()
+	_, rotatedSalt := set.GetFilter()
+	require.NotEqual(salt, rotatedSalt)
+	info := set.bloomInfo()
+	require.Equal(uint64(1), info.Resets)
+	require.Equal(uint64(1), info.Rotations)
+
+	// The block dropped from the filter is pulled again, found known and
+	// added back to the filter
+	pulled := pull()
+	require.Len(pulled, 1)
+	require.Equal(blockItem.GossipID(), pulled[0].GossipID())
+	require.True(set.Has(pulled[0].GossipID()))
+	require.NoError(set.Add(pulled[0]))
+	require.Empty(pull())
+}
+
+func TestBlockRegossipWindow(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMs(t, 2, key)[0]
+	clock := &mockable.Clock{}
+	clock.Set(time.Now())
+	vm.Clock = clock
+
+	// The push gossip loop is pushed out past the end of the test, so the
+	// pushed blocks are only gossiped by the test
+	vm.gossipConfig.PushGossipFrequency = time.Hour
+	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+
+	// relayedTip builds a block and waits for it to be pushed
+	relayedTip := func() ids.ID {
+		buildTestChain(t, vm, 1)
+		tip := hashToID(&vm.chain.BestSnapshot().Hash)
+		require.Eventually(func() bool {
+			_, ok := vm.relaySet.relayed.Get(tip)
+			return ok
+		}, 10*time.Second, 10*time.Millisecond)
+		return tip
+	}
+
+	// A block is regossiped within the window. Its push fails, as push
+	// gossip is not routed between the test VMs, but queues it for regossip.
+	old := relayedTip()
+	require.Error(vm.pushGossiper.Load().Gossip(ctx))
+	require.True(vm.relaySet.Has(old))
+	require.Zero(testutil.ToFloat64(vm.relaySet.suppressed))
+
+	// and stops being regossiped once it was first pushed too long ago,
+	// while it can still be requested
+	clock.Set(clock.Time().Add(vm.gossipConfig.BlockRegossipMaxAge + time.Second))
+	require.NoError(vm.pushGossiper.Load().Gossip(ctx))
+	require.Equal(float64(1), testutil.ToFloat64(vm.relaySet.suppressed))
+	require.True(vm.btcSet.Has(old))
+
+	// The push gossiper no longer tracks it, so it is not suppressed again
+	require.NoError(vm.pushGossiper.Load().Gossip(ctx))
+	require.Equal(float64(1), testutil.ToFloat64(vm.relaySet.suppressed))
+
+	// A block also stops being regossiped once it is too deep below the
+	// accepted tip
+	vm.relaySet.maxDepth = 1
+	deep := relayedTip()
+	relayedTip()
+	require.True(vm.relaySet.Has(deep))
+	relayedTip()
+	require.False(vm.relaySet.Has(deep))
+	require.Equal(float64(2), testutil.ToFloat64(vm.relaySet.suppressed))
+}
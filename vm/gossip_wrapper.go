@@ -14,17 +14,29 @@ import (
 // both transactions and blocks.
 type BTCGossip struct {
 	ItemType GossipItemType
-	Tx       *btcutil.Tx     // non-nil if ItemType == GossipItemTypeTx
-	Block    *btcutil.Block  // non-nil if ItemType == GossipItemTypeBlock
+	Tx       *btcutil.Tx    // non-nil if ItemType == GossipItemTypeTx
+	Block    *btcutil.Block // non-nil if ItemType == GossipItemTypeBlock
+	Hints    *BlockHints    // non-nil if the block was gossiped with height hints
+
+	// WitnessID identifies the transaction by its wtxid rather than its txid
+	WitnessID bool
+
+	// Sender is the peer which pushed the item, or empty if the item was
+	// pulled from a peer or submitted by a client
+	Sender ids.NodeID
 }
 
 // GossipID returns the unique identifier for this gossip item.
-// For transactions, this is the transaction hash.
+// For transactions, this is the transaction hash, or the witness hash if
+// WitnessID is set.
 // For blocks, this is the block hash.
 func (g *BTCGossip) GossipID() ids.ID {
 	switch g.ItemType {
 	case GossipItemTypeTx:
 		if g.Tx != nil {
+			if g.WitnessID {
+				return hashToID(g.Tx.WitnessHash())
+			}
 			return hashToID(g.Tx.Hash())
 		}
 	case GossipItemTypeBlock:
@@ -56,6 +68,14 @@ func NewTxGossip(tx *btcutil.Tx) *BTCGossip {
 	}
 }
 
+// newTxGossip returns the gossip item of tx, identified by its wtxid if the
+// node gossips transactions by wtxid
+func (vm *VM) newTxGossip(tx *btcutil.Tx) *BTCGossip {
+	item := NewTxGossip(tx)
+	item.WitnessID = vm.nodeConfig.WtxidGossip
+	return item
+}
+
 // NewBlockGossip creates a new BTCGossip wrapper for a block
 func NewBlockGossip(block *btcutil.Block) *BTCGossip {
 	return &BTCGossip{
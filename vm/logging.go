@@ -0,0 +1,235 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/btcsuite/btclog"
+	"go.uber.org/zap"
+)
+
+var _ btcd.LogSink = (*btcdLogSink)(nil)
+
+// Subsystems whose log levels are set by the logging config and the
+// setloglevel RPC
+const (
+	logSubsystemMempool = "mempool"
+	logSubsystemChain   = "chain"
+	logSubsystemRPC     = "rpc"
+	logSubsystemGossip  = "gossip"
+	logSubsystemBuilder = "builder"
+)
+
+var (
+	errUnknownLogSubsystem = errors.New("unknown log subsystem")
+	errUnsupportedLogLevel = errors.New("unsupported log level")
+)
+
+// btcdLogName is the name of the logger of the btcd subsystems, which key
+// their logs by their btcd subsystem ID
+const btcdLogName = "btcd"
+
+// btcdLogSubsystems are the btcd subsystems logging for the mempool, chain and
+// rpc subsystems
+var btcdLogSubsystems = map[string]string{
+	logSubsystemMempool: "TXMP",
+	logSubsystemChain:   "CHAN",
+	logSubsystemRPC:     "RPCS",
+}
+
+// btcdLogLevels are the btcd log levels of the node log levels. btcd has no
+// level between debug and info, so trace logs at debug.
+var btcdLogLevels = map[logging.Level]string{
+	logging.Verbo: "trace",
+	logging.Debug: "debug",
+	logging.Trace: "debug",
+	logging.Info:  "info",
+	logging.Warn:  "warn",
+	logging.Error: "error",
+	logging.Fatal: "critical",
+}
+
+// LoggingConfig sets the log levels of the subsystems of the VM, from verbo
+// to fatal. Subsystems without a level keep the btcd debugLevel for the btcd
+// subsystems and the level of the VM log for the others.
+type LoggingConfig struct {
+	// Mempool, Chain and RPC set the levels of the btcd mempool, block chain
+	// and RPC server
+	Mempool string `json:"mempool"`
+	Chain   string `json:"chain"`
+	RPC     string `json:"rpc"`
+
+	// Gossip and Builder set the levels of the gossip of transactions and
+	// blocks and of block building
+	Gossip  string `json:"gossip"`
+	Builder string `json:"builder"`
+}
+
+// levels returns the configured levels keyed by subsystem
+func (c *LoggingConfig) levels() map[string]string {
+	levels := make(map[string]string)
+	for subsystem, level := range map[string]string{
+		logSubsystemMempool: c.Mempool,
+		logSubsystemChain:   c.Chain,
+		logSubsystemRPC:     c.RPC,
+		logSubsystemGossip:  c.Gossip,
+		logSubsystemBuilder: c.Builder,
+	} {
+		if level != "" {
+			levels[subsystem] = level
+		}
+	}
+	return levels
+}
+
+// Validate checks if the levels are valid
+func (c *LoggingConfig) Validate() error {
+	for subsystem, level := range c.levels() {
+		if _, err := parseLogLevel(level); err != nil {
+			return fmt.Errorf("invalid %s log level: %w", subsystem, err)
+		}
+	}
+	return nil
+}
+
+// parseLogLevel parses the log level of a subsystem. Levels btcd cannot log
+// at are not supported.
+func parseLogLevel(levelStr string) (logging.Level, error) {
+	level, err := logging.ToLevel(levelStr)
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := btcdLogLevels[level]; !ok {
+		return 0, fmt.Errorf("%w: %q", errUnsupportedLogLevel, levelStr)
+	}
+	return level, nil
+}
+
+// logWriter writes the logs of the subsystem loggers to the VM log, which is
+// closed by the node rather than by the subsystem loggers
+type logWriter struct {
+	io.Writer
+}
+
+func (logWriter) Close() error {
+	return nil
+}
+
+// newSubsystemLogger returns the logger of a subsystem of the VM at a level of
+// its own, writing to w, which is the VM log outside of tests
+func newSubsystemLogger(w io.Writer, subsystem string, level logging.Level) logging.Logger {
+	return logging.NewLogger(subsystem, logging.NewWrappedCore(
+		level,
+		logWriter{Writer: w},
+		logging.Plain.ConsoleEncoder(),
+	))
+}
+
+// logLevel returns the lowest level log logs at
+func logLevel(log logging.Logger) logging.Level {
+	for level := logging.Verbo; level < logging.Off; level++ {
+		if log.Enabled(level) {
+			return level
+		}
+	}
+	return logging.Off
+}
+
+// btcdLogSink writes the logs of the btcd subsystems to log, keyed by their
+// subsystem ID. The btcd subsystems filter their logs by levels of their own,
+// so log logs at every level.
+type btcdLogSink struct {
+	log logging.Logger
+}
+
+func (s *btcdLogSink) Log(subsystemID string, level btclog.Level, msg string) {
+	subsystem := zap.String("subsystem", subsystemID)
+	switch level {
+	case btclog.LevelTrace:
+		s.log.Verbo(msg, subsystem)
+	case btclog.LevelDebug:
+		s.log.Debug(msg, subsystem)
+	case btclog.LevelInfo:
+		s.log.Info(msg, subsystem)
+	case btclog.LevelWarn:
+		s.log.Warn(msg, subsystem)
+	case btclog.LevelError:
+		s.log.Error(msg, subsystem)
+	default:
+		s.log.Fatal(msg, subsystem)
+	}
+}
+
+// initializeNodeLog routes the logs of the btcd subsystems to the VM log,
+// rather than to the btcd log files, and lets the plugin process route its
+// own logs there too, so that the process logs in a single format to the log
+// of the node. It must be called before btcd starts logging.
+func (vm *VM) initializeNodeLog() {
+	log := vm.ctx.Log
+	vm.nodeLog.Store(&log)
+	vm.btcdLogSink = &btcdLogSink{
+		log: newSubsystemLogger(vm.ctx.Log, btcdLogName, logging.Verbo),
+	}
+	btcd.SetLogSink(vm.btcdLogSink)
+}
+
+// NodeLog returns the log of the node running the VM, or nil before the VM is
+// initialized
+func (vm *VM) NodeLog() logging.Logger {
+	if log := vm.nodeLog.Load(); log != nil {
+		return *log
+	}
+	return nil
+}
+
+// initializeLogging creates the loggers of the gossip and builder subsystems,
+// sets the levels of the logging config and lets the setloglevel RPC change
+// them. It must be called before the subsystems start logging.
+func (vm *VM) initializeLogging() error {
+	level := logLevel(vm.ctx.Log)
+	vm.gossipLog = newSubsystemLogger(vm.ctx.Log, logSubsystemGossip, level)
+	vm.builderLog = newSubsystemLogger(vm.ctx.Log, logSubsystemBuilder, level)
+
+	for subsystem, level := range vm.nodeConfig.Logging.levels() {
+		if err := vm.setLogLevel(subsystem, level); err != nil {
+			return fmt.Errorf("failed to set %s log level: %w", subsystem, err)
+		}
+	}
+	vm.btcdAdapter.SetLogLevel(vm.setLogLevel)
+	return nil
+}
+
+// setLogLevel sets the log level of a subsystem
+func (vm *VM) setLogLevel(subsystem string, levelStr string) error {
+	level, err := parseLogLevel(levelStr)
+	if err != nil {
+		return err
+	}
+
+	switch subsystem {
+	case logSubsystemGossip:
+		vm.gossipLog.SetLevel(level)
+	case logSubsystemBuilder:
+		vm.builderLog.SetLevel(level)
+	default:
+		btcdSubsystem, ok := btcdLogSubsystems[subsystem]
+		if !ok {
+			return fmt.Errorf("%w: %q", errUnknownLogSubsystem, subsystem)
+		}
+		if err := btcd.SetDebugLevels(btcdSubsystem + "=" + btcdLogLevels[level]); err != nil {
+			return err
+		}
+	}
+
+	vm.ctx.Log.Info("Log level changed",
+		zap.String("subsystem", subsystem),
+		zap.Stringer("level", level),
+	)
+	return nil
+}
@@ -0,0 +1,175 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/btcsuite/btclog"
+	"github.com/stretchr/testify/require"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+)
+
+func TestSubsystemLogLevel(t *testing.T) {
+	require := require.New(t)
+
+	var gossipLogs, builderLogs bytes.Buffer
+	vm := &VM{
+		ctx:        &snow.Context{Log: logging.NoLog{}},
+		gossipLog:  newSubsystemLogger(&gossipLogs, logSubsystemGossip, logging.Info),
+		builderLog: newSubsystemLogger(&builderLogs, logSubsystemBuilder, logging.Info),
+	}
+
+	vm.gossipLog.Debug("hidden gossip")
+	vm.builderLog.Debug("hidden builder")
+	require.Zero(gossipLogs.Len())
+	require.Zero(builderLogs.Len())
+
+	// Changing the level of a subsystem does not change the others
+	require.NoError(vm.setLogLevel(logSubsystemGossip, "debug"))
+	vm.gossipLog.Debug("shown gossip")
+	vm.builderLog.Debug("hidden builder")
+	require.Contains(gossipLogs.String(), "shown gossip")
+	require.Contains(gossipLogs.String(), logSubsystemGossip)
+	require.NotContains(gossipLogs.String(), "hidden")
+	require.Zero(builderLogs.Len())
+
+	require.NoError(vm.setLogLevel(logSubsystemGossip, "error"))
+	vm.gossipLog.Warn("hidden warning")
+	require.NotContains(gossipLogs.String(), "hidden warning")
+
+	require.ErrorIs(vm.setLogLevel("network", "debug"), errUnknownLogSubsystem)
+	require.ErrorIs(vm.setLogLevel(logSubsystemBuilder, "off"), errUnsupportedLogLevel)
+	require.ErrorIs(vm.setLogLevel(logSubsystemBuilder, "loud"), logging.ErrUnknownLevel)
+}
+
+func TestSetLogLevelRPC(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	// The btcd loggers are shared by all VMs of the process, which log at
+	// info by default
+	t.Cleanup(func() {
+		for _, subsystem := range btcdLogSubsystems {
+			require.NoError(btcd.SetDebugLevels(subsystem + "=info"))
+		}
+	})
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	configBytes := []byte(`{"logging":{"mempool":"debug","builder":"warn"}}`)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, configBytes)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+
+	requireBtcdLevel := func(subsystem string, expected btclog.Level) {
+		level, err := btcd.LogLevel(btcdLogSubsystems[subsystem])
+		require.NoError(err)
+		require.Equal(expected, level, subsystem)
+	}
+	requireBtcdLevel(logSubsystemMempool, btclog.LevelDebug)
+	require.True(vm.builderLog.Enabled(logging.Warn))
+	require.False(vm.builderLog.Enabled(logging.Info))
+
+	var result interface{}
+	callRPC(t, handlers["/rpc"], "setloglevel", []interface{}{logSubsystemChain, "verbo"}, &result)
+	requireBtcdLevel(logSubsystemChain, btclog.LevelTrace)
+	callRPC(t, handlers["/rpc"], "setloglevel", []interface{}{logSubsystemMempool, "fatal"}, &result)
+	requireBtcdLevel(logSubsystemMempool, btclog.LevelCritical)
+	callRPC(t, handlers["/rpc"], "setloglevel", []interface{}{logSubsystemBuilder, "debug"}, &result)
+	require.True(vm.builderLog.Enabled(logging.Debug))
+
+	for _, params := range [][]interface{}{
+		{"network", "debug"},
+		{logSubsystemRPC, "loud"},
+	} {
+		request, err := json.Marshal(map[string]interface{}{
+			"jsonrpc": "1.0",
+			"id":      1,
+			"method":  "setloglevel",
+			"params":  params,
+		})
+		require.NoError(err)
+		var response batchResponse
+		require.NoError(json.Unmarshal(postRPC(handlers["/rpc"], string(request)).Body.Bytes(), &response))
+		require.NotNil(response.Error, params)
+		require.Equal(btcjson.ErrRPCInvalidParameter, response.Error.Code, params)
+	}
+}
+
+// syncBuffer is a buffer safe for the concurrent writes of loggers
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func TestBtcdLogSink(t *testing.T) {
+	require := require.New(t)
+
+	t.Cleanup(func() {
+		require.NoError(btcd.SetDebugLevels(btcdLogSubsystems[logSubsystemMempool] + "=info"))
+	})
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMs(t, 1, key)[0]
+	buildTestChain(t, vm, 2)
+	blk, err := vm.GetBlock(context.Background(), vm.lastAccepted)
+	require.NoError(err)
+	parentBlk, err := vm.GetBlock(context.Background(), blk.Parent())
+	require.NoError(err)
+
+	// The VM routes the btcd logs to the node log, which logs at info
+	var logs syncBuffer
+	nodeLog := logging.NewLogger("", logging.NewWrappedCore(logging.Info, logWriter{Writer: &logs}, logging.Plain.ConsoleEncoder()))
+	vm.ctx.Log = nodeLog
+	vm.initializeNodeLog()
+	require.Equal(nodeLog, vm.NodeLog())
+
+	// Mempool logs below the level of the mempool are dropped
+	require.NoError(vm.setLogLevel(logSubsystemMempool, "info"))
+	mempool := vm.btcdAdapter.TxMemPool()
+	spend := newTestSpend(t, key, parentBlk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx())
+	_, err = mempool.ProcessTransaction(spend, false, false, 0)
+	require.NoError(err)
+	require.NotContains(logs.String(), spend.Hash().String())
+
+	// Mempool logs at its level are written to the node log, keyed by the
+	// btcd subsystem, whatever the level of the node log
+	require.NoError(vm.setLogLevel(logSubsystemMempool, "debug"))
+	spend = newTestSpend(t, key, blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx())
+	_, err = mempool.ProcessTransaction(spend, false, false, 0)
+	require.NoError(err)
+	require.Contains(logs.String(), "Accepted transaction "+spend.Hash().String())
+	require.Contains(logs.String(), btcdLogName)
+	require.Contains(logs.String(), `"subsystem": "TXMP"`)
+
+	// A VM shutting down leaves the sink of another VM in place
+	btcd.RemoveLogSink(&btcdLogSink{log: logging.NoLog{}})
+	spend = newTestSpend(t, key, spend.MsgTx())
+	_, err = mempool.ProcessTransaction(spend, false, false, 0)
+	require.NoError(err)
+	require.Contains(logs.String(), "Accepted transaction "+spend.Hash().String())
+}
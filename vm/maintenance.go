@@ -0,0 +1,141 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	btcdb "github.com/MetalBlockchain/btcvm/btcd/database"
+)
+
+// defaultMaintenanceIntervalHours is how often the maintenance runs by default
+const defaultMaintenanceIntervalHours = 24
+
+// maintenanceRetryInterval is how long a maintenance postponed because of the
+// mempool activity waits before checking the mempool again
+const maintenanceRetryInterval = time.Minute
+
+var errMaintenanceRunning = errors.New("maintenance is already running")
+
+// maintenance runs the database maintenance, of which at most one runs at a
+// time
+type maintenance struct {
+	lock sync.Mutex
+
+	// compact compacts the chain database. It is nil if the database
+	// backend doesn't support compaction.
+	compact func() error
+
+	duration *prometheus.HistogramVec
+}
+
+// initializeMaintenance registers the maintenance metrics and schedules the
+// maintenance until shutdown, unless it is disabled. The maintenance can still
+// be run with the runmaintenance RPC.
+func (vm *VM) initializeMaintenance() error {
+	vm.maintenance.duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "maintenance_duration",
+		Help:    "time in seconds taken by the steps of the database maintenance",
+		Buckets: []float64{.01, .1, .5, 1, 5, 10, 30, 60, 300, 900},
+	}, []string{"step"})
+	if err := vm.metrics.Register(vm.maintenance.duration); err != nil {
+		return fmt.Errorf("failed to register maintenance metrics: %w", err)
+	}
+	if compacter, ok := vm.btcdAdapter.DB().(btcdb.Compacter); ok {
+		vm.maintenance.compact = compacter.Compact
+	}
+	vm.btcdAdapter.SetRunMaintenance(vm.runMaintenance)
+
+	if vm.nodeConfig.MaintenanceIntervalHours == 0 {
+		return nil
+	}
+	interval := time.Duration(vm.nodeConfig.MaintenanceIntervalHours) * time.Hour
+	vm.scheduleMaintenance(interval, maintenanceRetryInterval)
+	return nil
+}
+
+// scheduleMaintenance runs the maintenance every interval until shutdown. A
+// maintenance due while the mempool is busy is retried every retry until the
+// mempool quiets down.
+func (vm *VM) scheduleMaintenance(interval, retry time.Duration) {
+	vm.shutdownWg.Add(1)
+	go func() {
+		defer vm.shutdownWg.Done()
+
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+			case <-vm.shutdownChan:
+				return
+			}
+
+			if !vm.maintenanceIdle() {
+				timer.Reset(retry)
+				continue
+			}
+			if _, err := vm.runMaintenance(); err != nil {
+				vm.ctx.Log.Warn("Scheduled maintenance failed", zap.Error(err))
+			}
+			timer.Reset(interval)
+		}
+	}()
+}
+
+// maintenanceIdle returns whether the mempool is quiet enough for the
+// scheduled maintenance to run
+func (vm *VM) maintenanceIdle() bool {
+	maxTxs := vm.nodeConfig.MaintenanceMaxMempoolTxs
+	return maxTxs == 0 || vm.btcdAdapter.TxMemPool().Count() <= maxTxs
+}
+
+// runMaintenance flushes the UTXO cache and compacts the chain database. No
+// block is built or verified meanwhile, so that the chain state doesn't change
+// under the flush.
+func (vm *VM) runMaintenance() (*btcjson.RunMaintenanceResult, error) {
+	if !vm.maintenance.lock.TryLock() {
+		return nil, errMaintenanceRunning
+	}
+	defer vm.maintenance.lock.Unlock()
+
+	vm.buildBlockLock.Lock()
+	defer vm.buildBlockLock.Unlock()
+	vm.blocksMu.Lock()
+	defer vm.blocksMu.Unlock()
+
+	start := time.Now()
+	if err := vm.chain.FlushUtxoCache(blockchain.FlushRequired); err != nil {
+		return nil, fmt.Errorf("failed to flush UTXO cache: %w", err)
+	}
+	flushDuration := time.Since(start)
+	vm.maintenance.duration.WithLabelValues("flush").Observe(flushDuration.Seconds())
+	result := &btcjson.RunMaintenanceResult{FlushDuration: flushDuration.Seconds()}
+
+	if vm.maintenance.compact != nil {
+		start = time.Now()
+		if err := vm.maintenance.compact(); err != nil {
+			return nil, fmt.Errorf("failed to compact database: %w", err)
+		}
+		compactDuration := time.Since(start)
+		vm.maintenance.duration.WithLabelValues("compact").Observe(compactDuration.Seconds())
+		result.Compacted = true
+		result.CompactDuration = compactDuration.Seconds()
+	}
+
+	vm.ctx.Log.Info("Ran maintenance",
+		zap.Duration("flushDuration", flushDuration),
+		zap.Bool("compacted", result.Compacted),
+		zap.Float64("compactDuration", result.CompactDuration),
+	)
+	return result, nil
+}
@@ -0,0 +1,100 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+)
+
+func TestRunMaintenance(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, nil)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	buildTestChain(t, vm, 2)
+
+	// The ffldb database is compacted, and the durations of both steps are
+	// recorded
+	var result btcjson.RunMaintenanceResult
+	callRPC(t, handlers["/rpc"], "runmaintenance", nil, &result)
+	require.True(result.Compacted)
+	require.Equal(2, testutil.CollectAndCount(vm.maintenance.duration, "maintenance_duration"))
+
+	// No block is built while the database is compacted, and the maintenance
+	// is not run twice at the same time
+	compacting := make(chan struct{})
+	release := make(chan struct{})
+	vm.maintenance.compact = func() error {
+		close(compacting)
+		<-release
+		return nil
+	}
+	maintenanceDone := make(chan error, 1)
+	go func() {
+		_, err := vm.runMaintenance()
+		maintenanceDone <- err
+	}()
+	<-compacting
+
+	var built atomic.Bool
+	go func() {
+		blk, err := vm.BuildBlock(ctx)
+		if err == nil && blk.Accept(ctx) == nil {
+			built.Store(true)
+		}
+	}()
+	require.Never(built.Load, 100*time.Millisecond, 10*time.Millisecond)
+	_, err = vm.runMaintenance()
+	require.ErrorIs(err, errMaintenanceRunning)
+
+	close(release)
+	require.NoError(<-maintenanceDone)
+	require.Eventually(built.Load, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestScheduledMaintenance(t *testing.T) {
+	require := require.New(t)
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	configBytes := []byte(`{"maintenanceIntervalHours":0,"maintenanceMaxMempoolTxs":1}`)
+	vm := newTestVMsWithConfig(t, 1, key, "", configBytes)[0]
+	buildTestChain(t, vm, 2)
+
+	var runs atomic.Int32
+	vm.maintenance.compact = func() error {
+		runs.Add(1)
+		return nil
+	}
+
+	// The maintenance is postponed while the mempool holds more
+	// transactions than allowed
+	mempool := vm.btcdAdapter.TxMemPool()
+	for _, blk := range acceptedBlocks(t, vm) {
+		prevTx := blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx()
+		_, err := mempool.ProcessTransaction(newTestSpend(t, key, prevTx), false, false, 0)
+		require.NoError(err)
+	}
+	require.False(vm.maintenanceIdle())
+	vm.scheduleMaintenance(10*time.Millisecond, 10*time.Millisecond)
+	require.Never(func() bool { return runs.Load() > 0 }, 100*time.Millisecond, 10*time.Millisecond)
+
+	// Once the transactions are mined, the maintenance runs on schedule
+	buildTestChain(t, vm, 1)
+	require.Zero(mempool.Count())
+	require.Eventually(func() bool { return runs.Load() > 1 }, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,125 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MetalBlockchain/metalgo/snow/consensus/snowman"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/MetalBlockchain/btcvm/vm/vmtest"
+)
+
+// coinbaseHash returns the hash of the coinbase transaction of blk
+func coinbaseHash(t *testing.T, blk snowman.Block) chainhash.Hash {
+	var msgBlock wire.MsgBlock
+	require.NoError(t, msgBlock.Deserialize(bytes.NewReader(blk.Bytes())))
+	return msgBlock.Transactions[0].TxHash()
+}
+
+// getTxOut returns the gettxout result of the first output of the
+// transaction txHash, which is nil if it is not unspent
+func getTxOut(t *testing.T, handler http.Handler, txHash chainhash.Hash) *btcjson.GetTxOutResult {
+	require := require.New(t)
+
+	request, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "1.0",
+		"id":      1,
+		"method":  "gettxout",
+		"params":  []interface{}{txHash.String(), 0},
+	})
+	require.NoError(err)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/rpc", bytes.NewReader(request)))
+	require.Equal(http.StatusOK, recorder.Code)
+
+	var response struct {
+		Result *btcjson.GetTxOutResult `json:"result"`
+		Error  *btcjson.RPCError       `json:"error"`
+	}
+	require.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Nil(response.Error)
+	return response.Result
+}
+
+func TestParseBlockTrailingBytes(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	server, client := vmtest.NewMemVM(t), vmtest.NewMemVM(t)
+
+	blk, err := server.BuildBlock(ctx)
+	require.NoError(err)
+
+	blkBytes := append(blk.Bytes()[:len(blk.Bytes()):len(blk.Bytes())], 0x00)
+	_, err = client.ParseBlock(ctx, blkBytes)
+	require.Error(err)
+}
+
+func TestMemDBReorg(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	// The VMs mine to different keys, so that their blocks differ at the
+	// same heights
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	otherKey, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	configBytes := []byte(`{"rpcAuth":{"noAuth":true}}`)
+	vm := vmtest.NewMemVMWithConfig(t, key, configBytes)
+	competitor := vmtest.NewMemVMWithConfig(t, otherKey, configBytes)
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	_, err = competitor.CreateHandlers(ctx)
+	require.NoError(err)
+
+	// vm builds A1, which is not accepted yet
+	a1, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(a1.Verify(ctx))
+	require.NoError(vm.SetPreference(ctx, a1.ID()))
+	require.NotNil(getTxOut(t, handlers["/rpc"], coinbaseHash(t, a1)))
+
+	// The competitor builds B1 and B2 on the same parent
+	vmtest.BuildChain(t, competitor, 2)
+	var forkB []snowman.Block
+	for height := uint64(1); height <= 2; height++ {
+		blkID, err := competitor.GetBlockIDAtHeight(ctx, height)
+		require.NoError(err)
+		blk, err := competitor.GetBlock(ctx, blkID)
+		require.NoError(err)
+
+		// B2 gives the competing fork more work, so btcd reorganizes onto
+		// it
+		parsed, err := vm.ParseBlock(ctx, blk.Bytes())
+		require.NoError(err)
+		require.NoError(parsed.Verify(ctx))
+		forkB = append(forkB, parsed)
+	}
+
+	require.NoError(vm.SetPreference(ctx, forkB[1].ID()))
+	require.NoError(forkB[0].Accept(ctx))
+	require.NoError(a1.Reject(ctx))
+	require.NoError(forkB[1].Accept(ctx))
+	lastAccepted, err := vm.LastAccepted(ctx)
+	require.NoError(err)
+	require.Equal(forkB[1].ID(), lastAccepted)
+
+	// The UTXO set in memory reverted the disconnected block
+	require.Nil(getTxOut(t, handlers["/rpc"], coinbaseHash(t, a1)))
+	for _, blk := range forkB {
+		require.NotNil(getTxOut(t, handlers["/rpc"], coinbaseHash(t, blk)))
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/mempool"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+)
+
+// mempoolExpiryInterval is how often the mempool is swept for expired
+// transactions
+const mempoolExpiryInterval = 10 * time.Minute
+
+// defaultMempoolExpiryHours is how long transactions stay in the mempool by
+// default, two weeks as with bitcoind
+const defaultMempoolExpiryHours = 14 * 24
+
+// initializeMempoolEviction registers the metrics of the transactions evicted
+// from the mempool because it is full or expired, and starts sweeping the
+// mempool for expired transactions until shutdown
+func (vm *VM) initializeMempoolEviction() error {
+	vm.txsEvicted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mempool_txs_evicted",
+		Help: "number of transactions evicted from the mempool because it is full or expired",
+	}, []string{"reason"})
+	if err := vm.metrics.Register(vm.txsEvicted); err != nil {
+		return fmt.Errorf("failed to register mempool eviction metrics: %w", err)
+	}
+	vm.btcdAdapter.SetOnTxEvicted(vm.txEvicted)
+
+	if vm.nodeConfig.MempoolExpiryHours == 0 {
+		return nil
+	}
+	vm.shutdownWg.Add(1)
+	go func() {
+		defer vm.shutdownWg.Done()
+
+		ticker := time.NewTicker(mempoolExpiryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				vm.expireMempoolTxs()
+			case <-vm.shutdownChan:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// expireMempoolTxs evicts the transactions which stayed in the mempool longer
+// than the expiry
+func (vm *VM) expireMempoolTxs() {
+	expiry := time.Duration(vm.nodeConfig.MempoolExpiryHours) * time.Hour
+	if evicted := vm.btcdAdapter.TxMemPool().Expire(vm.Clock.Time().Add(-expiry)); evicted > 0 {
+		vm.gossipLog.Info("Expired mempool transactions",
+			zap.Int("evicted", evicted),
+			zap.Duration("expiry", expiry),
+		)
+	}
+}
+
+// txEvicted records that tx was evicted from the mempool. The transaction is
+// marked as rejected and added to the bloom filter, so that it is not pulled
+// from peers again right away. It is called with the mempool lock held.
+func (vm *VM) txEvicted(tx *btcutil.Tx, reason mempool.TxEvictionReason) {
+	vm.txsEvicted.WithLabelValues(string(reason)).Inc()
+	vm.gossipLog.Debug("Evicted mempool transaction",
+		zap.Stringer("txID", tx.Hash()),
+		zap.String("reason", string(reason)),
+	)
+
+	btcSet := vm.btcSet
+	if btcSet == nil {
+		return
+	}
+	btcSet.rejected.Put(wire.RejectInsufficientFee, hashToID(tx.Hash()), hashToID(tx.WitnessHash()))
+
+	// The set lock is taken before the mempool lock by the set, so the bloom
+	// filter is updated once the mempool lock is released
+	go func() {
+		btcSet.lock.Lock()
+		defer btcSet.lock.Unlock()
+
+		btcSet.addToBloom(vm.newTxGossip(tx))
+	}()
+}
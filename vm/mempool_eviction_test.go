@@ -0,0 +1,98 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/MetalBlockchain/metalgo/utils/timer/mockable"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/mempool"
+)
+
+func TestMempoolEviction(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, []byte(`{"maxMempoolBytes":700,"mempoolExpiryHours":1}`))[0]
+	require.Equal(int64(700), vm.config.MaxMempoolBytes)
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+	txPool := vm.btcdAdapter.TxMemPool()
+	mempoolInfo := func() btcjson.GetMempoolInfoResult {
+		var result btcjson.GetMempoolInfoResult
+		callRPC(t, handlers["/rpc"], "getmempoolinfo", nil, &result)
+		return result
+	}
+
+	// Confirm outputs for transactions of the same size paying increasing
+	// fee rates, of which three fit in the mempool
+	buildTestChain(t, vm, 1)
+	blk, err := vm.GetBlock(ctx, vm.lastAccepted)
+	require.NoError(err)
+	coinbase := blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx()
+	split := newTestSplitTx(t, key, coinbase, 0, 4)
+	require.NoError(vm.btcSet.Add(NewTxGossip(split)))
+	buildTestChain(t, vm, 1)
+	require.Zero(txPool.Count())
+
+	var txs []*btcutil.Tx
+	for i := range 4 {
+		rate := int64(i + 2)
+		txs = append(txs, newTestFeeTx(t, key, split.MsgTx(), uint32(i), func(vsize int64) int64 {
+			return vsize * rate
+		}))
+	}
+	for _, tx := range txs[:3] {
+		require.NoError(vm.btcSet.Add(NewTxGossip(tx)))
+	}
+	info := mempoolInfo()
+	require.Equal(int64(3), info.Size)
+	require.Equal(int64(700), info.MaxMempool)
+	require.Equal(float64(1), info.MempoolMinFee)
+
+	// The cheapest transaction makes room for the last one and the min fee
+	// rate rises above its fee rate
+	require.NoError(vm.btcSet.Add(NewTxGossip(txs[3])))
+	cheapest := txs[0]
+	require.False(txPool.HaveTransaction(cheapest.Hash()))
+	for _, tx := range txs[1:] {
+		require.True(txPool.IsTransactionInPool(tx.Hash()))
+	}
+	require.Equal(float64(1), testutil.ToFloat64(vm.txsEvicted.WithLabelValues(string(mempool.TxPoolFull))))
+	info = mempoolInfo()
+	require.Equal(int64(3), info.Size)
+	require.Greater(info.MempoolMinFee, float64(2))
+
+	// The evicted transaction is not pulled or processed again
+	_, rejected := vm.btcSet.rejected.Get(hashToID(cheapest.Hash()))
+	require.True(rejected)
+	require.Eventually(func() bool {
+		return vm.btcSet.inBloom(NewTxGossip(cheapest))
+	}, 5*time.Second, 10*time.Millisecond)
+	require.ErrorIs(vm.btcSet.Add(NewTxGossip(cheapest)), errRecentlyRejected)
+
+	// Transactions are only evicted once they expire
+	clock := &mockable.Clock{}
+	clock.Set(time.Now().Add(30 * time.Minute))
+	vm.Clock = clock
+	vm.expireMempoolTxs()
+	require.Equal(3, txPool.Count())
+	clock.Set(time.Now().Add(2 * time.Hour))
+	vm.expireMempoolTxs()
+	require.Zero(txPool.Count())
+	require.Equal(float64(3), testutil.ToFloat64(vm.txsEvicted.WithLabelValues(string(mempool.TxExpired))))
+}
@@ -0,0 +1,480 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MetalBlockchain/btcvm/btcd/mempool"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/network/p2p"
+	"github.com/MetalBlockchain/metalgo/network/p2p/gossip"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/utils/bloom"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/MetalBlockchain/metalgo/utils/set"
+	"go.uber.org/zap"
+)
+
+const (
+	// MempoolSyncHandlerID is the handler ID used to serve mempool contents
+	// to peers that are synchronizing their mempool on startup
+	MempoolSyncHandlerID = 101
+
+	// maxMempoolSyncTxIDs bounds the number of txids returned in a single
+	// response (512 KiB of txids)
+	maxMempoolSyncTxIDs = 16384
+
+	// maxMempoolSyncBatchSize bounds the number of transactions that may be
+	// requested in a single request
+	maxMempoolSyncBatchSize = 1024
+
+	// mempoolSyncFalsePositiveRate is the false positive rate of the filter
+	// describing the transactions we already have
+	mempoolSyncFalsePositiveRate = 0.001
+
+	// mempoolSyncThrottledRetryDelay is how long to wait before repeating a
+	// request the peer refused because we exceeded its request budget
+	mempoolSyncThrottledRetryDelay = time.Second
+)
+
+// mempoolSyncRequestType identifies the kind of mempool sync request
+type mempoolSyncRequestType byte
+
+const (
+	// mempoolSyncTxIDsRequest asks for the txids of the peer's mempool that
+	// are not in the attached bloom filter
+	mempoolSyncTxIDsRequest mempoolSyncRequestType = 0x01
+
+	// mempoolSyncTxsRequest asks for the transactions with the listed txids
+	mempoolSyncTxsRequest mempoolSyncRequestType = 0x02
+)
+
+var _ p2p.Handler = (*mempoolSyncHandler)(nil)
+
+// marshalMempoolSyncTxIDsRequest creates a request for the txids a peer has
+// that are not contained in filter
+func marshalMempoolSyncTxIDsRequest(filter []byte, salt []byte) ([]byte, error) {
+	request, err := gossip.MarshalAppRequest(filter, salt)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{byte(mempoolSyncTxIDsRequest)}, request...), nil
+}
+
+// marshalMempoolSyncTxsRequest creates a request for the transactions with
+// the given txids
+func marshalMempoolSyncTxsRequest(txIDs []ids.ID) []byte {
+	request := make([]byte, 1, 1+len(txIDs)*ids.IDLen)
+	request[0] = byte(mempoolSyncTxsRequest)
+	return append(request, marshalTxIDs(txIDs)...)
+}
+
+// marshalTxIDs concatenates txIDs
+func marshalTxIDs(txIDs []ids.ID) []byte {
+	b := make([]byte, 0, len(txIDs)*ids.IDLen)
+	for _, txID := range txIDs {
+		b = append(b, txID[:]...)
+	}
+	return b
+}
+
+// parseTxIDs splits b into txids
+func parseTxIDs(b []byte) ([]ids.ID, error) {
+	if len(b)%ids.IDLen != 0 {
+		return nil, fmt.Errorf("invalid txids length %d", len(b))
+	}
+
+	txIDs := make([]ids.ID, len(b)/ids.IDLen)
+	for i := range txIDs {
+		copy(txIDs[i][:], b[i*ids.IDLen:])
+	}
+	return txIDs, nil
+}
+
+// mempoolSyncHandler serves the contents of the local mempool to peers
+// performing a startup mempool sync
+type mempoolSyncHandler struct {
+	p2p.NoOpHandler
+
+	log                logging.Logger
+	mempool            *mempool.TxPool
+	marshaller         BTCGossipMarshaller
+	targetResponseSize int
+
+	// The txids of the mempool in the order they entered it, rebuilt only
+	// when the mempool has changed since the snapshot was taken
+	snapshotLock    sync.Mutex
+	snapshotUpdates uint64
+	snapshot        []ids.ID
+}
+
+// newMempoolSyncHandler creates a handler serving txPool, limiting
+// transaction responses to roughly targetResponseSize bytes
+func newMempoolSyncHandler(log logging.Logger, txPool *mempool.TxPool, targetResponseSize int) *mempoolSyncHandler {
+	return &mempoolSyncHandler{
+		log:                log,
+		mempool:            txPool,
+		targetResponseSize: targetResponseSize,
+	}
+}
+
+// AppRequest responds to txid and transaction requests
+func (h *mempoolSyncHandler) AppRequest(
+	_ context.Context,
+	nodeID ids.NodeID,
+	_ time.Time,
+	requestBytes []byte,
+) ([]byte, *common.AppError) {
+	if len(requestBytes) == 0 {
+		return nil, p2p.ErrUnexpected
+	}
+
+	var (
+		response []byte
+		err      error
+	)
+	switch mempoolSyncRequestType(requestBytes[0]) {
+	case mempoolSyncTxIDsRequest:
+		response, err = h.handleTxIDsRequest(requestBytes[1:])
+	case mempoolSyncTxsRequest:
+		response, err = h.handleTxsRequest(requestBytes[1:])
+	default:
+		err = fmt.Errorf("unknown mempool sync request type: %d", requestBytes[0])
+	}
+	if err != nil {
+		h.log.Debug("failed to handle mempool sync request",
+			zap.Stringer("nodeID", nodeID),
+			zap.Error(err),
+		)
+		return nil, p2p.ErrUnexpected
+	}
+	return response, nil
+}
+
+// handleTxIDsRequest returns the txids in the mempool that are not in the
+// requester's filter. Transactions are ordered by the time they entered the
+// mempool so that parents are listed before their children.
+func (h *mempoolSyncHandler) handleTxIDsRequest(requestBytes []byte) ([]byte, error) {
+	filter, salt, err := gossip.ParseAppRequest(requestBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := h.sortedTxIDs()
+	txIDs := make([]ids.ID, 0, min(len(snapshot), maxMempoolSyncTxIDs))
+	for _, txID := range snapshot {
+		if len(txIDs) >= maxMempoolSyncTxIDs {
+			break
+		}
+		if bloom.Contains(filter, txID[:], salt[:]) {
+			continue
+		}
+		txIDs = append(txIDs, txID)
+	}
+	return marshalTxIDs(txIDs), nil
+}
+
+// sortedTxIDs returns the txids in the mempool ordered by the time they
+// entered it. The returned slice is shared and must not be modified.
+func (h *mempoolSyncHandler) sortedTxIDs() []ids.ID {
+	h.snapshotLock.Lock()
+	defer h.snapshotLock.Unlock()
+
+	// Read the update count before the pool so that a change made while the
+	// snapshot is built invalidates it
+	numUpdates := h.mempool.NumUpdates()
+	if h.snapshot != nil && numUpdates == h.snapshotUpdates {
+		return h.snapshot
+	}
+
+	descs := h.mempool.TxDescs()
+	sort.Slice(descs, func(i, j int) bool {
+		return descs[i].Added.Before(descs[j].Added)
+	})
+
+	snapshot := make([]ids.ID, len(descs))
+	for i, desc := range descs {
+		snapshot[i] = hashToID(desc.Tx.Hash())
+	}
+	h.snapshot = snapshot
+	h.snapshotUpdates = numUpdates
+	return snapshot
+}
+
+// handleTxsRequest returns the requested transactions that are still in the
+// mempool, encoded as BTCGossip items
+func (h *mempoolSyncHandler) handleTxsRequest(requestBytes []byte) ([]byte, error) {
+	txIDs, err := parseTxIDs(requestBytes)
+	if err != nil {
+		return nil, err
+	}
+	if len(txIDs) > maxMempoolSyncBatchSize {
+		return nil, fmt.Errorf("requested %d transactions, max is %d", len(txIDs), maxMempoolSyncBatchSize)
+	}
+
+	var (
+		responseSize = 0
+		txs          = make([][]byte, 0, len(txIDs))
+	)
+	for _, txID := range txIDs {
+		tx, err := h.mempool.FetchTransaction(idToHash(txID))
+		if err != nil {
+			// The transaction was mined or evicted since it was advertised
+			continue
+		}
+
+		txBytes, err := h.marshaller.MarshalGossip(NewTxGossip(tx))
+		if err != nil {
+			return nil, err
+		}
+
+		responseSize += len(txBytes)
+		if responseSize > h.targetResponseSize && len(txs) > 0 {
+			break
+		}
+		txs = append(txs, txBytes)
+	}
+	return gossip.MarshalAppResponse(txs)
+}
+
+// initializeMempoolSync registers the mempool sync handler and, if enabled,
+// starts synchronizing the mempool from a sample of validators
+func (vm *VM) initializeMempoolSync() error {
+	handler := newMempoolSyncHandler(
+		vm.ctx.Log,
+		vm.btcdAdapter.TxMemPool(),
+		4*1024*1024, // 4MB target response size, matching the gossip handler
+	)
+
+	// Every txids request scans the whole mempool, so peers are held to the
+	// same pull request budget as gossip
+	rateLimitedHandler, err := newRateLimitedHandler(
+		handler,
+		newGossipLimiter(vm.gossipConfig),
+		vm.ctx.Log,
+		vm.metrics,
+		"btc_mempool_sync",
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create rate limited mempool sync handler: %w", err)
+	}
+	if err := vm.p2pNetwork.AddHandler(MempoolSyncHandlerID, rateLimitedHandler); err != nil {
+		return fmt.Errorf("failed to register mempool sync handler: %w", err)
+	}
+	vm.ctx.Log.Info("Registered mempool sync handler",
+		zap.Uint64("handlerID", MempoolSyncHandlerID))
+
+	if !vm.gossipConfig.MempoolSyncEnabled {
+		vm.ctx.Log.Info("Mempool sync disabled")
+		return nil
+	}
+
+	client := vm.p2pNetwork.NewClient(MempoolSyncHandlerID)
+	vm.shutdownWg.Add(1)
+	go func() {
+		defer vm.shutdownWg.Done()
+		vm.syncMempool(vm.gossipCtx, client)
+	}()
+	return nil
+}
+
+// syncMempool asks a sample of validators for the transactions in their
+// mempool that we do not have and adds them to our mempool. The total number
+// of bytes received is bounded by MempoolSyncMaxBytes.
+func (vm *VM) syncMempool(ctx context.Context, client *p2p.Client) {
+	ctx, cancel := context.WithTimeout(ctx, vm.gossipConfig.MempoolSyncTimeout)
+	defer cancel()
+
+	peers := vm.p2pValidators.Sample(ctx, vm.gossipConfig.MempoolSyncNumPeers)
+	if len(peers) == 0 {
+		vm.ctx.Log.Info("Skipping mempool sync, no connected validators")
+		return
+	}
+
+	request, err := vm.mempoolSyncTxIDsRequest()
+	if err != nil {
+		vm.ctx.Log.Error("failed to create mempool sync request", zap.Error(err))
+		return
+	}
+
+	vm.ctx.Log.Info("Starting mempool sync", zap.Int("numPeers", len(peers)))
+
+	// Collect the txids we are missing, remembering which peer advertised
+	// each one. Each txid is fetched only from the first peer listing it.
+	var (
+		totalBytes = 0
+		seen       = set.Set[ids.ID]{}
+		missing    = make(map[ids.NodeID][]ids.ID, len(peers))
+	)
+	for _, nodeID := range peers {
+		response, err := awaitMempoolSyncResponse(ctx, client, nodeID, request)
+		if err != nil {
+			vm.ctx.Log.Debug("mempool sync txids request failed",
+				zap.Stringer("nodeID", nodeID),
+				zap.Error(err),
+			)
+			continue
+		}
+		totalBytes += len(response)
+
+		txIDs, err := parseTxIDs(response)
+		if err != nil {
+			vm.ctx.Log.Debug("invalid mempool sync txids response",
+				zap.Stringer("nodeID", nodeID),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		for _, txID := range txIDs {
+			if seen.Contains(txID) || vm.btcSet.Has(txID) {
+				continue
+			}
+			seen.Add(txID)
+			missing[nodeID] = append(missing[nodeID], txID)
+		}
+	}
+
+	// Fetch the missing transactions in batches, preserving the order they
+	// were advertised in so parents are processed before their children
+	numSynced := 0
+	for _, nodeID := range peers {
+		txIDs := missing[nodeID]
+		for start := 0; start < len(txIDs); start += vm.gossipConfig.MempoolSyncBatchSize {
+			if totalBytes >= vm.gossipConfig.MempoolSyncMaxBytes {
+				vm.ctx.Log.Info("Stopping mempool sync, byte limit reached",
+					zap.Int("totalBytes", totalBytes))
+				break
+			}
+
+			end := min(start+vm.gossipConfig.MempoolSyncBatchSize, len(txIDs))
+			response, err := awaitMempoolSyncResponse(ctx, client, nodeID, marshalMempoolSyncTxsRequest(txIDs[start:end]))
+			if err != nil {
+				vm.ctx.Log.Debug("mempool sync txs request failed",
+					zap.Stringer("nodeID", nodeID),
+					zap.Error(err),
+				)
+				break
+			}
+			totalBytes += len(response)
+
+			numSynced += vm.addMempoolSyncTxs(nodeID, response)
+		}
+	}
+
+	vm.ctx.Log.Info("Finished mempool sync",
+		zap.Int("numMissing", seen.Len()),
+		zap.Int("numSynced", numSynced),
+		zap.Int("totalBytes", totalBytes),
+	)
+}
+
+// mempoolSyncTxIDsRequest creates a txids request whose filter contains the
+// transactions already in our mempool
+func (vm *VM) mempoolSyncTxIDsRequest() ([]byte, error) {
+	descs := vm.btcdAdapter.TxMemPool().TxDescs()
+
+	numHashes, numEntries := bloom.OptimalParameters(max(len(descs), 1), mempoolSyncFalsePositiveRate)
+	filter, err := bloom.New(numHashes, numEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	var salt ids.ID
+	if _, err := rand.Read(salt[:]); err != nil {
+		return nil, err
+	}
+	for _, desc := range descs {
+		txID := hashToID(desc.Tx.Hash())
+		bloom.Add(filter, txID[:], salt[:])
+	}
+	return marshalMempoolSyncTxIDsRequest(filter.Marshal(), salt[:])
+}
+
+// addMempoolSyncTxs processes the transactions in a txs response and returns
+// the number that were added to the mempool
+func (vm *VM) addMempoolSyncTxs(nodeID ids.NodeID, response []byte) int {
+	items, err := gossip.ParseAppResponse(response)
+	if err != nil {
+		vm.ctx.Log.Debug("invalid mempool sync txs response",
+			zap.Stringer("nodeID", nodeID),
+			zap.Error(err),
+		)
+		return 0
+	}
+
+	var (
+		marshaller = vm.gossipMarshaller()
+		numAdded   = 0
+	)
+	for _, itemBytes := range items {
+		item, err := marshaller.UnmarshalGossip(itemBytes)
+		if err != nil || item.ItemType != GossipItemTypeTx {
+			vm.ctx.Log.Debug("invalid transaction in mempool sync response",
+				zap.Stringer("nodeID", nodeID),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		if err := vm.btcSet.Add(item); err != nil {
+			vm.ctx.Log.Debug("failed to add synced transaction",
+				zap.Stringer("nodeID", nodeID),
+				zap.Stringer("txID", item.GossipID()),
+				zap.Error(err),
+			)
+			continue
+		}
+		numAdded++
+	}
+	return numAdded
+}
+
+// awaitMempoolSyncResponse sends request to nodeID and waits for the
+// response. Peers serve a limited number of requests per second, so a
+// throttled request is retried until ctx is done.
+func awaitMempoolSyncResponse(ctx context.Context, client *p2p.Client, nodeID ids.NodeID, request []byte) ([]byte, error) {
+	for {
+		response, err := awaitAppRequest(ctx, client, nodeID, request)
+		if !errors.Is(err, p2p.ErrThrottled) {
+			return response, err
+		}
+
+		select {
+		case <-time.After(mempoolSyncThrottledRetryDelay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// awaitAppRequest sends request to nodeID and waits for the response
+func awaitAppRequest(ctx context.Context, client *p2p.Client, nodeID ids.NodeID, request []byte) ([]byte, error) {
+	type result struct {
+		response []byte
+		err      error
+	}
+
+	done := make(chan result, 1)
+	err := client.AppRequest(ctx, set.Of(nodeID), request, func(_ context.Context, _ ids.NodeID, response []byte, err error) {
+		done <- result{response: response, err: err}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case r := <-done:
+		return r.response, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
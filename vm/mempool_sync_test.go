@@ -0,0 +1,308 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"testing"
+	"time"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/MetalBlockchain/metalgo/database/memdb"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/snow/engine/enginetest"
+	"github.com/MetalBlockchain/metalgo/snow/validators"
+	"github.com/MetalBlockchain/metalgo/snow/validators/validatorstest"
+	"github.com/MetalBlockchain/metalgo/utils/constants"
+	"github.com/MetalBlockchain/metalgo/utils/crypto/bls"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/MetalBlockchain/metalgo/utils/set"
+	"github.com/MetalBlockchain/metalgo/version"
+	"github.com/MetalBlockchain/metalgo/vms/platformvm/warp"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestNodeID returns a random node ID whose home directory is removed when
+// the test ends, so that the chain databases of other tests and earlier runs,
+// which are stored there by default, aren't reused
+func newTestNodeID(t testing.TB) ids.NodeID {
+	var nodeID ids.NodeID
+	_, err := rand.Read(nodeID[:])
+	require.NoError(t, err)
+	homeDir := btcutil.AppDataDir("btcdvm/"+nodeID.String(), false)
+	t.Cleanup(func() {
+		require.NoError(t, os.RemoveAll(homeDir))
+	})
+	return nodeID
+}
+
+// newTestVMs initializes numVMs VMs sharing a genesis whose block rewards are
+// paid to key. Every VM is a validator with its own warp signer and
+// AppRequests are routed between the VMs asynchronously. AppGossip is not
+// routed.
+func newTestVMs(t testing.TB, numVMs int, key *btcec.PrivateKey) []*VM {
+	return newTestVMsWithConfig(t, numVMs, key, "", nil)
+}
+
+// newTestVMsWithConfig is newTestVMs with extraConfig, a list of JSON
+// members, appended to the btcd config in the genesis and configBytes passed
+// to every VM
+func newTestVMsWithConfig(t testing.TB, numVMs int, key *btcec.PrivateKey, extraConfig string, configBytes []byte) []*VM {
+	return newTestVMsWithGenesis(t, numVMs, key, extraConfig, "", configBytes)
+}
+
+// newTestVMsWithGenesis is newTestVMsWithConfig with extraGenesis, a list of
+// JSON members, appended to the genesis
+func newTestVMsWithGenesis(t testing.TB, numVMs int, key *btcec.PrivateKey, extraConfig string, extraGenesis string, configBytes []byte) []*VM {
+	return newTestVMsWithEngine(t, numVMs, key, extraConfig, extraGenesis, configBytes, true)
+}
+
+// newTestVMsWithEngine is newTestVMsWithGenesis passing every VM an engine
+// channel if engineChannel is set, and a nil one, as engines relying on
+// WaitForEvent alone do, otherwise
+func newTestVMsWithEngine(t testing.TB, numVMs int, key *btcec.PrivateKey, extraConfig string, extraGenesis string, configBytes []byte, engineChannel bool) []*VM {
+	require := require.New(t)
+
+	t.Setenv("HOME", t.TempDir())
+
+	addr, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160(key.PubKey().SerializeCompressed()),
+		&btcd.BtcvmTestNetParms,
+	)
+	require.NoError(err)
+	config := `"testNet":true,"miningAddrs":["` + addr.EncodeAddress() + `"]`
+	if extraConfig != "" {
+		config += "," + extraConfig
+	}
+	genesis := `{"config":{` + config + `}`
+	if extraGenesis != "" {
+		genesis += "," + extraGenesis
+	}
+	genesis += "}"
+
+	var (
+		chainID    = ids.GenerateTestID()
+		vms        = make([]*VM, numVMs)
+		nodeIDs    = make([]ids.NodeID, numVMs)
+		vdrs       = make(map[ids.NodeID]*validators.GetValidatorOutput, numVMs)
+		vmByNodeID = make(map[ids.NodeID]*VM, numVMs)
+	)
+	for i := range vms {
+		nodeIDs[i] = newTestNodeID(t)
+		vdrs[nodeIDs[i]] = &validators.GetValidatorOutput{
+			NodeID: nodeIDs[i],
+			Weight: 1,
+		}
+		vms[i] = &VM{}
+		vmByNodeID[nodeIDs[i]] = vms[i]
+	}
+
+	validatorState := &validatorstest.State{
+		GetCurrentHeightF: func(context.Context) (uint64, error) {
+			return 0, nil
+		},
+		GetValidatorSetF: func(context.Context, uint64, ids.ID) (map[ids.NodeID]*validators.GetValidatorOutput, error) {
+			return vdrs, nil
+		},
+	}
+
+	for i, vm := range vms {
+		nodeID := nodeIDs[i]
+		sender := &enginetest.Sender{
+			SendAppRequestF: func(ctx context.Context, nodeIDs set.Set[ids.NodeID], requestID uint32, request []byte) error {
+				for peerID := range nodeIDs {
+					peer := vmByNodeID[peerID]
+					go func() {
+						_ = peer.AppRequest(ctx, nodeID, requestID, time.Now().Add(time.Minute), request)
+					}()
+				}
+				return nil
+			},
+			SendAppResponseF: func(ctx context.Context, peerID ids.NodeID, requestID uint32, response []byte) error {
+				peer := vmByNodeID[peerID]
+				go func() {
+					_ = peer.AppResponse(ctx, nodeID, requestID, response)
+				}()
+				return nil
+			},
+			SendAppErrorF: func(ctx context.Context, peerID ids.NodeID, requestID uint32, code int32, message string) error {
+				peer := vmByNodeID[peerID]
+				go func() {
+					_ = peer.AppRequestFailed(ctx, nodeID, requestID, &common.AppError{
+						Code:    code,
+						Message: message,
+					})
+				}()
+				return nil
+			},
+		}
+
+		sk, err := bls.NewSigner()
+		require.NoError(err)
+		snowCtx := &snow.Context{
+			NetworkID:      constants.UnitTestID,
+			ChainID:        chainID,
+			NodeID:         nodeID,
+			PublicKey:      sk.PublicKey(),
+			Log:            logging.NoLog{},
+			WarpSigner:     warp.NewSigner(sk, constants.UnitTestID, chainID),
+			ValidatorState: validatorState,
+		}
+		var toEngine chan common.Message
+		if engineChannel {
+			toEngine = make(chan common.Message, 1)
+		}
+		require.NoError(vm.Initialize(
+			context.Background(),
+			snowCtx,
+			memdb.New(),
+			[]byte(genesis),
+			nil,
+			configBytes,
+			toEngine,
+			nil,
+			sender,
+		))
+		t.Cleanup(func() {
+			require.NoError(vm.Shutdown(context.Background()))
+		})
+	}
+
+	for _, vm := range vms {
+		for _, nodeID := range nodeIDs {
+			if nodeID != vm.ctx.NodeID {
+				require.NoError(vm.Connected(context.Background(), nodeID, version.CurrentApp))
+			}
+		}
+	}
+	return vms
+}
+
+// newTestSpend returns a transaction spending the first output of prevTx,
+// which must pay to key
+func newTestSpend(t testing.TB, key *btcec.PrivateKey, prevTx *wire.MsgTx) *btcutil.Tx {
+	return newTestSpendWithFee(t, key, prevTx, 10_000)
+}
+
+// newTestSpendWithFee returns a transaction spending the first output of
+// prevTx to the same script and paying the given fee
+func newTestSpendWithFee(t testing.TB, key *btcec.PrivateKey, prevTx *wire.MsgTx, fee int64) *btcutil.Tx {
+	require := require.New(t)
+
+	prevOut := prevTx.TxOut[0]
+	prevHash := prevTx.TxHash()
+
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, 0), nil, nil))
+	msgTx.AddTxOut(wire.NewTxOut(prevOut.Value-fee, prevOut.PkScript))
+
+	sigScript, err := txscript.SignatureScript(msgTx, 0, prevOut.PkScript, txscript.SigHashAll, key, true)
+	require.NoError(err)
+	msgTx.TxIn[0].SignatureScript = sigScript
+	return btcutil.NewTx(msgTx)
+}
+
+func TestMempoolSync(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+
+	vms := newTestVMs(t, 2, key)
+	server, client := vms[0], vms[1]
+
+	// Mine a block on the server and share it with the client so that both
+	// know about the coinbase output being spent
+	blk, err := server.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+
+	clientBlk, err := client.ParseBlock(ctx, blk.Bytes())
+	require.NoError(err)
+	require.NoError(clientBlk.Verify(ctx))
+	require.NoError(clientBlk.Accept(ctx))
+
+	coinbase := blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx()
+	tx := newTestSpend(t, key, coinbase)
+	_, err = server.btcdAdapter.TxMemPool().ProcessTransaction(tx, false, false, 0)
+	require.NoError(err)
+
+	require.NoError(server.SetState(ctx, snow.NormalOp))
+	require.False(client.btcdAdapter.TxMemPool().HaveTransaction(tx.Hash()))
+
+	// Push gossip is not routed and pull gossip is pushed out past the end of
+	// the test, so the transaction can only reach the client through the
+	// mempool sync
+	client.gossipConfig.PullGossipFrequency = time.Hour
+	require.NoError(client.SetState(ctx, snow.NormalOp))
+	require.Eventually(func() bool {
+		return client.btcdAdapter.TxMemPool().HaveTransaction(tx.Hash())
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestMempoolSyncConfigValidate(t *testing.T) {
+	require := require.New(t)
+
+	config := DefaultGossipConfig()
+	config.MempoolSyncEnabled = false
+	config.MempoolSyncNumPeers = 0
+	require.NoError(config.Validate())
+
+	config.MempoolSyncEnabled = true
+	require.Error(config.Validate())
+}
+
+func TestMempoolSyncTxIDsRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	txIDs := []ids.ID{ids.GenerateTestID(), ids.GenerateTestID()}
+	parsed, err := parseTxIDs(marshalTxIDs(txIDs))
+	require.NoError(err)
+	require.Equal(txIDs, parsed)
+
+	_, err = parseTxIDs(make([]byte, ids.IDLen+1))
+	require.Error(err)
+}
+
+func TestMempoolSyncHandlerSnapshot(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+
+	vm := newTestVMs(t, 1, key)[0]
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+
+	txPool := vm.btcdAdapter.TxMemPool()
+	handler := newMempoolSyncHandler(vm.ctx.Log, txPool, 4*1024*1024)
+	require.Empty(handler.sortedTxIDs())
+
+	coinbase := blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx()
+	tx := newTestSpend(t, key, coinbase)
+	_, err = txPool.ProcessTransaction(tx, false, false, 0)
+	require.NoError(err)
+
+	// The snapshot is rebuilt once the mempool changes and reused until the
+	// next change
+	snapshot := handler.sortedTxIDs()
+	require.Equal([]ids.ID{hashToID(tx.Hash())}, snapshot)
+	require.Same(&snapshot[0], &handler.sortedTxIDs()[0])
+
+	txPool.RemoveTransaction(tx, false)
+	require.Empty(handler.sortedTxIDs())
+}
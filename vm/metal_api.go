@@ -0,0 +1,219 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/utils/json"
+	"github.com/gorilla/rpc/v2"
+	"github.com/gorilla/rpc/v2/json2"
+	"go.uber.org/zap"
+
+	"github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+)
+
+const (
+	// metalEndpoint is the endpoint of the Metal API
+	metalEndpoint = "/metal"
+
+	// metalServiceName is the prefix of the methods of the Metal API
+	metalServiceName = "metal"
+)
+
+var errInvalidBlockID = errors.New("block ID is neither a Metal ID nor a Bitcoin block hash")
+
+// metalHandler returns the handler of the Metal API, which serves the chain to
+// Metal tooling in the format of the APIs of the other Metal VMs, without
+// Bitcoin RPC
+func (vm *VM) metalHandler() (http.Handler, error) {
+	server := rpc.NewServer()
+	server.RegisterCodec(json.NewCodec(), "application/json")
+	server.RegisterCodec(json.NewCodec(), "application/json;charset=UTF-8")
+	if err := server.RegisterService(&MetalService{vm: vm}, metalServiceName); err != nil {
+		return nil, fmt.Errorf("failed to register Metal API: %w", err)
+	}
+	return server, nil
+}
+
+// parseBlockID parses a block ID given either as a Metal ID or as a Bitcoin
+// block hash in its byte-reversed hex form
+func parseBlockID(s string) (ids.ID, error) {
+	if len(s) == chainhash.MaxHashStringSize {
+		hash, err := chainhash.NewHashFromStr(s)
+		if err != nil {
+			return ids.Empty, fmt.Errorf("%w: %w", errInvalidBlockID, err)
+		}
+		return hashToID(hash), nil
+	}
+	id, err := ids.FromString(s)
+	if err != nil {
+		return ids.Empty, fmt.Errorf("%w: %w", errInvalidBlockID, err)
+	}
+	return id, nil
+}
+
+// MetalService serves the Metal API
+type MetalService struct {
+	vm *VM
+}
+
+// MetalBlockIDReply is a block by its Metal ID and its Bitcoin hash
+type MetalBlockIDReply struct {
+	ID     ids.ID      `json:"id"`
+	Hash   string      `json:"hash"`
+	Height json.Uint64 `json:"height"`
+}
+
+// blockIDReply fills reply with the block blockID of the main chain
+func (s *MetalService) blockIDReply(blockID ids.ID, reply *MetalBlockIDReply) error {
+	hash := idToHash(blockID)
+	height, err := s.vm.chain.BlockHeightByHash(hash)
+	if err != nil {
+		return fmt.Errorf("failed to look up height of block %s: %w", blockID, err)
+	}
+	reply.ID = blockID
+	reply.Hash = hash.String()
+	reply.Height = json.Uint64(height)
+	return nil
+}
+
+// GetLastAccepted returns the last accepted block
+func (s *MetalService) GetLastAccepted(_ *http.Request, _ *struct{}, reply *MetalBlockIDReply) error {
+	s.vm.blocksMu.RLock()
+	lastAccepted := s.vm.lastAccepted
+	s.vm.blocksMu.RUnlock()
+
+	return s.blockIDReply(lastAccepted, reply)
+}
+
+// GetPreference returns the preferred block
+func (s *MetalService) GetPreference(_ *http.Request, _ *struct{}, reply *MetalBlockIDReply) error {
+	return s.blockIDReply(s.vm.preferredBlock(), reply)
+}
+
+// MetalHeightReply is the height of the chain
+type MetalHeightReply struct {
+	Height json.Uint64 `json:"height"`
+}
+
+// GetHeight returns the height of the last accepted block
+func (s *MetalService) GetHeight(r *http.Request, _ *struct{}, reply *MetalHeightReply) error {
+	var lastAccepted MetalBlockIDReply
+	if err := s.GetLastAccepted(r, nil, &lastAccepted); err != nil {
+		return err
+	}
+	reply.Height = lastAccepted.Height
+	return nil
+}
+
+// MetalGetBlockArgs are the arguments of GetBlock
+type MetalGetBlockArgs struct {
+	// BlockID is the Metal ID or the Bitcoin hash of the block
+	BlockID string `json:"blockID"`
+}
+
+// MetalGetBlockReply is a block with its ID and the ID of its parent in both
+// forms
+type MetalGetBlockReply struct {
+	ID         ids.ID      `json:"id"`
+	Hash       string      `json:"hash"`
+	ParentID   ids.ID      `json:"parentID"`
+	ParentHash string      `json:"parentHash"`
+	Height     json.Uint64 `json:"height"`
+	Timestamp  json.Uint64 `json:"timestamp"`
+	// Block is the serialized block in hex
+	Block string `json:"block"`
+}
+
+// GetBlock returns the block identified by args.BlockID
+func (s *MetalService) GetBlock(_ *http.Request, args *MetalGetBlockArgs, reply *MetalGetBlockReply) error {
+	blockID, err := parseBlockID(args.BlockID)
+	if err != nil {
+		return err
+	}
+	blk, err := s.vm.getBlock(blockID)
+	if err != nil {
+		return fmt.Errorf("failed to get block %s: %w", blockID, err)
+	}
+
+	reply.ID = blk.ID()
+	reply.Hash = idToHash(blk.ID()).String()
+	reply.ParentID = blk.Parent()
+	reply.ParentHash = idToHash(blk.Parent()).String()
+	reply.Height = json.Uint64(blk.Height())
+	reply.Timestamp = json.Uint64(blk.Timestamp().Unix())
+	reply.Block = hex.EncodeToString(blk.Bytes())
+	return nil
+}
+
+// MetalIssueTxArgs are the arguments of IssueTx
+type MetalIssueTxArgs struct {
+	// Tx is the serialized transaction in hex
+	Tx string `json:"tx"`
+
+	// MaxFeeRate is the max fee rate in BTC/kvB of the transaction, as the
+	// maxfeerate of sendrawtransaction. Zero doesn't limit the fee rate and
+	// nil defaults to 0.10 BTC/kvB.
+	MaxFeeRate *json.Float64 `json:"maxFeeRate"`
+}
+
+// MetalIssueTxReply is the ID of an issued transaction in both forms
+type MetalIssueTxReply struct {
+	TxID ids.ID `json:"txID"`
+	Hash string `json:"hash"`
+}
+
+// IssueTx adds the transaction args.Tx to the mempool and pushes it to peers
+// right away, along with the orphans it accepted. Rejections are returned
+// with the code and data of the sendrawtransaction errors.
+func (s *MetalService) IssueTx(_ *http.Request, args *MetalIssueTxArgs, reply *MetalIssueTxReply) error {
+	txBytes, err := hex.DecodeString(args.Tx)
+	if err != nil {
+		return fmt.Errorf("failed to decode transaction: %w", err)
+	}
+	var msgTx wire.MsgTx
+	if err := msgTx.Deserialize(bytes.NewReader(txBytes)); err != nil {
+		return fmt.Errorf("failed to deserialize transaction: %w", err)
+	}
+
+	var maxFeeRate *float64
+	if args.MaxFeeRate != nil {
+		if *args.MaxFeeRate < 0 {
+			return fmt.Errorf("max fee rate must not be negative, got %f", *args.MaxFeeRate)
+		}
+		maxFeeRate = (*float64)(args.MaxFeeRate)
+	}
+	tx := btcutil.NewTx(&msgTx)
+	acceptedTxs, err := btcd.AcceptLocalTransaction(s.vm.btcdAdapter.TxMemPool(), tx, maxFeeRate)
+	if err != nil {
+		var rpcErr *btcjson.RPCError
+		if errors.As(err, &rpcErr) {
+			return &json2.Error{
+				Code:    json2.ErrorCode(rpcErr.Code),
+				Message: rpcErr.Message,
+				Data:    rpcErr.Data,
+			}
+		}
+		return fmt.Errorf("transaction %s rejected: %w", tx.Hash(), err)
+	}
+	s.vm.btcdAdapter.AnnounceLocalTransactions(acceptedTxs)
+
+	s.vm.ctx.Log.Debug("issued transaction through the Metal API",
+		zap.Stringer("hash", tx.Hash()),
+		zap.Int("accepted", len(acceptedTxs)),
+	)
+	reply.TxID = hashToID(tx.Hash())
+	reply.Hash = tx.Hash().String()
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+)
+
+// callMetalAPI calls method of the Metal API served by handler and decodes
+// its result into result, returning the error message of the call, if any
+func callMetalAPI(t *testing.T, handler http.Handler, method string, params interface{}, result interface{}) string {
+	require := require.New(t)
+
+	request, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  method,
+		"params":  params,
+	})
+	require.NoError(err)
+
+	httpRequest := httptest.NewRequest(http.MethodPost, metalEndpoint, bytes.NewReader(request))
+	httpRequest.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httpRequest)
+	require.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	require.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+	if response.Error != nil {
+		return response.Error.Message
+	}
+	require.NoError(json.Unmarshal(response.Result, result))
+	return ""
+}
+
+func TestParseBlockID(t *testing.T) {
+	require := require.New(t)
+
+	// The Bitcoin hash of a block is its Metal ID in reversed byte order
+	hash, err := chainhash.NewHashFromStr("000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f")
+	require.NoError(err)
+	id := hashToID(hash)
+	require.Equal(hash[:], id[:])
+	require.Equal(*hash, *idToHash(id))
+
+	parsed, err := parseBlockID(hash.String())
+	require.NoError(err)
+	require.Equal(id, parsed)
+	parsed, err = parseBlockID(id.String())
+	require.NoError(err)
+	require.Equal(id, parsed)
+
+	for _, s := range []string{"", "not an ID", hash.String()[1:] + "x"} {
+		_, err := parseBlockID(s)
+		require.ErrorIs(err, errInvalidBlockID, s)
+	}
+}
+
+func TestMetalAPI(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, nil)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	handler := handlers[metalEndpoint]
+	require.NotNil(handler)
+
+	buildTestChain(t, vm, 2)
+	tip := vm.chain.BestSnapshot()
+	tipID := hashToID(&tip.Hash)
+
+	var lastAccepted MetalBlockIDReply
+	require.Empty(callMetalAPI(t, handler, "metal.getLastAccepted", struct{}{}, &lastAccepted))
+	require.Equal(MetalBlockIDReply{ID: tipID, Hash: tip.Hash.String(), Height: 2}, lastAccepted)
+
+	var preference MetalBlockIDReply
+	require.Empty(callMetalAPI(t, handler, "metal.getPreference", struct{}{}, &preference))
+	require.Equal(lastAccepted, preference)
+
+	var height MetalHeightReply
+	require.Empty(callMetalAPI(t, handler, "metal.getHeight", struct{}{}, &height))
+	require.EqualValues(2, height.Height)
+
+	// Blocks are found by either form of their ID
+	blk, err := vm.GetBlock(ctx, tipID)
+	require.NoError(err)
+	for _, blockID := range []string{tipID.String(), tip.Hash.String()} {
+		var block MetalGetBlockReply
+		require.Empty(callMetalAPI(t, handler, "metal.getBlock", &MetalGetBlockArgs{BlockID: blockID}, &block))
+		require.Equal(tipID, block.ID)
+		require.Equal(tip.Hash.String(), block.Hash)
+		require.Equal(blk.Parent(), block.ParentID)
+		require.Equal(idToHash(blk.Parent()).String(), block.ParentHash)
+		require.EqualValues(2, block.Height)
+		require.EqualValues(blk.Timestamp().Unix(), block.Timestamp)
+		require.Equal(hex.EncodeToString(blk.Bytes()), block.Block)
+	}
+	var block MetalGetBlockReply
+	require.Contains(callMetalAPI(t, handler, "metal.getBlock", &MetalGetBlockArgs{BlockID: "unknown"}, &block), errInvalidBlockID.Error())
+	require.NotEmpty(callMetalAPI(t, handler, "metal.getBlock", &MetalGetBlockArgs{BlockID: ids.GenerateTestID().String()}, &block))
+
+	// Issued transactions enter the mempool
+	coinbase := blk.(*BlockAdapter).btcBlock.Transactions()[0]
+	spend := newTestSpend(t, key, coinbase.MsgTx())
+	var issued MetalIssueTxReply
+	require.Empty(callMetalAPI(t, handler, "metal.issueTx", &MetalIssueTxArgs{Tx: txHex(t, spend.MsgTx())}, &issued))
+	require.Equal(hashToID(spend.Hash()), issued.TxID)
+	require.Equal(spend.Hash().String(), issued.Hash)
+	require.True(vm.btcdAdapter.TxMemPool().HaveTransaction(spend.Hash()))
+
+	// Invalid and conflicting transactions are rejected
+	require.NotEmpty(callMetalAPI(t, handler, "metal.issueTx", &MetalIssueTxArgs{Tx: "zz"}, &issued))
+	require.Contains(callMetalAPI(t, handler, "metal.issueTx", &MetalIssueTxArgs{Tx: txHex(t, newTestSpendWithFee(t, key, coinbase.MsgTx(), 20_000).MsgTx())}, &issued), "rejected")
+}
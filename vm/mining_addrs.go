@@ -0,0 +1,103 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil/base58"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
+
+	"go.uber.org/zap"
+)
+
+var errInvalidMiningAddrs = errors.New("invalid mining addresses")
+
+// initializeMiningAddrs checks miningAddrs against the network of config and
+// sets them as the addresses built blocks pay to. Invalid addresses fail
+// initialization, unless block building is disabled, in which case they are
+// only logged and dropped.
+func (vm *VM) initializeMiningAddrs(config *btcd.Config, miningAddrs []string) error {
+	addrs, err := decodeMiningAddrs(miningAddrs, config.ChainParams)
+	if err != nil {
+		if !vm.nodeConfig.DisableBlockBuilding {
+			return err
+		}
+		vm.ctx.Log.Warn("ignoring invalid mining addresses of follower node", zap.Error(err))
+	}
+
+	for _, addr := range addrs {
+		script, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			return fmt.Errorf("failed to create script of mining address %s: %w", addr, err)
+		}
+		class := txscript.GetScriptClass(script)
+		vm.ctx.Log.Info("mining address",
+			zap.Stringer("address", addr),
+			zap.Stringer("type", class),
+		)
+		if class == txscript.PubKeyTy {
+			vm.ctx.Log.Warn("pay-to-pubkey mining address makes coinbase outputs larger than paying to its hash",
+				zap.Stringer("address", addr),
+			)
+		}
+	}
+	config.SetMiningAddrs(addrs)
+	return nil
+}
+
+// decodeMiningAddrs decodes miningAddrs on the network of params. The error
+// lists every address that is invalid along with the prefixes of the
+// addresses of the network.
+func decodeMiningAddrs(miningAddrs []string, params *chaincfg.Params) ([]btcutil.Address, error) {
+	var (
+		addrs   = make([]btcutil.Address, 0, len(miningAddrs))
+		invalid []string
+	)
+	for _, strAddr := range miningAddrs {
+		addr, err := btcutil.DecodeAddress(strAddr, params)
+		switch {
+		case err != nil:
+			invalid = append(invalid, fmt.Sprintf("%q (%s)", strAddr, err))
+		case !addr.IsForNet(params):
+			invalid = append(invalid, fmt.Sprintf("%q (wrong network)", strAddr))
+		default:
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(invalid) > 0 {
+		return addrs, fmt.Errorf("%w %s: addresses of network %s start with %s",
+			errInvalidMiningAddrs,
+			strings.Join(invalid, ", "),
+			params.Name,
+			strings.Join(addressPrefixes(params), ", "),
+		)
+	}
+	return addrs, nil
+}
+
+// addressPrefixes returns the leading characters of the P2PKH and P2SH
+// addresses of params and the prefix of its segwit and taproot addresses
+func addressPrefixes(params *chaincfg.Params) []string {
+	var prefixes []string
+	for _, version := range []byte{params.PubKeyHashAddrID, params.ScriptHashAddrID} {
+		// The leading character of a base58 address depends on its payload
+		// for some versions, so both ends of the range are encoded
+		for _, b := range []byte{0x00, 0xff} {
+			hash := bytes.Repeat([]byte{b}, 20)
+			prefix := base58.CheckEncode(hash, version)[:1]
+			if !slices.Contains(prefixes, prefix) {
+				prefixes = append(prefixes, prefix)
+			}
+		}
+	}
+	return append(prefixes, params.Bech32HRPSegwit+"1")
+}
@@ -0,0 +1,102 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/MetalBlockchain/metalgo/database/memdb"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/utils/constants"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/stretchr/testify/require"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+)
+
+// mainNetAddr is a P2PKH address of the Bitcoin main network
+const mainNetAddr = "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"
+
+// initializeMiningAddrsVM initializes a VM with the mining addresses of
+// genesisConfig and configBytes
+func initializeMiningAddrsVM(t *testing.T, genesisConfig string, configBytes []byte) (*VM, error) {
+	vm := &VM{}
+	err := vm.Initialize(
+		context.Background(),
+		&snow.Context{
+			NetworkID: constants.UnitTestID,
+			ChainID:   ids.GenerateTestID(),
+			NodeID:    newTestNodeID(t),
+			Log:       logging.NoLog{},
+		},
+		memdb.New(),
+		[]byte(`{"config":{"testNet":true,"dbType":"memdb",`+genesisConfig+`}}`),
+		nil,
+		configBytes,
+		make(chan common.Message, 1),
+		nil,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		require.NoError(t, vm.Shutdown(context.Background()))
+	})
+	return vm, nil
+}
+
+func TestDecodeMiningAddrs(t *testing.T) {
+	require := require.New(t)
+	params := &btcd.BtcvmTestNetParms
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	pkHash, err := btcutil.NewAddressPubKeyHash(btcutil.Hash160(key.PubKey().SerializeCompressed()), params)
+	require.NoError(err)
+	witnessPKHash, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(key.PubKey().SerializeCompressed()), params)
+	require.NoError(err)
+
+	addrs, err := decodeMiningAddrs([]string{pkHash.EncodeAddress(), witnessPKHash.EncodeAddress()}, params)
+	require.NoError(err)
+	require.Equal([]btcutil.Address{pkHash, witnessPKHash}, addrs)
+
+	// Every invalid address is reported along with the expected prefixes
+	addrs, err = decodeMiningAddrs([]string{mainNetAddr, pkHash.EncodeAddress(), "sb1typo"}, params)
+	require.ErrorIs(err, errInvalidMiningAddrs)
+	require.ErrorContains(err, `"`+mainNetAddr+`"`)
+	require.ErrorContains(err, `"sb1typo"`)
+	require.ErrorContains(err, "addresses of network btcvmtestnet start with S, r, sb1")
+	require.Equal([]btcutil.Address{pkHash}, addrs)
+}
+
+func TestInitializeMiningAddrs(t *testing.T) {
+	require := require.New(t)
+
+	// A mainnet address fails initialization of a node building blocks
+	_, err := initializeMiningAddrsVM(t, `"miningAddrs":["`+mainNetAddr+`"]`, nil)
+	require.ErrorIs(err, errInvalidMiningAddrs)
+
+	// Followers don't build blocks, so their invalid addresses are dropped
+	vm, err := initializeMiningAddrsVM(t, `"miningAddrs":["`+mainNetAddr+`"]`, []byte(`{"disableBlockBuilding":true}`))
+	require.NoError(err)
+	require.Empty(vm.config.MiningAddrs)
+
+	// Pay-to-pubkey addresses are kept as given rather than as their hash
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	pubKey := hex.EncodeToString(key.PubKey().SerializeCompressed())
+	vm, err = initializeMiningAddrsVM(t, `"miningAddrs":["`+pubKey+`"]`, nil)
+	require.NoError(err)
+	require.Equal([]string{pubKey}, vm.config.MiningAddrs)
+	payToAddr, err := vm.payToAddr()
+	require.NoError(err)
+	require.IsType(&btcutil.AddressPubKey{}, payToAddr)
+}
@@ -0,0 +1,26 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+)
+
+// miningInfo returns the state of the block builder for the getmininginfo RPC
+func (vm *VM) miningInfo() *btcjson.MetalMiningInfo {
+	info := &btcjson.MetalMiningInfo{
+		BuilderEnabled:  !vm.nodeConfig.DisableBlockBuilding,
+		MiningAddrs:     append([]string{}, vm.config.MiningAddrs...),
+		TargetBlockTime: TargetBlockTime.Seconds(),
+		PoWDisabled:     vm.config.ChainParams.PoWDisabled,
+	}
+
+	blk, builtAt := vm.buildFailures.lastBuild()
+	if blockAdapter, ok := blk.(*BlockAdapter); ok {
+		info.LastBuiltBlock = blockAdapter.btcBlock.Hash().String()
+		info.LastBuiltHeight = int64(blockAdapter.Height())
+		info.LastBuiltTime = builtAt.Unix()
+	}
+	return info
+}
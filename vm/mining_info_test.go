@@ -0,0 +1,90 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+)
+
+func TestMiningInfoPoWDisabled(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithGenesis(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, `"chainParams":{"powDisabled":true}`, nil)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+
+	// No block was built yet
+	var info map[string]interface{}
+	callRPC(t, handlers["/rpc"], "getmininginfo", nil, &info)
+	metal := info["metal"].(map[string]interface{})
+	require.Equal(map[string]interface{}{
+		"builderenabled":  true,
+		"miningaddrs":     []interface{}{vm.config.MiningAddrs[0]},
+		"targetblocktime": TargetBlockTime.Seconds(),
+		"powdisabled":     true,
+	}, metal)
+
+	buildTestChain(t, vm, 2)
+	blk, err := vm.GetBlock(ctx, vm.lastAccepted)
+	require.NoError(err)
+
+	info = nil
+	callRPC(t, handlers["/rpc"], "getmininginfo", nil, &info)
+	require.Equal(float64(1), info["difficulty"])
+	require.Equal(float64(0), info["networkhashps"])
+	require.Equal(float64(0), info["hashespersec"])
+	require.Equal(true, info["generate"])
+	require.Equal(float64(-1), info["genproclimit"])
+	metal = info["metal"].(map[string]interface{})
+	require.Equal(blk.(*BlockAdapter).btcBlock.Hash().String(), metal["lastbuiltblock"])
+	require.Equal(float64(2), metal["lastbuiltheight"])
+	require.Contains(metal, "lastbuilttime")
+
+	var difficulty, hashesPerSec interface{}
+	callRPC(t, handlers["/rpc"], "getdifficulty", nil, &difficulty)
+	require.Equal(float64(1), difficulty)
+	callRPC(t, handlers["/rpc"], "getnetworkhashps", nil, &hashesPerSec)
+	require.Equal(float64(0), hashesPerSec)
+}
+
+func TestMiningInfoPoW(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, nil)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	buildTestChain(t, vm, 2)
+
+	// The difficulty and hash rate are derived from the bits of the blocks
+	var header map[string]interface{}
+	callRPC(t, handlers["/rpc"], "getblockheader", []interface{}{vm.btcdAdapter.Chain().BestSnapshot().Hash.String()}, &header)
+	var difficulty float64
+	callRPC(t, handlers["/rpc"], "getdifficulty", nil, &difficulty)
+	require.Equal(header["difficulty"], difficulty)
+
+	var info map[string]interface{}
+	callRPC(t, handlers["/rpc"], "getmininginfo", nil, &info)
+	require.Equal(difficulty, info["difficulty"])
+	require.IsType(float64(0), info["networkhashps"])
+	require.NotEqual(float64(-1), info["genproclimit"])
+	metal := info["metal"].(map[string]interface{})
+	require.Equal(false, metal["powdisabled"])
+	require.Equal(true, metal["builderenabled"])
+	require.Equal(float64(2), metal["lastbuiltheight"])
+
+	var hashesPerSec float64
+	callRPC(t, handlers["/rpc"], "getnetworkhashps", nil, &hashesPerSec)
+	require.Equal(info["networkhashps"], hashesPerSec)
+}
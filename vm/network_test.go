@@ -0,0 +1,689 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MetalBlockchain/metalgo/network/p2p"
+	"github.com/MetalBlockchain/metalgo/network/p2p/gossip"
+	"github.com/MetalBlockchain/metalgo/snow/consensus/snowman"
+	"github.com/MetalBlockchain/metalgo/version"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/MetalBlockchain/btcvm/vm"
+	"github.com/MetalBlockchain/btcvm/vm/vmtest"
+)
+
+// spendCoinbase returns a transaction spending the coinbase output of blk,
+// which must pay to key, back to the same script
+func spendCoinbase(t *testing.T, key *btcec.PrivateKey, blk snowman.Block) *wire.MsgTx {
+	var msgBlock wire.MsgBlock
+	require.NoError(t, msgBlock.Deserialize(bytes.NewReader(blk.Bytes())))
+	return splitOutput(t, key, msgBlock.Transactions[0], 0, 1)
+}
+
+// splitOutput returns a transaction spending the output at index of prevTx,
+// which must pay to key, to numOutputs outputs of equal value paying to the
+// same script
+func splitOutput(t *testing.T, key *btcec.PrivateKey, prevTx *wire.MsgTx, index uint32, numOutputs int) *wire.MsgTx {
+	return splitOutputWithFee(t, key, prevTx, index, numOutputs, 10_000)
+}
+
+// splitOutputWithFee is splitOutput paying the given fee
+func splitOutputWithFee(t *testing.T, key *btcec.PrivateKey, prevTx *wire.MsgTx, index uint32, numOutputs int, fee int64) *wire.MsgTx {
+	require := require.New(t)
+
+	prevOut := prevTx.TxOut[index]
+	prevHash := prevTx.TxHash()
+
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, index), nil, nil))
+	value := (prevOut.Value - fee) / int64(numOutputs)
+	for i := 0; i < numOutputs; i++ {
+		msgTx.AddTxOut(wire.NewTxOut(value, prevOut.PkScript))
+	}
+	sigScript, err := txscript.SignatureScript(msgTx, 0, prevOut.PkScript, txscript.SigHashAll, key, true)
+	require.NoError(err)
+	msgTx.TxIn[0].SignatureScript = sigScript
+	return msgTx
+}
+
+// sendRawTransaction submits msgTx to the mempool of node
+func sendRawTransaction(t *testing.T, node *vmtest.Node, msgTx *wire.MsgTx) {
+	var buf bytes.Buffer
+	require.NoError(t, msgTx.Serialize(&buf))
+	require.NoError(t, node.CallRPC("sendrawtransaction", []interface{}{hex.EncodeToString(buf.Bytes())}, nil))
+}
+
+// mempoolSize returns the number of transactions in the mempool of node
+func mempoolSize(t *testing.T, node *vmtest.Node) int64 {
+	var info btcjson.GetMempoolInfoResult
+	require.NoError(t, node.CallRPC("getmempoolinfo", nil, &info))
+	return info.Size
+}
+
+// inMempool returns whether the transaction txID is in the mempool of node
+func inMempool(t *testing.T, node *vmtest.Node, txID string) bool {
+	var txIDs []string
+	require.NoError(t, node.CallRPC("getrawmempool", []interface{}{false}, &txIDs))
+	for _, id := range txIDs {
+		if id == txID {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNetworkTxGossip(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	// The mempools are polled until the block including the transaction is
+	// built, which waits for the target block time since the block built
+	// below, over the default RPC limits
+	network := vmtest.NewNetwork(t, 2, key, []byte(`{"rpcLimits":{"requestsPerSecond":1000,"requestBurst":1000}}`))
+	network.Router.SetLatency(10 * time.Millisecond)
+
+	blk, err := network.BuildBlock(ctx, 0)
+	require.NoError(err)
+
+	// The transaction submitted to node A is pushed to node B
+	tx := spendCoinbase(t, key, blk)
+	txID := tx.TxHash().String()
+	sendRawTransaction(t, network.Nodes[0], tx)
+	network.Eventually(func() bool {
+		return inMempool(t, network.Nodes[1], txID)
+	}, 10*time.Second)
+
+	// Either node builds the block including it, which both nodes accept
+	network.Start()
+	network.Eventually(func() bool {
+		return !inMempool(t, network.Nodes[0], txID) && !inMempool(t, network.Nodes[1], txID)
+	}, 10*time.Second)
+}
+
+func TestNetworkPushGossipBurst(t *testing.T) {
+	const numTxs = 200
+
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	network := vmtest.NewNetwork(t, 2, key, []byte(`{"rpcLimits":{"requestBurst":1000}}`))
+	nodeA, nodeB := network.Nodes[0], network.Nodes[1]
+
+	// Pull gossip and the mempool sync are requests, which are dropped so
+	// that transactions only reach node B through push gossip
+	network.Router.SetDrop(func(msg vmtest.Message) bool {
+		return msg.Type == vmtest.AppRequest
+	})
+
+	blk, err := network.BuildBlock(ctx, 0)
+	require.NoError(err)
+	var msgBlock wire.MsgBlock
+	require.NoError(msgBlock.Deserialize(bytes.NewReader(blk.Bytes())))
+	fund := splitOutput(t, key, msgBlock.Transactions[0], 0, numTxs)
+	sendRawTransaction(t, nodeA, fund)
+	_, err = network.BuildBlock(ctx, 0)
+	require.NoError(err)
+	require.Zero(mempoolSize(t, nodeB))
+
+	for i := 0; i < numTxs; i++ {
+		sendRawTransaction(t, nodeA, splitOutput(t, key, fund, uint32(i), 1))
+	}
+
+	// The burst is pushed within a few push cycles of 100ms
+	network.Eventually(func() bool {
+		return mempoolSize(t, nodeB) == numTxs
+	}, time.Second)
+}
+
+func TestNetworkBlockPropagation(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	network := vmtest.NewNetwork(t, 3, key, nil)
+
+	blk, err := network.BuildBlock(ctx, 0)
+	require.NoError(err)
+	for _, node := range network.Nodes {
+		lastAccepted, err := node.VM.LastAccepted(ctx)
+		require.NoError(err)
+		require.Equal(blk.ID(), lastAccepted)
+	}
+
+	// Any node at the tip builds on the block of node A
+	next, err := network.BuildBlock(ctx, 2)
+	require.NoError(err)
+	require.Equal(blk.ID(), next.Parent())
+}
+
+func TestNetworkOrphanRecovery(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	network := vmtest.NewNetwork(t, 2, key, nil)
+	nodeB := network.Nodes[1]
+
+	// Node B misses the first two blocks of node A and falls behind
+	network.Router.SetDrop(func(msg vmtest.Message) bool {
+		return msg.Type == vmtest.Block && msg.To == nodeB.NodeID
+	})
+	for i := 0; i < 2; i++ {
+		_, err := network.BuildBlock(ctx, 0)
+		require.NoError(err)
+	}
+	_, err = network.BuildBlock(ctx, 1)
+	require.Error(err)
+	_, err = nodeB.VM.GetBlockIDAtHeight(ctx, 1)
+	require.Error(err)
+
+	// The third block is an orphan to node B, which fetches its missing
+	// ancestors from node A before accepting it
+	network.Router.SetDrop(nil)
+	blk, err := network.BuildBlock(ctx, 0)
+	require.NoError(err)
+	lastAccepted, err := nodeB.VM.LastAccepted(ctx)
+	require.NoError(err)
+	require.Equal(blk.ID(), lastAccepted)
+	for height := uint64(1); height <= blk.Height(); height++ {
+		blkIDA, err := network.Nodes[0].VM.GetBlockIDAtHeight(ctx, height)
+		require.NoError(err)
+		blkIDB, err := nodeB.VM.GetBlockIDAtHeight(ctx, height)
+		require.NoError(err)
+		require.Equal(blkIDA, blkIDB)
+	}
+
+	// Node B is back at the tip and builds the next block
+	_, err = network.BuildBlock(ctx, 1)
+	require.NoError(err)
+}
+
+func TestNetworkPeerInfo(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	network := vmtest.NewNetwork(t, 3, key, nil)
+	node := network.Nodes[0]
+
+	peerAddrs := func() []string {
+		var peers []btcjson.GetPeerInfoResult
+		require.NoError(node.CallRPC("getpeerinfo", nil, &peers))
+		addrs := make([]string, 0, len(peers))
+		for _, peer := range peers {
+			// The user agent of the peer is its Metal node version
+			require.Equal("/"+strings.Replace(version.CurrentApp.String(), "/", ":", 1)+"/", peer.SubVer)
+			addrs = append(addrs, peer.Addr)
+		}
+		return addrs
+	}
+	networkInfo := func() btcjson.GetNetworkInfoResult {
+		var info btcjson.GetNetworkInfoResult
+		require.NoError(node.CallRPC("getnetworkinfo", nil, &info))
+		return info
+	}
+
+	// Peers are reported by node ID once connected
+	peerA, peerB := network.Nodes[1].NodeID, network.Nodes[2].NodeID
+	require.ElementsMatch([]string{peerA.String(), peerB.String()}, peerAddrs())
+	info := networkInfo()
+	require.Equal(int32(2), info.Connections)
+	require.NotNil(info.Metal)
+	require.Equal(node.NodeID.String(), info.Metal.NodeID)
+	require.Equal(int32(2), info.Metal.Peers)
+	require.Equal(int32(2), info.Metal.ValidatorPeers)
+
+	require.NoError(node.VM.Disconnected(ctx, peerA))
+	require.Equal([]string{peerB.String()}, peerAddrs())
+	require.Equal(int32(1), networkInfo().Connections)
+
+	require.NoError(node.VM.Connected(ctx, peerA, version.CurrentApp))
+	require.ElementsMatch([]string{peerA.String(), peerB.String()}, peerAddrs())
+	require.Equal(int32(2), networkInfo().Metal.Peers)
+}
+
+func TestNetworkPeerGossipStats(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	network := vmtest.NewNetwork(t, 2, key, nil)
+	node, peer := network.Nodes[0], network.Nodes[1]
+
+	blk, err := network.BuildBlock(ctx, 0)
+	require.NoError(err)
+
+	peerGossip := func() btcjson.GetPeerInfoResult {
+		var peers []btcjson.GetPeerInfoResult
+		require.NoError(node.CallRPC("getpeerinfo", nil, &peers))
+		require.Len(peers, 1)
+		require.NotNil(peers[0].Gossip)
+		return peers[0]
+	}
+	require.Zero(*peerGossip().Gossip)
+
+	// The peer pushes a transaction with a negative output, which is held
+	// against it
+	tx := spendCoinbase(t, key, blk)
+	tx.TxOut[0].Value = -1
+	itemBytes, err := (&vm.BTCGossipMarshaller{}).MarshalGossip(vm.NewTxGossip(btcutil.NewTx(tx)))
+	require.NoError(err)
+	msg, err := gossip.MarshalAppGossip([][]byte{itemBytes})
+	require.NoError(err)
+	msg = p2p.PrefixMessage(p2p.ProtocolPrefix(vm.BTCGossipHandlerID), msg)
+	require.NoError(node.VM.AppGossip(ctx, peer.NodeID, msg))
+	require.Eventually(func() bool {
+		return peerGossip().Gossip.InvalidTxs == 1
+	}, 10*time.Second, 10*time.Millisecond)
+	info := peerGossip()
+	require.Positive(info.BanScore)
+	require.Zero(info.Gossip.UsefulItems)
+
+	// Pushing it again is a duplicate, as it was rejected
+	require.NoError(node.VM.AppGossip(ctx, peer.NodeID, msg))
+	require.Eventually(func() bool {
+		return peerGossip().Gossip.DuplicateItems == 1
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Equal(uint64(1), peerGossip().Gossip.InvalidTxs)
+
+	// The stats are forgotten once the peer disconnects
+	require.NoError(node.VM.Disconnected(ctx, peer.NodeID))
+	require.NoError(node.VM.Connected(ctx, peer.NodeID, version.CurrentApp))
+	info = peerGossip()
+	require.Zero(info.BanScore)
+	require.Zero(*info.Gossip)
+}
+
+func TestNetworkPushGossipFallback(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	network := vmtest.NewNetworkWithValidators(t, 3, 1, key, nil)
+	validator, follower1, follower2 := network.Nodes[0], network.Nodes[1], network.Nodes[2]
+	// Pull gossip and the mempool sync are dropped so that transactions only
+	// reach the followers through push gossip
+	network.Router.SetDrop(func(msg vmtest.Message) bool { return msg.Type == vmtest.AppRequest })
+
+	blk, err := network.BuildBlock(ctx, 0)
+	require.NoError(err)
+	tx := spendCoinbase(t, key, blk)
+	txID := tx.TxHash().String()
+
+	// The validator has no validator peer, so it pushes to its other peers
+	sendRawTransaction(t, validator, tx)
+	network.Eventually(func() bool {
+		return inMempool(t, follower1, txID) && inMempool(t, follower2, txID)
+	}, 5*time.Second)
+
+	health, err := validator.VM.HealthCheck(ctx)
+	require.NoError(err)
+	require.Equal(2, health.(map[string]interface{})["connectedPeers"])
+}
+
+func TestNetworkTxGossipToNonValidators(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     []byte
+		toFollower bool
+	}{
+		{"validators only", nil, false},
+		{"non-validators", []byte(`{"txGossipValidatorsOnly":false}`), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+			ctx := context.Background()
+
+			key, err := btcec.NewPrivateKey()
+			require.NoError(err)
+			network := vmtest.NewNetworkWithValidators(t, 3, 2, key, test.config)
+			validatorA, validatorB, follower := network.Nodes[0], network.Nodes[1], network.Nodes[2]
+			// Pull gossip and the mempool sync are dropped so that
+			// transactions only reach the nodes through push gossip
+			network.Router.SetDrop(func(msg vmtest.Message) bool { return msg.Type == vmtest.AppRequest })
+
+			blk, err := network.BuildBlock(ctx, 0)
+			require.NoError(err)
+			tx := spendCoinbase(t, key, blk)
+			txID := tx.TxHash().String()
+
+			// The validator has a validator peer, so it only pushes to the
+			// follower if transactions are gossiped to non-validators
+			sendRawTransaction(t, validatorA, tx)
+			network.Eventually(func() bool {
+				return inMempool(t, validatorB, txID)
+			}, 5*time.Second)
+			if test.toFollower {
+				network.Eventually(func() bool {
+					return inMempool(t, follower, txID)
+				}, 5*time.Second)
+			} else {
+				time.Sleep(time.Second)
+				require.False(inMempool(t, follower, txID))
+			}
+		})
+	}
+}
+
+func TestNetworkReplaceByFee(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	network := vmtest.NewNetwork(t, 2, key, []byte(`{"mempoolFullRBF":true}`))
+	nodeA, nodeB := network.Nodes[0], network.Nodes[1]
+	// Pull gossip and the mempool sync are dropped so that transactions only
+	// reach node B through push gossip
+	network.Router.SetDrop(func(msg vmtest.Message) bool { return msg.Type == vmtest.AppRequest })
+
+	blk, err := network.BuildBlock(ctx, 0)
+	require.NoError(err)
+	var msgBlock wire.MsgBlock
+	require.NoError(msgBlock.Deserialize(bytes.NewReader(blk.Bytes())))
+	coinbase := msgBlock.Transactions[0]
+
+	// A transaction which doesn't signal replaceability and its child
+	original := splitOutput(t, key, coinbase, 0, 1)
+	child := splitOutput(t, key, original, 0, 1)
+	originalID, childID := original.TxHash().String(), child.TxHash().String()
+	sendRawTransaction(t, nodeA, original)
+	sendRawTransaction(t, nodeA, child)
+	network.Eventually(func() bool {
+		return inMempool(t, nodeB, originalID) && inMempool(t, nodeB, childID)
+	}, 5*time.Second)
+
+	// A replacement which doesn't pay for the child is rejected
+	var buf bytes.Buffer
+	require.NoError(splitOutputWithFee(t, key, coinbase, 0, 2, 15_000).Serialize(&buf))
+	err = nodeA.CallRPC("sendrawtransaction", []interface{}{hex.EncodeToString(buf.Bytes())}, nil)
+	require.ErrorContains(err, "insufficient absolute fee")
+
+	// The replacement evicts both transactions on both nodes
+	replacement := splitOutputWithFee(t, key, coinbase, 0, 2, 100_000)
+	replacementID := replacement.TxHash().String()
+	sendRawTransaction(t, nodeA, replacement)
+	for _, node := range network.Nodes {
+		network.Eventually(func() bool {
+			return inMempool(t, node, replacementID) &&
+				!inMempool(t, node, originalID) &&
+				!inMempool(t, node, childID) &&
+				mempoolSize(t, node) == 1
+		}, 5*time.Second)
+	}
+
+	// The replacement can be replaced in turn
+	bump := splitOutputWithFee(t, key, coinbase, 0, 3, 200_000)
+	bumpID := bump.TxHash().String()
+	sendRawTransaction(t, nodeA, bump)
+	network.Eventually(func() bool {
+		return inMempool(t, nodeB, bumpID) && !inMempool(t, nodeB, replacementID)
+	}, 5*time.Second)
+}
+
+func TestNetworkDoubleSpends(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	network := vmtest.NewNetwork(t, 3, key, nil)
+	nodeA, nodeB, nodeC := network.Nodes[0], network.Nodes[1], network.Nodes[2]
+	// Pull gossip and the mempool sync are dropped so that transactions only
+	// travel through push gossip
+	network.Router.SetDrop(func(msg vmtest.Message) bool { return msg.Type == vmtest.AppRequest })
+
+	blk, err := network.BuildBlock(ctx, 0)
+	require.NoError(err)
+	var msgBlock wire.MsgBlock
+	require.NoError(msgBlock.Deserialize(bytes.NewReader(blk.Bytes())))
+	coinbase := msgBlock.Transactions[0]
+
+	// Nodes B and C each accept a different spend of the same output before
+	// gossip delivers the other one
+	network.Router.SetLatency(500 * time.Millisecond)
+	spendB := splitOutput(t, key, coinbase, 0, 1)
+	spendC := splitOutput(t, key, coinbase, 0, 2)
+	spendBID, spendCID := spendB.TxHash().String(), spendC.TxHash().String()
+	sendRawTransaction(t, nodeB, spendB)
+	sendRawTransaction(t, nodeC, spendC)
+
+	doubleSpends := func(node *vmtest.Node, txID string) []btcjson.DoubleSpendResult {
+		var result []btcjson.DoubleSpendResult
+		require.NoError(node.CallRPC("getdoublespends", []interface{}{txID}, &result))
+		return result
+	}
+	// Every node reports the spend it rejected as double spending the one
+	// it accepted first
+	for _, node := range network.Nodes {
+		network.Eventually(func() bool {
+			return len(doubleSpends(node, spendBID)) == 1
+		}, 5*time.Second)
+	}
+	for node, accepted := range map[*vmtest.Node]string{nodeB: spendBID, nodeC: spendCID} {
+		doubleSpend := doubleSpends(node, spendBID)[0]
+		require.Equal(accepted, doubleSpend.ConflictTxID)
+		require.True(inMempool(t, node, accepted))
+	}
+	doubleSpend := doubleSpends(nodeA, spendCID)[0]
+	require.ElementsMatch([]string{spendBID, spendCID}, []string{doubleSpend.TxID, doubleSpend.ConflictTxID})
+	require.True(inMempool(t, nodeA, doubleSpend.ConflictTxID))
+	require.Equal([]btcjson.OutPoint{{Hash: coinbase.TxHash().String(), Index: 0}}, doubleSpend.OutPoints)
+	require.False(doubleSpend.Confirmed)
+}
+
+func TestNetworkGossipInfo(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	network := vmtest.NewNetwork(t, 2, key, nil)
+	nodeA, nodeB := network.Nodes[0], network.Nodes[1]
+	// Pull gossip and the mempool sync are dropped so that transactions only
+	// reach node B through push gossip
+	network.Router.SetDrop(func(msg vmtest.Message) bool { return msg.Type == vmtest.AppRequest })
+
+	blk, err := network.BuildBlock(ctx, 0)
+	require.NoError(err)
+	var msgBlock wire.MsgBlock
+	require.NoError(msgBlock.Deserialize(bytes.NewReader(blk.Bytes())))
+	coinbase := msgBlock.Transactions[0]
+
+	gossipInfo := func(node *vmtest.Node) btcjson.GetGossipInfoResult {
+		var result btcjson.GetGossipInfoResult
+		require.NoError(node.CallRPC("getgossipinfo", nil, &result))
+		return result
+	}
+	before := gossipInfo(nodeA)
+	require.Positive(before.Bloom.Size)
+	require.Positive(before.Bloom.MaxElements)
+	require.Positive(before.Bloom.FalsePositiveRate)
+
+	split := splitOutput(t, key, coinbase, 0, 2)
+	txs := []*wire.MsgTx{split, splitOutput(t, key, split, 0, 1), splitOutput(t, key, split, 1, 1)}
+	for _, tx := range txs {
+		sendRawTransaction(t, nodeA, tx)
+	}
+	network.Eventually(func() bool {
+		for _, tx := range txs {
+			if !inMempool(t, nodeB, tx.TxHash().String()) {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second)
+
+	// Node A pushed the transactions, which node B received and added to its
+	// bloom filter
+	infoA := gossipInfo(nodeA)
+	require.GreaterOrEqual(infoA.Push.Items, uint64(len(txs)))
+	require.Positive(infoA.Push.Bytes)
+	require.NotZero(infoA.Push.LastCycle)
+	require.Positive(infoA.BytesSent)
+
+	infoB := gossipInfo(nodeB)
+	require.Positive(infoB.BytesReceived)
+	require.GreaterOrEqual(infoB.Bloom.Elements, int64(len(txs)))
+	require.Zero(infoB.Pull.Items)
+}
+
+func TestNetworkFollowerNode(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	// Both nodes are polled until the follower's transaction is mined
+	network := vmtest.NewNetworkWithNodeConfigs(t, key,
+		[]byte(`{"rpcLimits":{"requestBurst":1000}}`),
+		[]byte(`{"rpcLimits":{"requestBurst":1000},"disableBlockBuilding":true}`),
+	)
+	builder, follower := network.Nodes[0], network.Nodes[1]
+
+	health, err := follower.VM.HealthCheck(ctx)
+	require.NoError(err)
+	require.Equal("follower", health.(map[string]interface{})["role"])
+	health, err = builder.VM.HealthCheck(ctx)
+	require.NoError(err)
+	require.Equal("builder", health.(map[string]interface{})["role"])
+
+	_, err = network.BuildBlock(ctx, 1)
+	require.ErrorIs(err, vm.ErrBlockBuildingDisabled)
+
+	// A transaction submitted to the follower is gossiped to the builder,
+	// whose block including it the follower accepts
+	blk, err := network.BuildBlock(ctx, 0)
+	require.NoError(err)
+	tx := spendCoinbase(t, key, blk)
+	txID := tx.TxHash().String()
+	sendRawTransaction(t, follower, tx)
+	network.Eventually(func() bool {
+		return inMempool(t, builder, txID)
+	}, 10*time.Second)
+
+	network.Start()
+	network.Eventually(func() bool {
+		return !inMempool(t, builder, txID) && !inMempool(t, follower, txID)
+	}, 10*time.Second)
+
+	var builderHash, followerHash string
+	require.NoError(builder.CallRPC("getbestblockhash", nil, &builderHash))
+	require.NoError(follower.CallRPC("getbestblockhash", nil, &followerHash))
+	require.Equal(builderHash, followerHash)
+
+	var block btcjson.GetBlockVerboseResult
+	require.NoError(follower.CallRPC("getblock", []interface{}{followerHash, 1}, &block))
+	require.Contains(block.Tx, txID)
+}
+
+func TestNetworkBlockBytes(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	network := vmtest.NewNetwork(t, 3, key, nil)
+	builder, gossiped := network.Nodes[0], network.Nodes[2]
+
+	blk, err := network.BuildBlock(ctx, 0)
+	require.NoError(err)
+	sendRawTransaction(t, builder, spendCoinbase(t, key, blk))
+
+	// Node C only receives the next block through gossip
+	network.Router.SetDrop(func(msg vmtest.Message) bool {
+		return msg.Type == vmtest.Block && msg.To == gossiped.NodeID
+	})
+	blk, err = network.BuildBlock(ctx, 0)
+	require.NoError(err)
+	network.Eventually(func() bool {
+		_, err := vm.NewBlockAdapterFromID(gossiped.VM, blk.ID())
+		return err == nil
+	}, 5*time.Second)
+
+	// Every node returns the bytes the block was built with, whether the
+	// block is cached or fetched from the database
+	for _, node := range network.Nodes {
+		cached, err := node.VM.GetBlock(ctx, blk.ID())
+		require.NoError(err)
+		require.Equal(blk.Bytes(), cached.Bytes())
+
+		stored, err := vm.NewBlockAdapterFromID(node.VM, blk.ID())
+		require.NoError(err)
+		require.Equal(blk.Bytes(), stored.Bytes())
+
+		parsed, err := node.VM.ParseBlock(ctx, blk.Bytes())
+		require.NoError(err)
+		require.Equal(blk.ID(), parsed.ID())
+		require.Equal(blk.Bytes(), parsed.Bytes())
+	}
+}
+
+func TestNetworkNoSiblingOnPreferenceChange(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	network := vmtest.NewNetwork(t, 2, key, nil)
+	nodeB := network.Nodes[1]
+
+	blk, err := network.BuildBlock(ctx, 0)
+	require.NoError(err)
+	tx := spendCoinbase(t, key, blk)
+	sendRawTransaction(t, nodeB, tx)
+	network.Eventually(func() bool {
+		return inMempool(t, network.Nodes[0], tx.TxHash().String())
+	}, 10*time.Second)
+
+	// Node B waits for the building delay of the block it just accepted
+	events := make(chan error, 1)
+	go func() {
+		_, err := nodeB.VM.WaitForEvent(ctx)
+		events <- err
+	}()
+	time.Sleep(vm.TargetBlockTime / 4)
+
+	// Node A's block including the transaction is accepted meanwhile, so
+	// node B has nothing left to build on it
+	blkA, err := network.BuildBlock(ctx, 0)
+	require.NoError(err)
+	select {
+	case err := <-events:
+		require.FailNow("node B asked to build a block", "err: %v", err)
+	case <-time.After(2 * vm.TargetBlockTime):
+	}
+
+	// A later transaction is built on node A's block rather than competing
+	// with it
+	sendRawTransaction(t, nodeB, spendCoinbase(t, key, blkA))
+	require.NoError(<-events)
+	blk, err = network.BuildBlock(ctx, 1)
+	require.NoError(err)
+	require.Equal(blkA.ID(), blk.Parent())
+}
@@ -0,0 +1,48 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/mempool"
+)
+
+// initializeOrphanPool registers the metrics of the orphan pool, which holds
+// the gossiped transactions whose parents have not arrived yet, and logs the
+// orphans it evicts
+func (vm *VM) initializeOrphanPool() error {
+	orphanTxs := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "orphan_txs",
+		Help: "number of transactions in the orphan pool",
+	}, func() float64 {
+		return float64(vm.btcdAdapter.TxMemPool().OrphanCount())
+	})
+	vm.orphansEvicted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "orphan_txs_evicted",
+		Help: "number of transactions evicted from the orphan pool",
+	}, []string{"reason"})
+	if err := vm.metrics.Register(orphanTxs); err != nil {
+		return fmt.Errorf("failed to register orphan pool metrics: %w", err)
+	}
+	if err := vm.metrics.Register(vm.orphansEvicted); err != nil {
+		return fmt.Errorf("failed to register orphan pool metrics: %w", err)
+	}
+	vm.btcdAdapter.SetOnOrphanEvicted(vm.orphanEvicted)
+	return nil
+}
+
+// orphanEvicted records that tx was evicted from the orphan pool. It is called
+// with the mempool lock held.
+func (vm *VM) orphanEvicted(tx *btcutil.Tx, reason mempool.OrphanEvictionReason) {
+	vm.orphansEvicted.WithLabelValues(string(reason)).Inc()
+	vm.gossipLog.Info("Evicted orphan transaction",
+		zap.Stringer("txID", tx.Hash()),
+		zap.String("reason", string(reason)),
+	)
+}
@@ -0,0 +1,105 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/mempool"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+)
+
+// newTestOrphan returns a transaction spending an output of an unknown
+// transaction, with an output script of scriptSize bytes
+func newTestOrphan(scriptSize int) *btcutil.Tx {
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	prevHash := chainhash.Hash(ids.GenerateTestID())
+	msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, 0), nil, nil))
+	msgTx.AddTxOut(wire.NewTxOut(1000, make([]byte, scriptSize)))
+	return btcutil.NewTx(msgTx)
+}
+
+func TestGossipOrphans(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, []byte(`{"maxOrphanTxs":1,"maxOrphanTxSize":1000}`))[0]
+	require.Equal(1, vm.config.MaxOrphanTxs)
+	require.Equal(1000, vm.config.MaxOrphanTxSize)
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+	txPool := vm.btcdAdapter.TxMemPool()
+
+	var relayed []chainhash.Hash
+	relayTxs := vm.btcdAdapter.OnTxRelay
+	vm.btcdAdapter.OnTxRelay = func(txns []*mempool.TxDesc) {
+		for _, txD := range txns {
+			relayed = append(relayed, *txD.Tx.Hash())
+		}
+		relayTxs(txns)
+	}
+	mempoolInfo := func() btcjson.GetMempoolInfoResult {
+		var result btcjson.GetMempoolInfoResult
+		callRPC(t, handlers["/rpc"], "getmempoolinfo", nil, &result)
+		return result
+	}
+
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(vm.SetPreference(ctx, blk.ID()))
+	require.NoError(blk.Accept(ctx))
+	coinbase := blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx()
+	parent := newTestSpend(t, key, coinbase)
+	child := newTestSpend(t, key, parent.MsgTx())
+
+	// The child arrives first and waits for its parent in the orphan pool
+	require.NoError(vm.btcSet.Add(NewTxGossip(child)))
+	require.False(txPool.IsTransactionInPool(child.Hash()))
+	require.True(txPool.IsOrphanInPool(child.Hash()))
+	require.Empty(relayed)
+	info := mempoolInfo()
+	require.Zero(info.Size)
+	require.Equal(int64(1), info.Orphans)
+
+	// The parent unlocks the child, and both are relayed parent first
+	require.NoError(vm.btcSet.Add(NewTxGossip(parent)))
+	require.True(txPool.IsTransactionInPool(parent.Hash()))
+	require.True(txPool.IsTransactionInPool(child.Hash()))
+	require.Equal([]chainhash.Hash{*parent.Hash(), *child.Hash()}, relayed)
+	info = mempoolInfo()
+	require.Equal(int64(2), info.Size)
+	require.Zero(info.Orphans)
+
+	// A new orphan evicts the previous one from the full orphan pool
+	evicted := vm.orphansEvicted.WithLabelValues(string(mempool.OrphanPoolFull))
+	first, second := newTestOrphan(100), newTestOrphan(100)
+	require.NoError(vm.btcSet.Add(NewTxGossip(first)))
+	require.Zero(testutil.ToFloat64(evicted))
+	require.NoError(vm.btcSet.Add(NewTxGossip(second)))
+	require.Equal(float64(1), testutil.ToFloat64(evicted))
+	require.False(txPool.IsOrphanInPool(first.Hash()))
+	require.True(txPool.IsOrphanInPool(second.Hash()))
+	require.Equal(int64(1), mempoolInfo().Orphans)
+
+	// Orphans larger than the maximum orphan size are rejected
+	large := newTestOrphan(1000)
+	require.Error(vm.btcSet.Add(NewTxGossip(large)))
+	require.False(txPool.HaveTransaction(large.Hash()))
+	require.True(txPool.IsOrphanInPool(second.Hash()))
+}
@@ -0,0 +1,215 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/utils/set"
+	"github.com/MetalBlockchain/metalgo/version"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+)
+
+// connectedPeer is a peer the node is connected to on the Metal network
+type connectedPeer struct {
+	nodeID   ids.NodeID
+	version  *version.Application
+	connTime time.Time
+}
+
+// peerSet tracks the peers the node is connected to on the Metal network,
+// which replaces the legacy peer-to-peer network of btcd
+type peerSet struct {
+	lock  sync.RWMutex
+	peers map[ids.NodeID]connectedPeer
+}
+
+func newPeerSet() *peerSet {
+	return &peerSet{
+		peers: make(map[ids.NodeID]connectedPeer),
+	}
+}
+
+// connected records that the node connected to nodeID at connTime
+func (p *peerSet) connected(nodeID ids.NodeID, nodeVersion *version.Application, connTime time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.peers[nodeID] = connectedPeer{
+		nodeID:   nodeID,
+		version:  nodeVersion,
+		connTime: connTime,
+	}
+}
+
+// disconnected records that the node disconnected from nodeID
+func (p *peerSet) disconnected(nodeID ids.NodeID) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	delete(p.peers, nodeID)
+}
+
+// len returns the number of connected peers
+func (p *peerSet) len() int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return len(p.peers)
+}
+
+// list returns the connected peers sorted by node ID
+func (p *peerSet) list() []connectedPeer {
+	p.lock.RLock()
+	peers := make([]connectedPeer, 0, len(p.peers))
+	for _, peer := range p.peers {
+		peers = append(peers, peer)
+	}
+	p.lock.RUnlock()
+
+	slices.SortFunc(peers, func(a, b connectedPeer) int {
+		return bytes.Compare(a.nodeID[:], b.nodeID[:])
+	})
+	return peers
+}
+
+// initializePeers registers the metrics of the connected peers and tracks the
+// outcomes of the items they push
+func (vm *VM) initializePeers() error {
+	connectedPeers := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "connected_peers",
+		Help: "number of peers connected on the Metal network",
+	}, func() float64 {
+		return float64(vm.peers.len())
+	})
+	if err := vm.metrics.Register(connectedPeers); err != nil {
+		return fmt.Errorf("failed to register peer metrics: %w", err)
+	}
+
+	peerGossip, err := newPeerGossipTracker(
+		vm.nodeConfig.GossipMisbehaviorThreshold,
+		vm.gossipLog,
+		vm.metrics,
+		"btc_gossip",
+	)
+	if err != nil {
+		return err
+	}
+	vm.peerGossip = peerGossip
+	return nil
+}
+
+// fallbackSender sends push gossip to connected non-validator peers when it
+// would otherwise reach no peer because no validator is connected, such as on
+// a single validator subnet or during validator set churn. Otherwise nodes
+// following the chain only learn about new items through pull gossip.
+type fallbackSender struct {
+	common.AppSender
+	vm *VM
+}
+
+func (s *fallbackSender) SendAppGossip(ctx context.Context, config common.SendConfig, msg []byte) error {
+	if numPeers := s.vm.gossipConfig.PushGossipFallbackNumPeers; numPeers > 0 && config.NonValidators == 0 && config.Peers == 0 {
+		if nonValidators, ok := s.vm.nonValidatorPeers(ctx); ok && len(nonValidators) > 0 {
+			rand.Shuffle(len(nonValidators), func(i, j int) {
+				nonValidators[i], nonValidators[j] = nonValidators[j], nonValidators[i]
+			})
+			nodeIDs := set.Of(config.NodeIDs.List()...)
+			nodeIDs.Add(nonValidators[:min(numPeers, len(nonValidators))]...)
+			config.NodeIDs = nodeIDs
+			s.vm.gossipLog.Debug("No validator peer connected, pushing gossip to non-validator peers",
+				zap.Int("numPeers", min(numPeers, len(nonValidators))),
+			)
+		}
+	}
+	return s.AppSender.SendAppGossip(ctx, config, msg)
+}
+
+// nonValidatorPeers returns the connected peers which are not validators, and
+// whether no validator peer is connected
+func (vm *VM) nonValidatorPeers(ctx context.Context) ([]ids.NodeID, bool) {
+	if vm.p2pValidators == nil {
+		return nil, false
+	}
+	var nonValidators []ids.NodeID
+	for _, peer := range vm.peers.list() {
+		if vm.p2pValidators.Has(ctx, peer.nodeID) {
+			return nil, false
+		}
+		nonValidators = append(nonValidators, peer.nodeID)
+	}
+	return nonValidators, true
+}
+
+// userAgent formats nodeVersion as a BIP 14 user agent component
+func userAgent(nodeVersion *version.Application) string {
+	if nodeVersion == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d.%d.%d", nodeVersion.Name, nodeVersion.Major, nodeVersion.Minor, nodeVersion.Patch)
+}
+
+// networkInfo describes the connectivity of the node on the Metal network for
+// the getnetworkinfo RPC command
+func (vm *VM) networkInfo() *btcd.NetworkInfo {
+	peers := vm.peers.list()
+	var validatorPeers int32
+	if vm.p2pValidators != nil {
+		for _, peer := range peers {
+			if vm.p2pValidators.Has(context.Background(), peer.nodeID) {
+				validatorPeers++
+			}
+		}
+	}
+
+	nodeVersion := version.CurrentApp
+	return &btcd.NetworkInfo{
+		Version:    int32(1000000*nodeVersion.Major + 10000*nodeVersion.Minor + 100*nodeVersion.Patch),
+		SubVersion: fmt.Sprintf("/%s/%s:%d.%d.%d/", userAgent(nodeVersion), Name, Version.Major, Version.Minor, Version.Patch),
+		Metal: &btcjson.MetalNetworkInfo{
+			NodeID:         vm.ctx.NodeID.String(),
+			NetworkID:      vm.ctx.NetworkID,
+			SubnetID:       vm.ctx.SubnetID.String(),
+			ChainID:        vm.ctx.ChainID.String(),
+			Peers:          int32(len(peers)),
+			ValidatorPeers: validatorPeers,
+		},
+	}
+}
+
+// peerInfo describes the peers the node is connected to on the Metal network
+// for the getpeerinfo RPC command. Peers are identified by their node ID since
+// their IP addresses are managed by the Metal network.
+func (vm *VM) peerInfo() []*btcjson.GetPeerInfoResult {
+	peers := vm.peers.list()
+	infos := make([]*btcjson.GetPeerInfoResult, 0, len(peers))
+	for i, peer := range peers {
+		gossipInfo, banScore := vm.peerGossip.get(peer.nodeID)
+		infos = append(infos, &btcjson.GetPeerInfoResult{
+			ID:        int32(i),
+			Addr:      peer.nodeID.String(),
+			Services:  fmt.Sprintf("%08d", uint64(wire.SFNodeNetwork|wire.SFNodeWitness)),
+			RelayTxes: true,
+			ConnTime:  peer.connTime.Unix(),
+			Version:   wire.ProtocolVersion,
+			SubVer:    "/" + userAgent(peer.version) + "/",
+			BanScore:  int32(banScore),
+			Gossip:    &gossipInfo,
+		})
+	}
+	return infos
+}
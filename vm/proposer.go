@@ -0,0 +1,74 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"math/rand"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/mining"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
+	"github.com/MetalBlockchain/metalgo/ids"
+)
+
+// proposerMagic prefixes the NodeID of the proposer of a block pushed by an
+// OP_RETURN output of its coinbase. The tag is informational only: blocks
+// are valid with or without it, and its content is not checked against the
+// validator that actually proposed the block.
+var proposerMagic = []byte("btcvm/proposer")
+
+// proposerTag returns the data tagging the coinbase of the blocks built by
+// nodeID
+func proposerTag(nodeID ids.NodeID) []byte {
+	tag := make([]byte, 0, len(proposerMagic)+ids.NodeIDLen)
+	tag = append(tag, proposerMagic...)
+	return append(tag, nodeID.Bytes()...)
+}
+
+// newBlockTemplate returns a template of generator paying to payToAddr, with
+// the NodeID of the node and a random extra nonce pushed to the signature
+// script of its coinbase. Otherwise blocks built on the same parent with the
+// same mining address and transactions, by different nodes or by the same
+// node, may be identical, or differ only by their time.
+func (vm *VM) newBlockTemplate(generator *mining.BlkTmplGenerator, payToAddr btcutil.Address) (*mining.BlockTemplate, error) {
+	return generator.NewBlockTemplateWithExtraData(payToAddr, rand.Uint64(), vm.ctx.NodeID.Bytes())
+}
+
+// blockProposer returns the NodeID tagged in the coinbase of block, and false
+// if the block has no proposer tag
+func blockProposer(block *btcutil.Block) (ids.NodeID, bool) {
+	transactions := block.MsgBlock().Transactions
+	if len(transactions) == 0 {
+		return ids.EmptyNodeID, false
+	}
+	for _, txOut := range transactions[0].TxOut {
+		data, ok := txscript.ExtractNullData(txOut.PkScript)
+		if !ok || len(data) != len(proposerMagic)+ids.NodeIDLen || !bytes.HasPrefix(data, proposerMagic) {
+			continue
+		}
+		nodeID, err := ids.ToNodeID(data[len(proposerMagic):])
+		if err != nil {
+			continue
+		}
+		return nodeID, true
+	}
+	return ids.EmptyNodeID, false
+}
+
+// blockProposerRPC returns the NodeID tagged in the coinbase of block for the
+// getblock RPC command, or an empty string if it has none
+func (vm *VM) blockProposerRPC(block *btcutil.Block) string {
+	nodeID, ok := blockProposer(block)
+	if !ok {
+		return ""
+	}
+	return nodeID.String()
+}
+
+// Proposer returns the NodeID of the validator that built the block, as
+// tagged in its coinbase, and false if the block has no proposer tag
+func (b *BlockAdapter) Proposer() (ids.NodeID, bool) {
+	return b.proposer, b.hasProposer
+}
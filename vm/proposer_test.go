@@ -0,0 +1,143 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
+)
+
+func TestBlockProposer(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vms := newTestVMsWithConfig(t, 2, key, `"rpcUser":"user","rpcPass":"pass"`, nil)
+	server, client := vms[0], vms[1]
+	serverHandlers, err := server.CreateHandlers(ctx)
+	require.NoError(err)
+	clientHandlers, err := client.CreateHandlers(ctx)
+	require.NoError(err)
+
+	// Built blocks are tagged with the NodeID of their builder, which other
+	// nodes read back from the block bytes
+	blk, err := server.BuildBlock(ctx)
+	require.NoError(err)
+	proposer, ok := blk.(*BlockAdapter).Proposer()
+	require.True(ok)
+	require.Equal(server.ctx.NodeID, proposer)
+	parsed, err := client.ParseBlock(ctx, blk.Bytes())
+	require.NoError(err)
+	proposer, ok = parsed.(*BlockAdapter).Proposer()
+	require.True(ok)
+	require.Equal(server.ctx.NodeID, proposer)
+
+	require.NoError(blk.Verify(ctx))
+	require.NoError(server.SetPreference(ctx, blk.ID()))
+	require.NoError(blk.Accept(ctx))
+
+	// getblock reports the proposer of tagged blocks
+	hash := idToHash(blk.ID()).String()
+	var result btcjson.GetBlockVerboseResult
+	callRPC(t, serverHandlers["/rpc"], "getblock", []interface{}{hash, 1}, &result)
+	require.Equal(server.ctx.NodeID.String(), result.Proposer)
+	var txResult btcjson.GetBlockVerboseTxResult
+	callRPC(t, serverHandlers["/rpc"], "getblock", []interface{}{hash, 2}, &txResult)
+	require.Equal(server.ctx.NodeID.String(), txResult.Proposer)
+
+	// The same block without the tag is valid as well, as the tag is
+	// ignored by validation
+	msgBlock := blk.(*BlockAdapter).btcBlock.MsgBlock().Copy()
+	coinbase := msgBlock.Transactions[0]
+	tag := proposerTag(server.ctx.NodeID)
+	for i, txOut := range coinbase.TxOut {
+		if data, ok := txscript.ExtractNullData(txOut.PkScript); ok && bytes.Equal(data, tag) {
+			coinbase.TxOut = append(coinbase.TxOut[:i], coinbase.TxOut[i+1:]...)
+			break
+		}
+	}
+	msgBlock.Header.MerkleRoot = blockchain.CalcMerkleRoot(btcutil.NewBlock(msgBlock).Transactions(), false)
+	untaggedBytes, err := serializeBlock(msgBlock)
+	require.NoError(err)
+	untagged, err := client.ParseBlock(ctx, untaggedBytes)
+	require.NoError(err)
+	require.NotEqual(blk.ID(), untagged.ID())
+	_, ok = untagged.(*BlockAdapter).Proposer()
+	require.False(ok)
+	require.NoError(untagged.Verify(ctx))
+	require.NoError(client.SetPreference(ctx, untagged.ID()))
+	require.NoError(untagged.Accept(ctx))
+
+	// getblock omits the proposer of blocks without the tag, such as the
+	// genesis block
+	result = btcjson.GetBlockVerboseResult{}
+	callRPC(t, clientHandlers["/rpc"], "getblock", []interface{}{client.config.ChainParams.GenesisHash.String(), 1}, &result)
+	require.Empty(result.Proposer)
+}
+
+func TestBuiltBlocksUnique(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vms := newTestVMs(t, 2, key)
+	buildTestChain(t, vms[0], 1)
+	parent, err := vms[0].GetBlock(ctx, vms[0].lastAccepted)
+	require.NoError(err)
+	parsed, err := vms[1].ParseBlock(ctx, parent.Bytes())
+	require.NoError(err)
+	require.NoError(parsed.Verify(ctx))
+	require.NoError(vms[1].SetPreference(ctx, parsed.ID()))
+	require.NoError(parsed.Accept(ctx))
+
+	// Both nodes build on the same parent with the same mining address and
+	// the same mempool
+	spend := newTestSpend(t, key, parent.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx())
+	blocks := make([]*BlockAdapter, len(vms))
+	for i, vm := range vms {
+		_, err := vm.btcdAdapter.TxMemPool().ProcessTransaction(spend, false, false, 0)
+		require.NoError(err)
+		blk, err := vm.BuildBlock(ctx)
+		require.NoError(err)
+		blocks[i] = blk.(*BlockAdapter)
+		require.Equal(parent.ID(), blk.Parent())
+		require.Len(blocks[i].btcBlock.Transactions(), 2)
+
+		// The height stays the first push of the coinbase script, followed
+		// by the extra nonce and the NodeID of the builder
+		coinbase := blocks[i].btcBlock.Transactions()[0]
+		height, err := blockchain.ExtractCoinbaseHeight(coinbase)
+		require.NoError(err)
+		require.EqualValues(2, height)
+		pushes, err := txscript.PushedData(coinbase.MsgTx().TxIn[0].SignatureScript)
+		require.NoError(err)
+		require.Contains(pushes, vm.ctx.NodeID.Bytes())
+	}
+	require.NotEqual(blocks[0].ID(), blocks[1].ID())
+	parsed, err = vms[0].ParseBlock(ctx, blocks[1].Bytes())
+	require.NoError(err)
+	require.NoError(parsed.Verify(ctx))
+
+	// Builds of the same node on the same parent differ as well
+	generator := vms[0].btcdAdapter.GetBlockTemplateGenerator()
+	addr, err := btcutil.DecodeAddress(vms[0].config.MiningAddrs[0], vms[0].config.ChainParams)
+	require.NoError(err)
+	first, err := vms[0].newBlockTemplate(generator, addr)
+	require.NoError(err)
+	second, err := vms[0].newBlockTemplate(generator, addr)
+	require.NoError(err)
+	require.NoError(generator.SetBlockTime(second.Block, first.Block.Header.Timestamp))
+	require.NotEqual(first.Block.BlockHash(), second.Block.BlockHash())
+}
@@ -0,0 +1,166 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/mempool"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/MetalBlockchain/metalgo/cache"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/utils/timer/mockable"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// rejectedEntry records why an item was rejected and until when the
+// rejection is remembered
+type rejectedEntry struct {
+	reason wire.RejectCode
+	expiry time.Time
+}
+
+// rejectedCache remembers recently rejected gossip items so that items
+// replayed by peers, or offered again by pull gossip, are dropped without
+// revalidation. Entries expire after ttl so that an item rejected for a
+// transient reason, such as a mempool conflict, can eventually be retried.
+type rejectedCache struct {
+	ttl   time.Duration
+	clock mockable.Clock
+
+	entries *cache.LRU[ids.ID, rejectedEntry]
+
+	size prometheus.Gauge
+	hits prometheus.Counter
+}
+
+// newRejectedCache creates a cache holding up to size entries for ttl each
+// and registers its metrics under namespace
+func newRejectedCache(
+	size int,
+	ttl time.Duration,
+	registerer prometheus.Registerer,
+	namespace string,
+) (*rejectedCache, error) {
+	c := &rejectedCache{
+		ttl:     ttl,
+		entries: &cache.LRU[ids.ID, rejectedEntry]{Size: size},
+		size: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "rejected_cache_size",
+			Help:      "number of recently rejected item IDs being remembered",
+		}),
+		hits: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rejected_cache_hits",
+			Help:      "number of items dropped because they were recently rejected",
+		}),
+	}
+
+	for _, collector := range []prometheus.Collector{c.size, c.hits} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, fmt.Errorf("failed to register rejected cache metrics: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// Put remembers that the items identified by itemIDs were rejected for reason
+func (c *rejectedCache) Put(reason wire.RejectCode, itemIDs ...ids.ID) {
+	entry := rejectedEntry{
+		reason: reason,
+		expiry: c.clock.Time().Add(c.ttl),
+	}
+	for _, itemID := range itemIDs {
+		c.entries.Put(itemID, entry)
+	}
+	c.size.Set(float64(c.entries.Len()))
+}
+
+// Get returns the reason itemID was rejected if the rejection has not expired.
+// A found rejection is counted as a hit, as the item is dropped for it.
+func (c *rejectedCache) Get(itemID ids.ID) (wire.RejectCode, bool) {
+	reason, ok := c.lookup(itemID)
+	if ok {
+		c.hits.Inc()
+	}
+	return reason, ok
+}
+
+// Contains returns whether itemID was rejected and the rejection has not
+// expired, without counting a hit
+func (c *rejectedCache) Contains(itemID ids.ID) bool {
+	_, ok := c.lookup(itemID)
+	return ok
+}
+
+// lookup returns the reason itemID was rejected if the rejection has not
+// expired, and evicts it otherwise
+func (c *rejectedCache) lookup(itemID ids.ID) (wire.RejectCode, bool) {
+	entry, ok := c.entries.Get(itemID)
+	if !ok {
+		return 0, false
+	}
+
+	if !c.clock.Time().Before(entry.expiry) {
+		c.entries.Evict(itemID)
+		c.size.Set(float64(c.entries.Len()))
+		return 0, false
+	}
+	return entry.reason, true
+}
+
+// Len returns the number of remembered rejections, including expired ones
+// that have not been looked up since expiring
+func (c *rejectedCache) Len() int {
+	return c.entries.Len()
+}
+
+// txRejectReason classifies an error returned by ProcessTransaction. It
+// returns false if the rejection should not be remembered: either the error
+// is not a rule violation, or the transaction only references inputs we do
+// not know about yet and may become valid once its parents arrive.
+func txRejectReason(err error) (wire.RejectCode, bool) {
+	var ruleErr mempool.RuleError
+	if !errors.As(err, &ruleErr) {
+		return 0, false
+	}
+
+	if txRuleErr, ok := ruleErr.Err.(mempool.TxRuleError); ok && txRuleErr.MissingInputs {
+		return 0, false
+	}
+
+	code, _ := mempool.ErrToRejectErr(ruleErr)
+	return code, true
+}
+
+// blockRejectReason classifies an error returned by ProcessBlock. It returns
+// false unless the block violates a consensus rule, or if the violation
+// depends on the time or the state of the node, so that the block may become
+// valid before the rejection expires.
+func blockRejectReason(err error) (wire.RejectCode, bool) {
+	var ruleErr blockchain.RuleError
+	if !errors.As(err, &ruleErr) {
+		return 0, false
+	}
+
+	switch ruleErr.ErrorCode {
+	case blockchain.ErrDuplicateBlock,
+		// The block is only ahead of the clock of the node
+		blockchain.ErrTimeTooNew,
+		// The block is checked against the tip or the checkpoints
+		blockchain.ErrForkTooOld,
+		blockchain.ErrCheckpointTimeTooOld,
+		blockchain.ErrPrevBlockNotBest,
+		blockchain.ErrPreviousBlockUnknown,
+		// The ancestor may be reconsidered
+		blockchain.ErrInvalidAncestorBlock:
+		return 0, false
+	default:
+		return wire.RejectInvalid, true
+	}
+}
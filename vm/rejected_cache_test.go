@@ -0,0 +1,167 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/mempool"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestMempool returns a mempool backed by an empty UTXO set, so every
+// transaction is missing its inputs
+func newTestMempool() *mempool.TxPool {
+	return mempool.New(&mempool.Config{
+		Policy: mempool.Policy{
+			MaxTxVersion:      2,
+			AcceptNonStd:      true,
+			MaxSigOpCostPerTx: blockchain.MaxBlockSigOpsCost / 4,
+		},
+		ChainParams: &btcd.BtcvmTestNetParms,
+		FetchUtxoView: func(tx *btcutil.Tx) (*blockchain.UtxoViewpoint, error) {
+			// Like the chain, report every requested output as missing
+			view := blockchain.NewUtxoViewpoint()
+			for _, txIn := range tx.MsgTx().TxIn {
+				view.Entries()[txIn.PreviousOutPoint] = nil
+			}
+			return view, nil
+		},
+		BestHeight:     func() int32 { return 0 },
+		MedianTimePast: time.Now,
+		IsDeploymentActive: func(uint32) (bool, error) {
+			return true, nil
+		},
+	})
+}
+
+// newTestTx returns a transaction spending an unknown output to an output
+// of the given value
+func newTestTx(value int64) *wire.MsgTx {
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{0x01}, 0), nil, nil))
+	msgTx.AddTxOut(wire.NewTxOut(value, bytes.Repeat([]byte{txscript.OP_TRUE}, 32)))
+	return msgTx
+}
+
+func TestRejectedCacheTTL(t *testing.T) {
+	require := require.New(t)
+
+	c, err := newRejectedCache(16, time.Minute, prometheus.NewRegistry(), "test")
+	require.NoError(err)
+	c.clock.Set(time.Unix(0, 0))
+
+	txID := ids.GenerateTestID()
+	wtxID := ids.GenerateTestID()
+	c.Put(wire.RejectInsufficientFee, txID, wtxID)
+	require.Equal(2, c.Len())
+	require.Equal(float64(2), testutil.ToFloat64(c.size))
+
+	// Membership checks are not counted as hits
+	require.True(c.Contains(wtxID))
+	require.Zero(testutil.ToFloat64(c.hits))
+
+	reason, ok := c.Get(wtxID)
+	require.True(ok)
+	require.Equal(wire.RejectInsufficientFee, reason)
+	require.Equal(float64(1), testutil.ToFloat64(c.hits))
+
+	c.clock.Set(c.clock.Time().Add(time.Minute))
+	require.False(c.Contains(txID))
+	require.Equal(1, c.Len())
+	require.Equal(float64(1), testutil.ToFloat64(c.hits))
+}
+
+func TestRejectedCacheSizeBound(t *testing.T) {
+	require := require.New(t)
+
+	c, err := newRejectedCache(2, time.Minute, prometheus.NewRegistry(), "test")
+	require.NoError(err)
+
+	for i := 0; i < 10; i++ {
+		c.Put(wire.RejectInvalid, ids.GenerateTestID())
+	}
+	require.Equal(2, c.Len())
+	require.Equal(float64(2), testutil.ToFloat64(c.size))
+}
+
+func TestTxRejectReasonMissingInputsExempt(t *testing.T) {
+	require := require.New(t)
+
+	mp := newTestMempool()
+
+	// Spends an output we have never seen
+	msgTx := newTestTx(1000)
+
+	_, err := mp.ProcessTransaction(btcutil.NewTx(msgTx), false, false, 0)
+	require.ErrorContains(err, "orphan transaction")
+
+	_, ok := txRejectReason(err)
+	require.False(ok)
+}
+
+func TestTxRejectReasonOversizedOrphan(t *testing.T) {
+	require := require.New(t)
+
+	mp := newTestMempool()
+
+	// Orphans are allowed, but not larger than the maximum orphan size,
+	// which is zero here
+	msgTx := newTestTx(1000)
+
+	_, err := mp.ProcessTransaction(btcutil.NewTx(msgTx), true, false, 0)
+	require.ErrorContains(err, "orphan transaction size")
+
+	reason, ok := txRejectReason(err)
+	require.True(ok)
+	require.Equal(wire.RejectNonstandard, reason)
+}
+
+func TestTxRejectReasonInvalid(t *testing.T) {
+	require := require.New(t)
+
+	mp := newTestMempool()
+
+	// A negative output value fails sanity checks
+	msgTx := newTestTx(-1)
+
+	_, err := mp.ProcessTransaction(btcutil.NewTx(msgTx), false, false, 0)
+	require.Error(err)
+
+	reason, ok := txRejectReason(err)
+	require.True(ok)
+	require.Equal(wire.RejectInvalid, reason)
+}
+
+func TestBlockRejectReason(t *testing.T) {
+	require := require.New(t)
+
+	for _, code := range []blockchain.ErrorCode{
+		blockchain.ErrDuplicateBlock,
+		blockchain.ErrTimeTooNew,
+		blockchain.ErrForkTooOld,
+		blockchain.ErrCheckpointTimeTooOld,
+		blockchain.ErrPrevBlockNotBest,
+		blockchain.ErrPreviousBlockUnknown,
+		blockchain.ErrInvalidAncestorBlock,
+	} {
+		_, ok := blockRejectReason(blockchain.RuleError{ErrorCode: code})
+		require.False(ok, code.String())
+	}
+
+	reason, ok := blockRejectReason(blockchain.RuleError{ErrorCode: blockchain.ErrBadMerkleRoot})
+	require.True(ok)
+	require.Equal(wire.RejectInvalid, reason)
+}
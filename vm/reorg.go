@@ -0,0 +1,164 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/metalgo/cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// disconnectedBlocksCacheSize is the number of blocks disconnected by reorgs
+// that are remembered to suppress their gossip
+const disconnectedBlocksCacheSize = 1024
+
+// reorgEvent describes a reorganization of the btcd main chain
+type reorgEvent struct {
+	OldTip *btcutil.Block
+	NewTip *btcutil.Block
+	// Disconnected are the blocks removed from the main chain, from the old
+	// tip down
+	Disconnected []*btcutil.Block
+	// Connected are the blocks added to the main chain, up to the new tip
+	Connected []*btcutil.Block
+}
+
+// Depth returns the number of blocks removed from the main chain
+func (e *reorgEvent) Depth() int {
+	return len(e.Disconnected)
+}
+
+// reorgTracker follows the chain notifications of btcd and groups the blocks
+// disconnected and connected by a reorganization into a single event. btcd
+// delivers the notifications synchronously with the chain lock held, so the
+// tracker must not call back into the chain.
+type reorgTracker struct {
+	onReorg func(*reorgEvent)
+
+	lock sync.Mutex
+	// current is the reorganization in progress, nil if there is none
+	current *reorgEvent
+	// disconnected holds the blocks removed from the main chain which have
+	// not been connected again
+	disconnected *cache.LRU[chainhash.Hash, struct{}]
+
+	depth prometheus.Histogram
+}
+
+// newReorgTracker creates a tracker calling onReorg for each completed
+// reorganization and registers its metrics under namespace
+func newReorgTracker(
+	onReorg func(*reorgEvent),
+	registerer prometheus.Registerer,
+	namespace string,
+) (*reorgTracker, error) {
+	t := &reorgTracker{
+		onReorg:      onReorg,
+		disconnected: &cache.LRU[chainhash.Hash, struct{}]{Size: disconnectedBlocksCacheSize},
+		depth: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "reorg_depth",
+			Help:      "number of blocks disconnected from the main chain by a reorg",
+			Buckets:   []float64{1, 2, 3, 4, 6, 8, 16, 32, 64},
+		}),
+	}
+
+	if err := registerer.Register(t.depth); err != nil {
+		return nil, fmt.Errorf("failed to register reorg metrics: %w", err)
+	}
+	return t, nil
+}
+
+// onBlockDisconnected records that block was removed from the main chain
+func (t *reorgTracker) onBlockDisconnected(block *btcutil.Block) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// A disconnect following connects starts a new reorganization
+	if t.current != nil && len(t.current.Connected) > 0 {
+		t.completeLocked()
+	}
+	if t.current == nil {
+		t.current = &reorgEvent{OldTip: block}
+	}
+	t.current.Disconnected = append(t.current.Disconnected, block)
+	t.disconnected.Put(*block.Hash(), struct{}{})
+}
+
+// onBlockConnected records that block was added to the main chain
+func (t *reorgTracker) onBlockConnected(block *btcutil.Block) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.disconnected.Evict(*block.Hash())
+	if t.current != nil {
+		t.current.Connected = append(t.current.Connected, block)
+		t.current.NewTip = block
+	}
+}
+
+// complete reports the reorganization in progress, if any. btcd connects all
+// the blocks of a reorganization before notifying that the block which caused
+// it was accepted.
+func (t *reorgTracker) complete() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.completeLocked()
+}
+
+func (t *reorgTracker) completeLocked() {
+	event := t.current
+	if event == nil || event.NewTip == nil {
+		return
+	}
+	t.current = nil
+
+	t.depth.Observe(float64(event.Depth()))
+	if t.onReorg != nil {
+		t.onReorg(event)
+	}
+}
+
+// isDisconnected returns true if hash was removed from the main chain by a
+// reorganization and has not been connected since
+func (t *reorgTracker) isDisconnected(hash *chainhash.Hash) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	_, ok := t.disconnected.Get(*hash)
+	return ok
+}
+
+// onReorg handles a reorganization of the btcd main chain. It is called when
+// the reorganization completes, without the btcd chain lock held: btcd
+// releases it before sending chain notifications.
+func (vm *VM) onReorg(event *reorgEvent) {
+	vm.ctx.Log.Info("btcd main chain reorganized",
+		zap.Int("depth", event.Depth()),
+		zap.Stringer("oldTip", event.OldTip.Hash()),
+		zap.Int32("oldHeight", event.OldTip.Height()),
+		zap.Stringer("newTip", event.NewTip.Hash()),
+		zap.Int32("newHeight", event.NewTip.Height()),
+	)
+
+	vm.removeBlockFilters(event.Disconnected)
+
+	// The transactions of the disconnected blocks return to the mempool, so
+	// they can be included in the next block
+	if vm.blockBuilder == nil {
+		return
+	}
+	for _, block := range event.Disconnected {
+		if len(block.Transactions()) > 1 {
+			vm.blockBuilder.signalCanBuild()
+			return
+		}
+	}
+}
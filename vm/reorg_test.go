@@ -0,0 +1,168 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// wsNotification is a websocket notification with its parameters left raw
+type wsNotification struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+func TestReorgNotifications(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vms := newTestVMsWithConfig(t, 2, key, `"rpcUser":"user","rpcPass":"pass"`, nil)
+	vm, competitor := vms[0], vms[1]
+	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+
+	// The competing fork pays a different address, so that its blocks differ
+	// from the blocks of vm at the same heights
+	otherKey, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{0x01}, 32))
+	otherAddr, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160(otherKey.PubKey().SerializeCompressed()),
+		&btcd.BtcvmTestNetParms,
+	)
+	require.NoError(err)
+	competitor.config.MiningAddrs = []string{otherAddr.EncodeAddress()}
+
+	// Subscribe to block notifications of vm
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	server := httptest.NewServer(handlers["/ws"])
+	defer server.Close()
+
+	header := http.Header{}
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(err)
+	request.SetBasicAuth("user", "pass")
+	header.Set("Authorization", request.Header.Get("Authorization"))
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	require.NoError(err)
+	defer conn.Close()
+
+	require.NoError(conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "1.0",
+		"method":  "notifyblocks",
+		"params":  []interface{}{},
+		"id":      1,
+	}))
+	// readNotification returns the next message, skipping the filtered block
+	// notifications sent alongside the block notifications
+	readNotification := func() wsNotification {
+		for {
+			require.NoError(conn.SetReadDeadline(time.Now().Add(10 * time.Second)))
+			var ntfn wsNotification
+			require.NoError(conn.ReadJSON(&ntfn))
+			if !strings.HasPrefix(ntfn.Method, "filtered") {
+				return ntfn
+			}
+		}
+	}
+	require.Empty(readNotification().Method)
+
+	// vm builds A1 and A2, which are not accepted yet
+	var forkA []*BlockAdapter
+	for i := 0; i < 2; i++ {
+		blk, err := vm.BuildBlock(ctx)
+		require.NoError(err)
+		require.NoError(blk.Verify(ctx))
+		require.NoError(vm.SetPreference(ctx, blk.ID()))
+		forkA = append(forkA, blk.(*BlockAdapter))
+	}
+
+	// The competitor builds B1, B2 and B3 on the same parent
+	var forkB []*BlockAdapter
+	for i := 0; i < 3; i++ {
+		blk, err := competitor.BuildBlock(ctx)
+		require.NoError(err)
+		require.NoError(blk.Verify(ctx))
+		require.NoError(competitor.SetPreference(ctx, blk.ID()))
+		require.NoError(blk.Accept(ctx))
+		forkB = append(forkB, blk.(*BlockAdapter))
+	}
+
+	// B3 gives the competing fork more work, so btcd reorganizes onto it
+	for _, blk := range forkB {
+		parsed, err := vm.ParseBlock(ctx, blk.Bytes())
+		require.NoError(err)
+		require.NoError(parsed.Verify(ctx))
+	}
+
+	type blockNotification struct {
+		method string
+		hash   string
+	}
+	expected := []blockNotification{
+		{"blockconnected", forkA[0].btcBlock.Hash().String()},
+		{"blockconnected", forkA[1].btcBlock.Hash().String()},
+		{"blockdisconnected", forkA[1].btcBlock.Hash().String()},
+		{"blockdisconnected", forkA[0].btcBlock.Hash().String()},
+		{"blockconnected", forkB[0].btcBlock.Hash().String()},
+		{"blockconnected", forkB[1].btcBlock.Hash().String()},
+		{"blockconnected", forkB[2].btcBlock.Hash().String()},
+	}
+	for _, want := range expected {
+		ntfn := readNotification()
+		var hash string
+		require.NoError(json.Unmarshal(ntfn.Params[0], &hash))
+		require.Equal(want, blockNotification{ntfn.Method, hash})
+
+		// Disconnected blocks list the transactions they reverted
+		if ntfn.Method == "blockdisconnected" {
+			require.Len(ntfn.Params, 4)
+			var txids []string
+			require.NoError(json.Unmarshal(ntfn.Params[3], &txids))
+			blk := forkA[0].btcBlock
+			if hash == forkA[1].btcBlock.Hash().String() {
+				blk = forkA[1].btcBlock
+			}
+			require.Equal([]string{blk.Transactions()[0].Hash().String()}, txids)
+		}
+	}
+
+	// Blocks of the losing fork are no longer gossiped
+	for _, blk := range forkA {
+		require.True(vm.reorgs.isDisconnected(blk.btcBlock.Hash()))
+	}
+	for _, blk := range forkB {
+		require.False(vm.reorgs.isDisconnected(blk.btcBlock.Hash()))
+	}
+
+	// A single reorg of depth 2 was recorded
+	families, err := vm.metrics.Gather()
+	require.NoError(err)
+	var found bool
+	for _, family := range families {
+		if family.GetName() != "reorg_depth" {
+			continue
+		}
+		found = true
+		histogram := family.GetMetric()[0].GetHistogram()
+		require.Equal(uint64(1), histogram.GetSampleCount())
+		require.Equal(float64(2), histogram.GetSampleSum())
+	}
+	require.True(found)
+}
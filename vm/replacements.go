@@ -0,0 +1,61 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+)
+
+// Kinds of transactions evicted from the mempool by a replacement
+const (
+	// replacedConflict is a transaction spending an input of the replacement
+	replacedConflict = "conflict"
+
+	// replacedDescendant is a transaction spending an output of a replaced
+	// transaction
+	replacedDescendant = "descendant"
+)
+
+// initializeReplacements registers the metrics of the transactions evicted
+// from the mempool by replace-by-fee, and logs the evictions
+func (vm *VM) initializeReplacements() error {
+	vm.txsReplaced = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "replaced_txs",
+		Help: "number of transactions evicted from the mempool by a replacement",
+	}, []string{"kind"})
+	if err := vm.metrics.Register(vm.txsReplaced); err != nil {
+		return fmt.Errorf("failed to register replacement metrics: %w", err)
+	}
+	vm.btcdAdapter.SetOnTxReplaced(vm.txReplaced)
+	return nil
+}
+
+// txReplaced records that replaced was evicted from the mempool by
+// replacement. It is called with the mempool lock held.
+func (vm *VM) txReplaced(replaced, replacement *btcutil.Tx) {
+	kind := replacedDescendant
+	spent := make(map[wire.OutPoint]struct{}, len(replacement.MsgTx().TxIn))
+	for _, txIn := range replacement.MsgTx().TxIn {
+		spent[txIn.PreviousOutPoint] = struct{}{}
+	}
+	for _, txIn := range replaced.MsgTx().TxIn {
+		if _, ok := spent[txIn.PreviousOutPoint]; ok {
+			kind = replacedConflict
+			break
+		}
+	}
+
+	vm.txsReplaced.WithLabelValues(kind).Inc()
+	vm.gossipLog.Info("Replaced transaction",
+		zap.Stringer("txID", replaced.Hash()),
+		zap.Stringer("replacementTxID", replacement.Hash()),
+		zap.String("kind", kind),
+	)
+}
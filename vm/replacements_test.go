@@ -0,0 +1,54 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+)
+
+func TestTxReplaced(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, "", []byte(`{"mempoolFullRBF":true}`))[0]
+	require.True(vm.config.MempoolFullRBF)
+	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+	txPool := vm.btcdAdapter.TxMemPool()
+
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(vm.SetPreference(ctx, blk.ID()))
+	require.NoError(blk.Accept(ctx))
+	coinbase := blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx()
+
+	// The parent doesn't signal replaceability, which full RBF ignores
+	parent := newTestSpend(t, key, coinbase)
+	child := newTestSpend(t, key, parent.MsgTx())
+	grandchild := newTestSpend(t, key, child.MsgTx())
+	replacement := newTestSpendWithFee(t, key, coinbase, 100_000)
+	for _, tx := range []*btcutil.Tx{parent, child, grandchild, replacement} {
+		_, err := txPool.ProcessTransaction(tx, false, false, 0)
+		require.NoError(err)
+	}
+	require.False(txPool.HaveTransaction(parent.Hash()))
+	require.False(txPool.HaveTransaction(child.Hash()))
+	require.False(txPool.HaveTransaction(grandchild.Hash()))
+	require.True(txPool.HaveTransaction(replacement.Hash()))
+
+	// The descendants of the conflict are evicted along with it
+	require.Equal(float64(1), testutil.ToFloat64(vm.txsReplaced.WithLabelValues(replacedConflict)))
+	require.Equal(float64(2), testutil.ToFloat64(vm.txsReplaced.WithLabelValues(replacedDescendant)))
+}
@@ -0,0 +1,187 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/metalgo/utils/set"
+)
+
+const bearerPrefix = "Bearer "
+
+// adminRPCMethods change the state of the node in ways that may make it
+// diverge from the network. They may only be called by the clients of tokens
+// without a role.
+var adminRPCMethods = set.Of("invalidateblock", "reconsiderblock")
+
+var (
+	errMissingToken = errors.New("missing bearer token")
+	errInvalidToken = errors.New("invalid bearer token")
+)
+
+// RPCAuthConfig restricts the /rpc and /ws endpoints to clients presenting a
+// bearer token, and the methods they call to those of the role of their
+// token. Without it, the rpcuser and rpclimituser credentials of the btcd
+// config are used.
+type RPCAuthConfig struct {
+	// NoAuth serves every method to every client. It must be set explicitly
+	// and is only meant for dev networks.
+	NoAuth bool `json:"noAuth"`
+
+	// Tokens are the accepted bearer tokens. Several tokens may be valid at
+	// once so that they can be rotated.
+	Tokens []RPCToken `json:"tokens"`
+
+	// PublicRole is the role of clients without a token. If empty, they are
+	// rejected.
+	PublicRole string `json:"publicRole"`
+
+	// Roles are the methods the clients of each role may call
+	Roles map[string]RPCRole `json:"roles"`
+}
+
+// RPCToken is a bearer token and the role of the clients presenting it
+type RPCToken struct {
+	Token string `json:"token"`
+
+	// Role of the clients presenting the token. If empty, they may call any
+	// method, including the admin methods no role may call.
+	Role string `json:"role"`
+}
+
+// RPCRole is the set of methods the clients of a role may call
+type RPCRole struct {
+	// Allow lists the methods of the role. If empty, every method is allowed.
+	Allow []string `json:"allow"`
+
+	// Deny lists methods the role may not call, even if they are allowed
+	Deny []string `json:"deny"`
+}
+
+// Validate checks if the configuration is valid
+func (c *RPCAuthConfig) Validate() error {
+	if c.NoAuth {
+		if len(c.Tokens) > 0 || c.PublicRole != "" {
+			return errors.New("tokens and public role must not be set without authentication")
+		}
+		return nil
+	}
+	if len(c.Tokens) == 0 && c.PublicRole == "" {
+		return errors.New("either tokens, a public role or noAuth must be set")
+	}
+
+	tokens := set.NewSet[string](len(c.Tokens))
+	for i, token := range c.Tokens {
+		if token.Token == "" {
+			return fmt.Errorf("token %d is empty", i)
+		}
+		if tokens.Contains(token.Token) {
+			return fmt.Errorf("token %d is a duplicate", i)
+		}
+		tokens.Add(token.Token)
+		if _, ok := c.Roles[token.Role]; token.Role != "" && !ok {
+			return fmt.Errorf("unknown role %q of token %d", token.Role, i)
+		}
+	}
+	if _, ok := c.Roles[c.PublicRole]; c.PublicRole != "" && !ok {
+		return fmt.Errorf("unknown public role %q", c.PublicRole)
+	}
+
+	for name, role := range c.Roles {
+		for _, method := range append(role.Allow, role.Deny...) {
+			if _, err := btcjson.MethodUsageFlags(method); err != nil {
+				return fmt.Errorf("unknown method %q of role %q", method, name)
+			}
+		}
+		for _, method := range role.Allow {
+			if adminRPCMethods.Contains(method) {
+				return fmt.Errorf("admin method %q may not be allowed to role %q", method, name)
+			}
+		}
+	}
+	return nil
+}
+
+// rpcAuthorizer authenticates RPC clients by their bearer token and returns
+// the methods of their role
+type rpcAuthorizer struct {
+	noAuth bool
+
+	// tokens maps the hash of each token to the methods of its role. Tokens
+	// are compared by hash so that lookups do not leak them through timing.
+	tokens map[[sha256.Size]byte]btcd.RPCMethodFilter
+
+	// public are the methods of clients without a token, nil if they are
+	// rejected
+	public btcd.RPCMethodFilter
+}
+
+// newRPCAuthorizer creates an authorizer for a valid config
+func newRPCAuthorizer(config *RPCAuthConfig) *rpcAuthorizer {
+	roles := make(map[string]btcd.RPCMethodFilter, len(config.Roles)+1)
+	roles[""] = allowAllRPCMethods
+	for name, role := range config.Roles {
+		roles[name] = newRPCMethodFilter(role)
+	}
+
+	a := &rpcAuthorizer{
+		noAuth: config.NoAuth,
+		tokens: make(map[[sha256.Size]byte]btcd.RPCMethodFilter, len(config.Tokens)),
+	}
+	for _, token := range config.Tokens {
+		a.tokens[sha256.Sum256([]byte(token.Token))] = roles[token.Role]
+	}
+	if config.PublicRole != "" {
+		a.public = roles[config.PublicRole]
+	}
+	return a
+}
+
+// authenticate returns the methods the client of r may call
+func (a *rpcAuthorizer) authenticate(r *http.Request) (btcd.RPCMethodFilter, error) {
+	if a.noAuth {
+		return allowAllRPCMethods, nil
+	}
+
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		if a.public == nil {
+			return nil, errMissingToken
+		}
+		return a.public, nil
+	}
+
+	token, ok := strings.CutPrefix(header, bearerPrefix)
+	if !ok {
+		return nil, errInvalidToken
+	}
+	methods, ok := a.tokens[sha256.Sum256([]byte(token))]
+	if !ok {
+		return nil, errInvalidToken
+	}
+	return methods, nil
+}
+
+// newRPCMethodFilter returns a filter of the methods of role, which never
+// includes the admin methods
+func newRPCMethodFilter(role RPCRole) btcd.RPCMethodFilter {
+	allow := set.Of(role.Allow...)
+	deny := set.Of(role.Deny...)
+	return func(method string) bool {
+		return !adminRPCMethods.Contains(method) && !deny.Contains(method) &&
+			(allow.Len() == 0 || allow.Contains(method))
+	}
+}
+
+// allowAllRPCMethods is the filter of clients that may call any method
+func allowAllRPCMethods(string) bool {
+	return true
+}
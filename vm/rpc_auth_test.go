@@ -0,0 +1,195 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+)
+
+// rpcAuthRequest returns an RPC request with the given Authorization header
+func rpcAuthRequest(authorization string, body string) *http.Request {
+	request := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+	return request
+}
+
+func TestRPCAuthTokenRotation(t *testing.T) {
+	require := require.New(t)
+
+	// During a rotation both the old and the new token are accepted
+	config := &RPCAuthConfig{
+		Tokens: []RPCToken{{Token: "old"}, {Token: "new"}},
+	}
+	require.NoError(config.Validate())
+	authorizer := newRPCAuthorizer(config)
+	for _, token := range []string{"old", "new"} {
+		methods, err := authorizer.authenticate(rpcAuthRequest("Bearer "+token, ""))
+		require.NoError(err)
+		require.True(methods("stop"))
+	}
+
+	// Once the old token is removed, it is rejected
+	config.Tokens = []RPCToken{{Token: "new"}}
+	require.NoError(config.Validate())
+	authorizer = newRPCAuthorizer(config)
+	_, err := authorizer.authenticate(rpcAuthRequest("Bearer old", ""))
+	require.ErrorIs(err, errInvalidToken)
+	_, err = authorizer.authenticate(rpcAuthRequest("Bearer new", ""))
+	require.NoError(err)
+
+	// Clients without a token or with other credentials are rejected
+	_, err = authorizer.authenticate(rpcAuthRequest("", ""))
+	require.ErrorIs(err, errMissingToken)
+	_, err = authorizer.authenticate(rpcAuthRequest("Basic bmV3Og==", ""))
+	require.ErrorIs(err, errInvalidToken)
+
+	// Without authentication every client may call every method
+	authorizer = newRPCAuthorizer(&RPCAuthConfig{NoAuth: true})
+	methods, err := authorizer.authenticate(rpcAuthRequest("", ""))
+	require.NoError(err)
+	require.True(methods("stop"))
+}
+
+func TestRPCAuthConfigValidate(t *testing.T) {
+	require := require.New(t)
+
+	roles := map[string]RPCRole{
+		"reader": {Allow: []string{"getblockcount"}, Deny: []string{"getblockhash"}},
+	}
+	require.NoError((&RPCAuthConfig{NoAuth: true}).Validate())
+	require.NoError((&RPCAuthConfig{PublicRole: "reader", Roles: roles}).Validate())
+	require.NoError((&RPCAuthConfig{Tokens: []RPCToken{{Token: "a", Role: "reader"}}, Roles: roles}).Validate())
+
+	for _, config := range []*RPCAuthConfig{
+		// Authentication must be disabled explicitly
+		{},
+		{NoAuth: true, Tokens: []RPCToken{{Token: "a"}}},
+		{NoAuth: true, PublicRole: "reader", Roles: roles},
+		{Tokens: []RPCToken{{Token: ""}}},
+		{Tokens: []RPCToken{{Token: "a"}, {Token: "a"}}},
+		{Tokens: []RPCToken{{Token: "a", Role: "writer"}}, Roles: roles},
+		{PublicRole: "writer", Roles: roles},
+		{PublicRole: "reader", Roles: map[string]RPCRole{"reader": {Allow: []string{"nosuchmethod"}}}},
+		{PublicRole: "reader", Roles: map[string]RPCRole{"reader": {Allow: []string{"invalidateblock"}}}},
+	} {
+		require.Error(config.Validate(), "%+v", config)
+	}
+
+	config := Config{
+		BlockMaxWeight: 3_000_000,
+		BlockMaxSize:   750_000,
+		DbType:         "ffldb",
+		RPCAuth:        &RPCAuthConfig{},
+		RPCLimits:      defaultRPCLimitsConfig(1000),
+	}
+	require.Error(config.Validate())
+}
+
+func TestRPCAuthMethods(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	configBytes := []byte(`{"rpcAuth":{
+		"tokens":[{"token":"admin-token"},{"token":"reader-token","role":"reader"}],
+		"publicRole":"public",
+		"roles":{
+			"reader":{"deny":["generatetoaddress","stop"]},
+			"public":{"allow":["getblockcount","getblockhash"]}
+		}
+	}}`)
+	vm := newTestVMsWithConfig(t, 1, key, "", configBytes)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+
+	post := func(authorization string, body string) (int, []byte) {
+		recorder := httptest.NewRecorder()
+		handlers["/rpc"].ServeHTTP(recorder, rpcAuthRequest(authorization, body))
+		return recorder.Code, recorder.Body.Bytes()
+	}
+	call := func(authorization string, method string) (int, batchResponse) {
+		code, body := post(authorization, `{"jsonrpc":"1.0","id":1,"method":"`+method+`","params":[]}`)
+		var response batchResponse
+		require.NoError(json.Unmarshal(body, &response))
+		return code, response
+	}
+	requireAllowed := func(authorization string, method string) {
+		code, response := call(authorization, method)
+		require.Equal(http.StatusOK, code, method)
+		require.Nil(response.Error, method)
+	}
+	requireUnauthorized := func(authorization string, method string) {
+		code, response := call(authorization, method)
+		require.Equal(http.StatusUnauthorized, code, method)
+		require.NotNil(response.Error, method)
+		require.Equal(btcjson.ErrRPCInvalidRequest.Code, response.Error.Code, method)
+	}
+
+	requireAllowed("Bearer admin-token", "getbestblockhash")
+	requireAllowed("Bearer reader-token", "getbestblockhash")
+	requireAllowed("", "getblockcount")
+
+	// A valid token does not allow the methods its role denies
+	requireUnauthorized("Bearer reader-token", "stop")
+	requireUnauthorized("", "getbestblockhash")
+	requireUnauthorized("Bearer wrong-token", "getblockcount")
+
+	// Denied entries of a batch fail on their own
+	code, body := post("Bearer reader-token", `[
+		{"jsonrpc":"2.0","id":1,"method":"getblockcount","params":[]},
+		{"jsonrpc":"2.0","id":2,"method":"stop","params":[]}
+	]`)
+	require.Equal(http.StatusOK, code)
+	var responses []batchResponse
+	require.NoError(json.Unmarshal(body, &responses))
+	require.Len(responses, 2)
+	require.Nil(responses[0].Error)
+	require.NotNil(responses[1].Error)
+	require.Equal(btcjson.ErrRPCInvalidRequest.Code, responses[1].Error.Code)
+
+	// Websocket clients are authenticated when connecting
+	server := httptest.NewServer(handlers["/ws"])
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	_, response, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer wrong-token"}})
+	require.Error(err)
+	require.Equal(http.StatusUnauthorized, response.StatusCode)
+	response.Body.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer reader-token"}})
+	require.NoError(err)
+	defer conn.Close()
+	for _, method := range []string{"getblockcount", "stop"} {
+		require.NoError(conn.WriteJSON(map[string]interface{}{
+			"jsonrpc": "1.0",
+			"method":  method,
+			"params":  []interface{}{},
+			"id":      1,
+		}))
+		require.NoError(conn.SetReadDeadline(time.Now().Add(10 * time.Second)))
+		var response batchResponse
+		require.NoError(conn.ReadJSON(&response))
+		if method == "stop" {
+			require.NotNil(response.Error)
+			require.Equal(btcjson.ErrRPCInvalidRequest.Code, response.Error.Code)
+		} else {
+			require.Nil(response.Error)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+)
+
+// batchResponse is a response to an entry of a batched request
+type batchResponse struct {
+	ID     json.RawMessage   `json:"id"`
+	Result json.RawMessage   `json:"result"`
+	Error  *btcjson.RPCError `json:"error"`
+}
+
+func TestRPCBatch(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass","rpcMaxBatchSize":3,"rpcBatchParallelism":2`, nil)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	buildTestChain(t, vm, 1)
+
+	postBatch := func(body string) []byte {
+		request := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+		request.SetBasicAuth("user", "pass")
+		recorder := httptest.NewRecorder()
+		handlers["/rpc"].ServeHTTP(recorder, request)
+		require.Equal(http.StatusOK, recorder.Code)
+		return recorder.Body.Bytes()
+	}
+
+	// Failed entries do not fail the batch, and responses are in the order of
+	// the requests
+	var responses []batchResponse
+	require.NoError(json.Unmarshal(postBatch(` [
+		{"jsonrpc":"2.0","id":1,"method":"getblockcount","params":[]},
+		{"jsonrpc":"2.0","id":2,"method":"nosuchmethod","params":[]},
+		{"jsonrpc":"2.0","id":3,"method":"getblockhash","params":[0]}
+	]`), &responses))
+	require.Len(responses, 3)
+	for i, response := range responses {
+		require.JSONEq(strconv.Itoa(i+1), string(response.ID))
+	}
+	require.Nil(responses[0].Error)
+	require.JSONEq(`1`, string(responses[0].Result))
+	require.NotNil(responses[1].Error)
+	require.Equal(btcjson.ErrRPCMethodNotFound.Code, responses[1].Error.Code)
+	require.Nil(responses[2].Error)
+	require.JSONEq(`"`+btcd.BtcvmTestNetParms.GenesisHash.String()+`"`, string(responses[2].Result))
+
+	// Batches above the max size are rejected as a whole
+	var response batchResponse
+	require.NoError(json.Unmarshal(postBatch(`[
+		{"jsonrpc":"2.0","id":1,"method":"getblockcount","params":[]},
+		{"jsonrpc":"2.0","id":2,"method":"getblockcount","params":[]},
+		{"jsonrpc":"2.0","id":3,"method":"getblockcount","params":[]},
+		{"jsonrpc":"2.0","id":4,"method":"getblockcount","params":[]}
+	]`), &response))
+	require.NotNil(response.Error)
+	require.Equal(btcjson.ErrRPCInvalidRequest.Code, response.Error.Code)
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+)
+
+func TestGetBlockHeaders(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, nil)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	buildTestChain(t, vm, 3)
+
+	// The batch returns the same headers as getblockheader, with the next
+	// hash of the last header
+	var headers []btcjson.GetBlockHeaderVerboseResult
+	callRPC(t, handlers["/rpc"], "getblockheaders", []interface{}{1, 2}, &headers)
+	require.Len(headers, 2)
+	for i, header := range headers {
+		require.Equal(int32(i+1), header.Height)
+		var single btcjson.GetBlockHeaderVerboseResult
+		callRPC(t, handlers["/rpc"], "getblockheader", []interface{}{header.Hash}, &single)
+		require.Equal(single, header)
+	}
+	require.Equal(headers[1].Hash, headers[0].NextHash)
+	require.NotEmpty(headers[1].NextHash)
+
+	// Fewer headers are returned when the main chain ends first, and the
+	// serialized headers are those of the blocks
+	var hexHeaders []string
+	callRPC(t, handlers["/rpc"], "getblockheaders", []interface{}{2, 10, false}, &hexHeaders)
+	require.Len(hexHeaders, 2)
+	blkID, err := vm.GetBlockIDAtHeight(ctx, 3)
+	require.NoError(err)
+	blk, err := vm.GetBlock(ctx, blkID)
+	require.NoError(err)
+	var headerBuf bytes.Buffer
+	require.NoError(blk.(*BlockAdapter).btcBlock.MsgBlock().Header.Serialize(&headerBuf))
+	require.Equal(hex.EncodeToString(headerBuf.Bytes()), hexHeaders[1])
+
+	for _, test := range []struct {
+		params []interface{}
+		code   btcjson.RPCErrorCode
+	}{
+		{params: []interface{}{4, 1}, code: btcjson.ErrRPCOutOfRange},
+		{params: []interface{}{-1, 1}, code: btcjson.ErrRPCOutOfRange},
+		{params: []interface{}{0, 0}, code: btcjson.ErrRPCInvalidParameter},
+		{params: []interface{}{0, 2001}, code: btcjson.ErrRPCInvalidParameter},
+	} {
+		request, err := json.Marshal(map[string]interface{}{
+			"jsonrpc": "1.0",
+			"id":      1,
+			"method":  "getblockheaders",
+			"params":  test.params,
+		})
+		require.NoError(err)
+		var response batchResponse
+		require.NoError(json.Unmarshal(postRPC(handlers["/rpc"], string(request)).Body.Bytes(), &response))
+		require.NotNil(response.Error, test.params)
+		require.Equal(test.code, response.Error.Code, test.params)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+)
+
+func TestGetBlockStats(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, nil)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+
+	// A block with spends of the coinbases of the previous blocks paying
+	// fees of 10,000 and 30,000 satoshis
+	buildTestChain(t, vm, 2)
+	mempool := vm.btcdAdapter.TxMemPool()
+	for i, blk := range acceptedBlocks(t, vm) {
+		prevTx := blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx()
+		tx := newTestSpendWithFee(t, key, prevTx, int64(10_000+i*20_000))
+		_, err := mempool.ProcessTransaction(tx, false, false, 0)
+		require.NoError(err)
+	}
+	buildTestChain(t, vm, 1)
+	blk, err := vm.GetBlock(ctx, vm.lastAccepted)
+	require.NoError(err)
+	btcBlock := blk.(*BlockAdapter).btcBlock
+	require.Len(btcBlock.Transactions(), 3)
+
+	var byHeight, byHash btcjson.GetBlockStatsResult
+	callRPC(t, handlers["/rpc"], "getblockstats", []interface{}{blk.Height()}, &byHeight)
+	callRPC(t, handlers["/rpc"], "getblockstats", []interface{}{btcBlock.Hash().String()}, &byHash)
+	require.Equal(byHeight, byHash)
+	require.Equal(btcBlock.Hash().String(), byHeight.Hash)
+	require.Equal(int64(blk.Height()), byHeight.Height)
+	require.Equal(int64(3), byHeight.Txs)
+	require.Equal(int64(2), byHeight.Ins)
+	require.Equal(int64(40_000), byHeight.TotalFee)
+	require.Equal(int64(20_000), byHeight.AverageFee)
+	require.Equal(int64(20_000), byHeight.MedianFee)
+	require.Equal(int64(10_000), byHeight.MinFee)
+	require.Equal(int64(30_000), byHeight.MaxFee)
+	require.Less(byHeight.MinFeeRate, byHeight.MaxFeeRate)
+	require.Len(byHeight.FeeratePercentiles, 5)
+	require.Equal(int64(1), byHeight.UTXOIncrease)
+	require.Positive(byHeight.TotalWeight)
+
+	// Only the selected statistics are returned
+	var selected map[string]json.RawMessage
+	callRPC(t, handlers["/rpc"], "getblockstats", []interface{}{blk.Height(), []string{"totalfee", "txs"}}, &selected)
+	require.Equal(map[string]json.RawMessage{
+		"totalfee": json.RawMessage("40000"),
+		"txs":      json.RawMessage("3"),
+	}, selected)
+
+	// Blocks without transactions other than the coinbase have no fees
+	var genesis btcjson.GetBlockStatsResult
+	callRPC(t, handlers["/rpc"], "getblockstats", []interface{}{0}, &genesis)
+	require.Equal(int64(1), genesis.Txs)
+	require.Zero(genesis.TotalFee)
+	require.Zero(genesis.Ins)
+
+	for _, test := range []struct {
+		params []interface{}
+		code   btcjson.RPCErrorCode
+	}{
+		{params: []interface{}{blk.Height() + 1}, code: btcjson.ErrRPCInvalidParameter},
+		{params: []interface{}{-1}, code: btcjson.ErrRPCInvalidParameter},
+		{params: []interface{}{chainhash.Hash{}.String()}, code: btcjson.ErrRPCBlockNotFound},
+		{params: []interface{}{0, []string{"txs", "unknown"}}, code: btcjson.ErrRPCInvalidParameter},
+	} {
+		request, err := json.Marshal(map[string]interface{}{
+			"jsonrpc": "1.0",
+			"id":      1,
+			"method":  "getblockstats",
+			"params":  test.params,
+		})
+		require.NoError(err)
+		var response batchResponse
+		require.NoError(json.Unmarshal(postRPC(handlers["/rpc"], string(request)).Body.Bytes(), &response))
+		require.NotNil(response.Error, test.params)
+		require.Equal(test.code, response.Error.Code, test.params)
+	}
+}
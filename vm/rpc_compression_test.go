@@ -0,0 +1,91 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+)
+
+func TestRPCCompression(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, nil)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	buildTestChain(t, vm, 1)
+
+	var blockHash string
+	callRPC(t, handlers["/rpc"], "getbestblockhash", []interface{}{}, &blockHash)
+	getBlock := `{"jsonrpc":"1.0","id":1,"method":"getblock","params":["` + blockHash + `",2]}`
+	post := func(body string, acceptEncoding string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+		request.SetBasicAuth("user", "pass")
+		request.Header.Set("Accept-Encoding", acceptEncoding)
+		recorder := httptest.NewRecorder()
+		handlers["/rpc"].ServeHTTP(recorder, request)
+		require.Equal(http.StatusOK, recorder.Code)
+		return recorder
+	}
+
+	// Clients not accepting gzip get the plain reply
+	plain := post(getBlock, "")
+	require.Empty(plain.Header().Get("Content-Encoding"))
+	var response batchResponse
+	require.NoError(json.Unmarshal(plain.Body.Bytes(), &response))
+	require.Nil(response.Error)
+	var block btcjson.GetBlockVerboseResult
+	require.NoError(json.Unmarshal(response.Result, &block))
+	require.Equal(blockHash, block.Hash)
+	require.Len(block.RawTx, 1)
+
+	// Clients accepting gzip get the same reply compressed
+	compressed := post(getBlock, "gzip")
+	require.Equal("gzip", compressed.Header().Get("Content-Encoding"))
+	reader, err := gzip.NewReader(compressed.Body)
+	require.NoError(err)
+	decompressed, err := io.ReadAll(reader)
+	require.NoError(err)
+	require.Equal(plain.Body.String(), string(decompressed))
+
+	// Small replies are not worth compressing
+	small := post(`{"jsonrpc":"1.0","id":2,"method":"getblockcount","params":[]}`, "gzip")
+	require.Empty(small.Header().Get("Content-Encoding"))
+	require.JSONEq(`{"jsonrpc":"1.0","result":1,"error":null,"id":2}`, small.Body.String())
+
+	// Websocket replies are neither compressed nor streamed
+	server := httptest.NewServer(handlers["/ws"])
+	defer server.Close()
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(err)
+	request.SetBasicAuth("user", "pass")
+	header := http.Header{}
+	header.Set("Authorization", request.Header.Get("Authorization"))
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	require.NoError(err)
+	defer conn.Close()
+
+	require.NoError(conn.WriteMessage(websocket.TextMessage, []byte(getBlock)))
+	require.NoError(conn.SetReadDeadline(time.Now().Add(10 * time.Second)))
+	var wsResponse batchResponse
+	require.NoError(conn.ReadJSON(&wsResponse))
+	require.Nil(wsResponse.Error)
+	require.JSONEq(string(response.Result), string(wsResponse.Result))
+}
@@ -0,0 +1,396 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/MetalBlockchain/metalgo/cache"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/MetalBlockchain/metalgo/utils/timer/mockable"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+)
+
+const (
+	// maxRateLimitedRPCClients bounds the number of per-IP token buckets kept
+	// in memory, evicting the least recently seen clients first
+	maxRateLimitedRPCClients = 4096
+
+	defaultRPCRequestsPerSecond     = 50
+	defaultRPCRequestBurst          = 100
+	defaultRPCMaxConcurrentRequests = 16
+
+	// defaultRPCMaxRequestBytes fits a submitblock call with a block of the
+	// max weight
+	defaultRPCMaxRequestBytes = 10 * 1024 * 1024 // 10 MiB
+
+	// defaultRPCMaxResponseBytes fits the serialized hex of any block, so
+	// that verbose getblock calls can always fall back to it
+	defaultRPCMaxResponseBytes = 16 * 1024 * 1024 // 16 MiB
+)
+
+// Names of the limits, used as the label of the limited requests metric
+const (
+	rpcLimitRate            = "rate"
+	rpcLimitConcurrency     = "concurrency"
+	rpcLimitRequestSize     = "request_size"
+	rpcLimitResponseSize    = "response_size"
+	rpcLimitGetBlockVerbose = "getblock_verbose"
+)
+
+var batchedRequestPrefix = []byte("[")
+
+// RPCLimitsConfig bounds the load each client may put on the RPC endpoints.
+// Clients are told apart by their IP address.
+type RPCLimitsConfig struct {
+	// RequestsPerSecond is the sustained number of requests accepted per
+	// client. Each entry of a batch and each websocket connection counts as a
+	// request.
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+
+	// RequestBurst is the maximum number of requests a client may send in a
+	// burst
+	RequestBurst int `json:"requestBurst"`
+
+	// MaxConcurrentRequests is the maximum number of HTTP requests of a
+	// client processed at once
+	MaxConcurrentRequests int `json:"maxConcurrentRequests"`
+
+	// MaxRequestBytes is the maximum size of the body of an HTTP request
+	MaxRequestBytes int64 `json:"maxRequestBytes"`
+
+	// MaxResponseBytes is the maximum size of the response to an HTTP
+	// request. Verbose getblock responses above it are replaced by the
+	// serialized block, and other responses by an error.
+	MaxResponseBytes int `json:"maxResponseBytes"`
+
+	// MaxWebsocketSubscriptions is the maximum number of addresses and
+	// outpoints a websocket connection may request notifications for
+	MaxWebsocketSubscriptions int `json:"maxWebsocketSubscriptions"`
+}
+
+// defaultRPCLimitsConfig returns the default limits, with the max number of
+// websocket subscriptions of the btcd config
+func defaultRPCLimitsConfig(maxWebsocketSubscriptions int) RPCLimitsConfig {
+	return RPCLimitsConfig{
+		RequestsPerSecond:         defaultRPCRequestsPerSecond,
+		RequestBurst:              defaultRPCRequestBurst,
+		MaxConcurrentRequests:     defaultRPCMaxConcurrentRequests,
+		MaxRequestBytes:           defaultRPCMaxRequestBytes,
+		MaxResponseBytes:          defaultRPCMaxResponseBytes,
+		MaxWebsocketSubscriptions: maxWebsocketSubscriptions,
+	}
+}
+
+// Validate checks if the configuration is valid
+func (c *RPCLimitsConfig) Validate() error {
+	if c.RequestsPerSecond <= 0 {
+		return fmt.Errorf("requests per second must be positive, got %f", c.RequestsPerSecond)
+	}
+	if c.RequestBurst <= 0 {
+		return fmt.Errorf("request burst must be positive, got %d", c.RequestBurst)
+	}
+	if c.MaxConcurrentRequests <= 0 {
+		return fmt.Errorf("max concurrent requests must be positive, got %d", c.MaxConcurrentRequests)
+	}
+	if c.MaxRequestBytes <= 0 {
+		return fmt.Errorf("max request bytes must be positive, got %d", c.MaxRequestBytes)
+	}
+	if c.MaxResponseBytes <= 0 {
+		return fmt.Errorf("max response bytes must be positive, got %d", c.MaxResponseBytes)
+	}
+	if c.MaxWebsocketSubscriptions <= 0 {
+		return fmt.Errorf("max websocket subscriptions must be positive, got %d", c.MaxWebsocketSubscriptions)
+	}
+	return nil
+}
+
+// rpcClientLimits holds the request budget of a single client
+type rpcClientLimits struct {
+	requests *tokenBucket
+	inFlight int
+}
+
+// rpcLimiter enforces the RPC limits of each client in front of the btcd
+// handlers
+type rpcLimiter struct {
+	config RPCLimitsConfig
+	log    logging.Logger
+
+	clock mockable.Clock
+
+	lock    sync.Mutex
+	clients *cache.LRU[string, *rpcClientLimits]
+
+	limited *prometheus.CounterVec
+}
+
+// newRPCLimiter creates a limiter and registers its metrics
+func newRPCLimiter(config RPCLimitsConfig, log logging.Logger, registerer prometheus.Registerer) (*rpcLimiter, error) {
+	l := &rpcLimiter{
+		config:  config,
+		log:     log,
+		clients: &cache.LRU[string, *rpcClientLimits]{Size: maxRateLimitedRPCClients},
+		limited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rpc_limited_requests",
+			Help: "number of RPC requests rejected or degraded because the client exceeded a limit",
+		}, []string{"limit"}),
+	}
+	if err := registerer.Register(l.limited); err != nil {
+		return nil, fmt.Errorf("failed to register rpc limit metrics: %w", err)
+	}
+	return l, nil
+}
+
+// limitExceeded records that a client exceeded limit
+func (l *rpcLimiter) limitExceeded(limit string) {
+	l.limited.WithLabelValues(limit).Inc()
+}
+
+// acquire takes numRequests requests from the budget of the client at ip and
+// reserves one of its concurrent requests if concurrent is set. It returns
+// the exceeded limit, if any. Tokens are only consumed when the request is
+// accepted.
+func (l *rpcLimiter) acquire(ip string, numRequests int, concurrent bool) (*rpcClientLimits, string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.clock.Time()
+	client, ok := l.clients.Get(ip)
+	if !ok {
+		client = &rpcClientLimits{
+			requests: newTokenBucket(l.config.RequestsPerSecond, l.config.RequestBurst, now),
+		}
+		l.clients.Put(ip, client)
+	}
+
+	client.requests.refill(now)
+	if client.requests.tokens < float64(numRequests) {
+		return nil, rpcLimitRate
+	}
+	if concurrent && client.inFlight >= l.config.MaxConcurrentRequests {
+		return nil, rpcLimitConcurrency
+	}
+
+	client.requests.tokens -= float64(numRequests)
+	if concurrent {
+		client.inFlight++
+	}
+	return client, ""
+}
+
+// release frees the concurrent request reserved by acquire. The client may
+// have been evicted in the meantime, which only resets it.
+func (l *rpcLimiter) release(client *rpcClientLimits) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	client.inFlight--
+}
+
+// reject records that the client of r exceeded limit and replies with a
+// JSON-RPC error
+func (l *rpcLimiter) reject(w http.ResponseWriter, r *http.Request, status int, limit string, message string) {
+	l.limitExceeded(limit)
+	l.log.Debug("rejecting RPC request of limited client",
+		zap.String("remoteAddr", r.RemoteAddr),
+		zap.String("limit", limit),
+	)
+	writeRPCLimitError(w, status, nil, message)
+}
+
+// wrapRPC limits the requests served by the HTTP POST handler
+func (l *rpcLimiter) wrapRPC(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, l.config.MaxRequestBytes+1))
+		r.Body.Close()
+		if err != nil {
+			errCode := http.StatusBadRequest
+			http.Error(w, fmt.Sprintf("%d error reading JSON message: %v", errCode, err), errCode)
+			return
+		}
+		if int64(len(body)) > l.config.MaxRequestBytes {
+			l.reject(w, r, http.StatusRequestEntityTooLarge, rpcLimitRequestSize,
+				fmt.Sprintf("Request exceeds the max size of %d bytes", l.config.MaxRequestBytes))
+			return
+		}
+
+		client, limit := l.acquire(clientIP(r), numRequests(body), true)
+		if limit != "" {
+			l.reject(w, r, http.StatusTooManyRequests, limit, "Too many requests")
+			return
+		}
+		defer l.release(client)
+
+		response := l.serve(handler, r, body)
+		if response.overflow {
+			response = l.replaceLargeResponse(handler, r, body)
+		}
+		response.writeTo(w)
+	})
+}
+
+// wrapWebsocket limits the connections accepted by the websocket handler.
+// Each connection counts as a request, and the subscriptions of a connection
+// are limited by btcd.
+func (l *rpcLimiter) wrapWebsocket(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, limit := l.acquire(clientIP(r), 1, false); limit != "" {
+			l.reject(w, r, http.StatusTooManyRequests, limit, "Too many requests")
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// serve runs handler on a request with body and buffers its response
+func (l *rpcLimiter) serve(handler http.Handler, r *http.Request, body []byte) *bufferedResponse {
+	response := &bufferedResponse{
+		header:   make(http.Header),
+		status:   http.StatusOK,
+		maxBytes: l.config.MaxResponseBytes,
+	}
+	r = r.Clone(r.Context())
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	handler.ServeHTTP(response, r)
+	return response
+}
+
+// replaceLargeResponse returns the response to a request whose response
+// exceeded the max size: the serialized block for a verbose getblock request,
+// and an error otherwise
+func (l *rpcLimiter) replaceLargeResponse(handler http.Handler, r *http.Request, body []byte) *bufferedResponse {
+	var request btcjson.Request
+	if err := json.Unmarshal(body, &request); err != nil {
+		request = btcjson.Request{}
+	}
+
+	if rawBody, ok := rawGetBlockRequest(&request); ok {
+		l.limitExceeded(rpcLimitGetBlockVerbose)
+		if response := l.serve(handler, r, rawBody); !response.overflow {
+			return response
+		}
+	}
+
+	l.limitExceeded(rpcLimitResponseSize)
+	response := &bufferedResponse{
+		header: make(http.Header),
+		status: http.StatusOK,
+	}
+	writeRPCLimitError(response, http.StatusOK, &request,
+		fmt.Sprintf("Response exceeds the max size of %d bytes", l.config.MaxResponseBytes))
+	return response
+}
+
+// rawGetBlockRequest returns the body of request with a verbosity of 0 if it
+// is a verbose getblock request
+func rawGetBlockRequest(request *btcjson.Request) ([]byte, bool) {
+	if request.Method != "getblock" || len(request.Params) == 0 || len(request.Params) > 2 {
+		return nil, false
+	}
+	if len(request.Params) == 2 {
+		var verbosity int
+		if err := json.Unmarshal(request.Params[1], &verbosity); err != nil || verbosity == 0 {
+			return nil, false
+		}
+	}
+
+	raw := *request
+	raw.Params = []json.RawMessage{request.Params[0], json.RawMessage("0")}
+	body, err := json.Marshal(&raw)
+	if err != nil {
+		return nil, false
+	}
+	return body, true
+}
+
+// writeRPCLimitError replies to request with a JSON-RPC error of a limit
+func writeRPCLimitError(w http.ResponseWriter, status int, request *btcjson.Request, message string) {
+	rpcVersion, id := btcjson.RpcVersion1, interface{}(nil)
+	if request != nil && request.Jsonrpc.IsValid() {
+		rpcVersion, id = request.Jsonrpc, request.ID
+	}
+	reply, err := btcjson.MarshalResponse(rpcVersion, id, nil, &btcjson.RPCError{
+		Code:    btcjson.ErrRPCLimitExceeded,
+		Message: message,
+	})
+	if err != nil {
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(append(reply, '\n'))
+}
+
+// numRequests returns the number of requests in an HTTP request body
+func numRequests(body []byte) int {
+	if !bytes.HasPrefix(bytes.TrimLeft(body, " \t\r\n"), batchedRequestPrefix) {
+		return 1
+	}
+	var batch []json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil || len(batch) == 0 {
+		return 1
+	}
+	return len(batch)
+}
+
+// clientIP returns the IP address the limits of the client of r are keyed by
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// bufferedResponse is an http.ResponseWriter holding a response of up to
+// maxBytes bytes so that it can be replaced before it is sent. Larger
+// responses are discarded, without failing the writes of the handler.
+type bufferedResponse struct {
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	maxBytes int
+	overflow bool
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.overflow {
+		return len(p), nil
+	}
+	if b.maxBytes > 0 && b.body.Len()+len(p) > b.maxBytes {
+		b.overflow = true
+		b.body.Reset()
+		return len(p), nil
+	}
+	return b.body.Write(p)
+}
+
+// writeTo sends the buffered response to w
+func (b *bufferedResponse) writeTo(w http.ResponseWriter) {
+	for key, values := range b.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(b.status)
+	_, _ = w.Write(b.body.Bytes())
+}
@@ -0,0 +1,256 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+)
+
+// postRPC posts body to the /rpc handler with the credentials of the test VMs
+func postRPC(handler http.Handler, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+	request.SetBasicAuth("user", "pass")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// requireLimitError checks that recorder holds a limit error with status
+func requireLimitError(t *testing.T, recorder *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	require.Equal(t, status, recorder.Code)
+	var response batchResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.NotNil(t, response.Error)
+	require.Equal(t, btcjson.ErrRPCLimitExceeded, response.Error.Code)
+}
+
+func TestRPCLimitsConfigValidate(t *testing.T) {
+	require := require.New(t)
+
+	valid := RPCLimitsConfig{
+		RequestsPerSecond:         1,
+		RequestBurst:              1,
+		MaxConcurrentRequests:     1,
+		MaxRequestBytes:           1,
+		MaxResponseBytes:          1,
+		MaxWebsocketSubscriptions: 1,
+	}
+	require.NoError(valid.Validate())
+
+	for _, modify := range []func(*RPCLimitsConfig){
+		func(c *RPCLimitsConfig) { c.RequestsPerSecond = 0 },
+		func(c *RPCLimitsConfig) { c.RequestBurst = 0 },
+		func(c *RPCLimitsConfig) { c.MaxConcurrentRequests = 0 },
+		func(c *RPCLimitsConfig) { c.MaxRequestBytes = 0 },
+		func(c *RPCLimitsConfig) { c.MaxResponseBytes = -1 },
+		func(c *RPCLimitsConfig) { c.MaxWebsocketSubscriptions = 0 },
+	} {
+		config := valid
+		modify(&config)
+		require.Error(config.Validate(), "%+v", config)
+	}
+}
+
+func TestRPCLimitsRequests(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	configBytes := []byte(`{"rpcLimits":{
+		"requestsPerSecond":1,
+		"requestBurst":10,
+		"maxConcurrentRequests":2,
+		"maxRequestBytes":512
+	}}`)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, configBytes)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	vm.rpcLimiter.clock.Set(time.Now())
+
+	// Hammering the handler exhausts the burst, after which requests are
+	// rejected until the bucket refills
+	const numRequests = 30
+	var (
+		wg        sync.WaitGroup
+		recorders = make([]*httptest.ResponseRecorder, numRequests)
+		codes     = make(map[int]int)
+	)
+	for i := range recorders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recorders[i] = postRPC(handlers["/rpc"], `{"jsonrpc":"1.0","id":1,"method":"getblockcount","params":[]}`)
+		}()
+	}
+	wg.Wait()
+	for _, recorder := range recorders {
+		if recorder.Code == http.StatusTooManyRequests {
+			requireLimitError(t, recorder, http.StatusTooManyRequests)
+		}
+		codes[recorder.Code]++
+	}
+	require.Equal(numRequests, codes[http.StatusOK]+codes[http.StatusTooManyRequests])
+	require.LessOrEqual(codes[http.StatusOK], 10)
+	require.GreaterOrEqual(codes[http.StatusTooManyRequests], numRequests-10)
+	rejected := testutil.ToFloat64(vm.rpcLimiter.limited.WithLabelValues(rpcLimitRate)) +
+		testutil.ToFloat64(vm.rpcLimiter.limited.WithLabelValues(rpcLimitConcurrency))
+	require.Equal(float64(codes[http.StatusTooManyRequests]), rejected)
+
+	// Once every token is spent, one request is accepted per second
+	for codes[http.StatusOK] < 10 {
+		require.Equal(http.StatusOK, postRPC(handlers["/rpc"], `{"jsonrpc":"1.0","id":1,"method":"getblockcount","params":[]}`).Code)
+		codes[http.StatusOK]++
+	}
+	requireLimitError(t, postRPC(handlers["/rpc"], `{"jsonrpc":"1.0","id":1,"method":"getblockcount","params":[]}`), http.StatusTooManyRequests)
+	vm.rpcLimiter.clock.Set(vm.rpcLimiter.clock.Time().Add(time.Second))
+	require.Equal(http.StatusOK, postRPC(handlers["/rpc"], `{"jsonrpc":"1.0","id":1,"method":"getblockcount","params":[]}`).Code)
+
+	// Each entry of a batch counts as a request
+	batch := `[
+		{"jsonrpc":"2.0","id":1,"method":"getblockcount","params":[]},
+		{"jsonrpc":"2.0","id":2,"method":"getblockcount","params":[]}
+	]`
+	vm.rpcLimiter.clock.Set(vm.rpcLimiter.clock.Time().Add(time.Second))
+	requireLimitError(t, postRPC(handlers["/rpc"], batch), http.StatusTooManyRequests)
+	vm.rpcLimiter.clock.Set(vm.rpcLimiter.clock.Time().Add(time.Second))
+	require.Equal(http.StatusOK, postRPC(handlers["/rpc"], batch).Code)
+
+	// Bodies above the max size are rejected before they are parsed
+	vm.rpcLimiter.clock.Set(vm.rpcLimiter.clock.Time().Add(time.Minute))
+	large := `{"jsonrpc":"1.0","id":1,"method":"getblockcount","params":[],"padding":"` + strings.Repeat("a", 512) + `"}`
+	requireLimitError(t, postRPC(handlers["/rpc"], large), http.StatusRequestEntityTooLarge)
+	require.Equal(float64(1), testutil.ToFloat64(vm.rpcLimiter.limited.WithLabelValues(rpcLimitRequestSize)))
+
+	// Clients may only have so many requests in flight, and are told apart
+	// by their IP
+	first, limit := vm.rpcLimiter.acquire("192.0.2.2", 1, true)
+	require.Empty(limit)
+	_, limit = vm.rpcLimiter.acquire("192.0.2.2", 1, true)
+	require.Empty(limit)
+	_, limit = vm.rpcLimiter.acquire("192.0.2.2", 1, true)
+	require.Equal(rpcLimitConcurrency, limit)
+	_, limit = vm.rpcLimiter.acquire("192.0.2.3", 1, true)
+	require.Empty(limit)
+	vm.rpcLimiter.release(first)
+	_, limit = vm.rpcLimiter.acquire("192.0.2.2", 1, true)
+	require.Empty(limit)
+}
+
+func TestRPCLimitsResponseSize(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	configBytes := []byte(`{"rpcLimits":{"maxResponseBytes":512}}`)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, configBytes)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+
+	genesis := btcutil.NewBlock(btcd.BtcvmTestNetParms.GenesisBlock)
+	var serialized bytes.Buffer
+	require.NoError(genesis.MsgBlock().Serialize(&serialized))
+	rawBlock := `"` + hex.EncodeToString(serialized.Bytes()) + `"`
+
+	// Verbose blocks above the max size fall back to the serialized block
+	for _, params := range []string{
+		`["` + genesis.Hash().String() + `"]`,
+		`["` + genesis.Hash().String() + `",2]`,
+		`["` + genesis.Hash().String() + `",0]`,
+	} {
+		recorder := postRPC(handlers["/rpc"], `{"jsonrpc":"1.0","id":7,"method":"getblock","params":`+params+`}`)
+		require.Equal(http.StatusOK, recorder.Code)
+		var response batchResponse
+		require.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+		require.Nil(response.Error)
+		require.JSONEq(`7`, string(response.ID))
+		require.JSONEq(rawBlock, string(response.Result))
+	}
+	require.Equal(float64(2), testutil.ToFloat64(vm.rpcLimiter.limited.WithLabelValues(rpcLimitGetBlockVerbose)))
+
+	// Other responses above the max size are replaced by an error
+	recorder := postRPC(handlers["/rpc"], `{"jsonrpc":"1.0","id":8,"method":"help","params":[]}`)
+	requireLimitError(t, recorder, http.StatusOK)
+	var response batchResponse
+	require.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.JSONEq(`8`, string(response.ID))
+	require.Equal(float64(1), testutil.ToFloat64(vm.rpcLimiter.limited.WithLabelValues(rpcLimitResponseSize)))
+}
+
+func TestRPCLimitsWebsocketSubscriptions(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	configBytes := []byte(`{"rpcLimits":{"maxWebsocketSubscriptions":2}}`)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass"`, configBytes)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+
+	addresses := make([]string, 3)
+	for i := range addresses {
+		address, err := btcutil.NewAddressPubKeyHash(bytes.Repeat([]byte{byte(i + 1)}, 20), &btcd.BtcvmTestNetParms)
+		require.NoError(err)
+		addresses[i] = address.EncodeAddress()
+	}
+
+	server := httptest.NewServer(handlers["/ws"])
+	defer server.Close()
+	header := http.Header{"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	require.NoError(err)
+	defer conn.Close()
+
+	call := func(method string, params ...interface{}) *btcjson.RPCError {
+		require.NoError(conn.WriteJSON(map[string]interface{}{
+			"jsonrpc": "1.0",
+			"method":  method,
+			"params":  params,
+			"id":      1,
+		}))
+		require.NoError(conn.SetReadDeadline(time.Now().Add(10 * time.Second)))
+		var response batchResponse
+		require.NoError(conn.ReadJSON(&response))
+		return response.Error
+	}
+	requireLimited := func(rpcErr *btcjson.RPCError) {
+		require.NotNil(rpcErr)
+		require.Equal(btcjson.ErrRPCLimitExceeded, rpcErr.Code)
+	}
+
+	// Subscriptions count across notifyreceived and loadtxfilter, and
+	// addresses already watched are free
+	require.Nil(call("notifyreceived", addresses[:2]))
+	require.Nil(call("notifyreceived", addresses[:1]))
+	requireLimited(call("notifyreceived", addresses[2:]))
+	requireLimited(call("loadtxfilter", true, addresses[2:], []interface{}{}))
+
+	// Unsubscribing frees room for other subscriptions
+	require.Nil(call("stopnotifyreceived", addresses[:1]))
+	require.Nil(call("loadtxfilter", true, addresses[2:], []interface{}{}))
+	requireLimited(call("notifyreceived", addresses[:1]))
+	require.Equal(float64(3), testutil.ToFloat64(vm.rpcLimiter.limited.WithLabelValues("ws_subscriptions")))
+}
@@ -0,0 +1,155 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+)
+
+// sendRawTxError calls sendrawtransaction with params on handler and returns
+// the error of the call, with its data decoded as a rejection
+func sendRawTxError(t *testing.T, handler http.Handler, params []interface{}) (btcjson.RPCErrorCode, string, *btcjson.TxRejection) {
+	require := require.New(t)
+
+	request, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "1.0",
+		"id":      1,
+		"method":  "sendrawtransaction",
+		"params":  params,
+	})
+	require.NoError(err)
+
+	httpRequest := httptest.NewRequest(http.MethodPost, "/rpc", bytes.NewReader(request))
+	httpRequest.SetBasicAuth("user", "pass")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httpRequest)
+	require.Equal(http.StatusOK, recorder.Code)
+
+	var response struct {
+		Error *struct {
+			Code    btcjson.RPCErrorCode `json:"code"`
+			Message string               `json:"message"`
+			Data    *btcjson.TxRejection `json:"data"`
+		} `json:"error"`
+	}
+	require.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.NotNil(response.Error, recorder.Body.String())
+	return response.Error.Code, response.Error.Message, response.Error.Data
+}
+
+func TestSendRawTransactionRejections(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass","rejectNonStd":true`, nil)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	handler := handlers["/rpc"]
+	buildTestChain(t, vm, 2)
+	blk, err := vm.GetBlock(ctx, vm.lastAccepted)
+	require.NoError(err)
+	coinbase := blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx()
+
+	// A transaction spending an unknown output
+	unknown := coinbase.Copy()
+	unknown.LockTime++
+	code, _, rejection := sendRawTxError(t, handler, []interface{}{txHex(t, newTestSpend(t, key, unknown).MsgTx())})
+	require.Equal(btcjson.ErrRPCTxError, code)
+	require.Equal(&btcjson.TxRejection{Reason: btcjson.TxRejectMissingInputs}, rejection)
+
+	// A transaction paying no fee for an unconfirmed input, which has no
+	// priority
+	parentBlk, err := vm.GetBlock(ctx, blk.Parent())
+	require.NoError(err)
+	parent := newTestSpend(t, key, parentBlk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx())
+	var txID string
+	callRPC(t, handler, "sendrawtransaction", []interface{}{txHex(t, parent.MsgTx())}, &txID)
+	code, _, rejection = sendRawTxError(t, handler, []interface{}{txHex(t, newTestSpendWithFee(t, key, parent.MsgTx(), 0).MsgTx())})
+	require.Equal(btcjson.ErrRPCTxRejected, code)
+	require.Equal(&btcjson.TxRejection{Reason: btcjson.TxRejectLowFee}, rejection)
+
+	// A transaction with a dust output, which is non-standard whatever fee
+	// rate it pays
+	dust := newTestSpendWithFee(t, key, coinbase, coinbase.TxOut[0].Value-1)
+	code, _, rejection = sendRawTxError(t, handler, []interface{}{txHex(t, dust.MsgTx())})
+	require.Equal(btcjson.ErrRPCTxRejected, code)
+	require.Equal(&btcjson.TxRejection{Reason: btcjson.TxRejectNonStandard}, rejection)
+	code, _, rejection = sendRawTxError(t, handler, []interface{}{txHex(t, dust.MsgTx()), 0})
+	require.Equal(btcjson.ErrRPCTxRejected, code)
+	require.Equal(&btcjson.TxRejection{Reason: btcjson.TxRejectNonStandard}, rejection)
+
+	// The max fee rate is lifted by allowhighfees and a zero maxfeerate
+	highFee := newTestSpendWithFee(t, key, coinbase, btcutil.SatoshiPerBitcoin)
+	code, _, rejection = sendRawTxError(t, handler, []interface{}{txHex(t, highFee.MsgTx()), 0.5})
+	require.Equal(btcjson.ErrRPCTxError, code)
+	require.Equal(&btcjson.TxRejection{Reason: btcjson.TxRejectMaxFeeExceeded}, rejection)
+	code, _, _ = sendRawTxError(t, handler, []interface{}{txHex(t, highFee.MsgTx()), -1})
+	require.Equal(btcjson.ErrRPCInvalidParameter, code)
+	callRPC(t, handler, "sendrawtransaction", []interface{}{txHex(t, highFee.MsgTx()), true}, &txID)
+	require.Equal(highFee.Hash().String(), txID)
+
+	// A transaction spending the same output without replacing it
+	conflict := newTestSpend(t, key, coinbase)
+	code, message, rejection := sendRawTxError(t, handler, []interface{}{txHex(t, conflict.MsgTx())})
+	require.Equal(btcjson.ErrRPCTxRejected, code)
+	require.Contains(message, "TX rejected")
+	require.Equal(&btcjson.TxRejection{
+		Reason:           btcjson.TxRejectConflict,
+		ConflictingTxids: []string{highFee.Hash().String()},
+	}, rejection)
+
+	// A transaction already in the mempool
+	code, _, _ = sendRawTxError(t, handler, []interface{}{txHex(t, highFee.MsgTx()), true})
+	require.Equal(btcjson.ErrRPCTxRejected, code)
+}
+
+func TestSendRawTransactionPush(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 2, key, `"rpcUser":"user","rpcPass":"pass"`, nil)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	buildTestChain(t, vm, 1)
+	blk, err := vm.GetBlock(ctx, vm.lastAccepted)
+	require.NoError(err)
+	coinbase := blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx()
+
+	// The push gossip loop is pushed out past the end of the test, so the
+	// transaction can only be pushed by the submission itself. The block may
+	// be relayed after gossip starts and pushed along with it.
+	vm.gossipConfig.PushGossipFrequency = time.Hour
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+	require.Zero(vm.gossipStats.pushed.items.Load())
+
+	spend := newTestSpend(t, key, coinbase)
+	var txID string
+	callRPC(t, handlers["/rpc"], "sendrawtransaction", []interface{}{txHex(t, spend.MsgTx())}, &txID)
+	require.Equal(spend.Hash().String(), txID)
+	pushed := vm.gossipStats.pushed.items.Load()
+	require.Positive(pushed)
+
+	// Transactions issued through the Metal API are pushed as well
+	spend = newTestSpend(t, key, spend.MsgTx())
+	var issued MetalIssueTxReply
+	require.Empty(callMetalAPI(t, handlers[metalEndpoint], "metal.issueTx", &MetalIssueTxArgs{Tx: txHex(t, spend.MsgTx())}, &issued))
+	require.Greater(vm.gossipStats.pushed.items.Load(), pushed)
+}
@@ -0,0 +1,77 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+)
+
+// blockHexAtHeight returns the accepted block of vm at height, hex encoded
+func blockHexAtHeight(t *testing.T, vm *VM, height uint64) string {
+	require := require.New(t)
+	ctx := context.Background()
+
+	blkID, err := vm.GetBlockIDAtHeight(ctx, height)
+	require.NoError(err)
+	blk, err := vm.GetBlock(ctx, blkID)
+	require.NoError(err)
+	return hex.EncodeToString(blk.Bytes())
+}
+
+func TestSubmitBlock(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vms := newTestVMsWithConfig(t, 2, key, `"rpcUser":"user","rpcPass":"pass"`, nil)
+	producer, vm := vms[0], vms[1]
+	_, err = producer.CreateHandlers(ctx)
+	require.NoError(err)
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	handler := handlers["/rpc"]
+	buildTestChain(t, producer, 3)
+	genesisID := vm.lastAccepted
+
+	// Blocks are only submitted once gossip runs
+	var status string
+	callRPC(t, handler, "submitblock", []interface{}{blockHexAtHeight(t, producer, 1)}, &status)
+	require.True(strings.HasPrefix(status, blockStatusRejected), status)
+
+	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+
+	// A block with an unknown parent waits for it
+	callRPC(t, handler, "submitblock", []interface{}{blockHexAtHeight(t, producer, 2)}, &status)
+	require.Equal(blockStatusOrphan, status)
+
+	// The next block is processed, but left to consensus to accept
+	callRPC(t, handler, "submitblock", []interface{}{blockHexAtHeight(t, producer, 1)}, &status)
+	require.Equal(blockStatusPending, status)
+	require.Equal(genesisID, vm.lastAccepted)
+
+	callRPC(t, handler, "submitblock", []interface{}{blockHexAtHeight(t, producer, 1)}, &status)
+	require.Equal(blockStatusDuplicate, status)
+
+	// A block whose transactions do not match its header is rejected
+	blockBytes, err := hex.DecodeString(blockHexAtHeight(t, producer, 3))
+	require.NoError(err)
+	block, err := btcutil.NewBlockFromBytes(blockBytes)
+	require.NoError(err)
+	block.MsgBlock().Transactions[0].TxOut[0].Value--
+	tampered, err := btcutil.NewBlock(block.MsgBlock()).Bytes()
+	require.NoError(err)
+	callRPC(t, handler, "submitblock", []interface{}{hex.EncodeToString(tampered)}, &status)
+	require.True(strings.HasPrefix(status, blockStatusRejected), status)
+}
@@ -0,0 +1,177 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2/schnorr"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+)
+
+// txHex returns the serialization of msgTx with its witnesses in hex
+func txHex(t *testing.T, msgTx *wire.MsgTx) string {
+	var buf bytes.Buffer
+	require.NoError(t, msgTx.Serialize(&buf))
+	return hex.EncodeToString(buf.Bytes())
+}
+
+func TestTaprootRPC(t *testing.T) {
+	const fee = 10_000
+
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm, err := newDeploymentsVM(
+		t,
+		key,
+		`,"rpcUser":"user","rpcPass":"pass","dbType":"memdb"`,
+		[]byte(`{"activationHeights":{"segwit":1,"taproot":1}}`),
+	)
+	require.NoError(err)
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	buildTestChain(t, vm, 1)
+	blk, err := vm.GetBlock(ctx, vm.lastAccepted)
+	require.NoError(err)
+	coinbase := blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx()
+	params := vm.config.ChainParams
+
+	// A taproot output committing to a single leaf checking the signature of
+	// leafKey, spendable by the tweaked internal key as well
+	internalKey, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	leafKey, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	leafScript, err := txscript.NewScriptBuilder().
+		AddData(schnorr.SerializePubKey(leafKey.PubKey())).
+		AddOp(txscript.OP_CHECKSIG).
+		Script()
+	require.NoError(err)
+	leaf := txscript.NewBaseTapLeaf(leafScript)
+	tree := txscript.AssembleTaprootScriptTree(leaf)
+	rootHash := tree.RootNode.TapHash()
+	outputKey := txscript.ComputeTaprootOutputKey(internalKey.PubKey(), rootHash[:])
+	pkScript, err := txscript.PayToTaprootScript(outputKey)
+	require.NoError(err)
+	addr, err := btcutil.NewAddressTaproot(schnorr.SerializePubKey(outputKey), params)
+	require.NoError(err)
+	encodedAddr := addr.EncodeAddress()
+	require.Equal(params.Bech32HRPSegwit+"1p", encodedAddr[:len(params.Bech32HRPSegwit)+2])
+
+	// Fund two taproot outputs from the coinbase
+	coinbaseHash := coinbase.TxHash()
+	funding := wire.NewMsgTx(wire.TxVersion)
+	funding.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&coinbaseHash, 0), nil, nil))
+	amount := (coinbase.TxOut[0].Value - fee) / 2
+	funding.AddTxOut(wire.NewTxOut(amount, pkScript))
+	funding.AddTxOut(wire.NewTxOut(amount, pkScript))
+	sigScript, err := txscript.SignatureScript(funding, 0, coinbase.TxOut[0].PkScript, txscript.SigHashAll, key, true)
+	require.NoError(err)
+	funding.TxIn[0].SignatureScript = sigScript
+	var txID string
+	callRPC(t, handlers["/rpc"], "sendrawtransaction", []interface{}{txHex(t, funding)}, &txID)
+	require.Equal(funding.TxHash().String(), txID)
+
+	// requireTaprootOutput checks the script of a decoded taproot output
+	requireTaprootOutput := func(scriptPubKey btcjson.ScriptPubKeyResult) {
+		require.Equal("witness_v1_taproot", scriptPubKey.Type)
+		require.Equal(encodedAddr, scriptPubKey.Address)
+		require.Equal(hex.EncodeToString(pkScript), scriptPubKey.Hex)
+	}
+
+	var txOut btcjson.GetTxOutResult
+	callRPC(t, handlers["/rpc"], "gettxout", []interface{}{txID, 0, true}, &txOut)
+	requireTaprootOutput(txOut.ScriptPubKey)
+
+	var decodedScript btcjson.DecodeScriptResult
+	callRPC(t, handlers["/rpc"], "decodescript", []interface{}{hex.EncodeToString(pkScript)}, &decodedScript)
+	require.Equal("witness_v1_taproot", decodedScript.Type)
+	require.Equal(encodedAddr, decodedScript.Address)
+	require.Empty(decodedScript.P2sh)
+
+	var validated btcjson.ValidateAddressChainResult
+	callRPC(t, handlers["/rpc"], "validateaddress", []interface{}{encodedAddr}, &validated)
+	require.Equal(btcjson.ValidateAddressChainResult{
+		IsValid:        true,
+		Address:        encodedAddr,
+		IsScript:       btcjson.Bool(true),
+		IsWitness:      btcjson.Bool(true),
+		WitnessVersion: btcjson.Int32(1),
+		WitnessProgram: btcjson.String(hex.EncodeToString(schnorr.SerializePubKey(outputKey))),
+	}, validated)
+
+	// spend returns a transaction spending output index of the funding
+	// transaction back to the taproot output, with the witness returned by
+	// witness for its signature hashes
+	fetcher := txscript.NewMultiPrevOutFetcher(map[wire.OutPoint]*wire.TxOut{
+		{Hash: funding.TxHash(), Index: 0}: funding.TxOut[0],
+		{Hash: funding.TxHash(), Index: 1}: funding.TxOut[1],
+	})
+	spend := func(index uint32, witness func(*wire.MsgTx, *txscript.TxSigHashes) wire.TxWitness) *wire.MsgTx {
+		fundingHash := funding.TxHash()
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&fundingHash, index), nil, nil))
+		msgTx.AddTxOut(wire.NewTxOut(amount-fee, pkScript))
+		msgTx.TxIn[0].Witness = witness(msgTx, txscript.NewTxSigHashes(msgTx, fetcher))
+		return msgTx
+	}
+
+	// A key path spend has the signature of the tweaked internal key as its
+	// only witness item
+	keyPathSpend := spend(0, func(msgTx *wire.MsgTx, sigHashes *txscript.TxSigHashes) wire.TxWitness {
+		sig, err := txscript.RawTxInTaprootSignature(msgTx, sigHashes, 0, amount, pkScript, rootHash[:], txscript.SigHashDefault, internalKey)
+		require.NoError(err)
+		return wire.TxWitness{sig}
+	})
+
+	// A script path spend has the witness of the leaf, the leaf script and
+	// the control block proving its inclusion in the output key
+	controlBlock := tree.LeafMerkleProofs[0].ToControlBlock(internalKey.PubKey())
+	controlBlockBytes, err := controlBlock.ToBytes()
+	require.NoError(err)
+	scriptPathSpend := spend(1, func(msgTx *wire.MsgTx, sigHashes *txscript.TxSigHashes) wire.TxWitness {
+		sig, err := txscript.RawTxInTapscriptSignature(msgTx, sigHashes, 0, amount, pkScript, leaf, txscript.SigHashDefault, leafKey)
+		require.NoError(err)
+		return wire.TxWitness{sig, leafScript, controlBlockBytes}
+	})
+
+	for _, msgTx := range []*wire.MsgTx{keyPathSpend, scriptPathSpend} {
+		callRPC(t, handlers["/rpc"], "sendrawtransaction", []interface{}{txHex(t, msgTx)}, &txID)
+		require.Equal(msgTx.TxHash().String(), txID)
+
+		var decoded btcjson.TxRawDecodeResult
+		callRPC(t, handlers["/rpc"], "decoderawtransaction", []interface{}{txHex(t, msgTx)}, &decoded)
+		require.Equal(txID, decoded.Txid)
+		require.Len(decoded.Vin, 1)
+		require.Equal(msgTx.TxIn[0].Witness.ToHexStrings(), decoded.Vin[0].Witness)
+		require.Len(decoded.Vout, 1)
+		requireTaprootOutput(decoded.Vout[0].ScriptPubKey)
+
+		var raw btcjson.TxRawResult
+		callRPC(t, handlers["/rpc"], "getrawtransaction", []interface{}{txID, 1}, &raw)
+		require.Equal(decoded.Vin, raw.Vin)
+		require.Equal(decoded.Vout, raw.Vout)
+	}
+
+	// An annex is decoded as the last witness item
+	annexed := scriptPathSpend.Copy()
+	annex := []byte{txscript.TaprootAnnexTag, 0x01, 0x02}
+	annexed.TxIn[0].Witness = append(annexed.TxIn[0].Witness, annex)
+	var decoded btcjson.TxRawDecodeResult
+	callRPC(t, handlers["/rpc"], "decoderawtransaction", []interface{}{txHex(t, annexed)}, &decoded)
+	require.Len(decoded.Vin[0].Witness, 4)
+	require.Equal(hex.EncodeToString(annex), decoded.Vin[0].Witness[3])
+}
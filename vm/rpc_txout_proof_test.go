@@ -0,0 +1,113 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+)
+
+func TestTxOutProof(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass","txIndex":true`, nil)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+
+	// A block with an odd number of transactions: the coinbase and the
+	// spends of the coinbases of the previous blocks
+	buildTestChain(t, vm, 2)
+	mempool := vm.btcdAdapter.TxMemPool()
+	var txIDs []string
+	for _, blk := range acceptedBlocks(t, vm) {
+		tx := newTestSpend(t, key, blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx())
+		_, err := mempool.ProcessTransaction(tx, false, false, 0)
+		require.NoError(err)
+		txIDs = append(txIDs, tx.Hash().String())
+	}
+	buildTestChain(t, vm, 1)
+	blk, err := vm.GetBlock(ctx, vm.lastAccepted)
+	require.NoError(err)
+	txs := blk.(*BlockAdapter).btcBlock.Transactions()
+	require.Len(txs, 3)
+	blockHash := idToHash(blk.ID()).String()
+
+	call := func(method string, params ...interface{}) batchResponse {
+		request, err := json.Marshal(map[string]interface{}{
+			"jsonrpc": "1.0",
+			"id":      1,
+			"method":  method,
+			"params":  params,
+		})
+		require.NoError(err)
+		var response batchResponse
+		require.NoError(json.Unmarshal(postRPC(handlers["/rpc"], string(request)).Body.Bytes(), &response))
+		return response
+	}
+	requireError := func(response batchResponse, code btcjson.RPCErrorCode) {
+		require.NotNil(response.Error)
+		require.Equal(code, response.Error.Code)
+	}
+
+	// Proofs round trip for any subset of the transactions, with the block
+	// looked up in the transaction index when it is not provided
+	for _, test := range []struct {
+		txIDs  []string
+		params []interface{}
+	}{
+		{txIDs: txIDs[:1], params: []interface{}{txIDs[:1]}},
+		{txIDs: txIDs[1:], params: []interface{}{txIDs[1:], blockHash}},
+		{txIDs: txIDs, params: []interface{}{txIDs}},
+		{txIDs: []string{txs[0].Hash().String()}, params: []interface{}{[]string{txs[0].Hash().String()}, blockHash}},
+	} {
+		var proof string
+		callRPC(t, handlers["/rpc"], "gettxoutproof", test.params, &proof)
+		var proven []string
+		callRPC(t, handlers["/rpc"], "verifytxoutproof", []interface{}{proof}, &proven)
+		require.ElementsMatch(test.txIDs, proven)
+	}
+
+	// Every transaction must be in the block
+	coinbase := acceptedBlocks(t, vm)[0].(*BlockAdapter).btcBlock.Transactions()[0].Hash().String()
+	requireError(call("gettxoutproof", []string{txIDs[0], coinbase}), btcjson.ErrRPCInvalidAddressOrKey)
+	requireError(call("gettxoutproof", []string{txIDs[0], txIDs[0]}), btcjson.ErrRPCInvalidParameter)
+	requireError(call("gettxoutproof", []string{}), btcjson.ErrRPCInvalidParameter)
+
+	// Proofs with a tampered hash prove nothing. The hashes follow the
+	// header and the number of transactions.
+	var proof string
+	callRPC(t, handlers["/rpc"], "gettxoutproof", []interface{}{txIDs}, &proof)
+	tampered := []byte(proof)
+	if tampered[2*(80+4+1)] == '0' {
+		tampered[2*(80+4+1)] = '1'
+	} else {
+		tampered[2*(80+4+1)] = '0'
+	}
+	var proven []string
+	callRPC(t, handlers["/rpc"], "verifytxoutproof", []interface{}{string(tampered)}, &proven)
+	require.Empty(proven)
+	requireError(call("verifytxoutproof", "zz"), btcjson.ErrRPCDecodeHexString)
+
+	// Proofs of blocks outside the main chain are refused
+	otherKey, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	other := newTestVMsWithConfig(t, 1, otherKey, `"rpcUser":"user","rpcPass":"pass"`, nil)[0]
+	otherHandlers, err := other.CreateHandlers(ctx)
+	require.NoError(err)
+	buildTestChain(t, other, 1)
+	otherBlk, err := other.GetBlock(ctx, other.lastAccepted)
+	require.NoError(err)
+	otherTx := otherBlk.(*BlockAdapter).btcBlock.Transactions()[0].Hash().String()
+	callRPC(t, otherHandlers["/rpc"], "gettxoutproof", []interface{}{[]string{otherTx}, idToHash(otherBlk.ID()).String()}, &proof)
+	requireError(call("verifytxoutproof", proof), btcjson.ErrRPCInvalidAddressOrKey)
+}
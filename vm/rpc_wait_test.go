@@ -0,0 +1,116 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+)
+
+// waitResponse is the response to a waitfornewblock or waitforblockheight
+// request
+type waitResponse struct {
+	Result *btcjson.WaitForBlockResult `json:"result"`
+	Error  *btcjson.RPCError           `json:"error"`
+}
+
+func TestWaitForBlock(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	// Waiting requests count against the max number of clients and
+	// concurrent requests
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass","rpcMaxClients":100`,
+		[]byte(`{"rpcLimits":{"maxConcurrentRequests":100}}`))[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+
+	wait := func(method string, params string) waitResponse {
+		recorder := postRPC(handlers["/rpc"], `{"jsonrpc":"1.0","id":1,"method":"`+method+`","params":`+params+`}`)
+		var response waitResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			response.Error = &btcjson.RPCError{Message: err.Error()}
+		}
+		return response
+	}
+	genesis := &btcjson.WaitForBlockResult{Hash: btcd.BtcvmTestNetParms.GenesisHash.String()}
+
+	// Heights already accepted return at once, and timeouts return the
+	// current tip
+	require.Equal(waitResponse{Result: genesis}, wait("waitforblockheight", `[0]`))
+	require.Equal(waitResponse{Result: genesis}, wait("waitfornewblock", `[50]`))
+	require.Equal(waitResponse{Result: genesis}, wait("waitforblockheight", `[1,50]`))
+	require.NotNil(wait("waitfornewblock", `[-1]`).Error)
+
+	// Many waiters are unblocked by a single accepted block
+	const numWaiters = 20
+	responses := make(chan waitResponse, 2*numWaiters)
+	for i := 0; i < numWaiters; i++ {
+		go func() {
+			responses <- wait("waitfornewblock", `[10000]`)
+		}()
+		go func() {
+			responses <- wait("waitforblockheight", `[1]`)
+		}()
+	}
+
+	// Blocks connected by btcd do not end the wait until they are accepted
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(vm.SetPreference(ctx, blk.ID()))
+	select {
+	case response := <-responses:
+		require.FailNow("waiter returned before the block was accepted", "%+v", response)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	accepted := make(chan error, 1)
+	go func() {
+		accepted <- blk.Accept(ctx)
+	}()
+	require.NoError(<-accepted)
+	want := &btcjson.WaitForBlockResult{
+		Hash:   idToHash(blk.ID()).String(),
+		Height: 1,
+	}
+	for i := 0; i < 2*numWaiters; i++ {
+		select {
+		case response := <-responses:
+			require.Equal(waitResponse{Result: want}, response)
+		case <-time.After(20 * time.Second):
+			require.FailNow("waiter was not unblocked by the accepted block")
+		}
+	}
+
+	// Waiters return once their client goes away
+	requestCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		request := httptest.NewRequest(http.MethodPost, "/rpc",
+			strings.NewReader(`{"jsonrpc":"1.0","id":1,"method":"waitfornewblock","params":[]}`)).WithContext(requestCtx)
+		request.SetBasicAuth("user", "pass")
+		handlers["/rpc"].ServeHTTP(httptest.NewRecorder(), request)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		require.FailNow("waiter did not return after its client went away")
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultShutdownTimeoutSeconds is how long Shutdown waits for the
+	// subsystems of the VM to stop before forcing them closed
+	defaultShutdownTimeoutSeconds = 30
+
+	// forcedShutdownStepTimeout is how long each step left once the shutdown
+	// timeout elapsed is given before moving on to the next one
+	forcedShutdownStepTimeout = time.Second
+)
+
+// ErrShutdownTimeout is returned by Shutdown when subsystems of the VM did not
+// stop within the shutdown timeout. They are left running in the background.
+var ErrShutdownTimeout = errors.New("shutdown timed out")
+
+// shutdownStep is a subsystem stopped by Shutdown, in the order of the steps
+type shutdownStep struct {
+	name string
+	stop func()
+
+	// wait is set for the steps Shutdown always waits for, even once the
+	// shutdown timeout elapsed
+	wait bool
+}
+
+// shutdownSteps returns the steps stopping the subsystems of the VM. Each
+// step only starts once those it depends on stopped or were given up on.
+func (vm *VM) shutdownSteps() []shutdownStep {
+	return []shutdownStep{
+		{
+			// Wait for the block builder before stopping the adapter it
+			// reads from
+			name: "block builder",
+			stop: func() {
+				vm.builderLock.Lock()
+				builder := vm.blockBuilder
+				vm.builderLock.Unlock()
+				if builder != nil {
+					vm.ctx.Log.Info("Waiting for block builder to finish")
+					builder.stop()
+				}
+			},
+		},
+		{
+			name: "gossip",
+			stop: func() {
+				// Cancel gossip context to stop goroutines
+				if vm.cancel != nil {
+					vm.ctx.Log.Info("Cancelling gossip context")
+					vm.cancel()
+				}
+
+				// Note: p2pNetwork cleanup is handled by the network layer
+				// automatically
+				vm.ctx.Log.Info("Waiting for gossip goroutines to finish")
+				vm.shutdownWg.Wait()
+			},
+		},
+		{
+			// Stop state sync before the database it reads from is closed
+			name: "state sync",
+			stop: vm.shutdownStateSync,
+		},
+		{
+			name: "fee estimator",
+			stop: func() {
+				if vm.feeEstimator != nil {
+					vm.saveFeeEstimator()
+				}
+			},
+		},
+		{
+			// Stop btcd adapter (gracefully closes database and other
+			// resources). The database lock must be released before
+			// Shutdown returns, as the node may initialize the chain again
+			// in the same process, so this step is always waited for.
+			name: "btcd adapter",
+			wait: true,
+			stop: func() {
+				if vm.btcdAdapter == nil {
+					return
+				}
+				vm.ctx.Log.Info("Stopping btcd adapter")
+				if err := vm.btcdAdapter.Stop(); err != nil {
+					vm.ctx.Log.Error("Error stopping btcd adapter", zap.Error(err))
+				}
+			},
+		},
+	}
+}
+
+// runShutdownSteps runs steps in order. Once timeout elapses, the goroutines
+// still running are logged and each step left is given
+// forcedShutdownStepTimeout, so that a hung subsystem can't block the
+// shutdown of the others. Steps set to wait are waited for regardless. A zero
+// timeout waits for every step.
+func (vm *VM) runShutdownSteps(ctx context.Context, timeout time.Duration, steps []shutdownStep) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var hung []string
+	for _, step := range steps {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			step.stop()
+		}()
+
+		if step.wait {
+			<-done
+			continue
+		}
+
+		stepCtx := ctx
+		if len(hung) > 0 {
+			var cancel context.CancelFunc
+			stepCtx, cancel = context.WithTimeout(context.WithoutCancel(ctx), forcedShutdownStepTimeout)
+			defer cancel()
+		}
+		select {
+		case <-done:
+			continue
+		case <-stepCtx.Done():
+		}
+
+		if len(hung) == 0 {
+			vm.ctx.Log.Error("Timed out waiting for subsystem to stop, forcing shutdown",
+				zap.String("subsystem", step.name),
+				zap.Duration("timeout", timeout),
+				zap.String("goroutines", goroutineDump()),
+			)
+		} else {
+			vm.ctx.Log.Error("Timed out forcing subsystem to stop",
+				zap.String("subsystem", step.name),
+			)
+		}
+		hung = append(hung, step.name)
+	}
+
+	if len(hung) > 0 {
+		return fmt.Errorf("%w: %s still running", ErrShutdownTimeout, strings.Join(hung, ", "))
+	}
+	return nil
+}
+
+// goroutineDump returns the stack traces of all goroutines
+func goroutineDump() string {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 2); err != nil {
+		return fmt.Sprintf("failed to dump goroutines: %s", err)
+	}
+	return buf.String()
+}
@@ -0,0 +1,57 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	btcdb "github.com/MetalBlockchain/btcvm/btcd/database"
+)
+
+func TestShutdownTimeout(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, "", []byte(`{"shutdownTimeoutSeconds":1}`))[0]
+
+	// A gossip goroutine ignoring the shutdown signal
+	release := make(chan struct{})
+	defer close(release)
+	vm.shutdownWg.Add(1)
+	go func() {
+		defer vm.shutdownWg.Done()
+		<-release
+	}()
+
+	saved, err := vm.db.Has(feeEstimatorKey)
+	require.NoError(err)
+	require.False(saved)
+
+	start := time.Now()
+	err = vm.Shutdown(ctx)
+	require.ErrorIs(err, ErrShutdownTimeout)
+	require.ErrorContains(err, "gossip still running")
+	require.Less(time.Since(start), 5*time.Second)
+
+	// The subsystems after the hung one were still stopped
+	saved, err = vm.db.Has(feeEstimatorKey)
+	require.NoError(err)
+	require.True(saved)
+
+	// The block database was closed before Shutdown returned
+	blockDB, err := btcdb.Open(vm.config.DbType, btcd.BlockDBPath(vm.config.DataDir, vm.config.DbType), vm.config.ChainParams.Net)
+	require.NoError(err)
+	require.NoError(blockDB.Close())
+
+	// Shutting down again does not wait on the hung goroutine
+	require.NoError(vm.Shutdown(ctx))
+}
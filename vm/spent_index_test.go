@@ -0,0 +1,118 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
+)
+
+func TestSpentIndex(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vms := newTestVMsWithConfig(t, 2, key, `"rpcUser":"user","rpcPass":"pass","txIndex":true,"spentIndex":true`, nil)
+	vm, competitor := vms[0], vms[1]
+
+	// The competing fork pays a different address, so that its blocks differ
+	// from the blocks of vm at the same heights
+	otherKey, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{0x01}, 32))
+	otherAddr, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160(otherKey.PubKey().SerializeCompressed()),
+		&btcd.BtcvmTestNetParms,
+	)
+	require.NoError(err)
+	competitor.config.MiningAddrs = []string{otherAddr.EncodeAddress()}
+	_, err = competitor.CreateHandlers(ctx)
+	require.NoError(err)
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+
+	// Both VMs accept the block paying the coinbase to key
+	buildTestChain(t, vm, 1)
+	blk, err := vm.GetBlock(ctx, vm.lastAccepted)
+	require.NoError(err)
+	parsed, err := competitor.ParseBlock(ctx, blk.Bytes())
+	require.NoError(err)
+	require.NoError(parsed.Verify(ctx))
+	require.NoError(competitor.SetPreference(ctx, parsed.ID()))
+	require.NoError(parsed.Accept(ctx))
+	coinbase := blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx()
+	coinbaseHash := coinbase.TxHash()
+
+	// vm connects A2 spending the coinbase
+	spend := newTestSpend(t, key, coinbase)
+	var txID string
+	callRPC(t, handlers["/rpc"], "sendrawtransaction", []interface{}{txHex(t, spend.MsgTx())}, &txID)
+	require.Equal(spend.Hash().String(), txID)
+	a2, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(a2.Verify(ctx))
+	require.NoError(vm.SetPreference(ctx, a2.ID()))
+	require.Len(a2.(*BlockAdapter).btcBlock.Transactions(), 2)
+
+	var spentInfo btcjson.GetSpentInfoResult
+	callRPC(t, handlers["/rpc"], "getspentinfo", []interface{}{coinbaseHash.String(), 0}, &spentInfo)
+	require.Equal(btcjson.GetSpentInfoResult{
+		Txid:   txID,
+		Index:  0,
+		Height: 2,
+	}, spentInfo)
+
+	// The input of the spend describes the coinbase output
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(coinbase.TxOut[0].PkScript, vm.config.ChainParams)
+	require.NoError(err)
+	require.Len(addrs, 1)
+	var raw btcjson.TxRawResult
+	callRPC(t, handlers["/rpc"], "getrawtransaction", []interface{}{txID, 1}, &raw)
+	require.Equal(&btcjson.PrevOut{
+		Addresses: []string{addrs[0].EncodeAddress()},
+		Value:     btcutil.Amount(coinbase.TxOut[0].Value).ToBTC(),
+	}, raw.Vin[0].PrevOut)
+
+	// The competitor builds B2 and B3, which don't include the spend
+	var forkB []*BlockAdapter
+	for range 2 {
+		blk, err := competitor.BuildBlock(ctx)
+		require.NoError(err)
+		require.NoError(blk.Verify(ctx))
+		require.NoError(competitor.SetPreference(ctx, blk.ID()))
+		require.NoError(blk.Accept(ctx))
+		require.Len(blk.(*BlockAdapter).btcBlock.Transactions(), 1)
+		forkB = append(forkB, blk.(*BlockAdapter))
+	}
+
+	// B3 gives the competing fork more work, so btcd disconnects A2 and the
+	// coinbase is no longer spent
+	for _, blk := range forkB {
+		parsed, err := vm.ParseBlock(ctx, blk.Bytes())
+		require.NoError(err)
+		require.NoError(parsed.Verify(ctx))
+	}
+	require.Equal(int32(3), vm.btcdAdapter.Chain().BestSnapshot().Height)
+
+	request, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "1.0",
+		"id":      1,
+		"method":  "getspentinfo",
+		"params":  []interface{}{coinbaseHash.String(), 0},
+	})
+	require.NoError(err)
+	var response batchResponse
+	require.NoError(json.Unmarshal(postRPC(handlers["/rpc"], string(request)).Body.Bytes(), &response))
+	require.NotNil(response.Error)
+	require.Equal(btcjson.ErrRPCInvalidAddressOrKey, response.Error.Code)
+}
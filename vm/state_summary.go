@@ -0,0 +1,191 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/snow/engine/snowman/block"
+	"github.com/MetalBlockchain/metalgo/utils/hashing"
+)
+
+const (
+	// stateSummaryVersion is the version of the state summary encoding
+	stateSummaryVersion = 0
+
+	// stateSummaryLen is the length of an encoded state summary: version,
+	// height, block ID, UTXO commitment, number of UTXOs and total number of
+	// transactions
+	stateSummaryLen = 1 + 8 + ids.IDLen + ids.IDLen + 8 + 8
+
+	// utxoKeyLen is the length of an encoded outpoint. Encoded outpoints
+	// sort in outpoint order: by transaction hash and then by output index.
+	utxoKeyLen = chainhash.HashSize + 4
+
+	// utxoHeaderLen is the length of an encoded UTXO without its script:
+	// outpoint, height and coinbase flag, and amount
+	utxoHeaderLen = utxoKeyLen + 4 + 8
+)
+
+var _ block.StateSummary = (*stateSummary)(nil)
+
+// stateSummary describes the UTXO set as of an accepted block. Validators
+// vote on summaries by ID, and a syncing node downloads the UTXO set from
+// peers and checks it against the commitment.
+type stateSummary struct {
+	vm *VM
+
+	height         uint64
+	blockID        ids.ID
+	utxoCommitment ids.ID
+	numUTXOs       uint64
+	totalTxns      uint64
+
+	id    ids.ID
+	bytes []byte
+}
+
+// newStateSummary creates the summary of the UTXO set as of blockID
+func newStateSummary(
+	vm *VM,
+	height uint64,
+	blockID ids.ID,
+	utxoCommitment ids.ID,
+	numUTXOs uint64,
+	totalTxns uint64,
+) *stateSummary {
+	bytes := make([]byte, stateSummaryLen)
+	bytes[0] = stateSummaryVersion
+	binary.BigEndian.PutUint64(bytes[1:], height)
+	copy(bytes[9:], blockID[:])
+	copy(bytes[9+ids.IDLen:], utxoCommitment[:])
+	binary.BigEndian.PutUint64(bytes[9+2*ids.IDLen:], numUTXOs)
+	binary.BigEndian.PutUint64(bytes[17+2*ids.IDLen:], totalTxns)
+
+	return &stateSummary{
+		vm:             vm,
+		height:         height,
+		blockID:        blockID,
+		utxoCommitment: utxoCommitment,
+		numUTXOs:       numUTXOs,
+		totalTxns:      totalTxns,
+		id:             hashing.ComputeHash256Array(bytes),
+		bytes:          bytes,
+	}
+}
+
+// parseStateSummary parses a summary created by newStateSummary
+func parseStateSummary(vm *VM, bytes []byte) (*stateSummary, error) {
+	if len(bytes) != stateSummaryLen {
+		return nil, fmt.Errorf("invalid state summary length %d", len(bytes))
+	}
+	if bytes[0] != stateSummaryVersion {
+		return nil, fmt.Errorf("unknown state summary version %d", bytes[0])
+	}
+
+	var blockID, utxoCommitment ids.ID
+	copy(blockID[:], bytes[9:])
+	copy(utxoCommitment[:], bytes[9+ids.IDLen:])
+	return newStateSummary(
+		vm,
+		binary.BigEndian.Uint64(bytes[1:]),
+		blockID,
+		utxoCommitment,
+		binary.BigEndian.Uint64(bytes[9+2*ids.IDLen:]),
+		binary.BigEndian.Uint64(bytes[17+2*ids.IDLen:]),
+	), nil
+}
+
+// ID returns the hash of the summary bytes
+func (s *stateSummary) ID() ids.ID {
+	return s.id
+}
+
+// Height returns the height of the summarized block
+func (s *stateSummary) Height() uint64 {
+	return s.height
+}
+
+// Bytes returns the encoded summary
+func (s *stateSummary) Bytes() []byte {
+	return s.bytes
+}
+
+// Accept starts syncing to the summary if the VM decides to state sync
+func (s *stateSummary) Accept(ctx context.Context) (block.StateSyncMode, error) {
+	return s.vm.acceptStateSummary(ctx, s)
+}
+
+// marshalUTXO encodes an unspent output as its outpoint, followed by its
+// height and coinbase flag, amount and script
+func marshalUTXO(outpoint wire.OutPoint, entry *blockchain.UtxoEntry) []byte {
+	pkScript := entry.PkScript()
+	b := make([]byte, utxoHeaderLen+len(pkScript))
+	copy(b, outpoint.Hash[:])
+	binary.BigEndian.PutUint32(b[chainhash.HashSize:], outpoint.Index)
+
+	code := uint32(entry.BlockHeight()) << 1
+	if entry.IsCoinBase() {
+		code |= 0x01
+	}
+	binary.BigEndian.PutUint32(b[utxoKeyLen:], code)
+	binary.BigEndian.PutUint64(b[utxoKeyLen+4:], uint64(entry.Amount()))
+	copy(b[utxoHeaderLen:], pkScript)
+	return b
+}
+
+// parseUTXO decodes an unspent output encoded by marshalUTXO
+func parseUTXO(b []byte) (wire.OutPoint, *blockchain.UtxoEntry, error) {
+	if len(b) < utxoHeaderLen {
+		return wire.OutPoint{}, nil, fmt.Errorf("invalid utxo length %d", len(b))
+	}
+
+	var outpoint wire.OutPoint
+	copy(outpoint.Hash[:], b)
+	outpoint.Index = binary.BigEndian.Uint32(b[chainhash.HashSize:])
+
+	code := binary.BigEndian.Uint32(b[utxoKeyLen:])
+	txOut := &wire.TxOut{
+		Value:    int64(binary.BigEndian.Uint64(b[utxoKeyLen+4:])),
+		PkScript: append([]byte(nil), b[utxoHeaderLen:]...),
+	}
+	entry := blockchain.NewUtxoEntry(txOut, int32(code>>1), code&0x01 == 0x01)
+	return outpoint, entry, nil
+}
+
+// utxoCommitment accumulates the commitment to a UTXO set from its encoded
+// outputs in outpoint order
+type utxoCommitment struct {
+	hasher   hash.Hash
+	numUTXOs uint64
+}
+
+// newUTXOCommitment returns the commitment to an empty UTXO set
+func newUTXOCommitment() *utxoCommitment {
+	return &utxoCommitment{hasher: sha256.New()}
+}
+
+// Add includes the encoded output in the commitment
+func (c *utxoCommitment) Add(utxo []byte) {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(utxo)))
+	_, _ = c.hasher.Write(length[:])
+	_, _ = c.hasher.Write(utxo)
+	c.numUTXOs++
+}
+
+// ID returns the commitment to the outputs added so far
+func (c *utxoCommitment) ID() ids.ID {
+	var id ids.ID
+	copy(id[:], c.hasher.Sum(nil))
+	return id
+}
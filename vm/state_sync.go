@@ -0,0 +1,481 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/MetalBlockchain/metalgo/database"
+	"github.com/MetalBlockchain/metalgo/database/prefixdb"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/network/p2p"
+	"github.com/MetalBlockchain/metalgo/network/p2p/gossip"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/snow/engine/snowman/block"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"go.uber.org/zap"
+)
+
+const (
+	// StateSyncHandlerID is the handler ID used to serve state summaries'
+	// headers, tip blocks and UTXO sets to syncing peers
+	StateSyncHandlerID = 102
+
+	// maxStateSyncHeaders bounds the number of headers returned in a single
+	// response (800 KB of headers)
+	maxStateSyncHeaders = 10_000
+
+	// maxStateSyncUTXOs bounds the number of UTXOs returned in a single
+	// response
+	maxStateSyncUTXOs = 10_000
+
+	// stateSyncTargetResponseSize is the target size of a UTXO response
+	stateSyncTargetResponseSize = 1024 * 1024 // 1 MiB
+
+	// stateSyncBatchSize is the size at which database batches are written
+	// while copying a UTXO set
+	stateSyncBatchSize = 4 * 1024 * 1024 // 4 MiB
+)
+
+// stateSyncRequestType identifies the kind of state sync request
+type stateSyncRequestType byte
+
+const (
+	// stateSyncHeadersRequest asks for a range of main chain headers
+	stateSyncHeadersRequest stateSyncRequestType = 0x01
+
+	// stateSyncBlockRequest asks for the main chain block at a height
+	stateSyncBlockRequest stateSyncRequestType = 0x02
+
+	// stateSyncUTXOsRequest asks for the UTXOs of a summary following an
+	// outpoint
+	stateSyncUTXOsRequest stateSyncRequestType = 0x03
+)
+
+var (
+	_ block.StateSyncableVM = (*VM)(nil)
+	_ p2p.Handler           = (*stateSyncHandler)(nil)
+
+	lastSummaryKey    = []byte("lastSummary")
+	ongoingSummaryKey = []byte("ongoingSummary")
+	snapshotPrefix    = []byte("snapshot")
+	stagingPrefix     = []byte("staging")
+
+	errUnknownSummary = errors.New("unknown state summary")
+)
+
+// StateSyncEnabled reports whether the VM wants to state sync. A sync that
+// was interrupted is always resumed since the chain state is inconsistent
+// until it completes.
+func (vm *VM) StateSyncEnabled(context.Context) (bool, error) {
+	if _, err := vm.stateSyncDB.Get(ongoingSummaryKey); err == nil {
+		return true, nil
+	} else if err != database.ErrNotFound {
+		return false, err
+	}
+
+	if !vm.stateSyncConfig.Enabled {
+		return false, nil
+	}
+
+	// Optional indexes are built from every block, which a synced node does
+	// not have
+	if vm.config.TxIndex || vm.config.AddrIndex || vm.config.SpentIndex || !vm.config.NoCFilters {
+		vm.ctx.Log.Warn("State sync disabled, it requires txindex, addrindex and spentindex to be disabled and noCFilters to be set")
+		return false, nil
+	}
+	return true, nil
+}
+
+// GetOngoingSyncStateSummary returns the summary of an interrupted sync
+func (vm *VM) GetOngoingSyncStateSummary(context.Context) (block.StateSummary, error) {
+	summaryBytes, err := vm.stateSyncDB.Get(ongoingSummaryKey)
+	if err != nil {
+		return nil, err
+	}
+	return parseStateSummary(vm, summaryBytes)
+}
+
+// GetLastStateSummary returns the most recent summary served to peers
+func (vm *VM) GetLastStateSummary(context.Context) (block.StateSummary, error) {
+	vm.summaryLock.Lock()
+	defer vm.summaryLock.Unlock()
+
+	if vm.lastSummary == nil {
+		return nil, database.ErrNotFound
+	}
+	return vm.lastSummary, nil
+}
+
+// ParseStateSummary parses a summary received from a peer
+func (vm *VM) ParseStateSummary(_ context.Context, summaryBytes []byte) (block.StateSummary, error) {
+	return parseStateSummary(vm, summaryBytes)
+}
+
+// GetStateSummary returns the summary at summaryHeight. Only the most recent
+// summary is served.
+func (vm *VM) GetStateSummary(_ context.Context, summaryHeight uint64) (block.StateSummary, error) {
+	vm.summaryLock.Lock()
+	defer vm.summaryLock.Unlock()
+
+	if vm.lastSummary == nil || vm.lastSummary.height != summaryHeight {
+		return nil, database.ErrNotFound
+	}
+	return vm.lastSummary, nil
+}
+
+// initializeStateSync loads the last summary, registers the state sync
+// handler and starts producing summaries as blocks are connected
+func (vm *VM) initializeStateSync() error {
+	vm.stateSyncDB = prefixdb.New([]byte("stateSync"), vm.db)
+	vm.stateSyncCtx, vm.stateSyncCancel = context.WithCancel(context.Background())
+
+	summaryBytes, err := vm.stateSyncDB.Get(lastSummaryKey)
+	switch err {
+	case nil:
+		vm.lastSummary, err = parseStateSummary(vm, summaryBytes)
+		if err != nil {
+			return fmt.Errorf("failed to parse last state summary: %w", err)
+		}
+		vm.ctx.Log.Info("Loaded last state summary",
+			zap.Uint64("height", vm.lastSummary.height),
+			zap.Stringer("blockID", vm.lastSummary.blockID),
+		)
+	case database.ErrNotFound:
+	default:
+		return fmt.Errorf("failed to load last state summary: %w", err)
+	}
+
+	handler := &stateSyncHandler{
+		log:   vm.ctx.Log,
+		vm:    vm,
+		chain: vm.chain,
+	}
+	if err := vm.p2pNetwork.AddHandler(StateSyncHandlerID, handler); err != nil {
+		return fmt.Errorf("failed to register state sync handler: %w", err)
+	}
+
+	vm.chain.Subscribe(vm.onChainNotification)
+	return nil
+}
+
+// shutdownStateSync stops any snapshot or sync in progress. It must be
+// called before the btcd database is closed.
+func (vm *VM) shutdownStateSync() {
+	if vm.stateSyncCancel == nil {
+		return
+	}
+	vm.stateSyncCancel()
+	vm.stateSyncWg.Wait()
+}
+
+// onChainNotification produces a state summary whenever a block at a
+// multiple of the summary interval is connected
+func (vm *VM) onChainNotification(notification *blockchain.Notification) {
+	if notification.Type != blockchain.NTBlockConnected || vm.stateSyncConfig.SummaryInterval == 0 {
+		return
+	}
+
+	blk, ok := notification.Data.(*btcutil.Block)
+	if !ok || blk.Height() == 0 || uint64(blk.Height())%vm.stateSyncConfig.SummaryInterval != 0 {
+		return
+	}
+
+	vm.summaryLock.Lock()
+	defer vm.summaryLock.Unlock()
+
+	if vm.snapshotting {
+		vm.ctx.Log.Warn("Skipping state summary, previous snapshot still in progress",
+			zap.Int32("height", blk.Height()))
+		return
+	}
+
+	// Block notifications are delivered without the chain lock held, so
+	// the tip may already have moved on
+	snapshot, err := vm.chain.SnapshotUtxoSet()
+	if err != nil {
+		vm.ctx.Log.Error("failed to snapshot UTXO set", zap.Error(err))
+		return
+	}
+	if !snapshot.Hash.IsEqual(blk.Hash()) {
+		_ = snapshot.Close()
+		vm.ctx.Log.Debug("Skipping state summary, tip moved before snapshot",
+			zap.Int32("height", blk.Height()))
+		return
+	}
+
+	vm.snapshotting = true
+	vm.stateSyncWg.Add(1)
+	go func() {
+		defer vm.stateSyncWg.Done()
+		defer snapshot.Close()
+
+		err := vm.writeSnapshot(vm.stateSyncCtx, snapshot)
+
+		vm.summaryLock.Lock()
+		vm.snapshotting = false
+		vm.summaryLock.Unlock()
+
+		if err != nil {
+			vm.ctx.Log.Error("failed to write state summary",
+				zap.Int32("height", snapshot.Height),
+				zap.Error(err),
+			)
+		}
+	}()
+}
+
+// writeSnapshot copies the UTXO set of snapshot into the state sync
+// database, makes it the served summary and removes the previous one
+func (vm *VM) writeSnapshot(ctx context.Context, snapshot *blockchain.UtxoSnapshot) error {
+	start := time.Now()
+	height := uint64(snapshot.Height)
+	snapshotDB := prefixdb.New(snapshotPrefix, vm.stateSyncDB)
+
+	var (
+		commitment = newUTXOCommitment()
+		batch      = snapshotDB.NewBatch()
+	)
+	err := snapshot.ForEach(func(outpoint wire.OutPoint, entry *blockchain.UtxoEntry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		utxo := marshalUTXO(outpoint, entry)
+		commitment.Add(utxo)
+		if err := batch.Put(snapshotKey(height, utxo[:utxoKeyLen]), utxo); err != nil {
+			return err
+		}
+		return writeIfFull(batch)
+	})
+	if err == nil {
+		err = batch.Write()
+	}
+	if err != nil {
+		// Don't leave a partial snapshot behind
+		return errors.Join(err, deletePrefix(snapshotDB, snapshotKey(height, nil)))
+	}
+
+	summary := newStateSummary(
+		vm,
+		height,
+		hashToID(&snapshot.Hash),
+		commitment.ID(),
+		commitment.numUTXOs,
+		snapshot.TotalTxns,
+	)
+	if err := vm.stateSyncDB.Put(lastSummaryKey, summary.Bytes()); err != nil {
+		return err
+	}
+
+	vm.summaryLock.Lock()
+	previous := vm.lastSummary
+	vm.lastSummary = summary
+	vm.summaryLock.Unlock()
+
+	vm.ctx.Log.Info("Created state summary",
+		zap.Uint64("height", summary.height),
+		zap.Stringer("blockID", summary.blockID),
+		zap.Stringer("utxoCommitment", summary.utxoCommitment),
+		zap.Uint64("numUTXOs", summary.numUTXOs),
+		zap.Duration("duration", time.Since(start)),
+	)
+
+	if previous == nil || previous.height == height {
+		return nil
+	}
+	return deletePrefix(snapshotDB, snapshotKey(previous.height, nil))
+}
+
+// snapshotKey returns the key of the UTXO with the given encoded outpoint
+// in the snapshot at height
+func snapshotKey(height uint64, outpointKey []byte) []byte {
+	key := make([]byte, 8, 8+len(outpointKey))
+	binary.BigEndian.PutUint64(key, height)
+	return append(key, outpointKey...)
+}
+
+// writeIfFull writes and resets batch once it reaches stateSyncBatchSize
+func writeIfFull(batch database.Batch) error {
+	if batch.Size() < stateSyncBatchSize {
+		return nil
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	batch.Reset()
+	return nil
+}
+
+// deletePrefix deletes every key in db starting with prefix
+func deletePrefix(db database.Database, prefix []byte) error {
+	it := db.NewIteratorWithPrefix(prefix)
+	defer it.Release()
+
+	batch := db.NewBatch()
+	for it.Next() {
+		if err := batch.Delete(it.Key()); err != nil {
+			return err
+		}
+		if err := writeIfFull(batch); err != nil {
+			return err
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// marshalStateSyncHeadersRequest creates a request for count headers
+// starting at height
+func marshalStateSyncHeadersRequest(height uint64, count uint32) []byte {
+	request := make([]byte, 13)
+	request[0] = byte(stateSyncHeadersRequest)
+	binary.BigEndian.PutUint64(request[1:], height)
+	binary.BigEndian.PutUint32(request[9:], count)
+	return request
+}
+
+// marshalStateSyncBlockRequest creates a request for the block at height
+func marshalStateSyncBlockRequest(height uint64) []byte {
+	request := make([]byte, 9)
+	request[0] = byte(stateSyncBlockRequest)
+	binary.BigEndian.PutUint64(request[1:], height)
+	return request
+}
+
+// marshalStateSyncUTXOsRequest creates a request for the UTXOs of the
+// summary at height following the encoded outpoint after. An empty after
+// requests the first UTXOs.
+func marshalStateSyncUTXOsRequest(height uint64, after []byte) []byte {
+	request := make([]byte, 9, 9+len(after))
+	request[0] = byte(stateSyncUTXOsRequest)
+	binary.BigEndian.PutUint64(request[1:], height)
+	return append(request, after...)
+}
+
+// stateSyncHandler serves the data needed to sync to a state summary
+type stateSyncHandler struct {
+	p2p.NoOpHandler
+
+	log   logging.Logger
+	vm    *VM
+	chain *blockchain.BlockChain
+}
+
+// AppRequest responds to header, block and UTXO requests
+func (h *stateSyncHandler) AppRequest(
+	_ context.Context,
+	nodeID ids.NodeID,
+	_ time.Time,
+	requestBytes []byte,
+) ([]byte, *common.AppError) {
+	if len(requestBytes) < 9 {
+		return nil, p2p.ErrUnexpected
+	}
+
+	var (
+		height   = binary.BigEndian.Uint64(requestBytes[1:])
+		response []byte
+		err      error
+	)
+	switch stateSyncRequestType(requestBytes[0]) {
+	case stateSyncHeadersRequest:
+		if len(requestBytes) != 13 {
+			err = fmt.Errorf("invalid headers request length %d", len(requestBytes))
+			break
+		}
+		response, err = h.handleHeadersRequest(height, binary.BigEndian.Uint32(requestBytes[9:]))
+	case stateSyncBlockRequest:
+		response, err = h.handleBlockRequest(height)
+	case stateSyncUTXOsRequest:
+		response, err = h.handleUTXOsRequest(height, requestBytes[9:])
+	default:
+		err = fmt.Errorf("unknown state sync request type: %d", requestBytes[0])
+	}
+	if err != nil {
+		h.log.Debug("failed to handle state sync request",
+			zap.Stringer("nodeID", nodeID),
+			zap.Error(err),
+		)
+		return nil, p2p.ErrUnexpected
+	}
+	return response, nil
+}
+
+// handleHeadersRequest returns up to count main chain headers starting at
+// height
+func (h *stateSyncHandler) handleHeadersRequest(height uint64, count uint32) ([]byte, error) {
+	count = min(count, maxStateSyncHeaders)
+
+	var buf bytes.Buffer
+	for i := uint64(0); i < uint64(count); i++ {
+		hash, err := h.chain.BlockHashByHeight(int32(height + i))
+		if err != nil {
+			break
+		}
+		header, err := h.chain.HeaderByHash(hash)
+		if err != nil {
+			return nil, err
+		}
+		if err := header.Serialize(&buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// handleBlockRequest returns the main chain block at height
+func (h *stateSyncHandler) handleBlockRequest(height uint64) ([]byte, error) {
+	blk, err := h.chain.BlockByHeight(int32(height))
+	if err != nil {
+		return nil, err
+	}
+	return blk.Bytes()
+}
+
+// handleUTXOsRequest returns the UTXOs of the summary at height that follow
+// the encoded outpoint after
+func (h *stateSyncHandler) handleUTXOsRequest(height uint64, after []byte) ([]byte, error) {
+	if len(after) != 0 && len(after) != utxoKeyLen {
+		return nil, fmt.Errorf("invalid outpoint length %d", len(after))
+	}
+
+	h.vm.summaryLock.Lock()
+	summary := h.vm.lastSummary
+	h.vm.summaryLock.Unlock()
+	if summary == nil || summary.height != height {
+		return nil, fmt.Errorf("%w at height %d", errUnknownSummary, height)
+	}
+
+	snapshotDB := prefixdb.New(snapshotPrefix, h.vm.stateSyncDB)
+	it := snapshotDB.NewIteratorWithStartAndPrefix(snapshotKey(height, after), snapshotKey(height, nil))
+	defer it.Release()
+
+	var (
+		responseSize = 0
+		utxos        = make([][]byte, 0, maxStateSyncUTXOs)
+	)
+	for len(utxos) < maxStateSyncUTXOs && responseSize < stateSyncTargetResponseSize && it.Next() {
+		utxo := bytes.Clone(it.Value())
+		if bytes.Equal(utxo[:utxoKeyLen], after) {
+			continue
+		}
+		responseSize += len(utxo)
+		utxos = append(utxos, utxo)
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	return gossip.MarshalAppResponse(utxos)
+}
@@ -0,0 +1,383 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/MetalBlockchain/metalgo/database"
+	"github.com/MetalBlockchain/metalgo/database/prefixdb"
+	"github.com/MetalBlockchain/metalgo/network/p2p"
+	"github.com/MetalBlockchain/metalgo/network/p2p/gossip"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/snow/engine/snowman/block"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxStateSyncRequestAttempts is the number of peers a state sync
+	// request is sent to before the sync is abandoned
+	maxStateSyncRequestAttempts = 10
+
+	// stateSyncRetryDelay is how long to wait for peers to connect when
+	// there are none to send a request to
+	stateSyncRetryDelay = time.Second
+)
+
+var (
+	stagingHeaderPrefix = []byte("headers")
+	stagingUTXOPrefix   = []byte("utxos")
+
+	errNoStateSyncPeers = errors.New("no peers to state sync from")
+)
+
+// acceptStateSummary starts syncing to summary unless the local chain is
+// close enough to it that bootstrapping is cheaper
+func (vm *VM) acceptStateSummary(_ context.Context, summary *stateSummary) (block.StateSyncMode, error) {
+	// An interrupted sync left the chain state inconsistent, so it must be
+	// completed even if the summary is no longer far enough ahead
+	_, err := vm.stateSyncDB.Get(ongoingSummaryKey)
+	switch err {
+	case nil:
+	case database.ErrNotFound:
+		localHeight := uint64(vm.chain.BestSnapshot().Height)
+		if summary.height < localHeight+vm.stateSyncConfig.MinBlocks {
+			vm.ctx.Log.Info("Skipping state sync, summary is not far enough ahead",
+				zap.Uint64("summaryHeight", summary.height),
+				zap.Uint64("localHeight", localHeight),
+			)
+			return block.StateSyncSkipped, nil
+		}
+	default:
+		return block.StateSyncSkipped, err
+	}
+
+	if err := vm.stateSyncDB.Put(ongoingSummaryKey, summary.Bytes()); err != nil {
+		return block.StateSyncSkipped, err
+	}
+
+	vm.ctx.Log.Info("Starting state sync",
+		zap.Uint64("height", summary.height),
+		zap.Stringer("blockID", summary.blockID),
+		zap.Uint64("numUTXOs", summary.numUTXOs),
+	)
+
+	client := vm.p2pNetwork.NewClient(StateSyncHandlerID)
+	vm.stateSyncWg.Add(1)
+	go func() {
+		defer vm.stateSyncWg.Done()
+
+		vm.stateSyncErr = vm.syncToSummary(vm.stateSyncCtx, client, summary)
+		if vm.stateSyncErr != nil {
+			vm.ctx.Log.Error("state sync failed", zap.Error(vm.stateSyncErr))
+		}
+
+		select {
+		case vm.toEngine <- common.StateSyncDone:
+		case <-vm.stateSyncCtx.Done():
+		}
+	}()
+	return block.StateSyncStatic, nil
+}
+
+// syncToSummary downloads the headers, tip block and UTXO set of summary,
+// checks them against the summary and imports them into the chain
+func (vm *VM) syncToSummary(ctx context.Context, client *p2p.Client, summary *stateSummary) error {
+	start := time.Now()
+	stagingDB := prefixdb.New(stagingPrefix, vm.stateSyncDB)
+
+	// Any staged data belongs to an interrupted sync, possibly to another
+	// summary
+	if err := deletePrefix(stagingDB, nil); err != nil {
+		return fmt.Errorf("failed to clear staged state: %w", err)
+	}
+
+	headerDB := prefixdb.New(stagingHeaderPrefix, stagingDB)
+	if err := vm.syncHeaders(ctx, client, headerDB, summary); err != nil {
+		return fmt.Errorf("failed to sync headers: %w", err)
+	}
+
+	tip, err := vm.syncTipBlock(ctx, client, summary)
+	if err != nil {
+		return fmt.Errorf("failed to sync tip block: %w", err)
+	}
+
+	utxoDB := prefixdb.New(stagingUTXOPrefix, stagingDB)
+	if err := vm.syncUTXOs(ctx, client, utxoDB, summary); err != nil {
+		return fmt.Errorf("failed to sync utxos: %w", err)
+	}
+
+	source := &stagedSnapshot{
+		headerDB: headerDB,
+		utxoDB:   utxoDB,
+	}
+	if err := vm.chain.ImportSnapshot(source, tip, summary.totalTxns); err != nil {
+		return fmt.Errorf("failed to import chain state: %w", err)
+	}
+
+	vm.blocksMu.Lock()
+	vm.lastAccepted = summary.blockID
+	vm.preferred = summary.blockID
+	vm.btcdAdapter.NotifyBlockAccepted(tip.Hash(), int32(summary.height))
+	vm.blocksMu.Unlock()
+	if _, err := vm.indexAcceptedChain(int32(summary.height)); err != nil {
+		return fmt.Errorf("failed to record accepted blocks: %w", err)
+	}
+
+	if err := vm.stateSyncDB.Delete(ongoingSummaryKey); err != nil {
+		return err
+	}
+	if err := deletePrefix(stagingDB, nil); err != nil {
+		return err
+	}
+
+	vm.ctx.Log.Info("Finished state sync",
+		zap.Uint64("height", summary.height),
+		zap.Stringer("blockID", summary.blockID),
+		zap.Duration("duration", time.Since(start)),
+	)
+	return nil
+}
+
+// syncHeaders downloads the headers from height 1 to the summary height,
+// checking that each connects to the previous one
+func (vm *VM) syncHeaders(ctx context.Context, client *p2p.Client, headerDB database.Database, summary *stateSummary) error {
+	prevHash := *vm.config.ChainParams.GenesisHash
+	for height := uint64(1); height <= summary.height; {
+		count := min(summary.height-height+1, maxStateSyncHeaders)
+		request := marshalStateSyncHeadersRequest(height, uint32(count))
+
+		var headers []*wire.BlockHeader
+		err := vm.stateSyncRequest(ctx, client, request, func(response []byte) error {
+			var err error
+			headers, err = parseHeaders(response, prevHash)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		batch := headerDB.NewBatch()
+		for _, header := range headers {
+			var buf bytes.Buffer
+			if err := header.Serialize(&buf); err != nil {
+				return err
+			}
+			if err := batch.Put(database.PackUInt64(height), buf.Bytes()); err != nil {
+				return err
+			}
+			prevHash = header.BlockHash()
+			height++
+		}
+		if err := batch.Write(); err != nil {
+			return err
+		}
+	}
+
+	if hashToID(&prevHash) != summary.blockID {
+		return fmt.Errorf("header chain ends at %s, expected %s", prevHash, summary.blockID)
+	}
+	return nil
+}
+
+// parseHeaders parses a non-empty headers response whose first header
+// follows prevHash
+func parseHeaders(response []byte, prevHash chainhash.Hash) ([]*wire.BlockHeader, error) {
+	if len(response) == 0 || len(response)%wire.MaxBlockHeaderPayload != 0 {
+		return nil, fmt.Errorf("invalid headers length %d", len(response))
+	}
+
+	r := bytes.NewReader(response)
+	headers := make([]*wire.BlockHeader, 0, len(response)/wire.MaxBlockHeaderPayload)
+	for r.Len() > 0 {
+		header := &wire.BlockHeader{}
+		if err := header.Deserialize(r); err != nil {
+			return nil, err
+		}
+		if header.PrevBlock != prevHash {
+			return nil, fmt.Errorf("header %s does not connect to %s", header.BlockHash(), prevHash)
+		}
+		prevHash = header.BlockHash()
+		headers = append(headers, header)
+	}
+	return headers, nil
+}
+
+// syncTipBlock downloads the summarized block
+func (vm *VM) syncTipBlock(ctx context.Context, client *p2p.Client, summary *stateSummary) (*btcutil.Block, error) {
+	var tip *btcutil.Block
+	err := vm.stateSyncRequest(ctx, client, marshalStateSyncBlockRequest(summary.height), func(response []byte) error {
+		blk, err := btcutil.NewBlockFromBytes(response)
+		if err != nil {
+			return err
+		}
+		if hashToID(blk.Hash()) != summary.blockID {
+			return fmt.Errorf("received block %s, expected %s", blk.Hash(), summary.blockID)
+		}
+		tip = blk
+		return nil
+	})
+	return tip, err
+}
+
+// syncUTXOs downloads the UTXO set of summary in outpoint order and checks
+// it against the summary's commitment
+func (vm *VM) syncUTXOs(ctx context.Context, client *p2p.Client, utxoDB database.Database, summary *stateSummary) error {
+	var (
+		commitment = newUTXOCommitment()
+		after      []byte
+	)
+	for {
+		var utxos [][]byte
+		request := marshalStateSyncUTXOsRequest(summary.height, after)
+		err := vm.stateSyncRequest(ctx, client, request, func(response []byte) error {
+			var err error
+			utxos, err = parseUTXOs(response, after)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if len(utxos) == 0 {
+			break
+		}
+
+		batch := utxoDB.NewBatch()
+		for _, utxo := range utxos {
+			commitment.Add(utxo)
+			if err := batch.Put(utxo[:utxoKeyLen], utxo); err != nil {
+				return err
+			}
+		}
+		if err := batch.Write(); err != nil {
+			return err
+		}
+
+		after = utxos[len(utxos)-1][:utxoKeyLen]
+		if commitment.numUTXOs > summary.numUTXOs {
+			return fmt.Errorf("received more than %d utxos", summary.numUTXOs)
+		}
+	}
+
+	if commitment.numUTXOs != summary.numUTXOs {
+		return fmt.Errorf("received %d utxos, expected %d", commitment.numUTXOs, summary.numUTXOs)
+	}
+	if commitment.ID() != summary.utxoCommitment {
+		return fmt.Errorf("utxo commitment %s does not match summary commitment %s", commitment.ID(), summary.utxoCommitment)
+	}
+	return nil
+}
+
+// parseUTXOs parses a UTXOs response, checking that the outputs are valid
+// and follow after in outpoint order
+func parseUTXOs(response []byte, after []byte) ([][]byte, error) {
+	utxos, err := gossip.ParseAppResponse(response)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, utxo := range utxos {
+		if _, _, err := parseUTXO(utxo); err != nil {
+			return nil, err
+		}
+		if bytes.Compare(utxo[:utxoKeyLen], after) <= 0 {
+			return nil, fmt.Errorf("utxo %x is out of order", utxo[:utxoKeyLen])
+		}
+		after = utxo[:utxoKeyLen]
+	}
+	return utxos, nil
+}
+
+// stateSyncRequest sends request to connected peers until one of them
+// returns a response accepted by handle
+func (vm *VM) stateSyncRequest(
+	ctx context.Context,
+	client *p2p.Client,
+	request []byte,
+	handle func(response []byte) error,
+) error {
+	var lastErr error = errNoStateSyncPeers
+	for attempt := 0; attempt < maxStateSyncRequestAttempts; attempt++ {
+		nodeIDs := vm.p2pNetwork.Peers.Sample(1)
+		if len(nodeIDs) == 0 {
+			select {
+			case <-time.After(stateSyncRetryDelay):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		nodeID := nodeIDs[0]
+
+		requestCtx, cancel := context.WithTimeout(ctx, vm.stateSyncConfig.RequestTimeout)
+		response, err := awaitAppRequest(requestCtx, client, nodeID, request)
+		cancel()
+		if err == nil {
+			err = handle(response)
+		}
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		vm.ctx.Log.Debug("state sync request failed",
+			zap.Stringer("nodeID", nodeID),
+			zap.Int("attempt", attempt),
+			zap.Error(err),
+		)
+		lastErr = err
+	}
+	return lastErr
+}
+
+// stagedSnapshot supplies the headers and UTXO set staged during a sync to
+// the chain import
+type stagedSnapshot struct {
+	headerDB database.Database
+	utxoDB   database.Database
+}
+
+// ForEachHeader calls fn with the staged headers in order of height
+func (s *stagedSnapshot) ForEachHeader(fn func(*wire.BlockHeader) error) error {
+	it := s.headerDB.NewIterator()
+	defer it.Release()
+
+	for it.Next() {
+		header := &wire.BlockHeader{}
+		if err := header.Deserialize(bytes.NewReader(it.Value())); err != nil {
+			return err
+		}
+		if err := fn(header); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// ForEachUtxo calls fn with the staged UTXOs in outpoint order
+func (s *stagedSnapshot) ForEachUtxo(fn func(wire.OutPoint, *blockchain.UtxoEntry) error) error {
+	it := s.utxoDB.NewIterator()
+	defer it.Release()
+
+	for it.Next() {
+		outpoint, entry, err := parseUTXO(it.Value())
+		if err != nil {
+			return err
+		}
+		if err := fn(outpoint, entry); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
@@ -0,0 +1,49 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"fmt"
+	"time"
+)
+
+// StateSyncConfig contains all configuration parameters for state sync
+type StateSyncConfig struct {
+	// Enabled syncs the UTXO set from peers instead of replaying every block
+	// when the node is far behind the network
+	// Default: false
+	Enabled bool
+
+	// MinBlocks is the minimum number of blocks a state summary must be ahead
+	// of the local chain for state sync to be used instead of bootstrapping
+	// Default: 300000
+	MinBlocks uint64
+
+	// SummaryInterval is the number of blocks between state summaries served
+	// to peers. Zero disables producing summaries.
+	// Default: 4096
+	SummaryInterval uint64
+
+	// RequestTimeout is the maximum duration of a single state sync request
+	// Default: 30s
+	RequestTimeout time.Duration
+}
+
+// DefaultStateSyncConfig returns the default state sync configuration
+func DefaultStateSyncConfig() StateSyncConfig {
+	return StateSyncConfig{
+		Enabled:         false,
+		MinBlocks:       300_000,
+		SummaryInterval: 4096,
+		RequestTimeout:  30 * time.Second,
+	}
+}
+
+// Validate checks if the state sync configuration is valid
+func (c *StateSyncConfig) Validate() error {
+	if c.RequestTimeout <= 0 {
+		return fmt.Errorf("state sync request timeout must be positive, got %s", c.RequestTimeout)
+	}
+	return nil
+}
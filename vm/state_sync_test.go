@@ -0,0 +1,126 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/MetalBlockchain/metalgo/database"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/snow/engine/snowman/block"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateSync(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+
+	toEngine := make(chan common.Message, 1)
+	vms := newTestVMsWithConfig(t, 2, key, `"noCFilters":true`, nil)
+	server, client := vms[0], vms[1]
+	client.toEngine = toEngine
+
+	// Produce a summary every other block and build past the first one
+	server.stateSyncConfig.SummaryInterval = 2
+	for i := 0; i < 3; i++ {
+		blk, err := server.BuildBlock(ctx)
+		require.NoError(err)
+		require.NoError(blk.Verify(ctx))
+		require.NoError(blk.Accept(ctx))
+	}
+
+	var summary block.StateSummary
+	require.Eventually(func() bool {
+		summary, err = server.GetLastStateSummary(ctx)
+		return err == nil
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Equal(uint64(2), summary.Height())
+
+	client.stateSyncConfig.Enabled = true
+	client.stateSyncConfig.MinBlocks = 1
+	enabled, err := client.StateSyncEnabled(ctx)
+	require.NoError(err)
+	require.True(enabled)
+
+	clientSummary, err := client.ParseStateSummary(ctx, summary.Bytes())
+	require.NoError(err)
+	require.Equal(summary.ID(), clientSummary.ID())
+
+	mode, err := clientSummary.Accept(ctx)
+	require.NoError(err)
+	require.Equal(block.StateSyncStatic, mode)
+
+	select {
+	case msg := <-toEngine:
+		require.Equal(common.StateSyncDone, msg)
+	case <-time.After(30 * time.Second):
+		require.FailNow("state sync did not finish")
+	}
+	require.NoError(client.stateSyncErr)
+
+	lastAccepted, err := client.LastAccepted(ctx)
+	require.NoError(err)
+	require.Equal(clientSummary.(*stateSummary).blockID, lastAccepted)
+
+	_, err = client.GetOngoingSyncStateSummary(ctx)
+	require.ErrorIs(err, database.ErrNotFound)
+
+	// The synced client continues from the summary block
+	serverBlk, err := server.GetBlockIDAtHeight(ctx, 3)
+	require.NoError(err)
+	blk, err := server.GetBlock(ctx, serverBlk)
+	require.NoError(err)
+	clientBlk, err := client.ParseBlock(ctx, blk.Bytes())
+	require.NoError(err)
+	require.NoError(clientBlk.Verify(ctx))
+	require.NoError(clientBlk.Accept(ctx))
+	require.Equal(blk.ID(), clientBlk.ID())
+}
+
+func TestStateSummaryRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	summary := newStateSummary(nil, 4096, ids.GenerateTestID(), ids.GenerateTestID(), 10, 20)
+	parsed, err := parseStateSummary(nil, summary.Bytes())
+	require.NoError(err)
+	require.Equal(summary.ID(), parsed.ID())
+	require.Equal(summary.Height(), parsed.Height())
+	require.Equal(summary.blockID, parsed.blockID)
+	require.Equal(summary.utxoCommitment, parsed.utxoCommitment)
+	require.Equal(summary.numUTXOs, parsed.numUTXOs)
+	require.Equal(summary.totalTxns, parsed.totalTxns)
+
+	_, err = parseStateSummary(nil, summary.Bytes()[1:])
+	require.Error(err)
+}
+
+func TestUTXORoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	outpoint := wire.OutPoint{Hash: chainhash.Hash{0x01}, Index: 3}
+	txOut := wire.NewTxOut(5_000_000_000, []byte{0x51})
+	entry := blockchain.NewUtxoEntry(txOut, 100, true)
+
+	utxo := marshalUTXO(outpoint, entry)
+	parsedOutpoint, parsedEntry, err := parseUTXO(utxo)
+	require.NoError(err)
+	require.Equal(outpoint, parsedOutpoint)
+	require.Equal(entry.Amount(), parsedEntry.Amount())
+	require.Equal(entry.PkScript(), parsedEntry.PkScript())
+	require.Equal(entry.BlockHeight(), parsedEntry.BlockHeight())
+	require.Equal(entry.IsCoinBase(), parsedEntry.IsCoinBase())
+
+	_, _, err = parseUTXO(utxo[:utxoHeaderLen-1])
+	require.Error(err)
+}
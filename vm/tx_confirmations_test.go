@@ -0,0 +1,81 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+)
+
+func TestTxConfirmations(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMsWithConfig(t, 1, key, `"rpcUser":"user","rpcPass":"pass","txIndex":true`, nil)[0]
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	buildTestChain(t, vm, 1)
+	blk, err := vm.GetBlock(ctx, vm.lastAccepted)
+	require.NoError(err)
+	coinbase := blk.(*BlockAdapter).btcBlock.Transactions()[0].MsgTx()
+
+	// A transaction of the mempool has no confirmations
+	spend := newTestSpend(t, key, coinbase)
+	var txID string
+	callRPC(t, handlers["/rpc"], "sendrawtransaction", []interface{}{txHex(t, spend.MsgTx())}, &txID)
+	var result btcjson.GetTxConfirmationsResult
+	callRPC(t, handlers["/rpc"], "gettxconfirmations", []interface{}{txID}, &result)
+	require.Equal(btcjson.GetTxConfirmationsResult{AcceptedHeight: 1}, result)
+	var raw btcjson.TxRawResult
+	callRPC(t, handlers["/rpc"], "getrawtransaction", []interface{}{txID, 1}, &raw)
+	require.Equal(btcjson.Bool(false), raw.Finalized)
+
+	// Once its block is verified and preferred, the transaction is confirmed
+	// but not final until consensus accepts the block
+	processing, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(processing.Verify(ctx))
+	require.NoError(vm.SetPreference(ctx, processing.ID()))
+	require.Len(processing.(*BlockAdapter).btcBlock.Transactions(), 2)
+	blockHash := processing.(*BlockAdapter).btcBlock.Hash().String()
+
+	result = btcjson.GetTxConfirmationsResult{}
+	callRPC(t, handlers["/rpc"], "gettxconfirmations", []interface{}{txID}, &result)
+	require.Equal(btcjson.GetTxConfirmationsResult{
+		BlockHash:      blockHash,
+		BlockHeight:    2,
+		AcceptedHeight: 1,
+		Confirmations:  1,
+		Finalized:      false,
+	}, result)
+	raw = btcjson.TxRawResult{}
+	callRPC(t, handlers["/rpc"], "getrawtransaction", []interface{}{txID, 1}, &raw)
+	require.Equal(uint64(1), raw.Confirmations)
+	require.Equal(btcjson.Bool(false), raw.Finalized)
+
+	// The accepted block finalizes the transaction
+	require.NoError(processing.Accept(ctx))
+	buildTestChain(t, vm, 1)
+
+	result = btcjson.GetTxConfirmationsResult{}
+	callRPC(t, handlers["/rpc"], "gettxconfirmations", []interface{}{txID}, &result)
+	require.Equal(btcjson.GetTxConfirmationsResult{
+		BlockHash:      blockHash,
+		BlockHeight:    2,
+		AcceptedHeight: 3,
+		Confirmations:  2,
+		Finalized:      true,
+	}, result)
+	raw = btcjson.TxRawResult{}
+	callRPC(t, handlers["/rpc"], "getrawtransaction", []interface{}{txID, 1}, &raw)
+	require.Equal(uint64(2), raw.Confirmations)
+	require.Equal(btcjson.Bool(true), raw.Finalized)
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg"
+	"github.com/MetalBlockchain/btcvm/btcd/txscript"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+)
+
+// TestSpendVestedOutput spends an output vested like the premine allocations
+// of the genesis generator, a P2WSH output whose witness script is
+//
+//	<locktime> OP_CHECKLOCKTIMEVERIFY OP_DROP
+//	OP_DUP OP_HASH160 <keyHash> OP_EQUALVERIFY OP_CHECKSIG
+func TestSpendVestedOutput(t *testing.T) {
+	const lockHeight = 310
+
+	require := require.New(t)
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vm := newTestVMs(t, 1, key)[0]
+	chain := vm.btcdAdapter.Chain()
+	mempool := vm.btcdAdapter.TxMemPool()
+
+	pubKey := key.PubKey().SerializeCompressed()
+	redeemScript, err := txscript.NewScriptBuilder().
+		AddInt64(lockHeight).
+		AddOp(txscript.OP_CHECKLOCKTIMEVERIFY).
+		AddOp(txscript.OP_DROP).
+		AddOp(txscript.OP_DUP).
+		AddOp(txscript.OP_HASH160).
+		AddData(btcutil.Hash160(pubKey)).
+		AddOp(txscript.OP_EQUALVERIFY).
+		AddOp(txscript.OP_CHECKSIG).
+		Script()
+	require.NoError(err)
+	scriptHash := sha256.Sum256(redeemScript)
+	pkScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(scriptHash[:]).Script()
+	require.NoError(err)
+
+	// Pay a coinbase to the vested output
+	buildTestChain(t, vm, 1)
+	coinbase := acceptedBlocks(t, vm)[0].(*BlockAdapter).btcBlock.Transactions()[0].MsgTx()
+	fund := newTestSpend(t, key, coinbase)
+	fund.MsgTx().TxOut[0].PkScript = pkScript
+	sigScript, err := txscript.SignatureScript(fund.MsgTx(), 0, coinbase.TxOut[0].PkScript, txscript.SigHashAll, key, true)
+	require.NoError(err)
+	fund.MsgTx().TxIn[0].SignatureScript = sigScript
+	fund = btcutil.NewTx(fund.MsgTx())
+	_, err = mempool.ProcessTransaction(fund, false, false, 0)
+	require.NoError(err)
+	buildTestChain(t, vm, 1)
+	_, err = chain.FetchUtxoEntry(wire.OutPoint{Hash: *fund.Hash(), Index: 0})
+	require.NoError(err)
+
+	// Witness scripts are validated once segwit is active
+	for {
+		active, err := chain.IsDeploymentActive(chaincfg.DeploymentSegwit)
+		require.NoError(err)
+		if active {
+			break
+		}
+		buildTestChain(t, vm, 1)
+	}
+	require.Less(chain.BestSnapshot().Height, int32(lockHeight-1))
+
+	// spend returns a spend of the vested output with the given locktime
+	prevOut := fund.MsgTx().TxOut[0]
+	spend := func(lockTime uint32) *btcutil.Tx {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Hash: *fund.Hash(), Index: 0},
+			Sequence:         0,
+		})
+		tx.AddTxOut(wire.NewTxOut(prevOut.Value-10_000, coinbase.TxOut[0].PkScript))
+		tx.LockTime = lockTime
+
+		prevFetcher := txscript.NewCannedPrevOutputFetcher(prevOut.PkScript, prevOut.Value)
+		sigHashes := txscript.NewTxSigHashes(tx, prevFetcher)
+		sig, err := txscript.RawTxInWitnessSignature(tx, sigHashes, 0, prevOut.Value, redeemScript, txscript.SigHashAll, key)
+		require.NoError(err)
+		tx.TxIn[0].Witness = wire.TxWitness{sig, pubKey, redeemScript}
+		return btcutil.NewTx(tx)
+	}
+
+	// Spends whose locktime is below the lock height are invalid
+	for chain.BestSnapshot().Height < lockHeight-1 {
+		buildTestChain(t, vm, 1)
+	}
+	_, err = mempool.ProcessTransaction(spend(lockHeight-1), false, false, 0)
+	require.ErrorContains(err, "locktime requirement not satisfied")
+
+	// The spend is not final in the block at the lock height, so it is
+	// mined in the block after it
+	vested := spend(lockHeight)
+	_, err = mempool.ProcessTransaction(vested, false, false, 0)
+	require.NoError(err)
+	buildTestChain(t, vm, 1)
+	blks := acceptedBlocks(t, vm)
+	require.Len(blks[lockHeight-1].(*BlockAdapter).btcBlock.Transactions(), 1)
+	buildTestChain(t, vm, 1)
+	blks = acceptedBlocks(t, vm)
+	txs := blks[lockHeight].(*BlockAdapter).btcBlock.Transactions()
+	require.Len(txs, 2)
+	require.Equal(vested.Hash(), txs[1].Hash())
+}
@@ -1,18 +1,26 @@
 package vm
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	btcd "github.com/MetalBlockchain/btcvm/btcd"
 	"github.com/MetalBlockchain/btcvm/btcd/blockchain"
 	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
 	"github.com/MetalBlockchain/btcvm/btcd/mempool"
+	"github.com/MetalBlockchain/btcvm/btcd/wire"
+	"github.com/MetalBlockchain/metalgo/api/metrics"
+	"github.com/MetalBlockchain/metalgo/cache"
 	"github.com/MetalBlockchain/metalgo/database"
 	"github.com/MetalBlockchain/metalgo/ids"
 	"github.com/MetalBlockchain/metalgo/network/p2p"
@@ -21,6 +29,9 @@ import (
 	"github.com/MetalBlockchain/metalgo/snow/consensus/snowman"
 	"github.com/MetalBlockchain/metalgo/snow/engine/common"
 	"github.com/MetalBlockchain/metalgo/snow/engine/snowman/block"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/MetalBlockchain/metalgo/utils/set"
+	"github.com/MetalBlockchain/metalgo/utils/timer/mockable"
 	"github.com/MetalBlockchain/metalgo/version"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -32,12 +43,30 @@ var (
 
 	errNotInitialized     = errors.New("VM not initialized")
 	errAlreadyInitialized = errors.New("VM already initialized")
+
+	// ErrBlockBuildingDisabled is returned by BuildBlock when the node is
+	// configured not to build blocks
+	ErrBlockBuildingDisabled = errors.New("block building is disabled")
+
+	// ErrStaleParent is returned by BuildBlock when another block became the
+	// tip of btcd while the block was being prepared. The build can be
+	// retried on the new tip.
+	ErrStaleParent = errors.New("parent of built block is no longer the tip")
 )
 
 const (
 	Name = "btcvm"
 )
 
+// Roles of the node reported by HealthCheck
+const (
+	// roleBuilder builds blocks in addition to following the chain
+	roleBuilder = "builder"
+
+	// roleFollower only follows the chain, as block building is disabled
+	roleFollower = "follower"
+)
+
 var Version = &version.Semantic{
 	Major: 0,
 	Minor: 0,
@@ -46,38 +75,153 @@ var Version = &version.Semantic{
 
 // VM implements the Metal ChainVM interface for Bitcoin
 type VM struct {
+	// Clock is the source of the current time of the VM. If it is nil when
+	// the VM is initialized, the real clock is used.
+	Clock Clock
+
 	// Metal context
 	ctx      *snow.Context
 	db       database.Database
 	toEngine chan<- common.Message
 
-	config *btcd.Config
+	// metrics is the registry for all VM metrics, exported through the
+	// snow context's gatherer when one is available
+	metrics *prometheus.Registry
+
+	config     *btcd.Config
+	nodeConfig Config
+
+	// genesisHash is the hash of the genesis bytes of the chain
+	genesisHash [sha256.Size]byte
+
+	// increasingTimestamps is set if the chain params of the genesis
+	// require block times to be after the time of their parent
+	increasingTimestamps bool
 
 	// btcd adapter (encapsulates blockchain, mempool, RPC, etc.)
 	btcdAdapter *btcd.Server
 
-	// Unified gossip system (replaces separate tx/block gossipers)
+	// Loggers of the subsystems of the VM with levels of their own
+	gossipLog  logging.Logger
+	builderLog logging.Logger
+
+	// btcdLogSink writes the logs of the btcd subsystems to the VM log
+	btcdLogSink *btcdLogSink
+	// nodeLog is the VM log, set by Initialize for the loggers of the plugin
+	// process, which run concurrently with it
+	nodeLog atomic.Pointer[logging.Logger]
+
+	// Unified gossip system (replaces separate tx/block gossipers). The push
+	// gossiper is created when normal operations start, while blocks may
+	// already be relayed on goroutines of their own, so it is published
+	// atomically after the set it gossips.
 	gossipConfig  GossipConfig
 	btcSet        *UnifiedBTCSet
-	pushGossiper  *gossip.PushGossiper[*BTCGossip]
+	relaySet      *relayWindowSet
+	gossipQueue   *gossipQueue
+	pushGossiper  atomic.Pointer[typedPushGossiper]
 	pullGossiper  gossip.Gossiper
+	gossipStats   *gossipStats
 	p2pNetwork    *p2p.Network
 	p2pValidators *p2p.Validators
 
+	// Peers connected on the Metal network, reported by getpeerinfo and
+	// pushed gossip to when no validator is connected
+	peers *peerSet
+
+	// Outcomes of the items pushed by each peer, reported by getpeerinfo
+	peerGossip *peerGossipTracker
+
+	// State sync
+	stateSyncConfig StateSyncConfig
+	stateSyncDB     database.Database
+	stateSyncCtx    context.Context
+	stateSyncCancel context.CancelFunc
+	stateSyncWg     sync.WaitGroup
+	stateSyncErr    error
+	summaryLock     sync.Mutex
+	lastSummary     *stateSummary
+	snapshotting    bool
+
 	// Bitcoin components (legacy, kept for compatibility)
 	chain *blockchain.BlockChain
 
 	appSender common.AppSender
 
 	// Block management
-	preferred    ids.ID
-	lastAccepted ids.ID
-	blocksMu     sync.RWMutex
+	cacheConfig   CacheConfig
+	blockCache    *cache.LRU[ids.ID, *BlockAdapter]
+	blockVerifier func(blk *BlockAdapter, parent *BlockAdapter) error
+	preferred     ids.ID
+	lastAccepted  ids.ID
+	blocksMu      sync.RWMutex
+
+	// reorgs follows the reorganizations of the btcd main chain
+	reorgs *reorgTracker
+
+	// feeEstimator estimates fee rates for the estimatesmartfee and
+	// estimatefeebytime RPCs
+	feeEstimator *feeEstimator
+
+	// orphansEvicted counts the transactions evicted from the orphan pool
+	// by reason
+	orphansEvicted *prometheus.CounterVec
+
+	// txsEvicted counts the transactions evicted from the mempool because it
+	// is full or expired, by reason
+	txsEvicted *prometheus.CounterVec
+
+	// txsReplaced counts the transactions evicted from the mempool by a
+	// replacement, either as conflicts or as their descendants
+	txsReplaced *prometheus.CounterVec
+
+	// doubleSpends remembers the recent double spends of mempool
+	// transactions for getdoublespends, and doubleSpendsSeen counts them
+	doubleSpends     *doubleSpendCache
+	doubleSpendsSeen *prometheus.CounterVec
+
+	// rpcLimiter enforces the rate and size limits of the RPC clients
+	rpcLimiter *rpcLimiter
+
+	// Compact filters of accepted blocks, served over RPC and to peers
+	blockFilterDB           database.Database
+	blockFilterClient       *p2p.Client
+	blockFiltersUnavailable bool
+
+	// Decisions of consensus, reported by getchaintips. processing holds the
+	// verified blocks which are not decided yet and is protected by blocksMu.
+	blockDecisionDB database.Database
+	processing      set.Set[ids.ID]
+
+	// IDs of the accepted blocks by height, which the chain state is
+	// resynced from, and the status of the last resync
+	acceptedBlockDB database.Database
+	resync          chainResync
+
+	// maintenance flushes the UTXO cache and compacts the chain database
+	maintenance maintenance
+
+	// acceptor is told of each accepted block, to export it
+	acceptor Acceptor
+
+	// blockValidityChanges counts the blocks marked as invalid or valid by
+	// the invalidateblock and reconsiderblock RPCs
+	blockValidityChanges *prometheus.CounterVec
 
 	// Block building
 	buildBlockLock sync.Mutex
 	blockBuilder   *blockBuilder
 	builderLock    sync.Mutex
+	buildFailures  *buildFailureTracker
+
+	// processLock serializes the blocks given to btcd, so that no block is
+	// connected while a block is built on the tip
+	processLock sync.Mutex
+
+	// Blocks requested through the generatetoaddress RPC
+	generateLock sync.Mutex
+	generateMu   sync.Mutex
+	generating   *generateRequest
 
 	// Lifecycle management for gossip goroutines
 	cancel       context.CancelFunc
@@ -92,7 +236,8 @@ type VM struct {
 }
 
 type genesisBytes struct {
-	Config btcd.Config `json:"config"`
+	Config      btcd.Config `json:"config"`
+	ChainParams ChainParams `json:"chainParams"`
 }
 
 // parseGenesisBytes parses genesis bytes from JSON
@@ -120,7 +265,7 @@ func (vm *VM) Initialize(
 	toEngine chan<- common.Message,
 	_ []*common.Fx,
 	appSender common.AppSender,
-) error {
+) (err error) {
 	// Store context first so we can use the logger
 	vm.ctx = snowCtx
 
@@ -131,21 +276,42 @@ func (vm *VM) Initialize(
 		return errAlreadyInitialized
 	}
 
+	// A VM failing to initialize stops what it started, so that the node
+	// can initialize a new VM over the same database and data directory
+	defer func() {
+		if err != nil {
+			if shutdownErr := vm.Shutdown(ctx); shutdownErr != nil {
+				vm.ctx.Log.Error("Error shutting down VM which failed to initialize", zap.Error(shutdownErr))
+			}
+		}
+	}()
+
 	vm.db = db
 	vm.toEngine = toEngine
 	vm.appSender = appSender
 	vm.shutdownChan = make(chan struct{})
+	vm.peers = newPeerSet()
+	if vm.Clock == nil {
+		vm.Clock = &mockable.Clock{}
+	}
+	vm.initializeNodeLog()
 
-	// Parse genesis to get config
-	gb, err := parseGenesisBytes(genesisBytes)
-	if err != nil {
-		return fmt.Errorf("failed to parse genesis: %w", err)
+	if vm.ctx.Metrics != nil {
+		reg, err := metrics.MakeAndRegister(vm.ctx.Metrics, Name)
+		if err != nil {
+			return fmt.Errorf("failed to register metrics: %w", err)
+		}
+		vm.metrics = reg
+	} else {
+		vm.metrics = prometheus.NewRegistry()
 	}
 
-	config, _, err := btcd.LoadConfig(vm.ctx.NodeID.String(), &gb.Config)
+	genesis, err := LoadGenesis(genesisBytes, vm.ctx.ChainID, vm.ctx.NodeID)
 	if err != nil {
-		return fmt.Errorf("failed to parse config: %w", err)
+		return err
 	}
+	config := genesis.Config
+	vm.increasingTimestamps = genesis.ChainParams.IncreasingTimestamps
 
 	// Disable legacy networking
 	config.DisableListen = true
@@ -153,19 +319,70 @@ func (vm *VM) Initialize(
 	config.MaxPeers = 0
 	config.Upnp = false
 
+	// Apply the upgrades and then the node config over the genesis config
+	upgrades, err := parseUpgradeBytes(upgradeBytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse upgrades: %w", err)
+	}
+	if err := upgrades.Validate(); err != nil {
+		return fmt.Errorf("invalid upgrades: %w", err)
+	}
+	deployments := config.ChainParams.Deployments
+	upgrades.apply(config)
+
+	vm.nodeConfig = newConfig(config)
+	if err := parseConfigBytes(configBytes, &vm.nodeConfig); err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+	if err := vm.nodeConfig.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	vm.genesisHash = genesis.Hash
+	if err := vm.verifyGenesisHash(); err != nil {
+		return err
+	}
+	vm.nodeConfig.apply(config)
+	if err := vm.resolveDataDir(config); err != nil {
+		return err
+	}
+	if err := vm.initializeMiningAddrs(config, genesis.MiningAddrs); err != nil {
+		return err
+	}
+	// Built blocks record this node as their proposer in their coinbase
+	config.SetCoinbaseTag(proposerTag(vm.ctx.NodeID))
+
 	vm.config = config
 
 	// Initialize gossip configuration with defaults
 	vm.gossipConfig = DefaultGossipConfig()
+	vm.gossipConfig.TxGossipValidatorsOnly = vm.nodeConfig.TxGossipValidatorsOnly
+	vm.gossipConfig.BloomRotationInterval = time.Duration(vm.nodeConfig.GossipBloomRotationMinutes) * time.Minute
+	vm.nodeConfig.GossipLimits.apply(&vm.gossipConfig)
 	if err := vm.gossipConfig.Validate(); err != nil {
 		return fmt.Errorf("invalid gossip config: %w", err)
 	}
 
+	vm.stateSyncConfig = DefaultStateSyncConfig()
+	if err := vm.stateSyncConfig.Validate(); err != nil {
+		return fmt.Errorf("invalid state sync config: %w", err)
+	}
+
+	vm.cacheConfig = DefaultCacheConfig()
+	if err := vm.cacheConfig.Validate(); err != nil {
+		return fmt.Errorf("invalid cache config: %w", err)
+	}
+	vm.blockCache = &cache.LRU[ids.ID, *BlockAdapter]{Size: vm.cacheConfig.BlockCacheSize}
+	vm.blockVerifier = vm.verifyBlock
+
 	vm.ctx.Log.Info("initializing Bitcoin VM",
 		zap.String("network", config.ChainParams.Name),
 		zap.String("dbPath", config.DataDir),
 		zap.String("dbType", config.DbType),
+		zap.String("genesisHash", hex.EncodeToString(vm.genesisHash[:])),
 		zap.String("gossipConfig", fmt.Sprintf("%+v", vm.gossipConfig)),
+		zap.Uint("utxoCacheMaxSizeMiB", config.UtxoCacheMaxSizeMiB),
+		zap.Uint("sigCacheMaxEntries", config.SigCacheMaxSize),
+		zap.Int("maxScriptValidationWorkers", config.MaxScriptWorkers),
 	)
 
 	// Initialize btcd adapter (replaces btcd server)
@@ -176,16 +393,75 @@ func (vm *VM) Initialize(
 		return fmt.Errorf("failed to initialize btcd adapter: %w", err)
 	}
 	vm.btcdAdapter = btcdAdapter
+	if err := vm.verifyDataDirGenesis(); err != nil {
+		return err
+	}
+	if err := vm.verifyCheckpoints(); err != nil {
+		return err
+	}
+	if err := vm.verifyActivationHeights(upgrades.ActivationHeights, deployments); err != nil {
+		return fmt.Errorf("mismatched upgrades: %w", err)
+	}
+	if err := vm.initializeLogging(); err != nil {
+		return err
+	}
 
-	// Initialize block builder and set callback before starting server
-	vm.blockBuilder = newBlockBuilder(vm)
-	vm.btcdAdapter.SetOnTxAccepted(vm.blockBuilder.onTxAccepted)
+	// Initialize block builder and set callback before starting server.
+	// Nodes not building blocks have no builder.
+	if !vm.nodeConfig.DisableBlockBuilding {
+		vm.blockBuilder, err = newBlockBuilder(vm)
+		if err != nil {
+			return err
+		}
+		vm.btcdAdapter.SetOnTxAccepted(vm.blockBuilder.onTxAccepted)
+		if vm.blockBuilder.waitForEventOnly {
+			vm.ctx.Log.Info("no engine channel, blocks are built through WaitForEvent only")
+		}
+	} else {
+		vm.ctx.Log.Info("block building disabled, following the chain only")
+	}
+	vm.btcdAdapter.SetGenerateToAddress(vm.generateToAddress)
+	vm.btcdAdapter.SetConsensusInfo(vm.consensusInfo)
+	vm.btcdAdapter.SetNetworkInfo(vm.networkInfo, vm.peerInfo)
+	vm.btcdAdapter.SetExportChainState(vm.exportChainStateRPC)
+	vm.btcdAdapter.SetCheckpoint(vm.checkpoint)
+	vm.btcdAdapter.SetGossipInfo(vm.gossipInfo)
+	vm.btcdAdapter.SetMiningInfo(vm.miningInfo)
+	vm.btcdAdapter.SetBlockProposer(vm.blockProposerRPC)
+	if vm.nodeConfig.RPCAuth != nil {
+		if vm.nodeConfig.RPCAuth.NoAuth {
+			vm.ctx.Log.Warn("RPC authentication disabled, do not expose the RPC API publicly")
+		}
+		vm.btcdAdapter.SetRPCAuth(newRPCAuthorizer(vm.nodeConfig.RPCAuth).authenticate)
+	}
+	vm.rpcLimiter, err = newRPCLimiter(vm.nodeConfig.RPCLimits, vm.ctx.Log, vm.metrics)
+	if err != nil {
+		return err
+	}
+	vm.btcdAdapter.SetRPCLimitExceeded(vm.rpcLimiter.limitExceeded)
+	if err := vm.initializeFeeEstimator(); err != nil {
+		return err
+	}
+	if err := vm.initializeOrphanPool(); err != nil {
+		return err
+	}
+	if err := vm.initializeMempoolEviction(); err != nil {
+		return err
+	}
+	if err := vm.initializePeers(); err != nil {
+		return err
+	}
+	if err := vm.initializeReplacements(); err != nil {
+		return err
+	}
+	if err := vm.initializeDoubleSpends(); err != nil {
+		return err
+	}
 	vm.btcdAdapter.Start()
 
 	// Initialize p2p network
 	vm.ctx.Log.Info("Initializing p2p network")
-	reg := prometheus.NewRegistry()
-	p2pNet, err := p2p.NewNetwork(vm.ctx.Log, appSender, reg, "p2p")
+	p2pNet, err := p2p.NewNetwork(vm.ctx.Log, &fallbackSender{AppSender: appSender, vm: vm}, vm.metrics, "p2p")
 	if err != nil {
 		return fmt.Errorf("failed to create p2p network: %w", err)
 	}
@@ -199,12 +475,41 @@ func (vm *VM) Initialize(
 	vm.chain = vm.btcdAdapter.Chain()
 	vm.ctx.Log.Info("btcd adapter initialized successfully")
 
+	// Serve state summaries to peers and allow syncing from them
+	if err := vm.initializeStateSync(); err != nil {
+		return fmt.Errorf("failed to initialize state sync: %w", err)
+	}
+
+	// Sign warp messages making claims about the chain
+	if err := vm.initializeWarp(); err != nil {
+		return err
+	}
+
+	// Record the accepted chain and resync the chain state from it if
+	// needed, before the last accepted block is read from the chain state
+	if err := vm.initializeAcceptedBlocks(); err != nil {
+		return err
+	}
+
+	// Export the accepted blocks, catching up from where the export stopped
+	if err := vm.initializeAcceptor(); err != nil {
+		return err
+	}
+
+	// Flush the UTXO cache and compact the database at the maintenance
+	// window
+	if err := vm.initializeMaintenance(); err != nil {
+		return err
+	}
+
 	// Get the latest block from the chain and set it as lastAccepted
 	bestSnapshot := vm.chain.BestSnapshot()
 	if bestSnapshot != nil {
 		// Convert btcd hash to Metal ID
 		vm.lastAccepted = hashToID(&bestSnapshot.Hash)
 		vm.preferred = vm.lastAccepted
+		vm.finalize(vm.lastAccepted)
+		vm.btcdAdapter.NotifyBlockAccepted(&bestSnapshot.Hash, bestSnapshot.Height)
 		vm.ctx.Log.Info("Set lastAccepted to best block",
 			zap.Int32("height", bestSnapshot.Height),
 			zap.String("hash", bestSnapshot.Hash.String()),
@@ -214,32 +519,65 @@ func (vm *VM) Initialize(
 		vm.ctx.Log.Warn("No best block found, lastAccepted remains empty")
 	}
 
-	// Set the callback for relaying transactions via unified gossip
+	// Build and serve the filters of accepted blocks
+	if err := vm.initializeBlockFilters(); err != nil {
+		return err
+	}
+
+	// Report the consensus status of the chain tips
+	vm.initializeBlockDecisions()
+	if err := vm.initializeBlockValidity(); err != nil {
+		return err
+	}
+
+	// Set the callbacks for relaying transactions via unified gossip,
+	// pushing those submitted by clients right away
 	vm.btcdAdapter.OnTxRelay = func(txns []*mempool.TxDesc) {
-		for _, txD := range txns {
-			// Use unified gossip if available
-			if vm.pushGossiper != nil {
-				item := NewTxGossip(txD.Tx)
-				vm.pushGossiper.Add(item)
-				vm.ctx.Log.Debug("Gossiped transaction via unified gossip",
-					zap.String("hash", txD.Tx.Hash().String()))
-			}
-		}
+		vm.addTxsToPushGossip(txns)
+	}
+	vm.btcdAdapter.OnLocalTxRelay = vm.pushLocalTxs
+	vm.btcdAdapter.OnSubmitBlock = vm.submitBlock
+
+	// Track reorganizations of the main chain
+	reorgs, err := newReorgTracker(vm.onReorg, vm.metrics, "")
+	if err != nil {
+		return fmt.Errorf("failed to create reorg tracker: %w", err)
+	}
+	vm.reorgs = reorgs
+	vm.btcdAdapter.OnBlockConnected = vm.reorgs.onBlockConnected
+	vm.btcdAdapter.OnBlockDisconnected = vm.reorgs.onBlockDisconnected
+
+	// Track failed builds for HealthCheck
+	vm.buildFailures, err = newBuildFailureTracker(vm.metrics, "block_builder")
+	if err != nil {
+		return fmt.Errorf("failed to create build failure tracker: %w", err)
 	}
 
 	// Set the callback for relaying blocks via unified gossip
 	vm.btcdAdapter.OnBlockRelay = func(block *btcutil.Block) {
+		// Blocks are accepted after the reorganization they caused, if any
+		vm.reorgs.complete()
+
 		// Run gossip asynchronously to avoid blocking block processing
 		go func(b *btcutil.Block) {
+			// Don't gossip blocks of a fork that lost a reorganization
+			if vm.reorgs.isDisconnected(b.Hash()) {
+				vm.gossipLog.Debug("Skipping block gossip - disconnected by reorg",
+					zap.String("hash", b.Hash().String()),
+					zap.Int32("height", b.Height()),
+				)
+				return
+			}
+
 			// Use unified gossip if available
-			if vm.pushGossiper != nil {
+			if pushGossiper := vm.pushGossiper.Load(); pushGossiper != nil {
 				item := NewBlockGossip(b)
 
 				// Check if we already gossiped this block to avoid continuous re-gossip
 				// The bloom filter tracks blocks we've seen/gossiped
-				if vm.btcSet != nil && vm.btcSet.bloom != nil {
-					if vm.btcSet.bloom.Has(item) {
-						vm.ctx.Log.Debug("Skipping block gossip - already in bloom filter",
+				if vm.btcSet != nil {
+					if vm.btcSet.inBloom(item) {
+						vm.gossipLog.Debug("Skipping block gossip - already in bloom filter",
 							zap.String("hash", b.Hash().String()),
 							zap.Int32("height", b.Height()),
 						)
@@ -247,8 +585,9 @@ func (vm *VM) Initialize(
 					}
 				}
 
-				vm.pushGossiper.Add(item)
-				vm.ctx.Log.Info("Gossiped block via unified gossip",
+				vm.relaySet.relay(b)
+				pushGossiper.Add(item)
+				vm.gossipLog.Info("Gossiped block via unified gossip",
 					zap.String("hash", b.Hash().String()),
 					zap.Int32("height", b.Height()))
 			}
@@ -277,6 +616,9 @@ func (vm *VM) SetState(ctx context.Context, state snow.State) error {
 		return nil
 
 	case snow.Bootstrapping:
+		if vm.stateSyncErr != nil {
+			return fmt.Errorf("state sync failed: %w", vm.stateSyncErr)
+		}
 		vm.bootstrapped = false
 		vm.ctx.Log.Info("Bitcoin VM bootstrapping")
 		return nil
@@ -295,6 +637,9 @@ func (vm *VM) SetState(ctx context.Context, state snow.State) error {
 		}
 
 		// Initialize block building after gossip is set up
+		if vm.nodeConfig.DisableBlockBuilding {
+			return nil
+		}
 		return vm.initBlockBuilding()
 
 	default:
@@ -317,6 +662,11 @@ func (vm *VM) onNormalOperationsStarted() error {
 	// Start gossip loops
 	vm.startGossipLoops()
 
+	// Serve our mempool to peers and fetch theirs
+	if err := vm.initializeMempoolSync(); err != nil {
+		return fmt.Errorf("failed to initialize mempool sync: %w", err)
+	}
+
 	vm.ctx.Log.Info("Normal operations started successfully")
 	return nil
 }
@@ -332,6 +682,8 @@ func (vm *VM) initBlockBuilding() error {
 		return fmt.Errorf("block builder not initialized")
 	}
 
+	// Blocks are not built on a chain state being resynced
+	vm.resync.wait()
 	vm.blockBuilder.start()
 	vm.ctx.Log.Info("initBlockBuilding blockBuilder started")
 
@@ -358,8 +710,11 @@ func (vm *VM) WaitForEvent(ctx context.Context) (common.Message, error) {
 	builder := vm.blockBuilder
 	vm.builderLock.Unlock()
 
+	// Nodes not building blocks never have pending transactions to build
 	if builder == nil {
-		vm.ctx.Log.Warn("WaitForEvent called but blockBuilder is nil")
+		if !vm.nodeConfig.DisableBlockBuilding {
+			vm.ctx.Log.Warn("WaitForEvent called but blockBuilder is nil")
+		}
 		select {
 		case <-ctx.Done():
 			return 0, ctx.Err()
@@ -384,30 +739,23 @@ func (vm *VM) Shutdown(ctx context.Context) error {
 
 	vm.ctx.Log.Info("shutting down Bitcoin VM")
 
-	// Cancel gossip context to stop goroutines
-	if vm.cancel != nil {
-		vm.ctx.Log.Info("Cancelling gossip context")
-		vm.cancel()
-	}
-
-	// Note: p2pNetwork cleanup is handled by the network layer automatically
-
-	// Stop btcd adapter (gracefully closes database and other resources)
-	if vm.btcdAdapter != nil {
-		vm.ctx.Log.Info("Stopping btcd adapter")
-		if err := vm.btcdAdapter.Stop(); err != nil {
-			vm.ctx.Log.Error("Error stopping btcd adapter", zap.Error(err))
-		}
-	}
-
-	// Signal shutdown
+	// Signal shutdown first so that nothing waits on the resources stopped
+	// below
 	close(vm.shutdownChan)
+	vm.stopped = true
 
-	// Wait for all gossip goroutines to finish
-	vm.ctx.Log.Info("Waiting for gossip goroutines to finish")
-	vm.shutdownWg.Wait()
+	timeout := time.Duration(vm.nodeConfig.ShutdownTimeoutSeconds) * time.Second
+	err := vm.runShutdownSteps(ctx, timeout, vm.shutdownSteps())
 
-	vm.stopped = true
+	// Leave no state of the VM in the process, as the node may initialize a
+	// new VM of the chain in it
+	btcd.RemoveLogSink(vm.btcdLogSink)
+	if vm.ctx.Metrics != nil {
+		vm.ctx.Metrics.Deregister(Name)
+	}
+	if err != nil {
+		return err
+	}
 
 	vm.ctx.Log.Info("Bitcoin VM shutdown complete")
 	return nil
@@ -415,10 +763,23 @@ func (vm *VM) Shutdown(ctx context.Context) error {
 
 // BuildBlock builds a new block
 func (vm *VM) BuildBlock(ctx context.Context) (snowman.Block, error) {
+	return vm.buildBlock(ctx, nil)
+}
+
+// buildBlock builds a new block, committing to the P-chain height of blockCtx
+// if it is not nil
+func (vm *VM) buildBlock(ctx context.Context, blockCtx *block.Context) (blk snowman.Block, err error) {
 	vm.ctx.Log.Info("BuildBlock called by Snowman engine")
 
+	if vm.nodeConfig.DisableBlockBuilding {
+		return nil, ErrBlockBuildingDisabled
+	}
+
 	vm.buildBlockLock.Lock()
 	defer vm.buildBlockLock.Unlock()
+	defer func() {
+		vm.buildFailures.record(blk, err, vm.Clock.Time())
+	}()
 
 	if vm.btcdAdapter == nil {
 		return nil, fmt.Errorf("btcd adapter not initialized")
@@ -443,39 +804,69 @@ func (vm *VM) BuildBlock(ctx context.Context) (snowman.Block, error) {
 		return nil, fmt.Errorf("block template generator not available")
 	}
 
-	if len(vm.config.MiningAddrs) == 0 {
-		return nil, fmt.Errorf("no mining address configured")
+	payToAddr, err := vm.payToAddr()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errBuildMiningAddr, err)
 	}
 
-	payToAddr, err := btcutil.DecodeAddress(vm.config.MiningAddrs[0], vm.config.ChainParams)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode mining address: %w", err)
+	// No block connects from gossip or consensus until the block is
+	// processed, so that it is built on the tip and from a mempool the
+	// transactions of the tip were removed from. A block connected since the
+	// parent was read makes the block a sibling bound to lose, so the build
+	// is retried on the new tip instead.
+	vm.processLock.Lock()
+	defer vm.processLock.Unlock()
+	if bestHash := vm.chain.BestSnapshot().Hash; !bestHash.IsEqual(currentBlock.Hash()) {
+		return nil, fmt.Errorf("%w: tip moved from %s to %s", ErrStaleParent, currentBlock.Hash(), bestHash)
 	}
 
-	template, err := generator.NewBlockTemplate(payToAddr)
+	templateStart := vm.Clock.Time()
+	template, err := vm.newBlockTemplate(generator, payToAddr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create block template: %w", err)
+		return nil, fmt.Errorf("%w: %w", errBuildTemplate, err)
+	}
+	templateDuration := vm.Clock.Time().Sub(templateStart)
+
+	// The time of the template is taken from the clock, which may be behind
+	// the parent or far ahead of it
+	if err := vm.clampBlockTime(generator, template.Block); err != nil {
+		return nil, err
 	}
 
+	// The commitment is added before the block is processed so that it is
+	// part of the block hash. Its few bytes fit in the margin btcd keeps
+	// between the mining and consensus block weight limits.
+	if blockCtx != nil {
+		if err := commitPChainHeight(template.Block, blockCtx.PChainHeight); err != nil {
+			return nil, err
+		}
+	}
+
+	// The block is stored and identified by the bytes it is serialized to
+	// here, with the encoding peers parse it with
 	template.Block.Header.Nonce = 0
-	block := btcutil.NewBlock(template.Block)
+	blockBytes, err := serializeBlock(template.Block)
+	if err != nil {
+		return nil, err
+	}
+	block := btcutil.NewBlockFromBlockAndBytes(template.Block, blockBytes)
 
 	isMainChain, isOrphan, err := vm.btcdAdapter.ProcessBlockNoPoW(block)
 	if err != nil {
-		return nil, fmt.Errorf("failed to process block: %w", err)
+		return nil, fmt.Errorf("%w: %w", errBuildProcess, err)
 	}
 
 	if isOrphan {
-		return nil, fmt.Errorf("generated block is orphan (parent missing)")
+		return nil, errBuildOrphan
 	}
 
-	blockAdapter, err := NewBlockAdapter(vm, block)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create block adapter: %w", err)
-	}
+	blockAdapter := newBlockAdapterWithBytes(vm, block, blockBytes)
+	vm.blockCache.Put(blockAdapter.ID(), blockAdapter)
+	vm.onBlockBuilt(blockAdapter.ID(), payToAddr)
 
 	if vm.blockBuilder != nil {
 		vm.blockBuilder.clearPendingSignal()
+		vm.blockBuilder.metrics.observeBuild(templateDuration, len(block.Transactions()), block.MsgBlock().SerializeSize())
 	}
 
 	vm.ctx.Log.Info("Built block",
@@ -493,11 +884,37 @@ func (vm *VM) ParseBlock(ctx context.Context, blockBytes []byte) (snowman.Block,
 		return nil, errNotInitialized
 	}
 
+	// Blocks are identified by the hash of their header, so a block that was
+	// already parsed can be found without deserializing it
+	if len(blockBytes) >= wire.MaxBlockHeaderPayload {
+		blockHash := chainhash.DoubleHashH(blockBytes[:wire.MaxBlockHeaderPayload])
+		blockID := hashToID(&blockHash)
+		if blockAdapter, ok := vm.blockCache.Get(blockID); ok && bytes.Equal(blockAdapter.Bytes(), blockBytes) {
+			return blockAdapter, nil
+		}
+
+		// Blocks btcd already processed, such as blocks received through
+		// gossip, are not processed again
+		have, err := vm.chain.HaveBlock(&blockHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up block: %w", err)
+		}
+		if have {
+			blockAdapter, err := newKnownBlockAdapter(vm, blockBytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse known block: %w", err)
+			}
+			vm.blockCache.Put(blockAdapter.ID(), blockAdapter)
+			return blockAdapter, nil
+		}
+	}
+
 	// Create block adapter from the serialized bytes
 	blockAdapter, err := NewBlockAdapterFromBytes(vm, blockBytes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse block: %w", err)
 	}
+	vm.blockCache.Put(blockAdapter.ID(), blockAdapter)
 
 	vm.ctx.Log.Info("Successfully parsed block",
 		zap.String("blockID", blockAdapter.ID().String()),
@@ -514,7 +931,13 @@ func (vm *VM) GetBlock(ctx context.Context, blockID ids.ID) (snowman.Block, erro
 	vm.ctx.Log.Debug("getting block", zap.String("id", blockID.String()))
 
 	block, err := vm.getBlock(blockID)
-	if err != nil {
+	switch {
+	case errors.Is(err, ErrBlockNotFound):
+		// The engine fetches the blocks it doesn't know of
+		vm.ctx.Log.Debug("block not found",
+			zap.String("id", blockID.String()))
+		return nil, err
+	case err != nil:
 		vm.ctx.Log.Error("failed to get block",
 			zap.String("id", blockID.String()),
 			zap.Error(err))
@@ -526,15 +949,29 @@ func (vm *VM) GetBlock(ctx context.Context, blockID ids.ID) (snowman.Block, erro
 
 // getBlock returns a block by ID (internal)
 func (vm *VM) getBlock(blockID ids.ID) (snowman.Block, error) {
+	if blockAdapter, ok := vm.blockCache.Get(blockID); ok {
+		return blockAdapter, nil
+	}
+
 	// Use the block adapter to fetch and wrap the Bitcoin block
 	blockAdapter, err := NewBlockAdapterFromID(vm, blockID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get block adapter: %w", err)
+		return nil, err
 	}
+	vm.blockCache.Put(blockID, blockAdapter)
 
 	return blockAdapter, nil
 }
 
+// processBlock validates and stores block in btcd with flags. Blocks are
+// processed one at a time and never while a block is built.
+func (vm *VM) processBlock(block *btcutil.Block, flags blockchain.BehaviorFlags) (bool, bool, error) {
+	vm.processLock.Lock()
+	defer vm.processLock.Unlock()
+
+	return vm.chain.ProcessBlock(block, flags)
+}
+
 // getCurrentBlock returns the current best block from the blockchain
 func (vm *VM) getCurrentBlock() (*btcutil.Block, error) {
 	bestHash := vm.chain.BestSnapshot().Hash
@@ -545,17 +982,33 @@ func (vm *VM) getCurrentBlock() (*btcutil.Block, error) {
 	return block, nil
 }
 
-// SetPreference sets the preferred block
+// SetPreference sets the preferred block. A build scheduled on the previous
+// preferred block is rescheduled on the new one.
 func (vm *VM) SetPreference(ctx context.Context, blockID ids.ID) error {
 	if !vm.initialized {
 		return errNotInitialized
 	}
 
+	vm.blocksMu.Lock()
+	moved := vm.preferred != blockID
 	vm.preferred = blockID
+	vm.blocksMu.Unlock()
 	vm.ctx.Log.Debug("set preference", zap.String("id", blockID.String()))
+
+	if moved && vm.blockBuilder != nil {
+		vm.blockBuilder.onPreferenceChanged(blockID)
+	}
 	return nil
 }
 
+// preferredBlock returns the ID of the preferred block
+func (vm *VM) preferredBlock() ids.ID {
+	vm.blocksMu.RLock()
+	defer vm.blocksMu.RUnlock()
+
+	return vm.preferred
+}
+
 // LastAccepted returns the last accepted block ID
 func (vm *VM) LastAccepted(ctx context.Context) (ids.ID, error) {
 	if !vm.initialized {
@@ -571,8 +1024,15 @@ func (vm *VM) GetBlockIDAtHeight(ctx context.Context, height uint64) (ids.ID, er
 		return ids.Empty, errNotInitialized
 	}
 
-	// Get block hash at the specified height
-	blockHash, err := vm.chain.BlockHashByHeight(int32(height))
+	// Get block hash at the specified height from the block index, without
+	// loading the block. Heights above the last accepted block are not
+	// indexed.
+	headers, err := vm.chain.MainChainHeaders(int32(height), 1)
+	if blockchain.IsBlockNotFoundErr(err) {
+		vm.ctx.Log.Debug("no block at height",
+			zap.Uint64("height", height))
+		return ids.Empty, fmt.Errorf("%w: %w", ErrBlockNotFound, err)
+	}
 	if err != nil {
 		vm.ctx.Log.Error("failed to get block hash at height",
 			zap.Uint64("height", height),
@@ -581,7 +1041,7 @@ func (vm *VM) GetBlockIDAtHeight(ctx context.Context, height uint64) (ids.ID, er
 	}
 
 	// Convert Bitcoin hash to Metal ID
-	blockID := hashToID(blockHash)
+	blockID := hashToID(&headers[0].Hash)
 	vm.ctx.Log.Debug("retrieved block ID at height",
 		zap.Uint64("height", height),
 		zap.String("id", blockID.String()))
@@ -594,16 +1054,30 @@ func (vm *VM) Version(ctx context.Context) (string, error) {
 	return Version.String(), nil
 }
 
-// HealthCheck returns health status
+// HealthCheck returns health status. The node is unhealthy once its last
+// unhealthyBuildFailureStreak builds failed.
 func (vm *VM) HealthCheck(ctx context.Context) (interface{}, error) {
 	if !vm.initialized {
 		return nil, errNotInitialized
 	}
 
-	return map[string]interface{}{
-		"initialized":  vm.initialized,
-		"lastAccepted": vm.lastAccepted.String(),
-	}, nil
+	details := map[string]interface{}{
+		"initialized":       vm.initialized,
+		"lastAccepted":      vm.lastAccepted.String(),
+		"utxoCacheBytes":    vm.chain.CachedStateSize(),
+		"utxoCacheMaxBytes": uint64(vm.config.UtxoCacheMaxSizeMiB) * 1024 * 1024,
+		"connectedPeers":    vm.peers.len(),
+		"role":              vm.role(),
+	}
+	return details, vm.buildFailures.health(details)
+}
+
+// role returns the role of the node in the network
+func (vm *VM) role() string {
+	if vm.nodeConfig.DisableBlockBuilding {
+		return roleFollower
+	}
+	return roleBuilder
 }
 
 // AppGossip handles incoming gossip messages
@@ -623,8 +1097,11 @@ func (vm *VM) AppRequest(
 	deadline time.Time,
 	msgBytes []byte,
 ) error {
-	// Not implemented yet
-	return nil
+	if !vm.initialized {
+		return errNotInitialized
+	}
+
+	return vm.p2pNetwork.AppRequest(ctx, nodeID, requestID, deadline, msgBytes)
 }
 
 // AppRequestFailed handles failed app requests
@@ -634,24 +1111,41 @@ func (vm *VM) AppRequestFailed(
 	requestID uint32,
 	appErr *common.AppError,
 ) error {
-	// Log the failure
-	return nil
+	if !vm.initialized {
+		return errNotInitialized
+	}
+
+	return vm.p2pNetwork.AppRequestFailed(ctx, nodeID, requestID, appErr)
 }
 
 // AppResponse handles responses to app requests
 func (vm *VM) AppResponse(ctx context.Context, nodeID ids.NodeID, requestID uint32, msgBytes []byte) error {
-	// Not implemented yet
-	return nil
+	if !vm.initialized {
+		return errNotInitialized
+	}
+
+	return vm.p2pNetwork.AppResponse(ctx, nodeID, requestID, msgBytes)
 }
 
 // Connected is called when a new connection is established
 func (vm *VM) Connected(ctx context.Context, nodeID ids.NodeID, nodeVersion *version.Application) error {
-	return nil
+	if !vm.initialized {
+		return errNotInitialized
+	}
+
+	vm.peers.connected(nodeID, nodeVersion, vm.Clock.Time())
+	return vm.p2pNetwork.Connected(ctx, nodeID, nodeVersion)
 }
 
 // Disconnected is called when a connection is terminated
 func (vm *VM) Disconnected(ctx context.Context, nodeID ids.NodeID) error {
-	return nil
+	if !vm.initialized {
+		return errNotInitialized
+	}
+
+	vm.peers.disconnected(nodeID)
+	vm.peerGossip.disconnected(nodeID)
+	return vm.p2pNetwork.Disconnected(ctx, nodeID)
 }
 
 // CrossChainAppRequest handles incoming cross-chain app requests
@@ -702,8 +1196,21 @@ func (vm *VM) CreateHandlers(context.Context) (map[string]http.Handler, error) {
 		zap.Strings("endpoints", []string{"Bitcoin RPC methods via btcd adapter"}),
 	)
 
-	return map[string]http.Handler{
-		"/rpc": rpcHandler,
-		"/ws":  wsHandler,
-	}, nil
+	metalHandler, err := vm.metalHandler()
+	if err != nil {
+		return nil, err
+	}
+
+	handlers := map[string]http.Handler{
+		"/rpc":        vm.rpcLimiter.wrapRPC(rpcHandler),
+		"/ws":         vm.rpcLimiter.wrapWebsocket(wsHandler),
+		metalEndpoint: vm.rpcLimiter.wrapRPC(metalHandler),
+	}
+	if vm.nodeConfig.DebugAPIEnabled {
+		for endpoint, handler := range vm.debugHandlers() {
+			handlers[endpoint] = handler
+		}
+		vm.ctx.Log.Warn("Debug API enabled, do not expose it publicly")
+	}
+	return handlers, nil
 }
@@ -0,0 +1,364 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vmtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/MetalBlockchain/metalgo/snow/consensus/snowman"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/snow/validators"
+	"github.com/MetalBlockchain/metalgo/snow/validators/validatorstest"
+	"github.com/MetalBlockchain/metalgo/utils/set"
+	"github.com/MetalBlockchain/metalgo/version"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcjson"
+	"github.com/MetalBlockchain/btcvm/vm"
+)
+
+var errNotAtTip = errors.New("node is not at the tip of the network")
+
+// Node is a node of a network
+type Node struct {
+	NodeID ids.NodeID
+	VM     *vm.VM
+
+	handlers map[string]http.Handler
+}
+
+// CallRPC calls the RPC method of the node with params and decodes its result
+// into result, unless result is nil
+func (n *Node) CallRPC(method string, params []interface{}, result interface{}) error {
+	request, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "1.0",
+		"id":      1,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+	recorder := httptest.NewRecorder()
+	n.handlers["/rpc"].ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/rpc", bytes.NewReader(request)))
+
+	var response struct {
+		Result json.RawMessage   `json:"result"`
+		Error  *btcjson.RPCError `json:"error"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		return fmt.Errorf("failed to parse response to %s with status %d: %w", method, recorder.Code, err)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+// Network is a network of in-process nodes validating the same chain, whose
+// app messages are delivered by a router. Its consensus accepts every block
+// on every node as soon as it is built.
+type Network struct {
+	t      testing.TB
+	Router *Router
+	Nodes  []*Node
+
+	// consensusLock serializes the decisions of blocks. decided is closed,
+	// and replaced under consensusLock, when a block is accepted.
+	consensusLock sync.Mutex
+	lastAccepted  ids.ID
+	decided       chan struct{}
+
+	// decisionLatency is how long built blocks take to be accepted
+	decisionLatency time.Duration
+}
+
+// NewNetwork returns a network of numNodes connected validators of a new
+// chain, in normal operation and mining to key. Their chains are kept in
+// memory and their RPC endpoints serve every method without authentication.
+// The nodes are shut down when the test ends.
+func NewNetwork(t testing.TB, numNodes int, key *btcec.PrivateKey, configBytes []byte) *Network {
+	return NewNetworkWithValidators(t, numNodes, numNodes, key, configBytes)
+}
+
+// NewNetworkWithValidators returns a network like NewNetwork whose first
+// numValidators nodes are the validators of the chain. The other nodes only
+// follow the chain, like RPC nodes.
+func NewNetworkWithValidators(t testing.TB, numNodes int, numValidators int, key *btcec.PrivateKey, configBytes []byte) *Network {
+	nodeConfigs := make([][]byte, numNodes)
+	for i := range nodeConfigs {
+		nodeConfigs[i] = configBytes
+	}
+	return newNetwork(t, numValidators, key, nodeConfigs)
+}
+
+// NewNetworkWithNodeConfigs returns a network like NewNetwork with a validator
+// for each of nodeConfigs, configured with it
+func NewNetworkWithNodeConfigs(t testing.TB, key *btcec.PrivateKey, nodeConfigs ...[]byte) *Network {
+	return newNetwork(t, len(nodeConfigs), key, nodeConfigs)
+}
+
+// newNetwork returns a network of a node for each of nodeConfigs, whose first
+// numValidators nodes are the validators of the chain
+func newNetwork(t testing.TB, numValidators int, key *btcec.PrivateKey, nodeConfigs [][]byte) *Network {
+	require := require.New(t)
+	ctx := context.Background()
+
+	n := &Network{
+		t:       t,
+		Router:  NewRouter(),
+		Nodes:   make([]*Node, len(nodeConfigs)),
+		decided: make(chan struct{}),
+	}
+	vdrs := make(map[ids.NodeID]*validators.GetValidatorOutput, numValidators)
+	vdrIDs := set.NewSet[ids.NodeID](numValidators)
+	for i := range n.Nodes {
+		nodeID := ids.GenerateTestNodeID()
+		n.Nodes[i] = &Node{NodeID: nodeID}
+		if i < numValidators {
+			vdrs[nodeID] = &validators.GetValidatorOutput{
+				NodeID: nodeID,
+				Weight: 1,
+			}
+			vdrIDs.Add(nodeID)
+		}
+	}
+	n.Router.SetValidators(vdrIDs)
+	validatorState := &validatorstest.State{
+		GetCurrentHeightF: func(context.Context) (uint64, error) {
+			return 0, nil
+		},
+		GetValidatorSetF: func(context.Context, uint64, ids.ID) (map[ids.NodeID]*validators.GetValidatorOutput, error) {
+			return vdrs, nil
+		},
+	}
+
+	chainID := ids.GenerateTestID()
+	for i, node := range n.Nodes {
+		configBytes := withConfig(t, nodeConfigs[i], map[string]string{
+			"dbType":  `"memdb"`,
+			"rpcAuth": `{"noAuth":true}`,
+		})
+		node.VM = newVM(t, chainID, node.NodeID, key, configBytes, validatorState, n.Router.Sender(node.NodeID))
+		n.Router.Register(node.NodeID, node.VM)
+	}
+	// Messages are no longer delivered once the nodes start shutting down
+	t.Cleanup(n.Router.Close)
+
+	for _, node := range n.Nodes {
+		for _, peer := range n.Nodes {
+			if peer != node {
+				require.NoError(node.VM.Connected(ctx, peer.NodeID, version.CurrentApp))
+			}
+		}
+		require.NoError(node.VM.SetState(ctx, snow.Bootstrapping))
+		require.NoError(node.VM.SetState(ctx, snow.NormalOp))
+
+		handlers, err := node.VM.CreateHandlers(ctx)
+		require.NoError(err)
+		node.handlers = handlers
+	}
+
+	var err error
+	n.lastAccepted, err = n.Nodes[0].VM.LastAccepted(ctx)
+	require.NoError(err)
+	return n
+}
+
+// Start runs the consensus loop of the network until the test ends. Nodes
+// at the tip of the network build a block when their VM asks to, which is
+// then accepted by every node.
+func (n *Network) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, node := range n.Nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n.run(ctx, node)
+		}()
+	}
+	n.t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+}
+
+// run builds blocks on node when its VM asks to until ctx is cancelled. A
+// block the VM asks to build on a parent another node built on meanwhile is
+// counted as a sibling and not built, as consensus would reject it.
+func (n *Network) run(ctx context.Context, node *Node) {
+	for {
+		msg, err := node.VM.WaitForEvent(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				n.t.Errorf("node %s failed to wait for events: %v", node.NodeID, err)
+			}
+			return
+		}
+		if msg != common.PendingTxs {
+			continue
+		}
+		parent, err := node.VM.LastAccepted(ctx)
+		if err != nil {
+			n.t.Errorf("node %s failed to get its last accepted block: %v", node.NodeID, err)
+			return
+		}
+
+		n.consensusLock.Lock()
+		decided := n.decided
+		if n.builtOn(ctx, node, parent) {
+			n.consensusLock.Unlock()
+			continue
+		}
+		_, err = n.buildBlock(ctx, node)
+		n.consensusLock.Unlock()
+		switch {
+		case errors.Is(err, errNotAtTip):
+			// The node catches up when the next block is accepted
+			select {
+			case <-decided:
+			case <-ctx.Done():
+				return
+			}
+		case err != nil && ctx.Err() == nil:
+			n.t.Errorf("node %s failed to build a block: %v", node.NodeID, err)
+		}
+	}
+}
+
+// builtOn returns whether node is at the tip of the network and another block
+// was accepted on top of parent, the block node had last accepted when its VM
+// asked to build. n.consensusLock must be held.
+func (n *Network) builtOn(ctx context.Context, node *Node, parent ids.ID) bool {
+	lastAccepted, err := node.VM.LastAccepted(ctx)
+	return err == nil && lastAccepted == n.lastAccepted && parent != lastAccepted
+}
+
+// SetDecisionLatency sets how long the blocks built by the nodes take to be
+// accepted by every node, as consensus would take to decide them. Nodes may
+// ask to build siblings of a block meanwhile.
+func (n *Network) SetDecisionLatency(latency time.Duration) {
+	n.consensusLock.Lock()
+	defer n.consensusLock.Unlock()
+
+	n.decisionLatency = latency
+}
+
+// BuildBlock builds a block on the node at index i and accepts it on every
+// node
+func (n *Network) BuildBlock(ctx context.Context, i int) (snowman.Block, error) {
+	n.consensusLock.Lock()
+	defer n.consensusLock.Unlock()
+
+	return n.buildBlock(ctx, n.Nodes[i])
+}
+
+// buildBlock builds a block on node and accepts it on every node. Nodes the
+// delivery of the block to is dropped do not accept it and fall behind.
+// n.consensusLock must be held.
+func (n *Network) buildBlock(ctx context.Context, node *Node) (snowman.Block, error) {
+	lastAccepted, err := node.VM.LastAccepted(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if lastAccepted != n.lastAccepted {
+		return nil, fmt.Errorf("%w: last accepted %s instead of %s", errNotAtTip, lastAccepted, n.lastAccepted)
+	}
+
+	blk, err := node.VM.BuildBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if n.decisionLatency > 0 {
+		time.Sleep(n.decisionLatency)
+	}
+	if err := accept(ctx, node.VM, blk); err != nil {
+		return nil, err
+	}
+	for _, peer := range n.Nodes {
+		if peer == node || n.Router.dropped(Message{Type: Block, From: node.NodeID, To: peer.NodeID}) {
+			continue
+		}
+		if err := n.acceptFrom(ctx, peer, node, blk.ID()); err != nil {
+			return nil, fmt.Errorf("node %s failed to accept block %s: %w", peer.NodeID, blk.ID(), err)
+		}
+	}
+
+	n.lastAccepted = blk.ID()
+	close(n.decided)
+	n.decided = make(chan struct{})
+	return blk, nil
+}
+
+// acceptFrom accepts the block blkID of src on node. The ancestors of the
+// block node has not accepted are fetched from src and accepted first, the
+// way the consensus engine fetches the ancestors of a block whose parent is
+// unknown.
+func (n *Network) acceptFrom(ctx context.Context, node *Node, src *Node, blkID ids.ID) error {
+	lastAcceptedID, err := node.VM.LastAccepted(ctx)
+	if err != nil {
+		return err
+	}
+	lastAccepted, err := node.VM.GetBlock(ctx, lastAcceptedID)
+	if err != nil {
+		return err
+	}
+
+	var ancestors []snowman.Block
+	for id := blkID; id != lastAcceptedID; {
+		blk, err := src.VM.GetBlock(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to fetch block %s: %w", id, err)
+		}
+		if blk.Height() <= lastAccepted.Height() {
+			return fmt.Errorf("block %s at height %d conflicts with last accepted block %s", id, blk.Height(), lastAcceptedID)
+		}
+		ancestors = append(ancestors, blk)
+		id = blk.Parent()
+	}
+
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		blk, err := node.VM.ParseBlock(ctx, ancestors[i].Bytes())
+		if err != nil {
+			return err
+		}
+		if err := accept(ctx, node.VM, blk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// accept verifies blk, sets it as the preference of nodeVM and accepts it
+func accept(ctx context.Context, nodeVM *vm.VM, blk snowman.Block) error {
+	if err := blk.Verify(ctx); err != nil {
+		return err
+	}
+	if err := nodeVM.SetPreference(ctx, blk.ID()); err != nil {
+		return err
+	}
+	return blk.Accept(ctx)
+}
+
+// Eventually waits until condition returns true, failing the test after
+// timeout
+func (n *Network) Eventually(condition func() bool, timeout time.Duration) {
+	require.Eventually(n.t, condition, timeout, 10*time.Millisecond)
+}
@@ -0,0 +1,274 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vmtest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/utils/set"
+
+	"github.com/MetalBlockchain/btcvm/vm"
+)
+
+// MessageType is the type of a message routed between two nodes
+type MessageType uint8
+
+// Types of the messages routed between nodes
+const (
+	AppGossip MessageType = iota
+	AppRequest
+	AppResponse
+	AppError
+
+	// Block is the delivery of a block accepted by the consensus loop of a
+	// network
+	Block
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case AppGossip:
+		return "AppGossip"
+	case AppRequest:
+		return "AppRequest"
+	case AppResponse:
+		return "AppResponse"
+	case AppError:
+		return "AppError"
+	case Block:
+		return "Block"
+	default:
+		return "Unknown"
+	}
+}
+
+// Message is a message routed between two nodes
+type Message struct {
+	Type MessageType
+	From ids.NodeID
+	To   ids.NodeID
+}
+
+// Router delivers the app messages of the VMs of a network to each other in
+// process. Messages are delivered asynchronously after the latency of the
+// router, unless its drop function drops them. Like the network of a node, a
+// request that is dropped, or whose response is dropped, fails with a timeout.
+type Router struct {
+	lock    sync.Mutex
+	nodes   map[ids.NodeID]*vm.VM
+	latency time.Duration
+	drop    func(Message) bool
+
+	// validators are the nodes receiving gossip sent to validators. If nil,
+	// every node is a validator.
+	validators set.Set[ids.NodeID]
+
+	// closed is set, under lock, once no more messages are delivered.
+	// deliveries tracks the messages being delivered.
+	closed     bool
+	closing    chan struct{}
+	deliveries sync.WaitGroup
+}
+
+// NewRouter returns a router without nodes that delivers every message
+// without latency
+func NewRouter() *Router {
+	return &Router{
+		nodes:   make(map[ids.NodeID]*vm.VM),
+		closing: make(chan struct{}),
+	}
+}
+
+// SetLatency sets the delay before messages are delivered
+func (r *Router) SetLatency(latency time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.latency = latency
+}
+
+// SetDrop sets the function returning whether a message is dropped. If nil,
+// every message is delivered.
+func (r *Router) SetDrop(drop func(Message) bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.drop = drop
+}
+
+// SetValidators sets the nodes receiving gossip sent to validators. Other
+// nodes receive gossip sent to non-validators. If nil, every node is a
+// validator.
+func (r *Router) SetValidators(validators set.Set[ids.NodeID]) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.validators = validators
+}
+
+// Register delivers the messages to nodeID to vm
+func (r *Router) Register(nodeID ids.NodeID, vm *vm.VM) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.nodes[nodeID] = vm
+}
+
+// Sender returns the AppSender of the node nodeID
+func (r *Router) Sender(nodeID ids.NodeID) common.AppSender {
+	return &sender{
+		router: r,
+		nodeID: nodeID,
+	}
+}
+
+// Close stops delivering messages and waits for the messages being delivered
+func (r *Router) Close() {
+	r.lock.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.closing)
+	}
+	r.lock.Unlock()
+
+	r.deliveries.Wait()
+}
+
+// dropped returns whether msg is dropped
+func (r *Router) dropped(msg Message) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.droppedLocked(msg)
+}
+
+// droppedLocked returns whether msg is dropped, which it is if it is sent to
+// an unknown node. r.lock must be held.
+func (r *Router) droppedLocked(msg Message) bool {
+	_, ok := r.nodes[msg.To]
+	return !ok || (r.drop != nil && r.drop(msg))
+}
+
+// route calls deliver with the VM msg is sent to after the latency of the
+// router, or onDrop instead if msg is dropped
+func (r *Router) route(msg Message, deliver func(*vm.VM), onDrop func()) {
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return
+	}
+	to := r.nodes[msg.To]
+	drop := r.droppedLocked(msg)
+	latency := r.latency
+	r.deliveries.Add(1)
+	r.lock.Unlock()
+
+	go func() {
+		defer r.deliveries.Done()
+
+		if latency > 0 {
+			timer := time.NewTimer(latency)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-r.closing:
+				return
+			}
+		}
+		if !drop {
+			deliver(to)
+		} else if onDrop != nil {
+			onDrop()
+		}
+	}()
+}
+
+// failRequest fails the request requestID of requester to responder with a
+// timeout
+func (r *Router) failRequest(requester, responder ids.NodeID, requestID uint32) {
+	r.lock.Lock()
+	requesterVM, ok := r.nodes[requester]
+	r.lock.Unlock()
+	if ok {
+		_ = requesterVM.AppRequestFailed(context.Background(), responder, requestID, common.ErrTimeout)
+	}
+}
+
+// sender implements common.AppSender for a node by routing its messages
+type sender struct {
+	router *Router
+	nodeID ids.NodeID
+}
+
+func (s *sender) SendAppRequest(_ context.Context, nodeIDs set.Set[ids.NodeID], requestID uint32, request []byte) error {
+	for nodeID := range nodeIDs {
+		s.router.route(
+			Message{Type: AppRequest, From: s.nodeID, To: nodeID},
+			func(to *vm.VM) {
+				_ = to.AppRequest(context.Background(), s.nodeID, requestID, time.Now().Add(time.Minute), request)
+			},
+			func() { s.router.failRequest(s.nodeID, nodeID, requestID) },
+		)
+	}
+	return nil
+}
+
+func (s *sender) SendAppResponse(_ context.Context, nodeID ids.NodeID, requestID uint32, response []byte) error {
+	s.router.route(
+		Message{Type: AppResponse, From: s.nodeID, To: nodeID},
+		func(to *vm.VM) {
+			_ = to.AppResponse(context.Background(), s.nodeID, requestID, response)
+		},
+		func() { s.router.failRequest(nodeID, s.nodeID, requestID) },
+	)
+	return nil
+}
+
+func (s *sender) SendAppError(_ context.Context, nodeID ids.NodeID, requestID uint32, code int32, message string) error {
+	s.router.route(
+		Message{Type: AppError, From: s.nodeID, To: nodeID},
+		func(to *vm.VM) {
+			_ = to.AppRequestFailed(context.Background(), s.nodeID, requestID, &common.AppError{
+				Code:    code,
+				Message: message,
+			})
+		},
+		func() { s.router.failRequest(nodeID, s.nodeID, requestID) },
+	)
+	return nil
+}
+
+// SendAppGossip sends gossip to the nodes of config, to every other validator
+// if it asks for any validator, to every other non-validator if it asks for
+// any non-validator, and to every other node if it asks for any peer
+func (s *sender) SendAppGossip(_ context.Context, config common.SendConfig, gossip []byte) error {
+	nodeIDs := set.Of(config.NodeIDs.List()...)
+	s.router.lock.Lock()
+	for nodeID := range s.router.nodes {
+		isValidator := s.router.validators == nil || s.router.validators.Contains(nodeID)
+		switch {
+		case config.Peers > 0,
+			config.Validators > 0 && isValidator,
+			config.NonValidators > 0 && !isValidator:
+			nodeIDs.Add(nodeID)
+		}
+	}
+	s.router.lock.Unlock()
+	nodeIDs.Remove(s.nodeID)
+
+	for nodeID := range nodeIDs {
+		s.router.route(
+			Message{Type: AppGossip, From: s.nodeID, To: nodeID},
+			func(to *vm.VM) {
+				_ = to.AppGossip(context.Background(), s.nodeID, gossip)
+			},
+			nil,
+		)
+	}
+	return nil
+}
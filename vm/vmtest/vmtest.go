@@ -0,0 +1,123 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+// Package vmtest provides helpers to run VMs in tests without touching the
+// filesystem, alone or as networks of in-process nodes.
+package vmtest
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/MetalBlockchain/metalgo/database/memdb"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/snow"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/snow/validators"
+	"github.com/MetalBlockchain/metalgo/utils/constants"
+	"github.com/MetalBlockchain/metalgo/utils/crypto/bls"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/MetalBlockchain/metalgo/vms/platformvm/warp"
+	"github.com/stretchr/testify/require"
+
+	btcd "github.com/MetalBlockchain/btcvm/btcd"
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/btcutil"
+	"github.com/MetalBlockchain/btcvm/vm"
+)
+
+// NewMemVM returns an initialized VM of a new test network whose chain is
+// kept in memory, mining to a new key. It is shut down when the test ends.
+func NewMemVM(t testing.TB) *vm.VM {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	return NewMemVMWithConfig(t, key, nil)
+}
+
+// NewMemVMWithConfig returns an initialized VM of a new test network whose
+// chain is kept in memory, mining to key with the node config configBytes.
+// The dbType of configBytes is always memdb. It is shut down when the test
+// ends.
+func NewMemVMWithConfig(t testing.TB, key *btcec.PrivateKey, configBytes []byte) *vm.VM {
+	configBytes = withConfig(t, configBytes, map[string]string{"dbType": `"memdb"`})
+	return newVM(t, ids.GenerateTestID(), ids.GenerateTestNodeID(), key, configBytes, nil, nil)
+}
+
+// withConfig returns configBytes with the fields of values, given as JSON,
+// set over those of configBytes
+func withConfig(t testing.TB, configBytes []byte, values map[string]string) []byte {
+	require := require.New(t)
+
+	config := map[string]json.RawMessage{}
+	if len(configBytes) != 0 {
+		require.NoError(json.Unmarshal(configBytes, &config))
+	}
+	for name, value := range values {
+		config[name] = json.RawMessage(value)
+	}
+	configBytes, err := json.Marshal(config)
+	require.NoError(err)
+	return configBytes
+}
+
+// newVM initializes the VM of the node nodeID for the chain chainID of a
+// test network, mining to key. It is shut down when the test ends.
+func newVM(
+	t testing.TB,
+	chainID ids.ID,
+	nodeID ids.NodeID,
+	key *btcec.PrivateKey,
+	configBytes []byte,
+	validatorState validators.State,
+	appSender common.AppSender,
+) *vm.VM {
+	require := require.New(t)
+
+	addr, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160(key.PubKey().SerializeCompressed()),
+		&btcd.BtcvmTestNetParms,
+	)
+	require.NoError(err)
+	sk, err := bls.NewSigner()
+	require.NoError(err)
+	newVM := &vm.VM{}
+	require.NoError(newVM.Initialize(
+		context.Background(),
+		&snow.Context{
+			NetworkID:      constants.UnitTestID,
+			ChainID:        chainID,
+			NodeID:         nodeID,
+			PublicKey:      sk.PublicKey(),
+			Log:            logging.NoLog{},
+			WarpSigner:     warp.NewSigner(sk, constants.UnitTestID, chainID),
+			ValidatorState: validatorState,
+		},
+		memdb.New(),
+		[]byte(`{"config":{"testNet":true,"miningAddrs":["`+addr.EncodeAddress()+`"]}}`),
+		nil,
+		configBytes,
+		make(chan common.Message, 1),
+		nil,
+		appSender,
+	))
+	t.Cleanup(func() {
+		require.NoError(newVM.Shutdown(context.Background()))
+	})
+	return newVM
+}
+
+// BuildChain builds, verifies and accepts numBlocks blocks on top of the
+// preferred block of the VM
+func BuildChain(t testing.TB, memVM *vm.VM, numBlocks int) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	for i := 0; i < numBlocks; i++ {
+		blk, err := memVM.BuildBlock(ctx)
+		require.NoError(err)
+		require.NoError(blk.Verify(ctx))
+		require.NoError(memVM.SetPreference(ctx, blk.ID()))
+		require.NoError(blk.Accept(ctx))
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/metalgo/cache"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/network/p2p/acp118"
+	"github.com/MetalBlockchain/metalgo/snow/engine/common"
+	"github.com/MetalBlockchain/metalgo/utils/logging"
+	"github.com/MetalBlockchain/metalgo/vms/platformvm/warp"
+	"github.com/MetalBlockchain/metalgo/vms/platformvm/warp/payload"
+	"go.uber.org/zap"
+)
+
+const (
+	// WarpSignatureHandlerID is the handler ID used to serve BLS signatures
+	// of warp messages making claims about the Bitcoin chain
+	WarpSignatureHandlerID = 103
+
+	// warpSignatureCacheSize is the number of signatures remembered to answer
+	// repeated requests without verifying their claims again
+	warpSignatureCacheSize = 512
+
+	// txConfirmedClaimLen is the length of an encoded TxConfirmedClaim
+	txConfirmedClaimLen = chainhash.HashSize + chainhash.HashSize + 4
+)
+
+var (
+	_ acp118.Verifier = (*warpVerifier)(nil)
+
+	// ErrWarpInvalidPayload is returned for messages of another chain or
+	// whose payload cannot be parsed
+	ErrWarpInvalidPayload = &common.AppError{
+		Code:    1,
+		Message: "invalid warp payload",
+	}
+	// ErrWarpUnsupportedPayload is returned for payloads that are not claims
+	// about the Bitcoin chain
+	ErrWarpUnsupportedPayload = &common.AppError{
+		Code:    2,
+		Message: "unsupported warp payload",
+	}
+	// ErrWarpUnverifiedClaim is returned for claims that do not hold on the
+	// accepted chain
+	ErrWarpUnverifiedClaim = &common.AppError{
+		Code:    3,
+		Message: "warp claim could not be verified",
+	}
+	// ErrWarpTxIndexDisabled is returned for transaction claims when the
+	// transaction index is disabled
+	ErrWarpTxIndexDisabled = &common.AppError{
+		Code:    4,
+		Message: "transaction index disabled",
+	}
+
+	errInvalidTxConfirmedClaim = errors.New("invalid transaction claim")
+	errTxIndexDisabled         = errors.New("transaction index disabled")
+)
+
+// TxConfirmedClaim claims that transaction TxID is confirmed in block
+// BlockHash at Height of the accepted chain. It is sent as the payload of an
+// AddressedCall without a source address, encoded as the transaction hash,
+// the block hash and the big-endian height.
+type TxConfirmedClaim struct {
+	TxID      chainhash.Hash
+	BlockHash chainhash.Hash
+	Height    uint32
+}
+
+// Bytes returns the encoding of the claim
+func (c *TxConfirmedClaim) Bytes() []byte {
+	bytes := make([]byte, txConfirmedClaimLen)
+	copy(bytes, c.TxID[:])
+	copy(bytes[chainhash.HashSize:], c.BlockHash[:])
+	binary.BigEndian.PutUint32(bytes[2*chainhash.HashSize:], c.Height)
+	return bytes
+}
+
+// ParseTxConfirmedClaim parses a claim encoded by Bytes
+func ParseTxConfirmedClaim(bytes []byte) (*TxConfirmedClaim, error) {
+	if len(bytes) != txConfirmedClaimLen {
+		return nil, fmt.Errorf("%w: length %d", errInvalidTxConfirmedClaim, len(bytes))
+	}
+	c := &TxConfirmedClaim{
+		Height: binary.BigEndian.Uint32(bytes[2*chainhash.HashSize:]),
+	}
+	copy(c.TxID[:], bytes)
+	copy(c.BlockHash[:], bytes[chainhash.HashSize:])
+	return c, nil
+}
+
+// warpVerifier decides which warp messages are signed. It signs messages of
+// this chain whose payload is either a Hash of an accepted block or an
+// AddressedCall carrying a TxConfirmedClaim that holds.
+type warpVerifier struct {
+	log logging.Logger
+	vm  *VM
+}
+
+// Verify returns nil if msg should be signed
+func (v *warpVerifier) Verify(
+	_ context.Context,
+	msg *warp.UnsignedMessage,
+	_ []byte,
+) *common.AppError {
+	if msg.NetworkID != v.vm.ctx.NetworkID || msg.SourceChainID != v.vm.ctx.ChainID {
+		v.log.Debug("refusing to sign warp message of another chain",
+			zap.Uint32("networkID", msg.NetworkID),
+			zap.Stringer("sourceChainID", msg.SourceChainID),
+		)
+		return ErrWarpInvalidPayload
+	}
+
+	parsed, err := payload.Parse(msg.Payload)
+	if err != nil {
+		v.log.Debug("failed to parse warp payload", zap.Error(err))
+		return ErrWarpInvalidPayload
+	}
+
+	switch p := parsed.(type) {
+	case *payload.Hash:
+		err = v.verifyBlockAccepted(idToHash(p.Hash))
+	case *payload.AddressedCall:
+		if len(p.SourceAddress) != 0 {
+			return ErrWarpUnsupportedPayload
+		}
+		claim, parseErr := ParseTxConfirmedClaim(p.Payload)
+		if parseErr != nil {
+			v.log.Debug("failed to parse warp claim", zap.Error(parseErr))
+			return ErrWarpInvalidPayload
+		}
+		err = v.verifyTxConfirmed(claim)
+	default:
+		return ErrWarpUnsupportedPayload
+	}
+	switch {
+	case errors.Is(err, errTxIndexDisabled):
+		return ErrWarpTxIndexDisabled
+	case err != nil:
+		v.log.Debug("failed to verify warp claim",
+			zap.Stringer("messageID", msg.ID()),
+			zap.Error(err),
+		)
+		return ErrWarpUnverifiedClaim
+	}
+	return nil
+}
+
+// verifyTxConfirmed returns nil if claim holds according to the transaction
+// index
+func (v *warpVerifier) verifyTxConfirmed(claim *TxConfirmedClaim) error {
+	txIndex := v.vm.btcdAdapter.TxIndex()
+	if txIndex == nil {
+		return errTxIndexDisabled
+	}
+
+	region, err := txIndex.TxBlockRegion(&claim.TxID)
+	if err != nil {
+		return fmt.Errorf("failed to look up transaction %s: %w", claim.TxID, err)
+	}
+	if region == nil {
+		return fmt.Errorf("unknown transaction %s", claim.TxID)
+	}
+	if !region.Hash.IsEqual(&claim.BlockHash) {
+		return fmt.Errorf("transaction %s is in block %s", claim.TxID, region.Hash)
+	}
+
+	height, err := v.vm.chain.BlockHeightByHash(&claim.BlockHash)
+	if err != nil {
+		return fmt.Errorf("block %s is not in the main chain: %w", claim.BlockHash, err)
+	}
+	if uint32(height) != claim.Height {
+		return fmt.Errorf("block %s is at height %d", claim.BlockHash, height)
+	}
+	return v.verifyBlockAccepted(&claim.BlockHash)
+}
+
+// verifyBlockAccepted returns nil if hash is a main chain block at or below
+// the last accepted block
+func (v *warpVerifier) verifyBlockAccepted(hash *chainhash.Hash) error {
+	height, err := v.vm.chain.BlockHeightByHash(hash)
+	if err != nil {
+		return fmt.Errorf("block %s is not in the main chain: %w", hash, err)
+	}
+
+	v.vm.blocksMu.RLock()
+	lastAccepted := v.vm.lastAccepted
+	v.vm.blocksMu.RUnlock()
+	acceptedHeight, err := v.vm.chain.BlockHeightByHash(idToHash(lastAccepted))
+	if err != nil {
+		return fmt.Errorf("failed to look up last accepted block: %w", err)
+	}
+	if height > acceptedHeight {
+		return fmt.Errorf("block %s at height %d is not accepted", hash, height)
+	}
+	return nil
+}
+
+// initializeWarp registers the warp signature handler if the node can sign
+// warp messages
+func (vm *VM) initializeWarp() error {
+	if vm.ctx.WarpSigner == nil {
+		vm.ctx.Log.Info("Warp signing disabled, no signer available")
+		return nil
+	}
+
+	handler := acp118.NewCachedHandler(
+		&cache.LRU[ids.ID, []byte]{Size: warpSignatureCacheSize},
+		&warpVerifier{
+			log: vm.ctx.Log,
+			vm:  vm,
+		},
+		vm.ctx.WarpSigner,
+	)
+	if err := vm.p2pNetwork.AddHandler(WarpSignatureHandlerID, handler); err != nil {
+		return fmt.Errorf("failed to register warp signature handler: %w", err)
+	}
+	vm.ctx.Log.Info("Registered warp signature handler",
+		zap.Uint64("handlerID", WarpSignatureHandlerID))
+	return nil
+}
@@ -0,0 +1,193 @@
+// Copyright (C) 2024-2025, Metallicus, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MetalBlockchain/btcvm/btcd/btcec/v2"
+	"github.com/MetalBlockchain/btcvm/btcd/chaincfg/chainhash"
+	"github.com/MetalBlockchain/metalgo/ids"
+	"github.com/MetalBlockchain/metalgo/proto/pb/sdk"
+	"github.com/MetalBlockchain/metalgo/utils/crypto/bls"
+	"github.com/MetalBlockchain/metalgo/utils/set"
+	"github.com/MetalBlockchain/metalgo/vms/platformvm/warp"
+	"github.com/MetalBlockchain/metalgo/vms/platformvm/warp/payload"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTxConfirmedClaim(t *testing.T) {
+	require := require.New(t)
+
+	claim := &TxConfirmedClaim{
+		TxID:      chainhash.Hash{1},
+		BlockHash: chainhash.Hash{2},
+		Height:    3,
+	}
+	parsed, err := ParseTxConfirmedClaim(claim.Bytes())
+	require.NoError(err)
+	require.Equal(claim, parsed)
+
+	_, err = ParseTxConfirmedClaim(claim.Bytes()[1:])
+	require.ErrorIs(err, errInvalidTxConfirmedClaim)
+}
+
+func TestWarpSignatureRequests(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	vms := newTestVMsWithConfig(t, 2, key, `"txIndex":true`, nil)
+	server, client := vms[0], vms[1]
+
+	// The coinbase of the first block is spent in the second block, which is
+	// accepted. A third block is built but not accepted.
+	buildBlock := func(accept bool) *BlockAdapter {
+		blk, err := server.BuildBlock(ctx)
+		require.NoError(err)
+		require.NoError(blk.Verify(ctx))
+		require.NoError(server.SetPreference(ctx, blk.ID()))
+		if accept {
+			require.NoError(blk.Accept(ctx))
+		}
+		return blk.(*BlockAdapter)
+	}
+	coinbase := buildBlock(true).btcBlock.Transactions()[0].MsgTx()
+	spend := newTestSpend(t, key, coinbase)
+	_, err = server.btcdAdapter.TxMemPool().ProcessTransaction(spend, false, false, 0)
+	require.NoError(err)
+	confirmed := buildBlock(true)
+	require.Len(confirmed.btcBlock.Transactions(), 2)
+	pending := buildBlock(false)
+
+	// requestSignature asks the server to sign a message of payloadBytes from
+	// the client and checks the signature it returns
+	p2pClient := client.p2pNetwork.NewClient(WarpSignatureHandlerID)
+	requestSignature := func(networkID uint32, payloadBytes []byte) error {
+		msg, err := warp.NewUnsignedMessage(networkID, server.ctx.ChainID, payloadBytes)
+		require.NoError(err)
+		requestBytes, err := proto.Marshal(&sdk.SignatureRequest{Message: msg.Bytes()})
+		require.NoError(err)
+
+		type result struct {
+			response []byte
+			err      error
+		}
+		done := make(chan result, 1)
+		require.NoError(p2pClient.AppRequest(ctx, set.Of(server.ctx.NodeID), requestBytes,
+			func(_ context.Context, _ ids.NodeID, responseBytes []byte, err error) {
+				done <- result{responseBytes, err}
+			},
+		))
+		select {
+		case r := <-done:
+			if r.err != nil {
+				return r.err
+			}
+			response := &sdk.SignatureResponse{}
+			require.NoError(proto.Unmarshal(r.response, response))
+
+			// The signature is the server's signature of the message
+			signature, err := bls.SignatureFromBytes(response.Signature)
+			require.NoError(err)
+			require.True(bls.Verify(server.ctx.PublicKey, signature, msg.Bytes()))
+			return nil
+		case <-time.After(10 * time.Second):
+			require.FailNow("signature request timed out")
+			return nil
+		}
+	}
+	txClaim := func(claim *TxConfirmedClaim) []byte {
+		addressedCall, err := payload.NewAddressedCall(nil, claim.Bytes())
+		require.NoError(err)
+		return addressedCall.Bytes()
+	}
+	blockClaim := func(hash *chainhash.Hash) []byte {
+		hashPayload, err := payload.NewHash(hashToID(hash))
+		require.NoError(err)
+		return hashPayload.Bytes()
+	}
+
+	validClaim := &TxConfirmedClaim{
+		TxID:      *spend.Hash(),
+		BlockHash: *confirmed.btcBlock.Hash(),
+		Height:    uint32(confirmed.Height()),
+	}
+	unsupported, err := payload.NewAddressedCall([]byte{1}, validClaim.Bytes())
+	require.NoError(err)
+
+	tests := []struct {
+		name         string
+		networkID    uint32
+		payloadBytes []byte
+		expectedErr  error
+	}{
+		{
+			name:         "confirmed transaction",
+			payloadBytes: txClaim(validClaim),
+		},
+		{
+			name: "unknown transaction",
+			payloadBytes: txClaim(&TxConfirmedClaim{
+				TxID:      chainhash.Hash{1},
+				BlockHash: validClaim.BlockHash,
+				Height:    validClaim.Height,
+			}),
+			expectedErr: ErrWarpUnverifiedClaim,
+		},
+		{
+			name: "wrong height",
+			payloadBytes: txClaim(&TxConfirmedClaim{
+				TxID:      validClaim.TxID,
+				BlockHash: validClaim.BlockHash,
+				Height:    validClaim.Height + 1,
+			}),
+			expectedErr: ErrWarpUnverifiedClaim,
+		},
+		{
+			name:         "accepted block",
+			payloadBytes: blockClaim(confirmed.btcBlock.Hash()),
+		},
+		{
+			name:         "block not accepted yet",
+			payloadBytes: blockClaim(pending.btcBlock.Hash()),
+			expectedErr:  ErrWarpUnverifiedClaim,
+		},
+		{
+			name:         "addressed call with a source address",
+			payloadBytes: unsupported.Bytes(),
+			expectedErr:  ErrWarpUnsupportedPayload,
+		},
+		{
+			name:         "invalid payload",
+			payloadBytes: []byte("payload"),
+			expectedErr:  ErrWarpInvalidPayload,
+		},
+		{
+			name:         "other network",
+			networkID:    1,
+			payloadBytes: txClaim(validClaim),
+			expectedErr:  ErrWarpInvalidPayload,
+		},
+	}
+	for _, test := range tests {
+		networkID := server.ctx.NetworkID
+		if test.networkID != 0 {
+			networkID = test.networkID
+		}
+		err := requestSignature(networkID, test.payloadBytes)
+		require.ErrorIs(err, test.expectedErr, test.name)
+	}
+
+	// Transaction claims cannot be verified without the transaction index
+	vm := newTestVMs(t, 1, key)[0]
+	msg, err := warp.NewUnsignedMessage(vm.ctx.NetworkID, vm.ctx.ChainID, txClaim(validClaim))
+	require.NoError(err)
+	verifier := &warpVerifier{log: vm.ctx.Log, vm: vm}
+	require.Equal(ErrWarpTxIndexDisabled, verifier.Verify(ctx, msg, nil))
+}